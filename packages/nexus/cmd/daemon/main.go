@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/inizio/nexus/packages/nexus/pkg/auth"
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
 	"github.com/inizio/nexus/packages/nexus/pkg/daemonclient"
 	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
 	"github.com/inizio/nexus/packages/nexus/pkg/runtime/drivers/shared"
@@ -125,6 +126,11 @@ func runServer(port int, workspaceDir string, token string) error {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 	srv.SetAuthProvider(auth.NewLocalTokenProvider(token))
+	if nodeCfg, err := config.LoadNodeConfig(""); err != nil {
+		log.Printf("node config: %v; using defaults", err)
+	} else {
+		srv.SetNodeConfig(nodeCfg)
+	}
 
 	runner := &CommandRunner{}
 
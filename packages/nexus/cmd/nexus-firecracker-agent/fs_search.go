@@ -0,0 +1,114 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filesearch"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+// fsSearchNotFoundExit is the exit code of an fs.find or fs.grep whose
+// starting path does not exist.
+const fsSearchNotFoundExit = 2
+
+// handleFSSearch runs fs.find or fs.grep over the guest workspace, for
+// workspaces whose files only exist inside the VM. The params are the
+// search options plus the workspace-relative path to start from. Every hit
+// is sent as a "match" chunk; the closing result carries the stats as
+// stdout.
+func handleFSSearch(req execRequest, c *shellConn) {
+	fail := func(err error) {
+		code := 1
+		if errors.Is(err, os.ErrNotExist) {
+			code = fsSearchNotFoundExit
+		}
+		c.send(execResponse{ID: req.ID, Type: "result", ExitCode: code, Stderr: err.Error()})
+	}
+	var p struct {
+		Path string `json:"path"`
+	}
+	var findOpts filesearch.FindOptions
+	var grepOpts filesearch.GrepOptions
+	if len(req.Params) > 0 {
+		opts := any(&grepOpts)
+		if req.Type == "fs.find" {
+			opts = &findOpts
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			fail(fmt.Errorf("invalid params: %w", err))
+			return
+		}
+		if err := json.Unmarshal(req.Params, opts); err != nil {
+			fail(fmt.Errorf("invalid params: %w", err))
+			return
+		}
+	}
+	ws, rel, err := guestWorkspacePath(req.WorkDir, p.Path)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// The search stops once the host hangs up.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	emit := func(v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		err = c.enc.Encode(execResponse{ID: req.ID, Type: "chunk", Stream: "match", Data: string(data)})
+		c.mu.Unlock()
+		if err != nil {
+			cancel()
+		}
+	}
+
+	var stats any
+	switch req.Type {
+	case "fs.find":
+		stats, err = filesearch.Find(ctx, ws.Path(), rel, findOpts, func(m filesearch.FindMatch) { emit(m) })
+	default:
+		stats, err = filesearch.Grep(ctx, ws.Path(), rel, grepOpts, func(m filesearch.GrepMatch) { emit(m) })
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	out, _ := json.Marshal(stats)
+	c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 0, Stdout: string(out)})
+}
+
+// guestWorkspacePath resolves path inside the workspace rooted at workdir
+// (the mount point by default), mounting the workspace disk if needed. It
+// returns the workspace and the path relative to its root.
+func guestWorkspacePath(workdir, path string) (*workspace.Workspace, string, error) {
+	root := workspaceMountPoint
+	if strings.TrimSpace(workdir) != "" {
+		root = workdir
+	}
+	if root == workspaceMountPoint || strings.HasPrefix(root, workspaceMountPoint+"/") {
+		if err := setupWorkspaceMountRequiredFunc(); err != nil {
+			return nil, "", fmt.Errorf("workspace mount ensure failed: %w", err)
+		}
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		return nil, "", err
+	}
+	safePath, err := ws.SecurePath(path)
+	if err != nil {
+		return nil, "", err
+	}
+	rel, _ := filepath.Rel(ws.Path(), safePath)
+	return ws, rel, nil
+}
@@ -0,0 +1,68 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filesearch"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/drivers/shared"
+)
+
+func TestServeConnGrepsGuestWorkspace(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "src", "main.go"), []byte("package main\n// TODO: fix\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := shared.BufferedPipe()
+	defer client.Close()
+	go serveConn(server)
+
+	enc := json.NewEncoder(client)
+	dec := json.NewDecoder(client)
+	if err := enc.Encode(map[string]any{"id": "grep-1", "type": "fs.grep", "workdir": root, "params": map[string]any{"path": "src", "pattern": "TODO"}}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var chunk execResponse
+	if err := dec.Decode(&chunk); err != nil {
+		t.Fatalf("decode chunk: %v", err)
+	}
+	var m filesearch.GrepMatch
+	if chunk.Type != "chunk" || chunk.Stream != "match" || json.Unmarshal([]byte(chunk.Data), &m) != nil || m.Path != "src/main.go" || m.Line != 2 || m.Column != 4 {
+		t.Fatalf("unexpected match chunk %+v", chunk)
+	}
+	var result execResponse
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	var stats filesearch.GrepStats
+	if result.Type != "result" || result.ExitCode != 0 || json.Unmarshal([]byte(result.Stdout), &stats) != nil || stats.Count != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if err := enc.Encode(map[string]any{"id": "find-1", "type": "fs.find", "workdir": root, "params": map[string]any{"path": "missing"}}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if result.ExitCode != fsSearchNotFoundExit {
+		t.Fatalf("expected not-found exit, got %+v", result)
+	}
+	if err := enc.Encode(map[string]any{"id": "find-2", "type": "fs.find", "workdir": root, "params": map[string]any{"path": "../etc"}}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := dec.Decode(&result); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if result.ExitCode != 1 || result.Stderr == "" {
+		t.Fatalf("expected traversal to be refused, got %+v", result)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filewatch"
+)
+
+// handleFSWatch turns conn into an fs.changed stream for a subtree of the
+// guest workspace. Once the watch is in place an fs.watching message is
+// sent; batches of events follow until the host closes the connection. A
+// watch that cannot start ends with a failed result instead, using
+// fsSearchNotFoundExit for a missing path.
+func handleFSWatch(conn net.Conn, req execRequest, encoder *json.Encoder) {
+	fail := func(err error) {
+		code := 1
+		if errors.Is(err, os.ErrNotExist) {
+			code = fsSearchNotFoundExit
+		}
+		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: code, Stderr: err.Error()})
+	}
+	var p struct {
+		Path string `json:"path"`
+		filewatch.Options
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			fail(fmt.Errorf("invalid params: %w", err))
+			return
+		}
+	}
+	ws, rel, err := guestWorkspacePath(req.WorkDir, p.Path)
+	if err != nil {
+		fail(err)
+		return
+	}
+	w, err := filewatch.New(ws.Path(), rel, p.Options)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer w.Close()
+	if err := encoder.Encode(map[string]any{"id": req.ID, "type": "fs.watching"}); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+	err = w.Run(ctx, func(events []filewatch.Event) {
+		if encoder.Encode(map[string]any{"id": req.ID, "type": "fs.changed", "events": events}) != nil {
+			cancel()
+		}
+	})
+	if err != nil {
+		fail(err)
+	}
+}
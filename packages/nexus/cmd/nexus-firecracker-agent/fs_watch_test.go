@@ -0,0 +1,63 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filewatch"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/drivers/shared"
+)
+
+func TestServeConnWatchesGuestWorkspace(t *testing.T) {
+	root := t.TempDir()
+	server, client := shared.BufferedPipe()
+	defer client.Close()
+	go serveConn(server)
+
+	enc := json.NewEncoder(client)
+	dec := json.NewDecoder(client)
+	if err := enc.Encode(map[string]any{"id": "watch-1", "type": "fs.watch", "workdir": root, "params": map[string]any{"debounceMs": 10}}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var ready map[string]any
+	if err := dec.Decode(&ready); err != nil || ready["type"] != "fs.watching" {
+		t.Fatalf("expected fs.watching, got %#v (%v)", ready, err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg struct {
+		Type   string            `json:"type"`
+		Events []filewatch.Event `json:"events"`
+	}
+	if err := dec.Decode(&msg); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if msg.Type != "fs.changed" || len(msg.Events) == 0 || msg.Events[0].Path != "a.txt" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+}
+
+func TestServeConnWatchRefusesMissingPath(t *testing.T) {
+	server, client := shared.BufferedPipe()
+	defer client.Close()
+	go serveConn(server)
+
+	if err := json.NewEncoder(client).Encode(map[string]any{"id": "watch-1", "type": "fs.watch", "workdir": t.TempDir(), "params": map[string]any{"path": "missing"}}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var result execResponse
+	if err := json.NewDecoder(client).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if result.Type != "result" || result.ExitCode != fsSearchNotFoundExit {
+		t.Fatalf("expected not-found result, got %+v", result)
+	}
+}
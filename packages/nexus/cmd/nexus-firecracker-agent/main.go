@@ -19,6 +19,8 @@ import (
 	"sync"
 	"time"
 
+	creackpty "github.com/creack/pty"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/drivers/shared"
 	"github.com/inizio/nexus/packages/nexus/pkg/runtime/firecracker"
 	"github.com/mdlayher/vsock"
 	"golang.org/x/sys/unix"
@@ -54,6 +56,15 @@ type execRequest struct {
 	Env     []string `json:"env,omitempty"`
 	Stream  bool     `json:"stream,omitempty"`
 	Data    string   `json:"data,omitempty"`
+	// Persist keeps a shell.open shell running after the connection drops.
+	Persist bool `json:"persist,omitempty"`
+	// Since is the output seq a shell.attach replays from.
+	Since uint64 `json:"since,omitempty"`
+	Cols  int    `json:"cols,omitempty"`
+	Rows  int    `json:"rows,omitempty"`
+	// Params carries the options of requests that are not commands, such
+	// as fs.find and fs.grep.
+	Params json.RawMessage `json:"params,omitempty"`
 }
 
 type execResponse struct {
@@ -64,21 +75,68 @@ type execResponse struct {
 	ExitCode int    `json:"exit_code"`
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
+	Seq      uint64 `json:"seq,omitempty"`
+	// Features answers agent.features.
+	Features []string `json:"features,omitempty"`
 }
 
-type shellSession struct {
-	id   string
-	cmd  *exec.Cmd
-	in   io.WriteCloser
-	out  io.ReadCloser
-	err  io.ReadCloser
-	done chan int
+// agentFeatures lists what this agent supports beyond the original shell
+// protocol. Hosts only ask for persistent shells when it includes
+// "shell.persist", and fall back to tmux otherwise.
+var agentFeatures = []string{"shell.persist"}
+
+// agentShells holds the shells of every connection. Persistent shells stay
+// here after their connection drops so the host can attach again.
+var agentShells = shared.NewShells()
+
+// shellConn is the shell side of one host connection.
+type shellConn struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// attached maps the shells this connection receives output from to
+	// their sinks; current is the shell opened or attached last, which
+	// writes and resizes address when their ID names no shell.
+	attached map[string]*shared.ShellSink
+	current  string
 }
 
-var (
-	shellSessions   = map[string]*shellSession{}
-	shellSessionsMu sync.Mutex
-)
+func newShellConn(enc *json.Encoder) *shellConn {
+	return &shellConn{enc: enc, attached: make(map[string]*shared.ShellSink)}
+}
+
+func (c *shellConn) send(resp execResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.enc.Encode(resp)
+}
+
+func (c *shellConn) sink(id string) *shared.ShellSink {
+	return &shared.ShellSink{
+		Chunk: func(data string, seq uint64) {
+			c.send(execResponse{ID: id, Type: "chunk", Stream: "stdout", Data: data, Seq: seq})
+		},
+		Exit: func(code int) {
+			c.send(execResponse{ID: id, Type: "result", ExitCode: code})
+		},
+	}
+}
+
+func (c *shellConn) shell(id string) *shared.Shell {
+	if s := agentShells.Get(id); s != nil {
+		return s
+	}
+	return agentShells.Get(c.current)
+}
+
+// detachAll runs when the connection ends: persistent shells keep running
+// and the others are killed.
+func (c *shellConn) detachAll() {
+	for id, sink := range c.attached {
+		if s := agentShells.Get(id); s != nil {
+			s.Detach(sink)
+		}
+	}
+}
 
 func handleExec(req execRequest) execResponse {
 	ctx, cancel := context.WithTimeout(context.Background(), agentExecTimeout())
@@ -134,13 +192,22 @@ func handleExec(req execRequest) execResponse {
 	}
 }
 
+// streamResultTail bounds the output of a streamed exec repeated in its
+// result. The chunks already carried all of it, and a follow may never end.
+const streamResultTail = 256 * 1024
+
+// streamOutput sends r as chunks and returns the last streamResultTail
+// bytes of it.
 func streamOutput(encoder *json.Encoder, id, stream string, r io.Reader) string {
-	var buf strings.Builder
+	var tail []byte
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
 	for scanner.Scan() {
 		line := scanner.Text() + "\n"
-		buf.WriteString(line)
+		tail = append(tail, line...)
+		if len(tail) > streamResultTail {
+			tail = append(tail[:0], tail[len(tail)-streamResultTail:]...)
+		}
 		_ = encoder.Encode(execResponse{
 			ID:     id,
 			Type:   "chunk",
@@ -148,7 +215,7 @@ func streamOutput(encoder *json.Encoder, id, stream string, r io.Reader) string
 			Data:   line,
 		})
 	}
-	return buf.String()
+	return string(tail)
 }
 
 func handleExecStreaming(req execRequest, encoder *json.Encoder) execResponse {
@@ -228,6 +295,17 @@ func agentExecTimeout() time.Duration {
 	return time.Duration(seconds) * time.Second
 }
 
+// agentShellIdleTimeout is how long a detached persistent shell is kept
+// running without anyone attaching to it.
+func agentShellIdleTimeout() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("AGENT_SHELL_IDLE_SEC"))
+	seconds, err := strconv.Atoi(raw)
+	if raw == "" || err != nil || seconds <= 0 {
+		return shared.DefaultShellIdleTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 func ensurePathInEnv(env []string) []string {
 	for i, entry := range env {
 		if !strings.HasPrefix(entry, "PATH=") {
@@ -277,6 +355,8 @@ func serveConn(conn net.Conn) {
 
 	decoder := json.NewDecoder(conn)
 	encoder := json.NewEncoder(conn)
+	shells := newShellConn(encoder)
+	defer shells.detachAll()
 
 	for {
 		// Parse request
@@ -297,8 +377,21 @@ func serveConn(conn net.Conn) {
 			continue
 		}
 
+		if req.Type == "ports.watch" {
+			handlePortsWatch(conn, req, encoder)
+			return
+		}
+		if req.Type == "fs.watch" {
+			handleFSWatch(conn, req, encoder)
+			return
+		}
+		if req.Type == "socket.connect" {
+			handleSocketConnect(conn, decoder, req, encoder)
+			return
+		}
+
 		if strings.TrimSpace(req.Type) != "" {
-			handleShellRequest(req, encoder)
+			handleShellRequest(req, shells)
 			continue
 		}
 
@@ -318,32 +411,42 @@ func serveConn(conn net.Conn) {
 	}
 }
 
-func handleShellRequest(req execRequest, encoder *json.Encoder) {
+func handleShellRequest(req execRequest, c *shellConn) {
 	switch req.Type {
+	case "agent.features":
+		c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 0, Features: agentFeatures})
 	case "shell.open":
-		handleShellOpen(req, encoder)
+		handleShellOpen(req, c)
+	case "shell.attach":
+		handleShellAttach(req, c)
 	case "shell.write":
-		handleShellWrite(req, encoder)
+		handleShellWrite(req, c)
 	case "shell.resize":
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 0})
+		handleShellResize(req, c)
 	case "shell.close":
-		handleShellClose(req, encoder)
+		handleShellClose(req, c)
+	case "fs.find", "fs.grep":
+		handleFSSearch(req, c)
+	case "ports.scan":
+		c.mu.Lock()
+		handlePortsScan(req, c.enc)
+		c.mu.Unlock()
 	case "disk.grow":
 		out, growErr := exec.Command("resize2fs", workspaceDevicePath).CombinedOutput()
 		if growErr != nil {
-			_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: string(out)})
+			c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: string(out)})
 		} else {
-			_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 0})
+			c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 0})
 		}
 	default:
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: "unknown shell request type"})
+		c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: "unknown shell request type"})
 	}
 }
 
-func handleShellOpen(req execRequest, encoder *json.Encoder) {
-	ctx, cancel := context.WithTimeout(context.Background(), agentExecTimeout())
-	defer cancel()
-
+// handleShellOpen starts a shell. Persistent shells run on a terminal, since
+// they stand in for a tmux session; the others keep the plain pipes they
+// always had.
+func handleShellOpen(req execRequest, c *shellConn) {
 	env := append([]string{}, os.Environ()...)
 	env = ensurePathInEnv(env)
 
@@ -353,7 +456,7 @@ func handleShellOpen(req execRequest, encoder *json.Encoder) {
 	}
 	if workDir == workspaceMountPoint || strings.HasPrefix(workDir, workspaceMountPoint+"/") {
 		if err := setupWorkspaceMountRequiredFunc(); err != nil {
-			_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: fmt.Sprintf("workspace mount ensure failed: %v", err)})
+			c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: fmt.Sprintf("workspace mount ensure failed: %v", err)})
 			return
 		}
 	}
@@ -363,58 +466,48 @@ func handleShellOpen(req execRequest, encoder *json.Encoder) {
 		shell = "bash"
 	}
 
-	cmd := exec.CommandContext(ctx, shell, "-l")
+	// The shell lives until it exits or is closed, so it gets no exec timeout.
+	cmd := exec.Command(shell, "-l")
 	cmd.Dir = workDir
 	cmd.Env = env
 
-	in, err := cmd.StdinPipe()
-	if err != nil {
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
-		return
-	}
-	out, err := cmd.StdoutPipe()
+	opts, outputs, err := startShellProcess(cmd, req)
 	if err != nil {
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
+		c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
 		return
 	}
-	errOut, err := cmd.StderrPipe()
+	sink := c.sink(req.ID)
+	s, err := agentShells.Add(req.ID, opts, sink)
 	if err != nil {
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
+		opts.Kill()
+		c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
 		return
 	}
-
-	if err := cmd.Start(); err != nil {
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
-		return
+	c.attached[req.ID] = sink
+	c.current = req.ID
+
+	c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 0})
+
+	var readers sync.WaitGroup
+	for _, out := range outputs {
+		readers.Add(1)
+		go func(out io.Reader) {
+			defer readers.Done()
+			buf := make([]byte, 4096)
+			for {
+				n, err := out.Read(buf)
+				if n > 0 {
+					s.Output(buf[:n])
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(out)
 	}
 
-	s := &shellSession{id: req.ID, cmd: cmd, in: in, out: out, err: errOut, done: make(chan int, 1)}
-
-	shellSessionsMu.Lock()
-	shellSessions[req.ID] = s
-	shellSessionsMu.Unlock()
-
-	_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 0})
-
-	go func() {
-		scan := bufio.NewScanner(out)
-		scan.Buffer(make([]byte, 0, 4096), 1024*1024)
-		for scan.Scan() {
-			line := scan.Text() + "\n"
-			_ = encoder.Encode(execResponse{ID: req.ID, Type: "chunk", Stream: "stdout", Data: line})
-		}
-	}()
-
-	go func() {
-		scan := bufio.NewScanner(errOut)
-		scan.Buffer(make([]byte, 0, 4096), 1024*1024)
-		for scan.Scan() {
-			line := scan.Text() + "\n"
-			_ = encoder.Encode(execResponse{ID: req.ID, Type: "chunk", Stream: "stderr", Data: line})
-		}
-	}()
-
 	go func() {
+		readers.Wait()
 		err := cmd.Wait()
 		exitCode := 0
 		if err != nil {
@@ -424,54 +517,111 @@ func handleShellOpen(req execRequest, encoder *json.Encoder) {
 				exitCode = 1
 			}
 		}
-		s.done <- exitCode
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: exitCode})
-		shellSessionsMu.Lock()
-		delete(shellSessions, req.ID)
-		shellSessionsMu.Unlock()
+		s.Exited(exitCode)
 	}()
 }
 
-func handleShellWrite(req execRequest, encoder *json.Encoder) {
-	shellSessionsMu.Lock()
-	s, ok := shellSessions[req.ID]
-	shellSessionsMu.Unlock()
-	if !ok {
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: "shell session not found"})
-		return
+// startShellProcess starts cmd on a terminal when req asks for a
+// persistent shell and on pipes otherwise, returning what to read its
+// output from.
+func startShellProcess(cmd *exec.Cmd, req execRequest) (shared.ShellOptions, []io.Reader, error) {
+	kill := func() {
+		if cmd.Process != nil {
+			_ = cmd.Process.Kill()
+		}
+	}
+	if req.Persist {
+		cmd.Env = append(cmd.Env, "TERM=xterm-256color")
+		size := &creackpty.Winsize{Cols: 80, Rows: 24}
+		if req.Cols > 0 && req.Rows > 0 {
+			size = &creackpty.Winsize{Cols: uint16(req.Cols), Rows: uint16(req.Rows)}
+		}
+		ptmx, err := creackpty.StartWithSize(cmd, size)
+		if err != nil {
+			return shared.ShellOptions{}, nil, err
+		}
+		return shared.ShellOptions{
+			Persistent: true,
+			Input:      ptmx,
+			Resize: func(cols, rows int) error {
+				return creackpty.Setsize(ptmx, &creackpty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+			},
+			Kill: kill,
+		}, []io.Reader{ptmx}, nil
 	}
 
-	if _, err := io.WriteString(s.in, req.Data); err != nil {
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
-		return
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return shared.ShellOptions{}, nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return shared.ShellOptions{}, nil, err
+	}
+	errOut, err := cmd.StderrPipe()
+	if err != nil {
+		return shared.ShellOptions{}, nil, err
 	}
+	if err := cmd.Start(); err != nil {
+		return shared.ShellOptions{}, nil, err
+	}
+	return shared.ShellOptions{Input: in, Kill: kill}, []io.Reader{out, errOut}, nil
+}
 
-	_ = encoder.Encode(execResponse{ID: req.ID, Type: "ack", ExitCode: 0})
+// handleShellAttach connects to a shell opened earlier, typically by a
+// previous daemon, replaying its output after req.Since.
+func handleShellAttach(req execRequest, c *shellConn) {
+	s := agentShells.Get(req.ID)
+	if s == nil {
+		c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: "shell session not found"})
+		return
+	}
+	sink := c.sink(req.ID)
+	c.attached[req.ID] = sink
+	c.current = req.ID
+	c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 0})
+	s.Attach(req.Since, sink)
 }
 
-func handleShellClose(req execRequest, encoder *json.Encoder) {
-	shellSessionsMu.Lock()
-	s, ok := shellSessions[req.ID]
-	if ok {
-		delete(shellSessions, req.ID)
+func handleShellWrite(req execRequest, c *shellConn) {
+	s := c.shell(req.ID)
+	if s == nil {
+		c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: "shell session not found"})
+		return
 	}
-	shellSessionsMu.Unlock()
 
-	if !ok {
-		_ = encoder.Encode(execResponse{ID: req.ID, Type: "ack", ExitCode: 0})
+	if err := s.Write([]byte(req.Data)); err != nil {
+		c.send(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
 		return
 	}
 
-	if s.cmd.Process != nil {
-		_ = s.cmd.Process.Kill()
+	c.send(execResponse{ID: req.ID, Type: "ack", ExitCode: 0})
+}
+
+// handleShellResize answers with an ack even on failure: the host reads a
+// result as the shell's exit.
+func handleShellResize(req execRequest, c *shellConn) {
+	if s := c.shell(req.ID); s != nil && req.Cols > 0 && req.Rows > 0 {
+		if err := s.Resize(req.Cols, req.Rows); err != nil {
+			c.send(execResponse{ID: req.ID, Type: "ack", ExitCode: 1, Stderr: err.Error()})
+			return
+		}
+	}
+	c.send(execResponse{ID: req.ID, Type: "ack", ExitCode: 0})
+}
+
+func handleShellClose(req execRequest, c *shellConn) {
+	if s := c.shell(req.ID); s != nil {
+		s.Close()
 	}
-	_ = encoder.Encode(execResponse{ID: req.ID, Type: "ack", ExitCode: 0})
+	c.send(execResponse{ID: req.ID, Type: "ack", ExitCode: 0})
 }
 
 func main() {
 	emitDiagnostic("agent boot pid=%d", os.Getpid())
 
 	bootstrapGuestEnvironment(os.Getpid())
+	agentShells.SetReapTimeouts(agentShellIdleTimeout(), shared.DefaultShellExitedTTL)
 
 	listener, transport, err := resolveListener()
 	if err != nil {
@@ -721,6 +871,9 @@ func mountKernelFilesystems() {
 	_ = kernelMountFunc("proc", "/proc", "proc", 0, "")
 	_ = kernelMountFunc("sysfs", "/sys", "sysfs", 0, "")
 	_ = kernelMountFunc("devtmpfs", "/dev", "devtmpfs", 0, "")
+	// Persistent shells run on a terminal.
+	_ = kernelMkdirAll("/dev/pts", 0o755)
+	_ = kernelMountFunc("devpts", "/dev/pts", "devpts", 0, "ptmxmode=0666")
 	mountCgroupFilesystems()
 }
 
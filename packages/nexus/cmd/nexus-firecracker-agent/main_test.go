@@ -5,13 +5,13 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/drivers/shared"
 	"golang.org/x/sys/unix"
 )
 
@@ -85,7 +85,7 @@ func TestHandleExecSetsDefaultPathWhenPathMissing(t *testing.T) {
 }
 
 func TestServeConnSendsErrorOnDecodeFailure(t *testing.T) {
-	server, client := net.Pipe()
+	server, client := shared.BufferedPipe()
 	defer server.Close()
 	defer client.Close()
 
@@ -118,7 +118,7 @@ func TestServeConnSendsErrorOnDecodeFailure(t *testing.T) {
 }
 
 func TestServeConnRejectsMissingRequestID(t *testing.T) {
-	server, client := net.Pipe()
+	server, client := shared.BufferedPipe()
 	defer server.Close()
 	defer client.Close()
 
@@ -166,7 +166,7 @@ func TestServeConnRejectsMissingRequestID(t *testing.T) {
 }
 
 func TestServeConnHonorsWorkDirField(t *testing.T) {
-	server, client := net.Pipe()
+	server, client := shared.BufferedPipe()
 	defer server.Close()
 	defer client.Close()
 
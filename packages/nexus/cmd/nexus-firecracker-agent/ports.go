@@ -0,0 +1,219 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// portWatchInterval is how often the guest re-reads /proc/net/tcp{,6} for a
+// ports.watch subscription. Reading procfs locally is cheap, so this can be
+// much tighter than the host-side polling it replaces.
+var portWatchInterval = 500 * time.Millisecond
+
+var procRoot = "/proc"
+
+type listeningPort struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Process string `json:"process,omitempty"`
+	inode   string
+}
+
+// handlePortsScan answers a one-shot ports.scan request.
+func handlePortsScan(req execRequest, encoder *json.Encoder) {
+	ports, err := scanListeningPorts()
+	if err != nil {
+		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
+		return
+	}
+	_ = encoder.Encode(map[string]any{"id": req.ID, "type": "ports.result", "ports": ports})
+}
+
+// handlePortsWatch turns conn into a ports.changed stream. The current set
+// is sent immediately and again whenever it changes, until the host closes
+// the connection.
+func handlePortsWatch(conn net.Conn, req execRequest, encoder *json.Encoder) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	ticker := time.NewTicker(portWatchInterval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		ports, err := scanListeningPorts()
+		if err == nil {
+			key := portSetKey(ports)
+			if key != last {
+				last = key
+				if err := encoder.Encode(map[string]any{"id": req.ID, "type": "ports.changed", "ports": ports}); err != nil {
+					return
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func scanListeningPorts() ([]listeningPort, error) {
+	var all []listeningPort
+	var firstErr error
+	for _, name := range []string{"tcp", "tcp6"} {
+		f, err := os.Open(filepath.Join(procRoot, "net", name))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ports, err := parseProcNetTCP(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse /proc/net/%s: %w", name, err)
+		}
+		all = append(all, ports...)
+	}
+	if all == nil && firstErr != nil {
+		return nil, firstErr
+	}
+
+	seen := make(map[int]bool, len(all))
+	out := make([]listeningPort, 0, len(all))
+	for _, p := range all {
+		if seen[p.Port] {
+			continue
+		}
+		seen[p.Port] = true
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+
+	if len(out) > 0 {
+		owners := socketOwners()
+		for i := range out {
+			out[i].Process = owners[out[i].inode]
+		}
+	}
+	return out, nil
+}
+
+// parseProcNetTCP returns the sockets in LISTEN state from a /proc/net/tcp
+// or /proc/net/tcp6 table.
+func parseProcNetTCP(r io.Reader) ([]listeningPort, error) {
+	const stateListen = "0A"
+	scanner := bufio.NewScanner(r)
+	var out []listeningPort
+	first := true
+	for scanner.Scan() {
+		if first {
+			first = false
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != stateListen {
+			continue
+		}
+		hexIP, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil || port == 0 {
+			continue
+		}
+		ip, err := decodeProcIP(hexIP)
+		if err != nil {
+			continue
+		}
+		out = append(out, listeningPort{
+			Address: net.JoinHostPort(ip.String(), strconv.Itoa(int(port))),
+			Port:    int(port),
+			inode:   fields[9],
+		})
+	}
+	return out, scanner.Err()
+}
+
+// decodeProcIP decodes the address column of /proc/net/tcp*, which stores
+// the address as 32-bit words in host byte order (little-endian on the
+// architectures Firecracker supports).
+func decodeProcIP(s string) (net.IP, error) {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+		return nil, fmt.Errorf("unexpected address length %d", len(raw))
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return ip, nil
+}
+
+// socketOwners maps socket inodes to the command name of a process holding
+// them.
+func socketOwners() map[string]string {
+	owners := map[string]string{}
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return owners
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		pidDir := filepath.Join(procRoot, entry.Name())
+		fds, err := os.ReadDir(filepath.Join(pidDir, "fd"))
+		if err != nil {
+			continue
+		}
+		var comm string
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(pidDir, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")
+			if _, ok := owners[inode]; ok {
+				continue
+			}
+			if comm == "" {
+				data, _ := os.ReadFile(filepath.Join(pidDir, "comm"))
+				comm = strings.TrimSpace(string(data))
+			}
+			owners[inode] = comm
+		}
+	}
+	return owners
+}
+
+func portSetKey(ports []listeningPort) string {
+	var b strings.Builder
+	for _, p := range ports {
+		fmt.Fprintf(&b, "%d/%s,", p.Port, p.Process)
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetTCPReturnsListeningSockets(t *testing.T) {
+	table := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0BB8 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4242 1 0000000000000000 100 0 0 10 0
+   1: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4343 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:0BB8 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 4444 1 0000000000000000 20 4 30 10 -1
+`
+	ports, err := parseProcNetTCP(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(ports) != 2 {
+		t.Fatalf("expected 2 listening sockets, got %#v", ports)
+	}
+	if ports[0].Address != "127.0.0.1:3000" || ports[0].Port != 3000 || ports[0].inode != "4242" {
+		t.Fatalf("unexpected first socket: %#v", ports[0])
+	}
+	if ports[1].Address != "0.0.0.0:8080" || ports[1].Port != 8080 {
+		t.Fatalf("unexpected second socket: %#v", ports[1])
+	}
+}
+
+func TestParseProcNetTCP6DecodesAddress(t *testing.T) {
+	table := `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:1538 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 5151 1 0000000000000000 100 0 0 10 0
+`
+	ports, err := parseProcNetTCP(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(ports) != 1 || ports[0].Address != "[::1]:5432" {
+		t.Fatalf("unexpected sockets: %#v", ports)
+	}
+}
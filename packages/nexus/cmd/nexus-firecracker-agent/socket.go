@@ -0,0 +1,47 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+// handleSocketConnect relays conn to a unix socket in the guest, so the host
+// can forward a guest socket such as the Docker daemon's. After the result
+// line conn carries the socket's bytes until either side closes.
+func handleSocketConnect(conn net.Conn, decoder *json.Decoder, req execRequest, encoder *json.Encoder) {
+	var params struct {
+		Path string `json:"path"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+	if !filepath.IsAbs(params.Path) {
+		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: fmt.Sprintf("socket path must be absolute: %q", params.Path)})
+		return
+	}
+	target, err := net.DialTimeout("unix", filepath.Clean(params.Path), 5*time.Second)
+	if err != nil {
+		_ = encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 1, Stderr: err.Error()})
+		return
+	}
+	defer target.Close()
+	if err := encoder.Encode(execResponse{ID: req.ID, Type: "result", ExitCode: 0}); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// The decoder may already hold bytes sent after the request.
+		_, _ = io.Copy(target, io.MultiReader(decoder.Buffered(), conn))
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, target)
+		done <- struct{}{}
+	}()
+	<-done
+}
@@ -0,0 +1,69 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/firecracker"
+)
+
+func TestSocketConnectRelaysGuestSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "agent-sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "echo.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go serveConn(server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := firecracker.NewAgentClient(client).ConnectSocket(ctx, "sock-1", path)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("expected ping echo, got %q (%v)", buf, err)
+	}
+}
+
+func TestSocketConnectReportsMissingSocket(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go serveConn(server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := firecracker.NewAgentClient(client).ConnectSocket(ctx, "sock-2", "/nonexistent/agent.sock")
+	if err == nil || !strings.Contains(err.Error(), "/nonexistent/agent.sock") {
+		t.Fatalf("expected a connect error naming the socket, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/projectmgr"
+	"github.com/spf13/cobra"
+)
+
+var (
+	templateProjectID   string
+	templateRevision    int
+	templateDescription string
+	templateSaveName    string
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage project workspace templates",
+}
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List templates for a project",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listTemplates()
+	},
+}
+
+var templateShowCmd = &cobra.Command{
+	Use:   "show <name>[@revision]",
+	Short: "Show a template revision and its history",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		showTemplate(strings.TrimSpace(args[0]))
+	},
+}
+
+var templateSaveFromCmd = &cobra.Command{
+	Use:   "save-from <workspace-id> --name <name>",
+	Short: "Save a workspace's settings as a new template revision",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		saveTemplateFromWorkspace(strings.TrimSpace(args[0]))
+	},
+}
+
+func init() {
+	templateListCmd.Flags().StringVar(&templateProjectID, "project", "", "project id (defaults to the project for the current repo)")
+	templateShowCmd.Flags().StringVar(&templateProjectID, "project", "", "project id (defaults to the project for the current repo)")
+	templateShowCmd.Flags().IntVar(&templateRevision, "revision", 0, "template revision (default latest)")
+	templateSaveFromCmd.Flags().StringVar(&templateSaveName, "name", "", "template name")
+	templateSaveFromCmd.Flags().StringVar(&templateDescription, "description", "", "template description")
+	templateCmd.AddCommand(templateListCmd, templateShowCmd, templateSaveFromCmd)
+	rootCmd.AddCommand(templateCmd)
+}
+
+// templateScope selects the project by --project, falling back to the repo
+// in the current directory.
+func templateScope(params map[string]any) error {
+	if id := strings.TrimSpace(templateProjectID); id != "" {
+		params["projectId"] = id
+		return nil
+	}
+	repo, err := normalizeLocalRepoPath(".")
+	if err != nil {
+		return fmt.Errorf("not in a repository; pass --project: %w", err)
+	}
+	params["repo"] = repo
+	return nil
+}
+
+func listTemplates() {
+	params := map[string]any{}
+	if err := templateScope(params); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus template list: %v\n", err)
+		os.Exit(2)
+	}
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus template list: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	var result struct {
+		ProjectID string                         `json:"projectId"`
+		Templates []projectmgr.WorkspaceTemplate `json:"templates"`
+	}
+	if err := daemonRPCFn(conn, "template.list", params, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus template list: %v\n", err)
+		os.Exit(1)
+	}
+	if len(result.Templates) == 0 {
+		fmt.Println("no templates")
+		return
+	}
+	fmt.Printf("%-20s  %-4s  %-12s  %-14s  %s\n", "NAME", "REV", "BACKEND", "AGENT PROFILE", "DESCRIPTION")
+	for _, t := range result.Templates {
+		fmt.Printf("%-20s  %-4d  %-12s  %-14s  %s\n", t.Name, t.Revision, templateBackendLabel(t), t.AgentProfile, t.Description)
+	}
+}
+
+func showTemplate(name string) {
+	params := map[string]any{"name": name}
+	if templateRevision > 0 {
+		params["revision"] = templateRevision
+	}
+	if err := templateScope(params); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus template show: %v\n", err)
+		os.Exit(2)
+	}
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus template show: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	var result struct {
+		ProjectID string                         `json:"projectId"`
+		Template  projectmgr.WorkspaceTemplate   `json:"template"`
+		Revisions []projectmgr.WorkspaceTemplate `json:"revisions"`
+	}
+	if err := daemonRPCFn(conn, "template.get", params, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus template show: %v\n", err)
+		os.Exit(1)
+	}
+
+	t := result.Template
+	fmt.Printf("Name:           %s\n", t.Name)
+	fmt.Printf("Revision:       %d\n", t.Revision)
+	if t.Description != "" {
+		fmt.Printf("Description:    %s\n", t.Description)
+	}
+	fmt.Printf("Backend:        %s\n", templateBackendLabel(t))
+	if t.VMMode != "" {
+		fmt.Printf("VM Mode:        %s\n", t.VMMode)
+	}
+	if t.MemoryMiB > 0 || t.VCPUs > 0 {
+		fmt.Printf("Resources:      %d MiB, %d vCPU\n", t.MemoryMiB, t.VCPUs)
+	}
+	if t.AgentProfile != "" {
+		fmt.Printf("Agent Profile:  %s\n", t.AgentProfile)
+	}
+	if len(t.Services) > 0 {
+		fmt.Printf("Services:       %s\n", strings.Join(t.Services, ", "))
+	}
+	if t.ReadinessProfile != "" {
+		fmt.Printf("Readiness:      %s\n", t.ReadinessProfile)
+	}
+	if t.SourceWorkspaceID != "" {
+		fmt.Printf("From Workspace: %s\n", t.SourceWorkspaceID)
+	}
+	fmt.Printf("Created:        %s\n", t.CreatedAt.Format("2006-01-02 15:04:05"))
+	if len(t.SetupHooks) > 0 {
+		fmt.Println("\nSetup Hooks:")
+		for _, h := range t.SetupHooks {
+			line := strings.TrimSpace(strings.Join(append([]string{h.Command}, h.Args...), " "))
+			if h.Name != "" {
+				line = h.Name + ": " + line
+			}
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	if len(result.Revisions) > 1 {
+		fmt.Printf("\nRevisions (%d):\n", len(result.Revisions))
+		for _, r := range result.Revisions {
+			fmt.Printf("  %-4d  %s  %s\n", r.Revision, r.CreatedAt.Format("2006-01-02 15:04:05"), r.Description)
+		}
+	}
+}
+
+func saveTemplateFromWorkspace(workspaceID string) {
+	name := strings.TrimSpace(templateSaveName)
+	if name == "" {
+		fmt.Fprintln(os.Stderr, "nexus template save-from: --name is required")
+		os.Exit(2)
+	}
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus template save-from: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	var result struct {
+		ProjectID string                       `json:"projectId"`
+		Template  projectmgr.WorkspaceTemplate `json:"template"`
+	}
+	params := map[string]any{
+		"workspaceId": workspaceID,
+		"name":        name,
+		"description": strings.TrimSpace(templateDescription),
+	}
+	if err := daemonRPCFn(conn, "template.saveFromWorkspace", params, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus template save-from: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("saved template %s@%d (project %s)\n", result.Template.Name, result.Template.Revision, result.ProjectID)
+}
+
+func templateBackendLabel(t projectmgr.WorkspaceTemplate) string {
+	if t.Backend != "" {
+		return t.Backend
+	}
+	if t.IsolationLevel != "" {
+		return t.IsolationLevel
+	}
+	return "auto"
+}
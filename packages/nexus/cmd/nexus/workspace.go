@@ -197,6 +197,7 @@ var createFresh bool
 var createProjectID string
 var createRepo string
 var createFrom string
+var createTemplate string
 var listFlat bool
 
 var createCmd = &cobra.Command{
@@ -286,6 +287,8 @@ var execCmd = &cobra.Command{
 	},
 }
 
+var tunnelExclusive bool
+
 var tunnelCmd = &cobra.Command{
 	Use:   "tunnel <id>",
 	Short: "Activate tunnels for a workspace",
@@ -316,8 +319,9 @@ var checkoutCmd = &cobra.Command{
 }
 
 var sandboxCmd = &cobra.Command{
-	Use:   "sandbox",
-	Short: "Manage sandboxes",
+	Use:     "sandbox",
+	Aliases: []string{"workspace"},
+	Short:   "Manage sandboxes",
 }
 
 func init() {
@@ -326,6 +330,8 @@ func init() {
 	createCmd.Flags().StringVar(&createProjectID, "project", "", "target project id (required when creating outside current repo)")
 	createCmd.Flags().StringVar(&createRepo, "repo", "", "repo/path for project creation when --project is not provided")
 	createCmd.Flags().StringVar(&createFrom, "from", "auto", "source mode: auto|fresh|branch:<name>|workspace:<id>")
+	tunnelCmd.Flags().BoolVar(&tunnelExclusive, "exclusive", false, "stop other workspaces' tunnels so this workspace gets its requested ports")
+	createCmd.Flags().StringVar(&createTemplate, "from-template", "", "project template to apply: <name> or <name>@<revision>")
 	forkCmd.Flags().StringVar(&forkRef, "ref", "", "child workspace git ref (defaults to child name)")
 	forkCmd.Flags().StringVar(&forkSourceWorkspaceID, "source-workspace", "", "explicit source workspace id override (for nested forks)")
 	shellCmd.Flags().DurationVar(&shellTimeout, "timeout", 0, "max wall time waiting for PTY output and exit (e.g. 90s); 0 = no limit")
@@ -502,6 +508,24 @@ func createWorkspace(backend string, projectID string, repoHint string, fromMode
 		SourceWorkspaceID     string                 `json:"sourceWorkspaceId"`
 		UsedLineageSnapshotID string                 `json:"usedLineageSnapshotId"`
 		FreshApplied          bool                   `json:"freshApplied"`
+		Template              *struct {
+			Name     string `json:"name"`
+			Revision int    `json:"revision"`
+		} `json:"template"`
+		TemplateHooks []struct {
+			Name     string `json:"name"`
+			Command  string `json:"command"`
+			ExitCode int    `json:"exitCode"`
+			Error    string `json:"error"`
+		} `json:"templateHooks"`
+		TemplateServices *struct {
+			Services []string `json:"services"`
+			Ready    *struct {
+				Ready   bool   `json:"ready"`
+				Profile string `json:"profile"`
+			} `json:"ready"`
+			Error string `json:"error"`
+		} `json:"templateServices"`
 	}
 	fmt.Println("Creating sandbox... (this may take a few minutes on first run)")
 	createParams := map[string]any{
@@ -518,6 +542,11 @@ func createWorkspace(backend string, projectID string, repoHint string, fromMode
 		"policy":            spec.Policy,
 		"repo":              spec.Repo,
 	}
+	if template := strings.TrimSpace(createTemplate); template != "" {
+		// Let the template supply the agent profile unless one is set explicitly.
+		createParams["template"] = template
+		delete(createParams, "agentProfile")
+	}
 	if err := daemonRPC(conn, "workspace.create", createParams, &result); err != nil {
 		if renderPreflightCreateError(err) {
 			os.Exit(1)
@@ -545,6 +574,35 @@ func createWorkspace(backend string, projectID string, repoHint string, fromMode
 	if localWorktreePath := createWorkspaceLocalWorktreePath(ws); localWorktreePath != "" {
 		fmt.Printf("local worktree:   %s\n", localWorktreePath)
 	}
+	if result.Template != nil {
+		fmt.Printf("template: %s@%d\n", result.Template.Name, result.Template.Revision)
+	}
+	for _, hook := range result.TemplateHooks {
+		label := hook.Name
+		if label == "" {
+			label = hook.Command
+		}
+		if hook.ExitCode == 0 && hook.Error == "" {
+			fmt.Printf("setup hook %s: ok\n", label)
+		} else if hook.Error != "" {
+			fmt.Printf("setup hook %s: failed: %s\n", label, hook.Error)
+		} else {
+			fmt.Printf("setup hook %s: failed (exit %d)\n", label, hook.ExitCode)
+		}
+	}
+	if svc := result.TemplateServices; svc != nil {
+		if len(svc.Services) > 0 && (svc.Error == "" || svc.Ready != nil) {
+			fmt.Printf("services: %s\n", strings.Join(svc.Services, ", "))
+		}
+		switch {
+		case svc.Error != "":
+			fmt.Printf("template services: failed: %s\n", svc.Error)
+		case svc.Ready != nil && svc.Ready.Ready:
+			fmt.Printf("readiness %s: ready\n", svc.Ready.Profile)
+		case svc.Ready != nil:
+			fmt.Printf("readiness %s: not ready\n", svc.Ready.Profile)
+		}
+	}
 }
 
 func createWorkspaceLocalWorktreePath(ws workspacemgr.Workspace) string {
@@ -1032,6 +1090,18 @@ func forkWorkspace(id, childName, ref string, sourceWorkspaceID string) {
 	}
 }
 
+type tunnelActivateResult struct {
+	Active             bool     `json:"active"`
+	ActiveWorkspaceID  string   `json:"activeWorkspaceId"`
+	ActiveWorkspaceIDs []string `json:"activeWorkspaceIds"`
+	Error              string   `json:"error"`
+	Items              []struct {
+		Port      int  `json:"port"`
+		LocalPort int  `json:"localPort"`
+		Tunneled  bool `json:"tunneled"`
+	} `json:"items"`
+}
+
 func tunnelWorkspace(workspaceID string) {
 	if workspaceID == "" {
 		fmt.Fprintln(os.Stderr, "usage: nexus tunnel <workspace-id>")
@@ -1045,26 +1115,40 @@ func tunnelWorkspace(workspaceID string) {
 	if conn != nil {
 		defer conn.Close()
 	}
-	var result struct {
-		Active            bool   `json:"active"`
-		ActiveWorkspaceID string `json:"activeWorkspaceId"`
+	var result tunnelActivateResult
+	params := map[string]any{"workspaceId": workspaceID}
+	if tunnelExclusive {
+		params["exclusive"] = true
 	}
-	if err := daemonRPCFn(conn, "workspace.tunnels.activate", map[string]any{"workspaceId": workspaceID}, &result); err != nil {
+	if err := daemonRPCFn(conn, "workspace.tunnels.start", params, &result); err != nil {
 		fmt.Fprintf(os.Stderr, "nexus tunnel: %v\n", err)
 		os.Exit(1)
 	}
 	if !result.Active {
-		if result.ActiveWorkspaceID != "" {
-			fmt.Fprintf(os.Stderr, "nexus tunnel: another workspace already has active tunnels: %s\n", result.ActiveWorkspaceID)
+		if result.Error != "" {
+			fmt.Fprintf(os.Stderr, "nexus tunnel: failed to activate tunnels: %s\n", result.Error)
 		} else {
 			fmt.Fprintln(os.Stderr, "nexus tunnel: failed to activate tunnels")
 		}
 		os.Exit(1)
 	}
 	fmt.Printf("tunnels active for workspace %s\n", workspaceID)
+	for _, item := range result.Items {
+		if !item.Tunneled {
+			continue
+		}
+		if item.LocalPort > 0 && item.LocalPort != item.Port {
+			fmt.Printf("  port %d -> localhost:%d (remapped)\n", item.Port, item.LocalPort)
+		} else {
+			fmt.Printf("  port %d -> localhost:%d\n", item.Port, item.Port)
+		}
+	}
+	if len(result.ActiveWorkspaceIDs) > 1 {
+		fmt.Printf("other workspaces with active tunnels: %d\n", len(result.ActiveWorkspaceIDs)-1)
+	}
 	fmt.Fprintln(os.Stdout, "press Ctrl-C to deactivate tunnels")
 	waitForInterruptFn()
-	if err := daemonRPCFn(conn, "workspace.tunnels.deactivate", map[string]any{"workspaceId": workspaceID}, &result); err != nil {
+	if err := daemonRPCFn(conn, "workspace.tunnels.stop", map[string]any{"workspaceId": workspaceID}, &result); err != nil {
 		fmt.Fprintf(os.Stderr, "nexus tunnel: deactivate warning: %v\n", err)
 	} else {
 		fmt.Printf("tunnels deactivated for workspace %s\n", workspaceID)
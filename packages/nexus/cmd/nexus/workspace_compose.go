@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/cobra"
+)
+
+type composeServiceOutput struct {
+	Service      string `json:"service"`
+	Container    string `json:"container"`
+	Image        string `json:"image"`
+	State        string `json:"state"`
+	Health       string `json:"health"`
+	Status       string `json:"status"`
+	RestartCount int    `json:"restartCount"`
+	Ports        []struct {
+		HostPort   int    `json:"hostPort"`
+		TargetPort int    `json:"targetPort"`
+		Protocol   string `json:"protocol"`
+	} `json:"ports"`
+}
+
+type composeLogLineOutput struct {
+	Service string `json:"service"`
+	Line    string `json:"line"`
+}
+
+var (
+	composeFollow bool
+	composeTail   int
+)
+
+var composeCmd = &cobra.Command{
+	Use:   "compose <id> ps|logs|restart [service...]",
+	Short: "Inspect and control a workspace's docker compose services",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := strings.TrimSpace(args[0])
+		services := args[2:]
+		switch action := strings.TrimSpace(args[1]); action {
+		case "ps":
+			composePS(id)
+		case "logs":
+			composeLogs(id, services)
+		case "restart":
+			composeRestart(id, services)
+		default:
+			return fmt.Errorf("unknown compose action %q (want ps, logs or restart)", action)
+		}
+		return nil
+	},
+}
+
+func init() {
+	composeCmd.Flags().BoolVarP(&composeFollow, "follow", "f", false, "logs: keep streaming new output")
+	composeCmd.Flags().IntVar(&composeTail, "tail", 0, "logs: number of lines to show per service (default 200)")
+	sandboxCmd.AddCommand(composeCmd)
+}
+
+func composePS(id string) {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus compose: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	var result struct {
+		Services []composeServiceOutput `json:"services"`
+	}
+	if err := daemonRPCFn(conn, "compose.ps", map[string]any{"workspaceId": id}, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus compose: %v\n", err)
+		os.Exit(1)
+	}
+	if len(result.Services) == 0 {
+		fmt.Println("no compose services")
+		return
+	}
+	fmt.Printf("%-16s  %-28s  %-10s  %-10s  %-8s  %-24s  %s\n", "SERVICE", "CONTAINER", "STATE", "HEALTH", "RESTARTS", "IMAGE", "PORTS")
+	for _, svc := range result.Services {
+		health := svc.Health
+		if health == "" {
+			health = "—"
+		}
+		ports := make([]string, 0, len(svc.Ports))
+		for _, p := range svc.Ports {
+			ports = append(ports, fmt.Sprintf("%d->%d/%s", p.HostPort, p.TargetPort, p.Protocol))
+		}
+		fmt.Printf("%-16s  %-28s  %-10s  %-10s  %-8d  %-24s  %s\n", svc.Service, svc.Container, svc.State, health, svc.RestartCount, svc.Image, strings.Join(ports, ","))
+	}
+}
+
+func composeRestart(id string, services []string) {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus compose: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	if err := daemonRPCFn(conn, "compose.restart", map[string]any{"workspaceId": id, "services": services}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus compose: %v\n", err)
+		os.Exit(1)
+	}
+	if len(services) == 0 {
+		fmt.Printf("restarted all services in workspace %s\n", id)
+		return
+	}
+	fmt.Printf("restarted %s in workspace %s\n", strings.Join(services, ", "), id)
+}
+
+func composeLogs(id string, services []string) {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus compose: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	params := map[string]any{"workspaceId": id, "services": services, "tail": composeTail}
+	if composeFollow {
+		params["follow"] = true
+		if err := followComposeLogs(conn, params); err != nil {
+			fmt.Fprintf(os.Stderr, "nexus compose: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var result struct {
+		Lines []composeLogLineOutput `json:"lines"`
+	}
+	if err := daemonRPCFn(conn, "compose.logs", params, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus compose: %v\n", err)
+		os.Exit(1)
+	}
+	for _, line := range result.Lines {
+		printComposeLogLine(line)
+	}
+}
+
+// followComposeLogs prints compose.logs.data notifications until the daemon
+// ends the stream. Interrupting the CLI closes the connection, which stops
+// the stream on the daemon side.
+func followComposeLogs(conn *websocket.Conn, params map[string]any) error {
+	reqID := fmt.Sprintf("%d", time.Now().UnixNano())
+	if err := conn.WriteJSON(rpcRequest{JSONRPC: "2.0", ID: reqID, Method: "compose.logs", Params: params}); err != nil {
+		return fmt.Errorf("rpc send: %w", err)
+	}
+	for {
+		var msg rpcResponse
+		if err := conn.ReadJSON(&msg); err != nil {
+			return fmt.Errorf("read failed: %w", err)
+		}
+		switch {
+		case msg.ID == reqID:
+			if msg.Error != nil {
+				return &daemonRPCError{Code: msg.Error.Code, Message: msg.Error.Message, Data: msg.Error.Data}
+			}
+		case msg.Method == "compose.logs.data":
+			var line composeLogLineOutput
+			if err := json.Unmarshal(msg.Params, &line); err == nil {
+				printComposeLogLine(line)
+			}
+		case msg.Method == "compose.logs.end":
+			var end struct {
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal(msg.Params, &end)
+			if end.Error != "" {
+				return fmt.Errorf("%s", end.Error)
+			}
+			return nil
+		}
+	}
+}
+
+func printComposeLogLine(line composeLogLineOutput) {
+	if line.Service == "" {
+		fmt.Println(line.Line)
+		return
+	}
+	fmt.Printf("%s | %s\n", line.Service, line.Line)
+}
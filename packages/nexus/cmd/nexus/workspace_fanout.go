@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type workspaceFanoutOutput struct {
+	GroupID           string `json:"groupId"`
+	SourceWorkspaceID string `json:"sourceWorkspaceId"`
+	Command           string `json:"command"`
+	SnapshotID        string `json:"snapshotId"`
+	Children          []struct {
+		Index         int    `json:"index"`
+		WorkspaceID   string `json:"workspaceId"`
+		WorkspaceName string `json:"workspaceName"`
+		Status        string `json:"status"`
+		ExitCode      *int   `json:"exitCode"`
+		Stdout        string `json:"stdout"`
+		Stderr        string `json:"stderr"`
+		Error         string `json:"error"`
+		DurationMs    int64  `json:"durationMs"`
+	} `json:"children"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+var (
+	fanoutCount      int
+	fanoutParallel   int
+	fanoutNamePrefix string
+	fanoutTimeout    int64
+	fanoutShowOutput bool
+)
+
+var fanoutCmd = &cobra.Command{
+	Use:   "fanout <id> --count N -- <command> [args...]",
+	Short: "Fork a workspace N times and run a command in each fork",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.ArgsLenAtDash() == -1 {
+			return fmt.Errorf("usage: nexus workspace fanout <id> --count N -- <command> [args...]")
+		}
+		rest := args[1:]
+		if len(rest) == 0 {
+			return fmt.Errorf("command required after --")
+		}
+		fanoutWorkspace(strings.TrimSpace(args[0]), rest)
+		return nil
+	},
+}
+
+var relationsCmd = &cobra.Command{
+	Use:   "relations",
+	Short: "Show workspace lineage and fan-out groups",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		showWorkspaceRelations()
+	},
+}
+
+func init() {
+	fanoutCmd.Flags().IntVar(&fanoutCount, "count", 0, "number of forks to create")
+	fanoutCmd.Flags().IntVar(&fanoutParallel, "parallel", 0, "max commands running at once (default 4)")
+	fanoutCmd.Flags().StringVar(&fanoutNamePrefix, "name-prefix", "", "child workspace name/ref prefix")
+	fanoutCmd.Flags().Int64Var(&fanoutTimeout, "timeout", 0, "per-fork command timeout in seconds (default 30m, max 4h)")
+	fanoutCmd.Flags().BoolVar(&fanoutShowOutput, "output", false, "print each fork's stdout/stderr after the summary")
+	sandboxCmd.AddCommand(fanoutCmd, relationsCmd)
+}
+
+func fanoutWorkspace(id string, command []string) {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus fanout: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	params := map[string]any{
+		"id":          id,
+		"count":       fanoutCount,
+		"command":     command[0],
+		"args":        command[1:],
+		"parallelism": fanoutParallel,
+		"namePrefix":  strings.TrimSpace(fanoutNamePrefix),
+		"timeout":     fanoutTimeout,
+	}
+	var result workspaceFanoutOutput
+	if err := daemonRPCFn(conn, "workspace.fanout", params, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus fanout: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("fan-out %s from %s: %s\n", result.GroupID, result.SourceWorkspaceID, result.Command)
+	fmt.Printf("%-4s  %-24s  %-28s  %-10s  %-5s  %s\n", "#", "ID", "NAME", "STATUS", "EXIT", "DURATION")
+	for _, child := range result.Children {
+		exit := "—"
+		if child.ExitCode != nil {
+			exit = fmt.Sprintf("%d", *child.ExitCode)
+		}
+		childID := child.WorkspaceID
+		if childID == "" {
+			childID = "—"
+		}
+		fmt.Printf("%-4d  %-24s  %-28s  %-10s  %-5s  %dms\n", child.Index+1, childID, child.WorkspaceName, child.Status, exit, child.DurationMs)
+		if child.Error != "" {
+			fmt.Printf("      error: %s\n", child.Error)
+		}
+	}
+	fmt.Printf("%d succeeded, %d failed\n", result.Succeeded, result.Failed)
+
+	if fanoutShowOutput {
+		for _, child := range result.Children {
+			fmt.Printf("\n== %s (%s) ==\n", child.WorkspaceName, child.Status)
+			if child.Stdout != "" {
+				fmt.Println(child.Stdout)
+			}
+			if child.Stderr != "" {
+				fmt.Fprintln(os.Stderr, child.Stderr)
+			}
+		}
+	}
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func showWorkspaceRelations() {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus relations: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	var result struct {
+		Relations []struct {
+			RepoID      string `json:"repoId"`
+			Repo        string `json:"repo"`
+			DisplayName string `json:"displayName"`
+			Nodes       []struct {
+				WorkspaceID       string `json:"workspaceId"`
+				ParentWorkspaceID string `json:"parentWorkspaceId"`
+				WorkspaceName     string `json:"workspaceName"`
+				State             string `json:"state"`
+				WorktreeRef       string `json:"worktreeRef"`
+			} `json:"nodes"`
+			FanoutGroups []struct {
+				GroupID           string   `json:"groupId"`
+				SourceWorkspaceID string   `json:"sourceWorkspaceId"`
+				Command           string   `json:"command"`
+				WorkspaceIDs      []string `json:"workspaceIds"`
+				Succeeded         int      `json:"succeeded"`
+				Failed            int      `json:"failed"`
+				Pending           int      `json:"pending"`
+			} `json:"fanoutGroups"`
+		} `json:"relations"`
+	}
+	if err := daemonRPCFn(conn, "workspace.relations.list", map[string]any{}, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus relations: %v\n", err)
+		os.Exit(1)
+	}
+	if len(result.Relations) == 0 {
+		fmt.Println("no workspaces")
+		return
+	}
+
+	for _, group := range result.Relations {
+		fmt.Printf("REPO: %s (%s)\n", group.DisplayName, group.Repo)
+		children := make(map[string][]int)
+		known := make(map[string]bool, len(group.Nodes))
+		for _, node := range group.Nodes {
+			known[node.WorkspaceID] = true
+		}
+		roots := make([]int, 0)
+		for i, node := range group.Nodes {
+			if node.ParentWorkspaceID == "" || !known[node.ParentWorkspaceID] {
+				roots = append(roots, i)
+				continue
+			}
+			children[node.ParentWorkspaceID] = append(children[node.ParentWorkspaceID], i)
+		}
+		var walk func(idx int, depth int)
+		walk = func(idx int, depth int) {
+			node := group.Nodes[idx]
+			fmt.Printf("%s- %s  %s  [%s]  %s\n", strings.Repeat("  ", depth+1), node.WorkspaceID, node.WorkspaceName, node.State, node.WorktreeRef)
+			for _, child := range children[node.WorkspaceID] {
+				walk(child, depth+1)
+			}
+		}
+		for _, idx := range roots {
+			walk(idx, 0)
+		}
+		for _, fanout := range group.FanoutGroups {
+			fmt.Printf("  FAN-OUT %s from %s: %s\n", fanout.GroupID, fanout.SourceWorkspaceID, fanout.Command)
+			fmt.Printf("    %d succeeded, %d failed, %d pending: %s\n", fanout.Succeeded, fanout.Failed, fanout.Pending, strings.Join(fanout.WorkspaceIDs, ", "))
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type workspaceDiffOutput struct {
+	BaseWorkspaceID string `json:"baseWorkspaceId"`
+	HeadWorkspaceID string `json:"headWorkspaceId"`
+	BaseCommit      string `json:"baseCommit"`
+	HeadCommit      string `json:"headCommit"`
+	MergeBase       string `json:"mergeBase"`
+	Files           []struct {
+		Path      string `json:"path"`
+		OldPath   string `json:"oldPath"`
+		Status    string `json:"status"`
+		Binary    bool   `json:"binary"`
+		Additions int    `json:"additions"`
+		Deletions int    `json:"deletions"`
+		Hunks     []struct {
+			Header string `json:"header"`
+			Lines  []struct {
+				Kind    string `json:"kind"`
+				Content string `json:"content"`
+			} `json:"lines"`
+		} `json:"hunks"`
+	} `json:"files"`
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+}
+
+type workspaceMergeOutput struct {
+	ParentWorkspaceID string   `json:"parentWorkspaceId"`
+	ChildWorkspaceID  string   `json:"childWorkspaceId"`
+	Mode              string   `json:"mode"`
+	DryRun            bool     `json:"dryRun"`
+	Merged            bool     `json:"merged"`
+	Clean             bool     `json:"clean"`
+	Commit            string   `json:"commit"`
+	Files             []string `json:"files"`
+	Conflicts         []string `json:"conflicts"`
+	ChildDirty        bool     `json:"childDirty"`
+}
+
+var (
+	diffStat           bool
+	diffCommittedOnly  bool
+	diffSinceForkPoint bool
+
+	mergeInto          string
+	mergeMode          string
+	mergeMessage       string
+	mergeDryRun        bool
+	mergeKeepConflicts bool
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <base-id> <head-id>",
+	Short: "Show changes between two workspaces in the same lineage",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		diffWorkspaces(strings.TrimSpace(args[0]), strings.TrimSpace(args[1]))
+	},
+}
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <child-id> --into <parent-id>",
+	Short: "Merge a forked workspace back into its parent",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mergeWorkspace(strings.TrimSpace(args[0]), strings.TrimSpace(mergeInto))
+	},
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffStat, "stat", false, "show per-file change counts only")
+	diffCmd.Flags().BoolVar(&diffCommittedOnly, "committed", false, "compare committed state only, ignoring uncommitted changes")
+	diffCmd.Flags().BoolVar(&diffSinceForkPoint, "since-fork", false, "diff head against the fork point instead of the base's current state")
+	mergeCmd.Flags().StringVar(&mergeInto, "into", "", "parent workspace id (defaults to the child's parent)")
+	mergeCmd.Flags().StringVar(&mergeMode, "mode", "commits", "merge mode: commits|patch")
+	mergeCmd.Flags().StringVarP(&mergeMessage, "message", "m", "", "merge commit message")
+	mergeCmd.Flags().BoolVar(&mergeDryRun, "dry-run", false, "report files and conflicts without changing the parent")
+	mergeCmd.Flags().BoolVar(&mergeKeepConflicts, "keep-conflicts", false, "leave conflict markers in the parent instead of aborting")
+	sandboxCmd.AddCommand(diffCmd, mergeCmd)
+}
+
+func diffWorkspaces(baseID, headID string) {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus diff: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	params := map[string]any{
+		"baseWorkspaceId": baseID,
+		"headWorkspaceId": headID,
+		"stat":            diffStat,
+		"committedOnly":   diffCommittedOnly,
+		"sinceForkPoint":  diffSinceForkPoint,
+	}
+	var result workspaceDiffOutput
+	if err := daemonRPCFn(conn, "workspace.diff", params, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus diff: %v\n", err)
+		os.Exit(1)
+	}
+	printWorkspaceDiff(result)
+}
+
+func printWorkspaceDiff(result workspaceDiffOutput) {
+	if len(result.Files) == 0 {
+		fmt.Printf("No differences between %s and %s\n", result.BaseWorkspaceID, result.HeadWorkspaceID)
+		return
+	}
+	for _, file := range result.Files {
+		name := file.Path
+		if file.OldPath != "" && file.OldPath != file.Path {
+			name = file.OldPath + " => " + file.Path
+		}
+		if file.Binary {
+			fmt.Printf("%-10s %s (binary)\n", file.Status, name)
+		} else {
+			fmt.Printf("%-10s %s +%d -%d\n", file.Status, name, file.Additions, file.Deletions)
+		}
+		for _, hunk := range file.Hunks {
+			fmt.Println(hunk.Header)
+			for _, line := range hunk.Lines {
+				switch line.Kind {
+				case "add":
+					fmt.Println("+" + line.Content)
+				case "delete":
+					fmt.Println("-" + line.Content)
+				case "meta":
+					fmt.Println(line.Content)
+				default:
+					fmt.Println(" " + line.Content)
+				}
+			}
+		}
+	}
+	fmt.Printf("%d file(s) changed, %d insertion(s), %d deletion(s)\n", len(result.Files), result.Additions, result.Deletions)
+}
+
+func mergeWorkspace(childID, parentID string) {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus merge: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	params := map[string]any{
+		"childWorkspaceId":  childID,
+		"parentWorkspaceId": parentID,
+		"mode":              strings.TrimSpace(mergeMode),
+		"message":           mergeMessage,
+		"dryRun":            mergeDryRun,
+		"keepConflicts":     mergeKeepConflicts,
+	}
+	var result workspaceMergeOutput
+	if err := daemonRPCFn(conn, "workspace.merge", params, &result); err != nil {
+		if rpcErr, ok := err.(*daemonRPCError); ok && rpcErr.Code == -32011 {
+			var data struct {
+				Conflicts []string `json:"conflicts"`
+			}
+			_ = json.Unmarshal(rpcErr.Data, &data)
+			fmt.Fprintf(os.Stderr, "nexus merge: %s\n", rpcErr.Message)
+			for _, path := range data.Conflicts {
+				fmt.Fprintf(os.Stderr, "  conflict: %s\n", path)
+			}
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "nexus merge: %v\n", err)
+		os.Exit(1)
+	}
+
+	if result.DryRun {
+		fmt.Printf("Dry run: merging %s into %s (%s) would change %d file(s)\n", result.ChildWorkspaceID, result.ParentWorkspaceID, result.Mode, len(result.Files))
+	} else {
+		fmt.Printf("✓ Merged %s into %s (%s), %d file(s) changed\n", result.ChildWorkspaceID, result.ParentWorkspaceID, result.Mode, len(result.Files))
+	}
+	for _, path := range result.Files {
+		fmt.Printf("  %s\n", path)
+	}
+	for _, path := range result.Conflicts {
+		fmt.Printf("  conflict: %s\n", path)
+	}
+	if strings.TrimSpace(result.Commit) != "" {
+		fmt.Printf("commit: %s\n", result.Commit)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type recordingOutput struct {
+	SessionID string    `json:"sessionId"`
+	Name      string    `json:"name"`
+	Shell     string    `json:"shell"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Bytes     int64     `json:"bytes"`
+	Segments  int       `json:"segments"`
+	Active    bool      `json:"active"`
+}
+
+var recordingsOutput string
+
+var recordingsCmd = &cobra.Command{
+	Use:   "recordings <id> [session-id]",
+	Short: "List a workspace's terminal recordings or export one as asciicast v2",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		id := strings.TrimSpace(args[0])
+		if len(args) == 1 {
+			listRecordings(id)
+			return
+		}
+		exportRecording(strings.TrimSpace(args[1]), recordingsOutput)
+	},
+}
+
+func init() {
+	recordingsCmd.Flags().StringVarP(&recordingsOutput, "output", "o", "", "write the .cast file here instead of stdout")
+	sandboxCmd.AddCommand(recordingsCmd)
+}
+
+func listRecordings(id string) {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus recordings: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	var result struct {
+		Recordings []recordingOutput `json:"recordings"`
+	}
+	if err := daemonRPCFn(conn, "pty.recording.list", map[string]any{"workspaceId": id}, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus recordings: %v\n", err)
+		os.Exit(1)
+	}
+	if len(result.Recordings) == 0 {
+		fmt.Println("no recordings")
+		return
+	}
+	fmt.Printf("%-24s  %-16s  %-20s  %-10s  %s\n", "SESSION", "NAME", "STARTED", "SIZE", "STATE")
+	for _, rec := range result.Recordings {
+		state := "ended"
+		if rec.Active {
+			state = "recording"
+		}
+		fmt.Printf("%-24s  %-16s  %-20s  %-10s  %s\n", rec.SessionID, rec.Name, rec.StartedAt.Local().Format("2006-01-02 15:04:05"), formatRecordingBytes(rec.Bytes), state)
+	}
+}
+
+func exportRecording(sessionID, output string) {
+	conn, err := ensureDaemonFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexus recordings: %v\n", err)
+		os.Exit(1)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	var result struct {
+		Cast string `json:"cast"`
+	}
+	if err := daemonRPCFn(conn, "pty.recording.get", map[string]any{"sessionId": sessionID}, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus recordings: %v\n", err)
+		os.Exit(1)
+	}
+	if output == "" {
+		fmt.Print(result.Cast)
+		return
+	}
+	if err := os.WriteFile(output, []byte(result.Cast), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "nexus recordings: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("wrote %s (play with: asciinema play %s)\n", output, output)
+}
+
+func formatRecordingBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
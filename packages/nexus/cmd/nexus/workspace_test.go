@@ -1,6 +1,9 @@
 package main
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -73,7 +76,7 @@ func TestRunWorkspaceTunnelCommandActivatesAndDeactivates(t *testing.T) {
 	daemonRPCFn = func(_ *websocket.Conn, method string, params interface{}, out interface{}) error {
 		calledMethods = append(calledMethods, method)
 		switch method {
-		case "workspace.tunnels.activate":
+		case "workspace.tunnels.start":
 			payload, ok := params.(map[string]any)
 			if !ok {
 				t.Fatalf("expected map params, got %T", params)
@@ -82,14 +85,11 @@ func TestRunWorkspaceTunnelCommandActivatesAndDeactivates(t *testing.T) {
 			if calledID != "ws-456" {
 				t.Fatalf("expected workspace id ws-456, got %q", calledID)
 			}
-			if typed, ok := out.(*struct {
-				Active            bool   `json:"active"`
-				ActiveWorkspaceID string `json:"activeWorkspaceId"`
-			}); ok {
+			if typed, ok := out.(*tunnelActivateResult); ok {
 				typed.Active = true
 				typed.ActiveWorkspaceID = "ws-456"
 			}
-		case "workspace.tunnels.deactivate":
+		case "workspace.tunnels.stop":
 			payload, ok := params.(map[string]any)
 			if !ok {
 				t.Fatalf("expected map params, got %T", params)
@@ -109,7 +109,7 @@ func TestRunWorkspaceTunnelCommandActivatesAndDeactivates(t *testing.T) {
 	if len(calledMethods) != 2 {
 		t.Fatalf("expected 2 rpc calls, got %d (%v)", len(calledMethods), calledMethods)
 	}
-	if calledMethods[0] != "workspace.tunnels.activate" || calledMethods[1] != "workspace.tunnels.deactivate" {
+	if calledMethods[0] != "workspace.tunnels.start" || calledMethods[1] != "workspace.tunnels.stop" {
 		t.Fatalf("unexpected rpc method sequence: %v", calledMethods)
 	}
 }
@@ -132,3 +132,149 @@ func TestCreateWorkspaceLocalWorktreePath_EmptyWhenUnset(t *testing.T) {
 		t.Fatalf("expected empty local worktree path, got %q", got)
 	}
 }
+
+func TestMergeWorkspaceCommandCallsWorkspaceMergeRPC(t *testing.T) {
+	origEnsure := ensureDaemonFn
+	origRPC := daemonRPCFn
+	origMode := mergeMode
+	t.Cleanup(func() {
+		ensureDaemonFn = origEnsure
+		daemonRPCFn = origRPC
+		mergeMode = origMode
+	})
+
+	var calledMethod string
+	var payload map[string]any
+	ensureDaemonFn = func() (*websocket.Conn, error) {
+		return nil, nil
+	}
+	daemonRPCFn = func(_ *websocket.Conn, method string, params interface{}, out interface{}) error {
+		calledMethod = method
+		payload, _ = params.(map[string]any)
+		return nil
+	}
+
+	mergeMode = "patch"
+	mergeWorkspace("ws-child", "ws-parent")
+
+	if calledMethod != "workspace.merge" {
+		t.Fatalf("expected workspace.merge method, got %q", calledMethod)
+	}
+	if payload["childWorkspaceId"] != "ws-child" || payload["parentWorkspaceId"] != "ws-parent" || payload["mode"] != "patch" {
+		t.Fatalf("unexpected merge params: %+v", payload)
+	}
+}
+
+func TestSandboxCommandAcceptsWorkspaceAlias(t *testing.T) {
+	cmd, _, err := rootCmd.Find([]string{"workspace", "diff"})
+	if err != nil {
+		t.Fatalf("find workspace diff: %v", err)
+	}
+	if cmd != diffCmd {
+		t.Fatalf("expected workspace alias to resolve diff command, got %q", cmd.Name())
+	}
+}
+
+func TestFanoutWorkspaceCommandSendsCommandAndArgs(t *testing.T) {
+	origEnsure := ensureDaemonFn
+	origRPC := daemonRPCFn
+	origCount := fanoutCount
+	t.Cleanup(func() {
+		ensureDaemonFn = origEnsure
+		daemonRPCFn = origRPC
+		fanoutCount = origCount
+	})
+
+	var calledMethod string
+	var payload map[string]any
+	ensureDaemonFn = func() (*websocket.Conn, error) {
+		return nil, nil
+	}
+	daemonRPCFn = func(_ *websocket.Conn, method string, params interface{}, out interface{}) error {
+		calledMethod = method
+		payload, _ = params.(map[string]any)
+		return nil
+	}
+
+	fanoutCount = 3
+	fanoutWorkspace("ws-src", []string{"go", "test", "./..."})
+
+	if calledMethod != "workspace.fanout" {
+		t.Fatalf("expected workspace.fanout method, got %q", calledMethod)
+	}
+	args, _ := payload["args"].([]string)
+	if payload["id"] != "ws-src" || payload["count"] != 3 || payload["command"] != "go" || strings.Join(args, " ") != "test ./..." {
+		t.Fatalf("unexpected fanout params: %+v", payload)
+	}
+}
+
+func TestRunWorkspaceComposeCommandsCallComposeRPCs(t *testing.T) {
+	origEnsure := ensureDaemonFn
+	origRPC := daemonRPCFn
+	t.Cleanup(func() {
+		ensureDaemonFn = origEnsure
+		daemonRPCFn = origRPC
+	})
+
+	ensureDaemonFn = func() (*websocket.Conn, error) {
+		return nil, nil
+	}
+	var calls []string
+	daemonRPCFn = func(_ *websocket.Conn, method string, params interface{}, out interface{}) error {
+		payload, ok := params.(map[string]any)
+		if !ok {
+			t.Fatalf("expected map params, got %T", params)
+		}
+		if payload["workspaceId"] != "ws-789" {
+			t.Fatalf("expected workspace id ws-789, got %v", payload["workspaceId"])
+		}
+		calls = append(calls, method)
+		if method == "compose.restart" {
+			services, _ := payload["services"].([]string)
+			if len(services) != 1 || services[0] != "web" {
+				t.Fatalf("expected restart of web, got %v", payload["services"])
+			}
+		}
+		return nil
+	}
+
+	composePS("ws-789")
+	composeRestart("ws-789", []string{"web"})
+	composeLogs("ws-789", nil)
+
+	if strings.Join(calls, ",") != "compose.ps,compose.restart,compose.logs" {
+		t.Fatalf("unexpected rpc calls %v", calls)
+	}
+}
+
+func TestRunWorkspaceRecordingsExportWritesCastFile(t *testing.T) {
+	origEnsure := ensureDaemonFn
+	origRPC := daemonRPCFn
+	t.Cleanup(func() {
+		ensureDaemonFn = origEnsure
+		daemonRPCFn = origRPC
+	})
+
+	ensureDaemonFn = func() (*websocket.Conn, error) {
+		return nil, nil
+	}
+	daemonRPCFn = func(_ *websocket.Conn, method string, params interface{}, out interface{}) error {
+		payload, _ := params.(map[string]any)
+		if method != "pty.recording.get" || payload["sessionId"] != "pty-1" {
+			t.Fatalf("unexpected rpc %s %v", method, params)
+		}
+		raw, _ := json.Marshal(map[string]any{"cast": "{\"version\":2}\n[0.5,\"o\",\"hi\"]\n"})
+		return json.Unmarshal(raw, out)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.cast")
+	exportRecording("pty-1", path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cast: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "{\"version\":2}\n") {
+		t.Fatalf("unexpected cast %q", data)
+	}
+}
@@ -0,0 +1,347 @@
+package compose
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Runner runs argv inside a workspace, in the directory holding its compose
+// file. onOutput, when set, receives output as it is produced.
+type Runner interface {
+	Run(ctx context.Context, workspaceID string, argv []string, onOutput func(stream, data string)) (CommandResult, error)
+}
+
+// CommandResult is the outcome of a command run by a Runner.
+type CommandResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// ServiceStatus is the state of one compose service container.
+type ServiceStatus struct {
+	Service      string          `json:"service"`
+	Container    string          `json:"container"`
+	Image        string          `json:"image,omitempty"`
+	State        string          `json:"state"`
+	Health       string          `json:"health,omitempty"`
+	Status       string          `json:"status,omitempty"`
+	ExitCode     int             `json:"exitCode"`
+	RestartCount int             `json:"restartCount"`
+	Ports        []PublishedPort `json:"ports,omitempty"`
+}
+
+// LogLine is one line of compose service output.
+type LogLine struct {
+	Service string `json:"service"`
+	Line    string `json:"line"`
+}
+
+// LogsOptions selects the log output to read.
+type LogsOptions struct {
+	Services []string
+	// Tail limits output to the last N lines per service; 0 means all.
+	Tail   int
+	Since  string
+	Follow bool
+}
+
+// ErrInvalidService is returned for a service name docker compose would
+// take for something else, such as a flag.
+var ErrInvalidService = errors.New("invalid service name")
+
+// stderrTailLimit bounds the stderr kept from a streamed command for its
+// error message.
+const stderrTailLimit = 4096
+
+// CheckServiceNames refuses empty names and names starting with "-", which
+// would reach docker compose as options.
+func CheckServiceNames(services []string) error {
+	for _, name := range services {
+		if strings.TrimSpace(name) == "" || strings.HasPrefix(name, "-") {
+			return fmt.Errorf("%w: %q", ErrInvalidService, name)
+		}
+	}
+	return nil
+}
+
+// Services reports and controls the compose project of a workspace.
+type Services struct {
+	runner Runner
+}
+
+func NewServices(runner Runner) *Services {
+	return &Services{runner: runner}
+}
+
+// PS lists the project's containers with their state, health, image and
+// restart count.
+func (s *Services) PS(ctx context.Context, workspaceID string) ([]ServiceStatus, error) {
+	res, err := s.run(ctx, workspaceID, []string{"ps", "--all", "--format", "json"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	services, err := parsePSOutput([]byte(res.Stdout))
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return services, nil
+	}
+
+	// compose ps does not report restart counts; docker inspect does.
+	containers := make([]string, 0, len(services))
+	for _, svc := range services {
+		containers = append(containers, svc.Container)
+	}
+	if counts, err := s.inspectRestartCounts(ctx, workspaceID, containers); err == nil {
+		for i := range services {
+			services[i].RestartCount = counts[services[i].Container]
+		}
+	}
+	return services, nil
+}
+
+// Logs reads service logs, calling onLine for every line. With Follow set
+// it blocks until ctx is cancelled or the project stops.
+func (s *Services) Logs(ctx context.Context, workspaceID string, opts LogsOptions, onLine func(LogLine)) error {
+	if err := CheckServiceNames(opts.Services); err != nil {
+		return err
+	}
+	args := []string{"logs", "--no-color"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if opts.Tail > 0 {
+		args = append(args, "--tail", strconv.Itoa(opts.Tail))
+	}
+	if since := strings.TrimSpace(opts.Since); since != "" {
+		args = append(args, "--since", since)
+	}
+	args = append(args, opts.Services...)
+
+	var pending strings.Builder
+	emit := func(chunk string) {
+		pending.WriteString(chunk)
+		buffered := pending.String()
+		idx := strings.LastIndexByte(buffered, '\n')
+		if idx < 0 {
+			return
+		}
+		pending.Reset()
+		pending.WriteString(buffered[idx+1:])
+		for _, line := range strings.Split(buffered[:idx], "\n") {
+			if line = strings.TrimRight(line, "\r"); line != "" {
+				onLine(parseLogLine(line))
+			}
+		}
+	}
+	// Streamed output is not kept by the runner; hold on to the end of
+	// stderr so a failure can say why.
+	var stderrTail string
+	res, err := s.run(ctx, workspaceID, args, func(stream, data string) {
+		if stream == "stdout" {
+			emit(data)
+			return
+		}
+		stderrTail += data
+		if len(stderrTail) > stderrTailLimit {
+			stderrTail = stderrTail[len(stderrTail)-stderrTailLimit:]
+		}
+	})
+	if rest := strings.TrimSpace(pending.String()); rest != "" {
+		onLine(parseLogLine(rest))
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	if err != nil && res.ExitCode != 0 && res.Stderr == "" {
+		if detail := strings.TrimSpace(stderrTail); detail != "" {
+			return fmt.Errorf("docker compose logs: %s", detail)
+		}
+	}
+	return err
+}
+
+// Restart restarts the given services, or every service when none are
+// named.
+func (s *Services) Restart(ctx context.Context, workspaceID string, services []string) error {
+	if err := CheckServiceNames(services); err != nil {
+		return err
+	}
+	_, err := s.run(ctx, workspaceID, append([]string{"restart"}, services...), nil)
+	return err
+}
+
+// Up starts the given services, or the whole project, in the background.
+func (s *Services) Up(ctx context.Context, workspaceID string, services []string, build bool) error {
+	if err := CheckServiceNames(services); err != nil {
+		return err
+	}
+	args := []string{"up", "--detach"}
+	if build {
+		args = append(args, "--build")
+	}
+	_, err := s.run(ctx, workspaceID, append(args, services...), nil)
+	return err
+}
+
+// Down stops and removes the project's containers and, with volumes set,
+// its named volumes.
+func (s *Services) Down(ctx context.Context, workspaceID string, volumes bool) error {
+	args := []string{"down"}
+	if volumes {
+		args = append(args, "--volumes")
+	}
+	_, err := s.run(ctx, workspaceID, args, nil)
+	return err
+}
+
+func (s *Services) run(ctx context.Context, workspaceID string, args []string, onOutput func(stream, data string)) (CommandResult, error) {
+	if s == nil || s.runner == nil {
+		return CommandResult{}, fmt.Errorf("compose runner unavailable")
+	}
+	res, err := s.runner.Run(ctx, workspaceID, append([]string{"docker", "compose"}, args...), onOutput)
+	if err != nil {
+		return res, fmt.Errorf("docker compose %s: %w", args[0], err)
+	}
+	if res.ExitCode != 0 {
+		detail := strings.TrimSpace(res.Stderr)
+		if detail == "" {
+			detail = fmt.Sprintf("exit code %d", res.ExitCode)
+		}
+		return res, fmt.Errorf("docker compose %s: %s", args[0], detail)
+	}
+	return res, nil
+}
+
+// inspectRestartCounts maps container names to their restart counts.
+func (s *Services) inspectRestartCounts(ctx context.Context, workspaceID string, containers []string) (map[string]int, error) {
+	argv := append([]string{"docker", "inspect", "--format", "{{.Name}} {{.RestartCount}}"}, containers...)
+	res, err := s.runner.Run(ctx, workspaceID, argv, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("docker inspect: exit code %d", res.ExitCode)
+	}
+	counts := map[string]int{}
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		name, count, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(count)); err == nil {
+			counts[strings.TrimPrefix(name, "/")] = n
+		}
+	}
+	return counts, nil
+}
+
+type psEntry struct {
+	Name       string `json:"Name"`
+	Service    string `json:"Service"`
+	Image      string `json:"Image"`
+	State      string `json:"State"`
+	Health     string `json:"Health"`
+	Status     string `json:"Status"`
+	ExitCode   int    `json:"ExitCode"`
+	Publishers []struct {
+		URL           string `json:"URL"`
+		TargetPort    int    `json:"TargetPort"`
+		PublishedPort int    `json:"PublishedPort"`
+		Protocol      string `json:"Protocol"`
+	} `json:"Publishers"`
+}
+
+// parsePSOutput accepts both the JSON array printed by compose < 2.21 and
+// the one-object-per-line output of later versions.
+func parsePSOutput(data []byte) ([]ServiceStatus, error) {
+	data = bytes.TrimSpace(data)
+	var entries []psEntry
+	switch {
+	case len(data) == 0:
+	case data[0] == '[':
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("parse compose ps json: %w", err)
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var entry psEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return nil, fmt.Errorf("parse compose ps json: %w", err)
+			}
+			entries = append(entries, entry)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]ServiceStatus, 0, len(entries))
+	for _, e := range entries {
+		status := ServiceStatus{
+			Service:   e.Service,
+			Container: e.Name,
+			Image:     e.Image,
+			State:     e.State,
+			Health:    e.Health,
+			Status:    e.Status,
+			ExitCode:  e.ExitCode,
+		}
+		for _, p := range e.Publishers {
+			if p.PublishedPort <= 0 {
+				continue
+			}
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			status.Ports = append(status.Ports, PublishedPort{
+				Service:    e.Service,
+				HostIP:     p.URL,
+				HostPort:   p.PublishedPort,
+				TargetPort: p.TargetPort,
+				Protocol:   protocol,
+			})
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Service != out[j].Service {
+			return out[i].Service < out[j].Service
+		}
+		return out[i].Container < out[j].Container
+	})
+	return out, nil
+}
+
+// containerReplicaSuffix matches the "-1" replica suffix compose appends to
+// container names in log prefixes.
+var containerReplicaSuffix = regexp.MustCompile(`-\d+$`)
+
+// parseLogLine splits compose's "<container>  | <line>" prefix.
+func parseLogLine(raw string) LogLine {
+	prefix, line, ok := strings.Cut(raw, " | ")
+	if !ok || strings.ContainsAny(strings.TrimSpace(prefix), " \t") {
+		return LogLine{Line: raw}
+	}
+	return LogLine{
+		Service: containerReplicaSuffix.ReplaceAllString(strings.TrimSpace(prefix), ""),
+		Line:    line,
+	}
+}
@@ -0,0 +1,112 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeRunner struct {
+	calls   [][]string
+	outputs map[string]CommandResult
+	chunks  []string
+}
+
+func (f *fakeRunner) Run(_ context.Context, _ string, argv []string, onOutput func(stream, data string)) (CommandResult, error) {
+	f.calls = append(f.calls, argv)
+	if onOutput != nil {
+		for _, chunk := range f.chunks {
+			onOutput("stdout", chunk)
+		}
+	}
+	return f.outputs[strings.Join(argv[:3], " ")], nil
+}
+
+func TestServicesPSParsesLineAndArrayOutput(t *testing.T) {
+	lines := `{"Name":"app-web-1","Service":"web","Image":"node:20","State":"running","Health":"healthy","Status":"Up 3 minutes","ExitCode":0,"Publishers":[{"URL":"0.0.0.0","TargetPort":3000,"PublishedPort":3000,"Protocol":"tcp"},{"TargetPort":9229,"PublishedPort":0}]}
+{"Name":"app-db-1","Service":"db","Image":"postgres:16","State":"exited","Status":"Exited (1)","ExitCode":1}
+`
+	array := `[` + strings.Join(strings.Split(strings.TrimSpace(lines), "\n"), ",") + `]`
+
+	for name, out := range map[string]string{"lines": lines, "array": array} {
+		t.Run(name, func(t *testing.T) {
+			runner := &fakeRunner{outputs: map[string]CommandResult{
+				"docker compose ps":       {Stdout: out},
+				"docker inspect --format": {Stdout: "/app-web-1 0\n/app-db-1 4\n"},
+			}}
+			services, err := NewServices(runner).PS(context.Background(), "ws-1")
+			if err != nil {
+				t.Fatalf("ps: %v", err)
+			}
+			if len(services) != 2 {
+				t.Fatalf("expected 2 services, got %#v", services)
+			}
+			db, web := services[0], services[1]
+			if db.Service != "db" || db.State != "exited" || db.ExitCode != 1 || db.RestartCount != 4 {
+				t.Fatalf("unexpected db status: %#v", db)
+			}
+			if web.Health != "healthy" || web.Image != "node:20" || len(web.Ports) != 1 || web.Ports[0].HostPort != 3000 {
+				t.Fatalf("unexpected web status: %#v", web)
+			}
+			inspect := runner.calls[1]
+			if !reflect.DeepEqual(inspect[len(inspect)-2:], []string{"app-db-1", "app-web-1"}) {
+				t.Fatalf("expected inspect of both containers, got %v", inspect)
+			}
+		})
+	}
+}
+
+func TestServicesLogsSplitsServicePrefixes(t *testing.T) {
+	runner := &fakeRunner{chunks: []string{"web-1  | listening on :3000\ndb-1   | ready", " to accept\n", "plain line\n"}}
+	var got []LogLine
+	err := NewServices(runner).Logs(context.Background(), "ws-1", LogsOptions{Services: []string{"web", "db"}, Tail: 50, Follow: true}, func(l LogLine) {
+		got = append(got, l)
+	})
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	want := []LogLine{
+		{Service: "web", Line: "listening on :3000"},
+		{Service: "db", Line: "ready to accept"},
+		{Line: "plain line"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected lines:\n got %#v\nwant %#v", got, want)
+	}
+	wantArgs := []string{"docker", "compose", "logs", "--no-color", "--follow", "--tail", "50", "web", "db"}
+	if !reflect.DeepEqual(runner.calls[0], wantArgs) {
+		t.Fatalf("unexpected argv %v", runner.calls[0])
+	}
+}
+
+func TestServicesReportsCommandFailures(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]CommandResult{
+		"docker compose restart": {ExitCode: 1, Stderr: "no such service: api\n"},
+	}}
+	err := NewServices(runner).Restart(context.Background(), "ws-1", []string{"api"})
+	if err == nil || !strings.Contains(err.Error(), "no such service: api") {
+		t.Fatalf("expected restart failure, got %v", err)
+	}
+}
+
+func TestServicesRejectFlagLikeServiceNames(t *testing.T) {
+	runner := &fakeRunner{}
+	svc := NewServices(runner)
+	ctx := context.Background()
+	for _, services := range [][]string{{"--project-directory=/"}, {"web", "-f"}, {""}} {
+		if err := svc.Up(ctx, "ws-1", services, false); !errors.Is(err, ErrInvalidService) {
+			t.Fatalf("Up(%q) = %v", services, err)
+		}
+		if err := svc.Restart(ctx, "ws-1", services); !errors.Is(err, ErrInvalidService) {
+			t.Fatalf("Restart(%q) = %v", services, err)
+		}
+		if err := svc.Logs(ctx, "ws-1", LogsOptions{Services: services}, func(LogLine) {}); !errors.Is(err, ErrInvalidService) {
+			t.Fatalf("Logs(%q) = %v", services, err)
+		}
+	}
+	if len(runner.calls) != 0 {
+		t.Fatalf("expected nothing to run, got %v", runner.calls)
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import "fmt"
+
+// WorkspaceLifecycle holds the "lifecycle" section of workspace.json: hooks
+// run inside the workspace at points in its life.
+type WorkspaceLifecycle struct {
+	OnCreate  []LifecycleHook `json:"onCreate,omitempty"`
+	PostStart []LifecycleHook `json:"postStart,omitempty"`
+	PreStop   []LifecycleHook `json:"preStop,omitempty"`
+	OnFork    []LifecycleHook `json:"onFork,omitempty"`
+	PreRemove []LifecycleHook `json:"preRemove,omitempty"`
+}
+
+// LifecycleHook is one command run for a lifecycle stage. A hook without
+// args runs command through sh -c.
+type LifecycleHook struct {
+	Name      string            `json:"name,omitempty"`
+	Command   string            `json:"command"`
+	Args      []string          `json:"args,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	TimeoutMs int               `json:"timeoutMs,omitempty"`
+	// OnFailure is "abort" or "warn". Empty uses the stage default: abort
+	// for onCreate, postStart and onFork, warn for preStop and preRemove.
+	OnFailure string `json:"onFailure,omitempty"`
+}
+
+// Hooks returns the hooks declared for stage, such as "onCreate".
+func (l WorkspaceLifecycle) Hooks(stage string) []LifecycleHook {
+	switch stage {
+	case "onCreate":
+		return l.OnCreate
+	case "postStart":
+		return l.PostStart
+	case "preStop":
+		return l.PreStop
+	case "onFork":
+		return l.OnFork
+	case "preRemove":
+		return l.PreRemove
+	default:
+		return nil
+	}
+}
+
+// Argv returns the command line the hook runs.
+func (h LifecycleHook) Argv() []string {
+	if len(h.Args) == 0 {
+		return []string{"sh", "-c", h.Command}
+	}
+	return append([]string{h.Command}, h.Args...)
+}
+
+func (l WorkspaceLifecycle) validate() error {
+	stages := []struct {
+		name  string
+		hooks []LifecycleHook
+	}{
+		{"onCreate", l.OnCreate},
+		{"postStart", l.PostStart},
+		{"preStop", l.PreStop},
+		{"onFork", l.OnFork},
+		{"preRemove", l.PreRemove},
+	}
+	for _, stage := range stages {
+		for i, hook := range stage.hooks {
+			if err := hook.validate(); err != nil {
+				return fmt.Errorf("lifecycle.%s[%d]: %w", stage.name, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (h LifecycleHook) validate() error {
+	if h.Command == "" {
+		return fmt.Errorf("command is required")
+	}
+	if h.TimeoutMs < 0 {
+		return fmt.Errorf("timeoutMs must not be negative")
+	}
+	switch h.OnFailure {
+	case "", "abort", "warn":
+	default:
+		return fmt.Errorf("onFailure must be one of abort or warn")
+	}
+	for key := range h.Env {
+		if key == "" {
+			return fmt.Errorf("env keys must not be empty")
+		}
+	}
+	return nil
+}
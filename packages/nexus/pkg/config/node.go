@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 // NodeConfig describes the capabilities and identity of a Nexus node (host machine).
@@ -19,6 +21,53 @@ type NodeConfig struct {
 	Node          NodeIdentity      `json:"node,omitempty"`
 	Capabilities  NodeCapabilities  `json:"capabilities,omitempty"`
 	Compatibility NodeCompatibility `json:"compatibility,omitempty"`
+	Proxy         NodeProxy         `json:"proxy,omitempty"`
+	Personal      NodePersonal      `json:"personal,omitempty"`
+}
+
+// NodePersonal is the user's personal layer, applied to every VM workspace
+// after guest bootstrap: dotfiles, an install command and host files such as
+// ~/.gitconfig.
+type NodePersonal struct {
+	// Dotfiles is a git URL or a host directory. It is unpacked at
+	// ~/.dotfiles in the guest.
+	Dotfiles string `json:"dotfiles,omitempty"`
+	// Ref is the branch or tag checked out when Dotfiles is a git URL.
+	Ref string `json:"ref,omitempty"`
+	// Install is a shell command run in ~/.dotfiles after unpacking.
+	Install string `json:"install,omitempty"`
+	// Files are host paths under the home directory copied to the same
+	// place in the guest home directory. A leading ~/ is expanded.
+	Files []string `json:"files,omitempty"`
+}
+
+// Enabled reports whether there is anything to apply.
+func (p NodePersonal) Enabled() bool {
+	return strings.TrimSpace(p.Dotfiles) != "" || len(p.Files) > 0
+}
+
+// NodeProxy configures the daemon's HTTP front door, which routes
+// <port>.<workspace>.<baseDomain> to forwarded workspace ports.
+type NodeProxy struct {
+	// BaseDomain is the hostname suffix served by the proxy. Defaults to
+	// "localhost", which browsers resolve to loopback without DNS setup.
+	BaseDomain string `json:"baseDomain,omitempty"`
+	// RewriteHost rewrites Host and Origin to localhost:<port> before
+	// proxying, for dev servers that reject unfamiliar host names.
+	RewriteHost bool `json:"rewriteHost,omitempty"`
+	// ShareAddress is the interface spotlight shares listen on. Defaults to
+	// the host's first non-loopback IPv4 address.
+	ShareAddress string `json:"shareAddress,omitempty"`
+}
+
+// ProxyBaseDomain returns the configured proxy base domain, or "localhost".
+func (c *NodeConfig) ProxyBaseDomain() string {
+	if c != nil {
+		if d := strings.Trim(strings.ToLower(strings.TrimSpace(c.Proxy.BaseDomain)), "."); d != "" {
+			return d
+		}
+	}
+	return "localhost"
 }
 
 type NodeCompatibility struct {
@@ -123,6 +172,20 @@ func (c *NodeConfig) ValidateBasic() error {
 			return fmt.Errorf("minimumDaemonVersion must be semver-like (e.g. v0.3.0): %q", v)
 		}
 	}
+	if d := strings.TrimSpace(c.Proxy.BaseDomain); d != "" && strings.ContainsAny(d, "/:* ") {
+		return fmt.Errorf("proxy.baseDomain must be a bare domain name: %q", d)
+	}
+	if a := strings.TrimSpace(c.Proxy.ShareAddress); a != "" && net.ParseIP(a) == nil {
+		return fmt.Errorf("proxy.shareAddress must be an IP address: %q", a)
+	}
+	if strings.TrimSpace(c.Personal.Install) != "" && strings.TrimSpace(c.Personal.Dotfiles) == "" {
+		return fmt.Errorf("personal.install requires personal.dotfiles")
+	}
+	for _, f := range c.Personal.Files {
+		if strings.TrimSpace(f) == "" {
+			return fmt.Errorf("personal.files entries must not be empty")
+		}
+	}
 	return nil
 }
 
@@ -180,3 +180,34 @@ func TestNodeDBPath_DefaultsToDotNexusWhenXDGStateHomeMissing(t *testing.T) {
 		t.Fatalf("expected default node db path %q, got %q", want, got)
 	}
 }
+
+func TestLoadNodeConfig_ProxyBaseDomain(t *testing.T) {
+	if got := config.DefaultNodeConfig().ProxyBaseDomain(); got != "localhost" {
+		t.Fatalf("expected default base domain localhost, got %q", got)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "node.json")
+	data, _ := json.Marshal(map[string]any{
+		"version": 1,
+		"proxy":   map[string]any{"baseDomain": "Dev.Test.", "rewriteHost": true},
+	})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ProxyBaseDomain() != "dev.test" || !cfg.Proxy.RewriteHost {
+		t.Fatalf("unexpected proxy config %#v", cfg.Proxy)
+	}
+
+	data, _ = json.Marshal(map[string]any{"version": 1, "proxy": map[string]any{"baseDomain": "http://x"}})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadNodeConfig(path); err == nil {
+		t.Fatal("expected invalid base domain to be rejected")
+	}
+}
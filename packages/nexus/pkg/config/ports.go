@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// WorkspacePorts holds the port rules from the "ports" section of
+// workspace.json.
+type WorkspacePorts struct {
+	Rules []PortRule `json:"rules,omitempty"`
+}
+
+// PortRule matches detected ports by number, range or owning process and
+// says what to do with them. Rules are evaluated in order and the first
+// match wins.
+type PortRule struct {
+	Port    int    `json:"port,omitempty"`
+	Range   string `json:"range,omitempty"`
+	Process string `json:"process,omitempty"`
+
+	AutoExpose *bool  `json:"autoExpose,omitempty"`
+	Ignore     bool   `json:"ignore,omitempty"`
+	LocalPort  int    `json:"localPort,omitempty"`
+	Label      string `json:"label,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+}
+
+// PortPolicy is the outcome of matching a port against the rules.
+type PortPolicy struct {
+	Matched bool
+	// AutoExpose is nil when no rule decided; callers fall back to their
+	// default.
+	AutoExpose *bool
+	Ignore     bool
+	LocalPort  int
+	Label      string
+	Protocol   string
+}
+
+// ShouldAutoExpose reports the rule's autoExpose decision, or fallback when
+// the rule did not set one. Ignored ports are never exposed.
+func (p PortPolicy) ShouldAutoExpose(fallback bool) bool {
+	if p.Ignore {
+		return false
+	}
+	if p.AutoExpose != nil {
+		return *p.AutoExpose
+	}
+	return fallback
+}
+
+// Resolve returns the policy of the first rule matching port and process.
+func (c WorkspacePorts) Resolve(port int, process string) PortPolicy {
+	for _, rule := range c.Rules {
+		if !rule.Matches(port, process) {
+			continue
+		}
+		return PortPolicy{
+			Matched:    true,
+			AutoExpose: rule.AutoExpose,
+			Ignore:     rule.Ignore,
+			LocalPort:  rule.LocalPort,
+			Label:      rule.Label,
+			Protocol:   rule.Protocol,
+		}
+	}
+	return PortPolicy{}
+}
+
+// Matches reports whether every matcher set on the rule accepts the port.
+// Process is a case-insensitive glob matched against the process name.
+func (r PortRule) Matches(port int, process string) bool {
+	if r.Port > 0 && r.Port != port {
+		return false
+	}
+	if r.Range != "" {
+		lo, hi, err := parsePortRange(r.Range)
+		if err != nil || port < lo || port > hi {
+			return false
+		}
+	}
+	if r.Process != "" {
+		name := strings.ToLower(ProcessName(process))
+		ok, err := path.Match(strings.ToLower(r.Process), name)
+		if err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ProcessName extracts the command name from a port scanner's process
+// column. ss reports owners as users:(("node",pid=12,fd=20)); other scanners
+// report the bare name.
+func ProcessName(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if rest, ok := strings.CutPrefix(raw, `users:(("`); ok {
+		if name, _, ok := strings.Cut(rest, `"`); ok {
+			return name
+		}
+	}
+	return raw
+}
+
+func (c WorkspacePorts) validate() error {
+	for i, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("ports.rules[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r PortRule) validate() error {
+	if r.Port == 0 && r.Range == "" && r.Process == "" {
+		return fmt.Errorf("one of port, range or process is required")
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if r.Range != "" {
+		if _, _, err := parsePortRange(r.Range); err != nil {
+			return err
+		}
+	}
+	if r.Process != "" {
+		if _, err := path.Match(r.Process, ""); err != nil {
+			return fmt.Errorf("process pattern %q: %w", r.Process, err)
+		}
+	}
+	if r.LocalPort < 0 || r.LocalPort > 65535 {
+		return fmt.Errorf("localPort must be between 1 and 65535")
+	}
+	if r.LocalPort > 0 && r.Port == 0 {
+		return fmt.Errorf("localPort requires a single port match")
+	}
+	if r.Ignore && r.AutoExpose != nil && *r.AutoExpose {
+		return fmt.Errorf("ignore and autoExpose cannot both be set")
+	}
+	switch r.Protocol {
+	case "", "tcp", "udp":
+	default:
+		return fmt.Errorf("protocol must be one of tcp or udp")
+	}
+	return nil
+}
+
+// parsePortRange parses "lo-hi" into an inclusive range.
+func parsePortRange(s string) (int, int, error) {
+	loStr, hiStr, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("range %q must look like 3000-3999", s)
+	}
+	lo, errLo := strconv.Atoi(strings.TrimSpace(loStr))
+	hi, errHi := strconv.Atoi(strings.TrimSpace(hiStr))
+	if errLo != nil || errHi != nil || lo < 1 || hi > 65535 || lo > hi {
+		return 0, 0, fmt.Errorf("range %q must be two ports between 1 and 65535, low first", s)
+	}
+	return lo, hi, nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspacePorts_ResolveFirstMatchWins(t *testing.T) {
+	yes, no := true, false
+	ports := WorkspacePorts{Rules: []PortRule{
+		{Port: 9229, Ignore: true},
+		{Range: "9000-9999", AutoExpose: &no, Label: "tools"},
+		{Process: "Vite*", AutoExpose: &yes, Label: "web"},
+	}}
+
+	if p := ports.Resolve(9229, ""); !p.Ignore || p.ShouldAutoExpose(true) {
+		t.Fatalf("expected 9229 ignored, got %#v", p)
+	}
+	if p := ports.Resolve(9100, ""); p.Label != "tools" || p.ShouldAutoExpose(true) {
+		t.Fatalf("expected range rule for 9100, got %#v", p)
+	}
+	if p := ports.Resolve(5173, `users:(("vite-dev",pid=4,fd=18))`); p.Label != "web" || !p.ShouldAutoExpose(false) {
+		t.Fatalf("expected process rule for vite, got %#v", p)
+	}
+	if p := ports.Resolve(8080, "node"); p.Matched || !p.ShouldAutoExpose(true) {
+		t.Fatalf("expected no match for 8080, got %#v", p)
+	}
+}
+
+func TestWorkspacePorts_ValidateRejectsBadRules(t *testing.T) {
+	yes := true
+	cases := map[string]PortRule{
+		"no matcher":          {Label: "x"},
+		"bad range":           {Range: "4000-3000"},
+		"bad protocol":        {Port: 53, Protocol: "sctp"},
+		"localPort on range":  {Range: "3000-3999", LocalPort: 13000},
+		"ignore + autoExpose": {Port: 80, Ignore: true, AutoExpose: &yes},
+		"bad glob":            {Process: "[node"},
+	}
+	for name, rule := range cases {
+		cfg := WorkspaceConfig{Ports: WorkspacePorts{Rules: []PortRule{rule}}}
+		if err := cfg.ValidateBasic(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestLoader_LoadsPortRules(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".nexus"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"version":1,"ports":{"rules":[{"port":5432,"localPort":15432,"label":"db","protocol":"tcp"}]}}`
+	if err := os.WriteFile(filepath.Join(root, ".nexus", "workspace.json"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := LoadWorkspaceConfig(root)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := cfg.Ports.Resolve(5432, ""); got.LocalPort != 15432 || got.Label != "db" || got.Protocol != "tcp" {
+		t.Fatalf("unexpected policy: %#v", got)
+	}
+}
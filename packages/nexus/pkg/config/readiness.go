@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// WorkspaceReadiness holds the "readiness" section of workspace.json: named
+// profiles of checks that workspace.ready can wait on.
+type WorkspaceReadiness struct {
+	Profiles map[string][]ReadinessCheck `json:"profiles,omitempty"`
+}
+
+// ReadinessCheck is one probe in a readiness profile. Type selects which
+// fields apply:
+//
+//	command          Command, Args; ready when the command exits 0
+//	service          ServiceName, ExpectRunning; a daemon-managed service
+//	http             URL, ExpectStatus, BodyRegex
+//	tcp              Port, Host; a port accepting connections in the workspace
+//	log              ServiceName, Pattern; a regex matched against the output
+//	compose-healthy  ServiceName; a compose service reporting healthy
+type ReadinessCheck struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type,omitempty"`
+	Command       string   `json:"command,omitempty"`
+	Args          []string `json:"args,omitempty"`
+	ServiceName   string   `json:"serviceName,omitempty"`
+	ExpectRunning *bool    `json:"expectRunning,omitempty"`
+	URL           string   `json:"url,omitempty"`
+	ExpectStatus  int      `json:"expectStatus,omitempty"`
+	BodyRegex     string   `json:"bodyRegex,omitempty"`
+	Host          string   `json:"host,omitempty"`
+	Port          int      `json:"port,omitempty"`
+	Pattern       string   `json:"pattern,omitempty"`
+	// TimeoutMs bounds a single attempt of the check.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+}
+
+// Kind returns the check type, inferring service or command checks written
+// before the type field existed.
+func (c ReadinessCheck) Kind() string {
+	if c.Type != "" {
+		return c.Type
+	}
+	if c.ServiceName != "" {
+		return "service"
+	}
+	return "command"
+}
+
+func (r WorkspaceReadiness) validate() error {
+	for profile, checks := range r.Profiles {
+		if profile == "" {
+			return fmt.Errorf("readiness.profiles: profile name is required")
+		}
+		if len(checks) == 0 {
+			return fmt.Errorf("readiness.profiles.%s: at least one check is required", profile)
+		}
+		for i, check := range checks {
+			if err := check.Validate(); err != nil {
+				return fmt.Errorf("readiness.profiles.%s[%d]: %w", profile, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate reports missing or malformed fields for the check's type.
+func (c ReadinessCheck) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if c.TimeoutMs < 0 {
+		return fmt.Errorf("timeoutMs must not be negative")
+	}
+	switch c.Kind() {
+	case "command":
+		if c.Command == "" {
+			return fmt.Errorf("command is required")
+		}
+	case "service", "compose-healthy":
+		if c.ServiceName == "" {
+			return fmt.Errorf("serviceName is required")
+		}
+	case "http":
+		if c.URL == "" {
+			return fmt.Errorf("url is required")
+		}
+		if c.ExpectStatus != 0 && (c.ExpectStatus < 100 || c.ExpectStatus > 599) {
+			return fmt.Errorf("expectStatus must be an HTTP status code")
+		}
+		if c.BodyRegex != "" {
+			if _, err := regexp.Compile(c.BodyRegex); err != nil {
+				return fmt.Errorf("bodyRegex: %w", err)
+			}
+		}
+	case "tcp":
+		if c.Port < 1 || c.Port > 65535 {
+			return fmt.Errorf("port must be between 1 and 65535")
+		}
+	case "log":
+		if c.ServiceName == "" {
+			return fmt.Errorf("serviceName is required")
+		}
+		if c.Pattern == "" {
+			return fmt.Errorf("pattern is required")
+		}
+		if _, err := regexp.Compile(c.Pattern); err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+	default:
+		return fmt.Errorf("type must be one of command, service, http, tcp, log or compose-healthy")
+	}
+	return nil
+}
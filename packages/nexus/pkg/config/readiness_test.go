@@ -0,0 +1,49 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspaceReadiness_ValidateRejectsBadChecks(t *testing.T) {
+	cases := map[string]ReadinessCheck{
+		"no name":              {Command: "true"},
+		"unknown type":         {Name: "x", Type: "ping"},
+		"http without url":     {Name: "x", Type: "http"},
+		"http bad status":      {Name: "x", Type: "http", URL: "http://localhost", ExpectStatus: 42},
+		"http bad regex":       {Name: "x", Type: "http", URL: "http://localhost", BodyRegex: "("},
+		"tcp without port":     {Name: "x", Type: "tcp"},
+		"log without pattern":  {Name: "x", Type: "log", ServiceName: "web"},
+		"compose without name": {Name: "x", Type: "compose-healthy"},
+	}
+	for name, check := range cases {
+		cfg := WorkspaceConfig{Readiness: WorkspaceReadiness{Profiles: map[string][]ReadinessCheck{"p": {check}}}}
+		if err := cfg.ValidateBasic(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestLoader_LoadsReadinessProfiles(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".nexus"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"version":1,"readiness":{"profiles":{"web":[{"name":"http","type":"http","url":"http://127.0.0.1:3000/health","expectStatus":200},{"name":"db","type":"tcp","port":5432},{"name":"api","serviceName":"api"}]}}}`
+	if err := os.WriteFile(filepath.Join(root, ".nexus", "workspace.json"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := LoadWorkspaceConfig(root)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	checks := cfg.Readiness.Profiles["web"]
+	if len(checks) != 3 {
+		t.Fatalf("expected 3 checks, got %#v", checks)
+	}
+	if checks[0].ExpectStatus != 200 || checks[1].Port != 5432 || checks[2].Kind() != "service" {
+		t.Fatalf("unexpected checks %#v", checks)
+	}
+}
@@ -7,6 +7,28 @@ type WorkspaceConfig struct {
 	Version          int                       `json:"version,omitempty"`
 	Isolation        WorkspaceIsolation        `json:"isolation,omitempty"`
 	InternalFeatures WorkspaceInternalFeatures `json:"internalFeatures,omitempty"`
+	Ports            WorkspacePorts            `json:"ports,omitempty"`
+	Readiness        WorkspaceReadiness        `json:"readiness,omitempty"`
+	Lifecycle        WorkspaceLifecycle        `json:"lifecycle,omitempty"`
+	Terminal         WorkspaceTerminal         `json:"terminal,omitempty"`
+}
+
+// WorkspaceTerminal holds defaults for the workspace's PTY sessions.
+type WorkspaceTerminal struct {
+	// Record records sessions whose pty.open does not say otherwise.
+	Record bool `json:"record,omitempty"`
+	// ScrollbackBytes sizes the output kept for replay on pty.attach.
+	ScrollbackBytes int `json:"scrollbackBytes,omitempty"`
+}
+
+// MaxScrollbackBytes bounds the scrollback kept per PTY session.
+const MaxScrollbackBytes = 16 << 20
+
+func (t WorkspaceTerminal) validate() error {
+	if t.ScrollbackBytes < 0 || t.ScrollbackBytes > MaxScrollbackBytes {
+		return fmt.Errorf("terminal.scrollbackBytes must be between 0 and %d", MaxScrollbackBytes)
+	}
+	return nil
 }
 
 type WorkspaceIsolation struct {
@@ -60,5 +82,17 @@ func (c WorkspaceConfig) ValidateBasic() error {
 	default:
 		return fmt.Errorf("isolation.vm.mode must be one of pool or dedicated")
 	}
+	if err := c.Ports.validate(); err != nil {
+		return err
+	}
+	if err := c.Readiness.validate(); err != nil {
+		return err
+	}
+	if err := c.Lifecycle.validate(); err != nil {
+		return err
+	}
+	if err := c.Terminal.validate(); err != nil {
+		return err
+	}
 	return nil
 }
@@ -26,3 +26,10 @@ func TestWorkspaceConfig_NegativeVersionRejected(t *testing.T) {
 		t.Fatal("expected validation error for negative version")
 	}
 }
+
+func TestWorkspaceConfig_ScrollbackBytesBounded(t *testing.T) {
+	cfg := WorkspaceConfig{Terminal: WorkspaceTerminal{ScrollbackBytes: MaxScrollbackBytes + 1}}
+	if err := cfg.ValidateBasic(); err == nil {
+		t.Fatal("expected validation error for oversized scrollback")
+	}
+}
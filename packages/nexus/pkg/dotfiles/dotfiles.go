@@ -0,0 +1,373 @@
+// Package dotfiles builds the user's personal layer (dotfiles, an install
+// command and selected home files) on the host and applies it inside VM
+// workspaces.
+package dotfiles
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+)
+
+const (
+	// guestDotfilesDir is where dotfiles land, relative to the guest home.
+	guestDotfilesDir = ".dotfiles"
+	// refreshInterval is how long a built bundle is reused before the
+	// dotfiles repo is fetched and the bundle rebuilt.
+	refreshInterval = 15 * time.Minute
+	// maxBundleBytes bounds the compressed layer pushed into each guest.
+	maxBundleBytes = 8 << 20
+	// uploadChunkBytes keeps each base64 chunk well under the kernel's
+	// single-argument limit.
+	uploadChunkBytes = 96 << 10
+	maxOutputBytes   = 16 << 10
+)
+
+// Runner runs argv inside a workspace and returns its exit code and
+// combined output.
+type Runner func(ctx context.Context, argv []string) (int, string, error)
+
+// Bundle is the personal layer packed as a gzipped tar rooted at the guest
+// home directory.
+type Bundle struct {
+	Archive     []byte
+	Revision    string
+	HasDotfiles bool
+	BuiltAt     time.Time
+}
+
+// Status is the outcome of applying the layer to one workspace.
+type Status struct {
+	State     string    `json:"state"`
+	Revision  string    `json:"revision,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Output    string    `json:"output,omitempty"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+const (
+	StateApplying = "applying"
+	StateApplied  = "applied"
+	StateFailed   = "failed"
+)
+
+// Layer builds the personal layer once and reuses it across workspaces.
+type Layer struct {
+	cfg      config.NodePersonal
+	cacheDir string
+	home     string
+	now      func() time.Time
+
+	mu     sync.Mutex
+	bundle *Bundle
+}
+
+// New returns a layer for cfg that clones git dotfiles under cacheDir.
+func New(cfg config.NodePersonal, cacheDir string) *Layer {
+	home, _ := os.UserHomeDir()
+	return &Layer{cfg: cfg, cacheDir: cacheDir, home: home, now: time.Now}
+}
+
+// DefaultCacheDir returns $XDG_CACHE_HOME/nexus/dotfiles, or
+// ~/.cache/nexus/dotfiles.
+func DefaultCacheDir() string {
+	cacheBase := os.Getenv("XDG_CACHE_HOME")
+	if cacheBase == "" {
+		home, _ := os.UserHomeDir()
+		cacheBase = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(cacheBase, "nexus", "dotfiles")
+}
+
+// Bundle returns the packed layer, rebuilding it when older than the
+// refresh interval. A failed refresh falls back to the previous bundle.
+func (l *Layer) Bundle(ctx context.Context) (*Bundle, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.bundle != nil && l.now().Sub(l.bundle.BuiltAt) < refreshInterval {
+		return l.bundle, nil
+	}
+	b, err := l.build(ctx)
+	if err != nil {
+		if l.bundle != nil {
+			return l.bundle, nil
+		}
+		return nil, err
+	}
+	l.bundle = b
+	return b, nil
+}
+
+// Apply unpacks the layer into the guest home and runs the install command.
+func (l *Layer) Apply(ctx context.Context, run Runner) Status {
+	status := Status{AppliedAt: l.now().UTC()}
+	fail := func(err error) Status {
+		status.State = StateFailed
+		status.Error = err.Error()
+		return status
+	}
+	b, err := l.Bundle(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	status.Revision = b.Revision
+
+	if err := upload(ctx, run, b); err != nil {
+		return fail(err)
+	}
+	if install := strings.TrimSpace(l.cfg.Install); install != "" && b.HasDotfiles {
+		code, out, err := run(ctx, []string{"sh", "-c", `cd "$HOME/` + guestDotfilesDir + `" && exec sh -c "$0"`, install})
+		status.Output = tail(out)
+		if err != nil {
+			return fail(fmt.Errorf("install: %w", err))
+		}
+		if code != 0 {
+			return fail(fmt.Errorf("install exited with code %d", code))
+		}
+	}
+	status.State = StateApplied
+	return status
+}
+
+const guestBundlePath = `"$HOME/.cache/nexus/personal.tgz.b64"`
+
+func upload(ctx context.Context, run Runner, b *Bundle) error {
+	step := func(what string, argv ...string) error {
+		code, out, err := run(ctx, argv)
+		if err != nil {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		if code != 0 {
+			if msg := strings.TrimSpace(out); msg != "" {
+				return fmt.Errorf("%s: %s", what, tail(msg))
+			}
+			return fmt.Errorf("%s exited with code %d", what, code)
+		}
+		return nil
+	}
+
+	if err := step("prepare upload", "sh", "-c", `mkdir -p "$HOME/.cache/nexus" && : > `+guestBundlePath); err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(b.Archive)
+	for len(encoded) > 0 {
+		n := min(uploadChunkBytes, len(encoded))
+		if err := step("upload", "sh", "-c", `printf %s "$0" >> `+guestBundlePath, encoded[:n]); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	extract := `base64 -d ` + guestBundlePath + ` | tar -xzf - -C "$HOME" && rm -f ` + guestBundlePath
+	if b.HasDotfiles {
+		extract = `rm -rf "$HOME/` + guestDotfilesDir + `" && ` + extract
+	}
+	return step("unpack", "sh", "-c", extract)
+}
+
+func (l *Layer) build(ctx context.Context) (*Bundle, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	b := &Bundle{BuiltAt: l.now()}
+
+	if source := strings.TrimSpace(l.cfg.Dotfiles); source != "" {
+		dir, revision, err := l.resolveDotfiles(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		if err := addTree(tw, dir, guestDotfilesDir); err != nil {
+			return nil, fmt.Errorf("pack dotfiles: %w", err)
+		}
+		b.Revision = revision
+		b.HasDotfiles = true
+	}
+	for _, f := range l.cfg.Files {
+		hostPath, rel, err := l.homePath(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := addTree(tw, hostPath, rel); err != nil {
+			return nil, fmt.Errorf("pack %s: %w", f, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > maxBundleBytes {
+		return nil, fmt.Errorf("personal layer is %d bytes compressed; the limit is %d", buf.Len(), maxBundleBytes)
+	}
+	b.Archive = buf.Bytes()
+	return b, nil
+}
+
+// homePath expands f and returns it with its path relative to the host home.
+func (l *Layer) homePath(f string) (string, string, error) {
+	f = strings.TrimSpace(f)
+	if rest, ok := strings.CutPrefix(f, "~/"); ok {
+		f = filepath.Join(l.home, rest)
+	} else if !filepath.IsAbs(f) {
+		f = filepath.Join(l.home, f)
+	}
+	rel, err := filepath.Rel(l.home, filepath.Clean(f))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("personal file %s must be inside the home directory", f)
+	}
+	return f, filepath.ToSlash(rel), nil
+}
+
+// resolveDotfiles returns the directory holding the dotfiles and, for git
+// sources, the checked-out commit. Git sources are cloned once into the
+// cache and fetched on later builds.
+func (l *Layer) resolveDotfiles(ctx context.Context, source string) (string, string, error) {
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		return source, "", nil
+	}
+	if !isGitSource(source) {
+		return "", "", fmt.Errorf("dotfiles %s is neither a directory nor a git URL", source)
+	}
+
+	sum := sha256.Sum256([]byte(source + "#" + l.cfg.Ref))
+	dir := filepath.Join(l.cacheDir, hex.EncodeToString(sum[:8]))
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(l.cacheDir, 0o755); err != nil {
+			return "", "", err
+		}
+		args := []string{"clone", "--depth", "1"}
+		if l.cfg.Ref != "" {
+			args = append(args, "--branch", l.cfg.Ref)
+		}
+		if _, err := git(ctx, "", append(args, source, dir)...); err != nil {
+			_ = os.RemoveAll(dir)
+			return "", "", fmt.Errorf("clone dotfiles: %w", err)
+		}
+	} else {
+		ref := l.cfg.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if _, err := git(ctx, dir, "fetch", "--depth", "1", "origin", ref); err != nil {
+			return "", "", fmt.Errorf("fetch dotfiles: %w", err)
+		}
+		if _, err := git(ctx, dir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return "", "", fmt.Errorf("update dotfiles: %w", err)
+		}
+	}
+	revision, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	return dir, revision, nil
+}
+
+func isGitSource(source string) bool {
+	return strings.Contains(source, "://") || strings.HasPrefix(source, "git@") || strings.HasSuffix(source, ".git")
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// addTree writes root to tw under prefix, skipping .git. Symlinks are
+// packed as what they point to, since a link into the host home would
+// dangle in the guest. Dangling links are left out, as is a link back into
+// a directory already being packed.
+func addTree(tw *tar.Writer, root, prefix string) error {
+	return addPath(tw, root, prefix, map[string]bool{})
+}
+
+func addPath(tw *tar.Writer, path, name string, packing map[string]bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if lst, lerr := os.Lstat(path); lerr == nil && lst.Mode()&fs.ModeSymlink != 0 && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+	if info.IsDir() {
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return err
+		}
+		if packing[real] {
+			return nil
+		}
+		packing[real] = true
+		defer delete(packing, real)
+
+		hdr.Name += "/"
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Name() == ".git" {
+				continue
+			}
+			if err := addPath(tw, filepath.Join(path, e.Name()), name+"/"+e.Name(), packing); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func tail(s string) string {
+	if len(s) > maxOutputBytes {
+		return s[len(s)-maxOutputBytes:]
+	}
+	return s
+}
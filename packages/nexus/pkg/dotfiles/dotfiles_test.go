@@ -0,0 +1,175 @@
+package dotfiles
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+)
+
+// hostRunner runs commands on the host with HOME pointed at guestHome, in
+// place of a guest agent.
+func hostRunner(guestHome string, calls *int) Runner {
+	return func(ctx context.Context, argv []string) (int, string, error) {
+		*calls++
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Env = append(os.Environ(), "HOME="+guestHome)
+		out, err := cmd.CombinedOutput()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), string(out), nil
+		}
+		return 0, string(out), err
+	}
+}
+
+func writeFile(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyUnpacksDotfilesAndFilesAndRunsInstall(t *testing.T) {
+	dotfiles := t.TempDir()
+	writeFile(t, filepath.Join(dotfiles, "zshrc"), "export EDITOR=vim\n")
+	writeFile(t, filepath.Join(dotfiles, ".git", "HEAD"), "ref: refs/heads/main\n")
+	hostHome := t.TempDir()
+	writeFile(t, filepath.Join(hostHome, ".gitconfig"), "[user]\n\tname = Dev\n")
+	writeFile(t, filepath.Join(hostHome, ".config", "nvim", "init.lua"), "vim.o.number = true\n")
+
+	layer := New(config.NodePersonal{
+		Dotfiles: dotfiles,
+		Install:  `ln -sf "$PWD/zshrc" "$HOME/.zshrc" && echo installed`,
+		Files:    []string{"~/.gitconfig", ".config/nvim"},
+	}, t.TempDir())
+	layer.home = hostHome
+
+	guestHome := t.TempDir()
+	calls := 0
+	status := layer.Apply(context.Background(), hostRunner(guestHome, &calls))
+	if status.State != StateApplied {
+		t.Fatalf("expected applied, got %#v", status)
+	}
+	if !strings.Contains(status.Output, "installed") {
+		t.Fatalf("expected install output, got %q", status.Output)
+	}
+	for _, rel := range []string{".dotfiles/zshrc", ".zshrc", ".gitconfig", ".config/nvim/init.lua"} {
+		if _, err := os.Stat(filepath.Join(guestHome, rel)); err != nil {
+			t.Fatalf("expected %s in guest home: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(guestHome, ".dotfiles", ".git")); !os.IsNotExist(err) {
+		t.Fatalf("expected .git to be left out, got %v", err)
+	}
+
+	// The bundle is reused until the refresh interval passes.
+	first, _ := layer.Bundle(context.Background())
+	writeFile(t, filepath.Join(dotfiles, "vimrc"), "set nu\n")
+	if again, _ := layer.Bundle(context.Background()); again != first {
+		t.Fatal("expected cached bundle within refresh interval")
+	}
+	layer.now = func() time.Time { return time.Now().Add(refreshInterval + time.Minute) }
+	if rebuilt, _ := layer.Bundle(context.Background()); rebuilt == first {
+		t.Fatal("expected bundle rebuild after refresh interval")
+	}
+}
+
+func TestApplyCopiesSymlinkTargets(t *testing.T) {
+	hostHome := t.TempDir()
+	writeFile(t, filepath.Join(hostHome, "src", "zshrc"), "export EDITOR=vim\n")
+	writeFile(t, filepath.Join(hostHome, "src", "nvim", "init.lua"), "vim.o.number = true\n")
+	dotfiles := filepath.Join(hostHome, "dotfiles")
+	writeFile(t, filepath.Join(dotfiles, "README"), "mine\n")
+	for link, target := range map[string]string{
+		filepath.Join(dotfiles, "zshrc"):      filepath.Join(hostHome, "src", "zshrc"),
+		filepath.Join(dotfiles, "nvim"):       filepath.Join(hostHome, "src", "nvim"),
+		filepath.Join(dotfiles, "gone"):       filepath.Join(hostHome, "missing"),
+		filepath.Join(dotfiles, "loop"):       dotfiles,
+		filepath.Join(hostHome, ".gitconfig"): filepath.Join(hostHome, "src", "zshrc"),
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	layer := New(config.NodePersonal{Dotfiles: dotfiles, Files: []string{"~/.gitconfig"}}, t.TempDir())
+	layer.home = hostHome
+	guestHome := t.TempDir()
+	calls := 0
+	if status := layer.Apply(context.Background(), hostRunner(guestHome, &calls)); status.State != StateApplied {
+		t.Fatalf("expected applied, got %#v", status)
+	}
+	for _, rel := range []string{".dotfiles/zshrc", ".dotfiles/nvim/init.lua", ".gitconfig"} {
+		info, err := os.Lstat(filepath.Join(guestHome, rel))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Fatalf("expected %s to be a regular file in the guest, got %v, %v", rel, info, err)
+		}
+	}
+	for _, rel := range []string{".dotfiles/gone", ".dotfiles/loop"} {
+		if _, err := os.Lstat(filepath.Join(guestHome, rel)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be left out, got %v", rel, err)
+		}
+	}
+}
+
+func TestApplyReportsInstallFailure(t *testing.T) {
+	dotfiles := t.TempDir()
+	writeFile(t, filepath.Join(dotfiles, "install.sh"), "echo nope >&2; exit 4\n")
+	layer := New(config.NodePersonal{Dotfiles: dotfiles, Install: "sh install.sh"}, t.TempDir())
+
+	calls := 0
+	status := layer.Apply(context.Background(), hostRunner(t.TempDir(), &calls))
+	if status.State != StateFailed || status.Error != "install exited with code 4" || !strings.Contains(status.Output, "nope") {
+		t.Fatalf("unexpected status %#v", status)
+	}
+}
+
+func TestBundleClonesGitDotfilesOnceIntoCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, "bashrc"), "alias ll='ls -l'\n")
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "."},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-qm", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+
+	cache := t.TempDir()
+	layer := New(config.NodePersonal{Dotfiles: "file://" + repo}, cache)
+	b, err := layer.Bundle(context.Background())
+	if err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+	if len(b.Revision) != 40 || !b.HasDotfiles {
+		t.Fatalf("expected git revision, got %#v", b)
+	}
+	entries, _ := os.ReadDir(cache)
+	if len(entries) != 1 {
+		t.Fatalf("expected one cached clone, got %d", len(entries))
+	}
+}
+
+func TestHomePathRejectsPathsOutsideHome(t *testing.T) {
+	layer := New(config.NodePersonal{}, t.TempDir())
+	layer.home = "/home/dev"
+	if _, _, err := layer.homePath("/etc/passwd"); err == nil {
+		t.Fatal("expected error for path outside home")
+	}
+	if _, rel, err := layer.homePath("~/.gitconfig"); err != nil || rel != ".gitconfig" {
+		t.Fatalf("unexpected result %q %v", rel, err)
+	}
+}
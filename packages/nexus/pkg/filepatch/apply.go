@@ -0,0 +1,484 @@
+// Package filepatch applies a set of file changes, given as a unified diff
+// or as structured edits, all or nothing. Every precondition is checked
+// before any file is touched; new contents are then staged in temp files
+// next to their targets and renamed into place, and a failure partway
+// restores the files already changed.
+package filepatch
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ActionCreate = "create"
+	ActionModify = "modify"
+	ActionDelete = "delete"
+	ActionRename = "rename"
+
+	StatusOK       = "ok"
+	StatusConflict = "conflict"
+)
+
+// Edit is one structured change. Content replaces the file, creating it if
+// needed; NewPath moves it, with Content if set; Delete removes it. OldHash,
+// when set, must be the Hash of the current content.
+type Edit struct {
+	Path    string  `json:"path"`
+	OldHash string  `json:"oldHash,omitempty"`
+	Content *string `json:"content,omitempty"`
+	// Encoding of Content: "utf8" (the default) or "base64".
+	Encoding string `json:"encoding,omitempty"`
+	NewPath  string `json:"newPath,omitempty"`
+	Delete   bool   `json:"delete,omitempty"`
+}
+
+// FileResult reports what happened, or would happen, to one file.
+type FileResult struct {
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"`
+	Action  string `json:"action"`
+	Status  string `json:"status"`
+	OldHash string `json:"oldHash,omitempty"`
+	NewHash string `json:"newHash,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Result struct {
+	// Applied is false for a dry run and when any file conflicts.
+	Applied   bool         `json:"applied"`
+	DryRun    bool         `json:"dryRun,omitempty"`
+	Conflicts int          `json:"conflicts"`
+	Files     []FileResult `json:"files"`
+}
+
+// Hash is the hex SHA-256 of data, the form OldHash expects.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Resolver maps a user path to an absolute one, refusing paths outside the
+// tree (workspace.SecurePath, say).
+type Resolver func(path string) (string, error)
+
+// PathError is a path the Resolver refused.
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string { return fmt.Sprintf("%s: %v", e.Path, e.Err) }
+func (e *PathError) Unwrap() error { return e.Err }
+
+// EditError is an edit that makes no sense on its own, whatever the tree
+// holds.
+type EditError struct {
+	Path string
+	Msg  string
+}
+
+func (e *EditError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+}
+
+// change is one file operation after validation.
+type change struct {
+	result *FileResult
+	// src is the existing file the change replaces, moves or removes, and
+	// dst where the new content or the moved file ends up.
+	src, dst string
+	data     []byte
+	write    bool
+	mode     fs.FileMode
+
+	staged   string
+	backup   string
+	madeDirs []string
+}
+
+// Apply validates the patches and edits together and, unless dryRun is set
+// or something conflicts, applies them. An error means nothing was
+// changed, except when rolling back itself failed, which the error says.
+func Apply(resolve Resolver, patches []FilePatch, edits []Edit, dryRun bool) (*Result, error) {
+	p := planner{resolve: resolve, claimed: map[string]string{}}
+	for _, fp := range patches {
+		if err := p.addPatch(fp); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range edits {
+		if err := p.addEdit(e); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{DryRun: dryRun, Files: make([]FileResult, 0, len(p.changes))}
+	for _, c := range p.changes {
+		if c.result.Status == StatusConflict {
+			result.Conflicts++
+		}
+	}
+	if dryRun || result.Conflicts > 0 {
+		for _, c := range p.changes {
+			result.Files = append(result.Files, *c.result)
+		}
+		return result, nil
+	}
+	if err := commit(p.changes); err != nil {
+		return nil, err
+	}
+	result.Applied = true
+	for _, c := range p.changes {
+		result.Files = append(result.Files, *c.result)
+	}
+	return result, nil
+}
+
+type planner struct {
+	resolve Resolver
+	changes []*change
+	// claimed maps each absolute path a change touches to the user path
+	// that claimed it, so no file is changed twice.
+	claimed map[string]string
+}
+
+func (p *planner) addPatch(fp FilePatch) error {
+	r := &FileResult{Path: fp.NewPath, Status: StatusOK}
+	c := &change{result: r}
+	switch {
+	case fp.OldPath == "":
+		r.Action = ActionCreate
+	case fp.NewPath == "":
+		r.Action = ActionDelete
+		r.Path = fp.OldPath
+	case fp.OldPath != fp.NewPath:
+		r.Action = ActionRename
+		r.OldPath = fp.OldPath
+	default:
+		r.Action = ActionModify
+	}
+	if err := p.resolvePaths(c, fp.OldPath, fp.NewPath); err != nil {
+		return err
+	}
+
+	var old []byte
+	if c.src != "" {
+		data, mode, err := readFile(c.src)
+		if err != nil {
+			return p.add(c, err)
+		}
+		old, c.mode = data, mode
+		r.OldHash = Hash(data)
+	}
+	if c.dst != "" && c.dst != c.src {
+		if err := mustNotExist(c.dst); err != nil {
+			return p.add(c, err)
+		}
+	}
+
+	data, err := applyHunks(old, fp.Hunks)
+	if err != nil {
+		return p.add(c, err)
+	}
+	switch {
+	case r.Action == ActionDelete:
+		if len(data) > 0 {
+			return p.add(c, fmt.Errorf("file has content the patch does not remove"))
+		}
+	case r.Action == ActionRename && len(fp.Hunks) == 0:
+		// A pure rename moves the file as it is.
+	default:
+		c.data, c.write = data, true
+		r.NewHash = Hash(data)
+	}
+	return p.add(c, nil)
+}
+
+func (p *planner) addEdit(e Edit) error {
+	if e.Path == "" {
+		return &EditError{Msg: "edit without a path"}
+	}
+	r := &FileResult{Path: e.Path, Status: StatusOK}
+	c := &change{result: r}
+	newPath := e.Path
+	switch {
+	case e.Delete:
+		if e.Content != nil || e.NewPath != "" {
+			return &EditError{Path: e.Path, Msg: "delete cannot be combined with content or newPath"}
+		}
+		r.Action = ActionDelete
+		newPath = ""
+	case e.NewPath != "" && e.NewPath != e.Path:
+		r.Action = ActionRename
+		r.Path, r.OldPath = e.NewPath, e.Path
+		newPath = e.NewPath
+	case e.Content == nil:
+		return &EditError{Path: e.Path, Msg: "edit needs content, newPath or delete"}
+	default:
+		r.Action = ActionModify
+	}
+	var data []byte
+	if e.Content != nil {
+		switch e.Encoding {
+		case "", "utf8", "utf-8":
+			data = []byte(*e.Content)
+		case "base64":
+			decoded, err := base64.StdEncoding.DecodeString(*e.Content)
+			if err != nil {
+				return &EditError{Path: e.Path, Msg: "invalid base64 content: " + err.Error()}
+			}
+			data = decoded
+		default:
+			return &EditError{Path: e.Path, Msg: fmt.Sprintf("unknown encoding %q", e.Encoding)}
+		}
+	}
+	if err := p.resolvePaths(c, e.Path, newPath); err != nil {
+		return err
+	}
+
+	current, mode, err := readFile(c.src)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && r.Action == ActionModify && e.OldHash == "":
+		r.Action = ActionCreate
+		c.src = ""
+	case err != nil:
+		return p.add(c, err)
+	default:
+		c.mode = mode
+		r.OldHash = Hash(current)
+		if e.OldHash != "" && e.OldHash != r.OldHash {
+			return p.add(c, fmt.Errorf("content changed: expected hash %s", e.OldHash))
+		}
+	}
+	if r.Action == ActionRename {
+		if err := mustNotExist(c.dst); err != nil {
+			return p.add(c, err)
+		}
+	}
+	if e.Content != nil {
+		c.data, c.write = data, true
+		r.NewHash = Hash(data)
+	}
+	return p.add(c, nil)
+}
+
+// resolvePaths sets c.src and c.dst from the user paths, either of which
+// may be empty.
+func (p *planner) resolvePaths(c *change, oldPath, newPath string) error {
+	for _, rp := range []struct {
+		user string
+		abs  *string
+	}{{oldPath, &c.src}, {newPath, &c.dst}} {
+		if rp.user == "" {
+			continue
+		}
+		abs, err := p.resolve(rp.user)
+		if err != nil {
+			return &PathError{Path: rp.user, Err: err}
+		}
+		*rp.abs = abs
+	}
+	return nil
+}
+
+// add records c, turning err or a second change to one of its paths into a
+// conflict.
+func (p *planner) add(c *change, err error) error {
+	for i, abs := range []string{c.src, c.dst} {
+		if abs == "" || (i == 1 && abs == c.src) {
+			continue
+		}
+		if other, ok := p.claimed[abs]; ok && err == nil {
+			err = fmt.Errorf("also changed by the edit of %s", other)
+		}
+		p.claimed[abs] = c.result.Path
+	}
+	if err != nil {
+		c.result.Status = StatusConflict
+		c.result.Error = err.Error()
+	}
+	p.changes = append(p.changes, c)
+	return nil
+}
+
+// readFile reads a regular file, refusing directories and other types.
+func readFile(path string) ([]byte, fs.FileMode, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, fmt.Errorf("file does not exist: %w", fs.ErrNotExist)
+		}
+		return nil, 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, 0, fmt.Errorf("not a regular file")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, info.Mode().Perm(), nil
+}
+
+func mustNotExist(path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", filepath.Base(path))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// commit stages every new content, then swaps the changes in. Originals
+// are moved aside rather than removed until everything is in place, so a
+// failure can put them back.
+func commit(changes []*change) (err error) {
+	var undo []func() error
+	defer func() {
+		for _, c := range changes {
+			if c.staged != "" {
+				_ = os.Remove(c.staged)
+			}
+		}
+		if err == nil {
+			for _, c := range changes {
+				if c.backup != "" {
+					_ = os.Remove(c.backup)
+				}
+			}
+			return
+		}
+		var failed []error
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undoErr := undo[i](); undoErr != nil {
+				failed = append(failed, undoErr)
+			}
+		}
+		for _, c := range changes {
+			for j := len(c.madeDirs) - 1; j >= 0; j-- {
+				_ = os.Remove(c.madeDirs[j])
+			}
+		}
+		if len(failed) > 0 {
+			err = fmt.Errorf("%w; rolling back also failed, the tree may be partly patched: %w", err, errors.Join(failed...))
+		}
+	}()
+
+	for _, c := range changes {
+		if c.write {
+			if err := c.stage(); err != nil {
+				return fmt.Errorf("%s: %w", c.result.Path, err)
+			}
+		} else if c.dst != "" {
+			if err := c.makeParents(); err != nil {
+				return fmt.Errorf("%s: %w", c.result.Path, err)
+			}
+		}
+	}
+	for _, c := range changes {
+		if c.src != "" {
+			backup, err := tempName(c.src, "orig")
+			if err != nil {
+				return err
+			}
+			if err := os.Rename(c.src, backup); err != nil {
+				return fmt.Errorf("%s: %w", c.result.Path, err)
+			}
+			c.backup = backup
+			src := c.src
+			undo = append(undo, func() error { return os.Rename(backup, src) })
+		}
+		if c.dst == "" {
+			continue
+		}
+		dst := c.dst
+		if !c.write {
+			// A pure rename moves the original itself.
+			backup := c.backup
+			if err := os.Rename(backup, dst); err != nil {
+				return fmt.Errorf("%s: %w", c.result.Path, err)
+			}
+			c.backup = ""
+			undo = append(undo, func() error { return os.Rename(dst, backup) })
+			continue
+		}
+		if err := os.Rename(c.staged, dst); err != nil {
+			return fmt.Errorf("%s: %w", c.result.Path, err)
+		}
+		c.staged = ""
+		undo = append(undo, func() error { return os.Remove(dst) })
+	}
+	return nil
+}
+
+// stage writes the new content to a temp file next to the target.
+func (c *change) stage() error {
+	if err := c.makeParents(); err != nil {
+		return err
+	}
+	name, err := tempName(c.dst, "new")
+	if err != nil {
+		return err
+	}
+	mode := c.mode
+	if mode == 0 {
+		mode = 0o644
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	c.staged = name
+	if _, err := f.Write(c.data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// OpenFile applies the umask; keep the original permissions exactly.
+	return os.Chmod(name, mode)
+}
+
+// makeParents creates the missing directories above c.dst, remembering
+// them so a rollback can remove them again.
+func (c *change) makeParents() error {
+	var missing []string
+	for dir := filepath.Dir(c.dst); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil || dir == filepath.Dir(dir) {
+			break
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		c.madeDirs = append(c.madeDirs, missing[i])
+	}
+	return nil
+}
+
+// tempName returns an unused name in the directory of path.
+func tempName(path, kind string) (string, error) {
+	var b [6]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%s-%s", filepath.Base(path), kind, hex.EncodeToString(b[:]))), nil
+}
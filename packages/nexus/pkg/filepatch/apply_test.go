@@ -0,0 +1,197 @@
+package filepatch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func resolverFor(t *testing.T, root string) Resolver {
+	t.Helper()
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws.SecurePath
+}
+
+const gitDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@
+ package main
+
+-func old() {}
++func renamed() {}
+ // end
+diff --git a/docs/new.md b/docs/new.md
+new file mode 100644
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1,2 @@
++# New
++no newline
+\ No newline at end of file
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/a.txt b/b.txt
+similarity index 100%
+rename from a.txt
+rename to b.txt
+`
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		// The hunk's lines moved down two lines since the diff was made.
+		"main.go":  "// header\n\npackage main\n\nfunc old() {}\n// end\n",
+		"gone.txt": "bye\n",
+		"a.txt":    "moved\n",
+	})
+	patches, err := ParseUnified(gitDiff)
+	if err != nil {
+		t.Fatalf("ParseUnified: %v", err)
+	}
+	result, err := Apply(resolverFor(t, root), patches, nil, false)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if !result.Applied || result.Conflicts != 0 || len(result.Files) != 4 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	actions := []string{}
+	for _, f := range result.Files {
+		actions = append(actions, f.Action+":"+f.Path)
+	}
+	if got := strings.Join(actions, " "); got != "modify:main.go create:docs/new.md delete:gone.txt rename:b.txt" {
+		t.Fatalf("unexpected actions %s", got)
+	}
+	want := map[string]string{
+		"main.go":     "// header\n\npackage main\n\nfunc renamed() {}\n// end\n",
+		"docs/new.md": "# New\nno newline",
+		"b.txt":       "moved\n",
+	}
+	got := readTree(t, root)
+	if len(got) != len(want) {
+		t.Fatalf("unexpected tree %#v", got)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Fatalf("%s = %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func TestApplyConflictsLeaveTreeUntouched(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{"a.txt": "one\n", "b.txt": "two\n", "c.txt": "three\n"}
+	writeFiles(t, root, files)
+	content := "changed\n"
+	edits := []Edit{
+		{Path: "a.txt", OldHash: Hash([]byte("one\n")), Content: &content},
+		{Path: "b.txt", OldHash: Hash([]byte("stale\n")), Content: &content},
+		{Path: "c.txt", NewPath: "a.txt"},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		result, err := Apply(resolverFor(t, root), nil, edits, dryRun)
+		if err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		if result.Applied || result.Conflicts != 2 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+		if result.Files[0].Status != StatusOK || result.Files[1].Status != StatusConflict || result.Files[2].Status != StatusConflict {
+			t.Fatalf("unexpected statuses %+v", result.Files)
+		}
+		if got := readTree(t, root); len(got) != 3 || got["a.txt"] != "one\n" || got["b.txt"] != "two\n" {
+			t.Fatalf("tree changed: %#v", got)
+		}
+	}
+
+	edits[1].OldHash = Hash([]byte("two\n"))
+	edits = edits[:2]
+	result, err := Apply(resolverFor(t, root), nil, edits, false)
+	if err != nil || !result.Applied {
+		t.Fatalf("Apply = %+v, %v", result, err)
+	}
+	if got := readTree(t, root); got["a.txt"] != content || got["b.txt"] != content {
+		t.Fatalf("edits not applied: %#v", got)
+	}
+}
+
+func TestCommitRollsBackOnFailure(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "one\n", "b.txt": "two\n", "blocked": "x"})
+	a := filepath.Join(root, "a.txt")
+	b := filepath.Join(root, "b.txt")
+	changes := []*change{
+		{result: &FileResult{Path: "a.txt"}, src: a, dst: a, data: []byte("new\n"), write: true},
+		{result: &FileResult{Path: "b.txt"}, src: b, dst: filepath.Join(root, "moved", "b.txt")},
+		// blocked is a file, so this fails once the others are in place.
+		{result: &FileResult{Path: "blocked/c.txt"}, src: a, dst: filepath.Join(root, "blocked", "c.txt")},
+	}
+	if err := commit(changes); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+	if got := readTree(t, root); len(got) != 3 || got["a.txt"] != "one\n" || got["b.txt"] != "two\n" {
+		t.Fatalf("tree not restored: %#v", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "moved")); !os.IsNotExist(err) {
+		t.Fatalf("expected the created directory to be removed, got %v", err)
+	}
+}
+
+func TestApplyRefusesPathsOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	content := "x"
+	_, err := Apply(resolverFor(t, root), nil, []Edit{{Path: "../escape.txt", Content: &content}}, true)
+	if _, ok := err.(*PathError); !ok {
+		t.Fatalf("expected a PathError, got %v", err)
+	}
+	if _, err := ParseUnified("--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n-a\n"); err == nil {
+		t.Fatal("expected a truncated hunk to be rejected")
+	}
+}
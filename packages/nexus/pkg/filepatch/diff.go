@@ -0,0 +1,264 @@
+package filepatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const devNull = "/dev/null"
+
+// FilePatch is the part of a unified diff that changes one file. OldPath is
+// empty for a created file and NewPath for a deleted one.
+type FilePatch struct {
+	OldPath string
+	NewPath string
+	Hunks   []Hunk
+}
+
+// Hunk is one @@ section. Lines keep their line endings, except a last line
+// marked "\ No newline at end of file".
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []HunkLine
+}
+
+// HunkLine is a context (' '), removed ('-') or added ('+') line.
+type HunkLine struct {
+	Op   byte
+	Text string
+}
+
+func (h Hunk) header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// ParseUnified parses a unified diff as produced by diff -u or git diff,
+// including git's rename headers. Paths lose git's a/ and b/ prefixes.
+func ParseUnified(diff string) ([]FilePatch, error) {
+	lines := strings.SplitAfter(diff, "\n")
+	var patches []FilePatch
+	var cur *FilePatch
+	flush := func() {
+		if cur != nil {
+			patches = append(patches, *cur)
+			cur = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			oldPath, newPath := splitGitHeader(strings.TrimPrefix(line, "diff --git "))
+			cur = &FilePatch{OldPath: oldPath, NewPath: newPath}
+		case strings.HasPrefix(line, "rename from ") && cur != nil:
+			cur.OldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to ") && cur != nil:
+			cur.NewPath = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "new file mode") && cur != nil:
+			cur.OldPath = ""
+		case strings.HasPrefix(line, "deleted file mode") && cur != nil:
+			cur.NewPath = ""
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			return nil, fmt.Errorf("binary patches are not supported")
+		case strings.HasPrefix(line, "--- "):
+			if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+				return nil, fmt.Errorf("line %d: --- without +++", i+1)
+			}
+			if cur == nil || len(cur.Hunks) > 0 {
+				flush()
+				cur = &FilePatch{}
+			}
+			cur.OldPath = diffPath(strings.TrimPrefix(line, "--- "), "a/")
+			cur.NewPath = diffPath(strings.TrimRight(strings.TrimPrefix(lines[i+1], "+++ "), "\r\n"), "b/")
+			i++
+		case strings.HasPrefix(line, "@@ "):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk outside a file", i+1)
+			}
+			h, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			cur.Hunks = append(cur.Hunks, h)
+			i = next - 1
+		}
+	}
+	flush()
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file changes in patch")
+	}
+	for _, p := range patches {
+		if p.OldPath == "" && p.NewPath == "" {
+			return nil, fmt.Errorf("patch without file names")
+		}
+	}
+	return patches, nil
+}
+
+// splitGitHeader splits "a/x b/y" from a diff --git line. It is only a
+// fallback for patches without ---/+++ lines, such as pure renames.
+func splitGitHeader(s string) (string, string) {
+	if i := strings.Index(s, " b/"); strings.HasPrefix(s, "a/") && i > 0 {
+		return s[2:i], s[i+3:]
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return "", ""
+	}
+	return fields[0], fields[1]
+}
+
+// diffPath cleans a ---/+++ file name: it drops a trailing timestamp and
+// git's prefix, and maps /dev/null to "".
+func diffPath(s, prefix string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	if s == devNull {
+		return ""
+	}
+	return strings.TrimPrefix(s, prefix)
+}
+
+func parseHunk(lines []string, i int) (Hunk, int, error) {
+	var h Hunk
+	header := strings.TrimRight(lines[i], "\r\n")
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return h, 0, fmt.Errorf("line %d: bad hunk header %q", i+1, header)
+	}
+	var err error
+	if h.OldStart, h.OldLines, err = parseRange(fields[1][1:]); err != nil {
+		return h, 0, fmt.Errorf("line %d: %w", i+1, err)
+	}
+	if h.NewStart, h.NewLines, err = parseRange(fields[2][1:]); err != nil {
+		return h, 0, fmt.Errorf("line %d: %w", i+1, err)
+	}
+
+	oldLeft, newLeft := h.OldLines, h.NewLines
+	i++
+	for ; i < len(lines) && (oldLeft > 0 || newLeft > 0); i++ {
+		line := lines[i]
+		if line == "" {
+			break
+		}
+		if line == "\n" || line == "\r\n" {
+			// Some editors strip the space of an empty context line.
+			line = " " + line
+		}
+		op := line[0]
+		switch op {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\\':
+			markNoNewline(&h)
+			continue
+		default:
+			return h, 0, fmt.Errorf("line %d: unexpected %q in hunk", i+1, line)
+		}
+		h.Lines = append(h.Lines, HunkLine{Op: op, Text: line[1:]})
+	}
+	if oldLeft != 0 || newLeft != 0 {
+		return h, 0, fmt.Errorf("hunk %s is truncated", h.header())
+	}
+	if i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+		markNoNewline(&h)
+		i++
+	}
+	return h, i, nil
+}
+
+func markNoNewline(h *Hunk) {
+	if n := len(h.Lines); n > 0 {
+		last := &h.Lines[n-1]
+		last.Text = strings.TrimSuffix(strings.TrimSuffix(last.Text, "\n"), "\r")
+	}
+}
+
+// parseRange parses "start,count" or "start", whose count is 1.
+func parseRange(s string) (int, int, error) {
+	startStr, countStr, hasCount := strings.Cut(s, ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad hunk range %q", s)
+	}
+	count := 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, fmt.Errorf("bad hunk range %q", s)
+		}
+	}
+	return start, count, nil
+}
+
+// applyHunks applies hunks to content. A hunk whose lines moved is found by
+// searching outwards from its stated position, as patch does, but context
+// must match exactly.
+func applyHunks(content []byte, hunks []Hunk) ([]byte, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var out []string
+	pos, offset := 0, 0
+	for n, h := range hunks {
+		var old, repl []string
+		for _, l := range h.Lines {
+			if l.Op != '+' {
+				old = append(old, l.Text)
+			}
+			if l.Op != '-' {
+				repl = append(repl, l.Text)
+			}
+		}
+		want := h.OldStart - 1
+		if h.OldLines == 0 {
+			// An insertion goes after line OldStart.
+			want = h.OldStart
+		}
+		at := findLines(lines, old, pos, want+offset)
+		if at < 0 {
+			return nil, fmt.Errorf("hunk %d (%s) does not apply", n+1, h.header())
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, repl...)
+		pos = at + len(old)
+		offset = at - want
+	}
+	out = append(out, lines[pos:]...)
+	return []byte(strings.Join(out, "")), nil
+}
+
+// findLines returns the index at or after min where want occurs in lines,
+// preferring the one closest to hint, or -1.
+func findLines(lines, want []string, min, hint int) int {
+	matches := func(at int) bool {
+		if at < min || at+len(want) > len(lines) {
+			return false
+		}
+		for i, l := range want {
+			if lines[at+i] != l {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; d <= len(lines)+max(hint, -hint); d++ {
+		if matches(hint - d) {
+			return hint - d
+		}
+		if matches(hint + d) {
+			return hint + d
+		}
+	}
+	return -1
+}
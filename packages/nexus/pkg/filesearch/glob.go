@@ -0,0 +1,52 @@
+package filesearch
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the slash path rel matches a glob pattern. Patterns
+// use path.Match syntax per element plus "**" for any number of elements.
+// A pattern without a slash matches the last element at any depth, as in
+// .gitignore, so "*.go" finds Go files everywhere.
+func Match(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	if !strings.Contains(pattern, "/") {
+		return matchSegments([]string{pattern}, []string{path.Base(rel)})
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range name {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if Match(p, rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package filesearch
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ignoreRule is one line of a .gitignore file.
+type ignoreRule struct {
+	// base is the slash path of the directory holding the .gitignore,
+	// relative to the walk root ("" for the root itself).
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	// anchored rules match the path relative to base; the others match
+	// the last path element at any depth.
+	anchored bool
+}
+
+// parseIgnoreFile reads the rules of a .gitignore-style file. A missing
+// file has no rules.
+func parseIgnoreFile(file, base string) []ignoreRule {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func parseIgnoreLine(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// match reports whether the rule applies to rel, a slash path relative to
+// the walk root.
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if !r.anchored {
+		return matchSegments(r.segments, []string{path.Base(rel)})
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// ignoreStack holds the rules in effect for a directory: those of its
+// .gitignore and of every parent up to the walk root.
+type ignoreStack struct {
+	rules []ignoreRule
+}
+
+// push returns the stack for the child directory dir (absolute) at rel.
+func (s *ignoreStack) push(dir, rel string) *ignoreStack {
+	rules := parseIgnoreFile(filepath.Join(dir, ".gitignore"), rel)
+	if len(rules) == 0 {
+		return s
+	}
+	next := &ignoreStack{rules: make([]ignoreRule, 0, len(s.rules)+len(rules))}
+	next.rules = append(append(next.rules, s.rules...), rules...)
+	return next
+}
+
+// ignored applies the rules in order; the last one that matches wins, so
+// deeper .gitignore files and later lines override earlier ones.
+func (s *ignoreStack) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range s.rules {
+		if rule.match(rel, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// Ignorer reports whether paths under a root are excluded by the tree's
+// .gitignore files. Each directory's rules are read once, the first time a
+// path in it is checked.
+type Ignorer struct {
+	root   string
+	mu     sync.Mutex
+	stacks map[string]*ignoreStack
+}
+
+func NewIgnorer(root string) *Ignorer {
+	return &Ignorer{root: root, stacks: make(map[string]*ignoreStack)}
+}
+
+// Ignored reports whether rel, a slash path relative to the root, or any
+// directory above it is ignored. The .git directory always is.
+func (i *Ignorer) Ignored(rel string, isDir bool) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	parts := strings.Split(rel, "/")
+	for n := 1; n <= len(parts); n++ {
+		if parts[n-1] == ".git" {
+			return true
+		}
+		prefix := strings.Join(parts[:n], "/")
+		dir := n < len(parts) || isDir
+		if i.stack(path.Dir(prefix)).ignored(prefix, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Ignorer) stack(dir string) *ignoreStack {
+	if dir == "." {
+		dir = ""
+	}
+	if s, ok := i.stacks[dir]; ok {
+		return s
+	}
+	var s *ignoreStack
+	if dir == "" {
+		base := &ignoreStack{rules: parseIgnoreFile(filepath.Join(i.root, ".git", "info", "exclude"), "")}
+		s = base.push(i.root, "")
+	} else {
+		s = i.stack(path.Dir(dir)).push(filepath.Join(i.root, filepath.FromSlash(dir)), dir)
+	}
+	i.stacks[dir] = s
+	return s
+}
@@ -0,0 +1,332 @@
+// Package filesearch finds files by glob and greps their contents under a
+// directory, skipping what the tree's .gitignore files exclude. It is used
+// by the daemon for host worktrees and by the guest agent inside VMs.
+package filesearch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultMaxResults = 1000
+	MaxResultsLimit   = 10000
+	// DefaultMaxFileBytes skips files larger than this when grepping.
+	DefaultMaxFileBytes = 10 << 20
+	MaxContextLines     = 10
+	// maxLineBytes bounds the text returned for one matching line, so a
+	// hit in minified code does not return the whole file.
+	maxLineBytes = 1000
+)
+
+// FindOptions selects files for Find.
+type FindOptions struct {
+	// Patterns are globs (see Match); no patterns matches everything.
+	Patterns []string `json:"patterns,omitempty"`
+	Exclude  []string `json:"exclude,omitempty"`
+	// Type is "file", "dir" or empty for both.
+	Type       string `json:"type,omitempty"`
+	MaxDepth   int    `json:"maxDepth,omitempty"`
+	MaxResults int    `json:"maxResults,omitempty"`
+	// NoIgnore also returns files excluded by .gitignore.
+	NoIgnore bool `json:"noIgnore,omitempty"`
+}
+
+// FindMatch is a file found by Find. Path is relative to the workspace.
+type FindMatch struct {
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir"`
+	Size  int64  `json:"size"`
+}
+
+// FindStats summarizes a Find.
+type FindStats struct {
+	Count     int  `json:"count"`
+	Truncated bool `json:"truncated"`
+}
+
+// GrepOptions describes a content search.
+type GrepOptions struct {
+	Pattern    string `json:"pattern"`
+	Literal    bool   `json:"literal,omitempty"`
+	IgnoreCase bool   `json:"ignoreCase,omitempty"`
+	// Include and Exclude are globs limiting the files searched.
+	Include      []string `json:"include,omitempty"`
+	Exclude      []string `json:"exclude,omitempty"`
+	Context      int      `json:"context,omitempty"`
+	MaxResults   int      `json:"maxResults,omitempty"`
+	MaxFileBytes int64    `json:"maxFileBytes,omitempty"`
+	NoIgnore     bool     `json:"noIgnore,omitempty"`
+}
+
+// GrepMatch is one matching line. Line and Column are 1-based; Column
+// counts characters.
+type GrepMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// GrepStats summarizes a Grep.
+type GrepStats struct {
+	Count         int  `json:"count"`
+	FilesSearched int  `json:"filesSearched"`
+	FilesMatched  int  `json:"filesMatched"`
+	Truncated     bool `json:"truncated"`
+}
+
+// errStop ends a walk early once enough results were found.
+var errStop = errors.New("stop")
+
+// walk calls fn for every entry under root/rel that .gitignore does not
+// exclude, in lexical order. The .git directory is always skipped.
+func walk(ctx context.Context, root, rel string, noIgnore bool, maxDepth int, fn func(rel string, d fs.DirEntry) error) error {
+	start := filepath.Join(root, filepath.FromSlash(rel))
+	info, err := os.Stat(start)
+	if err != nil {
+		return err
+	}
+	startRel := strings.Trim(path.Clean("/"+filepath.ToSlash(rel)), "/")
+	if !info.IsDir() {
+		// A single file is searched even if it is ignored: it was asked for.
+		if err := fn(startRel, fs.FileInfoToDirEntry(info)); err != nil && !errors.Is(err, filepath.SkipDir) {
+			return err
+		}
+		return nil
+	}
+	stacks := map[string]*ignoreStack{}
+	base := &ignoreStack{}
+	if !noIgnore {
+		base.rules = parseIgnoreFile(filepath.Join(root, ".git", "info", "exclude"), "")
+		// The .gitignore files above the starting directory still apply.
+		dir, dirRel := root, ""
+		base = base.push(dir, dirRel)
+		for _, part := range strings.Split(startRel, "/") {
+			if part == "" || part == "." {
+				continue
+			}
+			dir, dirRel = filepath.Join(dir, part), path.Join(dirRel, part)
+			base = base.push(dir, dirRel)
+		}
+	}
+	stacks[startRel] = base
+
+	return filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped rather than ending the search.
+			if d != nil && d.IsDir() && p != start {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if p == start {
+			return nil
+		}
+		entryRel, relErr := filepath.Rel(root, p)
+		if relErr != nil {
+			return nil
+		}
+		entryRel = filepath.ToSlash(entryRel)
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		parent := stacks[path.Dir(entryRel)]
+		if parent == nil {
+			parent = stacks[startRel]
+		}
+		if !noIgnore && parent.ignored(entryRel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		depth := strings.Count(strings.TrimPrefix(entryRel, startRel+"/"), "/") + 1
+		if startRel == "" {
+			depth = strings.Count(entryRel, "/") + 1
+		}
+		if err := fn(entryRel, d); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if maxDepth > 0 && depth >= maxDepth {
+				return filepath.SkipDir
+			}
+			if noIgnore {
+				stacks[entryRel] = parent
+			} else {
+				stacks[entryRel] = parent.push(p, entryRel)
+			}
+		}
+		return nil
+	})
+}
+
+func clampResults(n, def int) int {
+	if n <= 0 {
+		return def
+	}
+	return min(n, MaxResultsLimit)
+}
+
+// Find lists the entries under root/rel matching opts, calling emit for
+// each. rel must already be a clean path inside root.
+func Find(ctx context.Context, root, rel string, opts FindOptions, emit func(FindMatch)) (FindStats, error) {
+	if opts.Type != "" && opts.Type != "file" && opts.Type != "dir" {
+		return FindStats{}, fmt.Errorf("invalid type %q", opts.Type)
+	}
+	limit := clampResults(opts.MaxResults, DefaultMaxResults)
+	var stats FindStats
+	err := walk(ctx, root, rel, opts.NoIgnore, opts.MaxDepth, func(entryRel string, d fs.DirEntry) error {
+		if matchAny(opts.Exclude, entryRel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if (opts.Type == "file" && d.IsDir()) || (opts.Type == "dir" && !d.IsDir()) {
+			return nil
+		}
+		if len(opts.Patterns) > 0 && !matchAny(opts.Patterns, entryRel) {
+			return nil
+		}
+		if stats.Count == limit {
+			stats.Truncated = true
+			return errStop
+		}
+		m := FindMatch{Path: entryRel, IsDir: d.IsDir()}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			m.Size = info.Size()
+		}
+		stats.Count++
+		emit(m)
+		return nil
+	})
+	if errors.Is(err, errStop) {
+		err = nil
+	}
+	return stats, err
+}
+
+// CompileGrep builds the expression a GrepOptions searches for.
+func CompileGrep(opts GrepOptions) (*regexp.Regexp, error) {
+	if opts.Pattern == "" {
+		return nil, errors.New("pattern is required")
+	}
+	expr := opts.Pattern
+	if opts.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if opts.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// Grep searches the text files under root/rel, calling emit for every
+// matching line. Binary files and files over MaxFileBytes are skipped.
+func Grep(ctx context.Context, root, rel string, opts GrepOptions, emit func(GrepMatch)) (GrepStats, error) {
+	re, err := CompileGrep(opts)
+	if err != nil {
+		return GrepStats{}, err
+	}
+	limit := clampResults(opts.MaxResults, DefaultMaxResults)
+	maxBytes := opts.MaxFileBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxFileBytes
+	}
+	contextLines := min(max(opts.Context, 0), MaxContextLines)
+
+	var stats GrepStats
+	err = walk(ctx, root, rel, opts.NoIgnore, 0, func(entryRel string, d fs.DirEntry) error {
+		if matchAny(opts.Exclude, entryRel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchAny(opts.Include, entryRel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxBytes {
+			return nil
+		}
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(entryRel)))
+		if err != nil || isBinary(data) {
+			return nil
+		}
+		stats.FilesSearched++
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		matched := false
+		for i, line := range lines {
+			line = strings.TrimSuffix(line, "\r")
+			loc := re.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			if stats.Count == limit {
+				stats.Truncated = true
+				return errStop
+			}
+			if !matched {
+				matched = true
+				stats.FilesMatched++
+			}
+			m := GrepMatch{
+				Path:   entryRel,
+				Line:   i + 1,
+				Column: utf8.RuneCountInString(line[:loc[0]]) + 1,
+				Text:   clipLine(line),
+			}
+			if contextLines > 0 {
+				for _, l := range lines[max(0, i-contextLines):i] {
+					m.Before = append(m.Before, clipLine(strings.TrimSuffix(l, "\r")))
+				}
+				for _, l := range lines[i+1 : min(len(lines), i+1+contextLines)] {
+					m.After = append(m.After, clipLine(strings.TrimSuffix(l, "\r")))
+				}
+			}
+			stats.Count++
+			emit(m)
+		}
+		return nil
+	})
+	if errors.Is(err, errStop) {
+		err = nil
+	}
+	return stats, err
+}
+
+// isBinary uses git's heuristic: a NUL byte near the start of the file.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+func clipLine(line string) string {
+	if len(line) <= maxLineBytes {
+		return line
+	}
+	end := maxLineBytes
+	for end > 0 && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return line[:end]
+}
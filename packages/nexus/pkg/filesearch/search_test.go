@@ -0,0 +1,129 @@
+package filesearch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func findPaths(t *testing.T, root, rel string, opts FindOptions) []string {
+	t.Helper()
+	var paths []string
+	if _, err := Find(context.Background(), root, rel, opts, func(m FindMatch) { paths = append(paths, m.Path) }); err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	return paths
+}
+
+func TestFindHonoursGitignore(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":          "node_modules/\n*.log\n/build\n!keep.log\n",
+		".git/HEAD":           "ref: refs/heads/main\n",
+		"main.go":             "package main\n",
+		"debug.log":           "x",
+		"keep.log":            "x",
+		"build/out.bin":       "x",
+		"pkg/build/gen.go":    "package build\n",
+		"pkg/.gitignore":      "*.tmp\n",
+		"pkg/a.tmp":           "x",
+		"pkg/a.go":            "package pkg\n",
+		"node_modules/x/i.js": "x",
+	})
+
+	got := findPaths(t, root, "", FindOptions{Type: "file"})
+	want := []string{".gitignore", "keep.log", "main.go", "pkg/.gitignore", "pkg/a.go", "pkg/build/gen.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got = findPaths(t, root, "pkg", FindOptions{Patterns: []string{"*.tmp"}})
+	if len(got) != 0 {
+		t.Fatalf("expected pkg/.gitignore to apply when starting in pkg, got %v", got)
+	}
+	got = findPaths(t, root, "", FindOptions{Patterns: []string{"*.tmp", "**/*.log"}, NoIgnore: true})
+	if !reflect.DeepEqual(got, []string{"debug.log", "keep.log", "pkg/a.tmp"}) {
+		t.Fatalf("unexpected noIgnore result %v", got)
+	}
+}
+
+func TestFindLimitsAndDepth(t *testing.T) {
+	root := writeTree(t, map[string]string{"a/b/c.txt": "", "a/d.txt": "", "e.txt": ""})
+
+	if got := findPaths(t, root, "", FindOptions{MaxDepth: 1}); !reflect.DeepEqual(got, []string{"a", "e.txt"}) {
+		t.Fatalf("unexpected depth-limited result %v", got)
+	}
+	var paths []string
+	stats, err := Find(context.Background(), root, "", FindOptions{Type: "file", MaxResults: 2}, func(m FindMatch) { paths = append(paths, m.Path) })
+	if err != nil || !stats.Truncated || stats.Count != 2 || len(paths) != 2 {
+		t.Fatalf("expected truncation at 2, got %+v %v %v", stats, paths, err)
+	}
+	if got := findPaths(t, root, "", FindOptions{Patterns: []string{"a/**/*.txt"}}); !reflect.DeepEqual(got, []string{"a/b/c.txt", "a/d.txt"}) {
+		t.Fatalf("unexpected ** result %v", got)
+	}
+}
+
+func TestGrepReturnsPositionsAndContext(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"src/a.go":   "package a\n\nfunc héllo() {}\nfunc Hello() {}\n",
+		"src/b.bin":  "hello\x00world",
+		"vendor.txt": "hello",
+		".gitignore": "vendor.txt\n",
+	})
+
+	var matches []GrepMatch
+	stats, err := Grep(context.Background(), root, "", GrepOptions{Pattern: "hello", IgnoreCase: true, Context: 1}, func(m GrepMatch) { matches = append(matches, m) })
+	if err != nil {
+		t.Fatalf("grep: %v", err)
+	}
+	if stats.Count != 1 || stats.FilesMatched != 1 || stats.FilesSearched != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	want := GrepMatch{Path: "src/a.go", Line: 4, Column: 6, Text: "func Hello() {}", Before: []string{"func héllo() {}"}}
+	if !reflect.DeepEqual(matches[0], want) {
+		t.Fatalf("got %+v, want %+v", matches[0], want)
+	}
+
+	matches = nil
+	if _, err := Grep(context.Background(), root, "src/a.go", GrepOptions{Pattern: "éllo(", Literal: true}, func(m GrepMatch) { matches = append(matches, m) }); err != nil {
+		t.Fatalf("grep file: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Column != 7 {
+		t.Fatalf("expected the literal to match at character 7, got %+v", matches)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.go", "pkg/a.go", true},
+		{"pkg/*.go", "pkg/a.go", true},
+		{"pkg/*.go", "x/pkg/a.go", false},
+		{"**/test/*.ts", "a/b/test/c.ts", true},
+		{"src/**", "src/a/b", true},
+		{"[ab].txt", "c.txt", false},
+	}
+	for _, tc := range cases {
+		if got := Match(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("Match(%q, %q) = %v", tc.pattern, tc.path, got)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+//go:build linux
+
+package filewatch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF |
+	unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// inotifySource watches every directory of the tree with one inotify
+// instance, adding directories as they appear.
+type inotifySource struct {
+	w    *Watcher
+	file *os.File
+	fd   int
+	// dirs maps watch descriptors to directory paths. Only the reading
+	// goroutine touches it after setup.
+	dirs map[int]string
+	out  chan []Event
+	done chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	readErr error
+}
+
+func newSource(w *Watcher) (source, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+	s := &inotifySource{
+		w:    w,
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		dirs: make(map[int]string),
+		out:  make(chan []Event, 16),
+		done: make(chan struct{}),
+	}
+	if err := s.addTree(w.rel, nil); err != nil {
+		_ = s.file.Close()
+		return nil, err
+	}
+	go s.read()
+	return s, nil
+}
+
+func (s *inotifySource) events() <-chan []Event { return s.out }
+
+func (s *inotifySource) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readErr
+}
+
+func (s *inotifySource) close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.done)
+	// The fd is non-blocking, so closing it wakes the pending read.
+	return s.file.Close()
+}
+
+// addTree watches rel and the directories below it. found, when set,
+// receives a create event for every entry already there, since they may
+// have appeared before the watch was in place.
+func (s *inotifySource) addTree(rel string, found func(Event)) error {
+	var firstErr error
+	s.w.walk(rel, func(entryRel string, d fs.DirEntry) {
+		if found != nil && entryRel != rel {
+			found(Event{Type: EventCreate, Path: entryRel, IsDir: d.IsDir()})
+		}
+		if !d.IsDir() {
+			return
+		}
+		wd, err := unix.InotifyAddWatch(s.fd, filepath.Join(s.w.root, filepath.FromSlash(entryRel)), inotifyMask)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("watch %s: %w", entryRel, err)
+			}
+			return
+		}
+		s.dirs[wd] = entryRel
+	})
+	if len(s.dirs) == 0 && firstErr == nil {
+		firstErr = fmt.Errorf("watch %s: %w", rel, fs.ErrNotExist)
+	}
+	if errors.Is(firstErr, unix.ENOSPC) {
+		return fmt.Errorf("%w (raise fs.inotify.max_user_watches)", firstErr)
+	}
+	if found == nil {
+		return firstErr
+	}
+	return nil
+}
+
+// moveDirs renames the tracked directories under from to to, or forgets
+// them and drops their watches when to is empty.
+func (s *inotifySource) moveDirs(from, to string) {
+	for wd, dir := range s.dirs {
+		if dir != from && !strings.HasPrefix(dir, from+"/") {
+			continue
+		}
+		if to == "" {
+			_, _ = unix.InotifyRmWatch(s.fd, uint32(wd))
+			delete(s.dirs, wd)
+			continue
+		}
+		s.dirs[wd] = to + strings.TrimPrefix(dir, from)
+	}
+}
+
+func (s *inotifySource) read() {
+	defer close(s.out)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := s.file.Read(buf)
+		if err != nil {
+			s.mu.Lock()
+			if !s.closed {
+				s.readErr = fmt.Errorf("inotify read: %w", err)
+			}
+			s.mu.Unlock()
+			return
+		}
+		if batch := s.parse(buf[:n]); len(batch) > 0 {
+			select {
+			case s.out <- batch:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// parse turns one read of raw inotify records into events. The two halves
+// of a rename inside the tree arrive together and share a cookie; a half
+// without its partner is a move into or out of the tree.
+func (s *inotifySource) parse(buf []byte) []Event {
+	var batch []Event
+	emit := func(e Event) { batch = append(batch, e) }
+	movedFrom := map[uint32]Event{}
+	var fromOrder []uint32
+
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameBytes := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(raw.Len)]
+		off += unix.SizeofInotifyEvent + int(raw.Len)
+		name := string(bytes.TrimRight(nameBytes, "\x00"))
+
+		if raw.Mask&unix.IN_Q_OVERFLOW != 0 {
+			emit(Event{Type: EventOverflow})
+			continue
+		}
+		dir, ok := s.dirs[int(raw.Wd)]
+		if !ok {
+			continue
+		}
+		if raw.Mask&unix.IN_IGNORED != 0 {
+			delete(s.dirs, int(raw.Wd))
+			continue
+		}
+		if raw.Mask&unix.IN_DELETE_SELF != 0 {
+			// The parent reports deletions; only the root has none.
+			if dir == s.w.rel {
+				emit(Event{Type: EventDelete, Path: dir, IsDir: true})
+			}
+			continue
+		}
+		rel := path.Join(dir, name)
+		isDir := raw.Mask&unix.IN_ISDIR != 0
+		if s.w.skip(rel, isDir) {
+			continue
+		}
+		switch {
+		case raw.Mask&unix.IN_CREATE != 0:
+			emit(Event{Type: EventCreate, Path: rel, IsDir: isDir})
+			if isDir {
+				_ = s.addTree(rel, emit)
+			}
+		case raw.Mask&unix.IN_MODIFY != 0:
+			if !isDir {
+				emit(Event{Type: EventModify, Path: rel})
+			}
+		case raw.Mask&unix.IN_DELETE != 0:
+			emit(Event{Type: EventDelete, Path: rel, IsDir: isDir})
+		case raw.Mask&unix.IN_MOVED_FROM != 0:
+			movedFrom[raw.Cookie] = Event{Type: EventRename, OldPath: rel, IsDir: isDir}
+			fromOrder = append(fromOrder, raw.Cookie)
+		case raw.Mask&unix.IN_MOVED_TO != 0:
+			if from, ok := movedFrom[raw.Cookie]; ok {
+				delete(movedFrom, raw.Cookie)
+				from.Path = rel
+				emit(from)
+				if isDir {
+					s.moveDirs(from.OldPath, rel)
+				}
+				continue
+			}
+			emit(Event{Type: EventCreate, Path: rel, IsDir: isDir})
+			if isDir {
+				_ = s.addTree(rel, emit)
+			}
+		}
+	}
+	for _, cookie := range fromOrder {
+		from, ok := movedFrom[cookie]
+		if !ok {
+			continue
+		}
+		emit(Event{Type: EventDelete, Path: from.OldPath, IsDir: from.IsDir})
+		if from.IsDir {
+			s.moveDirs(from.OldPath, "")
+		}
+	}
+	return batch
+}
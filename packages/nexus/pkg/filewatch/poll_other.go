@@ -0,0 +1,95 @@
+//go:build !linux
+
+package filewatch
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+const pollInterval = time.Second
+
+// pollSource compares snapshots of the tree, for hosts without inotify.
+// It cannot tell renames apart, so they are reported as a delete and a
+// create.
+type pollSource struct {
+	w    *Watcher
+	out  chan []Event
+	stop chan struct{}
+	once sync.Once
+}
+
+type pollEntry struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+func newSource(w *Watcher) (source, error) {
+	s := &pollSource{w: w, out: make(chan []Event, 16), stop: make(chan struct{})}
+	go s.run(s.snapshot())
+	return s, nil
+}
+
+func (s *pollSource) events() <-chan []Event { return s.out }
+
+func (s *pollSource) err() error { return nil }
+
+func (s *pollSource) close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+func (s *pollSource) snapshot() map[string]pollEntry {
+	snap := make(map[string]pollEntry)
+	s.w.walk(s.w.rel, func(rel string, d fs.DirEntry) {
+		if rel == s.w.rel {
+			return
+		}
+		info, err := d.Info()
+		if err != nil {
+			return
+		}
+		snap[rel] = pollEntry{isDir: d.IsDir(), size: info.Size(), modTime: info.ModTime()}
+	})
+	return snap
+}
+
+func (s *pollSource) run(prev map[string]pollEntry) {
+	defer close(s.out)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		next := s.snapshot()
+		var batch []Event
+		for rel, e := range next {
+			old, ok := prev[rel]
+			switch {
+			case !ok:
+				batch = append(batch, Event{Type: EventCreate, Path: rel, IsDir: e.isDir})
+			case !e.isDir && (old.size != e.size || !old.modTime.Equal(e.modTime)):
+				batch = append(batch, Event{Type: EventModify, Path: rel})
+			}
+		}
+		for rel, e := range prev {
+			if _, ok := next[rel]; !ok {
+				batch = append(batch, Event{Type: EventDelete, Path: rel, IsDir: e.isDir})
+			}
+		}
+		prev = next
+		if len(batch) == 0 {
+			continue
+		}
+		select {
+		case s.out <- batch:
+		case <-s.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Package filewatch reports changes under a directory tree as debounced
+// batches of events. It uses inotify on Linux and polls elsewhere. Paths
+// ignored by the tree's .gitignore files or by caller patterns are neither
+// watched nor reported.
+package filewatch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filesearch"
+)
+
+const (
+	EventCreate = "create"
+	EventModify = "modify"
+	EventDelete = "delete"
+	EventRename = "rename"
+	// EventOverflow means changes were lost, because the kernel queue or a
+	// batch overflowed. Clients should rescan the tree.
+	EventOverflow = "overflow"
+
+	DefaultDebounce = 100 * time.Millisecond
+	MaxDebounce     = 10 * time.Second
+	// maxBatchEvents caps one batch; a bigger burst (a dependency install,
+	// say) is reported as a single overflow instead.
+	maxBatchEvents = 10000
+)
+
+// Event is one change. Paths are slash paths relative to the watcher root;
+// OldPath is set for renames.
+type Event struct {
+	Type    string `json:"type"`
+	Path    string `json:"path,omitempty"`
+	OldPath string `json:"oldPath,omitempty"`
+	IsDir   bool   `json:"isDir,omitempty"`
+}
+
+// Options tunes a Watcher.
+type Options struct {
+	// Ignore lists globs (see filesearch.Match) of paths not to report.
+	Ignore []string `json:"ignore,omitempty"`
+	// NoIgnore also reports paths excluded by .gitignore.
+	NoIgnore   bool `json:"noIgnore,omitempty"`
+	DebounceMs int  `json:"debounceMs,omitempty"`
+}
+
+func (o Options) debounce() time.Duration {
+	if o.DebounceMs <= 0 {
+		return DefaultDebounce
+	}
+	return min(time.Duration(o.DebounceMs)*time.Millisecond, MaxDebounce)
+}
+
+// source produces raw events for a Watcher.
+type source interface {
+	// events is closed when the source stops; err then tells why.
+	events() <-chan []Event
+	err() error
+	close() error
+}
+
+// Watcher watches the subtree rel of root.
+type Watcher struct {
+	root    string
+	rel     string
+	opts    Options
+	ignorer *filesearch.Ignorer
+	src     source
+}
+
+// New starts watching root/rel, which must be a directory. Events are
+// delivered by Run.
+func New(root, rel string, opts Options) (*Watcher, error) {
+	rel = strings.Trim(path.Clean("/"+filepath.ToSlash(rel)), "/")
+	info, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", rel)
+	}
+	w := &Watcher{root: root, rel: rel, opts: opts}
+	if !opts.NoIgnore {
+		w.ignorer = filesearch.NewIgnorer(root)
+	}
+	w.src, err = newSource(w)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Run delivers batches of events to onEvents until ctx is done or the
+// watch fails. Changes are collected for the debounce interval after the
+// first one, and repeated changes to a path are merged.
+func (w *Watcher) Run(ctx context.Context, onEvents func([]Event)) error {
+	defer w.Close()
+	var pending coalescer
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case batch, ok := <-w.src.events():
+			if !ok {
+				if events := pending.take(); len(events) > 0 {
+					onEvents(events)
+				}
+				return w.src.err()
+			}
+			for _, e := range batch {
+				pending.add(e)
+			}
+			if flush == nil {
+				flush = time.After(w.opts.debounce())
+			}
+		case <-flush:
+			flush = nil
+			if events := pending.take(); len(events) > 0 {
+				onEvents(events)
+			}
+		}
+	}
+}
+
+func (w *Watcher) Close() error {
+	return w.src.close()
+}
+
+// skip reports whether rel is excluded from watching and reporting.
+func (w *Watcher) skip(rel string, isDir bool) bool {
+	if rel == w.rel {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for n := 1; n <= len(parts); n++ {
+		if parts[n-1] == ".git" {
+			return true
+		}
+		for _, pattern := range w.opts.Ignore {
+			if filesearch.Match(pattern, strings.Join(parts[:n], "/")) {
+				return true
+			}
+		}
+	}
+	return w.ignorer != nil && w.ignorer.Ignored(rel, isDir)
+}
+
+// walk calls fn for rel and every entry below it that is not skipped.
+func (w *Watcher) walk(rel string, fn func(rel string, d fs.DirEntry)) {
+	start := filepath.Join(w.root, filepath.FromSlash(rel))
+	_ = filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && p != start {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		entryRel, relErr := filepath.Rel(w.root, p)
+		if relErr != nil {
+			return nil
+		}
+		entryRel = filepath.ToSlash(entryRel)
+		if entryRel == "." {
+			entryRel = ""
+		}
+		if p != start && w.skip(entryRel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fn(entryRel, d)
+		return nil
+	})
+}
+
+// coalescer merges the events of one debounce window, keeping the order in
+// which paths first changed.
+type coalescer struct {
+	order    []string
+	byKey    map[string]*Event
+	overflow bool
+}
+
+func (c *coalescer) add(e Event) {
+	if c.overflow {
+		return
+	}
+	if c.byKey == nil {
+		c.byKey = make(map[string]*Event)
+	}
+	if e.Type == EventOverflow || len(c.byKey) >= maxBatchEvents {
+		c.overflow = true
+		return
+	}
+	key := e.Path
+	if e.Type == EventRename {
+		key = "\x00" + e.OldPath + "\x00" + e.Path
+	}
+	prev, ok := c.byKey[key]
+	if !ok || e.Type == EventRename {
+		c.order = append(c.order, key)
+		c.byKey[key] = &e
+		return
+	}
+	switch {
+	case prev.Type == EventCreate && e.Type == EventDelete:
+		// Created and gone again within the window: nothing to report.
+		delete(c.byKey, key)
+	case prev.Type == EventCreate:
+	case prev.Type == EventDelete && e.Type == EventCreate:
+		// Replaced, as editors do when saving through a temp file.
+		prev.Type = EventModify
+		prev.IsDir = e.IsDir
+	default:
+		prev.Type = e.Type
+	}
+}
+
+func (c *coalescer) take() []Event {
+	defer func() { *c = coalescer{} }()
+	if c.overflow {
+		return []Event{{Type: EventOverflow}}
+	}
+	events := make([]Event, 0, len(c.byKey))
+	for _, key := range c.order {
+		if e, ok := c.byKey[key]; ok {
+			events = append(events, *e)
+			delete(c.byKey, key)
+		}
+	}
+	return events
+}
@@ -0,0 +1,125 @@
+package filewatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCoalescerMergesChangesPerPath(t *testing.T) {
+	var c coalescer
+	for _, e := range []Event{
+		{Type: EventCreate, Path: "a.txt"},
+		{Type: EventModify, Path: "a.txt"},
+		{Type: EventModify, Path: "b.txt"},
+		{Type: EventDelete, Path: "b.txt"},
+		{Type: EventCreate, Path: "tmp"},
+		{Type: EventDelete, Path: "tmp"},
+		{Type: EventDelete, Path: "c.txt"},
+		{Type: EventCreate, Path: "c.txt"},
+		{Type: EventRename, OldPath: "d", Path: "e"},
+	} {
+		c.add(e)
+	}
+	want := []Event{
+		{Type: EventCreate, Path: "a.txt"},
+		{Type: EventDelete, Path: "b.txt"},
+		{Type: EventModify, Path: "c.txt"},
+		{Type: EventRename, OldPath: "d", Path: "e"},
+	}
+	if got := c.take(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got := c.take(); len(got) != 0 {
+		t.Fatalf("expected take to reset, got %+v", got)
+	}
+
+	c.add(Event{Type: EventOverflow})
+	c.add(Event{Type: EventCreate, Path: "x"})
+	if got := c.take(); !reflect.DeepEqual(got, []Event{{Type: EventOverflow}}) {
+		t.Fatalf("expected a lone overflow, got %+v", got)
+	}
+}
+
+// nextBatch waits for events, failing the test after a generous timeout;
+// the polling fallback needs a full interval to notice anything.
+func nextBatch(t *testing.T, ch <-chan []Event) []Event {
+	t.Helper()
+	select {
+	case events := <-ch:
+		return events
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for events")
+	}
+	return nil
+}
+
+func TestWatcherReportsChangesAndSkipsIgnored(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(root, "", Options{Ignore: []string{"dist"}, DebounceMs: 50})
+	if err != nil {
+		t.Fatalf("new watcher: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan []Event, 8)
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx, func(events []Event) { ch <- events }) }()
+
+	for _, name := range []string{"debug.log", "dist/out.js"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "src", "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	events := nextBatch(t, ch)
+	if !reflect.DeepEqual(events, []Event{{Type: EventCreate, Path: "src/main.go"}}) {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	if err := os.Rename(filepath.Join(root, "src", "main.go"), filepath.Join(root, "src", "app.go")); err != nil {
+		t.Fatal(err)
+	}
+	events = nextBatch(t, ch)
+	if len(events) == 0 || events[len(events)-1].Path != "src/app.go" {
+		t.Fatalf("expected the rename to be reported, got %+v", events)
+	}
+
+	// Files written right after their directory appears are not lost.
+	if err := os.MkdirAll(filepath.Join(root, "pkg", "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "pkg", "a", "b.go"), []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	created := map[string]bool{}
+	for len(created) < 3 {
+		for _, e := range nextBatch(t, ch) {
+			if e.Type == EventCreate {
+				created[e.Path] = true
+			}
+		}
+	}
+	if !created["pkg"] || !created["pkg/a"] || !created["pkg/a/b.go"] {
+		t.Fatalf("unexpected creates %v", created)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Package forge talks to hosted git forges (GitHub, GitLab, Gitea) to open and
+// update pull requests for workspace branches.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	KindGitHub = "github"
+	KindGitLab = "gitlab"
+	KindGitea  = "gitea"
+)
+
+// PullRequest is the forge-neutral view of a pull/merge request.
+type PullRequest struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+	State  string `json:"state"`
+	Title  string `json:"title"`
+	Head   string `json:"head"`
+	Base   string `json:"base"`
+}
+
+// PullRequestSpec describes the pull request to open or update.
+type PullRequestSpec struct {
+	Head  string
+	Base  string
+	Title string
+	Body  string
+	Draft bool
+}
+
+// Adapter is implemented per forge. Repo is the forge's repository path
+// (owner/name, or group/subgroup/name on GitLab).
+type Adapter interface {
+	Kind() string
+	FindOpenPullRequest(ctx context.Context, repo, head, base string) (*PullRequest, error)
+	CreatePullRequest(ctx context.Context, repo string, spec PullRequestSpec) (*PullRequest, error)
+	UpdatePullRequest(ctx context.Context, repo string, number int, spec PullRequestSpec) (*PullRequest, error)
+}
+
+// Config selects and configures an adapter.
+type Config struct {
+	Kind       string
+	APIBaseURL string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns the adapter for cfg.Kind. APIBaseURL must be set.
+func New(cfg Config) (Adapter, error) {
+	base := strings.TrimRight(strings.TrimSpace(cfg.APIBaseURL), "/")
+	if base == "" {
+		return nil, fmt.Errorf("forge api base url is required")
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	api := &apiClient{base: base, client: client}
+	token := strings.TrimSpace(cfg.Token)
+	switch strings.ToLower(strings.TrimSpace(cfg.Kind)) {
+	case KindGitHub:
+		if token != "" {
+			api.header = http.Header{"Authorization": {"Bearer " + token}, "Accept": {"application/vnd.github+json"}}
+		}
+		return &github{api: api}, nil
+	case KindGitLab:
+		if token != "" {
+			api.header = http.Header{"PRIVATE-TOKEN": {token}}
+		}
+		return &gitlab{api: api}, nil
+	case KindGitea:
+		if token != "" {
+			api.header = http.Header{"Authorization": {"token " + token}}
+		}
+		return &gitea{api: api}, nil
+	default:
+		return nil, fmt.Errorf("unsupported forge kind %q", cfg.Kind)
+	}
+}
+
+// Remote is a parsed git remote URL.
+type Remote struct {
+	Host string
+	Repo string
+}
+
+// ParseRemote extracts host and repository path from https, ssh and scp-style
+// git remote URLs.
+func ParseRemote(raw string) (Remote, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Remote{}, fmt.Errorf("empty remote url")
+	}
+	var host, path string
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return Remote{}, fmt.Errorf("parse remote url: %w", err)
+		}
+		host, path = u.Host, u.Path
+	} else if at := strings.Index(raw, "@"); at >= 0 && strings.Contains(raw[at:], ":") {
+		rest := raw[at+1:]
+		colon := strings.Index(rest, ":")
+		host, path = rest[:colon], rest[colon+1:]
+	} else {
+		return Remote{}, fmt.Errorf("remote %q is not a forge url", raw)
+	}
+	if colon := strings.Index(host, ":"); colon >= 0 {
+		host = host[:colon]
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return Remote{}, fmt.Errorf("remote %q has no owner/repository path", raw)
+	}
+	return Remote{Host: strings.ToLower(host), Repo: path}, nil
+}
+
+// DetectKind guesses the forge from a remote host. Self-hosted instances
+// with neutral host names return "".
+func DetectKind(host string) string {
+	host = strings.ToLower(host)
+	switch {
+	case host == "github.com" || strings.HasPrefix(host, "github."):
+		return KindGitHub
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		return KindGitLab
+	case host == "gitea.com" || strings.HasPrefix(host, "gitea.") || host == "codeberg.org":
+		return KindGitea
+	}
+	return ""
+}
+
+// DefaultAPIBaseURL returns the conventional API root for a forge host.
+func DefaultAPIBaseURL(kind, host string) string {
+	switch kind {
+	case KindGitHub:
+		if host == "github.com" {
+			return "https://api.github.com"
+		}
+		return "https://" + host + "/api/v3"
+	case KindGitLab:
+		return "https://" + host + "/api/v4"
+	case KindGitea:
+		return "https://" + host + "/api/v1"
+	}
+	return ""
+}
+
+type apiClient struct {
+	base   string
+	client *http.Client
+	header http.Header
+}
+
+// APIError is returned for non-2xx forge responses.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("forge %s %s: status %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+func (c *apiClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshal forge request: %w", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return fmt.Errorf("build forge request: %w", err)
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("forge %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(raw))}
+	}
+	if out != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return fmt.Errorf("decode forge response: %w", err)
+		}
+	}
+	return nil
+}
+
+func repoPath(repo string) string {
+	parts := strings.Split(strings.Trim(repo, "/"), "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
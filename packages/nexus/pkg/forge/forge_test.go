@@ -0,0 +1,88 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	cases := map[string]Remote{
+		"git@github.com:acme/widgets.git":               {Host: "github.com", Repo: "acme/widgets"},
+		"https://gitlab.example.com/group/sub/tool.git": {Host: "gitlab.example.com", Repo: "group/sub/tool"},
+		"ssh://git@gitea.local:2222/team/app":           {Host: "gitea.local", Repo: "team/app"},
+	}
+	for raw, want := range cases {
+		got, err := ParseRemote(raw)
+		if err != nil {
+			t.Fatalf("ParseRemote(%q): %v", raw, err)
+		}
+		if got != want {
+			t.Fatalf("ParseRemote(%q) = %+v, want %+v", raw, got, want)
+		}
+	}
+	if _, err := ParseRemote("/srv/git/repo.git"); err == nil {
+		t.Fatal("expected local path remote to be rejected")
+	}
+}
+
+func TestDetectKindAndDefaultAPIBaseURL(t *testing.T) {
+	if DetectKind("github.com") != KindGitHub || DetectKind("gitlab.example.com") != KindGitLab || DetectKind("codeberg.org") != KindGitea {
+		t.Fatal("unexpected forge detection")
+	}
+	if DetectKind("git.internal") != "" {
+		t.Fatal("expected neutral host to be undetected")
+	}
+	if got := DefaultAPIBaseURL(KindGitHub, "github.com"); got != "https://api.github.com" {
+		t.Fatalf("unexpected github api base %q", got)
+	}
+	if got := DefaultAPIBaseURL(KindGitLab, "gitlab.example.com"); got != "https://gitlab.example.com/api/v4" {
+		t.Fatalf("unexpected gitlab api base %q", got)
+	}
+}
+
+func TestGitLabCreateMergeRequestEncodesProjectPath(t *testing.T) {
+	var gotPath, gotToken string
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotToken = r.Header.Get("PRIVATE-TOKEN")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		_ = json.NewEncoder(w).Encode(map[string]any{"iid": 7, "web_url": "https://gitlab.example.com/group/sub/tool/-/merge_requests/7", "state": "opened", "source_branch": "feature", "target_branch": "main"})
+	}))
+	defer srv.Close()
+
+	adapter, err := New(Config{Kind: KindGitLab, APIBaseURL: srv.URL, Token: "glpat"})
+	if err != nil {
+		t.Fatalf("new adapter: %v", err)
+	}
+	pr, err := adapter.CreatePullRequest(context.Background(), "group/sub/tool", PullRequestSpec{Head: "feature", Base: "main", Title: "Add tool", Draft: true})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if gotPath != "/projects/group%2Fsub%2Ftool/merge_requests" || gotToken != "glpat" {
+		t.Fatalf("unexpected request path=%q token=%q", gotPath, gotToken)
+	}
+	if gotBody["title"] != "Draft: Add tool" || gotBody["source_branch"] != "feature" {
+		t.Fatalf("unexpected request body %+v", gotBody)
+	}
+	if pr.Number != 7 || pr.Head != "feature" {
+		t.Fatalf("unexpected pull request %+v", pr)
+	}
+}
+
+func TestAPIErrorIncludesStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	adapter, _ := New(Config{Kind: KindGitea, APIBaseURL: srv.URL})
+	_, err := adapter.FindOpenPullRequest(context.Background(), "team/app", "feature", "main")
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 api error, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type gitea struct {
+	api *apiClient
+}
+
+// Gitea's pull request payload matches GitHub's for the fields used here.
+type giteaPull = githubPull
+
+func (g *gitea) Kind() string { return KindGitea }
+
+func (g *gitea) FindOpenPullRequest(ctx context.Context, repo, head, base string) (*PullRequest, error) {
+	var pulls []giteaPull
+	if err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls?state=open", repoPath(repo)), nil, &pulls); err != nil {
+		return nil, err
+	}
+	for _, p := range pulls {
+		if p.Head.Ref == head && (base == "" || p.Base.Ref == base) {
+			return p.toPullRequest(), nil
+		}
+	}
+	return nil, nil
+}
+
+func (g *gitea) CreatePullRequest(ctx context.Context, repo string, spec PullRequestSpec) (*PullRequest, error) {
+	title := spec.Title
+	if spec.Draft {
+		title = "WIP: " + title
+	}
+	in := map[string]any{"head": spec.Head, "base": spec.Base, "title": title, "body": spec.Body}
+	var out giteaPull
+	if err := g.api.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls", repoPath(repo)), in, &out); err != nil {
+		return nil, err
+	}
+	return out.toPullRequest(), nil
+}
+
+func (g *gitea) UpdatePullRequest(ctx context.Context, repo string, number int, spec PullRequestSpec) (*PullRequest, error) {
+	in := map[string]any{"title": spec.Title, "body": spec.Body}
+	if spec.Base != "" {
+		in["base"] = spec.Base
+	}
+	var out giteaPull
+	if err := g.api.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/pulls/%d", repoPath(repo), number), in, &out); err != nil {
+		return nil, err
+	}
+	return out.toPullRequest(), nil
+}
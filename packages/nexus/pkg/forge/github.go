@@ -0,0 +1,71 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type github struct {
+	api *apiClient
+}
+
+type githubPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+	Title   string `json:"title"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+func (p githubPull) toPullRequest() *PullRequest {
+	return &PullRequest{Number: p.Number, URL: p.HTMLURL, State: p.State, Title: p.Title, Head: p.Head.Ref, Base: p.Base.Ref}
+}
+
+func (g *github) Kind() string { return KindGitHub }
+
+func (g *github) FindOpenPullRequest(ctx context.Context, repo, head, base string) (*PullRequest, error) {
+	owner := strings.SplitN(repo, "/", 2)[0]
+	q := url.Values{"state": {"open"}, "head": {owner + ":" + head}}
+	if base != "" {
+		q.Set("base", base)
+	}
+	var pulls []githubPull
+	if err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls?%s", repoPath(repo), q.Encode()), nil, &pulls); err != nil {
+		return nil, err
+	}
+	for _, p := range pulls {
+		if p.Head.Ref == head {
+			return p.toPullRequest(), nil
+		}
+	}
+	return nil, nil
+}
+
+func (g *github) CreatePullRequest(ctx context.Context, repo string, spec PullRequestSpec) (*PullRequest, error) {
+	in := map[string]any{"head": spec.Head, "base": spec.Base, "title": spec.Title, "body": spec.Body, "draft": spec.Draft}
+	var out githubPull
+	if err := g.api.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls", repoPath(repo)), in, &out); err != nil {
+		return nil, err
+	}
+	return out.toPullRequest(), nil
+}
+
+func (g *github) UpdatePullRequest(ctx context.Context, repo string, number int, spec PullRequestSpec) (*PullRequest, error) {
+	in := map[string]any{"title": spec.Title, "body": spec.Body}
+	if spec.Base != "" {
+		in["base"] = spec.Base
+	}
+	var out githubPull
+	if err := g.api.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/pulls/%d", repoPath(repo), number), in, &out); err != nil {
+		return nil, err
+	}
+	return out.toPullRequest(), nil
+}
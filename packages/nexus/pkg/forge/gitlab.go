@@ -0,0 +1,75 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type gitlab struct {
+	api *apiClient
+}
+
+type gitlabMergeRequest struct {
+	IID          int    `json:"iid"`
+	WebURL       string `json:"web_url"`
+	State        string `json:"state"`
+	Title        string `json:"title"`
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+}
+
+func (m gitlabMergeRequest) toPullRequest() *PullRequest {
+	return &PullRequest{Number: m.IID, URL: m.WebURL, State: m.State, Title: m.Title, Head: m.SourceBranch, Base: m.TargetBranch}
+}
+
+func (g *gitlab) Kind() string { return KindGitLab }
+
+// projectPath encodes the full project path as a single path segment, as the
+// GitLab API expects for non-numeric project ids.
+func (g *gitlab) projectPath(repo string) string {
+	return "/projects/" + url.PathEscape(repo)
+}
+
+func (g *gitlab) FindOpenPullRequest(ctx context.Context, repo, head, base string) (*PullRequest, error) {
+	q := url.Values{"state": {"opened"}, "source_branch": {head}}
+	if base != "" {
+		q.Set("target_branch", base)
+	}
+	var mrs []gitlabMergeRequest
+	if err := g.api.do(ctx, http.MethodGet, g.projectPath(repo)+"/merge_requests?"+q.Encode(), nil, &mrs); err != nil {
+		return nil, err
+	}
+	for _, mr := range mrs {
+		if mr.SourceBranch == head {
+			return mr.toPullRequest(), nil
+		}
+	}
+	return nil, nil
+}
+
+func (g *gitlab) CreatePullRequest(ctx context.Context, repo string, spec PullRequestSpec) (*PullRequest, error) {
+	title := spec.Title
+	if spec.Draft {
+		title = "Draft: " + title
+	}
+	in := map[string]any{"source_branch": spec.Head, "target_branch": spec.Base, "title": title, "description": spec.Body}
+	var out gitlabMergeRequest
+	if err := g.api.do(ctx, http.MethodPost, g.projectPath(repo)+"/merge_requests", in, &out); err != nil {
+		return nil, err
+	}
+	return out.toPullRequest(), nil
+}
+
+func (g *gitlab) UpdatePullRequest(ctx context.Context, repo string, number int, spec PullRequestSpec) (*PullRequest, error) {
+	in := map[string]any{"title": spec.Title, "description": spec.Body}
+	if spec.Base != "" {
+		in["target_branch"] = spec.Base
+	}
+	var out gitlabMergeRequest
+	if err := g.api.do(ctx, http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", g.projectPath(repo), number), in, &out); err != nil {
+		return nil, err
+	}
+	return out.toPullRequest(), nil
+}
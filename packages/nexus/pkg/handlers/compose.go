@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/compose"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+)
+
+// defaultComposeLogTail bounds non-follow log reads so a chatty service
+// cannot produce an unbounded RPC result.
+const defaultComposeLogTail = 200
+
+type ComposePSParams struct {
+	WorkspaceID string `json:"workspaceId"`
+}
+
+type ComposePSResult struct {
+	Services []compose.ServiceStatus `json:"services"`
+}
+
+type ComposeLogsParams struct {
+	WorkspaceID string   `json:"workspaceId"`
+	Services    []string `json:"services,omitempty"`
+	Tail        int      `json:"tail,omitempty"`
+	Since       string   `json:"since,omitempty"`
+	// Follow streams compose.logs.data notifications instead of returning
+	// the lines in the result.
+	Follow bool `json:"follow,omitempty"`
+}
+
+type ComposeLogsResult struct {
+	Lines    []compose.LogLine `json:"lines,omitempty"`
+	StreamID string            `json:"streamId,omitempty"`
+}
+
+type ComposeServicesParams struct {
+	WorkspaceID string   `json:"workspaceId"`
+	Services    []string `json:"services,omitempty"`
+	Build       bool     `json:"build,omitempty"`
+}
+
+type ComposeDownParams struct {
+	WorkspaceID string `json:"workspaceId"`
+	Volumes     bool   `json:"volumes,omitempty"`
+}
+
+type ComposeActionResult struct {
+	OK bool `json:"ok"`
+}
+
+func HandleComposePS(ctx context.Context, p ComposePSParams, svc *compose.Services) (*ComposePSResult, *rpckit.RPCError) {
+	services, err := svc.PS(ctx, p.WorkspaceID)
+	if err != nil {
+		return nil, composeRPCError(err)
+	}
+	return &ComposePSResult{Services: services}, nil
+}
+
+// HandleComposeLogs returns recent log lines. Following is handled by the
+// server, which owns the connection the lines are pushed to.
+func HandleComposeLogs(ctx context.Context, p ComposeLogsParams, svc *compose.Services) (*ComposeLogsResult, *rpckit.RPCError) {
+	opts := ComposeLogsOptions(p)
+	opts.Follow = false
+	if opts.Tail <= 0 {
+		opts.Tail = defaultComposeLogTail
+	}
+	lines := []compose.LogLine{}
+	if err := svc.Logs(ctx, p.WorkspaceID, opts, func(l compose.LogLine) { lines = append(lines, l) }); err != nil {
+		return nil, composeRPCError(err)
+	}
+	return &ComposeLogsResult{Lines: lines}, nil
+}
+
+// ComposeLogsOptions converts RPC params to compose.LogsOptions.
+func ComposeLogsOptions(p ComposeLogsParams) compose.LogsOptions {
+	return compose.LogsOptions{Services: p.Services, Tail: p.Tail, Since: p.Since, Follow: p.Follow}
+}
+
+func HandleComposeRestart(ctx context.Context, p ComposeServicesParams, svc *compose.Services) (*ComposeActionResult, *rpckit.RPCError) {
+	if err := svc.Restart(ctx, p.WorkspaceID, p.Services); err != nil {
+		return nil, composeRPCError(err)
+	}
+	return &ComposeActionResult{OK: true}, nil
+}
+
+func HandleComposeUp(ctx context.Context, p ComposeServicesParams, svc *compose.Services) (*ComposeActionResult, *rpckit.RPCError) {
+	if err := svc.Up(ctx, p.WorkspaceID, p.Services, p.Build); err != nil {
+		return nil, composeRPCError(err)
+	}
+	return &ComposeActionResult{OK: true}, nil
+}
+
+func HandleComposeDown(ctx context.Context, p ComposeDownParams, svc *compose.Services) (*ComposeActionResult, *rpckit.RPCError) {
+	if err := svc.Down(ctx, p.WorkspaceID, p.Volumes); err != nil {
+		return nil, composeRPCError(err)
+	}
+	return &ComposeActionResult{OK: true}, nil
+}
+
+func composeRPCError(err error) *rpckit.RPCError {
+	if errors.Is(err, compose.ErrInvalidService) {
+		return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: err.Error()}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -15,6 +17,9 @@ type ReadFileParams struct {
 	WorkspaceID string `json:"workspaceId,omitempty"`
 	Path        string `json:"path"`
 	Encoding    string `json:"encoding"`
+	// Offset and Length select a byte range; Length 0 reads to the end.
+	Offset int64 `json:"offset,omitempty"`
+	Length int64 `json:"length,omitempty"`
 }
 
 type WriteFileParams struct {
@@ -49,20 +54,32 @@ type RmParams struct {
 type StatParams struct {
 	WorkspaceID string `json:"workspaceId,omitempty"`
 	Path        string `json:"path"`
+	// NoFollow describes a symlink itself rather than what it points to.
+	NoFollow bool `json:"noFollow,omitempty"`
+	// Hash adds the hex SHA-256 of a regular file's content.
+	Hash bool `json:"hash,omitempty"`
 }
 
 type DirEntry struct {
-	Name  string `json:"name"`
-	Path  string `json:"path"`
-	IsDir bool   `json:"is_dir"`
-	Size  int64  `json:"size"`
-	Mode  string `json:"mode"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	IsDir     bool   `json:"is_dir"`
+	IsSymlink bool   `json:"is_symlink,omitempty"`
+	Size      int64  `json:"size"`
+	Mode      string `json:"mode"`
+	MtimeMs   int64  `json:"mtime_ms"`
+	UID       int    `json:"uid"`
+	GID       int    `json:"gid"`
 }
 
 type ReadFileResult struct {
 	Content  string `json:"content"`
 	Encoding string `json:"encoding"`
-	Size     int64  `json:"size"`
+	// Size is the number of bytes read; FileSize that of the whole file.
+	Size     int64 `json:"size"`
+	Offset   int64 `json:"offset,omitempty"`
+	FileSize int64 `json:"fileSize"`
+	EOF      bool  `json:"eof"`
 }
 
 type WriteFileResult struct {
@@ -81,36 +98,75 @@ type ReaddirResult struct {
 	Path    string     `json:"path"`
 }
 
+type FileStats struct {
+	IsFile         bool   `json:"isFile"`
+	IsDirectory    bool   `json:"isDirectory"`
+	IsSymbolicLink bool   `json:"isSymbolicLink"`
+	Size           int64  `json:"size"`
+	Mtime          string `json:"mtime"`
+	Ctime          string `json:"ctime"`
+	MtimeMs        int64  `json:"mtimeMs"`
+	Mode           int    `json:"mode"`
+	// UID and GID are -1 where the host has no file ownership.
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+	// Target is where a symlink at the path points, as stored in the link.
+	Target string `json:"target,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+}
+
 type StatResult struct {
-	Stats struct {
-		IsFile      bool   `json:"isFile"`
-		IsDirectory bool   `json:"isDirectory"`
-		Size        int64  `json:"size"`
-		Mtime       string `json:"mtime"`
-		Ctime       string `json:"ctime"`
-		Mode        int    `json:"mode"`
-	} `json:"stats"`
-	Name    string `json:"name"`
-	Path    string `json:"path"`
-	IsDir   bool   `json:"isDir"`
-	Size    int64  `json:"size"`
-	Mode    string `json:"mode"`
-	ModTime string `json:"modTime"`
+	Stats   FileStats `json:"stats"`
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime string    `json:"modTime"`
 }
 
 func HandleReadFile(ctx context.Context, p ReadFileParams, ws *workspace.Workspace) (*ReadFileResult, *rpckit.RPCError) {
-	safePath, err := ws.SecurePath(p.Path)
+	safePath, err := ws.ContainedPath(p.Path, true)
 	if err != nil {
 		return nil, rpckit.ErrInvalidPath
 	}
 
-	content, err := os.ReadFile(safePath)
+	if p.Offset < 0 || p.Length < 0 {
+		return nil, rpckit.ErrInvalidParams
+	}
+
+	f, err := os.Open(safePath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, rpckit.ErrFileNotFound
 		}
 		return nil, rpckit.ErrInternalError
 	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, rpckit.ErrInternalError
+	}
+
+	var content []byte
+	if p.Offset == 0 && p.Length == 0 {
+		content, err = io.ReadAll(f)
+	} else {
+		length := p.Length
+		if length == 0 || length > info.Size()-p.Offset {
+			length = max(info.Size()-p.Offset, 0)
+		}
+		content = make([]byte, length)
+		var n int
+		n, err = f.ReadAt(content, p.Offset)
+		content = content[:n]
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, rpckit.ErrInternalError
+	}
 
 	encoding := "utf8"
 	if p.Encoding != "" {
@@ -118,9 +174,12 @@ func HandleReadFile(ctx context.Context, p ReadFileParams, ws *workspace.Workspa
 	}
 
 	return &ReadFileResult{
-		Content:  string(content),
+		Content:  encodeContent(content, encoding),
 		Encoding: encoding,
 		Size:     int64(len(content)),
+		Offset:   p.Offset,
+		FileSize: info.Size(),
+		EOF:      p.Offset+int64(len(content)) >= info.Size(),
 	}, nil
 }
 
@@ -129,7 +188,7 @@ func HandleWriteFile(ctx context.Context, p WriteFileParams, ws *workspace.Works
 		return nil, rpckit.ErrInvalidParams
 	}
 
-	safePath, err := ws.SecurePath(p.Path)
+	safePath, err := ws.ContainedPath(p.Path, true)
 	if err != nil {
 		return nil, rpckit.ErrInvalidPath
 	}
@@ -165,7 +224,7 @@ func HandleWriteFile(ctx context.Context, p WriteFileParams, ws *workspace.Works
 }
 
 func HandleExists(ctx context.Context, p ExistsParams, ws *workspace.Workspace) (*ExistsResult, *rpckit.RPCError) {
-	safePath, err := ws.SecurePath(p.Path)
+	safePath, err := ws.ContainedPath(p.Path, true)
 	if err != nil {
 		return nil, rpckit.ErrInvalidPath
 	}
@@ -185,7 +244,7 @@ func HandleReaddir(ctx context.Context, p ReaddirParams, ws *workspace.Workspace
 		path = p.Path
 	}
 
-	safePath, err := ws.SecurePath(path)
+	safePath, err := ws.ContainedPath(path, true)
 	if err != nil {
 		return nil, rpckit.ErrInvalidPath
 	}
@@ -206,13 +265,7 @@ func HandleReaddir(ctx context.Context, p ReaddirParams, ws *workspace.Workspace
 			continue
 		}
 
-		dirEntries = append(dirEntries, DirEntry{
-			Name:  entry.Name(),
-			Path:  entryPath,
-			IsDir: entry.IsDir(),
-			Size:  info.Size(),
-			Mode:  info.Mode().String(),
-		})
+		dirEntries = append(dirEntries, newDirEntry(entryPath, info))
 	}
 
 	return &ReaddirResult{
@@ -226,7 +279,7 @@ func HandleMkdir(ctx context.Context, p MkdirParams, ws *workspace.Workspace) (*
 		return nil, rpckit.ErrInvalidParams
 	}
 
-	safePath, err := ws.SecurePath(p.Path)
+	safePath, err := ws.ContainedPath(p.Path, true)
 	if err != nil {
 		return nil, rpckit.ErrInvalidPath
 	}
@@ -251,7 +304,7 @@ func HandleRm(ctx context.Context, p RmParams, ws *workspace.Workspace) (*WriteF
 		return nil, rpckit.ErrInvalidParams
 	}
 
-	safePath, err := ws.SecurePath(p.Path)
+	safePath, err := ws.ContainedPath(p.Path, false)
 	if err != nil {
 		return nil, rpckit.ErrInvalidPath
 	}
@@ -276,18 +329,44 @@ func HandleRm(ctx context.Context, p RmParams, ws *workspace.Workspace) (*WriteF
 }
 
 func HandleStat(ctx context.Context, p StatParams, ws *workspace.Workspace) (*StatResult, *rpckit.RPCError) {
-	safePath, err := ws.SecurePath(p.Path)
+	safePath, err := ws.ContainedPath(p.Path, false)
 	if err != nil {
 		return nil, rpckit.ErrInvalidPath
 	}
 
-	info, err := os.Stat(safePath)
+	info, err := os.Lstat(safePath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, rpckit.ErrFileNotFound
 		}
 		return nil, rpckit.ErrInternalError
 	}
+	var target string
+	isSymlink := info.Mode()&fs.ModeSymlink != 0
+	if isSymlink {
+		if target, err = os.Readlink(safePath); err != nil {
+			return nil, rpckit.ErrInternalError
+		}
+		if !p.NoFollow {
+			// Only follow links that stay inside the workspace.
+			if _, err := ws.ContainedPath(p.Path, true); err != nil {
+				return nil, rpckit.ErrInvalidPath
+			}
+			if info, err = os.Stat(safePath); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return nil, rpckit.ErrFileNotFound
+				}
+				return nil, rpckit.ErrInternalError
+			}
+		}
+	}
+	var hash string
+	if p.Hash && info.Mode().IsRegular() {
+		if hash, err = hashFile(safePath); err != nil {
+			return nil, rpckit.ErrInternalError
+		}
+	}
+	uid, gid, _ := fileOwner(info)
 
 	return &StatResult{
 		Name:    filepath.Base(safePath),
@@ -296,38 +375,61 @@ func HandleStat(ctx context.Context, p StatParams, ws *workspace.Workspace) (*St
 		Size:    info.Size(),
 		Mode:    info.Mode().String(),
 		ModTime: info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
-		Stats: struct {
-			IsFile      bool   `json:"isFile"`
-			IsDirectory bool   `json:"isDirectory"`
-			Size        int64  `json:"size"`
-			Mtime       string `json:"mtime"`
-			Ctime       string `json:"ctime"`
-			Mode        int    `json:"mode"`
-		}{
-			IsFile:      !info.IsDir(),
-			IsDirectory: info.IsDir(),
-			Size:        info.Size(),
-			Mtime:       info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
-			Ctime:       info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
-			Mode:        int(info.Mode()),
+		Stats: FileStats{
+			IsFile:         info.Mode().IsRegular(),
+			IsDirectory:    info.IsDir(),
+			IsSymbolicLink: isSymlink,
+			Size:           info.Size(),
+			Mtime:          info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
+			Ctime:          info.ModTime().Format("2006-01-02T15:04:05Z07:00"),
+			MtimeMs:        info.ModTime().UnixMilli(),
+			Mode:           int(info.Mode()),
+			UID:            uid,
+			GID:            gid,
+			Target:         target,
+			Hash:           hash,
 		},
 	}, nil
 }
 
 func decodeBase64(s string) ([]byte, error) {
-	return []byte{}, nil
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// encodeContent renders file bytes for a JSON result: base64 when asked,
+// as text otherwise.
+func encodeContent(data []byte, encoding string) string {
+	if encoding == "base64" {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return string(data)
 }
 
 func getDirEntries(entries []fs.DirEntry) []DirEntry {
 	result := make([]DirEntry, 0, len(entries))
 	for _, entry := range entries {
-		info, _ := entry.Info()
-		result = append(result, DirEntry{
-			Name:  entry.Name(),
-			IsDir: entry.IsDir(),
-			Size:  info.Size(),
-			Mode:  info.Mode().String(),
-		})
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		result = append(result, newDirEntry("", info))
 	}
 	return result
 }
+
+// newDirEntry describes a directory entry without following it, so a
+// symlink is reported as one.
+func newDirEntry(path string, info fs.FileInfo) DirEntry {
+	uid, gid, _ := fileOwner(info)
+	return DirEntry{
+		Name:      info.Name(),
+		Path:      path,
+		IsDir:     info.IsDir(),
+		IsSymlink: info.Mode()&fs.ModeSymlink != 0,
+		Size:      info.Size(),
+		Mode:      info.Mode().String(),
+		MtimeMs:   info.ModTime().UnixMilli(),
+		UID:       uid,
+		GID:       gid,
+	}
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+const (
+	// DefaultChunkBytes is what fs.read returns when no length is given.
+	DefaultChunkBytes = 64 << 10
+	// MaxChunkBytes bounds one fs.read or fs.write, keeping a base64 chunk
+	// well inside the websocket message limit.
+	MaxChunkBytes = 256 << 10
+	// TailPollInterval is how often fs.tail checks the file for new data.
+	TailPollInterval = 250 * time.Millisecond
+)
+
+type OpenParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	// Mode is "r" (the default), "w" (create or truncate), "a" (create,
+	// append) or "rw" (read and write an existing file).
+	Mode string `json:"mode,omitempty"`
+}
+
+type OpenResult struct {
+	Handle string `json:"handle"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+}
+
+type ReadParams struct {
+	Handle string `json:"handle"`
+	// Offset reads from a position without moving the handle; without it
+	// reads continue where the last one stopped.
+	Offset   *int64 `json:"offset,omitempty"`
+	Length   int    `json:"length,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type ReadResult struct {
+	Data     string `json:"data"`
+	Encoding string `json:"encoding"`
+	Offset   int64  `json:"offset"`
+	Size     int    `json:"size"`
+	EOF      bool   `json:"eof"`
+}
+
+type WriteParams struct {
+	Handle   string `json:"handle"`
+	Data     string `json:"data"`
+	Encoding string `json:"encoding,omitempty"`
+	Offset   *int64 `json:"offset,omitempty"`
+}
+
+type WriteResult struct {
+	Written int   `json:"written"`
+	Offset  int64 `json:"offset"`
+}
+
+type CloseParams struct {
+	Handle string `json:"handle"`
+}
+
+type TailParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	// Lines starts the tail that many lines before the end; otherwise it
+	// starts at Offset, or at the end when Offset is not set.
+	Lines    int    `json:"lines,omitempty"`
+	Offset   *int64 `json:"offset,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// TailChunk is data appended to a followed file. Truncated marks data read
+// from the start again after the file shrank or was replaced.
+type TailChunk struct {
+	Data      string `json:"data"`
+	Offset    int64  `json:"offset"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// OpenFile opens a workspace file for the handle API.
+func OpenFile(p OpenParams, ws *workspace.Workspace) (*os.File, *rpckit.RPCError) {
+	if p.Path == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	var flag int
+	switch p.Mode {
+	case "", "r":
+		flag = os.O_RDONLY
+	case "w":
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	case "a":
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	case "rw":
+		flag = os.O_RDWR
+	default:
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "mode must be r, w, a or rw"}
+	}
+	safePath, err := ws.ContainedPath(p.Path, true)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	if flag&os.O_CREATE != 0 {
+		if err := os.MkdirAll(filepath.Dir(safePath), 0755); err != nil {
+			return nil, rpckit.ErrInternalError
+		}
+	}
+	f, err := os.OpenFile(safePath, flag, 0644)
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		_ = f.Close()
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "not a regular file"}
+	}
+	return f, nil
+}
+
+// ReadChunk reads the next chunk, or the one at p.Offset, from f.
+func ReadChunk(f *os.File, p ReadParams) (*ReadResult, *rpckit.RPCError) {
+	length := p.Length
+	if length <= 0 {
+		length = DefaultChunkBytes
+	}
+	if length > MaxChunkBytes {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("length is limited to %d bytes", MaxChunkBytes)}
+	}
+	encoding := p.Encoding
+	if encoding == "" {
+		encoding = "utf8"
+	}
+
+	buf := make([]byte, length)
+	var n int
+	var offset int64
+	var err error
+	if p.Offset != nil {
+		if *p.Offset < 0 {
+			return nil, rpckit.ErrInvalidParams
+		}
+		offset = *p.Offset
+		n, err = f.ReadAt(buf, offset)
+	} else {
+		if offset, err = f.Seek(0, io.SeekCurrent); err != nil {
+			return nil, fileRPCError(err)
+		}
+		n, err = io.ReadFull(f, buf)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+	}
+	eof := errors.Is(err, io.EOF)
+	if err != nil && !eof {
+		return nil, fileRPCError(err)
+	}
+	if !eof {
+		// A read that exactly reaches the end should say so.
+		if info, statErr := f.Stat(); statErr == nil && offset+int64(n) >= info.Size() {
+			eof = true
+		}
+	}
+	return &ReadResult{
+		Data:     encodeContent(buf[:n], encoding),
+		Encoding: encoding,
+		Offset:   offset,
+		Size:     n,
+		EOF:      eof,
+	}, nil
+}
+
+// WriteChunk writes one chunk to f, at p.Offset or the handle's position.
+func WriteChunk(f *os.File, p WriteParams) (*WriteResult, *rpckit.RPCError) {
+	data := []byte(p.Data)
+	switch p.Encoding {
+	case "", "utf8", "utf-8":
+	case "base64":
+		decoded, err := decodeBase64(p.Data)
+		if err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		data = decoded
+	default:
+		return nil, rpckit.ErrInvalidParams
+	}
+	if len(data) > MaxChunkBytes {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("chunks are limited to %d bytes", MaxChunkBytes)}
+	}
+
+	if p.Offset != nil {
+		if *p.Offset < 0 {
+			return nil, rpckit.ErrInvalidParams
+		}
+		n, err := f.WriteAt(data, *p.Offset)
+		if err != nil {
+			return nil, fileRPCError(err)
+		}
+		return &WriteResult{Written: n, Offset: *p.Offset}, nil
+	}
+	n, err := f.Write(data)
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	// Appends land at the end wherever the handle was, so the position
+	// is only known afterwards.
+	end, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	return &WriteResult{Written: n, Offset: end - int64(n)}, nil
+}
+
+// FileTail follows a file as it grows.
+type FileTail struct {
+	path     string
+	encoding string
+	f        *os.File
+	info     os.FileInfo
+	offset   int64
+}
+
+// OpenTail opens a workspace file for fs.tail and finds where following
+// starts.
+func OpenTail(p TailParams, ws *workspace.Workspace) (*FileTail, *rpckit.RPCError) {
+	if p.Path == "" || p.Lines < 0 {
+		return nil, rpckit.ErrInvalidParams
+	}
+	safePath, err := ws.ContainedPath(p.Path, true)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	f, err := os.Open(safePath)
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		_ = f.Close()
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "not a regular file"}
+	}
+	t := &FileTail{path: safePath, encoding: p.Encoding, f: f, info: info, offset: info.Size()}
+	switch {
+	case p.Lines > 0:
+		if t.offset, err = lastLinesOffset(f, info.Size(), p.Lines); err != nil {
+			_ = f.Close()
+			return nil, fileRPCError(err)
+		}
+	case p.Offset != nil:
+		t.offset = min(max(*p.Offset, 0), info.Size())
+	}
+	return t, nil
+}
+
+// Follow sends what is in the file past the start and then whatever is
+// appended, until ctx is done. A file that shrinks or is replaced, as log
+// rotation does, is read again from its start. Follow closes the file.
+func (t *FileTail) Follow(ctx context.Context, emit func(TailChunk)) error {
+	defer func() { _ = t.f.Close() }()
+	buf := make([]byte, DefaultChunkBytes)
+	truncated := false
+	ticker := time.NewTicker(TailPollInterval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			n, err := t.f.ReadAt(buf, t.offset)
+			if n > 0 {
+				emit(TailChunk{Data: encodeContent(buf[:n], t.encoding), Offset: t.offset, Truncated: truncated})
+				t.offset += int64(n)
+				truncated = false
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			if n < len(buf) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := os.Stat(t.path)
+		if err != nil {
+			// Rotated away and not recreated yet.
+			continue
+		}
+		if !os.SameFile(t.info, current) {
+			next, err := os.Open(t.path)
+			if err != nil {
+				continue
+			}
+			_ = t.f.Close()
+			t.f, t.info, t.offset, truncated = next, current, 0, true
+			continue
+		}
+		if current.Size() < t.offset {
+			t.offset, truncated = 0, true
+		}
+	}
+}
+
+// lastLinesOffset returns where the last n lines of f start. A final line
+// without a newline counts as a line.
+func lastLinesOffset(f *os.File, size int64, n int) (int64, error) {
+	const block = 8 << 10
+	buf := make([]byte, block)
+	pos := size
+	newlines := 0
+	for pos > 0 {
+		start := max(pos-block, 0)
+		chunk := buf[:pos-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			newlines++
+			if newlines == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		pos = start
+	}
+	return 0, nil
+}
+
+func fileRPCError(err error) *rpckit.RPCError {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return rpckit.ErrFileNotFound
+	case errors.Is(err, os.ErrPermission):
+		return rpckit.ErrPermissionDenied
+	}
+	return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: err.Error()}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+func TestReadFileRangeAndBase64(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "data.bin"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, rpcErr := HandleReadFile(context.Background(), ReadFileParams{Path: "data.bin", Offset: 3, Length: 4}, ws)
+	if rpcErr != nil {
+		t.Fatalf("HandleReadFile: %v", rpcErr)
+	}
+	if result.Content != "3456" || result.Size != 4 || result.FileSize != 10 || result.EOF {
+		t.Fatalf("unexpected range result %+v", result)
+	}
+	result, rpcErr = HandleReadFile(context.Background(), ReadFileParams{Path: "data.bin", Offset: 8, Length: 100, Encoding: "base64"}, ws)
+	if rpcErr != nil {
+		t.Fatalf("HandleReadFile: %v", rpcErr)
+	}
+	if result.Content != base64.StdEncoding.EncodeToString([]byte("89")) || !result.EOF {
+		t.Fatalf("unexpected tail result %+v", result)
+	}
+}
+
+func TestFileHandleChunks(t *testing.T) {
+	ws, err := workspace.NewWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, rpcErr := OpenFile(OpenParams{Path: "logs/out.bin", Mode: "w"}, ws)
+	if rpcErr != nil {
+		t.Fatalf("OpenFile: %v", rpcErr)
+	}
+	for _, chunk := range []string{"hello ", "world"} {
+		if _, rpcErr := WriteChunk(w, WriteParams{Data: base64.StdEncoding.EncodeToString([]byte(chunk)), Encoding: "base64"}); rpcErr != nil {
+			t.Fatalf("WriteChunk: %v", rpcErr)
+		}
+	}
+	_ = w.Close()
+
+	a, rpcErr := OpenFile(OpenParams{Path: "logs/out.bin", Mode: "a"}, ws)
+	if rpcErr != nil {
+		t.Fatalf("OpenFile: %v", rpcErr)
+	}
+	wrote, rpcErr := WriteChunk(a, WriteParams{Data: "!"})
+	if rpcErr != nil || wrote.Offset != 11 {
+		t.Fatalf("append = %+v, %v", wrote, rpcErr)
+	}
+	_ = a.Close()
+
+	r, rpcErr := OpenFile(OpenParams{Path: "logs/out.bin"}, ws)
+	if rpcErr != nil {
+		t.Fatalf("OpenFile: %v", rpcErr)
+	}
+	defer r.Close()
+	first, rpcErr := ReadChunk(r, ReadParams{Length: 6})
+	if rpcErr != nil || first.Data != "hello " || first.Offset != 0 || first.EOF {
+		t.Fatalf("first chunk = %+v, %v", first, rpcErr)
+	}
+	second, rpcErr := ReadChunk(r, ReadParams{Length: 6})
+	if rpcErr != nil || second.Data != "world!" || second.Offset != 6 || !second.EOF {
+		t.Fatalf("second chunk = %+v, %v", second, rpcErr)
+	}
+	offset := int64(2)
+	at, rpcErr := ReadChunk(r, ReadParams{Offset: &offset, Length: 3})
+	if rpcErr != nil || at.Data != "llo" {
+		t.Fatalf("chunk at offset = %+v, %v", at, rpcErr)
+	}
+	if _, rpcErr := ReadChunk(r, ReadParams{Length: MaxChunkBytes + 1}); rpcErr == nil {
+		t.Fatal("expected oversized chunk to be refused")
+	}
+	if _, rpcErr := OpenFile(OpenParams{Path: "../outside", Mode: "w"}, ws); rpcErr == nil {
+		t.Fatal("expected path outside the workspace to be refused")
+	}
+}
+
+func TestTailFollowsAppendsAndTruncation(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "app.log")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail, rpcErr := OpenTail(TailParams{Path: "app.log", Lines: 2}, ws)
+	if rpcErr != nil {
+		t.Fatalf("OpenTail: %v", rpcErr)
+	}
+
+	chunks := make(chan TailChunk, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tail.Follow(ctx, func(c TailChunk) { chunks <- c }) }()
+	next := func() TailChunk {
+		t.Helper()
+		select {
+		case c := <-chunks:
+			return c
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for tail data")
+		}
+		return TailChunk{}
+	}
+
+	if c := next(); c.Data != "two\nthree\n" || c.Offset != 4 {
+		t.Fatalf("unexpected first chunk %+v", c)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("four\n")
+	_ = f.Close()
+	if c := next(); c.Data != "four\n" || c.Offset != 14 {
+		t.Fatalf("unexpected appended chunk %+v", c)
+	}
+	if err := os.WriteFile(path, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); c.Data != "new\n" || c.Offset != 0 || !c.Truncated {
+		t.Fatalf("unexpected chunk after truncation %+v", c)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Follow: %v", err)
+	}
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+type ChmodParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	// Mode holds Unix permission bits, e.g. 0o755, including setuid,
+	// setgid and sticky.
+	Mode uint32 `json:"mode"`
+	// Recursive applies Mode to everything under a directory. Symlinks
+	// inside it are skipped.
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+type RenameParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	NewPath     string `json:"newPath"`
+	Overwrite   bool   `json:"overwrite,omitempty"`
+}
+
+type SymlinkParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	// Path is the link to create; Target is what it points to, relative
+	// to the link's directory.
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+type ReadlinkParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+}
+
+type ReadlinkResult struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+type CopyParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	NewPath     string `json:"newPath"`
+	// Recursive is required to copy a directory. Symlinks are copied as
+	// links, not followed.
+	Recursive bool `json:"recursive,omitempty"`
+	// Overwrite replaces an existing destination once the copy is done.
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+type CopyResult struct {
+	OK    bool   `json:"ok"`
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+	// Reflinked counts files cloned copy-on-write rather than copied.
+	Reflinked int `json:"reflinked"`
+}
+
+func HandleChmod(ctx context.Context, p ChmodParams, ws *workspace.Workspace) (*WriteFileResult, *rpckit.RPCError) {
+	if p.Path == "" || p.Mode > 0o7777 {
+		return nil, rpckit.ErrInvalidParams
+	}
+	safePath, err := ws.ContainedPath(p.Path, true)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	mode := fileModeFromUnix(p.Mode)
+
+	info, err := os.Stat(safePath)
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	if !p.Recursive || !info.IsDir() {
+		if err := os.Chmod(safePath, mode); err != nil {
+			return nil, fileRPCError(err)
+		}
+		return &WriteFileResult{OK: true, Path: p.Path}, nil
+	}
+
+	// Directories are changed last, deepest first, so a mode without
+	// search permission does not stop the walk.
+	var dirs []string
+	err = filepath.WalkDir(safePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			return nil
+		case d.IsDir():
+			dirs = append(dirs, path)
+			return nil
+		}
+		return os.Chmod(path, mode)
+	})
+	for i := len(dirs) - 1; err == nil && i >= 0; i-- {
+		err = os.Chmod(dirs[i], mode)
+	}
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	return &WriteFileResult{OK: true, Path: p.Path}, nil
+}
+
+func HandleRename(ctx context.Context, p RenameParams, ws *workspace.Workspace) (*WriteFileResult, *rpckit.RPCError) {
+	if isRootPath(p.Path) || isRootPath(p.NewPath) {
+		return nil, rpckit.ErrInvalidParams
+	}
+	from, err := ws.ContainedPath(p.Path, false)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	to, err := ws.ContainedPath(p.NewPath, false)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	if _, err := os.Lstat(from); err != nil {
+		return nil, fileRPCError(err)
+	}
+	if _, err := os.Lstat(to); err == nil && !p.Overwrite {
+		return nil, existsError(p.NewPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return nil, fileRPCError(err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return nil, fileRPCError(err)
+	}
+	return &WriteFileResult{OK: true, Path: p.NewPath}, nil
+}
+
+func HandleSymlink(ctx context.Context, p SymlinkParams, ws *workspace.Workspace) (*WriteFileResult, *rpckit.RPCError) {
+	if isRootPath(p.Path) || p.Target == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	if filepath.IsAbs(p.Target) {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "symlink target must be relative"}
+	}
+	link, err := ws.ContainedPath(p.Path, false)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	// The target may not exist yet, but it must not point outside.
+	if err := ws.CheckLinkTarget(link, p.Target); err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	if _, err := os.Lstat(link); err == nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: p.Path + " already exists"}
+	}
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return nil, fileRPCError(err)
+	}
+	if err := os.Symlink(p.Target, link); err != nil {
+		return nil, fileRPCError(err)
+	}
+	return &WriteFileResult{OK: true, Path: p.Path}, nil
+}
+
+func HandleReadlink(ctx context.Context, p ReadlinkParams, ws *workspace.Workspace) (*ReadlinkResult, *rpckit.RPCError) {
+	if isRootPath(p.Path) {
+		return nil, rpckit.ErrInvalidParams
+	}
+	link, err := ws.ContainedPath(p.Path, false)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	info, err := os.Lstat(link)
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "not a symlink"}
+	}
+	target, err := os.Readlink(link)
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	return &ReadlinkResult{Path: p.Path, Target: target}, nil
+}
+
+// HandleCopy copies a file, link or directory tree. The copy is built next
+// to the destination and renamed into place, so a failed copy leaves
+// nothing behind and an overwritten destination is replaced whole.
+func HandleCopy(ctx context.Context, p CopyParams, ws *workspace.Workspace) (*CopyResult, *rpckit.RPCError) {
+	if isRootPath(p.Path) || isRootPath(p.NewPath) {
+		return nil, rpckit.ErrInvalidParams
+	}
+	from, err := ws.ContainedPath(p.Path, false)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	to, err := ws.ContainedPath(p.NewPath, false)
+	if err != nil {
+		return nil, rpckit.ErrInvalidPath
+	}
+	info, err := os.Lstat(from)
+	if err != nil {
+		return nil, fileRPCError(err)
+	}
+	if info.IsDir() {
+		if !p.Recursive {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "source is a directory; set recursive"}
+		}
+		if rel, err := filepath.Rel(from, to); err == nil && filepath.IsLocal(rel) {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "cannot copy a directory into itself"}
+		}
+	}
+	if _, err := os.Lstat(to); err == nil && !p.Overwrite {
+		return nil, existsError(p.NewPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return nil, fileRPCError(err)
+	}
+
+	var suffix [4]byte
+	_, _ = rand.Read(suffix[:])
+	staged := filepath.Join(filepath.Dir(to), fmt.Sprintf(".%s.copy-%s", filepath.Base(to), hex.EncodeToString(suffix[:])))
+	result := &CopyResult{OK: true, Path: p.NewPath}
+	if err := copyTree(ctx, from, staged, result); err != nil {
+		_ = os.RemoveAll(staged)
+		if ctx.Err() != nil {
+			return nil, rpckit.ErrTimeout
+		}
+		return nil, fileRPCError(err)
+	}
+	if p.Overwrite {
+		if err := os.RemoveAll(to); err != nil {
+			_ = os.RemoveAll(staged)
+			return nil, fileRPCError(err)
+		}
+	}
+	if err := os.Rename(staged, to); err != nil {
+		_ = os.RemoveAll(staged)
+		return nil, fileRPCError(err)
+	}
+	return result, nil
+}
+
+// copyTree copies src to dst, keeping modes and modification times.
+// Devices, sockets and pipes are skipped.
+func copyTree(ctx context.Context, src, dst string, result *CopyResult) error {
+	type dirMeta struct {
+		path string
+		info fs.FileInfo
+	}
+	var dirs []dirMeta
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			// Writable until its contents are in; the mode is set after.
+			dirs = append(dirs, dirMeta{target, info})
+			return os.Mkdir(target, 0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !d.Type().IsRegular():
+			return nil
+		}
+		reflinked, n, err := copyFile(path, target, info)
+		if err != nil {
+			return err
+		}
+		result.Files++
+		result.Bytes += n
+		if reflinked {
+			result.Reflinked++
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; err == nil && i >= 0; i-- {
+		if err = os.Chmod(dirs[i].path, dirs[i].info.Mode()); err == nil {
+			err = os.Chtimes(dirs[i].path, time.Time{}, dirs[i].info.ModTime())
+		}
+	}
+	return err
+}
+
+// copyFile clones src into a new file at dst when the filesystem can,
+// and copies the bytes otherwise.
+func copyFile(src, dst string, info fs.FileInfo) (bool, int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return false, 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return false, 0, err
+	}
+	reflinked := reflink(out, in) == nil
+	n := info.Size()
+	if !reflinked {
+		n, err = io.Copy(out, in)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	// Modes can carry bits the umask removed when the file was created.
+	if err := os.Chmod(dst, info.Mode()); err != nil {
+		return false, 0, err
+	}
+	return reflinked, n, os.Chtimes(dst, time.Time{}, info.ModTime())
+}
+
+// fileModeFromUnix converts Unix permission bits to an fs.FileMode.
+func fileModeFromUnix(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0o777)
+	if mode&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+func isRootPath(p string) bool {
+	return p == "" || filepath.Clean(p) == "."
+}
+
+func existsError(path string) *rpckit.RPCError {
+	return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("%s already exists; set overwrite", path)}
+}
+
+// hashFile returns the hex SHA-256 of a file, as fs.applyPatch expects
+// for oldHash.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var errNoReflink = errors.New("reflink not supported")
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+func TestFSOpsRefuseSymlinkEscapes(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "ws")
+	outside := filepath.Join(base, "ws-outside")
+	for _, dir := range []string{root, outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("s"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../ws-outside/secret", filepath.Join(root, "secret-link")); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// A sibling sharing the workspace's name as a prefix is still outside.
+	if _, rpcErr := HandleStat(ctx, StatParams{Path: "../ws-outside/secret"}, ws); rpcErr == nil {
+		t.Fatal("expected a sibling directory to be refused")
+	}
+	if _, rpcErr := HandleChmod(ctx, ChmodParams{Path: "out/secret", Mode: 0o777}, ws); rpcErr == nil {
+		t.Fatal("expected chmod through a symlinked directory to be refused")
+	}
+	if _, rpcErr := HandleChmod(ctx, ChmodParams{Path: "secret-link", Mode: 0o777}, ws); rpcErr == nil {
+		t.Fatal("expected chmod of an escaping link to be refused")
+	}
+	if _, rpcErr := HandleStat(ctx, StatParams{Path: "secret-link"}, ws); rpcErr == nil {
+		t.Fatal("expected stat to refuse following an escaping link")
+	}
+	stat, rpcErr := HandleStat(ctx, StatParams{Path: "secret-link", NoFollow: true}, ws)
+	if rpcErr != nil || !stat.Stats.IsSymbolicLink || stat.Stats.Target != "../ws-outside/secret" {
+		t.Fatalf("lstat of link = %+v, %v", stat, rpcErr)
+	}
+	if _, rpcErr := HandleCopy(ctx, CopyParams{Path: "out/secret", NewPath: "copied"}, ws); rpcErr == nil {
+		t.Fatal("expected copy from outside to be refused")
+	}
+	if _, rpcErr := HandleRename(ctx, RenameParams{Path: "secret-link", NewPath: "out/moved"}, ws); rpcErr == nil {
+		t.Fatal("expected rename to outside to be refused")
+	}
+	if _, rpcErr := HandleSymlink(ctx, SymlinkParams{Path: "new-link", Target: "../ws-outside"}, ws); rpcErr == nil {
+		t.Fatal("expected a link pointing outside to be refused")
+	}
+	if _, rpcErr := HandleSymlink(ctx, SymlinkParams{Path: "new-link", Target: "/etc/passwd"}, ws); rpcErr == nil {
+		t.Fatal("expected an absolute link target to be refused")
+	}
+	// "d/.." is the workspace's parent once d is a link to ".", although
+	// it cleans to the workspace itself.
+	if _, rpcErr := HandleSymlink(ctx, SymlinkParams{Path: "d", Target: "."}, ws); rpcErr != nil {
+		t.Fatalf("HandleSymlink: %v", rpcErr)
+	}
+	if _, rpcErr := HandleSymlink(ctx, SymlinkParams{Path: "x", Target: "d/.."}, ws); rpcErr == nil {
+		t.Fatal("expected a link through d/.. to be refused")
+	}
+	if err := os.Symlink("d/..", filepath.Join(root, "x")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"x/ws-outside/secret", "out/secret", "secret-link"} {
+		if _, rpcErr := HandleReadFile(ctx, ReadFileParams{Path: path}, ws); rpcErr == nil {
+			t.Fatalf("expected readFile of %s to be refused", path)
+		}
+		if _, rpcErr := HandleWriteFile(ctx, WriteFileParams{Path: path, Content: "x"}, ws); rpcErr == nil {
+			t.Fatalf("expected writeFile of %s to be refused", path)
+		}
+	}
+	if _, rpcErr := HandleReaddir(ctx, ReaddirParams{Path: "out"}, ws); rpcErr == nil {
+		t.Fatal("expected readdir through an escaping link to be refused")
+	}
+	if _, rpcErr := HandleMkdir(ctx, MkdirParams{Path: "out/new", Recursive: true}, ws); rpcErr == nil {
+		t.Fatal("expected mkdir through an escaping link to be refused")
+	}
+	if _, rpcErr := HandleRm(ctx, RmParams{Path: "out/secret"}, ws); rpcErr == nil {
+		t.Fatal("expected rm through an escaping link to be refused")
+	}
+	// Removing the link itself is fine.
+	if _, rpcErr := HandleRm(ctx, RmParams{Path: "secret-link"}, ws); rpcErr != nil {
+		t.Fatalf("rm of the link: %v", rpcErr)
+	}
+	if info, err := os.Stat(filepath.Join(outside, "secret")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("outside file changed: %v %v", info.Mode(), err)
+	}
+}
+
+func TestFSOpsChmodRenameSymlink(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "bin", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "bin", "sub", "run"), []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, rpcErr := HandleChmod(ctx, ChmodParams{Path: "bin", Mode: 0o750, Recursive: true}, ws); rpcErr != nil {
+		t.Fatalf("HandleChmod: %v", rpcErr)
+	}
+	for _, p := range []string{"bin", "bin/sub", "bin/sub/run"} {
+		if info, err := os.Stat(filepath.Join(root, p)); err != nil || info.Mode().Perm() != 0o750 {
+			t.Fatalf("%s mode = %v, %v", p, info.Mode(), err)
+		}
+	}
+
+	if _, rpcErr := HandleSymlink(ctx, SymlinkParams{Path: "links/run", Target: "../bin/sub/run"}, ws); rpcErr != nil {
+		t.Fatalf("HandleSymlink: %v", rpcErr)
+	}
+	link, rpcErr := HandleReadlink(ctx, ReadlinkParams{Path: "links/run"}, ws)
+	if rpcErr != nil || link.Target != "../bin/sub/run" {
+		t.Fatalf("HandleReadlink = %+v, %v", link, rpcErr)
+	}
+	if _, rpcErr := HandleReadlink(ctx, ReadlinkParams{Path: "bin/sub/run"}, ws); rpcErr == nil {
+		t.Fatal("expected readlink of a regular file to fail")
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "taken"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, rpcErr := HandleRename(ctx, RenameParams{Path: "bin/sub/run", NewPath: "taken"}, ws); rpcErr == nil {
+		t.Fatal("expected rename onto an existing file to need overwrite")
+	}
+	if _, rpcErr := HandleRename(ctx, RenameParams{Path: "bin/sub/run", NewPath: "taken", Overwrite: true}, ws); rpcErr != nil {
+		t.Fatalf("HandleRename: %v", rpcErr)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "taken")); err != nil || string(data) != "#!/bin/sh\n" {
+		t.Fatalf("renamed file = %q, %v", data, err)
+	}
+}
+
+func TestFSCopyTreeAndStat(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	if err := os.MkdirAll(filepath.Join(src, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "nested", "a.sh"), []byte("echo a\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nested/a.sh", filepath.Join(src, "a-link")); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "nested", "a.sh"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, rpcErr := HandleCopy(ctx, CopyParams{Path: "src", NewPath: "dst"}, ws); rpcErr == nil {
+		t.Fatal("expected copying a directory to need recursive")
+	}
+	if _, rpcErr := HandleCopy(ctx, CopyParams{Path: "src", NewPath: "src/inner", Recursive: true}, ws); rpcErr == nil {
+		t.Fatal("expected copying a directory into itself to be refused")
+	}
+	copied, rpcErr := HandleCopy(ctx, CopyParams{Path: "src", NewPath: "dst", Recursive: true}, ws)
+	if rpcErr != nil || copied.Files != 1 || copied.Bytes != 7 {
+		t.Fatalf("HandleCopy = %+v, %v", copied, rpcErr)
+	}
+	if target, err := os.Readlink(filepath.Join(root, "dst", "a-link")); err != nil || target != "nested/a.sh" {
+		t.Fatalf("copied link = %q, %v", target, err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected no staging leftovers, got %v", entries)
+	}
+
+	stat, rpcErr := HandleStat(ctx, StatParams{Path: "dst/a-link", Hash: true}, ws)
+	if rpcErr != nil {
+		t.Fatalf("HandleStat: %v", rpcErr)
+	}
+	sum := sha256.Sum256([]byte("echo a\n"))
+	got := stat.Stats
+	if !got.IsFile || !got.IsSymbolicLink || got.Target != "nested/a.sh" || got.Mode&0o777 != 0o755 ||
+		got.MtimeMs != mtime.UnixMilli() || got.Hash != hex.EncodeToString(sum[:]) || got.UID != os.Getuid() {
+		t.Fatalf("unexpected stats %+v", got)
+	}
+
+	if _, rpcErr := HandleCopy(ctx, CopyParams{Path: "dst/nested/a.sh", NewPath: "src/nested/a.sh"}, ws); rpcErr == nil {
+		t.Fatal("expected copy onto an existing file to need overwrite")
+	}
+	if _, rpcErr := HandleCopy(ctx, CopyParams{Path: "dst/a-link", NewPath: "src/nested/a.sh", Overwrite: true}, ws); rpcErr != nil {
+		t.Fatalf("HandleCopy overwrite: %v", rpcErr)
+	}
+	if info, err := os.Lstat(filepath.Join(src, "nested", "a.sh")); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected the destination to be replaced by the link, got %v, %v", info, err)
+	}
+}
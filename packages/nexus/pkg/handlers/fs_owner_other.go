@@ -0,0 +1,9 @@
+//go:build !unix
+
+package handlers
+
+import "io/fs"
+
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return -1, -1, false
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filepatch"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+type ApplyPatchParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	// Patch is a unified diff; Edits are applied along with it.
+	Patch  string           `json:"patch,omitempty"`
+	Edits  []filepatch.Edit `json:"edits,omitempty"`
+	DryRun bool             `json:"dryRun,omitempty"`
+}
+
+type ApplyPatchResult struct {
+	filepatch.Result
+}
+
+// HandleApplyPatch applies a patch and edits to the workspace all or
+// nothing. Conflicts are reported per file in the result rather than as an
+// error, so a caller can show them all at once.
+func HandleApplyPatch(ctx context.Context, p ApplyPatchParams, ws *workspace.Workspace) (*ApplyPatchResult, *rpckit.RPCError) {
+	if p.Patch == "" && len(p.Edits) == 0 {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "patch or edits required"}
+	}
+	var patches []filepatch.FilePatch
+	if p.Patch != "" {
+		parsed, err := filepatch.ParseUnified(p.Patch)
+		if err != nil {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+		}
+		patches = parsed
+	}
+	// Files are read through their links, so a link that leaves the
+	// workspace is refused as well as a parent directory that does.
+	resolve := func(path string) (string, error) { return ws.ContainedPath(path, true) }
+	result, err := filepatch.Apply(resolve, patches, p.Edits, p.DryRun)
+	if err != nil {
+		var pathErr *filepatch.PathError
+		var editErr *filepatch.EditError
+		switch {
+		case errors.As(err, &pathErr):
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidPath.Code, Message: pathErr.Error()}
+		case errors.As(err, &editErr):
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: editErr.Error()}
+		}
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: err.Error()}
+	}
+	return &ApplyPatchResult{Result: *result}, nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filepatch"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+func TestApplyPatchRefusesSymlinkedParents(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "ws")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{root, outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target := filepath.Join(outside, "file")
+	if err := os.WriteFile(target, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "new\n"
+	for _, p := range []ApplyPatchParams{
+		{Patch: "--- a/link/file\n+++ b/link/file\n@@ -1 +1 @@\n-old\n+new\n"},
+		{Edits: []filepatch.Edit{{Path: "link/file", Content: &content}}},
+	} {
+		_, rpcErr := HandleApplyPatch(context.Background(), p, ws)
+		if rpcErr == nil || rpcErr.Code != rpckit.ErrInvalidPath.Code {
+			t.Fatalf("expected the symlinked parent to be refused, got %v", rpcErr)
+		}
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "old\n" {
+		t.Fatalf("file outside the workspace changed: %q, %v", data, err)
+	}
+}
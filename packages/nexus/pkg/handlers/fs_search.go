@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filesearch"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+type FindParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	filesearch.FindOptions
+}
+
+type FindResult struct {
+	Matches []filesearch.FindMatch `json:"matches"`
+	Path    string                 `json:"path"`
+	filesearch.FindStats
+}
+
+type GrepParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	filesearch.GrepOptions
+	// Stream sends matches as fs.grep.match notifications instead of in the
+	// result.
+	Stream bool `json:"stream,omitempty"`
+}
+
+type GrepResult struct {
+	Matches  []filesearch.GrepMatch `json:"matches"`
+	Path     string                 `json:"path"`
+	StreamID string                 `json:"streamId,omitempty"`
+	filesearch.GrepStats
+}
+
+// ValidateFind checks the options of fs.find before any work starts.
+func ValidateFind(p FindParams) *rpckit.RPCError {
+	switch p.Type {
+	case "", "file", "dir":
+		return nil
+	}
+	return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "type must be file or dir"}
+}
+
+// ValidateGrep checks the pattern of fs.grep before any work starts.
+func ValidateGrep(p GrepParams) *rpckit.RPCError {
+	if _, err := filesearch.CompileGrep(p.GrepOptions); err != nil {
+		return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	return nil
+}
+
+func HandleFind(ctx context.Context, p FindParams, ws *workspace.Workspace) (*FindResult, *rpckit.RPCError) {
+	if rpcErr := ValidateFind(p); rpcErr != nil {
+		return nil, rpcErr
+	}
+	rel, rpcErr := searchStart(ws, p.Path)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	result := &FindResult{Matches: []filesearch.FindMatch{}, Path: p.Path}
+	stats, err := filesearch.Find(ctx, ws.Path(), rel, p.FindOptions, func(m filesearch.FindMatch) {
+		result.Matches = append(result.Matches, m)
+	})
+	if err != nil {
+		return nil, SearchRPCError(err)
+	}
+	result.FindStats = stats
+	return result, nil
+}
+
+// HandleGrep searches file contents. When emit is set matches go to it as
+// they are found and the result only carries the stats.
+func HandleGrep(ctx context.Context, p GrepParams, ws *workspace.Workspace, emit func(filesearch.GrepMatch)) (*GrepResult, *rpckit.RPCError) {
+	if rpcErr := ValidateGrep(p); rpcErr != nil {
+		return nil, rpcErr
+	}
+	rel, rpcErr := searchStart(ws, p.Path)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	result := &GrepResult{Matches: []filesearch.GrepMatch{}, Path: p.Path}
+	if emit == nil {
+		emit = func(m filesearch.GrepMatch) { result.Matches = append(result.Matches, m) }
+	}
+	stats, err := filesearch.Grep(ctx, ws.Path(), rel, p.GrepOptions, emit)
+	if err != nil {
+		return nil, SearchRPCError(err)
+	}
+	result.GrepStats = stats
+	return result, nil
+}
+
+// searchStart resolves the directory a search starts from, relative to the
+// workspace root.
+func searchStart(ws *workspace.Workspace, path string) (string, *rpckit.RPCError) {
+	safePath, err := ws.ContainedPath(path, true)
+	if err != nil {
+		return "", rpckit.ErrInvalidPath
+	}
+	rel, err := filepath.Rel(ws.Path(), safePath)
+	if err != nil {
+		return "", rpckit.ErrInvalidPath
+	}
+	return rel, nil
+}
+
+// SearchRPCError maps a failed search to an RPC error.
+func SearchRPCError(err error) *rpckit.RPCError {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return rpckit.ErrFileNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return rpckit.ErrTimeout
+	}
+	return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: err.Error()}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filewatch"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+type WatchParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	filewatch.Options
+}
+
+type WatchResult struct {
+	WatchID string `json:"watchId"`
+	Path    string `json:"path"`
+}
+
+type UnwatchParams struct {
+	WatchID string `json:"watchId"`
+}
+
+// StartWatch starts watching p.Path in the workspace. The caller runs the
+// returned watcher.
+func StartWatch(p WatchParams, ws *workspace.Workspace) (*filewatch.Watcher, *rpckit.RPCError) {
+	rel, rpcErr := searchStart(ws, p.Path)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	w, err := filewatch.New(ws.Path(), rel, p.Options)
+	if err != nil {
+		return nil, WatchRPCError(err)
+	}
+	return w, nil
+}
+
+// WatchRPCError maps a failure to start a watch to an RPC error.
+func WatchRPCError(err error) *rpckit.RPCError {
+	if errors.Is(err, os.ErrNotExist) {
+		return rpckit.ErrFileNotFound
+	}
+	return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: err.Error()}
+}
@@ -1,9 +1,7 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
-	"os/exec"
 	"strings"
 
 	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
@@ -26,27 +24,15 @@ func HandleGitCommand(ctx context.Context, p GitCommandParams, ws *workspace.Wor
 		return nil, rpckit.ErrInvalidParams
 	}
 
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Dir = ws.Path()
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
-	exitCode := 0
+	res, err := runGit(ctx, ws.Path(), nil, args...)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			return nil, rpckit.ErrInternalError
-		}
+		return nil, rpckit.ErrInternalError
 	}
 
 	return map[string]interface{}{
-		"stdout":    strings.TrimSuffix(stdout.String(), "\n"),
-		"stderr":    strings.TrimSuffix(stderr.String(), "\n"),
-		"exit_code": exitCode,
+		"stdout":    strings.TrimSuffix(res.stdout, "\n"),
+		"stderr":    strings.TrimSuffix(res.stderr, "\n"),
+		"exit_code": res.exitCode,
 		"action":    p.Action,
 	}, nil
 }
@@ -0,0 +1,1113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/authrelay"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/safeenv"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+const (
+	defaultGitLogLimit = 50
+	maxGitLogLimit     = 500
+)
+
+type GitStatusParams struct {
+	WorkspaceID      string `json:"workspaceId,omitempty"`
+	IncludeIgnored   bool   `json:"includeIgnored,omitempty"`
+	UntrackedDisable bool   `json:"untrackedDisable,omitempty"`
+}
+
+type GitBranchStatus struct {
+	Head     string `json:"head"`
+	OID      string `json:"oid,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	Detached bool   `json:"detached"`
+}
+
+type GitFileStatus struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"origPath,omitempty"`
+	Kind     string `json:"kind"`
+	Index    string `json:"index"`
+	Worktree string `json:"worktree"`
+	Staged   bool   `json:"staged"`
+	Unstaged bool   `json:"unstaged"`
+	Score    string `json:"score,omitempty"`
+}
+
+type GitStatusResult struct {
+	Branch GitBranchStatus `json:"branch"`
+	Files  []GitFileStatus `json:"files"`
+	Clean  bool            `json:"clean"`
+}
+
+type GitDiffParams struct {
+	WorkspaceID string   `json:"workspaceId,omitempty"`
+	Ref         string   `json:"ref,omitempty"`
+	Target      string   `json:"target,omitempty"`
+	Staged      bool     `json:"staged,omitempty"`
+	Stat        bool     `json:"stat,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+	Context     *int     `json:"context,omitempty"`
+}
+
+type GitDiffLine struct {
+	Kind    string `json:"kind"`
+	Content string `json:"content"`
+	OldLine int    `json:"oldLine,omitempty"`
+	NewLine int    `json:"newLine,omitempty"`
+}
+
+type GitDiffHunk struct {
+	Header   string        `json:"header"`
+	OldStart int           `json:"oldStart"`
+	OldLines int           `json:"oldLines"`
+	NewStart int           `json:"newStart"`
+	NewLines int           `json:"newLines"`
+	Lines    []GitDiffLine `json:"lines"`
+}
+
+type GitDiffFile struct {
+	Path      string        `json:"path"`
+	OldPath   string        `json:"oldPath,omitempty"`
+	Status    string        `json:"status"`
+	Binary    bool          `json:"binary"`
+	Additions int           `json:"additions"`
+	Deletions int           `json:"deletions"`
+	Hunks     []GitDiffHunk `json:"hunks,omitempty"`
+}
+
+type GitDiffResult struct {
+	Files     []GitDiffFile `json:"files"`
+	Additions int           `json:"additions"`
+	Deletions int           `json:"deletions"`
+}
+
+type GitLogParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Ref         string `json:"ref,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+	Skip        int    `json:"skip,omitempty"`
+}
+
+type GitCommit struct {
+	Hash           string   `json:"hash"`
+	ShortHash      string   `json:"shortHash"`
+	Parents        []string `json:"parents"`
+	AuthorName     string   `json:"authorName"`
+	AuthorEmail    string   `json:"authorEmail"`
+	AuthorDate     string   `json:"authorDate"`
+	CommitterName  string   `json:"committerName"`
+	CommitterEmail string   `json:"committerEmail"`
+	CommitterDate  string   `json:"committerDate"`
+	Subject        string   `json:"subject"`
+	Body           string   `json:"body,omitempty"`
+}
+
+type GitLogResult struct {
+	Commits  []GitCommit `json:"commits"`
+	HasMore  bool        `json:"hasMore"`
+	NextSkip int         `json:"nextSkip"`
+}
+
+type GitBranchesParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Remote      bool   `json:"remote,omitempty"`
+}
+
+type GitBranch struct {
+	Name     string `json:"name"`
+	Ref      string `json:"ref"`
+	Commit   string `json:"commit"`
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	Gone     bool   `json:"gone,omitempty"`
+	Current  bool   `json:"current"`
+	Remote   bool   `json:"remote"`
+}
+
+type GitBranchesResult struct {
+	Branches []GitBranch `json:"branches"`
+	Current  string      `json:"current,omitempty"`
+}
+
+type GitStashParams struct {
+	WorkspaceID      string `json:"workspaceId,omitempty"`
+	Action           string `json:"action"`
+	Message          string `json:"message,omitempty"`
+	IncludeUntracked bool   `json:"includeUntracked,omitempty"`
+	Index            int    `json:"index,omitempty"`
+}
+
+type GitStashEntry struct {
+	Index   int    `json:"index"`
+	Ref     string `json:"ref"`
+	Commit  string `json:"commit"`
+	Message string `json:"message"`
+	Date    string `json:"date"`
+}
+
+type GitStashResult struct {
+	Action  string          `json:"action"`
+	Entries []GitStashEntry `json:"entries,omitempty"`
+	Output  string          `json:"output,omitempty"`
+}
+
+type GitRemoteParams struct {
+	WorkspaceID    string `json:"workspaceId,omitempty"`
+	Remote         string `json:"remote,omitempty"`
+	Refspec        string `json:"refspec,omitempty"`
+	Prune          bool   `json:"prune,omitempty"`
+	Force          bool   `json:"force,omitempty"`
+	SetUpstream    bool   `json:"setUpstream,omitempty"`
+	Tags           bool   `json:"tags,omitempty"`
+	AuthRelayToken string `json:"authRelayToken,omitempty"`
+}
+
+type GitRemoteResult struct {
+	OK     bool   `json:"ok"`
+	Remote string `json:"remote"`
+	Output string `json:"output,omitempty"`
+}
+
+type GitBlameParams struct {
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	Path        string `json:"path"`
+	Ref         string `json:"ref,omitempty"`
+	StartLine   int    `json:"startLine,omitempty"`
+	EndLine     int    `json:"endLine,omitempty"`
+}
+
+type GitBlameLine struct {
+	Line        int    `json:"line"`
+	Commit      string `json:"commit"`
+	Author      string `json:"author"`
+	AuthorEmail string `json:"authorEmail"`
+	AuthorTime  int64  `json:"authorTime"`
+	Summary     string `json:"summary"`
+	Content     string `json:"content"`
+}
+
+type GitBlameResult struct {
+	Path  string         `json:"path"`
+	Lines []GitBlameLine `json:"lines"`
+}
+
+type gitRunResult struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+func runGit(ctx context.Context, dir string, env []string, args ...string) (gitRunResult, error) {
+	return runGitWithStdin(ctx, dir, env, "", args...)
+}
+
+func runGitWithStdin(ctx context.Context, dir string, env []string, stdin string, args ...string) (gitRunResult, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if env != nil {
+		cmd.Env = env
+	}
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	res := gitRunResult{stdout: stdout.String(), stderr: stderr.String()}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			res.exitCode = exitErr.ExitCode()
+			return res, nil
+		}
+		return res, err
+	}
+	return res, nil
+}
+
+func gitOutput(ctx context.Context, ws *workspace.Workspace, op string, args ...string) (string, *rpckit.RPCError) {
+	return gitOutputAt(ctx, ws.Path(), op, args...)
+}
+
+func gitOutputAt(ctx context.Context, dir string, op string, args ...string) (string, *rpckit.RPCError) {
+	res, err := runGit(ctx, dir, nil, args...)
+	if err != nil {
+		return "", rpckit.ErrInternalError
+	}
+	if res.exitCode != 0 {
+		return "", gitFailure(op, res)
+	}
+	return res.stdout, nil
+}
+
+func gitFailure(op string, res gitRunResult) *rpckit.RPCError {
+	msg := strings.TrimSpace(res.stderr)
+	if msg == "" {
+		msg = strings.TrimSpace(res.stdout)
+	}
+	return &rpckit.RPCError{
+		Code:    rpckit.ErrInternalError.Code,
+		Message: fmt.Sprintf("git %s failed: %s", op, msg),
+		Data:    map[string]any{"exitCode": res.exitCode},
+	}
+}
+
+// gitPathspec validates user-supplied paths against the workspace root and
+// returns them relative to it so they can be passed after "--".
+func gitPathspec(ws *workspace.Workspace, paths []string) ([]string, *rpckit.RPCError) {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		safePath, err := ws.SecurePath(p)
+		if err != nil {
+			return nil, rpckit.ErrInvalidPath
+		}
+		rel, err := filepath.Rel(ws.Path(), safePath)
+		if err != nil {
+			return nil, rpckit.ErrInvalidPath
+		}
+		out = append(out, filepath.ToSlash(rel))
+	}
+	return out, nil
+}
+
+// validGitRef accepts a single ref or revision. It rejects anything git
+// would read as an option, and refspec syntax: a leading "+" forces an
+// update past --force-with-lease, and "src:dst" can delete or write an
+// arbitrary remote ref.
+func validGitRef(ref string) bool {
+	ref = strings.TrimSpace(ref)
+	return ref != "" && !strings.HasPrefix(ref, "-") && !strings.HasPrefix(ref, "+") && !strings.Contains(ref, ":")
+}
+
+func HandleGitStatus(ctx context.Context, p GitStatusParams, ws *workspace.Workspace) (*GitStatusResult, *rpckit.RPCError) {
+	args := []string{"status", "--porcelain=v2", "--branch", "-z"}
+	if p.IncludeIgnored {
+		args = append(args, "--ignored")
+	}
+	if p.UntrackedDisable {
+		args = append(args, "--untracked-files=no")
+	}
+	out, rpcErr := gitOutput(ctx, ws, "status", args...)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	result := parseGitStatusV2(out)
+	return result, nil
+}
+
+func parseGitStatusV2(out string) *GitStatusResult {
+	result := &GitStatusResult{Files: []GitFileStatus{}}
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		rec := records[i]
+		if rec == "" {
+			continue
+		}
+		switch rec[0] {
+		case '#':
+			parseGitStatusHeader(&result.Branch, rec)
+		case '1':
+			// 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+			fields := strings.SplitN(rec, " ", 9)
+			if len(fields) < 9 {
+				continue
+			}
+			result.Files = append(result.Files, newGitFileStatus("ordinary", fields[1], fields[8]))
+		case '2':
+			// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>\0<origPath>
+			fields := strings.SplitN(rec, " ", 10)
+			if len(fields) < 10 {
+				continue
+			}
+			entry := newGitFileStatus("renamed", fields[1], fields[9])
+			entry.Score = fields[8]
+			if strings.HasPrefix(fields[8], "C") {
+				entry.Kind = "copied"
+			}
+			if i+1 < len(records) {
+				entry.OrigPath = records[i+1]
+				i++
+			}
+			result.Files = append(result.Files, entry)
+		case 'u':
+			// u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+			fields := strings.SplitN(rec, " ", 11)
+			if len(fields) < 11 {
+				continue
+			}
+			result.Files = append(result.Files, newGitFileStatus("unmerged", fields[1], fields[10]))
+		case '?':
+			result.Files = append(result.Files, GitFileStatus{
+				Path:     strings.TrimPrefix(rec, "? "),
+				Kind:     "untracked",
+				Index:    "untracked",
+				Worktree: "untracked",
+				Unstaged: true,
+			})
+		case '!':
+			result.Files = append(result.Files, GitFileStatus{
+				Path:     strings.TrimPrefix(rec, "! "),
+				Kind:     "ignored",
+				Index:    "ignored",
+				Worktree: "ignored",
+			})
+		}
+	}
+	result.Clean = true
+	for _, f := range result.Files {
+		if f.Kind != "ignored" {
+			result.Clean = false
+			break
+		}
+	}
+	return result
+}
+
+func parseGitStatusHeader(branch *GitBranchStatus, rec string) {
+	fields := strings.Fields(rec)
+	if len(fields) < 3 {
+		return
+	}
+	switch fields[1] {
+	case "branch.oid":
+		if fields[2] != "(initial)" {
+			branch.OID = fields[2]
+		}
+	case "branch.head":
+		branch.Head = fields[2]
+		branch.Detached = fields[2] == "(detached)"
+	case "branch.upstream":
+		branch.Upstream = fields[2]
+	case "branch.ab":
+		if len(fields) >= 4 {
+			branch.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+			branch.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+		}
+	}
+}
+
+func newGitFileStatus(kind, xy, path string) GitFileStatus {
+	x, y := byte('.'), byte('.')
+	if len(xy) >= 2 {
+		x, y = xy[0], xy[1]
+	}
+	return GitFileStatus{
+		Path:     path,
+		Kind:     kind,
+		Index:    gitStatusCodeName(x),
+		Worktree: gitStatusCodeName(y),
+		Staged:   x != '.',
+		Unstaged: y != '.',
+	}
+}
+
+func gitStatusCodeName(code byte) string {
+	switch code {
+	case 'M':
+		return "modified"
+	case 'T':
+		return "typechange"
+	case 'A':
+		return "added"
+	case 'D':
+		return "deleted"
+	case 'R':
+		return "renamed"
+	case 'C':
+		return "copied"
+	case 'U':
+		return "unmerged"
+	default:
+		return "unmodified"
+	}
+}
+
+func HandleGitDiff(ctx context.Context, p GitDiffParams, ws *workspace.Workspace) (*GitDiffResult, *rpckit.RPCError) {
+	args, rpcErr := gitDiffArgs(p, ws)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	numstatArgs := append([]string{"diff", "--numstat", "-z", "-M"}, args...)
+	numstatOut, rpcErr := gitOutput(ctx, ws, "diff", numstatArgs...)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	files := parseGitNumstat(numstatOut)
+
+	if !p.Stat {
+		patchArgs := []string{"diff", "--no-color", "--no-ext-diff", "-M"}
+		if p.Context != nil && *p.Context >= 0 {
+			patchArgs = append(patchArgs, fmt.Sprintf("-U%d", *p.Context))
+		}
+		patchOut, rpcErr := gitOutput(ctx, ws, "diff", append(patchArgs, args...)...)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		files = mergeGitPatch(files, parseGitPatch(patchOut))
+	}
+
+	result := &GitDiffResult{Files: files}
+	for _, f := range files {
+		result.Additions += f.Additions
+		result.Deletions += f.Deletions
+	}
+	return result, nil
+}
+
+func gitDiffArgs(p GitDiffParams, ws *workspace.Workspace) ([]string, *rpckit.RPCError) {
+	args := make([]string, 0, 4)
+	if p.Staged {
+		args = append(args, "--cached")
+	}
+	if strings.TrimSpace(p.Ref) != "" {
+		if !validGitRef(p.Ref) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		args = append(args, strings.TrimSpace(p.Ref))
+	}
+	if strings.TrimSpace(p.Target) != "" {
+		if strings.TrimSpace(p.Ref) == "" || p.Staged || !validGitRef(p.Target) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		args = append(args, strings.TrimSpace(p.Target))
+	}
+	paths, rpcErr := gitPathspec(ws, p.Paths)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	args = append(args, "--")
+	args = append(args, paths...)
+	return args, nil
+}
+
+// parseGitNumstat parses `git diff --numstat -z`. Renamed entries are
+// emitted as "add\tdel\t\0old\0new\0"; everything else as "add\tdel\tpath\0".
+func parseGitNumstat(out string) []GitDiffFile {
+	files := []GitDiffFile{}
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		rec := records[i]
+		if rec == "" {
+			continue
+		}
+		parts := strings.SplitN(rec, "\t", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		file := GitDiffFile{Status: "modified"}
+		if parts[0] == "-" && parts[1] == "-" {
+			file.Binary = true
+		} else {
+			file.Additions, _ = strconv.Atoi(parts[0])
+			file.Deletions, _ = strconv.Atoi(parts[1])
+		}
+		if parts[2] == "" {
+			if i+2 >= len(records) {
+				break
+			}
+			file.OldPath = records[i+1]
+			file.Path = records[i+2]
+			file.Status = "renamed"
+			i += 2
+		} else {
+			file.Path = parts[2]
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func parseGitPatch(out string) []GitDiffFile {
+	files := []GitDiffFile{}
+	var cur *GitDiffFile
+	var hunk *GitDiffHunk
+	oldLine, newLine := 0, 0
+
+	flushHunk := func() {
+		if cur != nil && hunk != nil {
+			cur.Hunks = append(cur.Hunks, *hunk)
+		}
+		hunk = nil
+	}
+	flushFile := func() {
+		flushHunk()
+		if cur != nil {
+			files = append(files, *cur)
+		}
+		cur = nil
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flushFile()
+			cur = &GitDiffFile{Status: "modified"}
+			if a, b, ok := splitGitDiffHeader(strings.TrimPrefix(line, "diff --git ")); ok {
+				cur.OldPath, cur.Path = a, b
+			}
+		case cur == nil:
+			continue
+		case hunk == nil && strings.HasPrefix(line, "new file mode"):
+			cur.Status = "added"
+		case hunk == nil && strings.HasPrefix(line, "deleted file mode"):
+			cur.Status = "deleted"
+		case hunk == nil && strings.HasPrefix(line, "rename from "):
+			cur.Status = "renamed"
+			cur.OldPath = unquoteGitPath(strings.TrimPrefix(line, "rename from "))
+		case hunk == nil && strings.HasPrefix(line, "rename to "):
+			cur.Path = unquoteGitPath(strings.TrimPrefix(line, "rename to "))
+		case hunk == nil && strings.HasPrefix(line, "Binary files "):
+			cur.Binary = true
+		case strings.HasPrefix(line, "@@ "):
+			flushHunk()
+			hunk = parseGitHunkHeader(line)
+			if hunk != nil {
+				oldLine, newLine = hunk.OldStart, hunk.NewStart
+			}
+		case hunk != nil && strings.HasPrefix(line, "+"):
+			hunk.Lines = append(hunk.Lines, GitDiffLine{Kind: "add", Content: line[1:], NewLine: newLine})
+			newLine++
+		case hunk != nil && strings.HasPrefix(line, "-"):
+			hunk.Lines = append(hunk.Lines, GitDiffLine{Kind: "delete", Content: line[1:], OldLine: oldLine})
+			oldLine++
+		case hunk != nil && strings.HasPrefix(line, " "):
+			hunk.Lines = append(hunk.Lines, GitDiffLine{Kind: "context", Content: line[1:], OldLine: oldLine, NewLine: newLine})
+			oldLine++
+			newLine++
+		case hunk != nil && strings.HasPrefix(line, `\`):
+			hunk.Lines = append(hunk.Lines, GitDiffLine{Kind: "meta", Content: line})
+		}
+	}
+	flushFile()
+
+	for i := range files {
+		if files[i].Status != "renamed" && files[i].OldPath == files[i].Path {
+			files[i].OldPath = ""
+		}
+	}
+	return files
+}
+
+// splitGitDiffHeader returns the paths of a "diff --git a/<old> b/<new>"
+// header. Git C-quotes a path with special characters. Bare paths may hold
+// " b/" themselves, so when both sides name the same file the header is
+// split in the middle.
+func splitGitDiffHeader(rest string) (string, string, bool) {
+	var a, b string
+	if strings.HasPrefix(rest, `"`) {
+		path, tail, ok := cutGitQuotedPath(rest)
+		if !ok || !strings.HasPrefix(tail, " ") {
+			return "", "", false
+		}
+		a, b = path, unquoteGitPath(tail[1:])
+	} else if idx := strings.Index(rest, ` "`); idx >= 0 {
+		a, b = rest[:idx], unquoteGitPath(rest[idx+1:])
+	} else {
+		idx := strings.Index(rest, " b/")
+		if n := len(rest); n%2 == 1 && strings.HasPrefix(rest[n/2:], " b/") && strings.HasPrefix(rest, "a/") && rest[2:n/2] == rest[n/2+3:] {
+			idx = n / 2
+		}
+		if idx < 0 {
+			return "", "", false
+		}
+		a, b = rest[:idx], rest[idx+1:]
+	}
+	if !strings.HasPrefix(a, "a/") || !strings.HasPrefix(b, "b/") {
+		return "", "", false
+	}
+	return a[2:], b[2:], true
+}
+
+// unquoteGitPath returns path with git's C-style quoting removed, or path
+// itself when it is not quoted.
+func unquoteGitPath(path string) string {
+	if !strings.HasPrefix(path, `"`) {
+		return path
+	}
+	unquoted, tail, ok := cutGitQuotedPath(path)
+	if !ok || tail != "" {
+		return path
+	}
+	return unquoted
+}
+
+// cutGitQuotedPath unquotes the quoted path at the start of s and returns
+// the text after it. Git's escapes (\t, \", \\, octal bytes and so on)
+// are a subset of Go's, so strconv.Unquote decodes them.
+func cutGitQuotedPath(s string) (string, string, bool) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			path, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", false
+			}
+			return path, s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+func parseGitHunkHeader(line string) *GitDiffHunk {
+	end := strings.Index(line[3:], " @@")
+	if end < 0 {
+		return nil
+	}
+	ranges := strings.Fields(line[3 : 3+end])
+	if len(ranges) != 2 {
+		return nil
+	}
+	h := &GitDiffHunk{Header: line, Lines: []GitDiffLine{}}
+	h.OldStart, h.OldLines = parseGitHunkRange(strings.TrimPrefix(ranges[0], "-"))
+	h.NewStart, h.NewLines = parseGitHunkRange(strings.TrimPrefix(ranges[1], "+"))
+	return h
+}
+
+func parseGitHunkRange(r string) (int, int) {
+	start, count := r, "1"
+	if idx := strings.IndexByte(r, ','); idx >= 0 {
+		start, count = r[:idx], r[idx+1:]
+	}
+	s, _ := strconv.Atoi(start)
+	c, _ := strconv.Atoi(count)
+	return s, c
+}
+
+func mergeGitPatch(stats []GitDiffFile, patches []GitDiffFile) []GitDiffFile {
+	byPath := make(map[string]GitDiffFile, len(patches))
+	for _, p := range patches {
+		byPath[p.Path] = p
+	}
+	for i := range stats {
+		patch, ok := byPath[stats[i].Path]
+		if !ok {
+			continue
+		}
+		stats[i].Hunks = patch.Hunks
+		if patch.Status != "modified" {
+			stats[i].Status = patch.Status
+		}
+		if patch.OldPath != "" {
+			stats[i].OldPath = patch.OldPath
+		}
+		stats[i].Binary = stats[i].Binary || patch.Binary
+	}
+	return stats
+}
+
+func HandleGitLog(ctx context.Context, p GitLogParams, ws *workspace.Workspace) (*GitLogResult, *rpckit.RPCError) {
+	limit := p.Limit
+	if limit <= 0 {
+		limit = defaultGitLogLimit
+	}
+	if limit > maxGitLogLimit {
+		limit = maxGitLogLimit
+	}
+	if p.Skip < 0 {
+		return nil, rpckit.ErrInvalidParams
+	}
+
+	// Fields are separated by US (0x1f) and records by RS (0x1e) so that
+	// commit bodies containing newlines survive parsing.
+	format := "%H%x1f%h%x1f%P%x1f%an%x1f%ae%x1f%aI%x1f%cn%x1f%ce%x1f%cI%x1f%s%x1f%b%x1e"
+	args := []string{"log", "--format=" + format, fmt.Sprintf("--max-count=%d", limit+1), fmt.Sprintf("--skip=%d", p.Skip)}
+	if ref := strings.TrimSpace(p.Ref); ref != "" {
+		if !validGitRef(ref) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		args = append(args, ref)
+	}
+	args = append(args, "--")
+	if p.Path != "" {
+		paths, rpcErr := gitPathspec(ws, []string{p.Path})
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		args = append(args, paths...)
+	}
+
+	out, rpcErr := gitOutput(ctx, ws, "log", args...)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	commits := parseGitLog(out)
+	result := &GitLogResult{Commits: commits, NextSkip: p.Skip + len(commits)}
+	if len(commits) > limit {
+		result.Commits = commits[:limit]
+		result.HasMore = true
+		result.NextSkip = p.Skip + limit
+	}
+	return result, nil
+}
+
+func parseGitLog(out string) []GitCommit {
+	commits := []GitCommit{}
+	for _, rec := range strings.Split(out, "\x1e") {
+		rec = strings.TrimLeft(rec, "\n")
+		if rec == "" {
+			continue
+		}
+		f := strings.Split(rec, "\x1f")
+		if len(f) < 11 {
+			continue
+		}
+		parents := strings.Fields(f[2])
+		if parents == nil {
+			parents = []string{}
+		}
+		commits = append(commits, GitCommit{
+			Hash:           f[0],
+			ShortHash:      f[1],
+			Parents:        parents,
+			AuthorName:     f[3],
+			AuthorEmail:    f[4],
+			AuthorDate:     f[5],
+			CommitterName:  f[6],
+			CommitterEmail: f[7],
+			CommitterDate:  f[8],
+			Subject:        f[9],
+			Body:           strings.TrimSpace(f[10]),
+		})
+	}
+	return commits
+}
+
+func HandleGitBranches(ctx context.Context, p GitBranchesParams, ws *workspace.Workspace) (*GitBranchesResult, *rpckit.RPCError) {
+	format := "%(HEAD)%1f%(refname)%1f%(refname:short)%1f%(objectname)%1f%(upstream:short)%1f%(upstream:track,nobracket)"
+	args := []string{"for-each-ref", "--format=" + format, "refs/heads"}
+	if p.Remote {
+		args = append(args, "refs/remotes")
+	}
+	out, rpcErr := gitOutput(ctx, ws, "branches", args...)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	result := &GitBranchesResult{Branches: []GitBranch{}}
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(line, "\x1f")
+		if len(f) < 6 {
+			continue
+		}
+		if strings.HasSuffix(f[1], "/HEAD") {
+			continue
+		}
+		b := GitBranch{
+			Name:     f[2],
+			Ref:      f[1],
+			Commit:   f[3],
+			Upstream: f[4],
+			Current:  f[0] == "*",
+			Remote:   strings.HasPrefix(f[1], "refs/remotes/"),
+		}
+		b.Ahead, b.Behind, b.Gone = parseGitTrack(f[5])
+		if b.Current {
+			result.Current = b.Name
+		}
+		result.Branches = append(result.Branches, b)
+	}
+	return result, nil
+}
+
+func parseGitTrack(track string) (ahead, behind int, gone bool) {
+	if track == "gone" {
+		return 0, 0, true
+	}
+	for _, part := range strings.Split(track, ",") {
+		fields := strings.Fields(part)
+		if len(fields) != 2 {
+			continue
+		}
+		n, _ := strconv.Atoi(fields[1])
+		switch fields[0] {
+		case "ahead":
+			ahead = n
+		case "behind":
+			behind = n
+		}
+	}
+	return ahead, behind, false
+}
+
+func HandleGitStash(ctx context.Context, p GitStashParams, ws *workspace.Workspace) (*GitStashResult, *rpckit.RPCError) {
+	if p.Index < 0 {
+		return nil, rpckit.ErrInvalidParams
+	}
+	switch p.Action {
+	case "list":
+		out, rpcErr := gitOutput(ctx, ws, "stash list", "stash", "list", "--format=%gd%x1f%H%x1f%gs%x1f%cI")
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return &GitStashResult{Action: p.Action, Entries: parseGitStashList(out)}, nil
+	case "push":
+		args := []string{"stash", "push"}
+		if p.IncludeUntracked {
+			args = append(args, "--include-untracked")
+		}
+		if strings.TrimSpace(p.Message) != "" {
+			args = append(args, "-m", p.Message)
+		}
+		out, rpcErr := gitOutput(ctx, ws, "stash push", args...)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return &GitStashResult{Action: p.Action, Output: strings.TrimSpace(out)}, nil
+	case "pop", "apply", "drop":
+		ref := fmt.Sprintf("stash@{%d}", p.Index)
+		out, rpcErr := gitOutput(ctx, ws, "stash "+p.Action, "stash", p.Action, ref)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return &GitStashResult{Action: p.Action, Output: strings.TrimSpace(out)}, nil
+	default:
+		return nil, rpckit.ErrInvalidParams
+	}
+}
+
+func parseGitStashList(out string) []GitStashEntry {
+	entries := []GitStashEntry{}
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(line, "\x1f")
+		if len(f) < 4 {
+			continue
+		}
+		idx := -1
+		if open, close := strings.IndexByte(f[0], '{'), strings.IndexByte(f[0], '}'); open >= 0 && close > open {
+			idx, _ = strconv.Atoi(f[0][open+1 : close])
+		}
+		entries = append(entries, GitStashEntry{
+			Index:   idx,
+			Ref:     f[0],
+			Commit:  f[1],
+			Message: f[2],
+			Date:    f[3],
+		})
+	}
+	return entries
+}
+
+func HandleGitFetch(ctx context.Context, p GitRemoteParams, ws *workspace.Workspace, broker *authrelay.Broker) (*GitRemoteResult, *rpckit.RPCError) {
+	remote, rpcErr := gitRemoteName(p)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	args := []string{"fetch"}
+	if p.Prune {
+		args = append(args, "--prune")
+	}
+	if p.Tags {
+		args = append(args, "--tags")
+	}
+	args = append(args, remote)
+	if p.Refspec != "" {
+		if !validGitRef(p.Refspec) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		args = append(args, p.Refspec)
+	}
+	return runGitRemote(ctx, p, ws, broker, "fetch", remote, args)
+}
+
+func HandleGitPush(ctx context.Context, p GitRemoteParams, ws *workspace.Workspace, broker *authrelay.Broker) (*GitRemoteResult, *rpckit.RPCError) {
+	remote, rpcErr := gitRemoteName(p)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	args := []string{"push", "--porcelain"}
+	if p.Force {
+		args = append(args, "--force-with-lease")
+	}
+	if p.SetUpstream {
+		args = append(args, "--set-upstream")
+	}
+	if p.Tags {
+		args = append(args, "--tags")
+	}
+	args = append(args, remote)
+	refspec := strings.TrimSpace(p.Refspec)
+	if refspec == "" {
+		refspec = "HEAD"
+	}
+	if !validGitRef(refspec) {
+		return nil, rpckit.ErrInvalidParams
+	}
+	args = append(args, refspec)
+	return runGitRemote(ctx, p, ws, broker, "push", remote, args)
+}
+
+func gitRemoteName(p GitRemoteParams) (string, *rpckit.RPCError) {
+	remote := strings.TrimSpace(p.Remote)
+	if remote == "" {
+		remote = "origin"
+	}
+	if strings.HasPrefix(remote, "-") {
+		return "", rpckit.ErrInvalidParams
+	}
+	return remote, nil
+}
+
+// runGitRemote runs a network git operation. When an auth relay token is
+// supplied the relayed secret is exposed to git through an inline credential
+// helper so it never appears on the command line or in the repo config.
+func runGitRemote(ctx context.Context, p GitRemoteParams, ws *workspace.Workspace, broker *authrelay.Broker, op, remote string, args []string) (*GitRemoteResult, *rpckit.RPCError) {
+	var injected map[string]string
+	if p.AuthRelayToken != "" {
+		if broker == nil {
+			return nil, rpckit.ErrAuthRelayInvalid
+		}
+		if p.WorkspaceID == "" {
+			return nil, rpckit.ErrInvalidParams
+		}
+		var ok bool
+		injected, ok = broker.Consume(p.AuthRelayToken, p.WorkspaceID)
+		if !ok {
+			return nil, rpckit.ErrAuthRelayInvalid
+		}
+	}
+	return runGitNetwork(ctx, ws.Path(), injected, op, remote, args)
+}
+
+// runGitNetwork runs git in dir with relayed credentials, if any, exposed
+// through the inline credential helper.
+func runGitNetwork(ctx context.Context, dir string, injected map[string]string, op, remote string, args []string) (*GitRemoteResult, *rpckit.RPCError) {
+	env := append(safeenv.Base(), "GIT_TERMINAL_PROMPT=0")
+	if injected != nil {
+		env = append(env, toEnvPairs(injected)...)
+		args = append([]string{
+			"-c", "credential.helper=",
+			"-c", "credential.helper=" + gitRelayCredentialHelper,
+		}, args...)
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, MaxTimeout)
+	defer cancel()
+
+	res, err := runGit(execCtx, dir, env, args...)
+	if execCtx.Err() == context.DeadlineExceeded {
+		return nil, rpckit.ErrTimeout
+	}
+	if err != nil {
+		return nil, rpckit.ErrInternalError
+	}
+	if res.exitCode != 0 {
+		return nil, gitFailure(op, res)
+	}
+	output := strings.TrimSpace(strings.TrimSpace(res.stdout) + "\n" + strings.TrimSpace(res.stderr))
+	return &GitRemoteResult{OK: true, Remote: remote, Output: output}, nil
+}
+
+const gitRelayCredentialHelper = `!f() { test "$1" = get || exit 0; echo "username=${NEXUS_AUTH_USERNAME:-x-access-token}"; echo "password=$NEXUS_AUTH_VALUE"; }; f`
+
+func HandleGitBlame(ctx context.Context, p GitBlameParams, ws *workspace.Workspace) (*GitBlameResult, *rpckit.RPCError) {
+	if strings.TrimSpace(p.Path) == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	paths, rpcErr := gitPathspec(ws, []string{p.Path})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if len(paths) == 0 {
+		return nil, rpckit.ErrInvalidParams
+	}
+	args := []string{"blame", "--porcelain"}
+	if p.StartLine > 0 {
+		end := ""
+		if p.EndLine >= p.StartLine {
+			end = strconv.Itoa(p.EndLine)
+		}
+		args = append(args, fmt.Sprintf("-L%d,%s", p.StartLine, end))
+	} else if p.EndLine > 0 {
+		return nil, rpckit.ErrInvalidParams
+	}
+	if ref := strings.TrimSpace(p.Ref); ref != "" {
+		if !validGitRef(ref) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		args = append(args, ref)
+	}
+	args = append(args, "--", paths[0])
+
+	out, rpcErr := gitOutput(ctx, ws, "blame", args...)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return &GitBlameResult{Path: paths[0], Lines: parseGitBlamePorcelain(out)}, nil
+}
+
+type gitBlameCommitInfo struct {
+	author      string
+	authorEmail string
+	authorTime  int64
+	summary     string
+}
+
+func parseGitBlamePorcelain(out string) []GitBlameLine {
+	lines := []GitBlameLine{}
+	commits := map[string]*gitBlameCommitInfo{}
+	var cur *GitBlameLine
+	var info *gitBlameCommitInfo
+
+	for _, line := range strings.Split(out, "\n") {
+		if cur == nil {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(fields[0]) < 40 {
+				continue
+			}
+			final, _ := strconv.Atoi(fields[2])
+			cur = &GitBlameLine{Commit: fields[0], Line: final}
+			info = commits[fields[0]]
+			if info == nil {
+				info = &gitBlameCommitInfo{}
+				commits[fields[0]] = info
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			cur.Content = line[1:]
+			cur.Author = info.author
+			cur.AuthorEmail = info.authorEmail
+			cur.AuthorTime = info.authorTime
+			cur.Summary = info.summary
+			lines = append(lines, *cur)
+			cur = nil
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			info.author = value
+		case "author-mail":
+			info.authorEmail = strings.Trim(value, "<>")
+		case "author-time":
+			info.authorTime, _ = strconv.ParseInt(value, 10, 64)
+		case "summary":
+			info.summary = value
+		}
+	}
+	return lines
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/authrelay"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+func runGitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeWorkspaceFile(t *testing.T, ws *workspace.Workspace, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(ws.Path(), name), []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func TestHandleGitStatus_ParsesPorcelainV2(t *testing.T) {
+	ws := createGitWorkspace(t)
+	writeWorkspaceFile(t, ws, "README.md", "hello\nworld\n")
+	writeWorkspaceFile(t, ws, "staged.txt", "staged\n")
+	writeWorkspaceFile(t, ws, "untracked.txt", "new\n")
+	runGitIn(t, ws.Path(), "add", "staged.txt")
+	runGitIn(t, ws.Path(), "mv", "README.md", "DOCS.md")
+
+	res, rpcErr := HandleGitStatus(context.Background(), GitStatusParams{}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if res.Clean {
+		t.Fatal("expected dirty status")
+	}
+	if res.Branch.Head == "" || res.Branch.OID == "" {
+		t.Fatalf("expected branch head and oid, got %+v", res.Branch)
+	}
+
+	byPath := map[string]GitFileStatus{}
+	for _, f := range res.Files {
+		byPath[f.Path] = f
+	}
+	if f := byPath["staged.txt"]; f.Index != "added" || !f.Staged {
+		t.Fatalf("expected staged.txt added in index, got %+v", f)
+	}
+	if f := byPath["untracked.txt"]; f.Kind != "untracked" {
+		t.Fatalf("expected untracked.txt untracked, got %+v", f)
+	}
+	renamed := byPath["DOCS.md"]
+	if renamed.Kind != "renamed" || renamed.OrigPath != "README.md" || renamed.Worktree != "modified" {
+		t.Fatalf("expected rename README.md -> DOCS.md with worktree change, got %+v", renamed)
+	}
+}
+
+func TestHandleGitDiff_HunksAndStat(t *testing.T) {
+	ws := createGitWorkspace(t)
+	writeWorkspaceFile(t, ws, "README.md", "hello\nworld\n")
+
+	res, rpcErr := HandleGitDiff(context.Background(), GitDiffParams{}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if len(res.Files) != 1 {
+		t.Fatalf("expected one changed file, got %+v", res.Files)
+	}
+	file := res.Files[0]
+	if file.Path != "README.md" || file.Additions != 1 || file.Deletions != 0 {
+		t.Fatalf("unexpected diff file summary: %+v", file)
+	}
+	if len(file.Hunks) != 1 {
+		t.Fatalf("expected one hunk, got %+v", file.Hunks)
+	}
+	var added []GitDiffLine
+	for _, line := range file.Hunks[0].Lines {
+		if line.Kind == "add" {
+			added = append(added, line)
+		}
+	}
+	if len(added) != 1 || added[0].Content != "world" || added[0].NewLine != 2 {
+		t.Fatalf("expected added line 'world' at 2, got %+v", added)
+	}
+
+	stat, rpcErr := HandleGitDiff(context.Background(), GitDiffParams{Stat: true}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected stat rpc error: %+v", rpcErr)
+	}
+	if len(stat.Files) != 1 || stat.Files[0].Hunks != nil || stat.Additions != 1 {
+		t.Fatalf("expected stat-only diff, got %+v", stat)
+	}
+
+	runGitIn(t, ws.Path(), "commit", "-am", "second")
+	againstRef, rpcErr := HandleGitDiff(context.Background(), GitDiffParams{Ref: "HEAD~1", Target: "HEAD"}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected ref diff rpc error: %+v", rpcErr)
+	}
+	if len(againstRef.Files) != 1 || againstRef.Additions != 1 {
+		t.Fatalf("expected ref diff with one addition, got %+v", againstRef)
+	}
+
+	if _, rpcErr := HandleGitDiff(context.Background(), GitDiffParams{Ref: "--output=/tmp/x"}, ws); rpcErr != rpckit.ErrInvalidParams {
+		t.Fatalf("expected invalid params for option-like ref, got %+v", rpcErr)
+	}
+	if _, rpcErr := HandleGitDiff(context.Background(), GitDiffParams{Paths: []string{"../escape"}}, ws); rpcErr != rpckit.ErrInvalidPath {
+		t.Fatalf("expected invalid path for traversal, got %+v", rpcErr)
+	}
+}
+
+func TestHandleGitDiff_QuotedAndSpacedPaths(t *testing.T) {
+	ws := createGitWorkspace(t)
+	if err := os.MkdirAll(filepath.Join(ws.Path(), "x b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"x b/notes.txt", "café \"menu\".txt"}
+	for _, name := range names {
+		writeWorkspaceFile(t, ws, name, "one\n")
+	}
+	runGitIn(t, ws.Path(), "add", ".")
+	runGitIn(t, ws.Path(), "commit", "-m", "paths")
+	for _, name := range names {
+		writeWorkspaceFile(t, ws, name, "one\ntwo\n")
+	}
+
+	res, rpcErr := HandleGitDiff(context.Background(), GitDiffParams{}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	got := map[string]bool{}
+	for _, file := range res.Files {
+		if len(file.Hunks) != 1 || file.OldPath != "" {
+			t.Fatalf("unexpected diff file: %+v", file)
+		}
+		got[file.Path] = true
+	}
+	for _, name := range names {
+		if !got[name] {
+			t.Fatalf("expected %q in diff paths, got %v", name, got)
+		}
+	}
+}
+
+func TestSplitGitDiffHeader(t *testing.T) {
+	cases := []struct {
+		header, a, b string
+	}{
+		{`a/README.md b/README.md`, "README.md", "README.md"},
+		{`a/x b/y b/x b/y`, "x b/y", "x b/y"},
+		{`a/old.txt b/new.txt`, "old.txt", "new.txt"},
+		{`"a/tab\there" "b/tab\there"`, "tab\there", "tab\there"},
+		{`"a/caf\303\251 \"q\".txt" "b/caf\303\251 \"q\".txt"`, "café \"q\".txt", "café \"q\".txt"},
+		{`a/plain.txt "b/new\nline"`, "plain.txt", "new\nline"},
+	}
+	for _, tc := range cases {
+		a, b, ok := splitGitDiffHeader(tc.header)
+		if !ok || a != tc.a || b != tc.b {
+			t.Fatalf("splitGitDiffHeader(%q) = %q, %q, %v; want %q, %q", tc.header, a, b, ok, tc.a, tc.b)
+		}
+	}
+	if _, _, ok := splitGitDiffHeader(`"a/unterminated b/x`); ok {
+		t.Fatal("expected unterminated quoted path to be rejected")
+	}
+}
+
+func TestValidGitRef(t *testing.T) {
+	for _, ref := range []string{"main", "HEAD~1", "origin/main", "v1.2.3", "feature+x"} {
+		if !validGitRef(ref) {
+			t.Fatalf("expected %q to be accepted", ref)
+		}
+	}
+	for _, ref := range []string{"", "  ", "--output=/tmp/x", "+main", "main:main", ":main", "HEAD:refs/heads/other"} {
+		if validGitRef(ref) {
+			t.Fatalf("expected %q to be rejected", ref)
+		}
+	}
+}
+
+func TestHandleGitLog_Pages(t *testing.T) {
+	ws := createGitWorkspace(t)
+	for _, msg := range []string{"two", "three"} {
+		writeWorkspaceFile(t, ws, "README.md", msg+"\n")
+		runGitIn(t, ws.Path(), "commit", "-am", msg, "-m", "body for "+msg)
+	}
+
+	first, rpcErr := HandleGitLog(context.Background(), GitLogParams{Limit: 2}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if len(first.Commits) != 2 || !first.HasMore || first.NextSkip != 2 {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+	if first.Commits[0].Subject != "three" || first.Commits[0].Body != "body for three" {
+		t.Fatalf("unexpected newest commit: %+v", first.Commits[0])
+	}
+	if len(first.Commits[0].Parents) != 1 {
+		t.Fatalf("expected one parent, got %+v", first.Commits[0].Parents)
+	}
+
+	second, rpcErr := HandleGitLog(context.Background(), GitLogParams{Limit: 2, Skip: first.NextSkip}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if len(second.Commits) != 1 || second.HasMore || second.Commits[0].Subject != "init" {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+}
+
+func TestHandleGitBranchesAndStash(t *testing.T) {
+	ws := createGitWorkspace(t)
+	runGitIn(t, ws.Path(), "branch", "feature")
+
+	branches, rpcErr := HandleGitBranches(context.Background(), GitBranchesParams{}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if len(branches.Branches) != 2 || branches.Current == "" || branches.Current == "feature" {
+		t.Fatalf("unexpected branches: %+v", branches)
+	}
+
+	writeWorkspaceFile(t, ws, "README.md", "stashed\n")
+	if _, rpcErr := HandleGitStash(context.Background(), GitStashParams{Action: "push", Message: "wip"}, ws); rpcErr != nil {
+		t.Fatalf("stash push: %+v", rpcErr)
+	}
+	list, rpcErr := HandleGitStash(context.Background(), GitStashParams{Action: "list"}, ws)
+	if rpcErr != nil {
+		t.Fatalf("stash list: %+v", rpcErr)
+	}
+	if len(list.Entries) != 1 || list.Entries[0].Index != 0 || !strings.Contains(list.Entries[0].Message, "wip") {
+		t.Fatalf("unexpected stash entries: %+v", list.Entries)
+	}
+	if _, rpcErr := HandleGitStash(context.Background(), GitStashParams{Action: "pop"}, ws); rpcErr != nil {
+		t.Fatalf("stash pop: %+v", rpcErr)
+	}
+	content, _ := os.ReadFile(filepath.Join(ws.Path(), "README.md"))
+	if string(content) != "stashed\n" {
+		t.Fatalf("expected stash pop to restore content, got %q", content)
+	}
+	if _, rpcErr := HandleGitStash(context.Background(), GitStashParams{Action: "clear"}, ws); rpcErr != rpckit.ErrInvalidParams {
+		t.Fatalf("expected invalid params for unknown stash action, got %+v", rpcErr)
+	}
+}
+
+func TestHandleGitPushAndFetch_BareRemoteWithAuthRelay(t *testing.T) {
+	ws := createGitWorkspace(t)
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	runGitIn(t, t.TempDir(), "init", "--bare", remote)
+	runGitIn(t, ws.Path(), "remote", "add", "origin", remote)
+
+	broker := authrelay.NewBroker()
+	token := broker.Mint("ws-1", map[string]string{"NEXUS_AUTH_VALUE": "secret"}, time.Minute)
+	params := GitRemoteParams{WorkspaceID: "ws-1", SetUpstream: true, AuthRelayToken: token}
+	res, rpcErr := HandleGitPush(context.Background(), params, ws, broker)
+	if rpcErr != nil {
+		t.Fatalf("push: %+v", rpcErr)
+	}
+	if !res.OK || res.Remote != "origin" {
+		t.Fatalf("unexpected push result: %+v", res)
+	}
+
+	head := runGitIn(t, ws.Path(), "rev-parse", "HEAD")
+	branch := runGitIn(t, ws.Path(), "rev-parse", "--abbrev-ref", "HEAD")
+	if got := runGitIn(t, remote, "rev-parse", branch); got != head {
+		t.Fatalf("expected remote %s at %s, got %s", branch, head, got)
+	}
+
+	if _, rpcErr := HandleGitPush(context.Background(), params, ws, broker); rpcErr != rpckit.ErrAuthRelayInvalid {
+		t.Fatalf("expected reused relay token to be rejected, got %+v", rpcErr)
+	}
+
+	if _, rpcErr := HandleGitFetch(context.Background(), GitRemoteParams{Prune: true}, ws, broker); rpcErr != nil {
+		t.Fatalf("fetch: %+v", rpcErr)
+	}
+	branches, rpcErr := HandleGitBranches(context.Background(), GitBranchesParams{Remote: true}, ws)
+	if rpcErr != nil {
+		t.Fatalf("branches: %+v", rpcErr)
+	}
+	var sawRemote bool
+	for _, b := range branches.Branches {
+		if b.Remote && b.Name == "origin/"+branch {
+			sawRemote = true
+		}
+		if b.Current && b.Upstream != "origin/"+branch {
+			t.Fatalf("expected upstream to be set on current branch, got %+v", b)
+		}
+	}
+	if !sawRemote {
+		t.Fatalf("expected remote-tracking branch in %+v", branches.Branches)
+	}
+}
+
+func TestHandleGitBlame_Porcelain(t *testing.T) {
+	ws := createGitWorkspace(t)
+	writeWorkspaceFile(t, ws, "README.md", "hello\nsecond\n")
+	runGitIn(t, ws.Path(), "commit", "-am", "add second line")
+
+	res, rpcErr := HandleGitBlame(context.Background(), GitBlameParams{Path: "README.md"}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if len(res.Lines) != 2 {
+		t.Fatalf("expected two blamed lines, got %+v", res.Lines)
+	}
+	if res.Lines[0].Summary != "init" || res.Lines[1].Summary != "add second line" {
+		t.Fatalf("unexpected blame summaries: %+v", res.Lines)
+	}
+	if res.Lines[1].Content != "second" || res.Lines[1].Line != 2 || res.Lines[1].AuthorEmail != "test@example.com" {
+		t.Fatalf("unexpected second blame line: %+v", res.Lines[1])
+	}
+
+	ranged, rpcErr := HandleGitBlame(context.Background(), GitBlameParams{Path: "README.md", StartLine: 2, EndLine: 2}, ws)
+	if rpcErr != nil {
+		t.Fatalf("unexpected ranged rpc error: %+v", rpcErr)
+	}
+	if len(ranged.Lines) != 1 || ranged.Lines[0].Content != "second" {
+		t.Fatalf("unexpected ranged blame: %+v", ranged.Lines)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package handlers
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones src's data into dst with FICLONE, which filesystems such
+// as btrfs and XFS support.
+func reflink(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package handlers
+
+import "os"
+
+func reflink(dst, src *os.File) error {
+	return errNoReflink
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"github.com/inizio/nexus/packages/nexus/pkg/compose"
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
 
 	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
 	"github.com/inizio/nexus/packages/nexus/pkg/spotlight"
@@ -96,20 +97,41 @@ func HandleSpotlightApplyComposePorts(ctx context.Context, p SpotlightApplyCompo
 		Errors:   make([]SpotlightApplyComposePortsError, 0),
 	}
 
+	// Port rules from workspace.json can skip published ports or pin their
+	// host port and protocol. A broken config is reported by workspace
+	// commands; here it just means no rules.
+	var rules config.WorkspacePorts
+	if cfg, _, err := config.LoadWorkspaceConfig(rootPath); err == nil {
+		rules = cfg.Ports
+	}
+
 	for _, entry := range published {
+		policy := rules.Resolve(entry.HostPort, "")
+		if policy.Ignore {
+			continue
+		}
 		host := entry.HostIP
 		if host == "" {
 			host = "127.0.0.1"
 		}
+		protocol := entry.Protocol
+		if policy.Protocol != "" {
+			protocol = policy.Protocol
+		}
+		candidates := composeLocalPortCandidates(entry.HostPort, entry.TargetPort)
+		if policy.LocalPort > 0 {
+			candidates = append([]int{policy.LocalPort}, candidates...)
+		}
 
 		var (
 			fwd       *spotlight.Forward
 			exposeErr error
 		)
-		for _, localPort := range composeLocalPortCandidates(entry.HostPort, entry.TargetPort) {
+		for _, localPort := range candidates {
 			fwd, exposeErr = mgr.Expose(ctx, spotlight.ExposeSpec{
 				WorkspaceID: p.WorkspaceID,
 				Service:     entry.Service,
+				Protocol:    protocol,
 				RemotePort:  entry.TargetPort,
 				LocalPort:   localPort,
 				Host:        host,
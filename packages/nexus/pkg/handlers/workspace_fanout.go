@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+const (
+	maxFanoutCount          = 64
+	defaultFanoutParallel   = 4
+	maxFanoutParallel       = 16
+	maxFanoutPersistedBytes = 4096
+
+	// DefaultFanoutTimeout and MaxFanoutTimeout bound each child's command.
+	// They are far above the exec RPC's limits because fan-out runs whole
+	// agent sessions.
+	DefaultFanoutTimeout = 30 * time.Minute
+	MaxFanoutTimeout     = 4 * time.Hour
+)
+
+type WorkspaceFanoutParams struct {
+	ID      string   `json:"id"`
+	Count   int      `json:"count"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Parallelism caps how many child commands run at once.
+	Parallelism int `json:"parallelism,omitempty"`
+	// NamePrefix names children <prefix>-<n> and is also used as their git ref.
+	NamePrefix string `json:"namePrefix,omitempty"`
+	// Timeout is the per-child command timeout in seconds. It defaults to
+	// DefaultFanoutTimeout and is capped at MaxFanoutTimeout.
+	Timeout int64    `json:"timeout,omitempty"`
+	Env     []string `json:"env,omitempty"`
+}
+
+type WorkspaceFanoutChild struct {
+	Index         int    `json:"index"`
+	WorkspaceID   string `json:"workspaceId,omitempty"`
+	WorkspaceName string `json:"workspaceName"`
+	Status        string `json:"status"`
+	ExitCode      *int   `json:"exitCode,omitempty"`
+	Stdout        string `json:"stdout,omitempty"`
+	Stderr        string `json:"stderr,omitempty"`
+	Error         string `json:"error,omitempty"`
+	DurationMs    int64  `json:"durationMs"`
+}
+
+type WorkspaceFanoutResult struct {
+	GroupID           string                 `json:"groupId"`
+	SourceWorkspaceID string                 `json:"sourceWorkspaceId"`
+	Command           string                 `json:"command"`
+	SnapshotID        string                 `json:"snapshotId,omitempty"`
+	Children          []WorkspaceFanoutChild `json:"children"`
+	Succeeded         int                    `json:"succeeded"`
+	Failed            int                    `json:"failed"`
+}
+
+// FanoutRunner executes a command inside a forked workspace. It runs until
+// ctx is done; req.Options.Timeout is informational.
+type FanoutRunner func(ctx context.Context, ws *workspacemgr.Workspace, req ExecParams) (*ExecResult, *rpckit.RPCError)
+
+// FanoutForkHook runs the onFork lifecycle hooks of a new child. A non-nil
+// error means the child was discarded and its command is not run.
+type FanoutForkHook func(ctx context.Context, workspaceID string) error
+
+// HandleWorkspaceFanout forks the source workspace req.Count times, taking the
+// runtime checkpoint once, then runs the same command in every child with
+// bounded parallelism. Each child's result is persisted on its workspace
+// record under a shared fan-out group id. onFork, when set, runs for every
+// child before its command.
+func HandleWorkspaceFanout(ctx context.Context, req WorkspaceFanoutParams, mgr *workspacemgr.Manager, factory *runtime.Factory, run FanoutRunner, onFork FanoutForkHook) (*WorkspaceFanoutResult, *rpckit.RPCError) {
+	sourceID := strings.TrimSpace(req.ID)
+	if sourceID == "" || strings.TrimSpace(req.Command) == "" || run == nil {
+		return nil, rpckit.ErrInvalidParams
+	}
+	if req.Count < 1 || req.Count > maxFanoutCount {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("count must be between 1 and %d", maxFanoutCount)}
+	}
+	source, ok := mgr.Get(sourceID)
+	if !ok {
+		return nil, rpckit.ErrWorkspaceNotFound
+	}
+
+	parallelism := req.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultFanoutParallel
+	}
+	if parallelism > maxFanoutParallel {
+		parallelism = maxFanoutParallel
+	}
+	if parallelism > req.Count {
+		parallelism = req.Count
+	}
+
+	startedAt := time.Now().UTC()
+	groupID := fmt.Sprintf("fanout-%d", startedAt.UnixNano())
+	prefix := strings.TrimSpace(req.NamePrefix)
+	if prefix == "" {
+		prefix = fmt.Sprintf("%s-%s", source.WorkspaceName, groupID)
+	}
+	command := req.Command
+	if len(req.Args) > 0 {
+		command = req.Command + " " + strings.Join(req.Args, " ")
+	}
+
+	result := &WorkspaceFanoutResult{
+		GroupID:           groupID,
+		SourceWorkspaceID: source.ID,
+		Command:           command,
+		Children:          make([]WorkspaceFanoutChild, req.Count),
+	}
+
+	// Forks run sequentially: the first one checkpoints the source and the
+	// rest reuse that snapshot.
+	children := make([]*workspacemgr.Workspace, req.Count)
+	for i := 0; i < req.Count; i++ {
+		name := fmt.Sprintf("%s-%d", prefix, i+1)
+		result.Children[i] = WorkspaceFanoutChild{Index: i, WorkspaceName: name, Status: "pending"}
+		forked, snapshotID, rpcErr := forkWorkspace(ctx, WorkspaceForkParams{
+			ID:                 source.ID,
+			ChildWorkspaceName: name,
+			ChildRef:           name,
+			SourceWorkspaceID:  source.ID,
+		}, mgr, factory, result.SnapshotID)
+		if rpcErr != nil {
+			result.Children[i].Status = "error"
+			result.Children[i].Error = "fork failed: " + rpcErr.Message
+			continue
+		}
+		if result.SnapshotID == "" {
+			result.SnapshotID = snapshotID
+		}
+		if onFork != nil {
+			if err := onFork(ctx, forked.Workspace.ID); err != nil {
+				result.Children[i].Status = "error"
+				result.Children[i].Error = err.Error()
+				continue
+			}
+		}
+		children[i] = forked.Workspace
+		result.Children[i].WorkspaceID = forked.Workspace.ID
+		_ = mgr.SetFanout(forked.Workspace.ID, workspacemgr.FanoutMembership{
+			GroupID:           groupID,
+			SourceWorkspaceID: source.ID,
+			Index:             i,
+			Command:           command,
+			Status:            "pending",
+			StartedAt:         startedAt,
+		})
+	}
+
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, child := range children {
+		if child == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, child *workspacemgr.Workspace) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				result.Children[i].Status = "error"
+				result.Children[i].Error = ctx.Err().Error()
+				recordFanoutResult(mgr, groupID, source.ID, command, startedAt, child.ID, result.Children[i])
+				return
+			}
+			defer func() { <-sem }()
+			result.Children[i] = runFanoutChild(ctx, run, child, req, result.Children[i])
+			recordFanoutResult(mgr, groupID, source.ID, command, startedAt, child.ID, result.Children[i])
+		}(i, child)
+	}
+	wg.Wait()
+
+	for _, child := range result.Children {
+		if child.Status == "succeeded" {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+func runFanoutChild(ctx context.Context, run FanoutRunner, child *workspacemgr.Workspace, req WorkspaceFanoutParams, entry WorkspaceFanoutChild) WorkspaceFanoutChild {
+	timeout := fanoutTimeout(req.Timeout)
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	began := time.Now()
+	execRes, rpcErr := run(runCtx, child, ExecParams{
+		WorkspaceID: child.ID,
+		Command:     req.Command,
+		Args:        req.Args,
+		Options:     ExecOptions{Timeout: int64(timeout / time.Second), Env: req.Env},
+	})
+	entry.DurationMs = time.Since(began).Milliseconds()
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		entry.Status = "error"
+		entry.Error = fmt.Sprintf("command timed out after %s", timeout)
+		return entry
+	}
+	if rpcErr != nil {
+		entry.Status = "error"
+		entry.Error = rpcErr.Message
+		return entry
+	}
+	exitCode := execRes.ExitCode
+	entry.ExitCode = &exitCode
+	entry.Stdout = execRes.Stdout
+	entry.Stderr = execRes.Stderr
+	if exitCode == 0 {
+		entry.Status = "succeeded"
+	} else {
+		entry.Status = "failed"
+	}
+	return entry
+}
+
+// fanoutTimeout returns the deadline of a child's command for a timeout
+// given in seconds.
+func fanoutTimeout(seconds int64) time.Duration {
+	if seconds <= 0 {
+		return DefaultFanoutTimeout
+	}
+	if timeout := time.Duration(seconds) * time.Second; timeout < MaxFanoutTimeout {
+		return timeout
+	}
+	return MaxFanoutTimeout
+}
+
+func recordFanoutResult(mgr *workspacemgr.Manager, groupID, sourceID, command string, startedAt time.Time, workspaceID string, entry WorkspaceFanoutChild) {
+	finishedAt := time.Now().UTC()
+	output := entry.Stdout
+	if entry.Stderr != "" {
+		if output != "" {
+			output += "\n"
+		}
+		output += entry.Stderr
+	}
+	if len(output) > maxFanoutPersistedBytes {
+		output = output[len(output)-maxFanoutPersistedBytes:]
+	}
+	_ = mgr.SetFanout(workspaceID, workspacemgr.FanoutMembership{
+		GroupID:           groupID,
+		SourceWorkspaceID: sourceID,
+		Index:             entry.Index,
+		Command:           command,
+		Status:            entry.Status,
+		ExitCode:          entry.ExitCode,
+		Output:            output,
+		Error:             entry.Error,
+		StartedAt:         startedAt,
+		FinishedAt:        &finishedAt,
+	})
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+func TestHandleWorkspaceFanout_CheckpointsOnceAndCapsParallelism(t *testing.T) {
+	mgr := workspacemgr.NewManager(t.TempDir())
+	source, err := mgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          "git@example/repo.git",
+		Ref:           "main",
+		WorkspaceName: "eval",
+		AgentProfile:  "default",
+		Backend:       vmIsolationBackend(),
+	})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	var checkpoints int32
+	factory := runtime.NewFactory([]runtime.Capability{{Name: "runtime.linux", Available: true}, {Name: "runtime.firecracker", Available: true}}, vmIsolationDrivers(&mockDriver{
+		backend: vmIsolationBackend(),
+		checkpointForkFn: func(_ context.Context, workspaceID, _ string) (string, error) {
+			if workspaceID != source.ID {
+				t.Errorf("expected checkpoint of source %q, got %q", source.ID, workspaceID)
+			}
+			atomic.AddInt32(&checkpoints, 1)
+			return "snap-fanout", nil
+		},
+	}))
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	run := func(_ context.Context, ws *workspacemgr.Workspace, req ExecParams) (*ExecResult, *rpckit.RPCError) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if req.WorkspaceID != ws.ID || req.Command != "make" {
+			t.Errorf("unexpected exec request %+v for %s", req, ws.ID)
+		}
+		if strings.HasSuffix(ws.WorkspaceName, "-3") {
+			return &ExecResult{Stderr: "boom", ExitCode: 2}, nil
+		}
+		return &ExecResult{Stdout: "ok " + ws.WorkspaceName}, nil
+	}
+
+	res, rpcErr := HandleWorkspaceFanout(context.Background(), WorkspaceFanoutParams{
+		ID:          source.ID,
+		Count:       5,
+		Command:     "make",
+		Args:        []string{"test"},
+		Parallelism: 2,
+		NamePrefix:  "trial",
+	}, mgr, factory, run, nil)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if got := atomic.LoadInt32(&checkpoints); got != 1 {
+		t.Fatalf("expected a single checkpoint, got %d", got)
+	}
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent runs, got %d", peak)
+	}
+	if res.SnapshotID != "snap-fanout" || res.Succeeded != 4 || res.Failed != 1 || len(res.Children) != 5 {
+		t.Fatalf("unexpected fanout result: %+v", res)
+	}
+	failed := res.Children[2]
+	if failed.Status != "failed" || failed.ExitCode == nil || *failed.ExitCode != 2 || failed.Stderr != "boom" {
+		t.Fatalf("unexpected failed child: %+v", failed)
+	}
+
+	for _, child := range res.Children {
+		ws, ok := mgr.Get(child.WorkspaceID)
+		if !ok {
+			t.Fatalf("child %s not found", child.WorkspaceID)
+		}
+		if ws.ParentWorkspaceID != source.ID || ws.LineageSnapshotID != "snap-fanout" {
+			t.Fatalf("unexpected child lineage: parent=%q snapshot=%q", ws.ParentWorkspaceID, ws.LineageSnapshotID)
+		}
+		if ws.Fanout == nil || ws.Fanout.GroupID != res.GroupID || ws.Fanout.Status != child.Status || ws.Fanout.FinishedAt == nil {
+			t.Fatalf("expected persisted fanout state for %s, got %+v", ws.ID, ws.Fanout)
+		}
+	}
+
+	relations, rpcErr := HandleWorkspaceRelationsList(context.Background(), WorkspaceRelationsListParams{}, mgr)
+	if rpcErr != nil {
+		t.Fatalf("relations: %+v", rpcErr)
+	}
+	if len(relations.Relations) != 1 || len(relations.Relations[0].FanoutGroups) != 1 {
+		t.Fatalf("expected one fanout group in relations, got %+v", relations.Relations)
+	}
+	group := relations.Relations[0].FanoutGroups[0]
+	if group.GroupID != res.GroupID || len(group.WorkspaceIDs) != 5 || group.Succeeded != 4 || group.Failed != 1 || group.Command != "make test" {
+		t.Fatalf("unexpected fanout group: %+v", group)
+	}
+}
+
+func TestHandleWorkspaceFanout_ValidatesParams(t *testing.T) {
+	mgr := workspacemgr.NewManager(t.TempDir())
+	run := func(context.Context, *workspacemgr.Workspace, ExecParams) (*ExecResult, *rpckit.RPCError) {
+		return &ExecResult{}, nil
+	}
+	if _, rpcErr := HandleWorkspaceFanout(context.Background(), WorkspaceFanoutParams{ID: "ws-1", Count: 2}, mgr, nil, run, nil); rpcErr != rpckit.ErrInvalidParams {
+		t.Fatalf("expected invalid params without command, got %+v", rpcErr)
+	}
+	if _, rpcErr := HandleWorkspaceFanout(context.Background(), WorkspaceFanoutParams{ID: "ws-1", Count: 0, Command: "true"}, mgr, nil, run, nil); rpcErr == nil || rpcErr.Code != rpckit.ErrInvalidParams.Code {
+		t.Fatalf("expected invalid params for zero count, got %+v", rpcErr)
+	}
+	if _, rpcErr := HandleWorkspaceFanout(context.Background(), WorkspaceFanoutParams{ID: "missing", Count: 1, Command: "true"}, mgr, nil, run, nil); rpcErr != rpckit.ErrWorkspaceNotFound {
+		t.Fatalf("expected workspace not found, got %+v", rpcErr)
+	}
+}
+
+func TestHandleWorkspaceFanout_SkipsChildrenWhoseForkHookFails(t *testing.T) {
+	mgr := workspacemgr.NewManager(t.TempDir())
+	source, err := mgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          "git@example/repo.git",
+		Ref:           "main",
+		WorkspaceName: "eval",
+		AgentProfile:  "default",
+	})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	var ran int32
+	run := func(context.Context, *workspacemgr.Workspace, ExecParams) (*ExecResult, *rpckit.RPCError) {
+		atomic.AddInt32(&ran, 1)
+		return &ExecResult{}, nil
+	}
+	var hooked []string
+	onFork := func(_ context.Context, workspaceID string) error {
+		hooked = append(hooked, workspaceID)
+		if len(hooked) == 2 {
+			return errors.New("onFork hook setup failed with exit code 1")
+		}
+		return nil
+	}
+
+	res, rpcErr := HandleWorkspaceFanout(context.Background(), WorkspaceFanoutParams{
+		ID:         source.ID,
+		Count:      3,
+		Command:    "true",
+		NamePrefix: "trial",
+	}, mgr, nil, run, onFork)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if len(hooked) != 3 {
+		t.Fatalf("expected onFork for every child, got %v", hooked)
+	}
+	if got := atomic.LoadInt32(&ran); got != 2 {
+		t.Fatalf("expected commands only in children that passed onFork, got %d", got)
+	}
+	failed := res.Children[1]
+	if failed.Status != "error" || failed.WorkspaceID != "" || !strings.Contains(failed.Error, "onFork hook setup failed") {
+		t.Fatalf("unexpected child after failed hook: %+v", failed)
+	}
+	if res.Succeeded != 2 || res.Failed != 1 {
+		t.Fatalf("unexpected fanout totals: %+v", res)
+	}
+}
+
+func TestHandleWorkspaceFanout_UsesRequestedChildTimeout(t *testing.T) {
+	mgr := workspacemgr.NewManager(t.TempDir())
+	source, err := mgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          "git@example/repo.git",
+		Ref:           "main",
+		WorkspaceName: "eval",
+		AgentProfile:  "default",
+	})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	run := func(ctx context.Context, _ *workspacemgr.Workspace, req ExecParams) (*ExecResult, *rpckit.RPCError) {
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > time.Second || req.Options.Timeout != 1 {
+			t.Errorf("expected a 1s deadline, got %v (timeout %d)", time.Until(deadline), req.Options.Timeout)
+		}
+		<-ctx.Done()
+		return &ExecResult{ExitCode: -1}, nil
+	}
+	res, rpcErr := HandleWorkspaceFanout(context.Background(), WorkspaceFanoutParams{
+		ID:      source.ID,
+		Count:   1,
+		Command: "sleep 60",
+		Timeout: 1,
+	}, mgr, nil, run, nil)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if child := res.Children[0]; child.Status != "error" || child.Error != "command timed out after 1s" {
+		t.Fatalf("expected timed out child, got %+v", child)
+	}
+
+	if got := fanoutTimeout(0); got != DefaultFanoutTimeout {
+		t.Fatalf("expected default timeout, got %s", got)
+	}
+	if got := fanoutTimeout(int64(time.Hour / time.Second)); got != time.Hour {
+		t.Fatalf("expected a one hour timeout to be kept, got %s", got)
+	}
+	if got := fanoutTimeout(int64(24 * time.Hour / time.Second)); got != MaxFanoutTimeout {
+		t.Fatalf("expected timeout capped at %s, got %s", MaxFanoutTimeout, got)
+	}
+}
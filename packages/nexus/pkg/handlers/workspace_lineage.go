@@ -0,0 +1,539 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+type WorkspaceDiffParams struct {
+	BaseWorkspaceID string `json:"baseWorkspaceId,omitempty"`
+	HeadWorkspaceID string `json:"headWorkspaceId"`
+	// CommittedOnly compares HEAD commits and ignores uncommitted and
+	// untracked changes in either workspace.
+	CommittedOnly bool `json:"committedOnly,omitempty"`
+	// SinceForkPoint diffs the head workspace against the merge base of the
+	// two workspaces instead of the base workspace's current state.
+	SinceForkPoint bool     `json:"sinceForkPoint,omitempty"`
+	Stat           bool     `json:"stat,omitempty"`
+	Paths          []string `json:"paths,omitempty"`
+}
+
+type WorkspaceDiffResult struct {
+	BaseWorkspaceID string        `json:"baseWorkspaceId"`
+	HeadWorkspaceID string        `json:"headWorkspaceId"`
+	BaseCommit      string        `json:"baseCommit"`
+	HeadCommit      string        `json:"headCommit"`
+	MergeBase       string        `json:"mergeBase,omitempty"`
+	Files           []GitDiffFile `json:"files"`
+	Additions       int           `json:"additions"`
+	Deletions       int           `json:"deletions"`
+}
+
+type WorkspaceMergeParams struct {
+	ChildWorkspaceID  string `json:"childWorkspaceId"`
+	ParentWorkspaceID string `json:"parentWorkspaceId,omitempty"`
+	// Mode is "commits" (merge the child's HEAD) or "patch" (apply the
+	// child's full working tree, including uncommitted changes, as a patch).
+	Mode    string `json:"mode,omitempty"`
+	Message string `json:"message,omitempty"`
+	DryRun  bool   `json:"dryRun,omitempty"`
+	// KeepConflicts leaves conflict markers in the parent worktree instead of
+	// rejecting the merge when conflicts are detected.
+	KeepConflicts bool `json:"keepConflicts,omitempty"`
+}
+
+type WorkspaceMergeResult struct {
+	ParentWorkspaceID string   `json:"parentWorkspaceId"`
+	ChildWorkspaceID  string   `json:"childWorkspaceId"`
+	Mode              string   `json:"mode"`
+	DryRun            bool     `json:"dryRun"`
+	Merged            bool     `json:"merged"`
+	Clean             bool     `json:"clean"`
+	Commit            string   `json:"commit,omitempty"`
+	Files             []string `json:"files"`
+	Conflicts         []string `json:"conflicts"`
+	ChildDirty        bool     `json:"childDirty,omitempty"`
+}
+
+type lineageWorkspace struct {
+	ws   *workspacemgr.Workspace
+	root string
+}
+
+func HandleWorkspaceDiff(ctx context.Context, req WorkspaceDiffParams, mgr *workspacemgr.Manager) (*WorkspaceDiffResult, *rpckit.RPCError) {
+	base, head, rpcErr := resolveLineagePair(mgr, req.BaseWorkspaceID, req.HeadWorkspaceID)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	baseCommit, baseTree, rpcErr := snapshotWorkspaceTree(ctx, base.root, !req.CommittedOnly)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	headCommit, headTree, rpcErr := snapshotWorkspaceTree(ctx, head.root, !req.CommittedOnly)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	result := &WorkspaceDiffResult{
+		BaseWorkspaceID: base.ws.ID,
+		HeadWorkspaceID: head.ws.ID,
+		BaseCommit:      baseCommit,
+		HeadCommit:      headCommit,
+	}
+	from := baseTree
+	if mergeBase, err := gitOutputAt(ctx, head.root, "merge-base", "merge-base", baseCommit, headCommit); err == nil {
+		result.MergeBase = strings.TrimSpace(mergeBase)
+	}
+	if req.SinceForkPoint {
+		if result.MergeBase == "" {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "workspaces have no common history"}
+		}
+		from = result.MergeBase
+	}
+
+	paths := make([]string, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		p = filepath.ToSlash(filepath.Clean(strings.TrimSpace(p)))
+		if p == "." || p == "" {
+			continue
+		}
+		if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+			return nil, rpckit.ErrInvalidPath
+		}
+		paths = append(paths, p)
+	}
+
+	files, rpcErr := diffGitRevisions(ctx, head.root, req.Stat, from, headTree, paths)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	result.Files = files
+	for _, f := range files {
+		result.Additions += f.Additions
+		result.Deletions += f.Deletions
+	}
+	return result, nil
+}
+
+func HandleWorkspaceMerge(ctx context.Context, req WorkspaceMergeParams, mgr *workspacemgr.Manager) (*WorkspaceMergeResult, *rpckit.RPCError) {
+	childID := strings.TrimSpace(req.ChildWorkspaceID)
+	if childID == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	mode := strings.ToLower(strings.TrimSpace(req.Mode))
+	if mode == "" {
+		mode = "commits"
+	}
+	if mode != "commits" && mode != "patch" {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "invalid merge mode (expected: commits, patch)"}
+	}
+
+	parent, child, rpcErr := resolveLineagePair(mgr, req.ParentWorkspaceID, childID)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	result := &WorkspaceMergeResult{
+		ParentWorkspaceID: parent.ws.ID,
+		ChildWorkspaceID:  child.ws.ID,
+		Mode:              mode,
+		DryRun:            req.DryRun,
+		Files:             []string{},
+		Conflicts:         []string{},
+	}
+	if status, err := gitOutputAt(ctx, child.root, "status", "status", "--porcelain"); err == nil {
+		result.ChildDirty = hasWorkspaceChanges(status, child.root)
+	}
+
+	var mergeErr *rpckit.RPCError
+	if mode == "commits" {
+		mergeErr = mergeWorkspaceCommits(ctx, req, parent, child, result)
+	} else {
+		mergeErr = mergeWorkspacePatch(ctx, req, parent, child, result)
+	}
+	if mergeErr != nil {
+		return nil, mergeErr
+	}
+	result.Clean = len(result.Conflicts) == 0
+
+	if result.Merged && !req.DryRun {
+		if head, err := gitOutputAt(ctx, parent.root, "rev-parse", "rev-parse", "HEAD"); err == nil {
+			result.Commit = strings.TrimSpace(head)
+			_ = mgr.SetCurrentCommit(parent.ws.ID, result.Commit)
+		}
+	}
+	return result, nil
+}
+
+func mergeWorkspaceCommits(ctx context.Context, req WorkspaceMergeParams, parent, child lineageWorkspace, result *WorkspaceMergeResult) *rpckit.RPCError {
+	parentHead, rpcErr := gitOutputAt(ctx, parent.root, "rev-parse", "rev-parse", "HEAD")
+	if rpcErr != nil {
+		return rpcErr
+	}
+	childHead, rpcErr := gitOutputAt(ctx, child.root, "rev-parse", "rev-parse", "HEAD")
+	if rpcErr != nil {
+		return rpcErr
+	}
+	parentHead, childHead = strings.TrimSpace(parentHead), strings.TrimSpace(childHead)
+
+	// merge-tree computes the merge result without touching either worktree,
+	// so conflicts can be reported before anything is modified.
+	res, err := runGit(ctx, parent.root, nil, "merge-tree", "--write-tree", "--name-only", "--no-messages", parentHead, childHead)
+	if err != nil {
+		return rpckit.ErrInternalError
+	}
+	if res.exitCode > 1 {
+		return gitFailure("merge-tree", res)
+	}
+	lines := splitNonEmptyLines(res.stdout)
+	if len(lines) == 0 {
+		return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: "git merge-tree returned no tree"}
+	}
+	mergedTree := lines[0]
+	if res.exitCode == 1 {
+		result.Conflicts = dedupeStrings(lines[1:])
+	}
+	if changed, err := gitOutputAt(ctx, parent.root, "diff", "diff", "--name-only", "-z", parentHead, mergedTree); err == nil {
+		result.Files = splitNUL(changed)
+	}
+
+	if req.DryRun {
+		return nil
+	}
+	if len(result.Conflicts) > 0 && !req.KeepConflicts {
+		return mergeConflictError(result)
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		message = fmt.Sprintf("Merge workspace %s into %s", child.ws.WorkspaceName, parent.ws.WorkspaceName)
+	}
+	res, err = runGit(ctx, parent.root, nil, "merge", "--no-ff", "--no-edit", "-m", message, childHead)
+	if err != nil {
+		return rpckit.ErrInternalError
+	}
+	if res.exitCode != 0 {
+		conflicts, _ := unmergedPaths(ctx, parent.root)
+		if len(conflicts) == 0 {
+			return gitFailure("merge", res)
+		}
+		result.Conflicts = conflicts
+		return nil
+	}
+	result.Merged = true
+	return nil
+}
+
+func mergeWorkspacePatch(ctx context.Context, req WorkspaceMergeParams, parent, child lineageWorkspace, result *WorkspaceMergeResult) *rpckit.RPCError {
+	parentHead, rpcErr := gitOutputAt(ctx, parent.root, "rev-parse", "rev-parse", "HEAD")
+	if rpcErr != nil {
+		return rpcErr
+	}
+	childHead, childTree, rpcErr := snapshotWorkspaceTree(ctx, child.root, true)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	mergeBase, rpcErr := gitOutputAt(ctx, child.root, "merge-base", "merge-base", strings.TrimSpace(parentHead), childHead)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	mergeBase = strings.TrimSpace(mergeBase)
+
+	patch, rpcErr := gitOutputAt(ctx, child.root, "diff", "diff", "--binary", "--no-color", "--no-ext-diff", mergeBase, childTree)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	if changed, err := gitOutputAt(ctx, child.root, "diff", "diff", "--name-only", "-z", mergeBase, childTree); err == nil {
+		result.Files = splitNUL(changed)
+	}
+	if strings.TrimSpace(patch) == "" {
+		result.Merged = true
+		return nil
+	}
+
+	check, err := runGitWithStdin(ctx, parent.root, nil, patch, "apply", "--check", "--binary", "--whitespace=nowarn")
+	if err != nil {
+		return rpckit.ErrInternalError
+	}
+	if check.exitCode != 0 {
+		result.Conflicts = parseApplyFailures(check.stderr)
+	}
+
+	if req.DryRun {
+		return nil
+	}
+	if check.exitCode != 0 && !req.KeepConflicts {
+		return mergeConflictError(result)
+	}
+
+	args := []string{"apply", "--binary", "--whitespace=nowarn"}
+	if check.exitCode != 0 {
+		args = append(args, "--3way")
+	}
+	res, err := runGitWithStdin(ctx, parent.root, nil, patch, args...)
+	if err != nil {
+		return rpckit.ErrInternalError
+	}
+	if res.exitCode != 0 {
+		conflicts, _ := unmergedPaths(ctx, parent.root)
+		if len(conflicts) == 0 {
+			return gitFailure("apply", res)
+		}
+		result.Conflicts = conflicts
+		return nil
+	}
+	result.Merged = true
+	return nil
+}
+
+func mergeConflictError(result *WorkspaceMergeResult) *rpckit.RPCError {
+	return &rpckit.RPCError{
+		Code:    rpckit.ErrCheckoutConflict.Code,
+		Message: fmt.Sprintf("merge of %s into %s has conflicts in %d file(s); retry with keepConflicts=true to resolve manually", result.ChildWorkspaceID, result.ParentWorkspaceID, len(result.Conflicts)),
+		Data: map[string]any{
+			"kind":      "workspace.merge.conflict",
+			"mode":      result.Mode,
+			"conflicts": result.Conflicts,
+			"files":     result.Files,
+		},
+	}
+}
+
+// resolveLineagePair looks up two workspaces that share a lineage root and
+// have host git checkouts. An empty baseID defaults to head's parent.
+func resolveLineagePair(mgr *workspacemgr.Manager, baseID, headID string) (lineageWorkspace, lineageWorkspace, *rpckit.RPCError) {
+	var base, head lineageWorkspace
+	if mgr == nil {
+		return base, head, rpckit.ErrInternalError
+	}
+	headID = strings.TrimSpace(headID)
+	if headID == "" {
+		return base, head, rpckit.ErrInvalidParams
+	}
+	headWS, ok := mgr.Get(headID)
+	if !ok {
+		return base, head, rpckit.ErrWorkspaceNotFound
+	}
+	baseID = strings.TrimSpace(baseID)
+	if baseID == "" {
+		baseID = strings.TrimSpace(headWS.ParentWorkspaceID)
+	}
+	if baseID == "" {
+		return base, head, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("workspace %s has no parent; specify the other workspace explicitly", headID)}
+	}
+	if baseID == headID {
+		return base, head, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "cannot compare a workspace with itself"}
+	}
+	baseWS, ok := mgr.Get(baseID)
+	if !ok {
+		return base, head, rpckit.ErrWorkspaceNotFound
+	}
+	if lineageRootOf(baseWS) != lineageRootOf(headWS) {
+		return base, head, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("workspaces %s and %s are not in the same lineage", baseID, headID)}
+	}
+
+	base = lineageWorkspace{ws: baseWS, root: lineageGitRoot(baseWS)}
+	head = lineageWorkspace{ws: headWS, root: lineageGitRoot(headWS)}
+	for _, lw := range []lineageWorkspace{base, head} {
+		if lw.root == "" {
+			return base, head, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("workspace %s has no local git checkout", lw.ws.ID)}
+		}
+	}
+	return base, head, nil
+}
+
+func lineageRootOf(ws *workspacemgr.Workspace) string {
+	if root := strings.TrimSpace(ws.LineageRootID); root != "" {
+		return root
+	}
+	return ws.ID
+}
+
+func lineageGitRoot(ws *workspacemgr.Workspace) string {
+	root := preferredProjectRootForRuntime(ws)
+	if root == "" {
+		return ""
+	}
+	if _, err := runGitAt(root, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return ""
+	}
+	return root
+}
+
+// snapshotWorkspaceTree returns the HEAD commit of the worktree at root and a
+// tree object for its state. With includeUncommitted the tree is written from
+// a throwaway index that also contains modified and untracked files, so the
+// real index and working tree are left untouched.
+func snapshotWorkspaceTree(ctx context.Context, root string, includeUncommitted bool) (string, string, *rpckit.RPCError) {
+	commit, rpcErr := gitOutputAt(ctx, root, "rev-parse", "rev-parse", "--verify", "HEAD")
+	if rpcErr != nil {
+		return "", "", rpcErr
+	}
+	commit = strings.TrimSpace(commit)
+	if !includeUncommitted {
+		tree, rpcErr := gitOutputAt(ctx, root, "rev-parse", "rev-parse", commit+"^{tree}")
+		if rpcErr != nil {
+			return "", "", rpcErr
+		}
+		return commit, strings.TrimSpace(tree), nil
+	}
+
+	indexPath, rpcErr := gitOutputAt(ctx, root, "rev-parse", "rev-parse", "--git-path", "index")
+	if rpcErr != nil {
+		return "", "", rpcErr
+	}
+	indexPath = strings.TrimSpace(indexPath)
+	if !filepath.IsAbs(indexPath) {
+		indexPath = filepath.Join(root, indexPath)
+	}
+
+	tmp, err := os.CreateTemp("", "nexus-snapshot-index-*")
+	if err != nil {
+		return "", "", rpckit.ErrInternalError
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	// Seeding from the real index keeps git's stat cache, so only files that
+	// actually changed get rehashed.
+	seeded := false
+	if src, err := os.Open(indexPath); err == nil {
+		n, copyErr := io.Copy(tmp, src)
+		src.Close()
+		if copyErr != nil {
+			tmp.Close()
+			return "", "", rpckit.ErrInternalError
+		}
+		seeded = n > 0
+	}
+	tmp.Close()
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+tmpPath)
+	if !seeded {
+		_ = os.Remove(tmpPath)
+		res, err := runGit(ctx, root, env, "read-tree", commit)
+		if err != nil {
+			return "", "", rpckit.ErrInternalError
+		}
+		if res.exitCode != 0 {
+			return "", "", gitFailure("read-tree", res)
+		}
+	}
+	marker := filepath.Base(workspacemgr.HostWorkspaceMarkerPath(root))
+	res, err := runGit(ctx, root, env, "add", "-A", "--", ".", ":(exclude)"+marker)
+	if err != nil {
+		return "", "", rpckit.ErrInternalError
+	}
+	if res.exitCode != 0 {
+		return "", "", gitFailure("add", res)
+	}
+	res, err = runGit(ctx, root, env, "write-tree")
+	if err != nil {
+		return "", "", rpckit.ErrInternalError
+	}
+	if res.exitCode != 0 {
+		return "", "", gitFailure("write-tree", res)
+	}
+	return commit, strings.TrimSpace(res.stdout), nil
+}
+
+// diffGitRevisions runs numstat and (unless statOnly) patch diffs between two
+// revisions or trees and returns the merged per-file view.
+func diffGitRevisions(ctx context.Context, dir string, statOnly bool, from, to string, paths []string) ([]GitDiffFile, *rpckit.RPCError) {
+	revs := append([]string{from, to, "--"}, paths...)
+	numstat, rpcErr := gitOutputAt(ctx, dir, "diff", append([]string{"diff", "--numstat", "-z", "-M"}, revs...)...)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	files := parseGitNumstat(numstat)
+	if statOnly {
+		return files, nil
+	}
+	patch, rpcErr := gitOutputAt(ctx, dir, "diff", append([]string{"diff", "--no-color", "--no-ext-diff", "-M"}, revs...)...)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return mergeGitPatch(files, parseGitPatch(patch)), nil
+}
+
+func unmergedPaths(ctx context.Context, dir string) ([]string, *rpckit.RPCError) {
+	out, rpcErr := gitOutputAt(ctx, dir, "diff", "diff", "--name-only", "--diff-filter=U", "-z")
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return splitNUL(out), nil
+}
+
+func hasWorkspaceChanges(statusPorcelain string, root string) bool {
+	marker := filepath.Base(workspacemgr.HostWorkspaceMarkerPath(root))
+	for _, line := range splitNonEmptyLines(statusPorcelain) {
+		if len(line) > 3 && strings.TrimSpace(line[3:]) == marker {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// parseApplyFailures extracts paths from `git apply --check` errors such as
+// "error: patch failed: a.txt:1" and "error: a.txt: does not exist in index".
+func parseApplyFailures(stderr string) []string {
+	paths := []string{}
+	for _, line := range splitNonEmptyLines(stderr) {
+		rest, ok := strings.CutPrefix(line, "error: ")
+		if !ok {
+			continue
+		}
+		if p, ok := strings.CutPrefix(rest, "patch failed: "); ok {
+			if idx := strings.LastIndexByte(p, ':'); idx > 0 {
+				p = p[:idx]
+			}
+			paths = append(paths, p)
+			continue
+		}
+		if idx := strings.Index(rest, ": "); idx > 0 {
+			paths = append(paths, rest[:idx])
+		}
+	}
+	return dedupeStrings(paths)
+}
+
+func splitNonEmptyLines(s string) []string {
+	out := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			out = append(out, strings.TrimRight(line, "\r"))
+		}
+	}
+	return out
+}
+
+func splitNUL(s string) []string {
+	out := []string{}
+	for _, part := range strings.Split(s, "\x00") {
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func dedupeStrings(in []string) []string {
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+func setupLineageWorkspaces(t *testing.T) (*workspacemgr.Manager, *workspacemgr.Workspace, *workspacemgr.Workspace) {
+	t.Helper()
+	repoRoot := initGitRepoForCheckoutHandlerTests(t)
+	mgr := workspacemgr.NewManager(t.TempDir())
+	parent, err := mgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          repoRoot,
+		Ref:           "main",
+		WorkspaceName: "alpha",
+		AgentProfile:  "default",
+	})
+	if err != nil {
+		t.Fatalf("create parent: %v", err)
+	}
+	child, err := mgr.Fork(parent.ID, "alpha-child", "alpha-child")
+	if err != nil {
+		t.Fatalf("fork child: %v", err)
+	}
+	for _, ws := range []*workspacemgr.Workspace{parent, child} {
+		runGitForCheckoutHandlerTests(t, ws.LocalWorktreePath, "config", "user.email", "nexus-tests@example.com")
+		runGitForCheckoutHandlerTests(t, ws.LocalWorktreePath, "config", "user.name", "Nexus Tests")
+	}
+	return mgr, parent, child
+}
+
+func writeLineageFile(t *testing.T, ws *workspacemgr.Workspace, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(ws.LocalWorktreePath, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func TestHandleWorkspaceDiff_IncludesUncommittedChildChanges(t *testing.T) {
+	mgr, parent, child := setupLineageWorkspaces(t)
+	writeLineageFile(t, child, "README.md", "# test\nchild edit\n")
+	writeLineageFile(t, child, "notes.txt", "untracked\n")
+
+	res, rpcErr := HandleWorkspaceDiff(context.Background(), WorkspaceDiffParams{HeadWorkspaceID: child.ID}, mgr)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if res.BaseWorkspaceID != parent.ID {
+		t.Fatalf("expected base to default to parent %s, got %s", parent.ID, res.BaseWorkspaceID)
+	}
+	byPath := map[string]GitDiffFile{}
+	for _, f := range res.Files {
+		byPath[f.Path] = f
+	}
+	if len(byPath) != 2 {
+		t.Fatalf("expected README.md and notes.txt only, got %+v", res.Files)
+	}
+	if f := byPath["README.md"]; f.Additions != 1 || len(f.Hunks) == 0 {
+		t.Fatalf("unexpected README.md diff: %+v", f)
+	}
+	if f := byPath["notes.txt"]; f.Additions != 1 {
+		t.Fatalf("unexpected notes.txt diff: %+v", f)
+	}
+
+	committed, rpcErr := HandleWorkspaceDiff(context.Background(), WorkspaceDiffParams{HeadWorkspaceID: child.ID, CommittedOnly: true}, mgr)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if len(committed.Files) != 0 {
+		t.Fatalf("expected no committed differences, got %+v", committed.Files)
+	}
+
+	status, err := runGitAt(child.LocalWorktreePath, "status", "--porcelain")
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if strings.Contains(status, "A ") {
+		t.Fatalf("expected diff to leave the real index untouched, got status %q", status)
+	}
+}
+
+func TestHandleWorkspaceDiff_RejectsWorkspacesOutsideLineage(t *testing.T) {
+	mgr, parent, _ := setupLineageWorkspaces(t)
+	other, err := mgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          initGitRepoForCheckoutHandlerTests(t),
+		Ref:           "main",
+		WorkspaceName: "other",
+		AgentProfile:  "default",
+	})
+	if err != nil {
+		t.Fatalf("create other: %v", err)
+	}
+
+	_, rpcErr := HandleWorkspaceDiff(context.Background(), WorkspaceDiffParams{BaseWorkspaceID: parent.ID, HeadWorkspaceID: other.ID}, mgr)
+	if rpcErr == nil || rpcErr.Code != rpckit.ErrInvalidParams.Code {
+		t.Fatalf("expected invalid params for unrelated workspaces, got %+v", rpcErr)
+	}
+	_, rpcErr = HandleWorkspaceDiff(context.Background(), WorkspaceDiffParams{HeadWorkspaceID: parent.ID}, mgr)
+	if rpcErr == nil || !strings.Contains(rpcErr.Message, "no parent") {
+		t.Fatalf("expected missing parent error for root workspace, got %+v", rpcErr)
+	}
+}
+
+func TestHandleWorkspaceMerge_CommitsMode(t *testing.T) {
+	mgr, parent, child := setupLineageWorkspaces(t)
+	writeLineageFile(t, child, "feature.txt", "feature\n")
+	runGitForCheckoutHandlerTests(t, child.LocalWorktreePath, "add", "feature.txt")
+	runGitForCheckoutHandlerTests(t, child.LocalWorktreePath, "commit", "-m", "add feature")
+
+	dry, rpcErr := HandleWorkspaceMerge(context.Background(), WorkspaceMergeParams{ChildWorkspaceID: child.ID, DryRun: true}, mgr)
+	if rpcErr != nil {
+		t.Fatalf("dry run: %+v", rpcErr)
+	}
+	if dry.Merged || !dry.Clean || len(dry.Files) != 1 || dry.Files[0] != "feature.txt" {
+		t.Fatalf("unexpected dry run result: %+v", dry)
+	}
+	if _, err := os.Stat(filepath.Join(parent.LocalWorktreePath, "feature.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected dry run to leave parent untouched, stat err=%v", err)
+	}
+
+	res, rpcErr := HandleWorkspaceMerge(context.Background(), WorkspaceMergeParams{ChildWorkspaceID: child.ID}, mgr)
+	if rpcErr != nil {
+		t.Fatalf("merge: %+v", rpcErr)
+	}
+	if !res.Merged || res.Commit == "" {
+		t.Fatalf("expected merged result with commit, got %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(parent.LocalWorktreePath, "feature.txt")); err != nil {
+		t.Fatalf("expected feature.txt in parent: %v", err)
+	}
+	updated, _ := mgr.Get(parent.ID)
+	if updated.CurrentCommit != res.Commit {
+		t.Fatalf("expected parent current commit %s, got %s", res.Commit, updated.CurrentCommit)
+	}
+}
+
+func TestHandleWorkspaceMerge_ReportsConflictsWithoutTouchingParent(t *testing.T) {
+	mgr, parent, child := setupLineageWorkspaces(t)
+	writeLineageFile(t, parent, "README.md", "# parent\n")
+	runGitForCheckoutHandlerTests(t, parent.LocalWorktreePath, "commit", "-am", "parent edit")
+	writeLineageFile(t, child, "README.md", "# child\n")
+	runGitForCheckoutHandlerTests(t, child.LocalWorktreePath, "commit", "-am", "child edit")
+
+	_, rpcErr := HandleWorkspaceMerge(context.Background(), WorkspaceMergeParams{ChildWorkspaceID: child.ID}, mgr)
+	if rpcErr == nil || rpcErr.Code != rpckit.ErrCheckoutConflict.Code {
+		t.Fatalf("expected conflict error, got %+v", rpcErr)
+	}
+	data, _ := rpcErr.Data.(map[string]any)
+	conflicts, _ := data["conflicts"].([]string)
+	if len(conflicts) != 1 || conflicts[0] != "README.md" {
+		t.Fatalf("expected README.md conflict, got %#v", data["conflicts"])
+	}
+	content, _ := os.ReadFile(filepath.Join(parent.LocalWorktreePath, "README.md"))
+	if string(content) != "# parent\n" {
+		t.Fatalf("expected parent untouched, got %q", content)
+	}
+}
+
+func TestHandleWorkspaceMerge_PatchModeAppliesWorkingTree(t *testing.T) {
+	mgr, parent, child := setupLineageWorkspaces(t)
+	writeLineageFile(t, child, "README.md", "# test\nuncommitted\n")
+	writeLineageFile(t, child, "new.txt", "brand new\n")
+
+	res, rpcErr := HandleWorkspaceMerge(context.Background(), WorkspaceMergeParams{ChildWorkspaceID: child.ID, Mode: "patch"}, mgr)
+	if rpcErr != nil {
+		t.Fatalf("patch merge: %+v", rpcErr)
+	}
+	if !res.Merged || !res.ChildDirty || len(res.Files) != 2 {
+		t.Fatalf("unexpected patch merge result: %+v", res)
+	}
+	content, _ := os.ReadFile(filepath.Join(parent.LocalWorktreePath, "README.md"))
+	if string(content) != "# test\nuncommitted\n" {
+		t.Fatalf("expected patch applied to parent README.md, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(parent.LocalWorktreePath, "new.txt")); err != nil {
+		t.Fatalf("expected new.txt in parent: %v", err)
+	}
+
+	if _, rpcErr := HandleWorkspaceMerge(context.Background(), WorkspaceMergeParams{ChildWorkspaceID: child.ID, Mode: "rebase"}, mgr); rpcErr == nil || rpcErr.Code != rpckit.ErrInvalidParams.Code {
+		t.Fatalf("expected invalid mode error, got %+v", rpcErr)
+	}
+}
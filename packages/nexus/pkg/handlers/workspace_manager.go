@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/inizio/nexus/packages/nexus/pkg/config"
+	"github.com/inizio/nexus/packages/nexus/pkg/lifecycle"
 	"github.com/inizio/nexus/packages/nexus/pkg/projectmgr"
 	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
 	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
@@ -38,6 +39,10 @@ type WorkspaceCreateParams struct {
 	Backend           string                  `json:"backend,omitempty"`
 	AuthBinding       map[string]string       `json:"authBinding,omitempty"`
 	ConfigBundle      string                  `json:"configBundle,omitempty"`
+	// Template names a project workspace template ("name" or "name@revision")
+	// whose defaults fill any params left unset.
+	Template         string `json:"template,omitempty"`
+	TemplateRevision int    `json:"templateRevision,omitempty"`
 }
 
 type WorkspaceOpenParams struct {
@@ -85,6 +90,14 @@ type WorkspaceCreateResult struct {
 	SourceWorkspaceID     string                  `json:"sourceWorkspaceId,omitempty"`
 	UsedLineageSnapshotID string                  `json:"usedLineageSnapshotId,omitempty"`
 	FreshApplied          bool                    `json:"freshApplied"`
+	// Template is the template revision applied, if any.
+	Template      *projectmgr.WorkspaceTemplate `json:"template,omitempty"`
+	TemplateHooks []TemplateHookResult          `json:"templateHooks,omitempty"`
+	// TemplateServices reports the template's services and readiness
+	// profile, started once the setup hooks pass.
+	TemplateServices *TemplateServicesResult `json:"templateServices,omitempty"`
+	// Hooks are the workspace.json lifecycle hooks run for the new workspace.
+	Hooks []lifecycle.HookResult `json:"hooks,omitempty"`
 }
 
 type WorkspaceOpenResult struct {
@@ -105,16 +118,19 @@ type WorkspaceStopResult struct {
 
 type WorkspaceStartResult struct {
 	Workspace *workspacemgr.Workspace `json:"workspace"`
+	Hooks     []lifecycle.HookResult  `json:"hooks,omitempty"`
 }
 
 type WorkspaceRestoreResult struct {
 	Restored  bool                    `json:"restored"`
 	Workspace *workspacemgr.Workspace `json:"workspace,omitempty"`
+	Hooks     []lifecycle.HookResult  `json:"hooks,omitempty"`
 }
 
 type WorkspaceForkResult struct {
 	Forked    bool                    `json:"forked"`
 	Workspace *workspacemgr.Workspace `json:"workspace,omitempty"`
+	Hooks     []lifecycle.HookResult  `json:"hooks,omitempty"`
 }
 
 type WorkspaceCheckoutResult struct {
@@ -132,6 +148,11 @@ func HandleWorkspaceCreateWithProjects(ctx context.Context, req WorkspaceCreateP
 	if resolveErr != nil {
 		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: resolveErr.Error()}
 	}
+	tmpl, rpcErr := resolveCreateTemplate(req, spec, projMgr)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	spec = applyTemplateToSpec(spec, tmpl)
 	sourceHint := resolveCreateSourceHint(mgr, req, spec)
 	if shouldUseProjectRootPathForBase(req, spec, mgr) {
 		spec.UseProjectRootPath = true
@@ -215,6 +236,16 @@ func HandleWorkspaceCreateWithProjects(ctx context.Context, req WorkspaceCreateP
 		}
 	}
 
+	if tmpl != nil {
+		if setErr := mgr.SetTemplate(ws.ID, tmpl.Name, tmpl.Revision, templateRuntimeOptions(tmpl)); setErr != nil {
+			_ = mgr.Remove(ws.ID)
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("workspace create template persist failed: %v", setErr)}
+		}
+		if updatedWS, ok := mgr.Get(ws.ID); ok {
+			ws = updatedWS
+		}
+	}
+
 	log.Printf("[workspace.create] Workspace %s created, ensuring runtime...", ws.ID)
 
 	if rpcErr := ensureLocalRuntimeWorkspace(ctx, ws, factory, mgr, spec.ConfigBundle); rpcErr != nil {
@@ -249,6 +280,7 @@ func HandleWorkspaceCreateWithProjects(ctx context.Context, req WorkspaceCreateP
 		SourceWorkspaceID:     strings.TrimSpace(sourceHint.SourceWorkspaceID),
 		UsedLineageSnapshotID: usedSnapshotID,
 		FreshApplied:          req.Fresh,
+		Template:              tmpl,
 	}, nil
 }
 
@@ -611,62 +643,76 @@ func HandleWorkspaceRestore(ctx context.Context, req WorkspaceRestoreParams, mgr
 }
 
 func HandleWorkspaceFork(ctx context.Context, req WorkspaceForkParams, mgr *workspacemgr.Manager, factory *runtime.Factory) (*WorkspaceForkResult, *rpckit.RPCError) {
+	result, _, rpcErr := forkWorkspace(ctx, req, mgr, factory, "")
+	return result, rpcErr
+}
+
+// forkWorkspace forks req.ID and returns the snapshot checkpointed for the
+// child, if any. When sharedSnapshotID is set the runtime checkpoint is skipped
+// and the child reuses that snapshot, so batch forks only pause the parent once.
+func forkWorkspace(ctx context.Context, req WorkspaceForkParams, mgr *workspacemgr.Manager, factory *runtime.Factory, sharedSnapshotID string) (*WorkspaceForkResult, string, *rpckit.RPCError) {
 	requestedParent, ok := mgr.Get(req.ID)
 	if !ok {
-		return nil, rpckit.ErrWorkspaceNotFound
+		return nil, "", rpckit.ErrWorkspaceNotFound
 	}
 	forkSource := resolveProjectRootForkSource(mgr, requestedParent)
 	if explicitSourceID := strings.TrimSpace(req.SourceWorkspaceID); explicitSourceID != "" {
 		explicitSource, explicitOK := mgr.Get(explicitSourceID)
 		if !explicitOK || explicitSource == nil {
-			return nil, rpckit.ErrWorkspaceNotFound
+			return nil, "", rpckit.ErrWorkspaceNotFound
 		}
 		// Keep explicit override bounded to the same project/repo scope.
 		if strings.TrimSpace(explicitSource.ProjectID) != strings.TrimSpace(requestedParent.ProjectID) ||
 			strings.TrimSpace(explicitSource.RepoID) != strings.TrimSpace(requestedParent.RepoID) {
-			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "sourceWorkspaceId must belong to the same project and repo"}
+			return nil, "", &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "sourceWorkspaceId must belong to the same project and repo"}
 		}
 		forkSource = explicitSource
 	}
 	child, err := mgr.Fork(forkSource.ID, req.ChildWorkspaceName, req.ChildRef)
 	if err != nil {
 		if strings.Contains(strings.ToLower(err.Error()), "workspace not found") {
-			return nil, rpckit.ErrWorkspaceNotFound
+			return nil, "", rpckit.ErrWorkspaceNotFound
 		}
-		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+		return nil, "", &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
 	}
 
+	checkpointID := ""
 	if factory != nil {
 		parent, ok := mgr.Get(forkSource.ID)
 		if !ok {
-			return nil, rpckit.ErrWorkspaceNotFound
+			return nil, "", rpckit.ErrWorkspaceNotFound
 		}
 
 		driver, selErr := selectDriverForWorkspaceBackend(factory, parent.Backend)
 		if selErr != nil {
-			return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("backend selection failed: %v", selErr)}
+			return nil, "", &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("backend selection failed: %v", selErr)}
 		}
 		if forkErr := driver.Fork(context.Background(), parent.ID, child.ID); forkErr != nil {
-			return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("runtime fork failed: %v", forkErr)}
+			return nil, "", &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("runtime fork failed: %v", forkErr)}
 		}
 
-		if snapshotter, ok := driver.(runtime.ForkSnapshotter); ok {
+		if strings.TrimSpace(sharedSnapshotID) != "" {
+			if setErr := mgr.SetLineageSnapshot(child.ID, sharedSnapshotID); setErr != nil {
+				return nil, "", &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("workspace snapshot persist failed: %v", setErr)}
+			}
+		} else if snapshotter, ok := driver.(runtime.ForkSnapshotter); ok {
 			if snapshotID, snapErr := snapshotter.CheckpointFork(ctx, parent.ID, child.ID); snapErr != nil {
-				return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("runtime fork checkpoint failed: %v", snapErr)}
+				return nil, "", &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("runtime fork checkpoint failed: %v", snapErr)}
 			} else if strings.TrimSpace(snapshotID) != "" {
 				if setErr := mgr.SetLineageSnapshot(child.ID, snapshotID); setErr != nil {
-					return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("workspace snapshot persist failed: %v", setErr)}
+					return nil, "", &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("workspace snapshot persist failed: %v", setErr)}
 				}
+				checkpointID = strings.TrimSpace(snapshotID)
 			}
 		}
 	}
 
 	updatedChild, ok := mgr.Get(child.ID)
 	if !ok {
-		return nil, rpckit.ErrWorkspaceNotFound
+		return nil, "", rpckit.ErrWorkspaceNotFound
 	}
 	enrichWorkspaceRuntimeLabel(updatedChild)
-	return &WorkspaceForkResult{Forked: true, Workspace: updatedChild}, nil
+	return &WorkspaceForkResult{Forked: true, Workspace: updatedChild}, checkpointID, nil
 }
 
 func resolveProjectRootForkSource(mgr *workspacemgr.Manager, requestedParent *workspacemgr.Workspace) *workspacemgr.Workspace {
@@ -1001,6 +1047,12 @@ func ensureLocalRuntimeWorkspace(ctx context.Context, ws *workspacemgr.Workspace
 	if strings.TrimSpace(ws.LineageSnapshotID) != "" {
 		options["lineage_snapshot_id"] = strings.TrimSpace(ws.LineageSnapshotID)
 	}
+	for k, v := range ws.RuntimeOptions {
+		if k == "vm.mode" && !isVMIsolationBackend(ws.Backend) {
+			continue
+		}
+		options[k] = v
+	}
 	var settingsRepo store.SandboxResourceSettingsRepository
 	if mgr != nil {
 		settingsRepo = mgr.SandboxResourceSettingsRepository()
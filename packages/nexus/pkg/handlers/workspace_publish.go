@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/authrelay"
+	"github.com/inizio/nexus/packages/nexus/pkg/forge"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+type WorkspacePublishParams struct {
+	WorkspaceID string `json:"workspaceId"`
+	Remote      string `json:"remote,omitempty"`
+	// Base is the pull request target branch. Defaults to the ref the
+	// workspace was derived from, then the remote's default branch.
+	Base  string `json:"base,omitempty"`
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Draft bool   `json:"draft,omitempty"`
+	Force bool   `json:"force,omitempty"`
+	// Forge is github, gitlab or gitea; detected from the remote host when empty.
+	Forge      string `json:"forge,omitempty"`
+	APIBaseURL string `json:"apiBaseUrl,omitempty"`
+	// Repository overrides the owner/name parsed from the remote URL.
+	Repository string `json:"repository,omitempty"`
+	// PushOnly pushes the branch without touching the forge API.
+	PushOnly       bool   `json:"pushOnly,omitempty"`
+	AuthRelayToken string `json:"authRelayToken,omitempty"`
+}
+
+type WorkspacePublishResult struct {
+	WorkspaceID string             `json:"workspaceId"`
+	Remote      string             `json:"remote"`
+	Branch      string             `json:"branch"`
+	Base        string             `json:"base,omitempty"`
+	Commit      string             `json:"commit"`
+	Pushed      bool               `json:"pushed"`
+	PushOutput  string             `json:"pushOutput,omitempty"`
+	Forge       string             `json:"forge,omitempty"`
+	PullRequest *forge.PullRequest `json:"pullRequest,omitempty"`
+	Created     bool               `json:"created"`
+}
+
+// HandleWorkspacePublish pushes the workspace branch using relayed
+// credentials and opens, or updates, the matching pull request on the forge.
+// The pull request URL is stored on the workspace record.
+func HandleWorkspacePublish(ctx context.Context, req WorkspacePublishParams, mgr *workspacemgr.Manager, broker *authrelay.Broker) (*WorkspacePublishResult, *rpckit.RPCError) {
+	workspaceID := strings.TrimSpace(req.WorkspaceID)
+	if workspaceID == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	if mgr == nil {
+		return nil, rpckit.ErrInternalError
+	}
+	ws, ok := mgr.Get(workspaceID)
+	if !ok {
+		return nil, rpckit.ErrWorkspaceNotFound
+	}
+	root := lineageGitRoot(ws)
+	if root == "" {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("workspace %s has no host git checkout", ws.ID)}
+	}
+	remote, rpcErr := gitRemoteName(GitRemoteParams{Remote: req.Remote})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if req.AuthRelayToken == "" && !req.PushOnly {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "authRelayToken is required to open a pull request"}
+	}
+
+	branch, rpcErr := gitOutputAt(ctx, root, "rev-parse", "rev-parse", "--abbrev-ref", "HEAD")
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	branch = strings.TrimSpace(branch)
+	if branch == "" || branch == "HEAD" {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "workspace HEAD is detached; check out a branch before publishing"}
+	}
+	commit, rpcErr := gitOutputAt(ctx, root, "rev-parse", "rev-parse", "HEAD")
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	commit = strings.TrimSpace(commit)
+
+	var injected map[string]string
+	if req.AuthRelayToken != "" {
+		if broker == nil {
+			return nil, rpckit.ErrAuthRelayInvalid
+		}
+		injected, ok = broker.Consume(req.AuthRelayToken, ws.ID)
+		if !ok {
+			return nil, rpckit.ErrAuthRelayInvalid
+		}
+	}
+
+	pushArgs := []string{"push", "--porcelain", "--set-upstream"}
+	if req.Force {
+		pushArgs = append(pushArgs, "--force-with-lease")
+	}
+	pushArgs = append(pushArgs, remote, "HEAD:refs/heads/"+branch)
+	pushed, rpcErr := runGitNetwork(ctx, root, injected, "push", remote, pushArgs)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	_ = mgr.SetCurrentCommit(ws.ID, commit)
+
+	result := &WorkspacePublishResult{
+		WorkspaceID: ws.ID,
+		Remote:      remote,
+		Branch:      branch,
+		Commit:      commit,
+		Pushed:      true,
+		PushOutput:  pushed.Output,
+	}
+	if req.PushOnly {
+		return result, nil
+	}
+
+	adapter, repo, rpcErr := publishForgeAdapter(ctx, root, remote, req, injected["NEXUS_AUTH_VALUE"])
+	if rpcErr != nil {
+		return nil, publishError(rpcErr.Message, result)
+	}
+	result.Forge = adapter.Kind()
+
+	base := strings.TrimSpace(req.Base)
+	if base == "" {
+		base = publishDefaultBase(ctx, root, remote, ws, branch)
+	}
+	if base == branch {
+		return nil, publishError(fmt.Sprintf("base branch %q is the same as the workspace branch", base), result)
+	}
+	result.Base = base
+
+	spec := forge.PullRequestSpec{Head: branch, Base: base, Title: strings.TrimSpace(req.Title), Body: req.Body, Draft: req.Draft}
+	if spec.Title == "" {
+		subject, _ := gitOutputAt(ctx, root, "log", "log", "-1", "--format=%s")
+		spec.Title = strings.TrimSpace(subject)
+	}
+
+	existing, err := adapter.FindOpenPullRequest(ctx, repo, branch, base)
+	if err != nil {
+		return nil, publishError(err.Error(), result)
+	}
+	var pr *forge.PullRequest
+	if existing != nil {
+		pr, err = adapter.UpdatePullRequest(ctx, repo, existing.Number, spec)
+	} else {
+		pr, err = adapter.CreatePullRequest(ctx, repo, spec)
+		result.Created = err == nil
+	}
+	if err != nil {
+		return nil, publishError(err.Error(), result)
+	}
+	result.PullRequest = pr
+	if err := mgr.SetPullRequest(ws.ID, pr.URL, pr.Number); err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("persist pull request: %v", err)}
+	}
+	return result, nil
+}
+
+func publishForgeAdapter(ctx context.Context, root, remote string, req WorkspacePublishParams, token string) (forge.Adapter, string, *rpckit.RPCError) {
+	kind := strings.ToLower(strings.TrimSpace(req.Forge))
+	apiBase := strings.TrimSpace(req.APIBaseURL)
+	repo := strings.Trim(strings.TrimSpace(req.Repository), "/")
+
+	if kind == "" || apiBase == "" || repo == "" {
+		remoteURL, rpcErr := gitOutputAt(ctx, root, "remote", "remote", "get-url", remote)
+		if rpcErr != nil {
+			return nil, "", rpcErr
+		}
+		parsed, err := forge.ParseRemote(remoteURL)
+		if err != nil {
+			return nil, "", &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+		}
+		if repo == "" {
+			repo = parsed.Repo
+		}
+		if kind == "" {
+			kind = forge.DetectKind(parsed.Host)
+		}
+		if kind == "" {
+			return nil, "", &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("cannot detect forge for host %s; set forge to github, gitlab or gitea", parsed.Host)}
+		}
+		if apiBase == "" {
+			apiBase = forge.DefaultAPIBaseURL(kind, parsed.Host)
+		}
+	}
+	adapter, err := forge.New(forge.Config{Kind: kind, APIBaseURL: apiBase, Token: token})
+	if err != nil {
+		return nil, "", &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	return adapter, repo, nil
+}
+
+// publishDefaultBase prefers the ref the workspace was derived from, then the
+// remote's default branch, then main.
+func publishDefaultBase(ctx context.Context, root, remote string, ws *workspacemgr.Workspace, branch string) string {
+	if derived := strings.TrimSpace(ws.DerivedFromRef); derived != "" && derived != branch {
+		return derived
+	}
+	if head, rpcErr := gitOutputAt(ctx, root, "symbolic-ref", "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD"); rpcErr == nil {
+		if name := strings.TrimPrefix(strings.TrimSpace(head), remote+"/"); name != "" && name != branch {
+			return name
+		}
+	}
+	return "main"
+}
+
+// publishError reports a forge failure after the branch has already been
+// pushed, so callers can tell the push itself succeeded.
+func publishError(msg string, result *WorkspacePublishResult) *rpckit.RPCError {
+	return &rpckit.RPCError{
+		Code:    rpckit.ErrInternalError.Code,
+		Message: "publish: " + msg,
+		Data: map[string]any{
+			"pushed": result.Pushed,
+			"branch": result.Branch,
+			"commit": result.Commit,
+		},
+	}
+}
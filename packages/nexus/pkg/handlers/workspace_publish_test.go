@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/authrelay"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+)
+
+type githubStandIn struct {
+	mu      sync.Mutex
+	pulls   []map[string]any
+	auth    []string
+	patched int
+}
+
+func (g *githubStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.auth = append(g.auth, r.Header.Get("Authorization"))
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/acme/widgets/pulls":
+		_ = json.NewEncoder(w).Encode(g.pulls)
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/acme/widgets/pulls":
+		var in map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		pr := map[string]any{
+			"number":   len(g.pulls) + 1,
+			"html_url": "https://github.test/acme/widgets/pull/1",
+			"state":    "open",
+			"title":    in["title"],
+			"head":     map[string]any{"ref": in["head"]},
+			"base":     map[string]any{"ref": in["base"]},
+		}
+		g.pulls = append(g.pulls, pr)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(pr)
+	case r.Method == http.MethodPatch && r.URL.Path == "/repos/acme/widgets/pulls/1":
+		var in map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		g.patched++
+		g.pulls[0]["title"] = in["title"]
+		_ = json.NewEncoder(w).Encode(g.pulls[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestHandleWorkspacePublish_PushesAndOpensThenUpdatesPullRequest(t *testing.T) {
+	mgr, parent, child := setupLineageWorkspaces(t)
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	runGitIn(t, t.TempDir(), "init", "--bare", remote)
+	runGitIn(t, parent.LocalWorktreePath, "remote", "add", "origin", remote)
+
+	writeLineageFile(t, child, "feature.txt", "feature\n")
+	runGitIn(t, child.LocalWorktreePath, "add", "feature.txt")
+	runGitIn(t, child.LocalWorktreePath, "commit", "-m", "Add feature")
+
+	standIn := &githubStandIn{}
+	srv := httptest.NewServer(standIn)
+	defer srv.Close()
+
+	broker := authrelay.NewBroker()
+	params := WorkspacePublishParams{
+		WorkspaceID: child.ID,
+		Forge:       "github",
+		APIBaseURL:  srv.URL,
+		Repository:  "acme/widgets",
+	}
+	params.AuthRelayToken = broker.Mint(child.ID, map[string]string{"NEXUS_AUTH_VALUE": "ghp_test"}, time.Minute)
+	res, rpcErr := HandleWorkspacePublish(context.Background(), params, mgr, broker)
+	if rpcErr != nil {
+		t.Fatalf("publish: %+v", rpcErr)
+	}
+	if !res.Pushed || !res.Created || res.Branch != "alpha-child" || res.Base != "main" {
+		t.Fatalf("unexpected publish result: %+v", res)
+	}
+	if res.PullRequest == nil || res.PullRequest.Title != "Add feature" {
+		t.Fatalf("expected pull request titled from commit, got %+v", res.PullRequest)
+	}
+	if got := runGitIn(t, remote, "rev-parse", "alpha-child"); got != res.Commit {
+		t.Fatalf("expected remote branch at %s, got %s", res.Commit, got)
+	}
+	updated, _ := mgr.Get(child.ID)
+	if updated.PullRequestURL != res.PullRequest.URL || updated.PullRequestNumber != 1 {
+		t.Fatalf("expected pull request stored on workspace, got %q #%d", updated.PullRequestURL, updated.PullRequestNumber)
+	}
+
+	params.Title = "Add feature (v2)"
+	params.AuthRelayToken = broker.Mint(child.ID, map[string]string{"NEXUS_AUTH_VALUE": "ghp_test"}, time.Minute)
+	again, rpcErr := HandleWorkspacePublish(context.Background(), params, mgr, broker)
+	if rpcErr != nil {
+		t.Fatalf("republish: %+v", rpcErr)
+	}
+	if again.Created || standIn.patched != 1 || again.PullRequest.Title != "Add feature (v2)" {
+		t.Fatalf("expected existing pull request to be updated, got %+v (patched=%d)", again, standIn.patched)
+	}
+	for _, header := range standIn.auth {
+		if header != "Bearer ghp_test" {
+			t.Fatalf("expected relayed token on forge requests, got %q", header)
+		}
+	}
+}
+
+func TestHandleWorkspacePublish_RequiresRelayTokenForPullRequest(t *testing.T) {
+	mgr, _, child := setupLineageWorkspaces(t)
+	_, rpcErr := HandleWorkspacePublish(context.Background(), WorkspacePublishParams{WorkspaceID: child.ID}, mgr, authrelay.NewBroker())
+	if rpcErr == nil || rpcErr.Code != rpckit.ErrInvalidParams.Code || !strings.Contains(rpcErr.Message, "authRelayToken") {
+		t.Fatalf("expected missing token error, got %+v", rpcErr)
+	}
+}
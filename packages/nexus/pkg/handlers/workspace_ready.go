@@ -2,9 +2,19 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/inizio/nexus/packages/nexus/pkg/compose"
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
 	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
 	"github.com/inizio/nexus/packages/nexus/pkg/services"
 	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
@@ -29,14 +39,9 @@ var startOpencodeACP = func(ctx context.Context, svcMgr *services.Manager, works
 	return err
 }
 
-type WorkspaceReadyCheck struct {
-	Name          string   `json:"name"`
-	Type          string   `json:"type,omitempty"`
-	Command       string   `json:"command,omitempty"`
-	Args          []string `json:"args,omitempty"`
-	ServiceName   string   `json:"serviceName,omitempty"`
-	ExpectRunning *bool    `json:"expectRunning,omitempty"`
-}
+// WorkspaceReadyCheck is a single readiness probe; see config.ReadinessCheck
+// for the supported types.
+type WorkspaceReadyCheck = config.ReadinessCheck
 
 type WorkspaceReadyParams struct {
 	WorkspaceID string                `json:"workspaceId,omitempty"`
@@ -46,20 +51,48 @@ type WorkspaceReadyParams struct {
 	IntervalMs  int                   `json:"intervalMs,omitempty"`
 }
 
+// WorkspaceReadyCheckResult diagnoses one check after the last attempt.
+type WorkspaceReadyCheckResult struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Ready     bool   `json:"ready"`
+	Attempts  int    `json:"attempts"`
+	ExitCode  int    `json:"exitCode"`
+	LastError string `json:"lastError,omitempty"`
+}
+
 type WorkspaceReadyResult struct {
-	Ready       bool           `json:"ready"`
-	WorkspaceID string         `json:"workspaceId"`
-	Profile     string         `json:"profile,omitempty"`
-	ElapsedMs   int64          `json:"elapsedMs"`
-	Attempts    int            `json:"attempts"`
-	LastResults map[string]int `json:"lastResults"`
+	Ready       bool                        `json:"ready"`
+	WorkspaceID string                      `json:"workspaceId"`
+	Profile     string                      `json:"profile,omitempty"`
+	ElapsedMs   int64                       `json:"elapsedMs"`
+	Attempts    int                         `json:"attempts"`
+	LastResults map[string]int              `json:"lastResults"`
+	Checks      []WorkspaceReadyCheckResult `json:"checks"`
 }
 
-func HandleWorkspaceReady(ctx context.Context, p WorkspaceReadyParams, ws *workspace.Workspace, svcMgr *services.Manager) (*WorkspaceReadyResult, *rpckit.RPCError) {
+// WorkspaceReadyDeps are the workspace facilities readiness checks consult.
+type WorkspaceReadyDeps struct {
+	Services *services.Manager
+	Compose  *compose.Services
+	// Run executes argv inside the workspace. http and tcp checks go through
+	// it so they see the workspace's own network; when nil they are made
+	// from the daemon host.
+	Run func(ctx context.Context, argv []string) (compose.CommandResult, error)
+}
+
+const (
+	defaultReadyTimeout      = 30 * time.Second
+	defaultReadyCheckTimeout = 5 * time.Second
+	maxReadyHTTPBody         = 1 << 20
+	readyLogTail             = 500
+)
+
+func HandleWorkspaceReady(ctx context.Context, p WorkspaceReadyParams, ws *workspace.Workspace, deps WorkspaceReadyDeps) (*WorkspaceReadyResult, *rpckit.RPCError) {
 	if p.Profile != "" {
-		checks, ok := readinessProfileForWorkspace(ws.Path(), p.Profile)
-		if !ok {
-			return nil, rpckit.ErrInvalidParams
+		checks, err := readinessProfileForWorkspace(ws.Path(), p.Profile)
+		if err != nil {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
 		}
 		p.Checks = checks
 	}
@@ -67,8 +100,13 @@ func HandleWorkspaceReady(ctx context.Context, p WorkspaceReadyParams, ws *works
 	if len(p.Checks) == 0 {
 		return nil, rpckit.ErrInvalidParams
 	}
+	for _, check := range p.Checks {
+		if err := check.Validate(); err != nil {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("check %q: %v", check.Name, err)}
+		}
+	}
 
-	timeout := 2000 * time.Millisecond
+	timeout := defaultReadyTimeout
 	if p.TimeoutMs > 0 {
 		timeout = time.Duration(p.TimeoutMs) * time.Millisecond
 	}
@@ -86,38 +124,45 @@ func HandleWorkspaceReady(ctx context.Context, p WorkspaceReadyParams, ws *works
 	deadline := start.Add(timeout)
 	attempts := 0
 	last := map[string]int{}
+	results := make([]WorkspaceReadyCheckResult, len(p.Checks))
+	for i, check := range p.Checks {
+		results[i] = WorkspaceReadyCheckResult{Name: check.Name, Type: check.Kind()}
+	}
+
+	result := func(ready bool) *WorkspaceReadyResult {
+		return &WorkspaceReadyResult{
+			Ready:       ready,
+			WorkspaceID: workspaceID,
+			Profile:     p.Profile,
+			ElapsedMs:   time.Since(start).Milliseconds(),
+			Attempts:    attempts,
+			LastResults: last,
+			Checks:      results,
+		}
+	}
 
 	for {
 		attempts++
 		allOK := true
-		for _, check := range p.Checks {
-			code, ok := runReadinessCheck(ctx, check, ws, workspaceID, svcMgr)
+		for i, check := range p.Checks {
+			code, err := runReadinessCheck(ctx, check, ws, workspaceID, deps)
 			last[check.Name] = code
-			if !ok {
+			results[i].Attempts++
+			results[i].ExitCode = code
+			results[i].Ready = err == nil
+			results[i].LastError = ""
+			if err != nil {
+				results[i].LastError = err.Error()
 				allOK = false
 			}
 		}
 
 		if allOK {
-			return &WorkspaceReadyResult{
-				Ready:       true,
-				WorkspaceID: workspaceID,
-				Profile:     p.Profile,
-				ElapsedMs:   time.Since(start).Milliseconds(),
-				Attempts:    attempts,
-				LastResults: last,
-			}, nil
+			return result(true), nil
 		}
 
 		if time.Now().After(deadline) {
-			return &WorkspaceReadyResult{
-				Ready:       false,
-				WorkspaceID: workspaceID,
-				Profile:     p.Profile,
-				ElapsedMs:   time.Since(start).Milliseconds(),
-				Attempts:    attempts,
-				LastResults: last,
-			}, nil
+			return result(false), nil
 		}
 
 		select {
@@ -128,68 +173,241 @@ func HandleWorkspaceReady(ctx context.Context, p WorkspaceReadyParams, ws *works
 	}
 }
 
-func runReadinessCheck(ctx context.Context, check WorkspaceReadyCheck, ws *workspace.Workspace, workspaceID string, svcMgr *services.Manager) (int, bool) {
-	switch checkType(check) {
+// runReadinessCheck runs one attempt of check. It returns an exit-code style
+// status (0 ready, 1 not ready, -1 could not probe, or the command's exit
+// code) and an error describing why the check is not ready.
+func runReadinessCheck(ctx context.Context, check WorkspaceReadyCheck, ws *workspace.Workspace, workspaceID string, deps WorkspaceReadyDeps) (int, error) {
+	timeout := defaultReadyCheckTimeout
+	if check.TimeoutMs > 0 {
+		timeout = time.Duration(check.TimeoutMs) * time.Millisecond
+	}
+	switch check.Kind() {
 	case "service":
-		if check.ServiceName == "" || svcMgr == nil {
-			return -1, false
-		}
-		if check.ServiceName == opencodeACPServiceName {
-			if !opencodeAvailable() {
-				return 0, true
-			}
-
-			status := svcMgr.Status(workspaceID, check.ServiceName)
-			running, _ := status["running"].(bool)
-			expected := true
-			if check.ExpectRunning != nil {
-				expected = *check.ExpectRunning
-			}
-			if expected && !running {
-				if err := startOpencodeACP(ctx, svcMgr, workspaceID, ws.Path()); err != nil {
-					return -1, false
-				}
-			}
-		}
-
-		status := svcMgr.Status(workspaceID, check.ServiceName)
-		running, _ := status["running"].(bool)
-		expected := true
-		if check.ExpectRunning != nil {
-			expected = *check.ExpectRunning
-		}
-		if running == expected {
-			return 0, true
-		}
-		return 1, false
+		return serviceReadinessCheck(ctx, check, ws, workspaceID, deps.Services)
 	case "command":
 		if check.Command == "" {
-			return -1, false
+			return -1, errors.New("command is required")
 		}
 		res, rpcErr := HandleExec(ctx, ExecParams{
 			Command: check.Command,
 			Args:    check.Args,
 		}, ws)
 		if rpcErr != nil {
-			return -1, false
+			return -1, errors.New(rpcErr.Message)
 		}
-		if res.ExitCode == 0 {
-			return 0, true
+		if res.ExitCode != 0 {
+			return res.ExitCode, fmt.Errorf("exited with code %d", res.ExitCode)
 		}
-		return res.ExitCode, false
+		return 0, nil
+	case "http":
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return httpReadinessCheck(checkCtx, check, deps.Run, timeout)
+	case "tcp":
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return tcpReadinessCheck(checkCtx, check, deps.Run, timeout)
+	case "log":
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return logReadinessCheck(checkCtx, check, workspaceID, deps)
+	case "compose-healthy":
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return composeHealthyCheck(checkCtx, check, workspaceID, deps.Compose)
 	default:
-		return -1, false
+		return -1, fmt.Errorf("unknown check type %q", check.Type)
+	}
+}
+
+func serviceReadinessCheck(ctx context.Context, check WorkspaceReadyCheck, ws *workspace.Workspace, workspaceID string, svcMgr *services.Manager) (int, error) {
+	if check.ServiceName == "" || svcMgr == nil {
+		return -1, errors.New("service manager unavailable")
+	}
+	expected := true
+	if check.ExpectRunning != nil {
+		expected = *check.ExpectRunning
+	}
+	if check.ServiceName == opencodeACPServiceName {
+		if !opencodeAvailable() {
+			return 0, nil
+		}
+
+		status := svcMgr.Status(workspaceID, check.ServiceName)
+		running, _ := status["running"].(bool)
+		if expected && !running {
+			if err := startOpencodeACP(ctx, svcMgr, workspaceID, ws.Path()); err != nil {
+				return -1, fmt.Errorf("start %s: %w", check.ServiceName, err)
+			}
+		}
+	}
+
+	status := svcMgr.Status(workspaceID, check.ServiceName)
+	running, _ := status["running"].(bool)
+	if running == expected {
+		return 0, nil
+	}
+	if expected {
+		return 1, fmt.Errorf("service %s is not running", check.ServiceName)
+	}
+	return 1, fmt.Errorf("service %s is still running", check.ServiceName)
+}
+
+// httpProbeScript fetches $0 with curl and prints the body followed by the
+// status code on its own line.
+const httpProbeScript = `command -v curl >/dev/null 2>&1 || { echo "curl not found in workspace" >&2; exit 127; }
+exec curl -sS -o - -w '\n%{http_code}' --max-time "$1" "$0"`
+
+func httpReadinessCheck(ctx context.Context, check WorkspaceReadyCheck, run func(context.Context, []string) (compose.CommandResult, error), timeout time.Duration) (int, error) {
+	var status int
+	var body string
+	if run != nil {
+		secs := strconv.Itoa(max(1, int(timeout.Seconds())))
+		res, err := run(ctx, []string{"sh", "-c", httpProbeScript, check.URL, secs})
+		if err != nil {
+			return -1, err
+		}
+		if res.ExitCode != 0 {
+			return 1, fmt.Errorf("GET %s: %s", check.URL, commandFailure(res))
+		}
+		body = res.Stdout
+		code := res.Stdout
+		if i := strings.LastIndex(res.Stdout, "\n"); i >= 0 {
+			body, code = res.Stdout[:i], res.Stdout[i+1:]
+		}
+		status, _ = strconv.Atoi(strings.TrimSpace(code))
+	} else {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.URL, nil)
+		if err != nil {
+			return -1, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 1, err
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxReadyHTTPBody))
+		status = resp.StatusCode
+		body = string(data)
+	}
+
+	if check.ExpectStatus > 0 {
+		if status != check.ExpectStatus {
+			return 1, fmt.Errorf("GET %s: status %d, want %d", check.URL, status, check.ExpectStatus)
+		}
+	} else if status < 200 || status >= 400 {
+		return 1, fmt.Errorf("GET %s: status %d", check.URL, status)
+	}
+	if check.BodyRegex != "" {
+		re, err := regexp.Compile(check.BodyRegex)
+		if err != nil {
+			return -1, err
+		}
+		if !re.MatchString(body) {
+			return 1, fmt.Errorf("GET %s: body does not match %q", check.URL, check.BodyRegex)
+		}
 	}
+	return 0, nil
 }
 
-func checkType(check WorkspaceReadyCheck) string {
-	if check.Type != "" {
-		return check.Type
+// tcpProbeScript connects to $0:$1 with nc, falling back to bash's
+// /dev/tcp when nc is missing.
+const tcpProbeScript = `if command -v nc >/dev/null 2>&1; then exec nc -z -w "$2" "$0" "$1"; fi
+command -v bash >/dev/null 2>&1 || { echo "neither nc nor bash found in workspace" >&2; exit 127; }
+exec bash -c 'exec 3<>"/dev/tcp/$0/$1"' "$0" "$1"`
+
+func tcpReadinessCheck(ctx context.Context, check WorkspaceReadyCheck, run func(context.Context, []string) (compose.CommandResult, error), timeout time.Duration) (int, error) {
+	host := check.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(check.Port))
+	if run != nil {
+		secs := strconv.Itoa(max(1, int(timeout.Seconds())))
+		res, err := run(ctx, []string{"sh", "-c", tcpProbeScript, host, strconv.Itoa(check.Port), secs})
+		if err != nil {
+			return -1, err
+		}
+		if res.ExitCode != 0 {
+			return 1, fmt.Errorf("connect %s: %s", addr, commandFailure(res))
+		}
+		return 0, nil
 	}
-	if check.ServiceName != "" {
-		return "service"
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return 1, err
 	}
-	return "command"
+	_ = conn.Close()
+	return 0, nil
+}
+
+// logReadinessCheck matches Pattern against a daemon-managed service's
+// output, or the compose service of that name when the daemon does not run
+// one.
+func logReadinessCheck(ctx context.Context, check WorkspaceReadyCheck, workspaceID string, deps WorkspaceReadyDeps) (int, error) {
+	re, err := regexp.Compile(check.Pattern)
+	if err != nil {
+		return -1, err
+	}
+	if deps.Services != nil {
+		logs := deps.Services.Logs(workspaceID, check.ServiceName)
+		if running, _ := logs["running"].(bool); running {
+			stdout, _ := logs["stdout"].(string)
+			stderr, _ := logs["stderr"].(string)
+			if re.MatchString(stdout) || re.MatchString(stderr) {
+				return 0, nil
+			}
+			return 1, fmt.Errorf("no output of %s matches %q", check.ServiceName, check.Pattern)
+		}
+	}
+	if deps.Compose == nil {
+		return -1, fmt.Errorf("service %s is not running", check.ServiceName)
+	}
+	matched := false
+	err = deps.Compose.Logs(ctx, workspaceID, compose.LogsOptions{Services: []string{check.ServiceName}, Tail: readyLogTail}, func(line compose.LogLine) {
+		if !matched && re.MatchString(line.Line) {
+			matched = true
+		}
+	})
+	if matched {
+		return 0, nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 1, fmt.Errorf("no output of %s matches %q", check.ServiceName, check.Pattern)
+}
+
+func composeHealthyCheck(ctx context.Context, check WorkspaceReadyCheck, workspaceID string, svc *compose.Services) (int, error) {
+	if svc == nil {
+		return -1, errors.New("compose is unavailable")
+	}
+	statuses, err := svc.PS(ctx, workspaceID)
+	if err != nil {
+		return -1, err
+	}
+	for _, status := range statuses {
+		if status.Service != check.ServiceName {
+			continue
+		}
+		switch status.Health {
+		case "healthy":
+			return 0, nil
+		case "":
+			return 1, fmt.Errorf("compose service %s has no healthcheck (state %s)", check.ServiceName, status.State)
+		default:
+			return 1, fmt.Errorf("compose service %s is %s", check.ServiceName, status.Health)
+		}
+	}
+	return 1, fmt.Errorf("compose service %s not found", check.ServiceName)
+}
+
+func commandFailure(res compose.CommandResult) string {
+	if msg := strings.TrimSpace(res.Stderr); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("exited with code %d", res.ExitCode)
 }
 
 func readinessProfiles() map[string][]WorkspaceReadyCheck {
@@ -202,8 +420,21 @@ func readinessProfiles() map[string][]WorkspaceReadyCheck {
 	}
 }
 
-func readinessProfileForWorkspace(root, profile string) ([]WorkspaceReadyCheck, bool) {
-	_ = root
+// readinessProfileForWorkspace resolves profile from the workspace's
+// workspace.json, falling back to the built-in profiles.
+func readinessProfileForWorkspace(root, profile string) ([]WorkspaceReadyCheck, error) {
+	if root != "" {
+		cfg, _, err := config.LoadWorkspaceConfig(root)
+		if err != nil {
+			return nil, err
+		}
+		if checks, ok := cfg.Readiness.Profiles[profile]; ok {
+			return checks, nil
+		}
+	}
 	checks, ok := readinessProfiles()[profile]
-	return checks, ok
+	if !ok {
+		return nil, fmt.Errorf("unknown readiness profile %q", profile)
+	}
+	return checks, nil
 }
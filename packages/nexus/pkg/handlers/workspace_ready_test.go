@@ -2,9 +2,16 @@ package handlers
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/inizio/nexus/packages/nexus/pkg/compose"
 	"github.com/inizio/nexus/packages/nexus/pkg/services"
 	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
 )
@@ -23,7 +30,7 @@ func TestHandleWorkspaceReady_Immediate(t *testing.T) {
 		},
 		TimeoutMs:  500,
 		IntervalMs: 50,
-	}, ws, mgr)
+	}, ws, WorkspaceReadyDeps{Services: mgr})
 	if rpcErr != nil {
 		t.Fatalf("unexpected rpc error: %+v", rpcErr)
 	}
@@ -47,7 +54,7 @@ func TestHandleWorkspaceReady_TimesOut(t *testing.T) {
 		},
 		TimeoutMs:  200,
 		IntervalMs: 50,
-	}, ws, mgr)
+	}, ws, WorkspaceReadyDeps{Services: mgr})
 	if rpcErr != nil {
 		t.Fatalf("unexpected rpc error: %+v", rpcErr)
 	}
@@ -78,7 +85,7 @@ func TestHandleWorkspaceReady_Profile_InternalDogfoodDefault(t *testing.T) {
 		Profile:     "default-services",
 		TimeoutMs:   200,
 		IntervalMs:  50,
-	}, ws, mgr)
+	}, ws, WorkspaceReadyDeps{Services: mgr})
 	if rpcErr != nil {
 		t.Fatalf("unexpected rpc error: %+v", rpcErr)
 	}
@@ -101,7 +108,7 @@ func TestHandleWorkspaceReady_Profile_Unknown(t *testing.T) {
 	_, rpcErr := HandleWorkspaceReady(context.Background(), WorkspaceReadyParams{
 		WorkspaceID: "ws-1",
 		Profile:     "unknown-profile",
-	}, ws, mgr)
+	}, ws, WorkspaceReadyDeps{Services: mgr})
 	if rpcErr == nil {
 		t.Fatal("expected invalid params for unknown readiness profile")
 	}
@@ -139,7 +146,7 @@ func TestHandleWorkspaceReady_OpencodeACPOptionalWhenBinaryMissing(t *testing.T)
 		Profile:     "default-services",
 		TimeoutMs:   200,
 		IntervalMs:  50,
-	}, ws, mgr)
+	}, ws, WorkspaceReadyDeps{Services: mgr})
 	if rpcErr != nil {
 		t.Fatalf("unexpected rpc error: %+v", rpcErr)
 	}
@@ -186,7 +193,7 @@ func TestHandleWorkspaceReady_StartsOpencodeACPWhenAvailable(t *testing.T) {
 		Profile:     "default-services",
 		TimeoutMs:   500,
 		IntervalMs:  50,
-	}, ws, mgr)
+	}, ws, WorkspaceReadyDeps{Services: mgr})
 	if rpcErr != nil {
 		t.Fatalf("unexpected rpc error: %+v", rpcErr)
 	}
@@ -201,3 +208,173 @@ func TestHandleWorkspaceReady_StartsOpencodeACPWhenAvailable(t *testing.T) {
 		_ = mgr.Stop("ws-1", name)
 	}
 }
+
+func TestHandleWorkspaceReady_HTTPAndTCPChecks(t *testing.T) {
+	ws, err := workspace.NewWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	res, rpcErr := HandleWorkspaceReady(context.Background(), WorkspaceReadyParams{
+		WorkspaceID: "ws-1",
+		Checks: []WorkspaceReadyCheck{
+			{Name: "web", Type: "http", URL: srv.URL + "/health", ExpectStatus: 200, BodyRegex: `"status":"ok"`},
+			{Name: "port", Type: "tcp", Port: port},
+		},
+		TimeoutMs: 500,
+	}, ws, WorkspaceReadyDeps{})
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if !res.Ready || len(res.Checks) != 2 || res.Checks[0].Attempts != 1 {
+		t.Fatalf("expected ready after one attempt, got %#v", res)
+	}
+}
+
+func TestHandleWorkspaceReady_ReportsPerCheckDiagnosis(t *testing.T) {
+	ws, err := workspace.NewWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	res, rpcErr := HandleWorkspaceReady(context.Background(), WorkspaceReadyParams{
+		WorkspaceID: "ws-1",
+		Checks: []WorkspaceReadyCheck{
+			{Name: "web", Type: "http", URL: srv.URL},
+			{Name: "ok", Command: "true"},
+		},
+		TimeoutMs:  150,
+		IntervalMs: 50,
+	}, ws, WorkspaceReadyDeps{})
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if res.Ready {
+		t.Fatalf("expected not ready, got %#v", res)
+	}
+	web, ok := res.Checks[0], res.Checks[1]
+	if web.Ready || web.Attempts < 2 || !strings.Contains(web.LastError, "status 503") {
+		t.Fatalf("unexpected web diagnosis %#v", web)
+	}
+	if !ok.Ready || ok.LastError != "" {
+		t.Fatalf("unexpected ok diagnosis %#v", ok)
+	}
+}
+
+func TestHandleWorkspaceReady_GuestProbesUseRun(t *testing.T) {
+	ws, err := workspace.NewWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	var calls [][]string
+	deps := WorkspaceReadyDeps{Run: func(_ context.Context, argv []string) (compose.CommandResult, error) {
+		calls = append(calls, argv)
+		if argv[2] == httpProbeScript {
+			return compose.CommandResult{Stdout: "hello world\n200"}, nil
+		}
+		return compose.CommandResult{ExitCode: 1, Stderr: "connection refused\n"}, nil
+	}}
+
+	res, rpcErr := HandleWorkspaceReady(context.Background(), WorkspaceReadyParams{
+		WorkspaceID: "ws-1",
+		Checks: []WorkspaceReadyCheck{
+			{Name: "web", Type: "http", URL: "http://127.0.0.1:3000", BodyRegex: "hello"},
+			{Name: "db", Type: "tcp", Port: 5432},
+		},
+		TimeoutMs: 1,
+	}, ws, deps)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if !res.Checks[0].Ready {
+		t.Fatalf("expected http check ready, got %#v", res.Checks[0])
+	}
+	if res.Checks[1].Ready || !strings.Contains(res.Checks[1].LastError, "connection refused") {
+		t.Fatalf("expected tcp failure diagnosis, got %#v", res.Checks[1])
+	}
+	if len(calls) < 2 || calls[1][3] != "127.0.0.1" || calls[1][4] != "5432" {
+		t.Fatalf("unexpected probe commands %#v", calls)
+	}
+}
+
+type readyComposeRunner struct{ stdout string }
+
+func (r readyComposeRunner) Run(_ context.Context, _ string, argv []string, onOutput func(stream, data string)) (compose.CommandResult, error) {
+	if onOutput != nil {
+		onOutput("stdout", r.stdout)
+	}
+	return compose.CommandResult{Stdout: r.stdout}, nil
+}
+
+func TestHandleWorkspaceReady_LogAndComposeHealthyChecks(t *testing.T) {
+	ws, err := workspace.NewWorkspace(t.TempDir())
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	mgr := services.NewManager()
+	if _, err := mgr.Start(context.Background(), "ws-1", "api", ws.Path(), "sh", []string{"-c", "echo listening on 8080; sleep 2"}, services.StartOptions{}); err != nil {
+		t.Fatalf("start service: %v", err)
+	}
+	defer mgr.Stop("ws-1", "api")
+
+	res, rpcErr := HandleWorkspaceReady(context.Background(), WorkspaceReadyParams{
+		WorkspaceID: "ws-1",
+		Checks: []WorkspaceReadyCheck{
+			{Name: "api-log", Type: "log", ServiceName: "api", Pattern: `listening on \d+`},
+		},
+		TimeoutMs:  1000,
+		IntervalMs: 20,
+	}, ws, WorkspaceReadyDeps{Services: mgr})
+	if rpcErr != nil || !res.Ready {
+		t.Fatalf("expected log check ready, got %#v %+v", res, rpcErr)
+	}
+
+	psOut := `{"Service":"db","Name":"app-db-1","State":"running","Health":"starting"}`
+	res, rpcErr = HandleWorkspaceReady(context.Background(), WorkspaceReadyParams{
+		WorkspaceID: "ws-1",
+		Checks:      []WorkspaceReadyCheck{{Name: "db", Type: "compose-healthy", ServiceName: "db"}},
+		TimeoutMs:   1,
+	}, ws, WorkspaceReadyDeps{Compose: compose.NewServices(readyComposeRunner{stdout: psOut})})
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if res.Ready || res.Checks[0].LastError != "compose service db is starting" {
+		t.Fatalf("expected starting diagnosis, got %#v", res.Checks)
+	}
+}
+
+func TestHandleWorkspaceReady_ProfileFromWorkspaceConfig(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".nexus"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"version":1,"readiness":{"profiles":{"quick":[{"name":"sh","command":"true"}]}}}`
+	if err := os.WriteFile(filepath.Join(root, ".nexus", "workspace.json"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+
+	res, rpcErr := HandleWorkspaceReady(context.Background(), WorkspaceReadyParams{
+		WorkspaceID: "ws-1",
+		Profile:     "quick",
+		TimeoutMs:   500,
+	}, ws, WorkspaceReadyDeps{})
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if !res.Ready || len(res.Checks) != 1 || res.Checks[0].Name != "sh" {
+		t.Fatalf("expected workspace profile to run, got %#v", res)
+	}
+}
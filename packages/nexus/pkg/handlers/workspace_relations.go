@@ -13,18 +13,30 @@ type WorkspaceRelationsListParams struct {
 }
 
 type WorkspaceRelationNode struct {
-	WorkspaceID       string                      `json:"workspaceId"`
-	ParentWorkspaceID string                      `json:"parentWorkspaceId,omitempty"`
-	LineageRootID     string                      `json:"lineageRootId,omitempty"`
-	DerivedFromRef    string                      `json:"derivedFromRef,omitempty"`
-	WorktreeRef       string                      `json:"worktreeRef,omitempty"`
-	State             workspacemgr.WorkspaceState `json:"state"`
-	Backend           string                      `json:"backend,omitempty"`
-	WorkspaceName     string                      `json:"workspaceName"`
-	RootPath          string                      `json:"rootPath"`
-	LocalWorktreePath string                      `json:"localWorktreePath,omitempty"`
-	CreatedAt         string                      `json:"createdAt"`
-	UpdatedAt         string                      `json:"updatedAt"`
+	WorkspaceID       string                         `json:"workspaceId"`
+	ParentWorkspaceID string                         `json:"parentWorkspaceId,omitempty"`
+	LineageRootID     string                         `json:"lineageRootId,omitempty"`
+	DerivedFromRef    string                         `json:"derivedFromRef,omitempty"`
+	WorktreeRef       string                         `json:"worktreeRef,omitempty"`
+	State             workspacemgr.WorkspaceState    `json:"state"`
+	Backend           string                         `json:"backend,omitempty"`
+	WorkspaceName     string                         `json:"workspaceName"`
+	RootPath          string                         `json:"rootPath"`
+	LocalWorktreePath string                         `json:"localWorktreePath,omitempty"`
+	Fanout            *workspacemgr.FanoutMembership `json:"fanout,omitempty"`
+	CreatedAt         string                         `json:"createdAt"`
+	UpdatedAt         string                         `json:"updatedAt"`
+}
+
+// WorkspaceFanoutGroup lists the workspaces created by one workspace.fanout call.
+type WorkspaceFanoutGroup struct {
+	GroupID           string   `json:"groupId"`
+	SourceWorkspaceID string   `json:"sourceWorkspaceId"`
+	Command           string   `json:"command"`
+	WorkspaceIDs      []string `json:"workspaceIds"`
+	Succeeded         int      `json:"succeeded"`
+	Failed            int      `json:"failed"`
+	Pending           int      `json:"pending"`
 }
 
 type WorkspaceRelationsGroup struct {
@@ -35,6 +47,7 @@ type WorkspaceRelationsGroup struct {
 	RemoteURL    string                  `json:"remoteUrl,omitempty"`
 	Nodes        []WorkspaceRelationNode `json:"nodes"`
 	LineageRoots []string                `json:"lineageRoots"`
+	FanoutGroups []WorkspaceFanoutGroup  `json:"fanoutGroups,omitempty"`
 }
 
 type WorkspaceRelationsListResult struct {
@@ -78,6 +91,7 @@ func HandleWorkspaceRelationsList(_ context.Context, p WorkspaceRelationsListPar
 			WorkspaceName:     ws.WorkspaceName,
 			RootPath:          ws.RootPath,
 			LocalWorktreePath: ws.LocalWorktreePath,
+			Fanout:            ws.Fanout,
 			CreatedAt:         ws.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
 			UpdatedAt:         ws.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z"),
 		})
@@ -101,6 +115,7 @@ func HandleWorkspaceRelationsList(_ context.Context, p WorkspaceRelationsListPar
 		sort.Slice(group.Nodes, func(i, j int) bool {
 			return group.Nodes[i].CreatedAt < group.Nodes[j].CreatedAt
 		})
+		group.FanoutGroups = fanoutGroupsForNodes(group.Nodes)
 		result = append(result, *group)
 	}
 
@@ -111,6 +126,43 @@ func HandleWorkspaceRelationsList(_ context.Context, p WorkspaceRelationsListPar
 	return &WorkspaceRelationsListResult{Relations: result}, nil
 }
 
+func fanoutGroupsForNodes(nodes []WorkspaceRelationNode) []WorkspaceFanoutGroup {
+	byID := make(map[string]*WorkspaceFanoutGroup)
+	order := make([]string, 0)
+	for _, node := range nodes {
+		if node.Fanout == nil || node.Fanout.GroupID == "" {
+			continue
+		}
+		group, ok := byID[node.Fanout.GroupID]
+		if !ok {
+			group = &WorkspaceFanoutGroup{
+				GroupID:           node.Fanout.GroupID,
+				SourceWorkspaceID: node.Fanout.SourceWorkspaceID,
+				Command:           node.Fanout.Command,
+			}
+			byID[node.Fanout.GroupID] = group
+			order = append(order, node.Fanout.GroupID)
+		}
+		group.WorkspaceIDs = append(group.WorkspaceIDs, node.WorkspaceID)
+		switch node.Fanout.Status {
+		case "succeeded":
+			group.Succeeded++
+		case "pending", "running":
+			group.Pending++
+		default:
+			group.Failed++
+		}
+	}
+	if len(order) == 0 {
+		return nil
+	}
+	out := make([]WorkspaceFanoutGroup, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	return out
+}
+
 func remoteURLForKind(repo, kind string) string {
 	if kind == "hosted" {
 		return repo
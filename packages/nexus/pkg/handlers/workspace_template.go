@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/compose"
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+	"github.com/inizio/nexus/packages/nexus/pkg/projectmgr"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/selection"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+type TemplateListParams struct {
+	ProjectID string `json:"projectId,omitempty"`
+	Repo      string `json:"repo,omitempty"`
+}
+
+type TemplateListResult struct {
+	ProjectID string                         `json:"projectId"`
+	Templates []projectmgr.WorkspaceTemplate `json:"templates"`
+}
+
+type TemplateGetParams struct {
+	ProjectID string `json:"projectId,omitempty"`
+	Repo      string `json:"repo,omitempty"`
+	// Name accepts "name" or "name@revision".
+	Name     string `json:"name"`
+	Revision int    `json:"revision,omitempty"`
+}
+
+type TemplateGetResult struct {
+	ProjectID string                         `json:"projectId"`
+	Template  *projectmgr.WorkspaceTemplate  `json:"template"`
+	Revisions []projectmgr.WorkspaceTemplate `json:"revisions,omitempty"`
+}
+
+type TemplateSaveParams struct {
+	ProjectID string                       `json:"projectId,omitempty"`
+	Repo      string                       `json:"repo,omitempty"`
+	Template  projectmgr.WorkspaceTemplate `json:"template"`
+}
+
+type TemplateSaveFromWorkspaceParams struct {
+	WorkspaceID string `json:"workspaceId"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type TemplateSaveResult struct {
+	ProjectID string                        `json:"projectId"`
+	Template  *projectmgr.WorkspaceTemplate `json:"template"`
+}
+
+// TemplateHookResult is the outcome of one template setup hook.
+type TemplateHookResult struct {
+	Name     string `json:"name,omitempty"`
+	Command  string `json:"command"`
+	ExitCode int    `json:"exitCode"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// TemplateServicesResult is the outcome of bringing up a template's compose
+// services and waiting on its readiness profile.
+type TemplateServicesResult struct {
+	Services []string              `json:"services,omitempty"`
+	Ready    *WorkspaceReadyResult `json:"ready,omitempty"`
+	Error    string                `json:"error,omitempty"`
+}
+
+// TemplateServiceRunner starts compose services and checks a readiness
+// profile in a running workspace.
+type TemplateServiceRunner struct {
+	Up    func(ctx context.Context, services []string) *rpckit.RPCError
+	Ready func(ctx context.Context, profile string) (*WorkspaceReadyResult, *rpckit.RPCError)
+}
+
+func HandleTemplateList(_ context.Context, req TemplateListParams, projMgr *projectmgr.Manager) (*TemplateListResult, *rpckit.RPCError) {
+	project, rpcErr := resolveTemplateProject(projMgr, req.ProjectID, req.Repo)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	templates, _ := projMgr.ListTemplates(project.ID)
+	return &TemplateListResult{ProjectID: project.ID, Templates: templates}, nil
+}
+
+func HandleTemplateGet(_ context.Context, req TemplateGetParams, projMgr *projectmgr.Manager) (*TemplateGetResult, *rpckit.RPCError) {
+	project, rpcErr := resolveTemplateProject(projMgr, req.ProjectID, req.Repo)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	tmpl, rpcErr := lookupTemplate(projMgr, project.ID, req.Name, req.Revision)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return &TemplateGetResult{
+		ProjectID: project.ID,
+		Template:  tmpl,
+		Revisions: projMgr.TemplateRevisions(project.ID, tmpl.Name),
+	}, nil
+}
+
+func HandleTemplateSave(_ context.Context, req TemplateSaveParams, projMgr *projectmgr.Manager) (*TemplateSaveResult, *rpckit.RPCError) {
+	project, rpcErr := resolveTemplateProject(projMgr, req.ProjectID, req.Repo)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := validateTemplate(req.Template); rpcErr != nil {
+		return nil, rpcErr
+	}
+	saved, err := projMgr.SaveTemplate(project.ID, req.Template)
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	return &TemplateSaveResult{ProjectID: project.ID, Template: saved}, nil
+}
+
+// HandleTemplateSaveFromWorkspace captures a workspace's backend, agent
+// profile and runtime options as a new template revision. Services,
+// readiness and setup hooks carry over from the template the workspace was
+// created from, if any.
+func HandleTemplateSaveFromWorkspace(_ context.Context, req TemplateSaveFromWorkspaceParams, mgr *workspacemgr.Manager, projMgr *projectmgr.Manager) (*TemplateSaveResult, *rpckit.RPCError) {
+	if strings.TrimSpace(req.WorkspaceID) == "" || strings.TrimSpace(req.Name) == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	if mgr == nil || projMgr == nil {
+		return nil, rpckit.ErrInternalError
+	}
+	ws, ok := mgr.Get(strings.TrimSpace(req.WorkspaceID))
+	if !ok {
+		return nil, rpckit.ErrWorkspaceNotFound
+	}
+	project, rpcErr := resolveTemplateProject(projMgr, ws.ProjectID, ws.Repo)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	tmpl := projectmgr.WorkspaceTemplate{}
+	if ws.TemplateName != "" {
+		if base, ok := projMgr.Template(project.ID, ws.TemplateName, ws.TemplateRevision); ok {
+			tmpl = *base
+		}
+	}
+	tmpl.Name = strings.TrimSpace(req.Name)
+	tmpl.Revision = 0
+	tmpl.Description = strings.TrimSpace(req.Description)
+	tmpl.SourceWorkspaceID = ws.ID
+	tmpl.Backend = strings.TrimSpace(ws.Backend)
+	tmpl.AgentProfile = strings.TrimSpace(ws.AgentProfile)
+	if tmpl.Backend == "process" {
+		tmpl.IsolationLevel = "process"
+	} else if isVMIsolationBackend(tmpl.Backend) {
+		tmpl.IsolationLevel = "vm"
+	}
+	if mode := strings.TrimSpace(ws.RuntimeOptions["vm.mode"]); mode != "" {
+		tmpl.VMMode = mode
+	}
+	if v, err := strconv.Atoi(ws.RuntimeOptions["mem_mib"]); err == nil && v > 0 {
+		tmpl.MemoryMiB = v
+	}
+	if v, err := strconv.Atoi(ws.RuntimeOptions["vcpus"]); err == nil && v > 0 {
+		tmpl.VCPUs = v
+	}
+
+	saved, err := projMgr.SaveTemplate(project.ID, tmpl)
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	return &TemplateSaveResult{ProjectID: project.ID, Template: saved}, nil
+}
+
+// RunTemplateSetupHooks runs a template's setup hooks in order, stopping at
+// the first failure.
+func RunTemplateSetupHooks(ctx context.Context, ws *workspacemgr.Workspace, tmpl *projectmgr.WorkspaceTemplate, run FanoutRunner) []TemplateHookResult {
+	if ws == nil || tmpl == nil || run == nil || len(tmpl.SetupHooks) == 0 {
+		return nil
+	}
+	results := make([]TemplateHookResult, 0, len(tmpl.SetupHooks))
+	for _, hook := range tmpl.SetupHooks {
+		result := TemplateHookResult{Name: hook.Name, Command: strings.TrimSpace(strings.Join(append([]string{hook.Command}, hook.Args...), " "))}
+		out, rpcErr := run(ctx, ws, ExecParams{WorkspaceID: ws.ID, Command: hook.Command, Args: hook.Args})
+		switch {
+		case rpcErr != nil:
+			result.ExitCode = -1
+			result.Error = rpcErr.Message
+		case out != nil:
+			result.ExitCode = out.ExitCode
+			result.Output = out.Stdout + out.Stderr
+			if len(result.Output) > maxFanoutPersistedBytes {
+				result.Output = result.Output[len(result.Output)-maxFanoutPersistedBytes:]
+			}
+		}
+		results = append(results, result)
+		if result.ExitCode != 0 {
+			break
+		}
+	}
+	return results
+}
+
+// StartTemplateServices brings up a template's services, then waits on its
+// readiness profile. It returns nil when the template has neither.
+func StartTemplateServices(ctx context.Context, tmpl *projectmgr.WorkspaceTemplate, run TemplateServiceRunner) *TemplateServicesResult {
+	if tmpl == nil || (len(tmpl.Services) == 0 && strings.TrimSpace(tmpl.ReadinessProfile) == "") {
+		return nil
+	}
+	result := &TemplateServicesResult{Services: tmpl.Services}
+	if len(tmpl.Services) > 0 && run.Up != nil {
+		if rpcErr := run.Up(ctx, tmpl.Services); rpcErr != nil {
+			result.Error = fmt.Sprintf("compose up: %s", rpcErr.Message)
+			return result
+		}
+	}
+	if profile := strings.TrimSpace(tmpl.ReadinessProfile); profile != "" && run.Ready != nil {
+		ready, rpcErr := run.Ready(ctx, profile)
+		if rpcErr != nil {
+			result.Error = fmt.Sprintf("readiness profile %s: %s", profile, rpcErr.Message)
+			return result
+		}
+		result.Ready = ready
+	}
+	return result
+}
+
+// resolveCreateTemplate loads the template named by a workspace.create
+// request. The project comes from projectId, or from the project whose
+// primary repo matches the resolved spec.
+func resolveCreateTemplate(req WorkspaceCreateParams, spec workspacemgr.CreateSpec, projMgr *projectmgr.Manager) (*projectmgr.WorkspaceTemplate, *rpckit.RPCError) {
+	if strings.TrimSpace(req.Template) == "" {
+		return nil, nil
+	}
+	project, rpcErr := resolveTemplateProject(projMgr, req.ProjectID, spec.Repo)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return lookupTemplate(projMgr, project.ID, req.Template, req.TemplateRevision)
+}
+
+// applyTemplateToSpec fills create fields the caller left unset. Explicit
+// request params always win over the template.
+func applyTemplateToSpec(spec workspacemgr.CreateSpec, tmpl *projectmgr.WorkspaceTemplate) workspacemgr.CreateSpec {
+	if tmpl == nil {
+		return spec
+	}
+	if strings.TrimSpace(spec.AgentProfile) == "" {
+		spec.AgentProfile = tmpl.AgentProfile
+	}
+	if strings.TrimSpace(spec.Backend) == "" {
+		spec.Backend = tmpl.Backend
+	}
+	if strings.TrimSpace(spec.Backend) == "" && strings.TrimSpace(tmpl.IsolationLevel) != "" {
+		// Pick the platform backend for the template's isolation level rather
+		// than the one the repo's workspace.json would.
+		cfg := config.WorkspaceConfig{}
+		cfg.Isolation.Level = strings.ToLower(strings.TrimSpace(tmpl.IsolationLevel))
+		cfg.Isolation.VM.Mode = strings.ToLower(strings.TrimSpace(tmpl.VMMode))
+		if backend, _, err := selection.SelectBackend(goruntime.GOOS, &cfg); err == nil {
+			spec.Backend = backend
+		}
+	}
+	return spec
+}
+
+// templateRuntimeOptions converts template resources into runtime driver
+// options. The daemon resource caps still apply on top.
+func templateRuntimeOptions(tmpl *projectmgr.WorkspaceTemplate) map[string]string {
+	if tmpl == nil {
+		return nil
+	}
+	options := map[string]string{}
+	if tmpl.MemoryMiB > 0 {
+		options["mem_mib"] = strconv.Itoa(tmpl.MemoryMiB)
+	}
+	if tmpl.VCPUs > 0 {
+		options["vcpus"] = strconv.Itoa(tmpl.VCPUs)
+	}
+	if mode := strings.ToLower(strings.TrimSpace(tmpl.VMMode)); mode != "" {
+		options["vm.mode"] = mode
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+func resolveTemplateProject(projMgr *projectmgr.Manager, projectID, repo string) (*projectmgr.Project, *rpckit.RPCError) {
+	if projMgr == nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: "project manager unavailable"}
+	}
+	if id := strings.TrimSpace(projectID); id != "" {
+		project, ok := projMgr.Get(id)
+		if !ok {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("project not found: %s", id)}
+		}
+		return project, nil
+	}
+	if repo = strings.TrimSpace(repo); repo != "" {
+		for _, project := range projMgr.List() {
+			if project.PrimaryRepo == repo {
+				return project, nil
+			}
+		}
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("no project for repo %s", repo)}
+	}
+	return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "projectId or repo is required"}
+}
+
+func lookupTemplate(projMgr *projectmgr.Manager, projectID, name string, revision int) (*projectmgr.WorkspaceTemplate, *rpckit.RPCError) {
+	name = strings.TrimSpace(name)
+	if at := strings.LastIndex(name, "@"); at > 0 {
+		rev, err := strconv.Atoi(name[at+1:])
+		if err != nil || rev <= 0 {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid template revision in %q", name)}
+		}
+		if revision > 0 && revision != rev {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("template %q conflicts with revision %d", name, revision)}
+		}
+		name, revision = name[:at], rev
+	}
+	if name == "" {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "template name is required"}
+	}
+	tmpl, ok := projMgr.Template(projectID, name, revision)
+	if !ok {
+		msg := fmt.Sprintf("template not found: %s", name)
+		if revision > 0 {
+			msg = fmt.Sprintf("template not found: %s@%d", name, revision)
+		}
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: msg, Data: map[string]any{"kind": "template.notFound", "projectId": projectID}}
+	}
+	return tmpl, nil
+}
+
+func validateTemplate(tmpl projectmgr.WorkspaceTemplate) *rpckit.RPCError {
+	switch strings.ToLower(strings.TrimSpace(tmpl.IsolationLevel)) {
+	case "", "vm", "process":
+	default:
+		return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid isolationLevel %q (want vm or process)", tmpl.IsolationLevel)}
+	}
+	switch strings.ToLower(strings.TrimSpace(tmpl.VMMode)) {
+	case "", "pool", "dedicated":
+	default:
+		return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid vmMode %q (want pool or dedicated)", tmpl.VMMode)}
+	}
+	switch level := strings.ToLower(strings.TrimSpace(tmpl.IsolationLevel)); {
+	case level == "process" && isVMIsolationBackend(tmpl.Backend),
+		level == "vm" && strings.EqualFold(strings.TrimSpace(tmpl.Backend), "process"):
+		return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("backend %q does not provide isolationLevel %q", tmpl.Backend, tmpl.IsolationLevel)}
+	}
+	if tmpl.MemoryMiB < 0 || tmpl.VCPUs < 0 {
+		return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "memoryMiB and vcpus must not be negative"}
+	}
+	if err := compose.CheckServiceNames(tmpl.Services); err != nil {
+		return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	for i, hook := range tmpl.SetupHooks {
+		if strings.TrimSpace(hook.Command) == "" {
+			return &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("setupHooks[%d].command is required", i)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/projectmgr"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+func setupTemplateProject(t *testing.T) (*workspacemgr.Manager, *projectmgr.Manager, *projectmgr.Project) {
+	t.Helper()
+	root := t.TempDir()
+	mgr := workspacemgr.NewManager(root)
+	projMgr := projectmgr.NewManager(root, mgr.ProjectRepository())
+	mgr.SetProjectManager(projMgr)
+	project, err := projMgr.GetOrCreateForRepo("git@example/repo.git", "repo-test")
+	if err != nil {
+		t.Fatalf("seed project: %v", err)
+	}
+	return mgr, projMgr, project
+}
+
+func TestHandleTemplateSaveVersionsRevisions(t *testing.T) {
+	_, projMgr, project := setupTemplateProject(t)
+	ctx := context.Background()
+
+	for _, desc := range []string{"first", "second"} {
+		if _, rpcErr := HandleTemplateSave(ctx, TemplateSaveParams{
+			ProjectID: project.ID,
+			Template:  projectmgr.WorkspaceTemplate{Name: "api", Description: desc, MemoryMiB: 2048},
+		}, projMgr); rpcErr != nil {
+			t.Fatalf("save %s: %+v", desc, rpcErr)
+		}
+	}
+
+	list, rpcErr := HandleTemplateList(ctx, TemplateListParams{Repo: "git@example/repo.git"}, projMgr)
+	if rpcErr != nil {
+		t.Fatalf("list: %+v", rpcErr)
+	}
+	if len(list.Templates) != 1 || list.Templates[0].Revision != 2 || list.Templates[0].Description != "second" {
+		t.Fatalf("expected latest revision only, got %#v", list.Templates)
+	}
+
+	got, rpcErr := HandleTemplateGet(ctx, TemplateGetParams{ProjectID: project.ID, Name: "api@1"}, projMgr)
+	if rpcErr != nil {
+		t.Fatalf("get: %+v", rpcErr)
+	}
+	if got.Template.Revision != 1 || got.Template.Description != "first" {
+		t.Fatalf("expected revision 1, got %#v", got.Template)
+	}
+	if len(got.Revisions) != 2 {
+		t.Fatalf("expected 2 revisions in history, got %d", len(got.Revisions))
+	}
+
+	if _, ok := projMgr.Template(project.ID, "api", 3); ok {
+		t.Fatal("expected missing revision lookup to fail")
+	}
+
+	_, rpcErr = HandleTemplateSave(ctx, TemplateSaveParams{
+		ProjectID: project.ID,
+		Template:  projectmgr.WorkspaceTemplate{Name: "bad", IsolationLevel: "container"},
+	}, projMgr)
+	if rpcErr == nil || rpcErr.Code != rpckit.ErrInvalidParams.Code {
+		t.Fatalf("expected invalid isolation level to be rejected, got %+v", rpcErr)
+	}
+}
+
+func TestHandleWorkspaceCreateWithProjects_AppliesTemplate(t *testing.T) {
+	mgr, projMgr, project := setupTemplateProject(t)
+	ctx := context.Background()
+
+	if _, err := projMgr.SaveTemplate(project.ID, projectmgr.WorkspaceTemplate{
+		Name:         "heavy",
+		Backend:      vmIsolationBackend(),
+		VMMode:       "dedicated",
+		MemoryMiB:    4096,
+		VCPUs:        2,
+		AgentProfile: "reviewer",
+	}); err != nil {
+		t.Fatalf("save template: %v", err)
+	}
+
+	var gotOptions map[string]string
+	driver := &mockDriver{backend: vmIsolationBackend(), createFn: func(_ context.Context, req runtime.CreateRequest) error {
+		gotOptions = req.Options
+		return nil
+	}}
+	factory := runtime.NewFactory([]runtime.Capability{{Name: "runtime.linux", Available: true}, {Name: "runtime.firecracker", Available: true}}, vmIsolationDrivers(driver))
+
+	result, rpcErr := HandleWorkspaceCreateWithProjects(ctx, WorkspaceCreateParams{
+		ProjectID:     project.ID,
+		TargetBranch:  "feature-tmpl",
+		WorkspaceName: "tmpl",
+		Fresh:         true,
+		Template:      "heavy",
+	}, mgr, projMgr, factory)
+	if rpcErr != nil {
+		t.Fatalf("create: %+v", rpcErr)
+	}
+	ws := result.Workspace
+	if ws.TemplateName != "heavy" || ws.TemplateRevision != 1 {
+		t.Fatalf("expected template heavy@1 recorded, got %q@%d", ws.TemplateName, ws.TemplateRevision)
+	}
+	if ws.AgentProfile != "reviewer" || ws.Backend != vmIsolationBackend() {
+		t.Fatalf("expected template defaults applied, got profile=%q backend=%q", ws.AgentProfile, ws.Backend)
+	}
+	if gotOptions["mem_mib"] != "4096" || gotOptions["vcpus"] != "2" || gotOptions["vm.mode"] != "dedicated" {
+		t.Fatalf("expected template runtime options, got %#v", gotOptions)
+	}
+	if result.Template == nil || result.Template.Revision != 1 {
+		t.Fatalf("expected applied template in result, got %#v", result.Template)
+	}
+
+	explicit, rpcErr := HandleWorkspaceCreateWithProjects(ctx, WorkspaceCreateParams{
+		ProjectID:     project.ID,
+		TargetBranch:  "feature-explicit",
+		WorkspaceName: "explicit",
+		Fresh:         true,
+		AgentProfile:  "default",
+		Template:      "heavy@1",
+	}, mgr, projMgr, factory)
+	if rpcErr != nil {
+		t.Fatalf("create explicit: %+v", rpcErr)
+	}
+	if explicit.Workspace.AgentProfile != "default" {
+		t.Fatalf("expected explicit agent profile to win, got %q", explicit.Workspace.AgentProfile)
+	}
+
+	_, rpcErr = HandleWorkspaceCreateWithProjects(ctx, WorkspaceCreateParams{
+		ProjectID:     project.ID,
+		WorkspaceName: "missing",
+		Fresh:         true,
+		Template:      "nope",
+	}, mgr, projMgr, factory)
+	if rpcErr == nil || rpcErr.Code != rpckit.ErrInvalidParams.Code {
+		t.Fatalf("expected unknown template to fail, got %+v", rpcErr)
+	}
+}
+
+func TestHandleTemplateSaveFromWorkspaceCarriesTemplateFields(t *testing.T) {
+	mgr, projMgr, project := setupTemplateProject(t)
+	ctx := context.Background()
+
+	base, err := projMgr.SaveTemplate(project.ID, projectmgr.WorkspaceTemplate{
+		Name:       "base",
+		Services:   []string{"db"},
+		SetupHooks: []projectmgr.TemplateHook{{Name: "deps", Command: "make", Args: []string{"deps"}}},
+	})
+	if err != nil {
+		t.Fatalf("save base: %v", err)
+	}
+	ws, err := mgr.Create(ctx, workspacemgr.CreateSpec{Repo: "git@example/repo.git", Ref: "main", WorkspaceName: "src", AgentProfile: "default", Backend: "firecracker"})
+	if err != nil {
+		t.Fatalf("create ws: %v", err)
+	}
+	if err := mgr.UpdateProjectID(ws.ID, project.ID); err != nil {
+		t.Fatalf("update project: %v", err)
+	}
+	if err := mgr.SetTemplate(ws.ID, base.Name, base.Revision, map[string]string{"mem_mib": "3072", "vm.mode": "pool"}); err != nil {
+		t.Fatalf("set template: %v", err)
+	}
+
+	saved, rpcErr := HandleTemplateSaveFromWorkspace(ctx, TemplateSaveFromWorkspaceParams{WorkspaceID: ws.ID, Name: "captured"}, mgr, projMgr)
+	if rpcErr != nil {
+		t.Fatalf("save-from: %+v", rpcErr)
+	}
+	tmpl := saved.Template
+	if tmpl.Revision != 1 || tmpl.SourceWorkspaceID != ws.ID {
+		t.Fatalf("unexpected template identity %#v", tmpl)
+	}
+	if tmpl.Backend != "firecracker" || tmpl.IsolationLevel != "vm" || tmpl.MemoryMiB != 3072 || tmpl.VMMode != "pool" {
+		t.Fatalf("expected workspace runtime captured, got %#v", tmpl)
+	}
+	if len(tmpl.Services) != 1 || len(tmpl.SetupHooks) != 1 {
+		t.Fatalf("expected services and hooks inherited from base, got %#v", tmpl)
+	}
+}
+
+func TestRunTemplateSetupHooksStopsAtFirstFailure(t *testing.T) {
+	ws := &workspacemgr.Workspace{ID: "ws-1"}
+	tmpl := &projectmgr.WorkspaceTemplate{SetupHooks: []projectmgr.TemplateHook{
+		{Name: "one", Command: "true"},
+		{Name: "two", Command: "false"},
+		{Name: "three", Command: "true"},
+	}}
+	var ran []string
+	run := func(_ context.Context, _ *workspacemgr.Workspace, req ExecParams) (*ExecResult, *rpckit.RPCError) {
+		ran = append(ran, req.Command)
+		if req.Command == "false" {
+			return &ExecResult{ExitCode: 1, Stderr: "boom"}, nil
+		}
+		return &ExecResult{}, nil
+	}
+	results := RunTemplateSetupHooks(context.Background(), ws, tmpl, run)
+	if len(results) != 2 || len(ran) != 2 {
+		t.Fatalf("expected two hooks to run, got results=%#v ran=%v", results, ran)
+	}
+	if results[1].ExitCode != 1 || results[1].Output != "boom" {
+		t.Fatalf("expected failing hook result, got %#v", results[1])
+	}
+}
+
+func TestStartTemplateServicesBringsUpServicesThenChecksReadiness(t *testing.T) {
+	tmpl := &projectmgr.WorkspaceTemplate{Services: []string{"db", "api"}, ReadinessProfile: "default"}
+	var calls []string
+	run := TemplateServiceRunner{
+		Up: func(_ context.Context, services []string) *rpckit.RPCError {
+			calls = append(calls, "up "+strings.Join(services, ","))
+			return nil
+		},
+		Ready: func(_ context.Context, profile string) (*WorkspaceReadyResult, *rpckit.RPCError) {
+			calls = append(calls, "ready "+profile)
+			return &WorkspaceReadyResult{Ready: true, Profile: profile}, nil
+		},
+	}
+	result := StartTemplateServices(context.Background(), tmpl, run)
+	if strings.Join(calls, ";") != "up db,api;ready default" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+	if result == nil || result.Error != "" || result.Ready == nil || !result.Ready.Ready {
+		t.Fatalf("unexpected result %#v", result)
+	}
+
+	calls = nil
+	run.Up = func(context.Context, []string) *rpckit.RPCError {
+		return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: "no compose file"}
+	}
+	result = StartTemplateServices(context.Background(), tmpl, run)
+	if len(calls) != 0 || result.Error != "compose up: no compose file" {
+		t.Fatalf("expected readiness to be skipped after a failed up, got calls=%v result=%#v", calls, result)
+	}
+
+	if result := StartTemplateServices(context.Background(), &projectmgr.WorkspaceTemplate{Name: "bare"}, run); result != nil {
+		t.Fatalf("expected nothing for a template without services, got %#v", result)
+	}
+}
+
+func TestApplyTemplateToSpecSelectsBackendForIsolationLevel(t *testing.T) {
+	spec := applyTemplateToSpec(workspacemgr.CreateSpec{}, &projectmgr.WorkspaceTemplate{IsolationLevel: "vm"})
+	if spec.Backend != vmIsolationBackend() {
+		t.Fatalf("expected vm isolation to select %q, got %q", vmIsolationBackend(), spec.Backend)
+	}
+	spec = applyTemplateToSpec(workspacemgr.CreateSpec{}, &projectmgr.WorkspaceTemplate{IsolationLevel: "process"})
+	if spec.Backend != "process" {
+		t.Fatalf("expected process isolation to select process, got %q", spec.Backend)
+	}
+	spec = applyTemplateToSpec(workspacemgr.CreateSpec{Backend: "process"}, &projectmgr.WorkspaceTemplate{IsolationLevel: "vm"})
+	if spec.Backend != "process" {
+		t.Fatalf("expected explicit backend to win, got %q", spec.Backend)
+	}
+
+	if rpcErr := validateTemplate(projectmgr.WorkspaceTemplate{Name: "x", Backend: "process", IsolationLevel: "vm"}); rpcErr == nil {
+		t.Fatal("expected a process backend with vm isolation to be rejected")
+	}
+	if rpcErr := validateTemplate(projectmgr.WorkspaceTemplate{Name: "x", Services: []string{"--project-directory"}}); rpcErr == nil {
+		t.Fatal("expected a flag-like service name to be rejected")
+	}
+}
@@ -0,0 +1,158 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+)
+
+// Workspace hook stages, declared under "lifecycle" in workspace.json.
+const (
+	StageOnCreate  = "onCreate"
+	StagePostStart = "postStart"
+	StagePreStop   = "preStop"
+	StageOnFork    = "onFork"
+	StagePreRemove = "preRemove"
+)
+
+const (
+	FailureAbort = "abort"
+	FailureWarn  = "warn"
+)
+
+const (
+	defaultWorkspaceHookTimeout = 5 * time.Minute
+	// maxHookOutputBytes keeps the tail of a hook's output.
+	maxHookOutputBytes = 64 << 10
+)
+
+// CommandRunner runs argv inside a workspace with env added to its
+// environment and returns the exit code.
+type CommandRunner func(ctx context.Context, argv, env []string, onOutput func(stream, data string)) (int, error)
+
+// HookResult is the outcome of one workspace hook.
+type HookResult struct {
+	Stage      string `json:"stage"`
+	Name       string `json:"name"`
+	Command    string `json:"command"`
+	OnFailure  string `json:"onFailure"`
+	ExitCode   int    `json:"exitCode"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Failed reports whether the hook could not run or exited non-zero.
+func (r HookResult) Failed() bool {
+	return r.Error != "" || r.ExitCode != 0
+}
+
+// HookError is returned when a hook with the abort policy fails.
+type HookError struct {
+	Result HookResult
+}
+
+func (e *HookError) Error() string {
+	if e.Result.Error != "" {
+		return fmt.Sprintf("%s hook %s failed: %s", e.Result.Stage, e.Result.Name, e.Result.Error)
+	}
+	return fmt.Sprintf("%s hook %s failed with exit code %d", e.Result.Stage, e.Result.Name, e.Result.ExitCode)
+}
+
+// DefaultFailurePolicy is the policy of hooks that do not set onFailure.
+// Hooks that prepare a workspace abort; hooks on the way out only warn so a
+// broken hook cannot keep a workspace from stopping or being removed.
+func DefaultFailurePolicy(stage string) string {
+	switch stage {
+	case StagePreStop, StagePreRemove:
+		return FailureWarn
+	default:
+		return FailureAbort
+	}
+}
+
+// RunWorkspaceHooks runs the hooks of stage in order. Failing warn hooks are
+// recorded and the stage continues; the first failing abort hook ends the
+// stage with a *HookError. The results cover every hook that ran.
+func RunWorkspaceHooks(ctx context.Context, stage string, hooks []config.LifecycleHook, env map[string]string, run CommandRunner) ([]HookResult, error) {
+	results := make([]HookResult, 0, len(hooks))
+	for i, hook := range hooks {
+		result := runWorkspaceHook(ctx, stage, i, hook, env, run)
+		results = append(results, result)
+		if result.Failed() && result.OnFailure == FailureAbort {
+			return results, &HookError{Result: result}
+		}
+	}
+	return results, nil
+}
+
+func runWorkspaceHook(ctx context.Context, stage string, index int, hook config.LifecycleHook, env map[string]string, run CommandRunner) HookResult {
+	argv := hook.Argv()
+	result := HookResult{
+		Stage:     stage,
+		Name:      hook.Name,
+		Command:   strings.Join(argv, " "),
+		OnFailure: hook.OnFailure,
+	}
+	if result.Name == "" {
+		result.Name = fmt.Sprintf("%s-%d", stage, index+1)
+	}
+	if result.OnFailure == "" {
+		result.OnFailure = DefaultFailurePolicy(stage)
+	}
+
+	timeout := defaultWorkspaceHookTimeout
+	if hook.TimeoutMs > 0 {
+		timeout = time.Duration(hook.TimeoutMs) * time.Millisecond
+	}
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output strings.Builder
+	start := time.Now()
+	exitCode, err := run(hookCtx, argv, hookEnv(env, hook.Env), func(_, data string) {
+		output.WriteString(data)
+	})
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.ExitCode = exitCode
+	result.Output = output.String()
+	if len(result.Output) > maxHookOutputBytes {
+		result.Output = result.Output[len(result.Output)-maxHookOutputBytes:]
+	}
+	switch {
+	case errors.Is(hookCtx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		result.Error = fmt.Sprintf("timed out after %s", timeout)
+	case err != nil:
+		result.ExitCode = -1
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// hookEnv merges the daemon-provided variables with the hook's own, the
+// hook winning, as sorted KEY=value pairs.
+func hookEnv(base, hook map[string]string) []string {
+	merged := make(map[string]string, len(base)+len(hook))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range hook {
+		merged[k] = v
+	}
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+merged[k])
+	}
+	return pairs
+}
@@ -0,0 +1,66 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+)
+
+func TestRunWorkspaceHooks_WarnContinuesAbortStops(t *testing.T) {
+	var ran []string
+	var gotEnv []string
+	run := func(_ context.Context, argv, env []string, onOutput func(stream, data string)) (int, error) {
+		ran = append(ran, strings.Join(argv, " "))
+		gotEnv = env
+		onOutput("stdout", "out of "+argv[len(argv)-1]+"\n")
+		if strings.Contains(argv[len(argv)-1], "fail") {
+			return 2, nil
+		}
+		return 0, nil
+	}
+	hooks := []config.LifecycleHook{
+		{Name: "lint", Command: "fail-lint", OnFailure: "warn"},
+		{Command: "make", Args: []string{"deps"}, Env: map[string]string{"STAGE": "hook"}},
+		{Name: "seed", Command: "fail-seed"},
+		{Name: "never", Command: "true"},
+	}
+
+	results, err := RunWorkspaceHooks(context.Background(), StageOnCreate, hooks, map[string]string{"STAGE": "daemon", "NEXUS_WORKSPACE_ID": "ws-1"}, run)
+	var hookErr *HookError
+	if !errors.As(err, &hookErr) || hookErr.Result.Name != "seed" {
+		t.Fatalf("expected abort from seed, got %v", err)
+	}
+	if len(results) != 3 || len(ran) != 3 {
+		t.Fatalf("expected three hooks to run, got %#v", results)
+	}
+	if !results[0].Failed() || results[0].OnFailure != FailureWarn || results[0].Output != "out of fail-lint\n" {
+		t.Fatalf("unexpected warn result %#v", results[0])
+	}
+	if results[1].Name != "onCreate-2" || results[1].Command != "make deps" || results[1].OnFailure != FailureAbort {
+		t.Fatalf("unexpected default naming/policy %#v", results[1])
+	}
+	if ran[0] != "sh -c fail-lint" {
+		t.Fatalf("expected shell form for hook without args, got %q", ran[0])
+	}
+	if strings.Join(gotEnv, ",") != "NEXUS_WORKSPACE_ID=ws-1,STAGE=daemon" {
+		t.Fatalf("unexpected env for last hook %v", gotEnv)
+	}
+}
+
+func TestRunWorkspaceHooks_TimeoutAndStageDefaults(t *testing.T) {
+	run := func(ctx context.Context, _, _ []string, _ func(stream, data string)) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	results, err := RunWorkspaceHooks(context.Background(), StagePreStop, []config.LifecycleHook{{Name: "slow", Command: "sleep 10", TimeoutMs: 20}}, nil, run)
+	if err != nil {
+		t.Fatalf("preStop hooks warn by default, got %v", err)
+	}
+	if results[0].ExitCode != -1 || results[0].Error != "timed out after "+(20*time.Millisecond).String() {
+		t.Fatalf("unexpected timeout result %#v", results[0])
+	}
+}
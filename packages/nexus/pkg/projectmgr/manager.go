@@ -227,5 +227,11 @@ func cloneProject(in *Project) *Project {
 		out.RepoIDs = make([]string, len(in.RepoIDs))
 		copy(out.RepoIDs, in.RepoIDs)
 	}
+	if in.Templates != nil {
+		out.Templates = make([]WorkspaceTemplate, len(in.Templates))
+		for i := range in.Templates {
+			out.Templates[i] = cloneTemplate(in.Templates[i])
+		}
+	}
 	return &out
 }
@@ -0,0 +1,141 @@
+package projectmgr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SaveTemplate stores tmpl as the next revision of its name in the project
+// and returns the stored copy.
+func (m *Manager) SaveTemplate(projectID string, tmpl WorkspaceTemplate) (*WorkspaceTemplate, error) {
+	name := strings.TrimSpace(tmpl.Name)
+	if name == "" {
+		return nil, fmt.Errorf("template name is required")
+	}
+	if strings.ContainsAny(name, " \t\n/@") {
+		return nil, fmt.Errorf("template name %q must not contain whitespace, '/' or '@'", name)
+	}
+
+	m.mu.Lock()
+	p, ok := m.projects[projectID]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("project not found: %s", projectID)
+	}
+	latest := 0
+	for _, existing := range p.Templates {
+		if existing.Name == name && existing.Revision > latest {
+			latest = existing.Revision
+		}
+	}
+	now := time.Now().UTC()
+	stored := cloneTemplate(tmpl)
+	stored.Name = name
+	stored.Revision = latest + 1
+	stored.CreatedAt = now
+	prevTemplates := p.Templates
+	prevUpdatedAt := p.UpdatedAt
+	p.Templates = append(append([]WorkspaceTemplate(nil), p.Templates...), stored)
+	p.UpdatedAt = now
+	snapshot := cloneProject(p)
+	m.mu.Unlock()
+
+	if err := m.persistProject(snapshot); err != nil {
+		m.mu.Lock()
+		p.Templates = prevTemplates
+		p.UpdatedAt = prevUpdatedAt
+		m.mu.Unlock()
+		return nil, fmt.Errorf("persist template: %w", err)
+	}
+	out := cloneTemplate(stored)
+	return &out, nil
+}
+
+// Template returns a template revision. A revision of 0 selects the latest.
+func (m *Manager) Template(projectID, name string, revision int) (*WorkspaceTemplate, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.projects[projectID]
+	if !ok {
+		return nil, false
+	}
+	name = strings.TrimSpace(name)
+	var found *WorkspaceTemplate
+	for i := range p.Templates {
+		t := &p.Templates[i]
+		if t.Name != name {
+			continue
+		}
+		if revision > 0 && t.Revision == revision {
+			found = t
+			break
+		}
+		if revision <= 0 && (found == nil || t.Revision > found.Revision) {
+			found = t
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+	out := cloneTemplate(*found)
+	return &out, true
+}
+
+// ListTemplates returns the latest revision of each template, sorted by name.
+func (m *Manager) ListTemplates(projectID string) ([]WorkspaceTemplate, bool) {
+	m.mu.RLock()
+	p, ok := m.projects[projectID]
+	if !ok {
+		m.mu.RUnlock()
+		return nil, false
+	}
+	latest := make(map[string]WorkspaceTemplate)
+	for _, t := range p.Templates {
+		if cur, seen := latest[t.Name]; !seen || t.Revision > cur.Revision {
+			latest[t.Name] = cloneTemplate(t)
+		}
+	}
+	m.mu.RUnlock()
+
+	out := make([]WorkspaceTemplate, 0, len(latest))
+	for _, t := range latest {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, true
+}
+
+// TemplateRevisions returns every stored revision of name, oldest first.
+func (m *Manager) TemplateRevisions(projectID, name string) []WorkspaceTemplate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.projects[projectID]
+	if !ok {
+		return nil
+	}
+	var out []WorkspaceTemplate
+	for _, t := range p.Templates {
+		if t.Name == name {
+			out = append(out, cloneTemplate(t))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Revision < out[j].Revision })
+	return out
+}
+
+func cloneTemplate(in WorkspaceTemplate) WorkspaceTemplate {
+	out := in
+	if in.Services != nil {
+		out.Services = append([]string(nil), in.Services...)
+	}
+	if in.SetupHooks != nil {
+		out.SetupHooks = make([]TemplateHook, len(in.SetupHooks))
+		for i, h := range in.SetupHooks {
+			h.Args = append([]string(nil), h.Args...)
+			out.SetupHooks[i] = h
+		}
+	}
+	return out
+}
@@ -10,4 +10,38 @@ type Project struct {
 	RootPath    string    `json:"rootPath"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+	// Templates holds every saved revision of the project's workspace
+	// templates. Use ListTemplates for the latest revision of each name.
+	Templates []WorkspaceTemplate `json:"templates,omitempty"`
+}
+
+// WorkspaceTemplate is a named, versioned set of workspace create defaults.
+// Saving a template under an existing name appends a new revision; older
+// revisions stay addressable so workspaces can record what they came from.
+type WorkspaceTemplate struct {
+	Name           string `json:"name"`
+	Revision       int    `json:"revision"`
+	Description    string `json:"description,omitempty"`
+	Backend        string `json:"backend,omitempty"`
+	IsolationLevel string `json:"isolationLevel,omitempty"`
+	VMMode         string `json:"vmMode,omitempty"`
+	MemoryMiB      int    `json:"memoryMiB,omitempty"`
+	VCPUs          int    `json:"vcpus,omitempty"`
+	AgentProfile   string `json:"agentProfile,omitempty"`
+	// Services lists compose services to bring up in the workspace.
+	Services []string `json:"services,omitempty"`
+	// ReadinessProfile names the readiness checks the workspace waits on.
+	ReadinessProfile string         `json:"readinessProfile,omitempty"`
+	SetupHooks       []TemplateHook `json:"setupHooks,omitempty"`
+	// SourceWorkspaceID is set when the template was captured from a workspace.
+	SourceWorkspaceID string    `json:"sourceWorkspaceId,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// TemplateHook is a command run in a new workspace after it is created,
+// inside the workspace runtime. Without Args, Command runs through sh -c.
+type TemplateHook struct {
+	Name    string   `json:"name,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
 }
@@ -0,0 +1,90 @@
+package shared
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+)
+
+// pipeReadAhead bounds the input an end of a BufferedPipe reads ahead.
+// Once it is full the writer blocks again, as with a bare net.Pipe.
+const pipeReadAhead = 1 << 20
+
+// BufferedPipe is net.Pipe with each end's input read ahead in the
+// background, up to pipeReadAhead bytes. With a bare net.Pipe a write
+// blocks until the peer has read every byte, and a json.Decoder that has a
+// complete message leaves its trailing newline unread, so two ends
+// answering each other can deadlock.
+func BufferedPipe() (net.Conn, net.Conn) {
+	left, right := net.Pipe()
+	return newReadAheadConn(left), newReadAheadConn(right)
+}
+
+type readAheadConn struct {
+	net.Conn
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	err    error
+	closed bool
+}
+
+func newReadAheadConn(c net.Conn) *readAheadConn {
+	r := &readAheadConn{Conn: c}
+	r.cond = sync.NewCond(&r.mu)
+	go r.fill()
+	return r
+}
+
+func (r *readAheadConn) fill() {
+	p := make([]byte, 32<<10)
+	for {
+		r.mu.Lock()
+		for r.buf.Len() >= pipeReadAhead && !r.closed {
+			r.cond.Wait()
+		}
+		closed := r.closed
+		r.mu.Unlock()
+		if closed {
+			return
+		}
+
+		n, err := r.Conn.Read(p)
+		r.mu.Lock()
+		r.buf.Write(p[:n])
+		if err != nil {
+			r.err = err
+		}
+		r.cond.Broadcast()
+		r.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *readAheadConn) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.buf.Len() == 0 && r.err == nil {
+		r.cond.Wait()
+	}
+	if r.buf.Len() > 0 {
+		n, err := r.buf.Read(p)
+		r.cond.Broadcast()
+		return n, err
+	}
+	return 0, r.err
+}
+
+func (r *readAheadConn) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	if r.err == nil {
+		r.err = io.ErrClosedPipe
+	}
+	r.cond.Broadcast()
+	r.mu.Unlock()
+	return r.Conn.Close()
+}
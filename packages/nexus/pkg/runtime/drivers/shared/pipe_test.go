@@ -0,0 +1,31 @@
+package shared
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBufferedPipeBoundsReadAhead(t *testing.T) {
+	left, right := BufferedPipe()
+	defer left.Close()
+	defer right.Close()
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := left.Write(make([]byte, 2*pipeReadAhead))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		t.Fatalf("expected the write to block once the read-ahead is full, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := io.ReadFull(right, make([]byte, 2*pipeReadAhead)); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package shared
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultShellBufferBytes is the output a shell keeps for replay on attach.
+const DefaultShellBufferBytes = 256 << 10
+
+// A persistent shell nobody is attached to is reaped: killed once it has
+// been idle for DefaultShellIdleTimeout, or dropped DefaultShellExitedTTL
+// after it exited without anyone collecting its exit.
+const (
+	DefaultShellIdleTimeout = 24 * time.Hour
+	DefaultShellExitedTTL   = 10 * time.Minute
+)
+
+// ShellSink receives a shell's output while a connection is attached. seq
+// is the total number of bytes the shell has produced up to and including
+// data.
+type ShellSink struct {
+	Chunk func(data string, seq uint64)
+	Exit  func(code int)
+}
+
+// ShellOptions describes a shell process for Shells.Add.
+type ShellOptions struct {
+	// Persistent shells survive their connection: output is buffered while
+	// nobody is attached. Other shells are killed when detached.
+	Persistent bool
+	Input      io.Writer
+	// Resize is nil when the shell has no terminal to resize.
+	Resize func(cols, rows int) error
+	Kill   func()
+}
+
+// Shells tracks the shells of a guest by session ID, so a host can attach
+// to a persistent shell again after its connection dropped, for example
+// across a daemon restart.
+type Shells struct {
+	mu          sync.Mutex
+	shells      map[string]*Shell
+	idleTimeout time.Duration
+	exitedTTL   time.Duration
+}
+
+func NewShells() *Shells {
+	return &Shells{
+		shells:      make(map[string]*Shell),
+		idleTimeout: DefaultShellIdleTimeout,
+		exitedTTL:   DefaultShellExitedTTL,
+	}
+}
+
+// SetReapTimeouts changes how long detached persistent shells are kept,
+// for shells detached or exiting from now on.
+func (t *Shells) SetReapTimeouts(idle, exited time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.idleTimeout, t.exitedTTL = idle, exited
+}
+
+func (t *Shells) reapTimeouts() (time.Duration, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.idleTimeout, t.exitedTTL
+}
+
+// Shell is one tracked shell process.
+type Shell struct {
+	ID    string
+	opts  ShellOptions
+	table *Shells
+
+	mu       sync.Mutex
+	buf      []byte
+	seq      uint64
+	sink     *ShellSink
+	exited   bool
+	exitCode int
+	// reap fires while the shell is detached; reapGen tells a stale timer
+	// apart from the current one.
+	reap    *time.Timer
+	reapGen uint64
+}
+
+// Add tracks a started shell with sink attached.
+func (t *Shells) Add(id string, opts ShellOptions, sink *ShellSink) (*Shell, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.shells[id]; ok {
+		return nil, fmt.Errorf("shell session %s already exists", id)
+	}
+	s := &Shell{ID: id, opts: opts, table: t, sink: sink}
+	t.shells[id] = s
+	return s, nil
+}
+
+func (t *Shells) Get(id string) *Shell {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.shells[id]
+}
+
+func (t *Shells) remove(s *Shell) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.shells[s.ID] == s {
+		delete(t.shells, s.ID)
+	}
+}
+
+// Persistent reports whether the shell outlives its connection.
+func (s *Shell) Persistent() bool { return s.opts.Persistent }
+
+// Output buffers data and forwards it to the attached connection.
+func (s *Shell) Output(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq += uint64(len(data))
+	s.buf = append(s.buf, data...)
+	if over := len(s.buf) - DefaultShellBufferBytes; over > 0 {
+		for over < len(s.buf) && !utf8.RuneStart(s.buf[over]) {
+			over++
+		}
+		s.buf = append(s.buf[:0:0], s.buf[over:]...)
+	}
+	if s.sink != nil {
+		s.sink.Chunk(string(data), s.seq)
+	}
+}
+
+// Exited records the shell's exit. An attached connection is told right
+// away; a detached persistent shell is kept until someone attaches to
+// collect its output and exit code.
+func (s *Shell) Exited(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exited, s.exitCode = true, code
+	if s.sink != nil {
+		s.sink.Exit(code)
+		s.table.remove(s)
+	} else if !s.opts.Persistent {
+		s.table.remove(s)
+	} else {
+		s.scheduleReapLocked()
+	}
+}
+
+// Attach makes sink the shell's connection, replacing any earlier one, and
+// first replays the kept output after since. It returns the seq the replay
+// ended at.
+func (s *Shell) Attach(since uint64, sink *ShellSink) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sink = sink
+	s.stopReapLocked()
+	oldest := s.seq - uint64(len(s.buf))
+	if since < oldest {
+		since = oldest
+	}
+	if since < s.seq {
+		sink.Chunk(string(s.buf[since-oldest:]), s.seq)
+	}
+	if s.exited {
+		sink.Exit(s.exitCode)
+		s.table.remove(s)
+	}
+	return s.seq
+}
+
+// Detach drops sink if it is still the shell's connection. Shells that are
+// not persistent are killed.
+func (s *Shell) Detach(sink *ShellSink) {
+	s.mu.Lock()
+	if s.sink != sink {
+		s.mu.Unlock()
+		return
+	}
+	s.sink = nil
+	persistent := s.opts.Persistent
+	if persistent {
+		s.scheduleReapLocked()
+	}
+	s.mu.Unlock()
+	if !persistent {
+		s.Close()
+	}
+}
+
+// scheduleReapLocked arms the reaper of a detached shell, with the exited
+// TTL once the shell has exited and the idle timeout before.
+func (s *Shell) scheduleReapLocked() {
+	s.stopReapLocked()
+	idle, exited := s.table.reapTimeouts()
+	after := idle
+	if s.exited {
+		after = exited
+	}
+	if after <= 0 {
+		return
+	}
+	gen := s.reapGen
+	s.reap = time.AfterFunc(after, func() { s.reapDetached(gen) })
+}
+
+func (s *Shell) stopReapLocked() {
+	s.reapGen++
+	if s.reap != nil {
+		s.reap.Stop()
+		s.reap = nil
+	}
+}
+
+func (s *Shell) reapDetached(gen uint64) {
+	s.mu.Lock()
+	if gen != s.reapGen || s.sink != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.reap = nil
+	s.mu.Unlock()
+	s.Close()
+}
+
+func (s *Shell) Write(data []byte) error {
+	_, err := s.opts.Input.Write(data)
+	return err
+}
+
+func (s *Shell) Resize(cols, rows int) error {
+	if s.opts.Resize == nil {
+		return nil
+	}
+	return s.opts.Resize(cols, rows)
+}
+
+// Close stops tracking the shell and kills it.
+func (s *Shell) Close() {
+	s.mu.Lock()
+	s.stopReapLocked()
+	s.mu.Unlock()
+	s.table.remove(s)
+	if s.opts.Kill != nil {
+		s.opts.Kill()
+	}
+}
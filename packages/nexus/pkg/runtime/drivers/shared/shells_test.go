@@ -0,0 +1,140 @@
+package shared
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type shellRecorder struct {
+	out   string
+	seq   uint64
+	exits []int
+}
+
+func (r *shellRecorder) sink() *ShellSink {
+	return &ShellSink{
+		Chunk: func(data string, seq uint64) { r.out += data; r.seq = seq },
+		Exit:  func(code int) { r.exits = append(r.exits, code) },
+	}
+}
+
+func TestPersistentShellReplaysOutputAfterReattach(t *testing.T) {
+	shells := NewShells()
+	var input bytes.Buffer
+	first := &shellRecorder{}
+	firstSink := first.sink()
+	s, err := shells.Add("pty-1", ShellOptions{Persistent: true, Input: &input}, firstSink)
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	s.Output([]byte("hello "))
+	s.Detach(firstSink)
+	s.Output([]byte("world"))
+
+	if shells.Get("pty-1") != s {
+		t.Fatal("expected detached persistent shell to stay tracked")
+	}
+	second := &shellRecorder{}
+	if seq := s.Attach(3, second.sink()); seq != 11 {
+		t.Fatalf("expected attach seq 11, got %d", seq)
+	}
+	if second.out != "lo world" || second.seq != 11 {
+		t.Fatalf("unexpected replay %q at %d", second.out, second.seq)
+	}
+	if err := s.Write([]byte("ls\n")); err != nil || input.String() != "ls\n" {
+		t.Fatalf("write: %v, input %q", err, input.String())
+	}
+}
+
+func TestPersistentShellKeepsExitUntilAttach(t *testing.T) {
+	shells := NewShells()
+	rec := &shellRecorder{}
+	sink := rec.sink()
+	s, _ := shells.Add("pty-1", ShellOptions{Persistent: true}, sink)
+	s.Detach(sink)
+	s.Output([]byte("bye\n"))
+	s.Exited(3)
+
+	if shells.Get("pty-1") == nil {
+		t.Fatal("expected exited shell to be kept for the next attach")
+	}
+	again := &shellRecorder{}
+	s.Attach(0, again.sink())
+	if again.out != "bye\n" || len(again.exits) != 1 || again.exits[0] != 3 {
+		t.Fatalf("unexpected attach result %q %v", again.out, again.exits)
+	}
+	if shells.Get("pty-1") != nil {
+		t.Fatal("expected shell to be dropped once its exit was delivered")
+	}
+}
+
+func TestDetachKillsNonPersistentShell(t *testing.T) {
+	shells := NewShells()
+	killed := false
+	rec := &shellRecorder{}
+	sink := rec.sink()
+	s, _ := shells.Add("pty-1", ShellOptions{Kill: func() { killed = true }}, sink)
+
+	s.Detach(&ShellSink{})
+	if killed {
+		t.Fatal("detaching a stale sink must not kill the shell")
+	}
+	s.Detach(sink)
+	if !killed || shells.Get("pty-1") != nil {
+		t.Fatalf("expected shell killed and dropped, killed=%v", killed)
+	}
+	if _, err := shells.Add("pty-1", ShellOptions{}, nil); err != nil {
+		t.Fatalf("expected id to be reusable: %v", err)
+	}
+}
+
+func TestDetachedPersistentShellsAreReaped(t *testing.T) {
+	shells := NewShells()
+	shells.SetReapTimeouts(20*time.Millisecond, 20*time.Millisecond)
+
+	killed := make(chan struct{})
+	rec := &shellRecorder{}
+	sink := rec.sink()
+	idle, _ := shells.Add("pty-idle", ShellOptions{Persistent: true, Kill: func() { close(killed) }}, sink)
+	idle.Detach(sink)
+	select {
+	case <-killed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an idle detached shell to be killed")
+	}
+	if shells.Get("pty-idle") != nil {
+		t.Fatal("expected the reaped shell to be dropped")
+	}
+
+	exitedSink := rec.sink()
+	exited, _ := shells.Add("pty-exited", ShellOptions{Persistent: true}, exitedSink)
+	exited.Detach(exitedSink)
+	exited.Exited(0)
+	deadline := time.Now().Add(2 * time.Second)
+	for shells.Get("pty-exited") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected an uncollected exited shell to be dropped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAttachCancelsReap(t *testing.T) {
+	shells := NewShells()
+	shells.SetReapTimeouts(20*time.Millisecond, 20*time.Millisecond)
+	killed := false
+	rec := &shellRecorder{}
+	sink := rec.sink()
+	s, _ := shells.Add("pty-1", ShellOptions{Persistent: true, Kill: func() { killed = true }}, sink)
+	s.Detach(sink)
+	s.Attach(0, rec.sink())
+	time.Sleep(60 * time.Millisecond)
+	if shells.Get("pty-1") != s {
+		t.Fatal("expected an attached shell to be kept")
+	}
+	s.Close()
+	if !killed {
+		t.Fatal("expected close to kill the shell")
+	}
+}
@@ -158,7 +158,9 @@ func DirectSSHInteractiveArgs(instanceName, workdir, shell string) ([]string, er
 // DirectSSHScriptArgs returns the ssh(1) argument slice that runs a
 // non-interactive shell script inside the Lima instance.
 //
-// Equivalent to `limactl shell INSTANCE -- sh -lc SCRIPT`.
+// Equivalent to `limactl shell INSTANCE -- sh -lc SCRIPT`. ssh joins its
+// command arguments with spaces for the remote shell, so the script is
+// quoted into a single argument.
 func DirectSSHScriptArgs(instanceName, script string) ([]string, error) {
 	cfgPath, err := nexusSSHConfigPath(instanceName)
 	if err != nil {
@@ -172,7 +174,7 @@ func DirectSSHScriptArgs(instanceName, script string) ([]string, error) {
 		"-o", "ControlPath=none",
 		instanceName,
 		"--",
-		"sh", "-lc", script,
+		"sh -lc " + ShellQuote(script),
 	}, nil
 }
 
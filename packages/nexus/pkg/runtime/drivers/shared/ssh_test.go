@@ -2,6 +2,7 @@ package shared
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -45,3 +46,33 @@ func TestDirectSSHInteractiveArgsUsesExplicitCdWrapper(t *testing.T) {
 		t.Fatalf("expected ssh args to disable multiplexing, got %v", args)
 	}
 }
+
+func TestDirectSSHScriptArgsQuotesScript(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("LIMA_HOME", filepath.Join(tmp, ".lima"))
+
+	limaDir := filepath.Join(tmp, ".lima", "nexus")
+	if err := os.MkdirAll(limaDir, 0o755); err != nil {
+		t.Fatalf("mkdir lima dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(limaDir, "ssh.config"), []byte("Host lima-nexus\n  HostName 127.0.0.1\n"), 0o600); err != nil {
+		t.Fatalf("write ssh.config: %v", err)
+	}
+
+	script := `echo "it's here" && exit 3`
+	args, err := DirectSSHScriptArgs("nexus", script)
+	if err != nil {
+		t.Fatalf("DirectSSHScriptArgs: %v", err)
+	}
+	// The remote side parses the joined command with a shell, so the script
+	// must survive that parse as one argument.
+	remote := strings.Join(args[len(args)-1:], " ")
+	out, err := exec.Command("sh", "-c", "set -- "+remote+"; printf '%s\\n' \"$#\" \"$3\"").Output()
+	if err != nil {
+		t.Fatalf("parse remote command: %v", err)
+	}
+	if got := string(out); got != "3\n"+script+"\n" {
+		t.Fatalf("remote command %q parsed as %q", remote, got)
+	}
+}
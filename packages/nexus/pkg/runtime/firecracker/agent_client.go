@@ -1,10 +1,13 @@
 package firecracker
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
+	"strings"
 	"sync"
 )
 
@@ -20,6 +23,8 @@ type ExecRequest struct {
 	WorkDir string   `json:"workdir,omitempty"`
 	Env     []string `json:"env,omitempty"`
 	Stream  bool     `json:"stream,omitempty"`
+	// Params carries the options of typed requests such as fs.grep.
+	Params json.RawMessage `json:"params,omitempty"`
 }
 
 // ExecResult represents the result of a command execution
@@ -51,13 +56,72 @@ func NewAgentClient(conn net.Conn) *AgentClient {
 	return &AgentClient{conn: conn}
 }
 
+// ConnectSocket asks the agent to connect to the unix socket at path in the
+// guest. The returned connection then carries the socket's bytes, so the
+// client must not be used again.
+func (c *AgentClient) ConnectSocket(ctx context.Context, id, path string) (net.Conn, error) {
+	if c.conn == nil {
+		return nil, errors.New("agent client: nil connection")
+	}
+	params, err := json.Marshal(map[string]string{"path": path})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(ExecRequest{ID: id, Type: "socket.connect", Params: params})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() { _ = c.conn.Close() })
+	defer stop()
+
+	// No trailing newline: the agent hands everything after the request to
+	// the socket.
+	if _, err := c.conn.Write(payload); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(c.conn)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	var env execEnvelope
+	if err := json.Unmarshal(line, &env); err != nil {
+		return nil, fmt.Errorf("agent socket.connect: %w", err)
+	}
+	if env.ExitCode != 0 {
+		return nil, fmt.Errorf("agent socket.connect %s: %s", path, strings.TrimSpace(env.Stderr))
+	}
+	if !stop() {
+		// ctx ended as the handshake finished and the connection is closed.
+		return nil, ctx.Err()
+	}
+	return &bufferedConn{Conn: c.conn, r: r}, nil
+}
+
+// bufferedConn reads through r, which may hold bytes read past a handshake.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
 // Exec executes a command on the guest and returns the result
 func (c *AgentClient) Exec(ctx context.Context, req ExecRequest) (ExecResult, error) {
 	return c.ExecStreaming(ctx, req, nil)
 }
 
 // ExecStreaming executes a command on the guest and streams output chunks as
-// they are emitted when the agent supports streaming responses.
+// they are emitted when the agent supports streaming responses. Chunks
+// handed to onChunk are not also collected into the result.
 func (c *AgentClient) ExecStreaming(ctx context.Context, req ExecRequest, onChunk func(stream, data string)) (ExecResult, error) {
 	if c.conn == nil {
 		return ExecResult{}, errors.New("agent client: nil connection")
@@ -96,14 +160,14 @@ func (c *AgentClient) ExecStreaming(ctx context.Context, req ExecRequest, onChun
 			}
 
 			if env.Type == "chunk" {
-				if env.Stream == "stderr" {
+				switch {
+				case onChunk != nil:
+					onChunk(env.Stream, env.Data)
+				case env.Stream == "stderr":
 					stderr += env.Data
-				} else {
+				default:
 					stdout += env.Data
 				}
-				if onChunk != nil {
-					onChunk(env.Stream, env.Data)
-				}
 				continue
 			}
 
@@ -1,8 +1,10 @@
 package lima
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +12,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -54,6 +57,11 @@ type GuestDriver struct {
 	prepareWorkspaceFS func(ctx context.Context, instance, targetPath, localPath string) error
 	// forkSSH runs a shell script on the Lima guest; defaults to shared.DirectSSHScript.
 	forkSSH func(ctx context.Context, instance, script string) ([]byte, error)
+	// holderCommand runs the guest-side shell holder; probeHolder reports
+	// whether an instance can run it, cached in holderInstances.
+	holderCommand   func(instance string, args ...string) (*exec.Cmd, error)
+	probeHolder     func(ctx context.Context, instance string) (bool, error)
+	holderInstances map[string]bool
 }
 
 var _ runtime.ForkSnapshotter = (*GuestDriver)(nil)
@@ -78,6 +86,9 @@ func NewGuestDriver() *GuestDriver {
 		forkSSH: func(ctx context.Context, instance, script string) ([]byte, error) {
 			return shared.DirectSSHScript(ctx, instance, script)
 		},
+		holderCommand:   sshShellHolderCommand,
+		probeHolder:     probeShellHolder,
+		holderInstances: make(map[string]bool),
 	}
 }
 
@@ -274,7 +285,7 @@ func (d *GuestDriver) setState(workspaceID, state string) error {
 
 func (d *GuestDriver) AgentConn(ctx context.Context, workspaceID string) (net.Conn, error) {
 	_ = ctx
-	left, right := net.Pipe()
+	left, right := shared.BufferedPipe()
 	go d.serveShellProtocol(context.Background(), workspaceID, right)
 	return left, nil
 }
@@ -297,7 +308,26 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 		ptmx *os.File
 	}
 
+	// Plain shells run over an SSH session owned by this connection, so
+	// they end with it. Persistent shells live in a guest-side holder that
+	// outlives the connection; holders maps the ones this connection is
+	// attached to, and current is the one opened or attached last, which
+	// writes and resizes address when their ID names no shell.
 	var session *shellSession
+	holders := make(map[string]*holderShell)
+	current := ""
+	holder := func(id string) *holderShell {
+		if h, ok := holders[id]; ok {
+			return h
+		}
+		return holders[current]
+	}
+	detachHolders := func() {
+		for id, h := range holders {
+			h.detach()
+			delete(holders, id)
+		}
+	}
 	closeSession := func() {
 		if session == nil {
 			return
@@ -310,10 +340,16 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 		session = nil
 	}
 
+	// The port watch, if any, lives as long as the connection.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchingPorts := false
+
 	for {
 		var req map[string]any
 		if err := dec.Decode(&req); err != nil {
 			closeSession()
+			detachHolders()
 			return
 		}
 
@@ -321,12 +357,20 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 		id, _ := req["id"].(string)
 
 		switch typ {
+		case "agent.features":
+			features := []string{}
+			if d.persistsShells(ctx, workspaceID) {
+				features = append(features, "shell.persist")
+			}
+			_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 0, "features": features})
+
 		case "shell.open":
 			closeSession()
 			shell, _ := req["command"].(string)
 			if strings.TrimSpace(shell) == "" {
 				shell = "bash"
 			}
+			holderCmd := "exec " + shell + " -i"
 			workdir, _ := req["workdir"].(string)
 			perWsPath := guestWorkdirForID(workspaceID)
 			localPath := ""
@@ -343,6 +387,7 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 				// In pool mode wrap the shell so the process sees /workspace,
 				// not /workspace/<id>, via a per-process mount namespace.
 				shell = d.buildRemoteShellCmd(workspaceID)
+				holderCmd = "exec " + shell
 			}
 
 			instance := d.workspaceInstance(workspaceID)
@@ -350,23 +395,31 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
 				continue
 			}
+
+			if persist, _ := req["persist"].(bool); persist {
+				if h, ok := holders[id]; ok {
+					h.detach()
+					delete(holders, id)
+				}
+				h, started, err := d.openHolderShell(ctx, instance, id, workdir, localPath, holderCmd, toInt(req["cols"], 120), toInt(req["rows"], 30))
+				if err != nil {
+					_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
+					continue
+				}
+				d.markShellRunning(workspaceID, started, localPath)
+				holders[id] = h
+				current = id
+				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 0})
+				go h.relay(writeJSON)
+				continue
+			}
+
 			cmd, ptmx, err := d.spawnShell(ctx, instance, workdir, localPath, shell)
 			if err != nil {
 				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
 				continue
 			}
-
-			d.mu.Lock()
-			if ws, ok := d.workspaces[workspaceID]; ok {
-				ws.state = "running"
-				if strings.TrimSpace(localPath) != "" {
-					ws.projectRoot = localPath
-				}
-				if strings.TrimSpace(instance) != "" {
-					ws.instance = instance
-				}
-			}
-			d.mu.Unlock()
+			d.markShellRunning(workspaceID, instance, localPath)
 
 			session = &shellSession{id: id, cmd: cmd, ptmx: ptmx}
 			_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 0})
@@ -401,12 +454,36 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 				d.mu.Unlock()
 			}(session)
 
+		case "shell.attach":
+			if h, ok := holders[id]; ok {
+				h.detach()
+				delete(holders, id)
+			}
+			since := strconv.FormatUint(uint64(toInt(req["since"], 0)), 10)
+			h, err := d.startHolderShell(d.workspaceInstance(workspaceID), id, "attach", id, since)
+			if err != nil {
+				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
+				continue
+			}
+			holders[id] = h
+			current = id
+			_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 0})
+			go h.relay(writeJSON)
+
 		case "shell.write":
+			data, _ := req["data"].(string)
+			if h := holder(id); h != nil {
+				if err := h.write([]byte(data)); err != nil {
+					_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
+					continue
+				}
+				_ = writeJSON(map[string]any{"id": id, "type": "ack", "ok": true})
+				continue
+			}
 			if session == nil {
 				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": "no active shell session"})
 				continue
 			}
-			data, _ := req["data"].(string)
 			if _, err := session.ptmx.Write([]byte(data)); err != nil {
 				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
 				continue
@@ -414,12 +491,20 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 			_ = writeJSON(map[string]any{"id": id, "type": "ack", "ok": true})
 
 		case "shell.resize":
+			cols := toInt(req["cols"], 120)
+			rows := toInt(req["rows"], 30)
+			if h := holder(id); h != nil {
+				if err := h.resize(cols, rows); err != nil {
+					_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
+					continue
+				}
+				_ = writeJSON(map[string]any{"id": id, "type": "ack", "ok": true})
+				continue
+			}
 			if session == nil {
 				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": "no active shell session"})
 				continue
 			}
-			cols := toInt(req["cols"], 120)
-			rows := toInt(req["rows"], 30)
 			if err := pty.Setsize(session.ptmx, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)}); err != nil {
 				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
 				continue
@@ -427,7 +512,12 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 			_ = writeJSON(map[string]any{"id": id, "type": "ack", "ok": true})
 
 		case "shell.close":
+			if h := holder(id); h != nil {
+				h.close()
+				delete(holders, h.id)
+			}
 			closeSession()
+			detachHolders()
 			_ = writeJSON(map[string]any{"id": id, "type": "ack", "ok": true})
 			return
 
@@ -439,14 +529,116 @@ func (d *GuestDriver) serveShellProtocol(ctx context.Context, workspaceID string
 				"ports": ports,
 			})
 
+		case "ports.watch":
+			if watchingPorts {
+				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": "ports.watch already active on this connection"})
+				continue
+			}
+			watchingPorts = true
+			go func(id string) {
+				err := d.watchPorts(ctx, workspaceID, func(ports []map[string]any) error {
+					return writeJSON(map[string]any{"id": id, "type": "ports.changed", "ports": ports})
+				})
+				if err != nil && ctx.Err() == nil {
+					_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": err.Error()})
+				}
+			}(id)
+
+		case "socket.connect":
+			if watchingPorts {
+				_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": "socket.connect needs its own connection"})
+				continue
+			}
+			closeSession()
+			detachHolders()
+			d.relaySocket(ctx, workspaceID, id, req, dec, conn, writeJSON)
+			return
+
+		case "":
+			// Plain exec requests, as understood by the firecracker agent.
+			go d.execCommand(ctx, workspaceID, req, writeJSON)
+
 		default:
 			_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": fmt.Sprintf("unknown request type %q", typ)})
 		}
 	}
 }
 
+// markShellRunning records that a shell started in instance for workspaceID.
+func (d *GuestDriver) markShellRunning(workspaceID, instance, localPath string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ws, ok := d.workspaces[workspaceID]; ok {
+		ws.state = "running"
+		if strings.TrimSpace(localPath) != "" {
+			ws.projectRoot = localPath
+		}
+		if strings.TrimSpace(instance) != "" {
+			ws.instance = instance
+		}
+	}
+}
+
+// relaySocket answers socket.connect: it connects conn to a unix socket in
+// the guest through socat, or nc -U, over ssh. After the result line conn
+// carries the socket's bytes.
+func (d *GuestDriver) relaySocket(ctx context.Context, workspaceID, id string, req map[string]any, dec *json.Decoder, conn net.Conn, writeJSON func(map[string]any) error) {
+	fail := func(msg string) {
+		_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": msg})
+	}
+	params, _ := req["params"].(map[string]any)
+	path, _ := params["path"].(string)
+	if !filepath.IsAbs(path) {
+		fail(fmt.Sprintf("socket path must be absolute: %q", path))
+		return
+	}
+	quoted := shared.ShellQuote(filepath.Clean(path))
+	script := "if command -v socat >/dev/null 2>&1; then exec socat - UNIX-CONNECT:" + quoted + "; fi; exec nc -U " + quoted
+	sshArgs, err := shared.DirectSSHScriptArgs(d.workspaceInstance(workspaceID), script)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	cmd := exec.CommandContext(ctx, "ssh", sshArgs...)
+	// The decoder may already hold bytes sent after the request.
+	cmd.Stdin = io.MultiReader(dec.Buffered(), conn)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		fail(err.Error())
+		return
+	}
+	if err := writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 0}); err == nil {
+		_, _ = io.Copy(conn, stdout)
+	}
+	// Closing conn ends the copy into ssh's stdin, which Wait waits on.
+	_ = conn.Close()
+	_ = cmd.Wait()
+}
+
 func startLimaShell(ctx context.Context, instanceName, workdir, localPath, shell string) (*exec.Cmd, *os.File, error) {
-	launchShell := shared.NormalizeLaunchShell(shell)
+	candidates, err := limaShellCandidates(ctx, instanceName, workdir, localPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return shared.TrySSHShellPTY(ctx, shared.TrySSHPTYOptions{
+		Candidates:          candidates,
+		LaunchShell:         shared.NormalizeLaunchShell(shell),
+		Workdir:             strings.TrimSpace(workdir),
+		BeforeEachCandidate: ensureLimaInstanceRunningFn,
+		PtyStart:            ptyStartWithSizeFn,
+		ErrPrefix:           "lima guest shell start failed",
+	})
+}
+
+// limaShellCandidates returns the instances a shell for instanceName may
+// start in. With localPath set, the workspace is mounted at workdir first
+// and only the instance that mounted it is returned.
+func limaShellCandidates(ctx context.Context, instanceName, workdir, localPath string) ([]string, error) {
 	workdir = strings.TrimSpace(workdir)
 	localPath = strings.TrimSpace(localPath)
 
@@ -475,18 +667,10 @@ func startLimaShell(ctx context.Context, instanceName, workdir, localPath, shell
 			if strings.TrimSpace(lastMountErr) == "" {
 				lastMountErr = "no available lima candidates"
 			}
-			return nil, nil, fmt.Errorf("prepare workspace mount failed: %s", lastMountErr)
+			return nil, fmt.Errorf("prepare workspace mount failed: %s", lastMountErr)
 		}
 	}
-
-	return shared.TrySSHShellPTY(ctx, shared.TrySSHPTYOptions{
-		Candidates:          candidates,
-		LaunchShell:         launchShell,
-		Workdir:             workdir,
-		BeforeEachCandidate: ensureLimaInstanceRunningFn,
-		PtyStart:            ptyStartWithSizeFn,
-		ErrPrefix:           "lima guest shell start failed",
-	})
+	return candidates, nil
 }
 
 func guestWorkdirForID(workspaceID string) string {
@@ -901,28 +1085,168 @@ func (d *GuestDriver) buildRemoteShellCmd(workspaceID string) string {
 	return cmd
 }
 
-func (d *GuestDriver) scanPorts(ctx context.Context, workspaceID string) []map[string]any {
-	instance := d.workspaceInstance(workspaceID)
-	log.Printf("[DEBUG scanPorts] Using instance: %s", instance)
-	// Use ss to list listening TCP ports
-	script := `ss -tlnp 2>/dev/null | awk 'NR>1 {split($4, a, ":"); print a[length(a)], $NF}' | while read port process; do \
+// limaListPortsScript prints one JSON object per listening TCP port.
+const limaListPortsScript = `ss -tlnp 2>/dev/null | awk 'NR>1 {split($4, a, ":"); print a[length(a)], $NF}' | sort -un | while read port process; do \
 		if [ -n "$port" ] && [ "$port" != "0" ] && [ -n "$process" ]; then
 			process_escaped=$(echo "$process" | sed 's/"/\\"/g')
 			echo "{\"port\": $port, \"process\": \"$process_escaped\"}"
 		fi
 	done`
 
-	log.Printf("[DEBUG scanPorts] Executing script: %s", script)
-	out, err := shared.DirectSSHScript(ctx, instance, script)
+// limaPortsWatchEnd terminates each port set printed by limaWatchPortsScript.
+const limaPortsWatchEnd = "--nexus-ports--"
+
+// limaWatchPortsScript polls the listening set inside the guest and prints it
+// only when it changes, so one SSH session serves a whole ports.watch
+// subscription.
+var limaWatchPortsScript = `prev="__init__"; while :; do cur=$(` + limaListPortsScript + `); if [ "$cur" != "$prev" ]; then [ -n "$cur" ] && printf '%s\n' "$cur"; echo "` + limaPortsWatchEnd + `"; prev="$cur"; fi; sleep 1; done`
+
+func (d *GuestDriver) scanPorts(ctx context.Context, workspaceID string) []map[string]any {
+	instance := d.workspaceInstance(workspaceID)
+	out, err := shared.DirectSSHScript(ctx, instance, limaListPortsScript)
 	if err != nil {
-		log.Printf("[DEBUG scanPorts] Command error: %v", err)
-		log.Printf("[DEBUG scanPorts] Raw output (on error): %s", string(out))
+		log.Printf("[lima] scan ports in %s: %v: %s", instance, err, strings.TrimSpace(string(out)))
 		return nil
 	}
-	log.Printf("[DEBUG scanPorts] Raw output: %s", string(out))
+	return parseLimaPortLines(strings.Split(string(out), "\n"))
+}
+
+// watchPorts streams the guest's listening ports to emit until ctx is
+// cancelled or emit fails.
+func (d *GuestDriver) watchPorts(ctx context.Context, workspaceID string, emit func([]map[string]any) error) error {
+	instance := d.workspaceInstance(workspaceID)
+	args, err := shared.DirectSSHScriptArgs(instance, limaWatchPortsScript)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start port watch in %s: %w", instance, err)
+	}
+	defer func() { _ = cmd.Wait() }()
+
+	scanner := bufio.NewScanner(stdout)
+	var pending []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) != limaPortsWatchEnd {
+			pending = append(pending, line)
+			continue
+		}
+		if err := emit(parseLimaPortLines(pending)); err != nil {
+			return err
+		}
+		pending = pending[:0]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("port watch in %s ended", instance)
+}
+
+// execCommand runs an agent-style exec request in the guest over SSH. With
+// "stream" set, output is sent as chunk messages before the final result.
+func (d *GuestDriver) execCommand(ctx context.Context, workspaceID string, req map[string]any, writeJSON func(map[string]any) error) {
+	id, _ := req["id"].(string)
+	command, _ := req["command"].(string)
+	stream, _ := req["stream"].(bool)
+	workdir, _ := req["workdir"].(string)
+	if strings.TrimSpace(workdir) == "" {
+		workdir = guestWorkdirForID(workspaceID)
+	}
+	fail := func(msg string) {
+		_ = writeJSON(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": msg})
+	}
+	if strings.TrimSpace(command) == "" {
+		fail("command is required")
+		return
+	}
+
+	argv := []string{shared.ShellQuote(command)}
+	if rawArgs, ok := req["args"].([]any); ok {
+		for _, a := range rawArgs {
+			if s, ok := a.(string); ok {
+				argv = append(argv, shared.ShellQuote(s))
+			}
+		}
+	}
+	if rawEnv, ok := req["env"].([]any); ok && len(rawEnv) > 0 {
+		envArgs := []string{"env"}
+		for _, e := range rawEnv {
+			if s, ok := e.(string); ok {
+				envArgs = append(envArgs, shared.ShellQuote(s))
+			}
+		}
+		argv = append(envArgs, argv...)
+	}
+	script := "cd " + shared.ShellQuote(workdir) + " && exec " + strings.Join(argv, " ")
+
+	sshArgs, err := shared.DirectSSHScriptArgs(d.workspaceInstance(workspaceID), script)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	cmd := exec.CommandContext(ctx, "ssh", sshArgs...)
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		fail(err.Error())
+		return
+	}
+
+	collect := func(name string, r io.Reader, out *strings.Builder, done chan<- struct{}) {
+		defer close(done)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text() + "\n"
+			// Streamed output is not kept: a follow may never end.
+			if stream {
+				_ = writeJSON(map[string]any{"id": id, "type": "chunk", "stream": name, "data": line})
+			} else {
+				out.WriteString(line)
+			}
+		}
+	}
+	var stdout, stderr strings.Builder
+	stdoutDone, stderrDone := make(chan struct{}), make(chan struct{})
+	go collect("stdout", stdoutPipe, &stdout, stdoutDone)
+	go collect("stderr", stderrPipe, &stderr, stderrDone)
+	<-stdoutDone
+	<-stderrDone
+
+	exitCode := 0
+	if err := cmd.Wait(); err != nil {
+		exitCode = 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	_ = writeJSON(map[string]any{
+		"id":        id,
+		"type":      "result",
+		"exit_code": exitCode,
+		"stdout":    stdout.String(),
+		"stderr":    stderr.String(),
+	})
+}
 
-	var ports []map[string]any
-	for _, line := range strings.Split(string(out), "\n") {
+func parseLimaPortLines(lines []string) []map[string]any {
+	ports := []map[string]any{}
+	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" || !strings.HasPrefix(line, "{") {
 			continue
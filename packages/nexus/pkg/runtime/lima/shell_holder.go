@@ -0,0 +1,250 @@
+package lima
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/drivers/shared"
+)
+
+// shellHolderScript keeps persistent shells running inside the guest, so
+// they survive both the connection and the daemon. It runs on the guest's
+// python3, which lima images carry for cloud-init.
+//
+//go:embed shell_holder.py
+var shellHolderScript string
+
+// holderCloseTimeout bounds how long shell.close waits for the holder to
+// end the shell before the relay is killed.
+const holderCloseTimeout = 5 * time.Second
+
+// sshShellHolderCommand runs the shell holder with args in instance over ssh.
+func sshShellHolderCommand(instance string, args ...string) (*exec.Cmd, error) {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, shared.ShellQuote(shellHolderScript))
+	for _, arg := range args {
+		quoted = append(quoted, shared.ShellQuote(arg))
+	}
+	sshArgs, err := shared.DirectSSHScriptArgs(instance, "exec python3 -c "+strings.Join(quoted, " "))
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command("ssh", sshArgs...), nil
+}
+
+// probeShellHolder reports whether instance has what the shell holder needs.
+func probeShellHolder(ctx context.Context, instance string) (bool, error) {
+	out, err := shared.DirectSSHScript(ctx, instance, "if command -v python3 >/dev/null 2>&1; then echo yes; else echo no; fi")
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return strings.HasSuffix(strings.TrimSpace(string(out)), "yes"), nil
+}
+
+// persistsShells answers agent.features for workspaceID. The answer is kept
+// per instance once the guest has been reached.
+func (d *GuestDriver) persistsShells(ctx context.Context, workspaceID string) bool {
+	instance := d.workspaceInstance(workspaceID)
+	d.mu.RLock()
+	ok, cached := d.holderInstances[instance]
+	d.mu.RUnlock()
+	if cached {
+		return ok
+	}
+	ok, err := d.probeHolder(ctx, instance)
+	if err != nil {
+		log.Printf("[lima] probe shell holder in %s: %v", instance, err)
+		return false
+	}
+	d.mu.Lock()
+	if d.holderInstances == nil {
+		d.holderInstances = make(map[string]bool)
+	}
+	d.holderInstances[instance] = ok
+	d.mu.Unlock()
+	return ok
+}
+
+// holderFrame is one line from the shell holder.
+type holderFrame struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error"`
+	Data  []byte `json:"data"`
+	Seq   uint64 `json:"seq"`
+	Exit  *int   `json:"exit"`
+}
+
+// holderShell is this connection's attach to a shell kept by the guest-side
+// holder. Ending the attach leaves the shell running; close ends the shell.
+type holderShell struct {
+	id   string
+	cmd  *exec.Cmd
+	out  *bufio.Reader
+	done chan struct{}
+
+	mu       sync.Mutex
+	in       io.WriteCloser
+	detached bool
+}
+
+// startHolderShell runs the holder with args in instance and waits until it
+// is attached to shell id.
+func (d *GuestDriver) startHolderShell(instance, id string, args ...string) (*holderShell, error) {
+	cmd, err := d.holderCommand(instance, args...)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start shell holder in %s: %w", instance, err)
+	}
+	fail := func(err error) (*holderShell, error) {
+		_ = stdin.Close()
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+
+	out := bufio.NewReader(stdout)
+	for {
+		line, err := out.ReadBytes('\n')
+		if err != nil {
+			_, _ = fail(nil)
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("shell holder in %s: %s", instance, msg)
+			}
+			return nil, fmt.Errorf("shell holder in %s: %w", instance, err)
+		}
+		var frame holderFrame
+		// A login shell may print before the holder starts.
+		if json.Unmarshal(line, &frame) != nil {
+			continue
+		}
+		if frame.Error != "" {
+			return fail(errors.New(frame.Error))
+		}
+		if frame.Ready {
+			break
+		}
+	}
+	return &holderShell{id: id, cmd: cmd, out: out, done: make(chan struct{}), in: stdin}, nil
+}
+
+// relay sends the shell's output and exit as chunk and result messages for
+// h.id until the attach ends.
+func (h *holderShell) relay(writeJSON func(map[string]any) error) {
+	defer close(h.done)
+	dec := json.NewDecoder(h.out)
+	exited := false
+	for {
+		var frame holderFrame
+		if err := dec.Decode(&frame); err != nil {
+			break
+		}
+		if frame.Exit != nil {
+			exited = true
+			_ = writeJSON(map[string]any{"id": h.id, "type": "result", "exit_code": *frame.Exit})
+			continue
+		}
+		if len(frame.Data) > 0 {
+			_ = writeJSON(map[string]any{"id": h.id, "type": "chunk", "stream": "stdout", "data": string(frame.Data), "seq": frame.Seq})
+		}
+	}
+	_ = h.cmd.Wait()
+
+	h.mu.Lock()
+	detached := h.detached
+	h.mu.Unlock()
+	if !exited && !detached {
+		_ = writeJSON(map[string]any{"id": h.id, "type": "result", "exit_code": 1, "stderr": "shell holder connection lost"})
+	}
+}
+
+func (h *holderShell) send(msg map[string]any) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = h.in.Write(append(line, '\n'))
+	return err
+}
+
+func (h *holderShell) write(data []byte) error {
+	return h.send(map[string]any{"data": data})
+}
+
+func (h *holderShell) resize(cols, rows int) error {
+	return h.send(map[string]any{"resize": []int{cols, rows}})
+}
+
+// detach ends the attach and leaves the shell running in the guest.
+func (h *holderShell) detach() {
+	h.mu.Lock()
+	h.detached = true
+	_ = h.in.Close()
+	h.mu.Unlock()
+	_ = h.cmd.Process.Kill()
+}
+
+// close ends the shell, then the attach.
+func (h *holderShell) close() {
+	_ = h.send(map[string]any{"close": true})
+	h.mu.Lock()
+	h.detached = true
+	_ = h.in.Close()
+	h.mu.Unlock()
+	select {
+	case <-h.done:
+	case <-time.After(holderCloseTimeout):
+		_ = h.cmd.Process.Kill()
+	}
+}
+
+// openHolderShell starts shell id in the first reachable candidate for
+// instance, preparing the workspace mount first, and returns the instance
+// it runs in.
+func (d *GuestDriver) openHolderShell(ctx context.Context, instance, id, workdir, localPath, command string, cols, rows int) (*holderShell, string, error) {
+	candidates, err := limaShellCandidates(ctx, instance, workdir, localPath)
+	if err != nil {
+		return nil, "", err
+	}
+	args := []string{"open", id, strconv.Itoa(cols), strconv.Itoa(rows), workdir, command}
+	var lastErr error
+	for _, candidate := range candidates {
+		if err := ensureLimaInstanceRunningFn(ctx, candidate); err != nil {
+			lastErr = err
+			continue
+		}
+		h, err := d.startHolderShell(candidate, id, args...)
+		if err == nil {
+			return h, candidate, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no lima instance candidates available")
+	}
+	return nil, "", fmt.Errorf("lima guest shell start failed: %w", lastErr)
+}
@@ -0,0 +1,273 @@
+# Guest-side holder for persistent lima shells.
+#
+# "open" starts a shell on a terminal inside a detached holder process and
+# then attaches to it; "attach" connects to a holder started earlier. Each
+# holder listens on ~/.nexus/shells/<id>/sock, keeps the shell's recent
+# output for replay, and outlives the ssh session that attached to it, so a
+# restarted daemon can attach again.
+#
+# An attached client sends {"since": N} first, then {"data": base64},
+# {"resize": [cols, rows]} or {"close": true} lines. The holder answers
+# {"ready": true, "seq": N}, then {"data": base64, "seq": N} for output and
+# {"exit": code} when the shell exits. seq counts every byte the shell
+# produced. A failed attach prints {"error": message}.
+import base64
+import fcntl
+import json
+import os
+import pty
+import select
+import signal
+import socket
+import struct
+import sys
+import termios
+import time
+
+BUFFER_BYTES = 256 << 10
+IDLE_TIMEOUT = 24 * 3600
+EXITED_TTL = 600
+
+
+def shell_dir(session_id):
+    return os.path.join(os.path.expanduser("~"), ".nexus", "shells", session_id)
+
+
+def write_all(fd, data):
+    while data:
+        n = os.write(fd, data)
+        data = data[n:]
+
+
+def emit(frame):
+    write_all(1, (json.dumps(frame) + "\n").encode())
+
+
+def set_size(fd, cols, rows):
+    if cols > 0 and rows > 0:
+        fcntl.ioctl(fd, termios.TIOCSWINSZ, struct.pack("HHHH", rows, cols, 0, 0))
+
+
+def send(client, frame):
+    try:
+        client.sendall((json.dumps(frame) + "\n").encode())
+        return True
+    except OSError:
+        return False
+
+
+def serve(session_id, cols, rows, workdir, command, ready_fd):
+    path = os.path.join(shell_dir(session_id), "sock")
+    listener = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+    listener.bind(path)
+    listener.listen(4)
+
+    pid, master = pty.fork()
+    if pid == 0:
+        try:
+            os.chdir(workdir)
+        except OSError as err:
+            sys.stderr.write("cd %s: %s\n" % (workdir, err.strerror))
+            os._exit(1)
+        os.environ["TERM"] = "xterm-256color"
+        # The ssh agent forwarded to the opening session goes away with it;
+        # use the guest's own agent when there is one.
+        os.environ.pop("SSH_AUTH_SOCK", None)
+        agent = os.path.join(os.path.expanduser("~"), ".ssh", "nexus-agent.sock")
+        if os.path.exists(agent):
+            os.environ["SSH_AUTH_SOCK"] = agent
+        os.execvp("sh", ["sh", "-c", command])
+    set_size(master, cols, rows)
+    write_all(ready_fd, b"1")
+    os.close(ready_fd)
+
+    buf = bytearray()
+    seq = 0
+    client = None
+    pending = bytearray()
+    ready = False
+    exited = False
+    code = 0
+    detached_at = time.monotonic()
+    done = False
+
+    def drop_client():
+        nonlocal client, detached_at
+        if client is not None:
+            client.close()
+        client = None
+        detached_at = time.monotonic()
+
+    while not done:
+        timeout = None
+        if client is None:
+            limit = EXITED_TTL if exited else IDLE_TIMEOUT
+            timeout = detached_at + limit - time.monotonic()
+            if timeout <= 0:
+                break
+        fds = [listener]
+        if not exited:
+            fds.append(master)
+        if client is not None:
+            fds.append(client)
+        readable, _, _ = select.select(fds, [], [], timeout)
+
+        if master in readable:
+            try:
+                data = os.read(master, 65536)
+            except OSError:
+                data = b""
+            if data:
+                seq += len(data)
+                buf += data
+                if len(buf) > BUFFER_BYTES:
+                    del buf[: len(buf) - BUFFER_BYTES]
+                if client is not None and ready:
+                    if not send(client, {"data": base64.b64encode(data).decode(), "seq": seq}):
+                        drop_client()
+            else:
+                exited = True
+                _, status = os.waitpid(pid, 0)
+                if os.WIFEXITED(status):
+                    code = os.WEXITSTATUS(status)
+                else:
+                    code = 128 + os.WTERMSIG(status)
+                os.close(master)
+                if client is not None and ready:
+                    send(client, {"exit": code})
+                    break
+                detached_at = time.monotonic()
+
+        if client is not None and client in readable:
+            try:
+                data = client.recv(65536)
+            except OSError:
+                data = b""
+            if not data:
+                drop_client()
+            else:
+                pending += data
+                while client is not None and b"\n" in pending:
+                    line, _, rest = bytes(pending).partition(b"\n")
+                    pending = bytearray(rest)
+                    try:
+                        msg = json.loads(line)
+                    except ValueError:
+                        continue
+                    if not ready:
+                        ready = True
+                        oldest = seq - len(buf)
+                        since = max(int(msg.get("since", 0)), oldest)
+                        send(client, {"ready": True, "seq": seq})
+                        if since < seq:
+                            send(client, {"data": base64.b64encode(bytes(buf[since - oldest :])).decode(), "seq": seq})
+                        if exited:
+                            send(client, {"exit": code})
+                            done = True
+                            break
+                    elif "data" in msg and not exited:
+                        write_all(master, base64.b64decode(msg["data"]))
+                    elif "resize" in msg and not exited:
+                        cols, rows = msg["resize"]
+                        set_size(master, int(cols), int(rows))
+                    elif msg.get("close"):
+                        done = True
+                        break
+
+        if listener in readable:
+            conn, _ = listener.accept()
+            drop_client()
+            client = conn
+            pending = bytearray()
+            ready = False
+
+    if not exited:
+        try:
+            os.killpg(pid, signal.SIGKILL)
+        except OSError:
+            pass
+        os.waitpid(pid, 0)
+    if client is not None:
+        client.close()
+    listener.close()
+    try:
+        os.unlink(path)
+        os.rmdir(os.path.dirname(path))
+    except OSError:
+        pass
+
+
+def attach(session_id, since):
+    sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+    try:
+        sock.connect(os.path.join(shell_dir(session_id), "sock"))
+    except OSError:
+        emit({"error": "shell session not found"})
+        return 1
+    sock.sendall((json.dumps({"since": since}) + "\n").encode())
+    stdin_open = True
+    while True:
+        fds = [sock]
+        if stdin_open:
+            fds.append(0)
+        readable, _, _ = select.select(fds, [], [])
+        if sock in readable:
+            data = sock.recv(65536)
+            if not data:
+                return 0
+            write_all(1, data)
+        if 0 in readable:
+            data = os.read(0, 65536)
+            if data:
+                sock.sendall(data)
+            else:
+                stdin_open = False
+                sock.shutdown(socket.SHUT_WR)
+
+
+def open_shell(session_id, cols, rows, workdir, command):
+    directory = shell_dir(session_id)
+    try:
+        os.makedirs(directory, mode=0o700)
+    except FileExistsError:
+        emit({"error": "shell session %s already exists" % session_id})
+        return 1
+    read_fd, ready_fd = os.pipe()
+    pid = os.fork()
+    if pid == 0:
+        os.close(read_fd)
+        os.setsid()
+        if os.fork() > 0:
+            os._exit(0)
+        devnull = os.open(os.devnull, os.O_RDWR)
+        for fd in (0, 1, 2):
+            os.dup2(devnull, fd)
+        try:
+            serve(session_id, cols, rows, workdir, command, ready_fd)
+        finally:
+            os._exit(0)
+    os.close(ready_fd)
+    os.waitpid(pid, 0)
+    ok = os.read(read_fd, 1)
+    os.close(read_fd)
+    if ok != b"1":
+        for cleanup in (os.unlink, os.rmdir):
+            try:
+                cleanup(os.path.join(directory, "sock") if cleanup is os.unlink else directory)
+            except OSError:
+                pass
+        emit({"error": "shell holder failed to start"})
+        return 1
+    return attach(session_id, 0)
+
+
+def main(argv):
+    if len(argv) == 6 and argv[0] == "open":
+        return open_shell(argv[1], int(argv[2]), int(argv[3]), argv[4], argv[5])
+    if len(argv) == 3 and argv[0] == "attach":
+        return attach(argv[1], int(argv[2]))
+    emit({"error": "usage: open ID COLS ROWS WORKDIR COMMAND | attach ID SINCE"})
+    return 2
+
+
+sys.exit(main(sys.argv[1:]))
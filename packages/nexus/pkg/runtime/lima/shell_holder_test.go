@@ -0,0 +1,175 @@
+package lima
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/drivers/shared"
+)
+
+// holderConn drives serveShellProtocol over one connection.
+type holderConn struct {
+	t    *testing.T
+	conn net.Conn
+	enc  *json.Encoder
+	msgs chan map[string]any
+}
+
+func dialHolderDriver(t *testing.T, d *GuestDriver, workspaceID string) *holderConn {
+	t.Helper()
+	left, right := shared.BufferedPipe()
+	go d.serveShellProtocol(context.Background(), workspaceID, right)
+	c := &holderConn{t: t, conn: left, enc: json.NewEncoder(left), msgs: make(chan map[string]any, 64)}
+	go func() {
+		defer close(c.msgs)
+		dec := json.NewDecoder(left)
+		for {
+			var msg map[string]any
+			if err := dec.Decode(&msg); err != nil {
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+	return c
+}
+
+func (c *holderConn) send(msg map[string]any) {
+	c.t.Helper()
+	if err := c.enc.Encode(msg); err != nil {
+		c.t.Fatalf("send %v: %v", msg["type"], err)
+	}
+}
+
+// next returns the next message of type typ, skipping the others.
+func (c *holderConn) next(typ string) map[string]any {
+	c.t.Helper()
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.msgs:
+			if !ok {
+				c.t.Fatalf("connection ended waiting for %s", typ)
+			}
+			if msg["type"] == typ {
+				return msg
+			}
+		case <-deadline:
+			c.t.Fatalf("timed out waiting for %s", typ)
+		}
+	}
+}
+
+// output collects chunks until one contains want.
+func (c *holderConn) output(want string) {
+	c.t.Helper()
+	var got strings.Builder
+	for !strings.Contains(got.String(), want) {
+		chunk := c.next("chunk")
+		data, _ := chunk["data"].(string)
+		got.WriteString(data)
+	}
+}
+
+func newLocalHolderDriver(t *testing.T) *GuestDriver {
+	t.Helper()
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not available")
+	}
+	t.Setenv("HOME", t.TempDir())
+
+	origEnsure, origList := ensureLimaInstanceRunningFn, listLimaInstancesFn
+	t.Cleanup(func() {
+		ensureLimaInstanceRunningFn = origEnsure
+		listLimaInstancesFn = origList
+	})
+	ensureLimaInstanceRunningFn = func(context.Context, string) error { return nil }
+	listLimaInstancesFn = func(context.Context) ([]string, error) { return nil, nil }
+
+	d := NewGuestDriver()
+	d.bootstrapInstance = func(context.Context, string, string) error { return nil }
+	d.probeHolder = func(context.Context, string) (bool, error) { return true, nil }
+	d.holderCommand = func(_ string, args ...string) (*exec.Cmd, error) {
+		return exec.Command("python3", append([]string{"-c", shellHolderScript}, args...)...), nil
+	}
+	return d
+}
+
+func TestPersistentShellSurvivesConnection(t *testing.T) {
+	d := newLocalHolderDriver(t)
+	workdir := t.TempDir()
+
+	first := dialHolderDriver(t, d, "ws-holder")
+	first.send(map[string]any{"id": "f", "type": "agent.features"})
+	features := first.next("result")
+	if got, _ := features["features"].([]any); len(got) != 1 || got[0] != "shell.persist" {
+		t.Fatalf("expected shell.persist feature, got %v", features)
+	}
+
+	first.send(map[string]any{"id": "sh-1", "type": "shell.open", "command": "sh", "workdir": workdir, "persist": true, "cols": 80, "rows": 24})
+	if res := first.next("result"); res["exit_code"] != float64(0) {
+		t.Fatalf("shell.open failed: %v", res)
+	}
+	first.send(map[string]any{"id": "sh-1", "type": "shell.write", "data": "echo hello-$((40+2))\n"})
+	first.next("ack")
+	first.output("hello-42")
+	_ = first.conn.Close()
+
+	second := dialHolderDriver(t, d, "ws-holder")
+	defer second.conn.Close()
+	second.send(map[string]any{"id": "sh-1", "type": "shell.attach"})
+	if res := second.next("result"); res["exit_code"] != float64(0) {
+		t.Fatalf("shell.attach failed: %v", res)
+	}
+	second.output("hello-42")
+
+	second.send(map[string]any{"id": "sh-1", "type": "shell.write", "data": "pwd; exit 3\n"})
+	second.output(filepath.Base(workdir))
+	if res := second.next("result"); res["exit_code"] != float64(3) {
+		t.Fatalf("expected exit code 3, got %v", res)
+	}
+
+	dir := filepath.Join(os.Getenv("HOME"), ".nexus", "shells", "sh-1")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("holder left %s behind", dir)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	second.send(map[string]any{"id": "sh-1", "type": "shell.attach"})
+	res := second.next("result")
+	if res["exit_code"] != float64(1) || res["stderr"] != "shell session not found" {
+		t.Fatalf("expected attach to an ended shell to fail, got %v", res)
+	}
+}
+
+func TestShellCloseEndsPersistentShell(t *testing.T) {
+	d := newLocalHolderDriver(t)
+
+	c := dialHolderDriver(t, d, "ws-holder")
+	c.send(map[string]any{"id": "sh-2", "type": "shell.open", "command": "sh", "workdir": t.TempDir(), "persist": true})
+	if res := c.next("result"); res["exit_code"] != float64(0) {
+		t.Fatalf("shell.open failed: %v", res)
+	}
+	c.send(map[string]any{"id": "sh-2", "type": "shell.close"})
+	c.next("ack")
+
+	other := dialHolderDriver(t, d, "ws-holder")
+	defer other.conn.Close()
+	other.send(map[string]any{"id": "sh-2", "type": "shell.attach"})
+	if res := other.next("result"); res["exit_code"] != float64(1) {
+		t.Fatalf("expected closed shell to be gone, got %v", res)
+	}
+}
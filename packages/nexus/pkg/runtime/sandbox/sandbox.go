@@ -55,6 +55,20 @@ func ShellCommand(shell, workDir, repoRoot string) (*exec.Cmd, error) {
 	}
 }
 
+// Command builds a host process sandbox command that runs argv from workDir.
+func Command(workDir, repoRoot string, argv []string) (*exec.Cmd, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("process sandbox: empty command")
+	}
+	cmd, err := ShellCommand("sh", workDir, repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Args = append(cmd.Args, "-c", `exec "$@"`, "sh")
+	cmd.Args = append(cmd.Args, argv...)
+	return cmd, nil
+}
+
 func internalProcessSandboxEnabled(repoRoot string) bool {
 	root := strings.TrimSpace(repoRoot)
 	if root == "" {
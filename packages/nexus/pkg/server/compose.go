@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/compose"
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/firecracker"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+// followComposeLogs streams compose logs to c as compose.logs.data
+// notifications until the logs end, compose.logs.stop is called or the
+// connection closes. A final compose.logs.end carries any error.
+func (s *Server) followComposeLogs(c *Connection, req handlers.ComposeLogsParams) string {
+	streamID := fmt.Sprintf("compose-logs-%d", time.Now().UnixNano())
+	ctx := c.startStream(streamID)
+	go func() {
+		defer c.endStream(streamID)
+		err := s.composeSvc.Logs(ctx, req.WorkspaceID, handlers.ComposeLogsOptions(req), func(line compose.LogLine) {
+			c.notify(ctx, "compose.logs.data", map[string]any{
+				"streamId": streamID,
+				"service":  line.Service,
+				"line":     line.Line,
+			})
+		})
+		end := map[string]any{"streamId": streamID}
+		if err != nil {
+			end["error"] = err.Error()
+		}
+		c.notify(ctx, "compose.logs.end", end)
+	}()
+	return streamID
+}
+
+// workspaceCommandRunner runs commands for a workspace: through the guest
+// agent for VM backends, or in the host worktree for local backends.
+type workspaceCommandRunner struct {
+	s *Server
+}
+
+func (r workspaceCommandRunner) Run(ctx context.Context, workspaceID string, argv []string, onOutput func(stream, data string)) (compose.CommandResult, error) {
+	if len(argv) == 0 {
+		return compose.CommandResult{}, errors.New("command required")
+	}
+	ws, ok := r.s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return compose.CommandResult{}, fmt.Errorf("workspace not found")
+	}
+	if driver, dial, ok := r.s.workspaceAgent(ws); ok {
+		return runAgentCommand(ctx, dial, guestWorkdir(driver, ws.ID), ws.ID, argv, nil, onOutput)
+	}
+	root := preferredWorkspaceRoot(ws)
+	if root == "" {
+		return compose.CommandResult{}, fmt.Errorf("workspace %s has no host path", ws.ID)
+	}
+	return runHostCommand(ctx, root, argv, onOutput)
+}
+
+// workspaceAgent returns the runtime driver of ws and its guest agent dialer
+// when the workspace runs in a VM.
+func (s *Server) workspaceAgent(ws *workspacemgr.Workspace) (runtime.Driver, func(context.Context, string) (net.Conn, error), bool) {
+	if s.runtimeFactory == nil {
+		return nil, nil, false
+	}
+	backend := strings.TrimSpace(ws.Backend)
+	if backend == "" {
+		backend = "firecracker"
+	}
+	driver, ok := s.runtimeFactory.DriverForBackend(backend)
+	if !ok {
+		return nil, nil, false
+	}
+	connector, ok := driver.(interface {
+		AgentConn(context.Context, string) (net.Conn, error)
+	})
+	if !ok {
+		return nil, nil, false
+	}
+	return driver, connector.AgentConn, true
+}
+
+// workspaceReadyDeps wires readiness checks to the workspace. Network probes
+// of VM workspaces run inside the guest, where the services listen.
+func (s *Server) workspaceReadyDeps(workspaceID string) handlers.WorkspaceReadyDeps {
+	deps := handlers.WorkspaceReadyDeps{Services: s.serviceMgr, Compose: s.composeSvc}
+	if ws, ok := s.workspaceMgr.Get(workspaceID); ok {
+		if _, _, inGuest := s.workspaceAgent(ws); inGuest {
+			runner := workspaceCommandRunner{s: s}
+			deps.Run = func(ctx context.Context, argv []string) (compose.CommandResult, error) {
+				return runner.Run(ctx, workspaceID, argv, nil)
+			}
+		}
+	}
+	return deps
+}
+
+func guestWorkdir(driver runtime.Driver, workspaceID string) string {
+	if provider, ok := driver.(runtime.GuestWorkdirProvider); ok {
+		if workdir := strings.TrimSpace(provider.GuestWorkdir(workspaceID)); workdir != "" {
+			return workdir
+		}
+	}
+	return "/workspace"
+}
+
+func runAgentCommand(ctx context.Context, dial func(context.Context, string) (net.Conn, error), workdir, workspaceID string, argv, env []string, onOutput func(stream, data string)) (compose.CommandResult, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := dial(dialCtx, workspaceID)
+	cancel()
+	if err != nil {
+		return compose.CommandResult{}, fmt.Errorf("agent connect: %w", err)
+	}
+	defer conn.Close()
+	// Closing the connection is the only way to abandon a running exec.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	result, err := firecracker.NewAgentClient(conn).ExecStreaming(ctx, firecracker.ExecRequest{
+		ID:      fmt.Sprintf("cmd-%d", time.Now().UnixNano()),
+		Command: argv[0],
+		Args:    argv[1:],
+		WorkDir: workdir,
+		Env:     env,
+		Stream:  onOutput != nil,
+	}, onOutput)
+	if err != nil {
+		return compose.CommandResult{}, err
+	}
+	return compose.CommandResult{ExitCode: result.ExitCode, Stdout: result.Stdout, Stderr: result.Stderr}, nil
+}
+
+func runHostCommand(ctx context.Context, dir string, argv []string, onOutput func(stream, data string)) (compose.CommandResult, error) {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	return runCommand(cmd, onOutput)
+}
+
+// runCommand runs cmd, streaming its output to onOutput. Streamed output is
+// not kept, so a follow can run for as long as it likes; without onOutput
+// it is returned in the result. A non-zero exit is reported in the result
+// rather than as an error.
+func runCommand(cmd *exec.Cmd, onOutput func(stream, data string)) (compose.CommandResult, error) {
+	var stdout, stderr bytes.Buffer
+	var mu sync.Mutex
+	cmd.Stdout = &streamWriter{buf: &stdout, stream: "stdout", mu: &mu, onOutput: onOutput}
+	cmd.Stderr = &streamWriter{buf: &stderr, stream: "stderr", mu: &mu, onOutput: onOutput}
+	err := cmd.Run()
+	res := compose.CommandResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		return res, nil
+	}
+	return res, err
+}
+
+type streamWriter struct {
+	buf      *bytes.Buffer
+	stream   string
+	mu       *sync.Mutex
+	onOutput func(stream, data string)
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.onOutput != nil {
+		w.onOutput(w.stream, string(p))
+	} else {
+		w.buf.Write(p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/compose"
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+)
+
+type scriptedComposeRunner struct {
+	chunks []string
+	block  bool
+}
+
+func (r scriptedComposeRunner) Run(ctx context.Context, _ string, _ []string, onOutput func(stream, data string)) (compose.CommandResult, error) {
+	for _, chunk := range r.chunks {
+		onOutput("stdout", chunk)
+	}
+	if r.block {
+		<-ctx.Done()
+		return compose.CommandResult{}, ctx.Err()
+	}
+	return compose.CommandResult{}, nil
+}
+
+func readNotification(t *testing.T, c *Connection) (string, map[string]any) {
+	t.Helper()
+	select {
+	case raw := <-c.send:
+		var msg struct {
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+		}
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			t.Fatalf("decode notification: %v", err)
+		}
+		return msg.Method, msg.Params
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+	return "", nil
+}
+
+func TestFollowComposeLogsStreamsNotifications(t *testing.T) {
+	srv := &Server{composeSvc: compose.NewServices(scriptedComposeRunner{chunks: []string{"web-1  | ready\n"}})}
+	c := &Connection{send: make(chan []byte, 8)}
+
+	streamID := srv.followComposeLogs(c, handlers.ComposeLogsParams{WorkspaceID: "ws-1", Follow: true})
+	method, params := readNotification(t, c)
+	if method != "compose.logs.data" || params["streamId"] != streamID || params["service"] != "web" || params["line"] != "ready" {
+		t.Fatalf("unexpected data notification %s %#v", method, params)
+	}
+	method, params = readNotification(t, c)
+	if method != "compose.logs.end" || params["streamId"] != streamID || params["error"] != nil {
+		t.Fatalf("unexpected end notification %s %#v", method, params)
+	}
+}
+
+func TestComposeLogStreamsStopWithConnection(t *testing.T) {
+	srv := &Server{composeSvc: compose.NewServices(scriptedComposeRunner{block: true})}
+	c := &Connection{send: make(chan []byte, 8)}
+
+	streamID := srv.followComposeLogs(c, handlers.ComposeLogsParams{WorkspaceID: "ws-1", Follow: true})
+	if !c.stopStream(streamID) {
+		t.Fatal("expected stream to be registered")
+	}
+	if c.stopStream(streamID) {
+		t.Fatal("expected stream to be gone after stop")
+	}
+
+	srv.followComposeLogs(c, handlers.ComposeLogsParams{WorkspaceID: "ws-1", Follow: true})
+	c.stopAllStreams()
+	c.streamMu.Lock()
+	remaining := len(c.streams)
+	c.streamMu.Unlock()
+	if remaining != 0 {
+		t.Fatalf("expected all streams stopped, %d remain", remaining)
+	}
+}
+
+func TestRunHostCommandStreamsOutputAndExitCode(t *testing.T) {
+	var streamed strings.Builder
+	res, err := runHostCommand(context.Background(), t.TempDir(), []string{"sh", "-c", "echo out; echo err >&2; exit 3"}, func(stream, data string) {
+		streamed.WriteString(stream + ":" + data)
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	// Streamed output is not kept as well.
+	if res.ExitCode != 3 || res.Stdout != "" || res.Stderr != "" {
+		t.Fatalf("unexpected result %#v", res)
+	}
+	if !strings.Contains(streamed.String(), "stdout:out\n") || !strings.Contains(streamed.String(), "stderr:err\n") {
+		t.Fatalf("expected streamed output, got %q", streamed.String())
+	}
+
+	res, err = runHostCommand(context.Background(), t.TempDir(), []string{"sh", "-c", "echo out; echo err >&2"}, nil)
+	if err != nil || res.Stdout != "out\n" || res.Stderr != "err\n" {
+		t.Fatalf("unexpected buffered result %#v, %v", res, err)
+	}
+}
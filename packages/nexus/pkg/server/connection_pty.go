@@ -79,3 +79,14 @@ func (c *Connection) DetachAllPTY() {
 	c.pty = make(map[string]*pty.Session)
 	c.ptyMu.Unlock()
 }
+
+// Participant identifies this connection in PTY presence.
+func (c *Connection) Participant() pty.Participant {
+	p := pty.Participant{ClientID: c.clientID}
+	if c.identity != nil {
+		p.Subject = c.identity.Subject
+		p.Name = c.identity.Name
+		p.Email = c.identity.Email
+	}
+	return p
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// startStream registers a server-push stream owned by c. The returned
+// context is cancelled by stopStream or when the connection goes away.
+func (c *Connection) startStream(id string) context.Context {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	return c.startStreamLocked(id)
+}
+
+// startStreamWithin starts a stream unless c already runs limit streams
+// whose IDs start with prefix.
+func (c *Connection) startStreamWithin(id, prefix string, limit int) (context.Context, bool) {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	n := 0
+	for existing := range c.streams {
+		if strings.HasPrefix(existing, prefix) {
+			n++
+		}
+	}
+	if n >= limit {
+		return nil, false
+	}
+	return c.startStreamLocked(id), true
+}
+
+func (c *Connection) startStreamLocked(id string) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	if c.streams == nil {
+		c.streams = make(map[string]context.CancelFunc)
+	}
+	if prev, ok := c.streams[id]; ok {
+		prev()
+	}
+	c.streams[id] = cancel
+	return ctx
+}
+
+// endStream forgets a stream that finished on its own.
+func (c *Connection) endStream(id string) {
+	c.streamMu.Lock()
+	cancel, ok := c.streams[id]
+	delete(c.streams, id)
+	c.streamMu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// stopStream cancels a stream started on this connection.
+func (c *Connection) stopStream(id string) bool {
+	c.streamMu.Lock()
+	_, ok := c.streams[id]
+	c.streamMu.Unlock()
+	if ok {
+		c.endStream(id)
+	}
+	return ok
+}
+
+func (c *Connection) stopAllStreams() {
+	c.streamMu.Lock()
+	streams := c.streams
+	c.streams = nil
+	c.streamMu.Unlock()
+	for _, cancel := range streams {
+		cancel()
+	}
+}
+
+// notify sends a JSON-RPC notification unless ctx is done, so a stream
+// never blocks on a connection that has stopped draining.
+func (c *Connection) notify(ctx context.Context, method string, params any) bool {
+	encoded, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return false
+	}
+	select {
+	case c.send <- encoded:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
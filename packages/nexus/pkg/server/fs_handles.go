@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+)
+
+const (
+	// maxFilesPerConn bounds the fs.open handles one connection may hold.
+	maxFilesPerConn = 64
+	// maxTailsPerConn bounds its fs.tail streams.
+	maxTailsPerConn  = 16
+	tailStreamPrefix = "fs-tail-"
+)
+
+// addFile registers an open file under a new handle, unless c already
+// holds maxFilesPerConn of them.
+func (c *Connection) addFile(f *os.File) (string, bool) {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+	if len(c.files) >= maxFilesPerConn {
+		return "", false
+	}
+	if c.files == nil {
+		c.files = make(map[string]*os.File)
+	}
+	id := fmt.Sprintf("fh-%d", time.Now().UnixNano())
+	for c.files[id] != nil {
+		id += "x"
+	}
+	c.files[id] = f
+	return id, true
+}
+
+func (c *Connection) file(id string) (*os.File, bool) {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+	f, ok := c.files[id]
+	return f, ok
+}
+
+func (c *Connection) closeFile(id string) bool {
+	c.fileMu.Lock()
+	f, ok := c.files[id]
+	delete(c.files, id)
+	c.fileMu.Unlock()
+	if ok {
+		_ = f.Close()
+	}
+	return ok
+}
+
+// closeAllFiles closes the handles of a connection that went away.
+func (c *Connection) closeAllFiles() {
+	c.fileMu.Lock()
+	files := c.files
+	c.files = nil
+	c.fileMu.Unlock()
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+func (s *Server) openFile(c *Connection, req handlers.OpenParams) (*handlers.OpenResult, *rpckit.RPCError) {
+	f, rpcErr := handlers.OpenFile(req, s.resolveWorkspaceTyped(req))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	id, ok := c.addFile(f)
+	if !ok {
+		_ = f.Close()
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("too many open files (limit %d per connection)", maxFilesPerConn)}
+	}
+	return &handlers.OpenResult{Handle: id, Path: req.Path, Size: size}, nil
+}
+
+// startTail follows a file for c. Data arrives as fs.tail.data
+// notifications; a final fs.tail.end carries the error of a tail that
+// failed. fs.tail.stop or closing the connection stops it.
+func (s *Server) startTail(c *Connection, req handlers.TailParams) (string, *rpckit.RPCError) {
+	streamID := fmt.Sprintf("%s%d", tailStreamPrefix, time.Now().UnixNano())
+	ctx, ok := c.startStreamWithin(streamID, tailStreamPrefix, maxTailsPerConn)
+	if !ok {
+		return "", &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("too many tails (limit %d per connection)", maxTailsPerConn)}
+	}
+	tail, rpcErr := handlers.OpenTail(req, s.resolveWorkspaceTyped(req))
+	if rpcErr != nil {
+		c.stopStream(streamID)
+		return "", rpcErr
+	}
+	go func() {
+		defer c.endStream(streamID)
+		err := tail.Follow(ctx, func(chunk handlers.TailChunk) {
+			c.notify(ctx, "fs.tail.data", map[string]any{"streamId": streamID, "data": chunk.Data, "offset": chunk.Offset, "truncated": chunk.Truncated})
+		})
+		if err != nil && ctx.Err() == nil {
+			c.notify(ctx, "fs.tail.end", map[string]any{"streamId": streamID, "error": err.Error()})
+		}
+	}()
+	return streamID, nil
+}
+
+// connFile finds the open file behind a handle of the calling connection.
+func connFile(conn any, handle string) (*os.File, *rpckit.RPCError) {
+	c, ok := conn.(*Connection)
+	if !ok {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "file handles require a streaming connection"}
+	}
+	f, ok := c.file(handle)
+	if !ok {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "unknown file handle"}
+	}
+	return f, nil
+}
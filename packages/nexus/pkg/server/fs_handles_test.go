@@ -0,0 +1,89 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+func TestFileHandlesAreLimitedAndClosedWithConnection(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{ws: ws}
+	c := &Connection{send: make(chan []byte, 8)}
+
+	var first *handlers.OpenResult
+	for i := 0; i < maxFilesPerConn; i++ {
+		opened, rpcErr := srv.openFile(c, handlers.OpenParams{Path: "a.txt"})
+		if rpcErr != nil {
+			t.Fatalf("open %d: %v", i, rpcErr)
+		}
+		if first == nil {
+			first = opened
+		}
+	}
+	if _, rpcErr := srv.openFile(c, handlers.OpenParams{Path: "a.txt"}); rpcErr == nil {
+		t.Fatal("expected the handle limit to be enforced")
+	}
+	f, rpcErr := connFile(c, first.Handle)
+	if rpcErr != nil {
+		t.Fatalf("connFile: %v", rpcErr)
+	}
+	if !c.closeFile(first.Handle) {
+		t.Fatal("expected fs.close to find the handle")
+	}
+	if _, err := f.Stat(); err == nil {
+		t.Fatal("expected the closed handle's file to be closed")
+	}
+	if _, rpcErr := srv.openFile(c, handlers.OpenParams{Path: "a.txt"}); rpcErr != nil {
+		t.Fatalf("open after close: %v", rpcErr)
+	}
+
+	c.closeAllFiles()
+	if _, rpcErr := connFile(c, first.Handle); rpcErr == nil {
+		t.Fatal("expected no handles after the connection closed")
+	}
+}
+
+func TestStartTailStreamsAppends(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "app.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{ws: ws}
+	c := &Connection{send: make(chan []byte, 8)}
+	defer c.stopAllStreams()
+
+	if _, rpcErr := srv.startTail(c, handlers.TailParams{Path: "missing.log"}); rpcErr == nil {
+		t.Fatal("expected an error tailing a missing file")
+	}
+	streamID, rpcErr := srv.startTail(c, handlers.TailParams{Path: "app.log"})
+	if rpcErr != nil {
+		t.Fatalf("startTail: %v", rpcErr)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("new\n")
+	_ = f.Close()
+
+	method, params := readNotification(t, c)
+	if method != "fs.tail.data" || params["streamId"] != streamID || params["data"] != "new\n" || params["offset"] != float64(4) {
+		t.Fatalf("unexpected notification %s %#v", method, params)
+	}
+}
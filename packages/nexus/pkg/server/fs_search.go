@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filesearch"
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/firecracker"
+)
+
+// grepBatchSize is how many matches one fs.grep.match notification holds.
+const grepBatchSize = 100
+
+// guestSearchNotFoundExit is the agent's exit code for a search whose path
+// does not exist.
+const guestSearchNotFoundExit = 2
+
+// guestFiles returns the agent dialer and guest workdir of a VM workspace
+// the host has no worktree for, so the guest disk is the only copy of its
+// files.
+func (s *Server) guestFiles(workspaceID string) (func(context.Context, string) (net.Conn, error), string, bool) {
+	if workspaceID == "" {
+		return nil, "", false
+	}
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok || preferredWorkspaceRoot(ws) != "" {
+		return nil, "", false
+	}
+	driver, dial, ok := s.workspaceAgent(ws)
+	if !ok {
+		return nil, "", false
+	}
+	return dial, guestWorkdir(driver, ws.ID), true
+}
+
+// guestSearcher returns a way to search the workspace inside its VM when
+// its files only exist there.
+func (s *Server) guestSearcher(workspaceID string) (func(ctx context.Context, typ string, params any, onMatch func(json.RawMessage)) (json.RawMessage, *rpckit.RPCError), bool) {
+	dial, workdir, ok := s.guestFiles(workspaceID)
+	if !ok {
+		return nil, false
+	}
+	return func(ctx context.Context, typ string, params any, onMatch func(json.RawMessage)) (json.RawMessage, *rpckit.RPCError) {
+		return runGuestSearch(ctx, dial, workdir, workspaceID, typ, params, onMatch)
+	}, true
+}
+
+// runGuestSearch sends fs.find or fs.grep to the guest agent, which walks
+// the workspace there and answers with one "match" chunk per hit.
+func runGuestSearch(ctx context.Context, dial func(context.Context, string) (net.Conn, error), workdir, workspaceID, typ string, params any, onMatch func(json.RawMessage)) (json.RawMessage, *rpckit.RPCError) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, rpckit.ErrInvalidParams
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := dial(dialCtx, workspaceID)
+	cancel()
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("agent connect: %v", err)}
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	result, err := firecracker.NewAgentClient(conn).ExecStreaming(ctx, firecracker.ExecRequest{
+		ID:      fmt.Sprintf("%s-%d", typ, time.Now().UnixNano()),
+		Type:    typ,
+		WorkDir: workdir,
+		Params:  raw,
+	}, func(stream, data string) {
+		if stream == "match" {
+			onMatch(json.RawMessage(data))
+		}
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, handlers.SearchRPCError(ctx.Err())
+		}
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: err.Error()}
+	}
+	switch result.ExitCode {
+	case 0:
+		return json.RawMessage(result.Stdout), nil
+	case guestSearchNotFoundExit:
+		return nil, rpckit.ErrFileNotFound
+	}
+	return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: result.Stderr}
+}
+
+func (s *Server) findFiles(ctx context.Context, req handlers.FindParams) (*handlers.FindResult, *rpckit.RPCError) {
+	search, inGuest := s.guestSearcher(req.WorkspaceID)
+	if !inGuest {
+		return handlers.HandleFind(ctx, req, s.resolveWorkspaceTyped(req))
+	}
+	if rpcErr := handlers.ValidateFind(req); rpcErr != nil {
+		return nil, rpcErr
+	}
+	result := &handlers.FindResult{Matches: []filesearch.FindMatch{}, Path: req.Path}
+	stats, rpcErr := search(ctx, "fs.find", req, func(raw json.RawMessage) {
+		var m filesearch.FindMatch
+		if json.Unmarshal(raw, &m) == nil {
+			result.Matches = append(result.Matches, m)
+		}
+	})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	_ = json.Unmarshal(stats, &result.FindStats)
+	return result, nil
+}
+
+// grepFiles runs fs.grep on the host worktree or in the guest, passing
+// matches to emit when set.
+func (s *Server) grepFiles(ctx context.Context, req handlers.GrepParams, emit func(filesearch.GrepMatch)) (*handlers.GrepResult, *rpckit.RPCError) {
+	search, inGuest := s.guestSearcher(req.WorkspaceID)
+	if !inGuest {
+		return handlers.HandleGrep(ctx, req, s.resolveWorkspaceTyped(req), emit)
+	}
+	if rpcErr := handlers.ValidateGrep(req); rpcErr != nil {
+		return nil, rpcErr
+	}
+	result := &handlers.GrepResult{Matches: []filesearch.GrepMatch{}, Path: req.Path}
+	if emit == nil {
+		emit = func(m filesearch.GrepMatch) { result.Matches = append(result.Matches, m) }
+	}
+	stats, rpcErr := search(ctx, "fs.grep", req, func(raw json.RawMessage) {
+		var m filesearch.GrepMatch
+		if json.Unmarshal(raw, &m) == nil {
+			emit(m)
+		}
+	})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	_ = json.Unmarshal(stats, &result.GrepStats)
+	return result, nil
+}
+
+// streamGrep runs fs.grep in the background, sending matches to c in
+// batches as fs.grep.match notifications. A final fs.grep.end carries the
+// stats or the error. fs.grep.stop or closing the connection cancels it.
+func (s *Server) streamGrep(c *Connection, req handlers.GrepParams) string {
+	streamID := fmt.Sprintf("fs-grep-%d", time.Now().UnixNano())
+	ctx := c.startStream(streamID)
+	go func() {
+		defer c.endStream(streamID)
+		batch := make([]filesearch.GrepMatch, 0, grepBatchSize)
+		flush := func() {
+			if len(batch) > 0 {
+				c.notify(ctx, "fs.grep.match", map[string]any{"streamId": streamID, "matches": batch})
+				batch = make([]filesearch.GrepMatch, 0, grepBatchSize)
+			}
+		}
+		result, rpcErr := s.grepFiles(ctx, req, func(m filesearch.GrepMatch) {
+			batch = append(batch, m)
+			if len(batch) == grepBatchSize {
+				flush()
+			}
+		})
+		flush()
+		end := map[string]any{"streamId": streamID}
+		if rpcErr != nil {
+			end["error"] = rpcErr.Message
+		} else {
+			end["stats"] = result.GrepStats
+		}
+		c.notify(ctx, "fs.grep.end", end)
+	}()
+	return streamID
+}
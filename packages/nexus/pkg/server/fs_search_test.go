@@ -0,0 +1,36 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filesearch"
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+func TestStreamGrepBatchesMatchesAndEnds(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("needle\nhay\nneedle\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{ws: ws}
+	c := &Connection{send: make(chan []byte, 8)}
+
+	streamID := srv.streamGrep(c, handlers.GrepParams{GrepOptions: filesearch.GrepOptions{Pattern: "needle"}, Stream: true})
+	method, params := readNotification(t, c)
+	matches, _ := params["matches"].([]any)
+	if method != "fs.grep.match" || params["streamId"] != streamID || len(matches) != 2 {
+		t.Fatalf("unexpected match notification %s %#v", method, params)
+	}
+	method, params = readNotification(t, c)
+	stats, _ := params["stats"].(map[string]any)
+	if method != "fs.grep.end" || params["error"] != nil || stats["count"] != float64(2) {
+		t.Fatalf("unexpected end notification %s %#v", method, params)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filewatch"
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+)
+
+const (
+	// maxWatchesPerConn bounds the fs.watch streams one connection may
+	// hold, since each keeps inotify watches (or an agent connection) open.
+	maxWatchesPerConn = 16
+	watchStreamPrefix = "fs-watch-"
+)
+
+// watchRunner delivers batches of events until ctx is done or the watch
+// fails.
+type watchRunner func(ctx context.Context, onEvents func([]filewatch.Event)) error
+
+// startWatch starts watching a workspace path for c. Events arrive as
+// fs.watch.event notifications; a final fs.watch.end carries the error of a
+// watch that failed. fs.unwatch or closing the connection stops it.
+func (s *Server) startWatch(c *Connection, req handlers.WatchParams) (*handlers.WatchResult, *rpckit.RPCError) {
+	watchID := fmt.Sprintf("%s%d", watchStreamPrefix, time.Now().UnixNano())
+	ctx, ok := c.startStreamWithin(watchID, watchStreamPrefix, maxWatchesPerConn)
+	if !ok {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("too many watches (limit %d per connection)", maxWatchesPerConn)}
+	}
+	run, rpcErr := s.openWatch(ctx, req)
+	if rpcErr != nil {
+		c.stopStream(watchID)
+		return nil, rpcErr
+	}
+	go func() {
+		defer c.endStream(watchID)
+		err := run(ctx, func(events []filewatch.Event) {
+			c.notify(ctx, "fs.watch.event", map[string]any{"watchId": watchID, "events": events})
+		})
+		if err != nil && ctx.Err() == nil {
+			c.notify(ctx, "fs.watch.end", map[string]any{"watchId": watchID, "error": err.Error()})
+		}
+	}()
+	return &handlers.WatchResult{WatchID: watchID, Path: req.Path}, nil
+}
+
+// openWatch sets up the watch, on the host worktree or in the guest when
+// the workspace files only exist there, and returns a way to run it.
+func (s *Server) openWatch(ctx context.Context, req handlers.WatchParams) (watchRunner, *rpckit.RPCError) {
+	if dial, workdir, inGuest := s.guestFiles(req.WorkspaceID); inGuest {
+		return openGuestWatch(ctx, dial, workdir, req)
+	}
+	w, rpcErr := handlers.StartWatch(req, s.resolveWorkspaceTyped(req))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return w.Run, nil
+}
+
+// openGuestWatch asks the guest agent to watch the path, on a connection of
+// its own that stays open for the life of the watch.
+func openGuestWatch(ctx context.Context, dial func(context.Context, string) (net.Conn, error), workdir string, req handlers.WatchParams) (watchRunner, *rpckit.RPCError) {
+	params, err := json.Marshal(req)
+	if err != nil {
+		return nil, rpckit.ErrInvalidParams
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := dial(dialCtx, req.WorkspaceID)
+	cancel()
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("agent connect: %v", err)}
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	closeConn := func() {
+		stop()
+		_ = conn.Close()
+	}
+
+	id := fmt.Sprintf("fs.watch-%d", time.Now().UnixNano())
+	if err := json.NewEncoder(conn).Encode(map[string]any{"id": id, "type": "fs.watch", "workdir": workdir, "params": json.RawMessage(params)}); err != nil {
+		closeConn()
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("send watch request: %v", err)}
+	}
+	dec := json.NewDecoder(conn)
+	var ready guestWatchMessage
+	if err := dec.Decode(&ready); err != nil {
+		closeConn()
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("fs.watch stream: %v", err)}
+	}
+	if ready.Type != "fs.watching" {
+		closeConn()
+		return nil, ready.rpcError()
+	}
+
+	return func(ctx context.Context, onEvents func([]filewatch.Event)) error {
+		defer closeConn()
+		for {
+			var msg guestWatchMessage
+			if err := dec.Decode(&msg); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("fs.watch stream: %w", err)
+			}
+			switch msg.Type {
+			case "fs.changed":
+				onEvents(msg.Events)
+			case "result":
+				return fmt.Errorf("%s", msg.rpcError().Message)
+			}
+		}
+	}, nil
+}
+
+// guestWatchMessage is one line of the agent's fs.watch stream.
+type guestWatchMessage struct {
+	Type     string            `json:"type"`
+	Events   []filewatch.Event `json:"events,omitempty"`
+	ExitCode int               `json:"exit_code"`
+	Stderr   string            `json:"stderr,omitempty"`
+}
+
+func (m guestWatchMessage) rpcError() *rpckit.RPCError {
+	if m.ExitCode == guestSearchNotFoundExit {
+		return rpckit.ErrFileNotFound
+	}
+	msg := strings.TrimSpace(m.Stderr)
+	if msg == "" {
+		msg = "fs.watch failed in guest"
+	}
+	return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: msg}
+}
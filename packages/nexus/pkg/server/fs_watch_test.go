@@ -0,0 +1,56 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/filewatch"
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspace"
+)
+
+func TestStartWatchNotifiesAndEnforcesLimit(t *testing.T) {
+	root := t.TempDir()
+	ws, err := workspace.NewWorkspace(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{ws: ws}
+	c := &Connection{send: make(chan []byte, 8)}
+	defer c.stopAllStreams()
+
+	first, rpcErr := srv.startWatch(c, handlers.WatchParams{Options: filewatch.Options{DebounceMs: 10}})
+	if rpcErr != nil {
+		t.Fatalf("startWatch: %v", rpcErr)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	method, params := readNotification(t, c)
+	events, _ := params["events"].([]any)
+	if method != "fs.watch.event" || params["watchId"] != first.WatchID || len(events) == 0 {
+		t.Fatalf("unexpected notification %s %#v", method, params)
+	}
+	if e, _ := events[0].(map[string]any); e["type"] != filewatch.EventCreate || e["path"] != "a.txt" {
+		t.Fatalf("unexpected event %#v", events[0])
+	}
+
+	if _, rpcErr := srv.startWatch(c, handlers.WatchParams{Path: "missing"}); rpcErr == nil {
+		t.Fatal("expected an error watching a missing path")
+	}
+	for i := 1; i < maxWatchesPerConn; i++ {
+		if _, rpcErr := srv.startWatch(c, handlers.WatchParams{}); rpcErr != nil {
+			t.Fatalf("watch %d: %v", i, rpcErr)
+		}
+	}
+	if _, rpcErr := srv.startWatch(c, handlers.WatchParams{}); rpcErr == nil {
+		t.Fatal("expected the watch limit to be enforced")
+	}
+	if !c.stopStream(first.WatchID) {
+		t.Fatal("expected fs.unwatch to find the first watch")
+	}
+	if _, rpcErr := srv.startWatch(c, handlers.WatchParams{}); rpcErr != nil {
+		t.Fatalf("watch after unwatch: %v", rpcErr)
+	}
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+// withWorkspaceProxy routes requests for <port>.<workspace>.<baseDomain> to
+// the workspace's forwarded port and <workspace>.<baseDomain> to its landing
+// page. All other hosts fall through to next.
+func (s *Server) withWorkspaceProxy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		label, port, ok := s.parseWorkspaceProxyHost(r.Host)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !isLoopbackRemote(r.RemoteAddr) {
+			http.Error(w, "workspace proxy is only served to local clients", http.StatusForbidden)
+			return
+		}
+		ws, err := s.workspaceForHostLabel(label)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if port == 0 {
+			s.renderWorkspaceLanding(w, r, ws)
+			return
+		}
+		s.proxyWorkspacePort(w, r, ws, port)
+	})
+}
+
+// parseWorkspaceProxyHost splits a request host into workspace label and
+// optional port. Hosts outside the base domain return ok=false.
+func (s *Server) parseWorkspaceProxyHost(hostport string) (label string, port int, ok bool) {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	suffix := "." + s.nodeCfg.ProxyBaseDomain()
+	if !strings.HasSuffix(host, suffix) {
+		return "", 0, false
+	}
+	parts := strings.Split(strings.TrimSuffix(host, suffix), ".")
+	switch len(parts) {
+	case 1:
+		if parts[0] == "" {
+			return "", 0, false
+		}
+		return parts[0], 0, true
+	case 2:
+		p, err := strconv.Atoi(parts[0])
+		if err != nil || p <= 0 || p > 65535 || parts[1] == "" {
+			return "", 0, false
+		}
+		return parts[1], p, true
+	}
+	return "", 0, false
+}
+
+// workspaceHostLabel returns the DNS label used for ws in proxy hostnames:
+// the sanitized workspace name, or the workspace id when the name is empty
+// or shared with another workspace.
+func (s *Server) workspaceHostLabel(ws *workspacemgr.Workspace) string {
+	label := hostLabel(ws.WorkspaceName)
+	if label == "" {
+		return strings.ToLower(ws.ID)
+	}
+	for _, other := range s.workspaceMgr.List() {
+		if other.ID != ws.ID && hostLabel(other.WorkspaceName) == label {
+			return strings.ToLower(ws.ID)
+		}
+	}
+	return label
+}
+
+func (s *Server) workspaceForHostLabel(label string) (*workspacemgr.Workspace, error) {
+	var matches []*workspacemgr.Workspace
+	for _, ws := range s.workspaceMgr.List() {
+		if strings.ToLower(ws.ID) == label {
+			return ws, nil
+		}
+		if hostLabel(ws.WorkspaceName) == label {
+			matches = append(matches, ws)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no workspace named %q", label)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("workspace name %q is ambiguous; use the workspace id", label)
+}
+
+// WorkspaceProxyURL returns the front-door URL for a workspace port, or the
+// workspace landing page when port is 0.
+func (s *Server) WorkspaceProxyURL(ws *workspacemgr.Workspace, port int) string {
+	host := s.workspaceHostLabel(ws) + "." + s.nodeCfg.ProxyBaseDomain()
+	if port > 0 {
+		host = strconv.Itoa(port) + "." + host
+	}
+	if s.port > 0 && s.port != 80 {
+		host = net.JoinHostPort(host, strconv.Itoa(s.port))
+	}
+	return "http://" + host + "/"
+}
+
+func (s *Server) proxyWorkspacePort(w http.ResponseWriter, r *http.Request, ws *workspacemgr.Workspace, port int) {
+	items, _ := s.WorkspacePortStates(ws.ID)
+	var state *WorkspacePortState
+	for i := range items {
+		if items[i].Port == port {
+			state = &items[i]
+			break
+		}
+	}
+	if state == nil {
+		http.Error(w, fmt.Sprintf("port %d is not exposed by workspace %s", port, ws.ID), http.StatusNotFound)
+		return
+	}
+	if !state.Tunneled || state.LocalPort <= 0 {
+		http.Error(w, fmt.Sprintf("port %d is not tunneled; run `nexus workspace tunnel %s`", port, ws.ID), http.StatusBadGateway)
+		return
+	}
+
+	target := &url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(state.LocalPort))}
+	rewriteHost := s.nodeCfg != nil && s.nodeCfg.Proxy.RewriteHost
+	originalHost := r.Host
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			if _, ok := req.Header["User-Agent"]; !ok {
+				req.Header.Set("User-Agent", "")
+			}
+			req.Header.Set("X-Forwarded-Host", originalHost)
+			if !rewriteHost {
+				return
+			}
+			rewritten := "localhost:" + strconv.Itoa(port)
+			req.Host = rewritten
+			if origin := req.Header.Get("Origin"); origin != "" {
+				if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, originalHost) {
+					u.Host = rewritten
+					req.Header.Set("Origin", u.String())
+				}
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("[proxy] %s -> %s: %v", originalHost, target.Host, err)
+			http.Error(w, fmt.Sprintf("workspace port %d unavailable: %v", port, err), http.StatusBadGateway)
+		},
+	}
+	// ReverseProxy handles Connection: Upgrade, so websockets pass through.
+	proxy.ServeHTTP(w, r)
+}
+
+type workspaceLandingPort struct {
+	Port      int
+	LocalPort int
+	Process   string
+	Tunneled  bool
+	URL       string
+}
+
+var workspaceLandingTemplate = template.Must(template.New("landing").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>{{.Name}} · ports</title>
+<style>body{font-family:system-ui,sans-serif;margin:2rem;color:#222}table{border-collapse:collapse}td,th{padding:.35rem .9rem;border-bottom:1px solid #ddd;text-align:left}.off{color:#999}</style>
+</head><body>
+<h1>{{.Name}}</h1>
+<p>Workspace <code>{{.ID}}</code> · {{.State}}</p>
+{{if .Ports}}<table><tr><th>Port</th><th>Process</th><th>Local</th><th>Open</th></tr>
+{{range .Ports}}<tr{{if not .Tunneled}} class="off"{{end}}><td>{{.Port}}</td><td>{{.Process}}</td><td>{{if .Tunneled}}localhost:{{.LocalPort}}{{else}}not tunneled{{end}}</td><td>{{if .Tunneled}}<a href="{{.URL}}">{{.URL}}</a>{{end}}</td></tr>
+{{end}}</table>{{else}}<p>No ports detected.</p>{{end}}
+</body></html>
+`))
+
+func (s *Server) renderWorkspaceLanding(w http.ResponseWriter, r *http.Request, ws *workspacemgr.Workspace) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	items, _ := s.WorkspacePortStates(ws.ID)
+	ports := make([]workspaceLandingPort, 0, len(items))
+	for _, item := range items {
+		ports = append(ports, workspaceLandingPort{
+			Port:      item.Port,
+			LocalPort: item.LocalPort,
+			Process:   item.Process,
+			Tunneled:  item.Tunneled,
+			URL:       s.WorkspaceProxyURL(ws, item.Port),
+		})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	name := ws.WorkspaceName
+	if name == "" {
+		name = ws.ID
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := workspaceLandingTemplate.Execute(w, map[string]any{
+		"Name":  name,
+		"ID":    ws.ID,
+		"State": ws.State,
+		"Ports": ports,
+	}); err != nil {
+		log.Printf("[proxy] render landing for %s: %v", ws.ID, err)
+	}
+}
+
+// handleWorkspacePortsPage serves the landing page at
+// /portal/workspaces/<id>/ports. Unlike the portal UI, which only serves
+// static assets, the page lists workspace data and so needs the daemon
+// token. A browser opening it cannot set headers, so the token may also
+// come as a "token" query parameter, as the portal UI passes it.
+func (s *Server) handleWorkspacePortsPage(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/portal/workspaces/")
+	id, tail, _ := strings.Cut(rest, "/")
+	if id == "" || tail != "ports" {
+		s.handlePortalUI(w, r)
+		return
+	}
+	token := bearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if _, ok := s.authenticate(w, r, token); !ok {
+		return
+	}
+	ws, ok := s.workspaceMgr.Get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.renderWorkspaceLanding(w, r, ws)
+}
+
+func isLoopbackRemote(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// hostLabel lowercases name and replaces characters not allowed in a DNS
+// label with '-'.
+func hostLabel(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	label := strings.Trim(b.String(), "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return label
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+func TestWorkspaceProxyRoutesPortHostsToTunnels(t *testing.T) {
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.SetNodeConfig(&config.NodeConfig{Version: 1, Proxy: config.NodeProxy{RewriteHost: true}})
+
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			mt, msg, err := conn.ReadMessage()
+			if err == nil {
+				_ = conn.WriteMessage(mt, append([]byte("echo:"), msg...))
+			}
+			return
+		}
+		fmt.Fprintf(w, "host=%s origin=%s", r.Host, r.Header.Get("Origin"))
+	}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          "https://example.com/repo.git",
+		Ref:           "web",
+		WorkspaceName: "Web App",
+		AgentProfile:  "codex",
+		Backend:       "firecracker",
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if err := srv.workspaceMgr.SetTunnelPorts(ws.ID, []int{port}); err != nil {
+		t.Fatalf("set tunnel ports: %v", err)
+	}
+	if err := srv.StartWorkspaceTunnels(ws.ID, false); err != nil {
+		t.Fatalf("start tunnels: %v", err)
+	}
+	defer srv.StopWorkspaceTunnels(ws.ID)
+
+	front := httptest.NewServer(srv.withWorkspaceProxy(srv.routes()))
+	defer front.Close()
+	host := fmt.Sprintf("%d.web-app.localhost", port)
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/", nil)
+	req.Host = host
+	req.Header.Set("Origin", "http://"+host)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("proxy request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	want := fmt.Sprintf("host=localhost:%d origin=http://localhost:%d", port, port)
+	if resp.StatusCode != http.StatusOK || string(body) != want {
+		t.Fatalf("expected %q, got %d %q", want, resp.StatusCode, body)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(front.URL, "http") + "/socket"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Host": {host}})
+	if err != nil {
+		t.Fatalf("websocket dial through proxy: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatalf("websocket write: %v", err)
+	}
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "echo:hi" {
+		t.Fatalf("expected websocket echo, got %q err=%v", msg, err)
+	}
+
+	landing, _ := http.NewRequest(http.MethodGet, front.URL+"/", nil)
+	landing.Host = "web-app.localhost"
+	resp, err = http.DefaultClient.Do(landing)
+	if err != nil {
+		t.Fatalf("landing request: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), fmt.Sprintf("http://%s/", host)) {
+		t.Fatalf("expected landing page to link port %d, got %s", port, body)
+	}
+
+	missing, _ := http.NewRequest(http.MethodGet, front.URL+"/", nil)
+	missing.Host = "1.web-app.localhost"
+	resp, err = http.DefaultClient.Do(missing)
+	if err != nil {
+		t.Fatalf("missing port request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unexposed port, got %d", resp.StatusCode)
+	}
+
+	items, _ := srv.WorkspacePortStates(ws.ID)
+	if len(items) != 1 || !strings.HasPrefix(items[0].URL, "http://"+host) {
+		t.Fatalf("expected ports.list url for %s, got %#v", host, items)
+	}
+}
+
+func TestShareWorkspacePortTunnelsAndProxiesWithToken(t *testing.T) {
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "shared %s", r.URL.Path)
+	}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          "https://example.com/repo.git",
+		Ref:           "web",
+		WorkspaceName: "share",
+		AgentProfile:  "codex",
+		Backend:       "firecracker",
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	defer srv.StopWorkspaceTunnels(ws.ID)
+
+	share, err := srv.ShareWorkspacePort(ws.ID, port, ShareWorkspacePortOptions{BindAddress: "127.0.0.1", ReadOnly: true})
+	if err != nil {
+		t.Fatalf("share port: %v", err)
+	}
+	defer srv.shareMgr.Revoke(share.ID)
+	if !srv.portTunneled(ws.ID, port) {
+		t.Fatalf("expected sharing to tunnel port %d", port)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(share.URL)
+	if err != nil {
+		t.Fatalf("share request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "shared /" {
+		t.Fatalf("expected proxied response, got %d %q", resp.StatusCode, body)
+	}
+
+	if shares := srv.shareMgr.List(ws.ID); len(shares) != 1 || shares[0].ID != share.ID {
+		t.Fatalf("expected share to be listed, got %#v", shares)
+	}
+	srv.shareMgr.RevokeWorkspace(ws.ID)
+	if shares := srv.shareMgr.List(ws.ID); len(shares) != 0 {
+		t.Fatalf("expected shares to be revoked, got %#v", shares)
+	}
+}
+
+func TestWorkspacePortsPageRequiresToken(t *testing.T) {
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          "https://example.com/repo.git",
+		Ref:           "web",
+		WorkspaceName: "ports",
+		AgentProfile:  "codex",
+		Backend:       "firecracker",
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	front := httptest.NewServer(srv.routes())
+	defer front.Close()
+	page := front.URL + "/portal/workspaces/" + ws.ID + "/ports"
+
+	for name, tc := range map[string]struct {
+		url    string
+		header string
+		want   int
+	}{
+		"missing": {url: page, want: http.StatusUnauthorized},
+		"invalid": {url: page + "?token=wrong", want: http.StatusUnauthorized},
+		"query":   {url: page + "?token=secret-token", want: http.StatusOK},
+		"header":  {url: page, header: "Bearer secret-token", want: http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tc.want {
+				t.Fatalf("expected %d, got %d %s", tc.want, resp.StatusCode, body)
+			}
+			if tc.want == http.StatusOK && !strings.Contains(string(body), ws.ID) {
+				t.Fatalf("expected the landing page, got %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/dotfiles"
+)
+
+// personalLayerTimeout bounds one background apply, dotfiles clone and
+// install command included.
+const personalLayerTimeout = 10 * time.Minute
+
+// personalLayer tracks the node's personal layer and where it was applied.
+type personalLayer struct {
+	layer *dotfiles.Layer
+
+	mu       sync.Mutex
+	statuses map[string]dotfiles.Status
+}
+
+func (p *personalLayer) status(workspaceID string) (dotfiles.Status, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st, ok := p.statuses[workspaceID]
+	return st, ok
+}
+
+func (p *personalLayer) setStatus(workspaceID string, st dotfiles.Status) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.statuses == nil {
+		p.statuses = make(map[string]dotfiles.Status)
+	}
+	p.statuses[workspaceID] = st
+}
+
+// begin marks the layer as applying to workspaceID and reports whether the
+// caller should apply it: not when it is already applied or applying.
+func (p *personalLayer) begin(workspaceID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if st, ok := p.statuses[workspaceID]; ok && (st.State == dotfiles.StateApplied || st.State == dotfiles.StateApplying) {
+		return false
+	}
+	if p.statuses == nil {
+		p.statuses = make(map[string]dotfiles.Status)
+	}
+	p.statuses[workspaceID] = dotfiles.Status{State: dotfiles.StateApplying, AppliedAt: time.Now().UTC()}
+	return true
+}
+
+func (p *personalLayer) forget(workspaceID string) {
+	p.mu.Lock()
+	delete(p.statuses, workspaceID)
+	p.mu.Unlock()
+}
+
+// startPersonalLayer applies the personal layer to a running VM workspace in
+// the background, so a slow dotfiles fetch or install command never holds up
+// workspace.create or workspace.start. workspace.info reports it as applying
+// until the outcome is recorded.
+func (s *Server) startPersonalLayer(workspaceID string) {
+	if s.personal == nil {
+		return
+	}
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return
+	}
+	if _, _, ok := s.workspaceAgent(ws); !ok {
+		return
+	}
+	if !s.personal.begin(workspaceID) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), personalLayerTimeout)
+		defer cancel()
+		s.applyPersonalLayer(ctx, workspaceID)
+	}()
+}
+
+// applyPersonalLayer pushes the node's personal layer into a running VM
+// workspace unless it already holds it. Failures are recorded for
+// workspace.info and the event log; they never fail the caller.
+func (s *Server) applyPersonalLayer(ctx context.Context, workspaceID string) {
+	if s.personal == nil {
+		return
+	}
+	if st, ok := s.personal.status(workspaceID); ok && st.State == dotfiles.StateApplied {
+		return
+	}
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return
+	}
+	driver, dial, ok := s.workspaceAgent(ws)
+	if !ok {
+		// Host and process workspaces already run with the user's home.
+		return
+	}
+	workdir := guestWorkdir(driver, ws.ID)
+	st := s.personal.layer.Apply(ctx, func(ctx context.Context, argv []string) (int, string, error) {
+		res, err := runAgentCommand(ctx, dial, workdir, ws.ID, argv, nil, nil)
+		return res.ExitCode, res.Stdout + res.Stderr, err
+	})
+	s.personal.setStatus(ws.ID, st)
+
+	msg := "personal layer applied"
+	if st.Revision != "" {
+		msg += " at " + shortRevision(st.Revision)
+	}
+	if st.State == dotfiles.StateFailed {
+		msg = fmt.Sprintf("personal layer failed: %s", st.Error)
+	}
+	s.events.append(ws.ID, WorkspaceEvent{Kind: "personal", Message: msg})
+}
+
+func shortRevision(rev string) string {
+	rev = strings.TrimSpace(rev)
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+	"github.com/inizio/nexus/packages/nexus/pkg/dotfiles"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/firecracker"
+)
+
+// hostExecAgentDriver answers agent exec requests by running them on the
+// host with HOME pointed at a scratch guest home.
+type hostExecAgentDriver struct {
+	serverTestDriver
+	home string
+	// gate, when set, holds every command until it is closed.
+	gate chan struct{}
+}
+
+func (d *hostExecAgentDriver) AgentConn(ctx context.Context, workspaceID string) (net.Conn, error) {
+	if d.gate != nil {
+		<-d.gate
+	}
+	left, right := net.Pipe()
+	go func() {
+		defer right.Close()
+		var req firecracker.ExecRequest
+		if err := json.NewDecoder(right).Decode(&req); err != nil {
+			return
+		}
+		cmd := exec.Command(req.Command, req.Args...)
+		cmd.Env = append(os.Environ(), "HOME="+d.home)
+		res, _ := runCommand(cmd, nil)
+		_ = json.NewEncoder(right).Encode(map[string]any{
+			"type": "result", "id": req.ID, "exit_code": res.ExitCode, "stdout": res.Stdout, "stderr": res.Stderr,
+		})
+	}()
+	return left, nil
+}
+
+func newPersonalLayerTestServer(t *testing.T, cfg config.NodePersonal) (*Server, *hostExecAgentDriver, string) {
+	t.Helper()
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	driver := &hostExecAgentDriver{serverTestDriver: serverTestDriver{backend: "firecracker"}, home: t.TempDir()}
+	srv.SetRuntimeFactory(runtime.NewFactory(
+		[]runtime.Capability{{Name: "runtime.firecracker", Available: true}},
+		map[string]runtime.Driver{"firecracker": driver},
+	))
+	srv.personal = &personalLayer{layer: dotfiles.New(cfg, t.TempDir())}
+
+	ws := createWorkspaceForPTYTest(t, srv.workspaceMgr, "firecracker")
+	return srv, driver, ws.ID
+}
+
+func TestApplyPersonalLayerInstallsDotfilesInGuest(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "gitconfig"), []byte("[user]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv, driver, wsID := newPersonalLayerTestServer(t, config.NodePersonal{
+		Dotfiles: src,
+		Install:  "cp gitconfig ../.gitconfig",
+	})
+
+	srv.applyPersonalLayer(context.Background(), wsID)
+
+	st, ok := srv.personal.status(wsID)
+	if !ok || st.State != dotfiles.StateApplied {
+		t.Fatalf("expected applied status, got %#v (ok=%v)", st, ok)
+	}
+	if _, err := os.Stat(filepath.Join(driver.home, ".dotfiles", "gitconfig")); err != nil {
+		t.Fatalf("expected dotfiles in guest home: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(driver.home, ".gitconfig")); err != nil {
+		t.Fatalf("expected install command to run: %v", err)
+	}
+	events := srv.events.list(wsID, 0)
+	if len(events) != 1 || events[0].Kind != "personal" {
+		t.Fatalf("expected one personal event, got %#v", events)
+	}
+}
+
+func TestApplyPersonalLayerRecordsInstallFailure(t *testing.T) {
+	srv, _, wsID := newPersonalLayerTestServer(t, config.NodePersonal{
+		Dotfiles: t.TempDir(),
+		Install:  "echo broken >&2; exit 4",
+	})
+
+	srv.applyPersonalLayer(context.Background(), wsID)
+
+	st, _ := srv.personal.status(wsID)
+	if st.State != dotfiles.StateFailed || st.Output != "broken\n" {
+		t.Fatalf("expected failed status with install output, got %#v", st)
+	}
+	events := srv.events.list(wsID, 0)
+	if len(events) != 1 || events[0].Message != "personal layer failed: install exited with code 4" {
+		t.Fatalf("unexpected events %#v", events)
+	}
+}
+
+func TestStartPersonalLayerAppliesInBackground(t *testing.T) {
+	srv, driver, wsID := newPersonalLayerTestServer(t, config.NodePersonal{Dotfiles: t.TempDir()})
+	driver.gate = make(chan struct{})
+
+	srv.startPersonalLayer(wsID)
+	if st, _ := srv.personal.status(wsID); st.State != dotfiles.StateApplying {
+		t.Fatalf("expected applying status while the guest is busy, got %#v", st)
+	}
+	// A second start while applying does not apply it again.
+	srv.startPersonalLayer(wsID)
+
+	close(driver.gate)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, _ := srv.personal.status(wsID)
+		if st.State == dotfiles.StateApplied {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the layer to be applied, got %#v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if events := srv.events.list(wsID, 0); len(events) != 1 {
+		t.Fatalf("expected one personal event, got %#v", events)
+	}
+}
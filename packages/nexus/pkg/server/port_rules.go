@@ -0,0 +1,77 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+)
+
+// workspacePortRules returns the port rules from the workspace's
+// .nexus/workspace.json. A missing or invalid config yields no rules.
+func (s *Server) workspacePortRules(workspaceID string) config.WorkspacePorts {
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return config.WorkspacePorts{}
+	}
+	root := preferredWorkspaceRoot(ws)
+	if root == "" {
+		return config.WorkspacePorts{}
+	}
+	cfg, _, err := config.LoadWorkspaceConfig(root)
+	if err != nil {
+		return config.WorkspacePorts{}
+	}
+	return cfg.Ports
+}
+
+// tunnelLocalPort picks the host port to try first for a workspace port: a
+// remembered remap, then the rule's localPort, then the port itself.
+func (s *Server) tunnelLocalPort(workspaceID string, port int, policy config.PortPolicy) int {
+	if ws, ok := s.workspaceMgr.Get(workspaceID); ok {
+		if mapped := ws.TunnelLocalPorts[port]; mapped > 0 {
+			return mapped
+		}
+	}
+	if policy.LocalPort > 0 {
+		return policy.LocalPort
+	}
+	return port
+}
+
+// detectedProcess returns the process the port monitor last saw listening
+// on port, for matching process rules.
+func (s *Server) detectedProcess(workspaceID string, port int) string {
+	if s.portMonitor == nil {
+		return ""
+	}
+	for _, p := range s.portMonitor.ListDiscovered(workspaceID) {
+		if p.Port == port {
+			return p.Process
+		}
+	}
+	return ""
+}
+
+// defaultTunnelPorts returns current extended with detected ports that
+// should be tunneled by default. With no preferred ports yet, every detected
+// port that rules do not opt out is added; afterwards only ports whose rule
+// sets autoExpose are.
+func defaultTunnelPorts(current []int, detected map[int]*WorkspacePortState, rules config.WorkspacePorts) []int {
+	firstTime := len(current) == 0
+	have := make(map[int]bool, len(current))
+	for _, p := range current {
+		have[p] = true
+	}
+	out := append([]int(nil), current...)
+	added := make([]int, 0)
+	for p, st := range detected {
+		if p <= 0 || p > 65535 || have[p] {
+			continue
+		}
+		if rules.Resolve(p, st.Process).ShouldAutoExpose(firstTime) {
+			added = append(added, p)
+		}
+	}
+	sort.Ints(added)
+	return append(out, added...)
+}
@@ -0,0 +1,381 @@
+package pty
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+)
+
+const (
+	defaultExpectTimeout = 10 * time.Second
+	maxExpectTimeout     = 5 * time.Minute
+	// maxExpectBuffer bounds the output a pty.expect keeps while it waits;
+	// older output is dropped.
+	maxExpectBuffer = 1 << 20
+)
+
+// tapOutput feeds the output of session to onData through a registry tap,
+// so it sees the same pty.data stream attached clients do. onData is first
+// called, possibly with no data, with the kept output after since, or with
+// none when since is nil, and then with every new chunk along with the seq
+// after it. onExit, when set, is called on pty.exit.
+func tapOutput(registry *Registry, session *Session, since *uint64, onData func(data []byte, seq uint64), onExit func()) (func(), bool) {
+	if registry == nil {
+		return nil, false
+	}
+	fn := func(encoded []byte) {
+		var ev struct {
+			Method string `json:"method"`
+			Params struct {
+				Data string `json:"data"`
+				Seq  uint64 `json:"seq"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(encoded, &ev); err != nil {
+			return
+		}
+		switch ev.Method {
+		case "pty.data":
+			onData([]byte(ev.Params.Data), ev.Params.Seq)
+		case "pty.exit":
+			if onExit != nil {
+				onExit()
+			}
+		}
+	}
+	sb := session.Scrollback
+	if sb == nil {
+		onData(nil, 0)
+		return registry.Tap(session.ID, fn)
+	}
+	// Hold the scrollback lock so no chunk is missed or seen twice between
+	// the replay and the tap.
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	var replay []byte
+	if since != nil {
+		replay, _ = sb.sinceLocked(*since)
+	}
+	onData(replay, sb.seq)
+	return registry.Tap(session.ID, fn)
+}
+
+// HandleExpect waits until session output matches a pattern, the session
+// exits or the timeout passes.
+func HandleExpect(ctx context.Context, deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
+	var p ExpectParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid pty.expect params: %v", err)}
+	}
+	if (p.Pattern == "") == (p.Literal == "") {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "invalid pty.expect params: exactly one of pattern or literal is required"}
+	}
+	expr := p.Pattern
+	if p.Literal != "" {
+		expr = regexp.QuoteMeta(p.Literal)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid pty.expect pattern: %v", err)}
+	}
+	timeout := defaultExpectTimeout
+	if p.TimeoutMs > 0 {
+		timeout = min(time.Duration(p.TimeoutMs)*time.Millisecond, maxExpectTimeout)
+	}
+
+	session := lookupSession(deps, conn, p.SessionID)
+	if session == nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("pty session not found: %s", p.SessionID)}
+	}
+
+	var (
+		mu     sync.Mutex
+		buf    []byte
+		end    uint64
+		exited bool
+	)
+	wake := make(chan struct{}, 1)
+	signal := func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	untap, ok := tapOutput(deps.Registry, session, p.Since, func(data []byte, seq uint64) {
+		mu.Lock()
+		buf = append(buf, data...)
+		if over := len(buf) - maxExpectBuffer; over > 0 {
+			buf = append(buf[:0:0], buf[over:]...)
+		}
+		end = seq
+		mu.Unlock()
+		signal()
+	}, func() {
+		mu.Lock()
+		exited = true
+		mu.Unlock()
+		signal()
+	})
+	if !ok {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("pty session not found: %s", p.SessionID)}
+	}
+	defer untap()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		mu.Lock()
+		res := matchOutput(re, buf, end, p.Raw)
+		res.Exited = exited
+		mu.Unlock()
+		if res.Matched || res.Exited {
+			return res, nil
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			res.TimedOut = true
+			return res, nil
+		case <-ctx.Done():
+			return nil, rpckit.ErrTimeout
+		}
+	}
+}
+
+// matchOutput matches re against raw, the output ending at seq end.
+func matchOutput(re *regexp.Regexp, raw []byte, end uint64, rawMode bool) *ExpectResult {
+	text, ends := raw, []int(nil)
+	if !rawMode {
+		text, ends = stripTerminal(raw)
+	}
+	res := &ExpectResult{Seq: end}
+	loc := re.FindSubmatchIndex(text)
+	if loc == nil {
+		res.Before = string(text)
+		return res
+	}
+	res.Matched = true
+	res.Match = string(text[loc[0]:loc[1]])
+	for i := 2; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			res.Groups = append(res.Groups, "")
+			continue
+		}
+		res.Groups = append(res.Groups, string(text[loc[i]:loc[i+1]]))
+	}
+	res.Before = string(text[:loc[0]])
+	res.After = string(text[loc[1]:])
+	rawEnd := loc[1]
+	if ends != nil {
+		rawEnd = ends[loc[1]]
+	}
+	if end >= uint64(len(raw)) {
+		res.Seq = end - uint64(len(raw)) + uint64(rawEnd)
+	}
+	return res
+}
+
+// stripTerminal removes escape sequences and control characters other than
+// newline and tab from raw. ends[i] is the offset in raw just past the byte
+// that became text[i-1].
+func stripTerminal(raw []byte) ([]byte, []int) {
+	text := make([]byte, 0, len(raw))
+	ends := make([]int, 1, len(raw)+1)
+	for i := 0; i < len(raw); i++ {
+		b := raw[i]
+		if b == 0x1b {
+			i = skipEscape(raw, i)
+			continue
+		}
+		if b == '\n' || b == '\t' || (b >= 0x20 && b != 0x7f) {
+			text = append(text, b)
+			ends = append(ends, i+1)
+		}
+	}
+	return text, ends
+}
+
+// skipEscape returns the index of the last byte of the escape sequence
+// starting at raw[i], or of the last byte of raw when it is incomplete.
+func skipEscape(raw []byte, i int) int {
+	if i+1 >= len(raw) {
+		return len(raw) - 1
+	}
+	switch raw[i+1] {
+	case '[':
+		for j := i + 2; j < len(raw); j++ {
+			if raw[j] >= 0x40 && raw[j] <= 0x7e {
+				return j
+			}
+		}
+	case ']', 'P', '_', '^', 'X':
+		for j := i + 2; j < len(raw); j++ {
+			if raw[j] == 0x07 {
+				return j
+			}
+			if raw[j] == 0x1b && j+1 < len(raw) && raw[j+1] == '\\' {
+				return j + 1
+			}
+		}
+	case '(', ')', '*', '+', '#', '%':
+		return min(i+2, len(raw)-1)
+	default:
+		return i + 1
+	}
+	return len(raw) - 1
+}
+
+var namedKeys = map[string]string{
+	"enter":     "\r",
+	"return":    "\r",
+	"tab":       "\t",
+	"shift-tab": "\x1b[Z",
+	"escape":    "\x1b",
+	"esc":       "\x1b",
+	"backspace": "\x7f",
+	"space":     " ",
+	"up":        "\x1b[A",
+	"down":      "\x1b[B",
+	"right":     "\x1b[C",
+	"left":      "\x1b[D",
+	"home":      "\x1b[H",
+	"end":       "\x1b[F",
+	"insert":    "\x1b[2~",
+	"delete":    "\x1b[3~",
+	"pageup":    "\x1b[5~",
+	"pagedown":  "\x1b[6~",
+	"f1":        "\x1bOP",
+	"f2":        "\x1bOQ",
+	"f3":        "\x1bOR",
+	"f4":        "\x1bOS",
+	"f5":        "\x1b[15~",
+	"f6":        "\x1b[17~",
+	"f7":        "\x1b[18~",
+	"f8":        "\x1b[19~",
+	"f9":        "\x1b[20~",
+	"f10":       "\x1b[21~",
+	"f11":       "\x1b[23~",
+	"f12":       "\x1b[24~",
+}
+
+// keySequence returns what a terminal sends for a key: a single character,
+// a name such as "enter" or "pageup", or a name or character prefixed with
+// "ctrl-" or "alt-". Names are case-insensitive and "+" may join modifiers.
+func keySequence(name string) (string, bool) {
+	if utf8.RuneCountInString(name) == 1 {
+		return name, true
+	}
+	key := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "+", "-")
+	if seq, ok := namedKeys[key]; ok {
+		return seq, true
+	}
+	for _, prefix := range []string{"alt-", "meta-"} {
+		if rest, ok := strings.CutPrefix(key, prefix); ok {
+			seq, ok := keySequence(rest)
+			return "\x1b" + seq, ok
+		}
+	}
+	if rest, ok := strings.CutPrefix(key, "ctrl-"); ok {
+		switch {
+		case rest == "space" || rest == "@":
+			return "\x00", true
+		case rest == "?":
+			return "\x7f", true
+		case len(rest) == 1 && rest[0] >= 'a' && rest[0] <= 'z':
+			return string(rune(rest[0] - 'a' + 1)), true
+		case len(rest) == 1 && rest[0] >= '[' && rest[0] <= '_':
+			return string(rune(rest[0] - '@')), true
+		}
+	}
+	return "", false
+}
+
+// HandleSend types text and named keys into a session.
+func HandleSend(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
+	var p SendParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid pty.send params: %v", err)}
+	}
+	if p.Text == "" && len(p.Keys) == 0 {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "invalid pty.send params: text or keys is required"}
+	}
+	var input strings.Builder
+	input.WriteString(p.Text)
+	for _, key := range p.Keys {
+		seq, ok := keySequence(key)
+		if !ok {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid pty.send params: unknown key %q", key)}
+		}
+		input.WriteString(seq)
+	}
+
+	session := lookupSession(deps, conn, p.SessionID)
+	if session == nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("pty session not found: %s", p.SessionID)}
+	}
+	if denied := inputDenied(deps.Registry, session.ID, conn); denied != nil {
+		return nil, denied
+	}
+	var seq uint64
+	if sb := session.Scrollback; sb != nil {
+		sb.mu.Lock()
+		seq = sb.seq
+		sb.mu.Unlock()
+	}
+	if rpcErr := writeInput(session, input.String()); rpcErr != nil {
+		return nil, rpcErr
+	}
+	return &SendResult{Seq: seq}, nil
+}
+
+// sessionScreen returns the emulator rendering session. On first use it is
+// fed the kept scrollback and then tapped into the session's output.
+func sessionScreen(registry *Registry, session *Session) *Screen {
+	session.screenOnce.Do(func() {
+		screen := NewScreen(session.Cols, session.Rows)
+		session.screenMu.Lock()
+		session.screen = screen
+		session.screenMu.Unlock()
+		var all uint64
+		_, _ = tapOutput(registry, session, &all, func(data []byte, seq uint64) {
+			session.screenMu.Lock()
+			_, _ = screen.Write(data)
+			session.screenSeq = seq
+			session.screenMu.Unlock()
+		}, nil)
+	})
+	return session.screen
+}
+
+// HandleSnapshot returns the rendered screen of a session.
+func HandleSnapshot(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
+	var p SnapshotParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid pty.snapshot params: %v", err)}
+	}
+	session := lookupSession(deps, conn, p.SessionID)
+	if session == nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("pty session not found: %s", p.SessionID)}
+	}
+	screen := sessionScreen(deps.Registry, session)
+	session.screenMu.Lock()
+	defer session.screenMu.Unlock()
+	row, col := screen.Cursor()
+	return &SnapshotResult{
+		Text:      screen.Text(),
+		Lines:     screen.Lines(),
+		Cols:      screen.cols,
+		Rows:      screen.rows,
+		CursorRow: row,
+		CursorCol: col,
+		AltScreen: screen.AltScreen(),
+		Seq:       session.screenSeq,
+	}, nil
+}
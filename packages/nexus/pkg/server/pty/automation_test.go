@@ -0,0 +1,179 @@
+package pty
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func newAutomationSession(t *testing.T) (*Registry, *Session, *Deps) {
+	t.Helper()
+	registry := NewRegistry()
+	session := &Session{ID: "pty-1", WorkspaceID: "ws-1", Cols: 20, Rows: 4, Scrollback: NewScrollback(0)}
+	registry.Register(session)
+	return registry, session, &Deps{Registry: registry}
+}
+
+func expect(t *testing.T, deps *Deps, p ExpectParams) *ExpectResult {
+	t.Helper()
+	p.SessionID = "pty-1"
+	res, rpcErr := HandleExpect(context.Background(), deps, mustJSON(p), newTestConn())
+	if rpcErr != nil {
+		t.Fatalf("expect: %v", rpcErr)
+	}
+	return res.(*ExpectResult)
+}
+
+func TestHandleExpectMatchesBroadcastOutput(t *testing.T) {
+	registry, session, deps := newAutomationSession(t)
+	publishOutput(nil, registry, session, "$ ")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		publishOutput(nil, registry, session, "hello \x1b[31mworld\x1b[0m\r\n$ ")
+	}()
+
+	since := uint64(0)
+	res := expect(t, deps, ExpectParams{Pattern: `hel+o (\w+)`, Since: &since, TimeoutMs: 2000})
+	if !res.Matched || res.Match != "hello world" || len(res.Groups) != 1 || res.Groups[0] != "world" {
+		t.Fatalf("unexpected match %+v", res)
+	}
+	if res.Before != "$ " || res.After != "\n$ " {
+		t.Fatalf("unexpected surrounding output %+v", res)
+	}
+	// "$ hello \x1b[31mworld" is 18 bytes.
+	if res.Seq != 18 {
+		t.Fatalf("expected seq just past the match, got %d", res.Seq)
+	}
+
+	again := expect(t, deps, ExpectParams{Literal: "world", Since: &res.Seq, TimeoutMs: 50})
+	if again.Matched || !again.TimedOut || again.Before != "\n$ " {
+		t.Fatalf("expected output after the first match only, got %+v", again)
+	}
+}
+
+func TestHandleExpectWithoutSinceIgnoresEarlierOutput(t *testing.T) {
+	registry, session, deps := newAutomationSession(t)
+	publishOutput(nil, registry, session, "ready\n")
+
+	res := expect(t, deps, ExpectParams{Literal: "ready", TimeoutMs: 50})
+	if res.Matched || !res.TimedOut {
+		t.Fatalf("expected earlier output to be skipped, got %+v", res)
+	}
+}
+
+func TestHandleExpectStopsWhenSessionExits(t *testing.T) {
+	registry, session, deps := newAutomationSession(t)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		publishOutput(nil, registry, session, "bye\n")
+		sendPTYExit(nil, registry, session.ID, 0)
+	}()
+
+	res := expect(t, deps, ExpectParams{Literal: "never", TimeoutMs: 2000})
+	if res.Matched || !res.Exited || res.Before != "bye\n" {
+		t.Fatalf("expected exit with the output seen, got %+v", res)
+	}
+}
+
+func TestHandleExpectRejectsBadParams(t *testing.T) {
+	_, _, deps := newAutomationSession(t)
+	for _, p := range []ExpectParams{
+		{SessionID: "pty-1"},
+		{SessionID: "pty-1", Pattern: "a", Literal: "a"},
+		{SessionID: "pty-1", Pattern: "("},
+		{SessionID: "missing", Literal: "a"},
+	} {
+		if _, rpcErr := HandleExpect(context.Background(), deps, mustJSON(p), newTestConn()); rpcErr == nil {
+			t.Fatalf("expected %+v to be rejected", p)
+		}
+	}
+}
+
+func TestKeySequence(t *testing.T) {
+	for name, want := range map[string]string{
+		"enter":     "\r",
+		"Ctrl-C":    "\x03",
+		"ctrl+d":    "\x04",
+		"ctrl-[":    "\x1b",
+		"up":        "\x1b[A",
+		"alt-b":     "\x1bb",
+		"alt-left":  "\x1b\x1b[D",
+		"y":         "y",
+		"f5":        "\x1b[15~",
+		"shift-tab": "\x1b[Z",
+	} {
+		got, ok := keySequence(name)
+		if !ok || got != want {
+			t.Errorf("keySequence(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	if _, ok := keySequence("hyper-x"); ok {
+		t.Error("expected unknown key to be rejected")
+	}
+}
+
+func TestHandleSendWritesTextThenKeys(t *testing.T) {
+	registry, session, deps := newAutomationSession(t)
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	session.File = writer
+	publishOutput(nil, registry, session, "$ ")
+
+	res, rpcErr := HandleSend(deps, mustJSON(SendParams{SessionID: "pty-1", Text: "ls", Keys: []string{"enter", "ctrl-c"}}), newTestConn())
+	if rpcErr != nil {
+		t.Fatalf("send: %v", rpcErr)
+	}
+	if seq := res.(*SendResult).Seq; seq != 2 {
+		t.Fatalf("expected the output seq before the input, got %d", seq)
+	}
+	buf := make([]byte, 16)
+	n, _ := reader.Read(buf)
+	if got := string(buf[:n]); got != "ls\r\x03" {
+		t.Fatalf("unexpected input %q", got)
+	}
+
+	if _, rpcErr := HandleSend(deps, mustJSON(SendParams{SessionID: "pty-1", Keys: []string{"nope"}}), newTestConn()); rpcErr == nil {
+		t.Fatal("expected unknown key to be rejected")
+	}
+}
+
+func TestHandleSendRespectsViewerRole(t *testing.T) {
+	registry, _, deps := newAutomationSession(t)
+	viewer := newTestConn()
+	registry.SubscribeAs("pty-1", viewer, RoleViewer)
+	if _, rpcErr := HandleSend(deps, mustJSON(SendParams{SessionID: "pty-1", Text: "x"}), viewer); rpcErr == nil {
+		t.Fatal("expected viewer input to be denied")
+	}
+}
+
+func TestHandleSnapshotRendersScreen(t *testing.T) {
+	registry, session, deps := newAutomationSession(t)
+	publishOutput(nil, registry, session, "one\r\ntwo\r\n")
+
+	snapshot := func() *SnapshotResult {
+		t.Helper()
+		res, rpcErr := HandleSnapshot(deps, json.RawMessage(`{"sessionId":"pty-1"}`), newTestConn())
+		if rpcErr != nil {
+			t.Fatalf("snapshot: %v", rpcErr)
+		}
+		return res.(*SnapshotResult)
+	}
+	if got := snapshot(); got.Text != "one\ntwo" || got.CursorRow != 2 || got.Rows != 4 || got.Cols != 20 {
+		t.Fatalf("unexpected snapshot %+v", got)
+	}
+
+	publishOutput(nil, registry, session, "\x1b[2J\x1b[Htop\x1b[3;5Hmid")
+	got := snapshot()
+	if got.Text != "top\n\n    mid" || got.CursorRow != 2 || got.CursorCol != 7 {
+		t.Fatalf("unexpected snapshot after redraw %+v", got)
+	}
+	if got.Seq != 29 {
+		t.Fatalf("expected snapshot seq 29, got %d", got.Seq)
+	}
+}
@@ -0,0 +1,321 @@
+package pty
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+)
+
+// Attach roles. Drivers may write to and resize the session; viewers only
+// receive output.
+const (
+	RoleDriver = "driver"
+	RoleViewer = "viewer"
+)
+
+// Participant identifies a connection attached to a session.
+type Participant struct {
+	ClientID string `json:"clientId"`
+	Subject  string `json:"subject,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// participantConn is implemented by connections that carry an identity.
+type participantConn interface {
+	Participant() Participant
+}
+
+func participantOf(conn Conn) Participant {
+	if pc, ok := conn.(participantConn); ok {
+		return pc.Participant()
+	}
+	return Participant{ClientID: fmt.Sprintf("conn-%p", conn)}
+}
+
+type attachment struct {
+	participant Participant
+	role        string
+	since       time.Time
+}
+
+// Presence is one attached participant as reported in pty.presence.
+type Presence struct {
+	Participant
+	Role       string    `json:"role"`
+	AttachedAt time.Time `json:"attachedAt"`
+}
+
+// PresenceEvent lists who is attached to a session and who holds its input
+// lock.
+type PresenceEvent struct {
+	SessionID    string     `json:"sessionId"`
+	Participants []Presence `json:"participants"`
+	LockedBy     string     `json:"lockedBy,omitempty"`
+}
+
+// Presence returns who is attached to sessionID.
+func (r *Registry) Presence(sessionID string) PresenceEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.presenceEventLocked(sessionID)
+}
+
+func (r *Registry) presenceEventLocked(sessionID string) PresenceEvent {
+	ev := PresenceEvent{SessionID: sessionID, Participants: []Presence{}}
+	for _, a := range r.subscribers[sessionID] {
+		ev.Participants = append(ev.Participants, Presence{Participant: a.participant, Role: a.role, AttachedAt: a.since})
+	}
+	sort.Slice(ev.Participants, func(i, j int) bool {
+		if !ev.Participants[i].AttachedAt.Equal(ev.Participants[j].AttachedAt) {
+			return ev.Participants[i].AttachedAt.Before(ev.Participants[j].AttachedAt)
+		}
+		return ev.Participants[i].ClientID < ev.Participants[j].ClientID
+	})
+	if holder, ok := r.locks[sessionID]; ok {
+		if a, ok := r.subscribers[sessionID][holder]; ok {
+			ev.LockedBy = a.participant.ClientID
+		}
+	}
+	return ev
+}
+
+// presenceLocked snapshots the presence of sessionID and returns a func
+// that sends it to every subscriber once the registry lock is released.
+func (r *Registry) presenceLocked(sessionID string) func() {
+	ev := r.presenceEventLocked(sessionID)
+	targets := make([]Conn, 0, len(r.subscribers[sessionID]))
+	for conn := range r.subscribers[sessionID] {
+		targets = append(targets, conn)
+	}
+	return func() {
+		encoded, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": "pty.presence", "params": ev})
+		if err != nil {
+			return
+		}
+		for _, conn := range targets {
+			conn.Enqueue(encoded)
+		}
+	}
+}
+
+// CheckInput returns why conn may not write to or resize sessionID, or ""
+// when it may. Connections the registry does not know, such as those of
+// sessions recovered without an attach, may write only while the session
+// is unlocked.
+func (r *Registry) CheckInput(sessionID string, conn Conn) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if a, ok := r.subscribers[sessionID][conn]; ok && a.role == RoleViewer {
+		return "attached as viewer; request control to type"
+	}
+	if holder, locked := r.locks[sessionID]; locked && holder != conn {
+		return fmt.Sprintf("session is locked by %s", r.subscribers[sessionID][holder].participant.displayName())
+	}
+	return ""
+}
+
+func (p Participant) displayName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.ClientID
+}
+
+// Lock gives conn exclusive input to sessionID. Only drivers can lock, and
+// only while nobody else holds the lock.
+func (r *Registry) Lock(sessionID string, conn Conn) error {
+	r.mu.Lock()
+	a, ok := r.subscribers[sessionID][conn]
+	if !ok || a.role != RoleDriver {
+		r.mu.Unlock()
+		return fmt.Errorf("only an attached driver can lock the session")
+	}
+	if holder, locked := r.locks[sessionID]; locked && holder != conn {
+		r.mu.Unlock()
+		return fmt.Errorf("session is already locked by %s", r.subscribers[sessionID][holder].participant.displayName())
+	}
+	r.locks[sessionID] = conn
+	notify := r.presenceLocked(sessionID)
+	r.mu.Unlock()
+	notify()
+	return nil
+}
+
+// Unlock releases conn's input lock on sessionID.
+func (r *Registry) Unlock(sessionID string, conn Conn) error {
+	r.mu.Lock()
+	if r.locks[sessionID] != conn {
+		r.mu.Unlock()
+		return fmt.Errorf("session is not locked by this connection")
+	}
+	delete(r.locks, sessionID)
+	notify := r.presenceLocked(sessionID)
+	r.mu.Unlock()
+	notify()
+	return nil
+}
+
+// RequestControl asks for conn to become a driver. While the session is
+// locked by someone else, the holder gets a pty.control.requested
+// notification and the request stays pending until the holder grants
+// control. While it is unlocked, a viewer's request goes the same way to
+// every attached driver; conn becomes a driver right away only when none
+// is attached.
+func (r *Registry) RequestControl(sessionID string, conn Conn) (ControlRequestResult, error) {
+	r.mu.Lock()
+	a, ok := r.subscribers[sessionID][conn]
+	if !ok {
+		r.mu.Unlock()
+		return ControlRequestResult{}, fmt.Errorf("not attached to session %s", sessionID)
+	}
+	var drivers []Conn
+	if holder, locked := r.locks[sessionID]; locked {
+		if holder != conn {
+			drivers = append(drivers, holder)
+		}
+	} else if a.role != RoleDriver {
+		for c, other := range r.subscribers[sessionID] {
+			if other.role == RoleDriver {
+				drivers = append(drivers, c)
+			}
+		}
+	}
+	if len(drivers) == 0 {
+		a.role = RoleDriver
+		notify := r.presenceLocked(sessionID)
+		r.mu.Unlock()
+		notify()
+		return ControlRequestResult{Role: RoleDriver}, nil
+	}
+	role := a.role
+	from := a.participant
+	r.mu.Unlock()
+
+	encoded, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "pty.control.requested",
+		"params":  map[string]any{"sessionId": sessionID, "from": from},
+	})
+	if err == nil {
+		for _, driver := range drivers {
+			driver.Enqueue(encoded)
+		}
+	}
+	return ControlRequestResult{Role: role, Pending: true}, nil
+}
+
+// GrantControl makes the participant with clientID a driver, handing over
+// conn's input lock when it holds one. Only drivers can grant, and only the
+// holder while the session is locked.
+func (r *Registry) GrantControl(sessionID string, conn Conn, clientID string) error {
+	r.mu.Lock()
+	if a, ok := r.subscribers[sessionID][conn]; !ok || a.role != RoleDriver {
+		r.mu.Unlock()
+		return fmt.Errorf("only an attached driver can grant control")
+	}
+	if holder, locked := r.locks[sessionID]; locked && holder != conn {
+		r.mu.Unlock()
+		return fmt.Errorf("only the lock holder can grant control")
+	}
+	var target Conn
+	for c, a := range r.subscribers[sessionID] {
+		if a.participant.ClientID == clientID {
+			target = c
+			a.role = RoleDriver
+			break
+		}
+	}
+	if target == nil {
+		r.mu.Unlock()
+		return fmt.Errorf("client %s is not attached to session %s", clientID, sessionID)
+	}
+	if _, locked := r.locks[sessionID]; locked {
+		r.locks[sessionID] = target
+	}
+	notify := r.presenceLocked(sessionID)
+	r.mu.Unlock()
+	notify()
+	return nil
+}
+
+func inputDenied(registry *Registry, sessionID string, conn Conn) *rpckit.RPCError {
+	if registry == nil {
+		return nil
+	}
+	if reason := registry.CheckInput(sessionID, conn); reason != "" {
+		return &rpckit.RPCError{Code: rpckit.ErrPermissionDenied.Code, Message: reason}
+	}
+	return nil
+}
+
+func collabParams(params json.RawMessage, deps *Deps) (SessionControlParams, *rpckit.RPCError) {
+	var p SessionControlParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return p, rpckit.ErrInvalidParams
+	}
+	p.SessionID = strings.TrimSpace(p.SessionID)
+	if p.SessionID == "" {
+		return p, rpckit.ErrInvalidParams
+	}
+	if deps.Registry == nil || deps.Registry.Get(p.SessionID) == nil {
+		return p, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "session not found"}
+	}
+	return p, nil
+}
+
+// HandleLock gives the caller exclusive input to a session.
+func HandleLock(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
+	p, rpcErr := collabParams(params, deps)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if err := deps.Registry.Lock(p.SessionID, conn); err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrPermissionDenied.Code, Message: err.Error()}
+	}
+	return deps.Registry.Presence(p.SessionID), nil
+}
+
+// HandleUnlock releases the caller's input lock.
+func HandleUnlock(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
+	p, rpcErr := collabParams(params, deps)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if err := deps.Registry.Unlock(p.SessionID, conn); err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrPermissionDenied.Code, Message: err.Error()}
+	}
+	return deps.Registry.Presence(p.SessionID), nil
+}
+
+// HandleControlRequest asks to drive a session.
+func HandleControlRequest(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
+	p, rpcErr := collabParams(params, deps)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	res, err := deps.Registry.RequestControl(p.SessionID, conn)
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	return &res, nil
+}
+
+// HandleControlGrant hands the caller's control to another participant.
+func HandleControlGrant(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
+	p, rpcErr := collabParams(params, deps)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if strings.TrimSpace(p.ClientID) == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	if err := deps.Registry.GrantControl(p.SessionID, conn, strings.TrimSpace(p.ClientID)); err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrPermissionDenied.Code, Message: err.Error()}
+	}
+	return deps.Registry.Presence(p.SessionID), nil
+}
@@ -0,0 +1,185 @@
+package pty
+
+import (
+	"encoding/json"
+	"testing"
+
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+)
+
+type namedTestConn struct {
+	*testConn
+	participant Participant
+}
+
+func (c *namedTestConn) Participant() Participant { return c.participant }
+
+func newNamedTestConn(clientID, name string) *namedTestConn {
+	return &namedTestConn{testConn: newTestConn(), participant: Participant{ClientID: clientID, Name: name}}
+}
+
+func (c *testConn) lastNotification(t *testing.T, method string) json.RawMessage {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.queued) - 1; i >= 0; i-- {
+		var msg struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(c.queued[i], &msg); err == nil && msg.Method == method {
+			return msg.Params
+		}
+	}
+	t.Fatalf("no %s notification", method)
+	return nil
+}
+
+func newCollabSession(t *testing.T) (*Deps, *Session) {
+	t.Helper()
+	registry := NewRegistry()
+	session := &Session{ID: "pty-1", WorkspaceID: "ws-1"}
+	registry.Register(session)
+	return &Deps{Registry: registry}, session
+}
+
+func attachAs(t *testing.T, deps *Deps, conn Conn, role string) {
+	t.Helper()
+	params, _ := json.Marshal(AttachParams{SessionID: "pty-1", Role: role})
+	if _, rpcErr := HandleAttach(deps, params, conn); rpcErr != nil {
+		t.Fatalf("attach as %s: %v", role, rpcErr)
+	}
+}
+
+func controlCall(t *testing.T, handler func(*Deps, json.RawMessage, Conn) (interface{}, *rpckit.RPCError), deps *Deps, conn Conn, clientID string) *rpckit.RPCError {
+	t.Helper()
+	params, _ := json.Marshal(SessionControlParams{SessionID: "pty-1", ClientID: clientID})
+	_, rpcErr := handler(deps, params, conn)
+	return rpcErr
+}
+
+func TestViewerCannotWriteUntilControlGranted(t *testing.T) {
+	deps, _ := newCollabSession(t)
+	human := newNamedTestConn("human", "Ada")
+	viewer := newNamedTestConn("viewer", "Bob")
+	attachAs(t, deps, human, "")
+	attachAs(t, deps, viewer, RoleViewer)
+
+	write, _ := json.Marshal(WriteParams{SessionID: "pty-1", Data: "ls\n"})
+	if _, rpcErr := HandleWrite(deps, write, viewer); rpcErr == nil || rpcErr.Code != rpckit.ErrPermissionDenied.Code {
+		t.Fatalf("expected viewer write to be denied, got %v", rpcErr)
+	}
+
+	var presence PresenceEvent
+	if err := json.Unmarshal(human.lastNotification(t, "pty.presence"), &presence); err != nil {
+		t.Fatalf("decode presence: %v", err)
+	}
+	if len(presence.Participants) != 2 || presence.Participants[1].Name != "Bob" || presence.Participants[1].Role != RoleViewer {
+		t.Fatalf("unexpected presence %+v", presence)
+	}
+
+	attachAs(t, deps, viewer, RoleDriver)
+	if _, rpcErr := HandleWrite(deps, write, viewer); rpcErr == nil {
+		t.Fatal("expected attaching again as driver not to lift the viewer role")
+	}
+
+	res, rpcErr := HandleControlRequest(deps, mustJSON(SessionControlParams{SessionID: "pty-1"}), viewer)
+	if rpcErr != nil || !res.(*ControlRequestResult).Pending || res.(*ControlRequestResult).Role != RoleViewer {
+		t.Fatalf("expected request to wait for the attached driver, got %+v %v", res, rpcErr)
+	}
+	var requested struct {
+		From Participant `json:"from"`
+	}
+	_ = json.Unmarshal(human.lastNotification(t, "pty.control.requested"), &requested)
+	if requested.From.ClientID != "viewer" {
+		t.Fatalf("expected driver to be asked by viewer, got %+v", requested)
+	}
+	if reason := deps.Registry.CheckInput("pty-1", viewer); reason == "" {
+		t.Fatal("expected pending request not to allow input")
+	}
+
+	if rpcErr := controlCall(t, HandleControlGrant, deps, human, "viewer"); rpcErr != nil {
+		t.Fatalf("grant: %v", rpcErr)
+	}
+	if reason := deps.Registry.CheckInput("pty-1", viewer); reason != "" {
+		t.Fatalf("expected new driver to be allowed input, got %q", reason)
+	}
+}
+
+func TestControlRequestWithoutDriversPromotesRightAway(t *testing.T) {
+	deps, _ := newCollabSession(t)
+	viewer := newNamedTestConn("viewer", "Bob")
+	attachAs(t, deps, viewer, RoleViewer)
+
+	res, rpcErr := HandleControlRequest(deps, mustJSON(SessionControlParams{SessionID: "pty-1"}), viewer)
+	if rpcErr != nil || res.(*ControlRequestResult).Role != RoleDriver || res.(*ControlRequestResult).Pending {
+		t.Fatalf("expected session without drivers to hand over control, got %+v %v", res, rpcErr)
+	}
+	if reason := deps.Registry.CheckInput("pty-1", viewer); reason != "" {
+		t.Fatalf("expected new driver to be allowed input, got %q", reason)
+	}
+}
+
+func TestLockedSessionRoutesControlRequestsToHolder(t *testing.T) {
+	deps, _ := newCollabSession(t)
+	agent := newNamedTestConn("agent", "agent")
+	human := newNamedTestConn("human", "Ada")
+	attachAs(t, deps, agent, RoleDriver)
+	attachAs(t, deps, human, RoleDriver)
+
+	if rpcErr := controlCall(t, HandleLock, deps, agent, ""); rpcErr != nil {
+		t.Fatalf("lock: %v", rpcErr)
+	}
+	if reason := deps.Registry.CheckInput("pty-1", human); reason != "session is locked by agent" {
+		t.Fatalf("expected human input to be blocked, got %q", reason)
+	}
+	if rpcErr := controlCall(t, HandleLock, deps, human, ""); rpcErr == nil {
+		t.Fatal("expected second lock to fail")
+	}
+	if reason := deps.Registry.CheckInput("pty-1", newTestConn()); reason == "" {
+		t.Fatal("expected input from an unattached connection to be blocked while locked")
+	}
+
+	res, rpcErr := HandleControlRequest(deps, mustJSON(SessionControlParams{SessionID: "pty-1"}), human)
+	if rpcErr != nil || !res.(*ControlRequestResult).Pending {
+		t.Fatalf("expected pending control request, got %+v %v", res, rpcErr)
+	}
+	var requested struct {
+		From Participant `json:"from"`
+	}
+	_ = json.Unmarshal(agent.lastNotification(t, "pty.control.requested"), &requested)
+	if requested.From.ClientID != "human" {
+		t.Fatalf("expected holder to be asked by human, got %+v", requested)
+	}
+
+	if rpcErr := controlCall(t, HandleControlGrant, deps, human, "human"); rpcErr == nil {
+		t.Fatal("expected non-holder grant to fail")
+	}
+	if rpcErr := controlCall(t, HandleControlGrant, deps, agent, "human"); rpcErr != nil {
+		t.Fatalf("grant: %v", rpcErr)
+	}
+	if got := deps.Registry.Presence("pty-1").LockedBy; got != "human" {
+		t.Fatalf("expected lock to move to human, got %q", got)
+	}
+	if reason := deps.Registry.CheckInput("pty-1", agent); reason == "" {
+		t.Fatal("expected agent input to be blocked after handing over the lock")
+	}
+
+	deps.Registry.UnsubscribeConn(human)
+	if got := deps.Registry.Presence("pty-1"); got.LockedBy != "" || len(got.Participants) != 1 {
+		t.Fatalf("expected disconnect to release the lock, got %+v", got)
+	}
+}
+
+func TestAttachRejectsUnknownRole(t *testing.T) {
+	deps, _ := newCollabSession(t)
+	params, _ := json.Marshal(AttachParams{SessionID: "pty-1", Role: "admin"})
+	if _, rpcErr := HandleAttach(deps, params, newTestConn()); rpcErr == nil {
+		t.Fatal("expected invalid role to be rejected")
+	}
+}
+
+func mustJSON(v any) json.RawMessage {
+	raw, _ := json.Marshal(v)
+	return raw
+}
@@ -15,6 +15,7 @@ import (
 
 	creackpty "github.com/creack/pty"
 	"github.com/inizio/nexus/packages/nexus/pkg/authrelay"
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
 	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
 	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
 	runtimeprocess "github.com/inizio/nexus/packages/nexus/pkg/runtime/sandbox"
@@ -34,6 +35,13 @@ type Deps struct {
 	RequireStarted func(workspaceID string) *rpckit.RPCError
 	Registry       *Registry // Global PTY session registry for multi-tab support
 	SessionStore   *Store
+	Recordings     *Recordings
+	// RecordDefault reports whether a workspace records sessions that do
+	// not set OpenParams.Record.
+	RecordDefault func(workspaceID string) bool
+	// ScrollbackDefault returns the workspace's scrollback size for
+	// sessions that do not set OpenParams.ScrollbackBytes.
+	ScrollbackDefault func(workspaceID string) int
 }
 
 func shellQuoteUnixExport(val string) string {
@@ -310,7 +318,9 @@ func HandleOpen(deps *Deps, conn Conn, params json.RawMessage, ws *workspace.Wor
 		File:        ptmx,
 		Done:        make(chan struct{}),
 		CreatedAt:   time.Now(),
+		Scrollback:  NewScrollback(scrollbackSize(deps, p.ScrollbackBytes, workspaceID)),
 	}
+	startRecording(deps, p.Record, p.RecordInput, session)
 
 	// Register in connection-local map for I/O handling
 	conn.SetPTY(sessionID, session)
@@ -393,19 +403,30 @@ func handleFirecrackerPTYOpen(deps *Deps, conn Conn, p OpenParams, wsRecord *wor
 	if workDirHint == "" || workDirHint == "/workspace" {
 		workDirHint = canonicalGuestWorkdir(driverAny, wsRecord.ID)
 	}
-	// Prefer tmux-backed shells for remote sessions so tabs can recover after daemon restarts.
-	useTmux := true
 
 	sessionID := fmt.Sprintf("pty-%d", time.Now().UnixNano())
 	enc := json.NewEncoder(agentConn)
 	dec := json.NewDecoder(agentConn)
 
+	// Prefer tmux-backed shells for remote sessions so tabs can recover after
+	// daemon restarts, unless the guest agent keeps shells alive itself.
+	useTmux := p.UseTmux || !agentPersistsShells(enc, dec, sessionID)
+
+	cols, rows := 80, 24
+	if p.Cols > 0 && p.Rows > 0 {
+		cols, rows = p.Cols, p.Rows
+	}
 	openReq := map[string]any{
 		"id":      sessionID,
 		"type":    "shell.open",
 		"command": shell,
 		"workdir": workDirHint,
 	}
+	if !useTmux {
+		openReq["persist"] = true
+		openReq["cols"] = cols
+		openReq["rows"] = rows
+	}
 	if localPath := localWorkspacePathFromRecord(wsRecord); localPath != "" {
 		openReq["local_path"] = localPath
 	}
@@ -448,14 +469,16 @@ func handleFirecrackerPTYOpen(deps *Deps, conn Conn, p OpenParams, wsRecord *wor
 		Name:        sessionName,
 		Shell:       shell,
 		WorkDir:     workDirHint,
-		Cols:        80, // Default, can be updated via resize
-		Rows:        24,
+		Cols:        cols,
+		Rows:        rows,
 		RemoteConn:  agentConn,
 		Enc:         enc,
 		Dec:         dec,
 		Remote:      true,
 		Done:        make(chan struct{}),
 		CreatedAt:   time.Now(),
+		Scrollback:  NewScrollback(scrollbackSize(deps, p.ScrollbackBytes, wsRecord.ID)),
+		Persistent:  !useTmux,
 	}
 	if useTmux {
 		session.IsTmux = true
@@ -469,6 +492,7 @@ func handleFirecrackerPTYOpen(deps *Deps, conn Conn, p OpenParams, wsRecord *wor
 			sendPTYData(conn, nil, sessionID, "\r\n[nexus] tmux unavailable; continuing without session persistence.\r\n")
 		}
 	}
+	startRecording(deps, p.Record, p.RecordInput, session)
 
 	conn.SetPTY(sessionID, session)
 
@@ -483,6 +507,28 @@ func handleFirecrackerPTYOpen(deps *Deps, conn Conn, p OpenParams, wsRecord *wor
 	return &OpenResult{SessionID: sessionID}, nil
 }
 
+// agentPersistsShells asks the guest agent whether it keeps shells alive
+// across connections. Agents that predate agent.features answer with an
+// unknown request error, which reads as no.
+func agentPersistsShells(enc *json.Encoder, dec *json.Decoder, sessionID string) bool {
+	if err := enc.Encode(map[string]any{"id": sessionID + "-features", "type": "agent.features"}); err != nil {
+		return false
+	}
+	var resp struct {
+		ExitCode int      `json:"exit_code"`
+		Features []string `json:"features"`
+	}
+	if err := dec.Decode(&resp); err != nil || resp.ExitCode != 0 {
+		return false
+	}
+	for _, feature := range resp.Features {
+		if feature == "shell.persist" {
+			return true
+		}
+	}
+	return false
+}
+
 func localWorkspacePathFromRecord(wsRecord *workspacemgr.Workspace) string {
 	if wsRecord == nil {
 		return ""
@@ -582,7 +628,7 @@ func streamRemoteShellOutput(conn Conn, session *Session, registry *Registry, st
 		typeStr, _ := msg["type"].(string)
 		if typeStr == "chunk" {
 			if data, ok := msg["data"].(string); ok && data != "" {
-				sendPTYData(conn, registry, session.ID, data)
+				publishOutput(conn, registry, session, data)
 			}
 			continue
 		}
@@ -607,6 +653,7 @@ func streamRemoteShellOutput(conn Conn, session *Session, registry *Registry, st
 	if session.Closing.Load() {
 		_ = store.Delete(session.ID)
 	}
+	_ = session.Recorder.Close()
 	_ = session.RemoteConn.Close()
 }
 
@@ -679,9 +726,20 @@ func HandleWrite(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *r
 	if session == nil {
 		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("pty session not found: %s", p.SessionID)}
 	}
+	if denied := inputDenied(deps.Registry, session.ID, conn); denied != nil {
+		return nil, denied
+	}
+	if rpcErr := writeInput(session, p.Data); rpcErr != nil {
+		return nil, rpcErr
+	}
+	return map[string]bool{"ok": true}, nil
+}
+
+// writeInput sends data to the shell of session and records it.
+func writeInput(session *Session, data string) *rpckit.RPCError {
 	if session.RemoteConn != nil {
-		if p.Data == "" {
-			return map[string]bool{"ok": true}, nil
+		if data == "" {
+			return nil
 		}
 
 		session.Mu.Lock()
@@ -689,19 +747,20 @@ func HandleWrite(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *r
 		request := map[string]any{
 			"id":   session.ID,
 			"type": "shell.write",
-			"data": p.Data,
+			"data": data,
 		}
 		if err := session.Enc.Encode(request); err != nil {
-			return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("firecracker shell write failed: %v", err)}
+			return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("firecracker shell write failed: %v", err)}
 		}
-		return map[string]bool{"ok": true}, nil
+		session.Recorder.Input(data)
+		return nil
 	}
 
-	if _, err := session.File.Write([]byte(p.Data)); err != nil {
-		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("pty write failed: %v", err)}
+	if _, err := session.File.Write([]byte(data)); err != nil {
+		return &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("pty write failed: %v", err)}
 	}
-
-	return map[string]bool{"ok": true}, nil
+	session.Recorder.Input(data)
+	return nil
 }
 
 func HandleResize(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
@@ -717,16 +776,21 @@ func HandleResize(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *
 	if session == nil {
 		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("pty session not found: %s", p.SessionID)}
 	}
+	if denied := inputDenied(deps.Registry, session.ID, conn); denied != nil {
+		return nil, denied
+	}
 	if session.RemoteConn != nil {
 		session.Mu.Lock()
 		_ = session.Enc.Encode(map[string]any{"id": session.ID, "type": "shell.resize", "cols": p.Cols, "rows": p.Rows})
 		session.Mu.Unlock()
+		session.resized(p.Cols, p.Rows)
 		return map[string]bool{"ok": true}, nil
 	}
 
 	if err := creackpty.Setsize(session.File, &creackpty.Winsize{Rows: uint16(p.Rows), Cols: uint16(p.Cols)}); err != nil {
 		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("pty resize failed: %v", err)}
 	}
+	session.resized(p.Cols, p.Rows)
 
 	return map[string]bool{"ok": true}, nil
 }
@@ -787,22 +851,7 @@ func streamPTYOutput(conn Conn, session *Session, registry *Registry, store *Sto
 	for {
 		n, err := session.File.Read(buf)
 		if n > 0 {
-			payload := map[string]any{
-				"jsonrpc": "2.0",
-				"method":  "pty.data",
-				"params": map[string]any{
-					"sessionId": session.ID,
-					"data":      string(buf[:n]),
-				},
-			}
-			encoded, marshalErr := json.Marshal(payload)
-			if marshalErr == nil {
-				if registry != nil {
-					registry.Broadcast(session.ID, encoded)
-				} else {
-					conn.Enqueue(encoded)
-				}
-			}
+			publishOutput(conn, registry, session, string(buf[:n]))
 		}
 
 		if err != nil {
@@ -843,6 +892,7 @@ func streamPTYOutput(conn Conn, session *Session, registry *Registry, store *Sto
 	if session.Closing.Load() && store != nil {
 		_ = store.Delete(session.ID)
 	}
+	_ = session.Recorder.Close()
 }
 
 func HandleAttach(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *rpckit.RPCError) {
@@ -854,6 +904,14 @@ func HandleAttach(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *
 	if sessionID == "" {
 		return nil, rpckit.ErrInvalidParams
 	}
+	role := strings.TrimSpace(p.Role)
+	switch role {
+	case "":
+		role = RoleDriver
+	case RoleDriver, RoleViewer:
+	default:
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid role %q (want driver or viewer)", p.Role)}
+	}
 	if deps.Registry == nil {
 		return &AttachResult{Attached: false}, nil
 	}
@@ -862,8 +920,8 @@ func HandleAttach(deps *Deps, params json.RawMessage, conn Conn) (interface{}, *
 		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "session not found"}
 	}
 	conn.SetPTY(sessionID, session)
-	deps.Registry.Subscribe(sessionID, conn)
-	return &AttachResult{Attached: true}, nil
+	seq, truncated := attachWithReplay(conn, deps.Registry, session, p.Since, role)
+	return &AttachResult{Attached: true, Seq: seq, Truncated: truncated, Role: role}, nil
 }
 
 // HandleList returns all PTY sessions for a workspace
@@ -908,7 +966,7 @@ func HandleGet(deps *Deps, params json.RawMessage) (interface{}, *rpckit.RPCErro
 		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "session not found"}
 	}
 
-	return &GetResult{Session: session.Info()}, nil
+	return &GetResult{Session: session.Info(), Presence: deps.Registry.Presence(sessionID)}, nil
 }
 
 // HandleRename updates a session's display name
@@ -937,6 +995,80 @@ func HandleRename(deps *Deps, params json.RawMessage) (interface{}, *rpckit.RPCE
 	return &RenameResult{Success: success}, nil
 }
 
+// HandleRecordingGet returns a session recording exported as asciicast v2.
+func HandleRecordingGet(deps *Deps, params json.RawMessage) (interface{}, *rpckit.RPCError) {
+	var p RecordingGetParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, rpckit.ErrInvalidParams
+	}
+	sessionID := strings.TrimSpace(p.SessionID)
+	if sessionID == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	info, err := deps.Recordings.Get(sessionID)
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	var cast strings.Builder
+	if err := deps.Recordings.Export(sessionID, &cast); err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: fmt.Sprintf("recording export failed: %v", err)}
+	}
+	info.Active = deps.Registry != nil && deps.Registry.Get(sessionID) != nil
+	return &RecordingGetResult{Recording: info, Cast: cast.String()}, nil
+}
+
+// HandleRecordingList returns the recordings of a workspace.
+func HandleRecordingList(deps *Deps, params json.RawMessage) (interface{}, *rpckit.RPCError) {
+	var p RecordingListParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, rpckit.ErrInvalidParams
+	}
+	workspaceID := strings.TrimSpace(p.WorkspaceID)
+	if workspaceID == "" {
+		return nil, rpckit.ErrInvalidParams
+	}
+	recordings, err := deps.Recordings.List(workspaceID)
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+	}
+	for i := range recordings {
+		recordings[i].Active = deps.Registry != nil && deps.Registry.Get(recordings[i].SessionID) != nil
+	}
+	return &RecordingListResult{Recordings: recordings}, nil
+}
+
+// startRecording attaches a recorder to session when record, or else the
+// workspace default, asks for one. Input is recorded only with
+// recordInput. A recording that cannot start never blocks the terminal.
+func startRecording(deps *Deps, record *bool, recordInput bool, session *Session) {
+	enabled := deps.RecordDefault != nil && deps.RecordDefault(session.WorkspaceID)
+	if record != nil {
+		enabled = *record
+	}
+	if !enabled || deps.Recordings == nil {
+		return
+	}
+	rec, err := deps.Recordings.Start(session, recordInput)
+	if err != nil {
+		log.Printf("[pty] recording disabled for %s: %v", session.ID, err)
+		return
+	}
+	session.Recorder = rec
+}
+
+// scrollbackSize picks the requested scrollback size, else the workspace
+// default, bounded by config.MaxScrollbackBytes.
+func scrollbackSize(deps *Deps, requested int, workspaceID string) int {
+	size := requested
+	if size <= 0 && deps.ScrollbackDefault != nil {
+		size = deps.ScrollbackDefault(workspaceID)
+	}
+	if size <= 0 {
+		return DefaultScrollbackBytes
+	}
+	return min(size, config.MaxScrollbackBytes)
+}
+
 func recoverPersistedSessionsForWorkspace(deps *Deps, workspaceID string) {
 	if deps == nil || deps.SessionStore == nil || deps.Registry == nil {
 		return
@@ -946,12 +1078,19 @@ func recoverPersistedSessionsForWorkspace(deps *Deps, workspaceID string) {
 		return
 	}
 	for _, record := range records {
-		if record.WorkspaceID != workspaceID || !record.IsTmux {
+		if record.WorkspaceID != workspaceID || (!record.IsTmux && !record.Persistent) {
 			continue
 		}
 		if deps.Registry.Get(record.ID) != nil {
 			continue
 		}
+		if record.Persistent {
+			if err := recoverPersistentShell(deps, record); err != nil {
+				log.Printf("[pty] persistent shell %s not recovered: %v", record.ID, err)
+				_ = deps.SessionStore.Delete(record.ID)
+			}
+			continue
+		}
 		alive, definitive := probePersistedTmuxSession(deps, record)
 		if definitive && !alive {
 			log.Printf("[pty] persisted tmux session %s missing; attempting rehydrate via attach", record.ID)
@@ -962,18 +1101,20 @@ func recoverPersistedSessionsForWorkspace(deps *Deps, workspaceID string) {
 	}
 }
 
-func recoverPersistedTmuxSession(deps *Deps, info SessionInfo) error {
+// recoveryAgentConn connects to the guest agent of a persisted session's
+// workspace.
+func recoveryAgentConn(deps *Deps, info SessionInfo) (net.Conn, runtime.Driver, error) {
 	if deps.RequireStarted != nil {
 		if rpcErr := deps.RequireStarted(info.WorkspaceID); rpcErr != nil {
-			return fmt.Errorf(rpcErr.Message)
+			return nil, nil, fmt.Errorf(rpcErr.Message)
 		}
 	}
 	if deps.WorkspaceMgr == nil || deps.RuntimeFactory == nil {
-		return fmt.Errorf("dependencies unavailable")
+		return nil, nil, fmt.Errorf("dependencies unavailable")
 	}
 	wsRecord, ok := deps.WorkspaceMgr.Get(info.WorkspaceID)
 	if !ok {
-		return fmt.Errorf("workspace not found")
+		return nil, nil, fmt.Errorf("workspace not found")
 	}
 	backend := strings.TrimSpace(wsRecord.Backend)
 	if backend == "" {
@@ -981,18 +1122,81 @@ func recoverPersistedTmuxSession(deps *Deps, info SessionInfo) error {
 	}
 	driverAny, ok := deps.RuntimeFactory.DriverForBackend(backend)
 	if !ok {
-		return fmt.Errorf("backend %s unavailable", backend)
+		return nil, nil, fmt.Errorf("backend %s unavailable", backend)
 	}
 	connector, ok := driverAny.(firecrackerAgentConnector)
 	if !ok {
-		return fmt.Errorf("backend %s has no agent connector", backend)
+		return nil, nil, fmt.Errorf("backend %s has no agent connector", backend)
 	}
 	openCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	agentConn, err := connector.AgentConn(openCtx, wsRecord.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return agentConn, driverAny, nil
+}
+
+// recoverPersistentShell attaches to a shell the guest agent kept running
+// while the daemon was away. Its buffered output is replayed into the new
+// session's scrollback.
+func recoverPersistentShell(deps *Deps, info SessionInfo) error {
+	agentConn, _, err := recoveryAgentConn(deps, info)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(agentConn)
+	dec := json.NewDecoder(agentConn)
+	if err := enc.Encode(map[string]any{"id": info.ID, "type": "shell.attach"}); err != nil {
+		_ = agentConn.Close()
+		return err
+	}
+	var resp map[string]any
+	if err := dec.Decode(&resp); err != nil {
+		_ = agentConn.Close()
+		return err
+	}
+	if exitRaw, ok := resp["exit_code"].(float64); ok && int(exitRaw) != 0 {
+		_ = agentConn.Close()
+		stderr, _ := resp["stderr"].(string)
+		if stderr == "" {
+			stderr = "shell attach failed"
+		}
+		return fmt.Errorf("%s", stderr)
+	}
+	session := &Session{
+		ID:          info.ID,
+		WorkspaceID: info.WorkspaceID,
+		Name:        info.Name,
+		Shell:       info.Shell,
+		WorkDir:     info.WorkDir,
+		Cols:        info.Cols,
+		Rows:        info.Rows,
+		RemoteConn:  agentConn,
+		Enc:         enc,
+		Dec:         dec,
+		Remote:      true,
+		Done:        make(chan struct{}),
+		CreatedAt:   info.CreatedAt,
+		Scrollback:  NewScrollback(scrollbackSize(deps, 0, info.WorkspaceID)),
+		Persistent:  true,
+	}
+	if info.Recording {
+		record := true
+		startRecording(deps, &record, info.RecordingInput, session)
+	}
+	deps.Registry.Register(session)
+	_ = deps.SessionStore.Upsert(session.Info())
+	go streamRemoteShellOutput(nil, session, deps.Registry, deps.SessionStore)
+	return nil
+}
+
+func recoverPersistedTmuxSession(deps *Deps, info SessionInfo) error {
+	agentConn, driverAny, err := recoveryAgentConn(deps, info)
 	if err != nil {
 		return err
 	}
+	wsRecord, _ := deps.WorkspaceMgr.Get(info.WorkspaceID)
 	enc := json.NewEncoder(agentConn)
 	dec := json.NewDecoder(agentConn)
 	openReq := buildRecoveredShellOpenRequest(info, wsRecord)
@@ -1030,18 +1234,25 @@ func recoverPersistedTmuxSession(deps *Deps, info SessionInfo) error {
 		CreatedAt:   info.CreatedAt,
 		IsTmux:      true,
 		TmuxSession: tmuxSession,
+		Scrollback:  NewScrollback(scrollbackSize(deps, 0, info.WorkspaceID)),
 	}
 	if err := sendRemoteShellWrite(enc, dec, nil, info.ID, buildTmuxAttachCommand(tmuxSession, guestCWD)); err != nil {
 		_ = agentConn.Close()
 		return err
 	}
+	if info.Recording {
+		record := true
+		startRecording(deps, &record, info.RecordingInput, session)
+	}
 	deps.Registry.Register(session)
 	_ = deps.SessionStore.Upsert(session.Info())
 	go streamRemoteShellOutput(nil, session, deps.Registry, deps.SessionStore)
 	return nil
 }
 
-// PruneStalePersistedSessions removes persisted tmux entries that are no longer valid.
+// PruneStalePersistedSessions removes persisted tmux and persistent shell
+// entries that are no longer valid. Persistent shells are not probed: an
+// attach would take them over, so recovery drops the ones that are gone.
 func PruneStalePersistedSessions(deps *Deps) int {
 	if deps == nil || deps.SessionStore == nil {
 		return 0
@@ -1052,7 +1263,7 @@ func PruneStalePersistedSessions(deps *Deps) int {
 	}
 	removed := 0
 	for _, entry := range entries {
-		if !entry.IsTmux {
+		if !entry.IsTmux && !entry.Persistent {
 			_ = deps.SessionStore.Delete(entry.ID)
 			removed++
 			continue
@@ -1068,7 +1279,7 @@ func PruneStalePersistedSessions(deps *Deps) int {
 			removed++
 			continue
 		}
-		if deps.Registry != nil && deps.Registry.Get(entry.ID) != nil {
+		if entry.Persistent || (deps.Registry != nil && deps.Registry.Get(entry.ID) != nil) {
 			continue
 		}
 		alive, definitive := probePersistedTmuxSession(deps, entry)
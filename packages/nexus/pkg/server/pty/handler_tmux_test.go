@@ -1,6 +1,8 @@
 package pty
 
 import (
+	"bytes"
+	"encoding/json"
 	"strings"
 	"testing"
 )
@@ -22,3 +24,24 @@ func TestBuildTmuxAttachCommand_UsesWorkspaceDirAndStaleSessionGuard(t *testing.
 	}
 }
 
+func TestAgentPersistsShellsFallsBackToTmuxForOlderAgents(t *testing.T) {
+	for name, tc := range map[string]struct {
+		resp string
+		want bool
+	}{
+		"advertised":  {`{"id":"pty-1-features","type":"result","exit_code":0,"features":["shell.persist"]}`, true},
+		"unknown":     {`{"id":"pty-1-features","type":"result","exit_code":1,"stderr":"unknown shell request type"}`, false},
+		"no features": {`{"id":"pty-1-features","type":"result","exit_code":0}`, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var sent bytes.Buffer
+			got := agentPersistsShells(json.NewEncoder(&sent), json.NewDecoder(strings.NewReader(tc.resp+"\n")), "pty-1")
+			if got != tc.want {
+				t.Fatalf("agentPersistsShells = %v, want %v", got, tc.want)
+			}
+			if !strings.Contains(sent.String(), `"type":"agent.features"`) {
+				t.Fatalf("expected an agent.features request, got %q", sent.String())
+			}
+		})
+	}
+}
@@ -9,6 +9,13 @@ type OpenParams struct {
 	AuthRelayToken string `json:"authRelayToken,omitempty"`
 	Name           string `json:"name,omitempty"`    // Optional display name for the tab
 	UseTmux        bool   `json:"useTmux,omitempty"` // Whether to use tmux for this session
+	// Record overrides the workspace's terminal.record default.
+	Record *bool `json:"record,omitempty"`
+	// RecordInput also records what is typed into a recorded session.
+	// It is off unless asked for, since input includes passwords.
+	RecordInput bool `json:"recordInput,omitempty"`
+	// ScrollbackBytes overrides the workspace's terminal.scrollbackBytes.
+	ScrollbackBytes int `json:"scrollbackBytes,omitempty"`
 }
 
 type OpenResult struct {
@@ -31,12 +38,37 @@ type CloseParams struct {
 }
 
 // AttachParams reattaches the current connection to an existing PTY session.
+// Output after Since, the seq of the last pty.data the client saw, is
+// replayed first; zero replays all kept scrollback.
 type AttachParams struct {
 	SessionID string `json:"sessionId"`
+	Since     uint64 `json:"since,omitempty"`
+	// Role is RoleDriver (the default) or RoleViewer.
+	Role string `json:"role,omitempty"`
 }
 
+// AttachResult reports the seq the replay ended at. Truncated means output
+// after Since had already left the scrollback.
 type AttachResult struct {
-	Attached bool `json:"attached"`
+	Attached  bool   `json:"attached"`
+	Seq       uint64 `json:"seq"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// SessionControlParams names a session for pty.lock, pty.unlock and
+// pty.control.request, and the participant for pty.control.grant.
+type SessionControlParams struct {
+	SessionID string `json:"sessionId"`
+	ClientID  string `json:"clientId,omitempty"`
+}
+
+// ControlRequestResult is the caller's role after pty.control.request.
+// Pending means the drivers, or the lock holder, were asked to grant
+// control.
+type ControlRequestResult struct {
+	Role    string `json:"role"`
+	Pending bool   `json:"pending,omitempty"`
 }
 
 // ListParams requests a list of PTY sessions for a workspace
@@ -56,7 +88,8 @@ type GetParams struct {
 
 // GetResult contains session details
 type GetResult struct {
-	Session SessionInfo `json:"session"`
+	Session  SessionInfo   `json:"session"`
+	Presence PresenceEvent `json:"presence"`
 }
 
 // RenameParams requests renaming a session
@@ -83,3 +116,83 @@ type TmuxCommandResult struct {
 	Output   string `json:"output,omitempty"`
 	ErrorMsg string `json:"error,omitempty"`
 }
+
+// RecordingGetParams requests a session recording.
+type RecordingGetParams struct {
+	SessionID string `json:"sessionId"`
+}
+
+// RecordingGetResult carries the recording and, as Cast, its asciicast v2
+// export.
+type RecordingGetResult struct {
+	Recording RecordingInfo `json:"recording"`
+	Cast      string        `json:"cast"`
+}
+
+// RecordingListParams requests the recordings of a workspace.
+type RecordingListParams struct {
+	WorkspaceID string `json:"workspaceId"`
+}
+
+type RecordingListResult struct {
+	Recordings []RecordingInfo `json:"recordings"`
+}
+
+// ExpectParams waits for session output to match Pattern, an RE2 regular
+// expression, or Literal. Output after Since is matched; without Since only
+// output produced after the call is. Escape sequences and control
+// characters other than newline and tab are removed before matching unless
+// Raw is set.
+type ExpectParams struct {
+	SessionID string  `json:"sessionId"`
+	Pattern   string  `json:"pattern,omitempty"`
+	Literal   string  `json:"literal,omitempty"`
+	Since     *uint64 `json:"since,omitempty"`
+	TimeoutMs int     `json:"timeoutMs,omitempty"`
+	Raw       bool    `json:"raw,omitempty"`
+}
+
+// ExpectResult carries the match and the output around it. Seq is the
+// output position just past the match, or past everything seen when there
+// was no match, to pass as Since to the next pty.expect.
+type ExpectResult struct {
+	Matched  bool     `json:"matched"`
+	Match    string   `json:"match,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Before   string   `json:"before"`
+	After    string   `json:"after"`
+	Seq      uint64   `json:"seq"`
+	TimedOut bool     `json:"timedOut,omitempty"`
+	Exited   bool     `json:"exited,omitempty"`
+}
+
+// SendParams types Text and then Keys, named keys such as "enter",
+// "ctrl-c" or "up", into a session.
+type SendParams struct {
+	SessionID string   `json:"sessionId"`
+	Text      string   `json:"text,omitempty"`
+	Keys      []string `json:"keys,omitempty"`
+}
+
+// SendResult reports the output seq before the input was written, so a
+// following pty.expect can match everything the input caused.
+type SendResult struct {
+	Seq uint64 `json:"seq"`
+}
+
+type SnapshotParams struct {
+	SessionID string `json:"sessionId"`
+}
+
+// SnapshotResult is the rendered screen of a session. Lines has one entry
+// per row; Text joins them without trailing blank rows.
+type SnapshotResult struct {
+	Text      string   `json:"text"`
+	Lines     []string `json:"lines"`
+	Cols      int      `json:"cols"`
+	Rows      int      `json:"rows"`
+	CursorRow int      `json:"cursorRow"`
+	CursorCol int      `json:"cursorCol"`
+	AltScreen bool     `json:"altScreen,omitempty"`
+	Seq       uint64   `json:"seq"`
+}
@@ -0,0 +1,393 @@
+package pty
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRecordingSegmentBytes is the size at which a recording rotates to a
+	// new segment.
+	maxRecordingSegmentBytes = 8 << 20
+	// keepRecordingSegments is how many rotated segments are kept besides
+	// the live one; older output is dropped.
+	keepRecordingSegments = 3
+)
+
+// castHeader is the first line of an asciicast v2 file.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// RecordingInfo describes a session recording on disk.
+type RecordingInfo struct {
+	SessionID   string    `json:"sessionId"`
+	WorkspaceID string    `json:"workspaceId"`
+	Name        string    `json:"name"`
+	Shell       string    `json:"shell,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Bytes       int64     `json:"bytes"`
+	Segments    int       `json:"segments"`
+	Active      bool      `json:"active"`
+}
+
+// Recordings stores session recordings as asciicast v2 files under
+// <workspaceDir>/.nexus/state/recordings/<workspaceId>/<sessionId>.cast.
+// Rotated segments get a numeric suffix, .cast.1 being the newest. A
+// recording can hold whatever was shown or typed in a terminal, so the
+// directories are private to the daemon's user and the files are 0600.
+type Recordings struct {
+	dir string
+}
+
+func NewRecordings(workspaceDir string) *Recordings {
+	return &Recordings{dir: filepath.Join(workspaceDir, ".nexus", "state", "recordings")}
+}
+
+// Start opens the recorder for s, appending to an existing recording of the
+// same session so recovered tmux sessions keep one timeline. Input is
+// recorded only when input is set.
+func (r *Recordings) Start(s *Session, input bool) (*Recorder, error) {
+	if r == nil {
+		return nil, errors.New("recordings unavailable")
+	}
+	path, err := r.path(s.WorkspaceID, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.mkdirPrivate(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	rec := &Recorder{path: path, maxBytes: maxRecordingSegmentBytes, now: time.Now, input: input}
+	if header, err := readCastHeader(path); err == nil {
+		rec.header = header
+		rec.start = time.Unix(header.Timestamp, 0)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		// Recordings made before they were private may still be 0644.
+		if err := f.Chmod(0o600); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		rec.f, rec.size = f, info.Size()
+		return rec, nil
+	}
+
+	rec.start = rec.now()
+	rec.header = castHeader{
+		Version:   2,
+		Width:     s.Cols,
+		Height:    s.Rows,
+		Timestamp: rec.start.Unix(),
+		Title:     s.Name,
+		Env:       map[string]string{"SHELL": s.Shell, "TERM": "xterm-256color"},
+	}
+	if err := rec.openSegment(); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// mkdirPrivate creates dir with mode 0700, tightening the recordings
+// directories that already exist.
+func (r *Recordings) mkdirPrivate(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	for _, d := range []string{r.dir, dir} {
+		if err := os.Chmod(d, 0o700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the recordings of a workspace, oldest first.
+func (r *Recordings) List(workspaceID string) ([]RecordingInfo, error) {
+	if r == nil {
+		return []RecordingInfo{}, nil
+	}
+	if err := validRecordingName(workspaceID); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(r.dir, workspaceID, "*.cast"))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RecordingInfo, 0, len(paths))
+	for _, path := range paths {
+		info, err := recordingInfo(workspaceID, path)
+		if err != nil {
+			continue
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out, nil
+}
+
+// Get returns the recording of sessionID wherever its workspace is.
+func (r *Recordings) Get(sessionID string) (RecordingInfo, error) {
+	path, workspaceID, err := r.find(sessionID)
+	if err != nil {
+		return RecordingInfo{}, err
+	}
+	return recordingInfo(workspaceID, path)
+}
+
+// Export writes the recording of sessionID to w as a single asciicast v2
+// stream: the header of the oldest kept segment, then every event in order.
+func (r *Recordings) Export(sessionID string, w io.Writer) error {
+	path, _, err := r.find(sessionID)
+	if err != nil {
+		return err
+	}
+	segments := segmentPaths(path)
+	for i := len(segments) - 1; i >= 0; i-- {
+		f, err := os.Open(segments[i])
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64<<10), maxRecordingSegmentBytes)
+		first := true
+		for sc.Scan() {
+			if first && i != len(segments)-1 {
+				first = false
+				continue
+			}
+			first = false
+			if _, err := w.Write(append(sc.Bytes(), '\n')); err != nil {
+				_ = f.Close()
+				return err
+			}
+		}
+		_ = f.Close()
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Recordings) find(sessionID string) (string, string, error) {
+	if r == nil {
+		return "", "", errors.New("recordings unavailable")
+	}
+	if err := validRecordingName(sessionID); err != nil {
+		return "", "", err
+	}
+	matches, _ := filepath.Glob(filepath.Join(r.dir, "*", sessionID+".cast"))
+	if len(matches) == 0 {
+		return "", "", fmt.Errorf("no recording for session %s", sessionID)
+	}
+	return matches[0], filepath.Base(filepath.Dir(matches[0])), nil
+}
+
+func (r *Recordings) path(workspaceID, sessionID string) (string, error) {
+	if err := validRecordingName(workspaceID); err != nil {
+		return "", err
+	}
+	if err := validRecordingName(sessionID); err != nil {
+		return "", err
+	}
+	return filepath.Join(r.dir, workspaceID, sessionID+".cast"), nil
+}
+
+func validRecordingName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid recording id %q", name)
+	}
+	return nil
+}
+
+// segmentPaths returns the live segment followed by its rotated segments,
+// newest first.
+func segmentPaths(path string) []string {
+	out := []string{path}
+	for i := 1; i <= keepRecordingSegments; i++ {
+		p := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func recordingInfo(workspaceID, path string) (RecordingInfo, error) {
+	header, err := readCastHeader(path)
+	if err != nil {
+		return RecordingInfo{}, err
+	}
+	info := RecordingInfo{
+		SessionID:   strings.TrimSuffix(filepath.Base(path), ".cast"),
+		WorkspaceID: workspaceID,
+		Name:        header.Title,
+		Shell:       header.Env["SHELL"],
+		StartedAt:   time.Unix(header.Timestamp, 0).UTC(),
+	}
+	for _, p := range segmentPaths(path) {
+		st, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		info.Bytes += st.Size()
+		info.Segments++
+		if st.ModTime().After(info.UpdatedAt) {
+			info.UpdatedAt = st.ModTime().UTC()
+		}
+	}
+	return info, nil
+}
+
+func readCastHeader(path string) (castHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return castHeader{}, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return castHeader{}, err
+	}
+	var header castHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return castHeader{}, err
+	}
+	if header.Version != 2 {
+		return castHeader{}, fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+	return header, nil
+}
+
+// Recorder appends a session's output, resize and, when enabled, input
+// events to its recording. A nil *Recorder records nothing.
+type Recorder struct {
+	mu       sync.Mutex
+	path     string
+	header   castHeader
+	start    time.Time
+	now      func() time.Time
+	f        *os.File
+	size     int64
+	maxBytes int64
+	// input enables Input: keystrokes include passwords typed at prompts.
+	input bool
+}
+
+// Output records data written by the terminal.
+func (r *Recorder) Output(data string) { r.event("o", data) }
+
+// Input records data typed into the terminal if the recorder was started
+// with input recording.
+func (r *Recorder) Input(data string) {
+	if r != nil && r.input {
+		r.event("i", data)
+	}
+}
+
+// RecordsInput reports whether the recorder records input.
+func (r *Recorder) RecordsInput() bool { return r != nil && r.input }
+
+// Resize records a terminal size change.
+func (r *Recorder) Resize(cols, rows int) { r.event("r", fmt.Sprintf("%dx%d", cols, rows)) }
+
+// Close flushes and closes the recording. Later events are dropped.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+func (r *Recorder) event(code, data string) {
+	if r == nil || data == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return
+	}
+	elapsed := float64(r.now().Sub(r.start).Microseconds()) / 1e6
+	line, err := json.Marshal([]any{elapsed, code, data})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if r.size+int64(len(line)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return
+		}
+	}
+	n, _ := r.f.Write(line)
+	r.size += int64(n)
+}
+
+// rotate shifts the segments up by one, dropping the oldest, and starts a
+// new live segment. Each segment is a playable cast on its own.
+func (r *Recorder) rotate() error {
+	_ = r.f.Close()
+	r.f = nil
+	_ = os.Remove(fmt.Sprintf("%s.%d", r.path, keepRecordingSegments))
+	for i := keepRecordingSegments - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.openSegment()
+}
+
+func (r *Recorder) openSegment() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0o600); err != nil {
+		_ = f.Close()
+		return err
+	}
+	header, err := json.Marshal(r.header)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	n, err := f.Write(append(header, '\n'))
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.f, r.size = f, int64(n)
+	return nil
+}
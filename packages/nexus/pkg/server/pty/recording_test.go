@@ -0,0 +1,226 @@
+package pty
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func castLines(t *testing.T, cast string) (castHeader, [][]any) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(cast, "\n"), "\n")
+	var header castHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("decode header %q: %v", lines[0], err)
+	}
+	events := make([][]any, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		var ev []any
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("decode event %q: %v", line, err)
+		}
+		events = append(events, ev)
+	}
+	return header, events
+}
+
+func TestRecorderWritesAsciicastEvents(t *testing.T) {
+	recs := NewRecordings(t.TempDir())
+	session := &Session{ID: "pty-1", WorkspaceID: "ws-1", Name: "Tab 1", Shell: "bash", Cols: 100, Rows: 30}
+	rec, err := recs.Start(session, true)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	rec.Output("$ ")
+	rec.Input("ls\r")
+	rec.Resize(120, 40)
+	if err := rec.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	rec.Output("dropped")
+
+	var cast strings.Builder
+	if err := recs.Export("pty-1", &cast); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	header, events := castLines(t, cast.String())
+	if header.Version != 2 || header.Width != 100 || header.Height != 30 || header.Title != "Tab 1" {
+		t.Fatalf("unexpected header %#v", header)
+	}
+	want := [][2]string{{"o", "$ "}, {"i", "ls\r"}, {"r", "120x40"}}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %v", len(want), events)
+	}
+	for i, w := range want {
+		if events[i][1] != w[0] || events[i][2] != w[1] {
+			t.Fatalf("event %d: expected %v, got %v", i, w, events[i])
+		}
+	}
+
+	list, err := recs.List("ws-1")
+	if err != nil || len(list) != 1 || list[0].SessionID != "pty-1" || list[0].Shell != "bash" || list[0].Segments != 1 {
+		t.Fatalf("unexpected list %#v (err=%v)", list, err)
+	}
+}
+
+func TestRecordingsArePrivateAndSkipInputByDefault(t *testing.T) {
+	dir := t.TempDir()
+	recs := NewRecordings(dir)
+	// A directory left 0755 by an earlier version is tightened.
+	if err := os.MkdirAll(recs.dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := recs.Start(&Session{ID: "pty-7", WorkspaceID: "ws-1", Cols: 80, Rows: 24}, false)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	rec.Output("password: ")
+	rec.Input("hunter2\r")
+	_ = rec.Close()
+
+	for _, p := range []string{recs.dir, filepath.Join(recs.dir, "ws-1")} {
+		if info, err := os.Stat(p); err != nil || info.Mode().Perm() != 0o700 {
+			t.Fatalf("%s mode = %v, %v", p, info.Mode(), err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(recs.dir, "ws-1", "pty-7.cast")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("recording mode = %v, %v", info.Mode(), err)
+	}
+	var cast strings.Builder
+	if err := recs.Export("pty-7", &cast); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if strings.Contains(cast.String(), "hunter2") {
+		t.Fatalf("expected input not to be recorded, got %s", cast.String())
+	}
+}
+
+func TestRecorderRotatesAndExportsKeptSegments(t *testing.T) {
+	recs := NewRecordings(t.TempDir())
+	rec, err := recs.Start(&Session{ID: "pty-2", WorkspaceID: "ws-1", Cols: 80, Rows: 24}, false)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	rec.maxBytes = 200
+	for i := 0; i < 40; i++ {
+		rec.Output(strings.Repeat("x", 40))
+	}
+	_ = rec.Close()
+
+	info, err := recs.Get("pty-2")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if info.Segments != keepRecordingSegments+1 {
+		t.Fatalf("expected %d segments, got %d", keepRecordingSegments+1, info.Segments)
+	}
+	var cast strings.Builder
+	if err := recs.Export("pty-2", &cast); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	_, events := castLines(t, cast.String())
+	if len(events) == 0 || len(events) >= 40 {
+		t.Fatalf("expected the oldest output to be dropped, got %d events", len(events))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i][0].(float64) < events[i-1][0].(float64) {
+			t.Fatalf("events out of order: %v", events)
+		}
+	}
+}
+
+func TestRecordingsResumeAppendsToSameTimeline(t *testing.T) {
+	recs := NewRecordings(t.TempDir())
+	session := &Session{ID: "pty-3", WorkspaceID: "ws-1", Cols: 80, Rows: 24}
+	first, err := recs.Start(session, false)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	first.Output("before restart")
+	_ = first.Close()
+
+	second, err := recs.Start(session, false)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	second.Output("after restart")
+	_ = second.Close()
+
+	var cast strings.Builder
+	if err := recs.Export("pty-3", &cast); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	_, events := castLines(t, cast.String())
+	if len(events) != 2 || events[0][2] != "before restart" || events[1][2] != "after restart" {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
+
+func TestRecordingsRejectPathIDs(t *testing.T) {
+	recs := NewRecordings(t.TempDir())
+	if _, err := recs.Get("../pty-1"); err == nil {
+		t.Fatal("expected invalid session id to be rejected")
+	}
+	if _, err := recs.List(".."); err == nil {
+		t.Fatal("expected invalid workspace id to be rejected")
+	}
+}
+
+func TestStreamPTYOutputRecordsOutput(t *testing.T) {
+	recs := NewRecordings(t.TempDir())
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	defer reader.Close()
+	session := &Session{ID: "pty-4", WorkspaceID: "ws-1", Cmd: exec.Command("sh"), File: reader}
+	record := true
+	startRecording(&Deps{Recordings: recs}, &record, false, session)
+	if session.Recorder == nil {
+		t.Fatal("expected recorder")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		streamPTYOutput(newTestConn(), session, nil, nil)
+		close(done)
+	}()
+	_, _ = writer.Write([]byte("hello\n"))
+	_ = writer.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("streamPTYOutput did not terminate")
+	}
+
+	var cast strings.Builder
+	if err := recs.Export("pty-4", &cast); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if _, events := castLines(t, cast.String()); len(events) != 1 || events[0][2] != "hello\n" {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
+
+func TestStartRecordingFollowsWorkspaceDefault(t *testing.T) {
+	recs := NewRecordings(t.TempDir())
+	deps := &Deps{Recordings: recs, RecordDefault: func(string) bool { return true }}
+
+	on := &Session{ID: "pty-5", WorkspaceID: "ws-1"}
+	startRecording(deps, nil, false, on)
+	if on.Recorder == nil {
+		t.Fatal("expected workspace default to enable recording")
+	}
+	_ = on.Recorder.Close()
+
+	off := &Session{ID: "pty-6", WorkspaceID: "ws-1"}
+	record := false
+	startRecording(deps, &record, false, off)
+	if off.Recorder != nil {
+		t.Fatal("expected record=false to override the workspace default")
+	}
+}
@@ -3,15 +3,22 @@ package pty
 import (
 	"sort"
 	"sync"
+	"time"
 )
 
 // Registry provides global tracking of PTY sessions across all connections.
 // This enables workspace-scoped session management and multi-tab support.
 type Registry struct {
 	mu          sync.RWMutex
-	sessions    map[string]*Session        // sessionID -> Session
-	byWorkspace map[string]map[string]bool // workspaceID -> set of sessionIDs
-	subscribers map[string]map[Conn]bool   // sessionID -> subscriber connections
+	sessions    map[string]*Session             // sessionID -> Session
+	byWorkspace map[string]map[string]bool      // workspaceID -> set of sessionIDs
+	subscribers map[string]map[Conn]*attachment // sessionID -> subscriber connections
+	locks       map[string]Conn                 // sessionID -> input lock holder
+	taps        map[string]map[*tap]struct{}    // sessionID -> output taps
+}
+
+type tap struct {
+	fn func(encoded []byte)
 }
 
 // NewRegistry creates a new global PTY session registry
@@ -19,7 +26,9 @@ func NewRegistry() *Registry {
 	return &Registry{
 		sessions:    make(map[string]*Session),
 		byWorkspace: make(map[string]map[string]bool),
-		subscribers: make(map[string]map[Conn]bool),
+		subscribers: make(map[string]map[Conn]*attachment),
+		locks:       make(map[string]Conn),
+		taps:        make(map[string]map[*tap]struct{}),
 	}
 }
 
@@ -50,6 +59,8 @@ func (r *Registry) Unregister(sessionID string) {
 
 	delete(r.sessions, sessionID)
 	delete(r.subscribers, sessionID)
+	delete(r.locks, sessionID)
+	delete(r.taps, sessionID)
 
 	if s.WorkspaceID != "" && r.byWorkspace[s.WorkspaceID] != nil {
 		delete(r.byWorkspace[s.WorkspaceID], sessionID)
@@ -59,45 +70,114 @@ func (r *Registry) Unregister(sessionID string) {
 	}
 }
 
-// Subscribe registers a connection to receive PTY events for a session.
+// Subscribe registers a connection to receive PTY events for a session as a
+// driver.
 func (r *Registry) Subscribe(sessionID string, conn Conn) bool {
+	return r.SubscribeAs(sessionID, conn, RoleDriver)
+}
+
+// SubscribeAs registers a connection with role and tells the session's
+// subscribers who is attached. An attached connection can drop to viewer
+// but is never raised to driver this way; that takes pty.control.request,
+// which a driver has to grant.
+func (r *Registry) SubscribeAs(sessionID string, conn Conn, role string) bool {
 	r.mu.Lock()
-	defer r.mu.Unlock()
 	if _, ok := r.sessions[sessionID]; !ok {
+		r.mu.Unlock()
 		return false
 	}
 	if r.subscribers[sessionID] == nil {
-		r.subscribers[sessionID] = make(map[Conn]bool)
+		r.subscribers[sessionID] = make(map[Conn]*attachment)
 	}
-	r.subscribers[sessionID][conn] = true
+	if a, ok := r.subscribers[sessionID][conn]; ok {
+		if role == RoleViewer {
+			a.role = role
+		}
+	} else {
+		r.subscribers[sessionID][conn] = &attachment{participant: participantOf(conn), role: role, since: time.Now()}
+	}
+	if role == RoleViewer && r.locks[sessionID] == conn {
+		delete(r.locks, sessionID)
+	}
+	notify := r.presenceLocked(sessionID)
+	r.mu.Unlock()
+	notify()
 	return true
 }
 
 // Unsubscribe removes a connection from a session's subscribers.
 func (r *Registry) Unsubscribe(sessionID string, conn Conn) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-	if subs, ok := r.subscribers[sessionID]; ok {
-		delete(subs, conn)
-		if len(subs) == 0 {
-			delete(r.subscribers, sessionID)
-		}
+	if !r.dropLocked(sessionID, conn) {
+		r.mu.Unlock()
+		return
 	}
+	notify := r.presenceLocked(sessionID)
+	r.mu.Unlock()
+	notify()
 }
 
 // UnsubscribeConn removes a connection from all session subscriber sets.
 func (r *Registry) UnsubscribeConn(conn Conn) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-	for sessionID, subs := range r.subscribers {
-		delete(subs, conn)
-		if len(subs) == 0 {
-			delete(r.subscribers, sessionID)
+	var notifies []func()
+	for sessionID := range r.subscribers {
+		if r.dropLocked(sessionID, conn) {
+			notifies = append(notifies, r.presenceLocked(sessionID))
 		}
 	}
+	r.mu.Unlock()
+	for _, notify := range notifies {
+		notify()
+	}
 }
 
-// Broadcast delivers a pre-encoded JSON-RPC notification to all subscribers.
+// dropLocked removes conn from a session, releasing its input lock.
+func (r *Registry) dropLocked(sessionID string, conn Conn) bool {
+	subs, ok := r.subscribers[sessionID]
+	if !ok {
+		return false
+	}
+	if _, ok := subs[conn]; !ok {
+		return false
+	}
+	delete(subs, conn)
+	if len(subs) == 0 {
+		delete(r.subscribers, sessionID)
+	}
+	if r.locks[sessionID] == conn {
+		delete(r.locks, sessionID)
+	}
+	return true
+}
+
+// Tap registers fn to receive every notification broadcast for sessionID.
+// Unlike subscribers, taps are not participants: they are not listed in
+// presence and cannot write. fn runs on the broadcasting goroutine and must
+// not block. The returned func removes the tap.
+func (r *Registry) Tap(sessionID string, fn func(encoded []byte)) (func(), bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[sessionID]; !ok {
+		return nil, false
+	}
+	t := &tap{fn: fn}
+	if r.taps[sessionID] == nil {
+		r.taps[sessionID] = make(map[*tap]struct{})
+	}
+	r.taps[sessionID][t] = struct{}{}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.taps[sessionID], t)
+		if len(r.taps[sessionID]) == 0 {
+			delete(r.taps, sessionID)
+		}
+	}, true
+}
+
+// Broadcast delivers a pre-encoded JSON-RPC notification to all subscribers
+// and taps.
 func (r *Registry) Broadcast(sessionID string, encoded []byte) {
 	r.mu.RLock()
 	subs := r.subscribers[sessionID]
@@ -105,10 +185,17 @@ func (r *Registry) Broadcast(sessionID string, encoded []byte) {
 	for conn := range subs {
 		targets = append(targets, conn)
 	}
+	taps := make([]*tap, 0, len(r.taps[sessionID]))
+	for t := range r.taps[sessionID] {
+		taps = append(taps, t)
+	}
 	r.mu.RUnlock()
 	for _, conn := range targets {
 		conn.Enqueue(encoded)
 	}
+	for _, t := range taps {
+		t.fn(encoded)
+	}
 }
 
 // Get retrieves a session by ID
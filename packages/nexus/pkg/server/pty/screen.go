@@ -0,0 +1,431 @@
+package pty
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Screen is a small VT100/xterm emulator that keeps the visible text of a
+// terminal so it can be read back as it would be rendered. Colors and other
+// attributes are ignored and every character takes one cell.
+type Screen struct {
+	cols, rows int
+	cells      [][]rune
+	x, y       int
+	// wrap is set after writing to the last column; the next printable
+	// character wraps to the next line first.
+	wrap        bool
+	top, bottom int
+	savedX      int
+	savedY      int
+
+	main *savedScreen
+
+	state   parserState
+	params  []byte
+	pending []byte
+}
+
+type savedScreen struct {
+	cells [][]rune
+	x, y  int
+}
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateString
+	stateStringEscape
+)
+
+func NewScreen(cols, rows int) *Screen {
+	if cols <= 0 {
+		cols = 80
+	}
+	if rows <= 0 {
+		rows = 24
+	}
+	s := &Screen{cols: cols, rows: rows, bottom: rows - 1}
+	s.cells = blankCells(cols, rows)
+	return s
+}
+
+func blankCells(cols, rows int) [][]rune {
+	cells := make([][]rune, rows)
+	for i := range cells {
+		cells[i] = blankLine(cols)
+	}
+	return cells
+}
+
+func blankLine(cols int) []rune {
+	line := make([]rune, cols)
+	for i := range line {
+		line[i] = ' '
+	}
+	return line
+}
+
+// Lines returns the screen rows with trailing spaces removed.
+func (s *Screen) Lines() []string {
+	out := make([]string, s.rows)
+	for i, line := range s.cells {
+		out[i] = strings.TrimRight(string(line), " ")
+	}
+	return out
+}
+
+// Text returns the screen as newline-separated rows without trailing blank
+// rows.
+func (s *Screen) Text() string {
+	lines := s.Lines()
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	return strings.Join(lines[:end], "\n")
+}
+
+// Cursor returns the zero-based cursor row and column.
+func (s *Screen) Cursor() (int, int) { return s.y, s.x }
+
+// AltScreen reports whether a full-screen program switched to the
+// alternate buffer.
+func (s *Screen) AltScreen() bool { return s.main != nil }
+
+// Resize changes the screen size, keeping the top-left content.
+func (s *Screen) Resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 || (cols == s.cols && rows == s.rows) {
+		return
+	}
+	cells := blankCells(cols, rows)
+	// Keep the bottom rows, where the cursor usually is.
+	shift := max(0, s.y-(rows-1))
+	for y := 0; y < rows && y+shift < s.rows; y++ {
+		copy(cells[y], s.cells[y+shift])
+	}
+	s.cells, s.cols, s.rows = cells, cols, rows
+	s.y -= shift
+	s.x = min(s.x, cols-1)
+	s.y = min(s.y, rows-1)
+	s.top, s.bottom = 0, rows-1
+	s.wrap = false
+	if s.main != nil {
+		s.main = &savedScreen{cells: blankCells(cols, rows)}
+	}
+}
+
+// Write feeds terminal output to the emulator.
+func (s *Screen) Write(p []byte) (int, error) {
+	data := p
+	if len(s.pending) > 0 {
+		data = append(s.pending, p...)
+		s.pending = nil
+	}
+	for len(data) > 0 {
+		b := data[0]
+		if b >= utf8.RuneSelf && s.state == stateGround {
+			if !utf8.FullRune(data) {
+				s.pending = append([]byte(nil), data...)
+				break
+			}
+			r, size := utf8.DecodeRune(data)
+			s.print(r)
+			data = data[size:]
+			continue
+		}
+		s.feed(b)
+		data = data[1:]
+	}
+	return len(p), nil
+}
+
+func (s *Screen) feed(b byte) {
+	switch s.state {
+	case stateEscape:
+		s.escape(b)
+		return
+	case stateEscapeIntermediate:
+		// Charset designation and similar: one final byte follows.
+		s.state = stateGround
+		return
+	case stateCSI:
+		if b >= 0x40 && b <= 0x7e {
+			s.csi(b)
+			s.state = stateGround
+			return
+		}
+		if b == 0x1b {
+			s.state = stateEscape
+			return
+		}
+		if b >= 0x20 {
+			s.params = append(s.params, b)
+			return
+		}
+	case stateString:
+		switch b {
+		case 0x07:
+			s.state = stateGround
+		case 0x1b:
+			s.state = stateStringEscape
+		}
+		return
+	case stateStringEscape:
+		// ESC \ ends the string; anything else keeps skipping it.
+		if b == '\\' {
+			s.state = stateGround
+		} else {
+			s.state = stateString
+		}
+		return
+	}
+	s.control(b)
+}
+
+func (s *Screen) control(b byte) {
+	switch b {
+	case 0x1b:
+		s.state = stateEscape
+	case '\r':
+		s.x, s.wrap = 0, false
+	case '\n', 0x0b, 0x0c:
+		s.lineFeed()
+	case '\b':
+		if s.x > 0 {
+			s.x--
+		}
+		s.wrap = false
+	case '\t':
+		s.x = min(s.cols-1, (s.x/8+1)*8)
+	case 0x07, 0x00, 0x0e, 0x0f:
+	default:
+		if b >= 0x20 && b != 0x7f {
+			s.print(rune(b))
+		}
+	}
+}
+
+func (s *Screen) escape(b byte) {
+	s.state = stateGround
+	switch b {
+	case '[':
+		s.state = stateCSI
+		s.params = s.params[:0]
+	case ']', 'P', '_', '^', 'X':
+		s.state = stateString
+	case '(', ')', '*', '+', '#', '%':
+		s.state = stateEscapeIntermediate
+	case '7':
+		s.savedX, s.savedY = s.x, s.y
+	case '8':
+		s.x, s.y, s.wrap = s.savedX, s.savedY, false
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.x = 0
+		s.lineFeed()
+	case 'M':
+		if s.y == s.top {
+			s.scrollDown(1)
+		} else if s.y > 0 {
+			s.y--
+		}
+	case 'c':
+		*s = *NewScreen(s.cols, s.rows)
+	}
+}
+
+func (s *Screen) print(r rune) {
+	if s.wrap {
+		s.x = 0
+		s.lineFeed()
+	}
+	s.cells[s.y][s.x] = r
+	if s.x == s.cols-1 {
+		s.wrap = true
+	} else {
+		s.x++
+	}
+}
+
+func (s *Screen) lineFeed() {
+	s.wrap = false
+	if s.y == s.bottom {
+		s.scrollUp(1)
+		return
+	}
+	if s.y < s.rows-1 {
+		s.y++
+	}
+}
+
+// scrollUp moves the scroll region up by n lines.
+func (s *Screen) scrollUp(n int) {
+	n = min(n, s.bottom-s.top+1)
+	copy(s.cells[s.top:s.bottom+1], s.cells[s.top+n:s.bottom+1])
+	for i := s.bottom - n + 1; i <= s.bottom; i++ {
+		s.cells[i] = blankLine(s.cols)
+	}
+}
+
+// scrollDown moves the scroll region down by n lines.
+func (s *Screen) scrollDown(n int) {
+	n = min(n, s.bottom-s.top+1)
+	copy(s.cells[s.top+n:s.bottom+1], s.cells[s.top:s.bottom+1-n])
+	for i := s.top; i < s.top+n; i++ {
+		s.cells[i] = blankLine(s.cols)
+	}
+}
+
+func (s *Screen) csi(final byte) {
+	private := len(s.params) > 0 && (s.params[0] == '?' || s.params[0] == '>' || s.params[0] == '=')
+	raw := string(s.params)
+	if private {
+		raw = raw[1:]
+	}
+	var args []int
+	for _, part := range strings.Split(raw, ";") {
+		n, _ := strconv.Atoi(part)
+		args = append(args, n)
+	}
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+	if private {
+		if final == 'h' || final == 'l' {
+			for _, mode := range args {
+				if mode == 1049 || mode == 1047 || mode == 47 {
+					s.altScreen(final == 'h')
+				}
+			}
+		}
+		return
+	}
+
+	s.wrap = false
+	switch final {
+	case 'A':
+		s.y = max(s.top, s.y-arg(0, 1))
+	case 'B', 'e':
+		s.y = min(s.bottom, s.y+arg(0, 1))
+	case 'C', 'a':
+		s.x = min(s.cols-1, s.x+arg(0, 1))
+	case 'D':
+		s.x = max(0, s.x-arg(0, 1))
+	case 'E':
+		s.y, s.x = min(s.bottom, s.y+arg(0, 1)), 0
+	case 'F':
+		s.y, s.x = max(s.top, s.y-arg(0, 1)), 0
+	case 'G', '`':
+		s.x = min(s.cols-1, arg(0, 1)-1)
+	case 'd':
+		s.y = min(s.rows-1, arg(0, 1)-1)
+	case 'H', 'f':
+		s.y = min(s.rows-1, arg(0, 1)-1)
+		s.x = min(s.cols-1, arg(1, 1)-1)
+	case 'J':
+		s.eraseDisplay(arg(0, 0))
+	case 'K':
+		s.eraseLine(arg(0, 0))
+	case 'L':
+		if s.y >= s.top && s.y <= s.bottom {
+			top := s.top
+			s.top = s.y
+			s.scrollDown(arg(0, 1))
+			s.top = top
+		}
+	case 'M':
+		if s.y >= s.top && s.y <= s.bottom {
+			top := s.top
+			s.top = s.y
+			s.scrollUp(arg(0, 1))
+			s.top = top
+		}
+	case '@':
+		n := min(arg(0, 1), s.cols-s.x)
+		line := s.cells[s.y]
+		copy(line[s.x+n:], line[s.x:s.cols-n])
+		for i := s.x; i < s.x+n; i++ {
+			line[i] = ' '
+		}
+	case 'P':
+		n := min(arg(0, 1), s.cols-s.x)
+		line := s.cells[s.y]
+		copy(line[s.x:], line[s.x+n:])
+		for i := s.cols - n; i < s.cols; i++ {
+			line[i] = ' '
+		}
+	case 'X':
+		for i := s.x; i < min(s.cols, s.x+arg(0, 1)); i++ {
+			s.cells[s.y][i] = ' '
+		}
+	case 'S':
+		s.scrollUp(arg(0, 1))
+	case 'T':
+		s.scrollDown(arg(0, 1))
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.x, s.y = 0, 0
+		}
+	case 's':
+		s.savedX, s.savedY = s.x, s.y
+	case 'u':
+		s.x, s.y = s.savedX, s.savedY
+	}
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for y := s.y + 1; y < s.rows; y++ {
+			s.cells[y] = blankLine(s.cols)
+		}
+	case 1:
+		s.eraseLine(1)
+		for y := 0; y < s.y; y++ {
+			s.cells[y] = blankLine(s.cols)
+		}
+	case 2, 3:
+		s.cells = blankCells(s.cols, s.rows)
+	}
+}
+
+func (s *Screen) eraseLine(mode int) {
+	line := s.cells[s.y]
+	from, to := s.x, s.cols
+	switch mode {
+	case 1:
+		from, to = 0, s.x+1
+	case 2:
+		from = 0
+	}
+	for i := from; i < min(to, s.cols); i++ {
+		line[i] = ' '
+	}
+}
+
+func (s *Screen) altScreen(on bool) {
+	if on == (s.main != nil) {
+		return
+	}
+	if on {
+		s.main = &savedScreen{cells: s.cells, x: s.x, y: s.y}
+		s.cells = blankCells(s.cols, s.rows)
+		return
+	}
+	s.cells, s.x, s.y = s.main.cells, s.main.x, s.main.y
+	s.main = nil
+	s.wrap = false
+}
@@ -0,0 +1,58 @@
+package pty
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScreenScrollsAndWraps(t *testing.T) {
+	s := NewScreen(5, 3)
+	_, _ = s.Write([]byte("1\r\n2\r\n3\r\nabcdefg"))
+	if got := s.Text(); got != "3\nabcde\nfg" {
+		t.Fatalf("unexpected text %q", got)
+	}
+	if row, col := s.Cursor(); row != 2 || col != 2 {
+		t.Fatalf("unexpected cursor %d,%d", row, col)
+	}
+}
+
+func TestScreenEditsLine(t *testing.T) {
+	s := NewScreen(10, 2)
+	_, _ = s.Write([]byte("hello\x1b[3D\x1b[K\x1b[1@p\b\bX"))
+	if got := s.Lines()[0]; got != "hXp" {
+		t.Fatalf("unexpected line %q", got)
+	}
+}
+
+func TestScreenAltScreenRestoresMain(t *testing.T) {
+	s := NewScreen(10, 3)
+	_, _ = s.Write([]byte("$ vim\r\n"))
+	_, _ = s.Write([]byte("\x1b[?1049h\x1b[H~ editing"))
+	if !s.AltScreen() || s.Text() != "~ editing" {
+		t.Fatalf("unexpected alt screen %q", s.Text())
+	}
+	_, _ = s.Write([]byte("\x1b[?1049l"))
+	if s.AltScreen() || s.Text() != "$ vim" {
+		t.Fatalf("unexpected main screen %q", s.Text())
+	}
+}
+
+func TestScreenSkipsStringsAndSplitsRunes(t *testing.T) {
+	s := NewScreen(10, 2)
+	euro := []byte("€")
+	_, _ = s.Write([]byte("\x1b]0;title\x07a"))
+	_, _ = s.Write(euro[:1])
+	_, _ = s.Write(euro[1:])
+	_, _ = s.Write([]byte("\x1b(Bb"))
+	if got := s.Lines()[0]; got != "a€b" {
+		t.Fatalf("unexpected line %q", got)
+	}
+}
+
+func TestScreenScrollRegion(t *testing.T) {
+	s := NewScreen(4, 4)
+	_, _ = s.Write([]byte("a\r\nb\r\nc\r\nd\x1b[2;3r\x1b[3;1H\n"))
+	if got := strings.Join(s.Lines(), "|"); got != "a|c||d" {
+		t.Fatalf("unexpected lines %q", got)
+	}
+}
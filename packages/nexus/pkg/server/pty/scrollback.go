@@ -0,0 +1,133 @@
+package pty
+
+import (
+	"encoding/json"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultScrollbackBytes is the output kept per session when neither
+// pty.open nor the workspace config sizes it.
+const DefaultScrollbackBytes = 256 << 10
+
+// Scrollback keeps the most recent output of a session for replay on
+// pty.attach. Output is numbered by byte offset: the seq of a pty.data
+// notification is the total number of bytes produced up to and including
+// that chunk, so a client that saw seq N can resume from N.
+type Scrollback struct {
+	mu   sync.Mutex
+	size int
+	// buf grows to size and is then written around, oldest byte at next.
+	buf  []byte
+	next int
+	seq  uint64
+}
+
+func NewScrollback(size int) *Scrollback {
+	if size <= 0 {
+		size = DefaultScrollbackBytes
+	}
+	return &Scrollback{size: size}
+}
+
+// appendLocked adds p and returns the seq after it.
+func (b *Scrollback) appendLocked(p []byte) uint64 {
+	b.seq += uint64(len(p))
+	if len(p) > b.size {
+		p = p[len(p)-b.size:]
+	}
+	if room := b.size - len(b.buf); room > 0 {
+		n := min(room, len(p))
+		b.buf = append(b.buf, p[:n]...)
+		p = p[n:]
+	}
+	for len(p) > 0 {
+		n := copy(b.buf[b.next:], p)
+		p = p[n:]
+		b.next = (b.next + n) % b.size
+	}
+	return b.seq
+}
+
+// sinceLocked returns the kept output after seq and whether output between
+// seq and the oldest kept byte was lost. Truncated output starts on the
+// first rune boundary kept.
+func (b *Scrollback) sinceLocked(seq uint64) ([]byte, bool) {
+	if seq >= b.seq {
+		return nil, false
+	}
+	// In order the kept output is buf[next:] followed by buf[:next].
+	older, newer := b.buf[b.next:], b.buf[:b.next]
+	oldest := b.seq - uint64(len(b.buf))
+	skip, truncated := 0, seq < oldest
+	if truncated {
+		for skip < len(b.buf) && !utf8.RuneStart(b.buf[(b.next+skip)%len(b.buf)]) {
+			skip++
+		}
+	} else {
+		skip = int(seq - oldest)
+	}
+	if skip >= len(older) {
+		return append([]byte(nil), newer[skip-len(older):]...), truncated
+	}
+	out := make([]byte, 0, len(b.buf)-skip)
+	out = append(out, older[skip:]...)
+	return append(out, newer...), truncated
+}
+
+// publishOutput adds data to the scrollback and recording and broadcasts it
+// as pty.data. The scrollback lock is held while broadcasting so an attach
+// sees every chunk exactly once, either in its replay or live.
+func publishOutput(conn Conn, registry *Registry, session *Session, data string) {
+	session.Recorder.Output(data)
+	params := map[string]any{"sessionId": session.ID, "data": data}
+	if sb := session.Scrollback; sb != nil {
+		sb.mu.Lock()
+		defer sb.mu.Unlock()
+		params["seq"] = sb.appendLocked([]byte(data))
+	}
+	encoded, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "pty.data",
+		"params":  params,
+	})
+	if err != nil {
+		return
+	}
+	if registry != nil {
+		registry.Broadcast(session.ID, encoded)
+	} else if conn != nil {
+		conn.Enqueue(encoded)
+	}
+}
+
+// attachWithReplay subscribes conn to session after queueing the output it
+// missed since seq as a replay pty.data notification. It returns the seq
+// the replay ends at and whether older output had already been dropped.
+func attachWithReplay(conn Conn, registry *Registry, session *Session, seq uint64, role string) (uint64, bool) {
+	sb := session.Scrollback
+	if sb == nil {
+		registry.SubscribeAs(session.ID, conn, role)
+		return 0, false
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	replay, truncated := sb.sinceLocked(seq)
+	if len(replay) > 0 {
+		encoded, err := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"method":  "pty.data",
+			"params": map[string]any{
+				"sessionId": session.ID,
+				"data":      string(replay),
+				"seq":       sb.seq,
+				"replay":    true,
+			},
+		})
+		if err == nil {
+			conn.Enqueue(encoded)
+		}
+	}
+	registry.SubscribeAs(session.ID, conn, role)
+	return sb.seq, truncated
+}
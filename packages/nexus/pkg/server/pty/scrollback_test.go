@@ -0,0 +1,130 @@
+package pty
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type dataNotification struct {
+	Data   string `json:"data"`
+	Seq    uint64 `json:"seq"`
+	Replay bool   `json:"replay"`
+}
+
+func (c *testConn) dataNotifications(t *testing.T) []dataNotification {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []dataNotification
+	for _, raw := range c.queued {
+		var msg struct {
+			Method string           `json:"method"`
+			Params dataNotification `json:"params"`
+		}
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			t.Fatalf("decode notification: %v", err)
+		}
+		if msg.Method == "pty.data" {
+			out = append(out, msg.Params)
+		}
+	}
+	return out
+}
+
+func TestScrollbackKeepsMostRecentOutput(t *testing.T) {
+	sb := NewScrollback(8)
+	sb.appendLocked([]byte("hello "))
+	if seq := sb.appendLocked([]byte("world")); seq != 11 {
+		t.Fatalf("expected seq 11, got %d", seq)
+	}
+	if data, truncated := sb.sinceLocked(0); string(data) != "lo world" || !truncated {
+		t.Fatalf("since 0: got %q truncated=%v", data, truncated)
+	}
+	if data, truncated := sb.sinceLocked(6); string(data) != "world" || truncated {
+		t.Fatalf("since 6: got %q truncated=%v", data, truncated)
+	}
+	if data, _ := sb.sinceLocked(11); len(data) != 0 {
+		t.Fatalf("since current seq: expected nothing, got %q", data)
+	}
+}
+
+func TestScrollbackWrapsAroundInPlace(t *testing.T) {
+	sb := NewScrollback(8)
+	var want []byte
+	for i := 0; i < 50; i++ {
+		chunk := []byte{byte('a' + i%26), byte('A' + i%26), '-'}
+		sb.appendLocked(chunk)
+		want = append(want, chunk...)
+	}
+	if len(sb.buf) != 8 || cap(sb.buf) > 16 {
+		t.Fatalf("expected a fixed buffer, got len %d cap %d", len(sb.buf), cap(sb.buf))
+	}
+	if data, truncated := sb.sinceLocked(0); string(data) != string(want[len(want)-8:]) || !truncated {
+		t.Fatalf("since 0: got %q truncated=%v", data, truncated)
+	}
+	if data, _ := sb.sinceLocked(sb.seq - 3); string(data) != string(want[len(want)-3:]) {
+		t.Fatalf("since seq-3: got %q", data)
+	}
+	sb.appendLocked([]byte("0123456789"))
+	if data, _ := sb.sinceLocked(0); string(data) != "23456789" {
+		t.Fatalf("expected an oversized chunk to keep its tail, got %q", data)
+	}
+}
+
+func TestScrollbackTrimsOnRuneBoundary(t *testing.T) {
+	sb := NewScrollback(4)
+	sb.appendLocked([]byte("aé€"))
+	if data, _ := sb.sinceLocked(0); string(data) != "€" {
+		t.Fatalf("expected trimmed output to start on a rune, got %q", data)
+	}
+}
+
+func TestHandleAttachReplaysMissedOutputThenStreams(t *testing.T) {
+	registry := NewRegistry()
+	session := &Session{ID: "pty-1", WorkspaceID: "ws-1", Scrollback: NewScrollback(0)}
+	registry.Register(session)
+	deps := &Deps{Registry: registry}
+
+	first := newTestConn()
+	registry.Subscribe(session.ID, first)
+	publishOutput(nil, registry, session, "one\n")
+	publishOutput(nil, registry, session, "two\n")
+	seen := first.dataNotifications(t)
+	if len(seen) != 2 || seen[0].Seq != 4 || seen[1].Seq != 8 {
+		t.Fatalf("expected seq numbers on live output, got %+v", seen)
+	}
+	registry.UnsubscribeConn(first)
+	publishOutput(nil, registry, session, "three\n")
+
+	second := newTestConn()
+	params, _ := json.Marshal(AttachParams{SessionID: session.ID, Since: seen[0].Seq})
+	res, rpcErr := HandleAttach(deps, params, second)
+	if rpcErr != nil {
+		t.Fatalf("attach: %v", rpcErr)
+	}
+	attached := res.(*AttachResult)
+	if !attached.Attached || attached.Seq != 14 || attached.Truncated {
+		t.Fatalf("unexpected attach result %+v", attached)
+	}
+	publishOutput(nil, registry, session, "four\n")
+
+	got := second.dataNotifications(t)
+	if len(got) != 2 {
+		t.Fatalf("expected replay then live output, got %+v", got)
+	}
+	if !got[0].Replay || got[0].Data != "two\nthree\n" || got[0].Seq != 14 {
+		t.Fatalf("unexpected replay %+v", got[0])
+	}
+	if got[1].Replay || got[1].Data != "four\n" || got[1].Seq != 19 {
+		t.Fatalf("unexpected live output %+v", got[1])
+	}
+}
+
+func TestScrollbackSizeUsesRequestThenDefault(t *testing.T) {
+	if got := scrollbackSize(&Deps{}, 0, "ws-1"); got != DefaultScrollbackBytes {
+		t.Fatalf("expected default size, got %d", got)
+	}
+	if got := scrollbackSize(&Deps{}, 1024, "ws-1"); got != 1024 {
+		t.Fatalf("expected requested size, got %d", got)
+	}
+}
@@ -23,6 +23,12 @@ type SessionInfo struct {
 	IsRemote    bool      `json:"isRemote"`
 	IsTmux      bool      `json:"isTmux"`
 	TmuxSession string    `json:"tmuxSession,omitempty"`
+	Recording   bool      `json:"recording,omitempty"`
+	// RecordingInput is set when the recording also captures input.
+	RecordingInput bool `json:"recordingInput,omitempty"`
+	// Persistent sessions run in a guest shell that survives daemon
+	// restarts without tmux.
+	Persistent bool `json:"persistent,omitempty"`
 }
 
 type Session struct {
@@ -46,21 +52,47 @@ type Session struct {
 	// Tmux support
 	IsTmux      bool
 	TmuxSession string // tmux session name if using tmux
+	// Recorder is nil unless the session is recorded.
+	Recorder *Recorder
+	// Scrollback keeps recent output for replay on attach.
+	Scrollback *Scrollback
+	// Persistent is set for guest shells that survive daemon restarts.
+	Persistent bool
+
+	// screen renders output for pty.snapshot. It is started on first use.
+	screenOnce sync.Once
+	screenMu   sync.Mutex
+	screen     *Screen
+	screenSeq  uint64
 }
 
 // Info returns a serializable snapshot of session metadata
 func (s *Session) Info() SessionInfo {
 	return SessionInfo{
-		ID:          s.ID,
-		WorkspaceID: s.WorkspaceID,
-		Name:        s.Name,
-		Shell:       s.Shell,
-		WorkDir:     s.WorkDir,
-		Cols:        s.Cols,
-		Rows:        s.Rows,
-		CreatedAt:   s.CreatedAt,
-		IsRemote:    s.Remote,
-		IsTmux:      s.IsTmux,
-		TmuxSession: s.TmuxSession,
+		ID:             s.ID,
+		WorkspaceID:    s.WorkspaceID,
+		Name:           s.Name,
+		Shell:          s.Shell,
+		WorkDir:        s.WorkDir,
+		Cols:           s.Cols,
+		Rows:           s.Rows,
+		CreatedAt:      s.CreatedAt,
+		IsRemote:       s.Remote,
+		IsTmux:         s.IsTmux,
+		TmuxSession:    s.TmuxSession,
+		Recording:      s.Recorder != nil,
+		RecordingInput: s.Recorder.RecordsInput(),
+		Persistent:     s.Persistent,
+	}
+}
+
+// resized records a new terminal size applied to the session's shell.
+func (s *Session) resized(cols, rows int) {
+	s.Cols, s.Rows = cols, rows
+	s.Recorder.Resize(cols, rows)
+	s.screenMu.Lock()
+	if s.screen != nil {
+		s.screen.Resize(cols, rows)
 	}
+	s.screenMu.Unlock()
 }
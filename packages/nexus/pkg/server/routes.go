@@ -23,9 +23,9 @@ func (s *Server) Start() error {
 		}
 	}
 
-	mux := s.routes()
+	handler := s.withWorkspaceProxy(s.routes())
 	addr := fmt.Sprintf(":%d", s.port)
-	return http.ListenAndServe(addr, mux)
+	return http.ListenAndServe(addr, handler)
 }
 
 func (s *Server) routes() *http.ServeMux {
@@ -62,6 +62,7 @@ func (s *Server) routes() *http.ServeMux {
 			mux.Handle("/@vite/", proxy)
 			mux.Handle("/@fs/", proxy)
 			mux.Handle("/node_modules/", proxy)
+			mux.HandleFunc("/portal/workspaces/", s.handleWorkspacePortsPage)
 			mux.HandleFunc("/portal/", s.handlePortalUI)
 			mux.HandleFunc("/portal", s.handlePortalUI)
 			mux.HandleFunc("/", s.handleWebSocket)
@@ -79,6 +80,7 @@ func (s *Server) routes() *http.ServeMux {
 	} else if staticDist, staticErr := fs.Sub(portal.FS, "static"); staticErr == nil {
 		mux.Handle("/ui/static/", http.StripPrefix("/ui/static/", http.FileServer(http.FS(staticDist))))
 	}
+	mux.HandleFunc("/portal/workspaces/", s.handleWorkspacePortsPage)
 	mux.HandleFunc("/portal/", s.handlePortalUI)
 	mux.HandleFunc("/portal", s.handlePortalUI)
 	mux.HandleFunc("/ui/", s.handlePortalUI)
@@ -3,11 +3,21 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/inizio/nexus/packages/nexus/pkg/compose"
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+	"github.com/inizio/nexus/packages/nexus/pkg/filesearch"
 	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	"github.com/inizio/nexus/packages/nexus/pkg/lifecycle"
+	"github.com/inizio/nexus/packages/nexus/pkg/projectmgr"
 	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
 	"github.com/inizio/nexus/packages/nexus/pkg/server/pty"
 	"github.com/inizio/nexus/packages/nexus/pkg/server/rpc"
+	"github.com/inizio/nexus/packages/nexus/pkg/spotlight"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
 )
 
 func (s *Server) newRPCRegistry() *rpc.Registry {
@@ -41,6 +51,157 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 		ws := s.resolveWorkspaceTyped(req)
 		return handlers.HandleStat(ctx, req, ws)
 	})
+	rpc.TypedRegister(r, "fs.chmod", func(ctx context.Context, req handlers.ChmodParams) (*handlers.WriteFileResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleChmod(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "fs.rename", func(ctx context.Context, req handlers.RenameParams) (*handlers.WriteFileResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleRename(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "fs.symlink", func(ctx context.Context, req handlers.SymlinkParams) (*handlers.WriteFileResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleSymlink(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "fs.readlink", func(ctx context.Context, req handlers.ReadlinkParams) (*handlers.ReadlinkResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleReadlink(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "fs.copy", func(ctx context.Context, req handlers.CopyParams) (*handlers.CopyResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleCopy(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "fs.applyPatch", func(ctx context.Context, req handlers.ApplyPatchParams) (*handlers.ApplyPatchResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleApplyPatch(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "fs.find", func(ctx context.Context, req handlers.FindParams) (*handlers.FindResult, *rpckit.RPCError) {
+		return s.findFiles(ctx, req)
+	})
+	r.Register("fs.grep", func(ctx context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.GrepParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		if !req.Stream {
+			return s.grepFiles(ctx, req, nil)
+		}
+		c, ok := conn.(*Connection)
+		if !ok {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "stream requires a streaming connection"}
+		}
+		if rpcErr := handlers.ValidateGrep(req); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return &handlers.GrepResult{Matches: []filesearch.GrepMatch{}, Path: req.Path, StreamID: s.streamGrep(c, req)}, nil
+	})
+	r.Register("fs.grep.stop", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req struct {
+			StreamID string `json:"streamId"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil || req.StreamID == "" {
+			return nil, rpckit.ErrInvalidParams
+		}
+		c, ok := conn.(*Connection)
+		if !ok || !c.stopStream(req.StreamID) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		return map[string]any{"stopped": true}, nil
+	})
+	r.Register("fs.watch", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.WatchParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		c, ok := conn.(*Connection)
+		if !ok {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "fs.watch requires a streaming connection"}
+		}
+		return s.startWatch(c, req)
+	})
+	r.Register("fs.unwatch", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.UnwatchParams
+		if err := json.Unmarshal(params, &req); err != nil || !strings.HasPrefix(req.WatchID, watchStreamPrefix) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		c, ok := conn.(*Connection)
+		if !ok || !c.stopStream(req.WatchID) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		return map[string]any{"stopped": true}, nil
+	})
+	r.Register("fs.open", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.OpenParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		c, ok := conn.(*Connection)
+		if !ok {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "file handles require a streaming connection"}
+		}
+		return s.openFile(c, req)
+	})
+	r.Register("fs.read", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.ReadParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		f, rpcErr := connFile(conn, req.Handle)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return handlers.ReadChunk(f, req)
+	})
+	r.Register("fs.write", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.WriteParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		f, rpcErr := connFile(conn, req.Handle)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return handlers.WriteChunk(f, req)
+	})
+	r.Register("fs.close", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.CloseParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		c, ok := conn.(*Connection)
+		if !ok || !c.closeFile(req.Handle) {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "unknown file handle"}
+		}
+		return map[string]any{"closed": true}, nil
+	})
+	r.Register("fs.tail", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.TailParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		c, ok := conn.(*Connection)
+		if !ok {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "fs.tail requires a streaming connection"}
+		}
+		streamID, rpcErr := s.startTail(c, req)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return map[string]any{"streamId": streamID}, nil
+	})
+	r.Register("fs.tail.stop", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req struct {
+			StreamID string `json:"streamId"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil || !strings.HasPrefix(req.StreamID, tailStreamPrefix) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		c, ok := conn.(*Connection)
+		if !ok || !c.stopStream(req.StreamID) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		return map[string]any{"stopped": true}, nil
+	})
 	rpc.TypedRegister(r, "exec", func(ctx context.Context, req handlers.ExecParams) (*handlers.ExecResult, *rpckit.RPCError) {
 		ws := s.resolveWorkspaceTyped(req)
 		return handlers.HandleExecWithAuthRelay(ctx, req, ws, s.authRelayBroker)
@@ -53,10 +214,45 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 	})
 	rpc.TypedRegister(r, "workspace.info", func(_ context.Context, req handlers.WorkspaceInfoParams) (map[string]interface{}, *rpckit.RPCError) {
 		wid := handlers.WorkspaceInfoWorkspaceID(req)
-		return handlers.HandleWorkspaceInfo(wid, s.ws, s.workspaceMgr, s.spotlightMgr), nil
+		info := handlers.HandleWorkspaceInfo(wid, s.ws, s.workspaceMgr, s.spotlightMgr)
+		if ws, ok := info["workspace"].(*workspacemgr.Workspace); ok {
+			info["shares"] = s.shareMgr.List(ws.ID)
+			if s.personal != nil {
+				if st, ok := s.personal.status(ws.ID); ok {
+					info["personal"] = st
+				}
+			}
+		} else {
+			info["shares"] = s.shareMgr.List("")
+		}
+		return info, nil
 	})
 	rpc.TypedRegister(r, "workspace.create", func(ctx context.Context, req handlers.WorkspaceCreateParams) (*handlers.WorkspaceCreateResult, *rpckit.RPCError) {
-		return handlers.HandleWorkspaceCreateWithProjects(ctx, req, s.workspaceMgr, s.projectMgr, s.runtimeFactory)
+		result, rpcErr := handlers.HandleWorkspaceCreateWithProjects(ctx, req, s.workspaceMgr, s.projectMgr, s.runtimeFactory)
+		if rpcErr != nil || result == nil || result.Workspace == nil {
+			return result, rpcErr
+		}
+		if result.Template != nil {
+			result.TemplateHooks = s.runTemplateSetupHooks(ctx, result.Workspace, result.Template)
+			if result.Workspace.State == workspacemgr.StateRunning && templateHooksPassed(result.TemplateHooks) {
+				result.TemplateServices = s.startTemplateServices(ctx, result.Workspace.ID, result.Template)
+			}
+		}
+		stages := []string{lifecycle.StageOnCreate}
+		if result.Workspace.State == workspacemgr.StateRunning {
+			// A failed personal layer is retried on the next workspace.start.
+			s.startPersonalLayer(result.Workspace.ID)
+			stages = append(stages, lifecycle.StagePostStart)
+		}
+		for _, stage := range stages {
+			hooks, err := s.runWorkspaceHooks(ctx, result.Workspace.ID, stage)
+			result.Hooks = append(result.Hooks, hooks...)
+			if err != nil {
+				s.discardWorkspace(ctx, result.Workspace.ID)
+				return nil, hookRPCError(err, result.Hooks)
+			}
+		}
+		return result, nil
 	})
 	rpc.TypedRegister(r, "daemon.settings.get", func(ctx context.Context, req handlers.DaemonSettingsGetParams) (*handlers.DaemonSettingsGetResult, *rpckit.RPCError) {
 		return handlers.HandleDaemonSettingsGet(ctx, req, s.workspaceMgr.SandboxResourceSettingsRepository())
@@ -95,13 +291,26 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 		return handlers.HandleWorkspaceRelationsList(ctx, req, s.workspaceMgr)
 	})
 	rpc.TypedRegister(r, "workspace.remove", func(ctx context.Context, req handlers.WorkspaceRemoveParams) (*handlers.WorkspaceRemoveResult, *rpckit.RPCError) {
+		if hooks, err := s.runWorkspaceHooks(ctx, req.ID, lifecycle.StagePreRemove); err != nil {
+			return nil, hookRPCError(err, hooks)
+		}
 		result, rpcErr := handlers.HandleWorkspaceRemove(ctx, req, s.workspaceMgr, s.runtimeFactory)
 		if rpcErr == nil {
+			s.shareMgr.RevokeWorkspace(req.ID)
 			s.StopWorkspaceTunnels(req.ID)
+			s.events.forget(req.ID)
+			if s.personal != nil {
+				s.personal.forget(req.ID)
+			}
 		}
 		return result, rpcErr
 	})
 	rpc.TypedRegister(r, "workspace.stop", func(ctx context.Context, req handlers.WorkspaceStopParams) (*handlers.WorkspaceStopResult, *rpckit.RPCError) {
+		if ws, ok := s.workspaceMgr.Get(req.ID); ok && ws.State == workspacemgr.StateRunning {
+			if hooks, err := s.runWorkspaceHooks(ctx, req.ID, lifecycle.StagePreStop); err != nil {
+				return nil, hookRPCError(err, hooks)
+			}
+		}
 		result, rpcErr := handlers.HandleWorkspaceStopWithRuntime(ctx, req, s.workspaceMgr, s.runtimeFactory)
 		if rpcErr == nil {
 			s.StopPortMonitoring(req.ID)
@@ -111,20 +320,79 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 	})
 	rpc.TypedRegister(r, "workspace.start", func(ctx context.Context, req handlers.WorkspaceStartParams) (*handlers.WorkspaceStartResult, *rpckit.RPCError) {
 		result, rpcErr := handlers.HandleWorkspaceStart(ctx, req, s.workspaceMgr, s.runtimeFactory)
-		if rpcErr == nil {
-			_ = s.StartPortMonitoring(req.ID)
+		if rpcErr != nil {
+			return result, rpcErr
 		}
-		return result, rpcErr
+		_ = s.StartPortMonitoring(req.ID)
+		s.startPersonalLayer(req.ID)
+		hooks, err := s.runPostStartHooks(ctx, req.ID)
+		if err != nil {
+			return nil, hookRPCError(err, hooks)
+		}
+		result.Hooks = hooks
+		return result, nil
 	})
 	rpc.TypedRegister(r, "workspace.restore", func(ctx context.Context, req handlers.WorkspaceRestoreParams) (*handlers.WorkspaceRestoreResult, *rpckit.RPCError) {
 		result, rpcErr := handlers.HandleWorkspaceRestore(ctx, req, s.workspaceMgr, s.runtimeFactory)
-		if rpcErr == nil {
-			_ = s.StartPortMonitoring(req.ID)
+		if rpcErr != nil {
+			return result, rpcErr
 		}
-		return result, rpcErr
+		_ = s.StartPortMonitoring(req.ID)
+		s.startPersonalLayer(req.ID)
+		hooks, err := s.runPostStartHooks(ctx, req.ID)
+		if err != nil {
+			return nil, hookRPCError(err, hooks)
+		}
+		result.Hooks = hooks
+		return result, nil
 	})
 	rpc.TypedRegister(r, "workspace.fork", func(ctx context.Context, req handlers.WorkspaceForkParams) (*handlers.WorkspaceForkResult, *rpckit.RPCError) {
-		return handlers.HandleWorkspaceFork(ctx, req, s.workspaceMgr, s.runtimeFactory)
+		result, rpcErr := handlers.HandleWorkspaceFork(ctx, req, s.workspaceMgr, s.runtimeFactory)
+		if rpcErr != nil || result == nil || result.Workspace == nil {
+			return result, rpcErr
+		}
+		hooks, err := s.runForkHooks(ctx, result.Workspace.ID)
+		if err != nil {
+			return nil, hookRPCError(err, hooks)
+		}
+		result.Hooks = hooks
+		return result, nil
+	})
+	rpc.TypedRegister(r, "workspace.events", func(_ context.Context, req struct {
+		WorkspaceID string `json:"workspaceId"`
+		Limit       int    `json:"limit,omitempty"`
+	}) (map[string]any, *rpckit.RPCError) {
+		if _, ok := s.workspaceMgr.Get(req.WorkspaceID); !ok {
+			return nil, rpckit.ErrWorkspaceNotFound
+		}
+		return map[string]any{"events": s.events.list(req.WorkspaceID, req.Limit)}, nil
+	})
+	rpc.TypedRegister(r, "template.list", func(ctx context.Context, req handlers.TemplateListParams) (*handlers.TemplateListResult, *rpckit.RPCError) {
+		return handlers.HandleTemplateList(ctx, req, s.projectMgr)
+	})
+	rpc.TypedRegister(r, "template.get", func(ctx context.Context, req handlers.TemplateGetParams) (*handlers.TemplateGetResult, *rpckit.RPCError) {
+		return handlers.HandleTemplateGet(ctx, req, s.projectMgr)
+	})
+	rpc.TypedRegister(r, "template.save", func(ctx context.Context, req handlers.TemplateSaveParams) (*handlers.TemplateSaveResult, *rpckit.RPCError) {
+		return handlers.HandleTemplateSave(ctx, req, s.projectMgr)
+	})
+	rpc.TypedRegister(r, "template.saveFromWorkspace", func(ctx context.Context, req handlers.TemplateSaveFromWorkspaceParams) (*handlers.TemplateSaveResult, *rpckit.RPCError) {
+		return handlers.HandleTemplateSaveFromWorkspace(ctx, req, s.workspaceMgr, s.projectMgr)
+	})
+	rpc.TypedRegister(r, "workspace.fanout", func(ctx context.Context, req handlers.WorkspaceFanoutParams) (*handlers.WorkspaceFanoutResult, *rpckit.RPCError) {
+		return handlers.HandleWorkspaceFanout(ctx, req, s.workspaceMgr, s.runtimeFactory, s.execInWorkspace, func(ctx context.Context, workspaceID string) error {
+			_, err := s.runForkHooks(ctx, workspaceID)
+			return err
+		})
+	})
+	rpc.TypedRegister(r, "workspace.diff", func(ctx context.Context, req handlers.WorkspaceDiffParams) (*handlers.WorkspaceDiffResult, *rpckit.RPCError) {
+		return handlers.HandleWorkspaceDiff(ctx, req, s.workspaceMgr)
+	})
+	rpc.TypedRegister(r, "workspace.merge", func(ctx context.Context, req handlers.WorkspaceMergeParams) (*handlers.WorkspaceMergeResult, *rpckit.RPCError) {
+		return handlers.HandleWorkspaceMerge(ctx, req, s.workspaceMgr)
+	})
+	rpc.TypedRegister(r, "workspace.publish", func(ctx context.Context, req handlers.WorkspacePublishParams) (*handlers.WorkspacePublishResult, *rpckit.RPCError) {
+		return handlers.HandleWorkspacePublish(ctx, req, s.workspaceMgr, s.authRelayBroker)
 	})
 	rpc.TypedRegister(r, "workspace.checkout", func(ctx context.Context, req handlers.WorkspaceCheckoutParams) (*handlers.WorkspaceCheckoutResult, *rpckit.RPCError) {
 		return handlers.HandleWorkspaceCheckout(ctx, req, s.workspaceMgr)
@@ -147,15 +415,7 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 		if accessErr := s.requireWorkspaceStarted(workspaceID); accessErr != nil {
 			return nil, accessErr
 		}
-		workspace := s.resolveWorkspace(raw)
-		rootPath := workspace.Path()
-		if wsRecord, ok := s.workspaceMgr.Get(workspaceID); ok {
-			if preferred := preferredWorkspaceRoot(wsRecord); preferred != "" {
-				rootPath = preferred
-			}
-		}
-		s.ensureComposeHints(ctx, workspaceID, rootPath)
-		return handlers.HandleWorkspaceReady(ctx, req, workspace, s.serviceMgr)
+		return s.checkWorkspaceReady(ctx, workspaceID, req)
 	})
 	rpc.TypedRegister(r, "workspace.ports.list", func(_ context.Context, req struct {
 		WorkspaceID string `json:"workspaceId"`
@@ -165,8 +425,9 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 		}
 		items, activeWorkspaceID := s.WorkspacePortStates(req.WorkspaceID)
 		return map[string]any{
-			"items":             items,
-			"activeWorkspaceId": activeWorkspaceID,
+			"items":              items,
+			"activeWorkspaceId":  activeWorkspaceID,
+			"activeWorkspaceIds": s.ActiveTunnelWorkspaces(),
 		}, nil
 	})
 	rpc.TypedRegister(r, "workspace.ports.add", func(_ context.Context, req struct {
@@ -195,24 +456,31 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 		items, activeWorkspaceID := s.WorkspacePortStates(req.WorkspaceID)
 		return map[string]any{"items": items, "activeWorkspaceId": activeWorkspaceID}, nil
 	})
-	rpc.TypedRegister(r, "workspace.tunnels.start", func(_ context.Context, req struct {
+	startTunnels := func(_ context.Context, req struct {
 		WorkspaceID string `json:"workspaceId"`
+		// Exclusive stops other workspaces' tunnels first (single-lease mode).
+		Exclusive bool `json:"exclusive,omitempty"`
 	}) (map[string]any, *rpckit.RPCError) {
 		if req.WorkspaceID == "" {
 			return nil, rpckit.ErrInvalidParams
 		}
-		if err := s.StartWorkspaceTunnels(req.WorkspaceID); err != nil {
+		if err := s.StartWorkspaceTunnels(req.WorkspaceID, req.Exclusive); err != nil {
 			return map[string]any{
-				"active":            false,
-				"activeWorkspaceId": "",
+				"active":             false,
+				"activeWorkspaceId":  "",
+				"activeWorkspaceIds": s.ActiveTunnelWorkspaces(),
+				"error":              err.Error(),
 			}, nil
 		}
+		items, _ := s.WorkspacePortStates(req.WorkspaceID)
 		return map[string]any{
-			"active":            true,
-			"activeWorkspaceId": req.WorkspaceID,
+			"active":             true,
+			"activeWorkspaceId":  req.WorkspaceID,
+			"activeWorkspaceIds": s.ActiveTunnelWorkspaces(),
+			"items":              items,
 		}, nil
-	})
-	rpc.TypedRegister(r, "workspace.tunnels.stop", func(_ context.Context, req struct {
+	}
+	stopTunnels := func(_ context.Context, req struct {
 		WorkspaceID string `json:"workspaceId"`
 	}) (map[string]any, *rpckit.RPCError) {
 		if req.WorkspaceID == "" {
@@ -220,14 +488,49 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 		}
 		s.StopWorkspaceTunnels(req.WorkspaceID)
 		return map[string]any{
-			"active":            false,
-			"activeWorkspaceId": "",
+			"active":             false,
+			"activeWorkspaceId":  "",
+			"activeWorkspaceIds": s.ActiveTunnelWorkspaces(),
 		}, nil
-	})
+	}
+	rpc.TypedRegister(r, "workspace.tunnels.start", startTunnels)
+	rpc.TypedRegister(r, "workspace.tunnels.stop", stopTunnels)
 	rpc.TypedRegister(r, "git.command", func(ctx context.Context, req handlers.GitCommandParams) (map[string]interface{}, *rpckit.RPCError) {
 		ws := s.resolveWorkspaceTyped(req)
 		return handlers.HandleGitCommand(ctx, req, ws)
 	})
+	rpc.TypedRegister(r, "git.status", func(ctx context.Context, req handlers.GitStatusParams) (*handlers.GitStatusResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleGitStatus(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "git.diff", func(ctx context.Context, req handlers.GitDiffParams) (*handlers.GitDiffResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleGitDiff(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "git.log", func(ctx context.Context, req handlers.GitLogParams) (*handlers.GitLogResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleGitLog(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "git.branches", func(ctx context.Context, req handlers.GitBranchesParams) (*handlers.GitBranchesResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleGitBranches(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "git.stash", func(ctx context.Context, req handlers.GitStashParams) (*handlers.GitStashResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleGitStash(ctx, req, ws)
+	})
+	rpc.TypedRegister(r, "git.fetch", func(ctx context.Context, req handlers.GitRemoteParams) (*handlers.GitRemoteResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleGitFetch(ctx, req, ws, s.authRelayBroker)
+	})
+	rpc.TypedRegister(r, "git.push", func(ctx context.Context, req handlers.GitRemoteParams) (*handlers.GitRemoteResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleGitPush(ctx, req, ws, s.authRelayBroker)
+	})
+	rpc.TypedRegister(r, "git.blame", func(ctx context.Context, req handlers.GitBlameParams) (*handlers.GitBlameResult, *rpckit.RPCError) {
+		ws := s.resolveWorkspaceTyped(req)
+		return handlers.HandleGitBlame(ctx, req, ws)
+	})
 	rpc.TypedRegister(r, "service.command", func(ctx context.Context, req handlers.ServiceCommandParams) (map[string]interface{}, *rpckit.RPCError) {
 		ws := s.resolveWorkspaceTyped(req)
 		return handlers.HandleServiceCommand(ctx, req, ws, s.serviceMgr)
@@ -246,6 +549,122 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 		rootPath := ws.Path()
 		return handlers.HandleSpotlightApplyComposePorts(ctx, req, rootPath, s.spotlightMgr)
 	})
+	rpc.TypedRegister(r, "spotlight.share", func(_ context.Context, req struct {
+		WorkspaceID string                    `json:"workspaceId"`
+		Port        int                       `json:"port"`
+		TTL         string                    `json:"ttl,omitempty"`
+		BindAddress string                    `json:"bindAddress,omitempty"`
+		ListenPort  int                       `json:"listenPort,omitempty"`
+		ReadOnly    bool                      `json:"readOnly,omitempty"`
+		BasicAuth   *spotlight.ShareBasicAuth `json:"basicAuth,omitempty"`
+	}) (map[string]any, *rpckit.RPCError) {
+		if req.WorkspaceID == "" || req.Port <= 0 || req.Port > 65535 {
+			return nil, rpckit.ErrInvalidParams
+		}
+		if _, ok := s.workspaceMgr.Get(req.WorkspaceID); !ok {
+			return nil, rpckit.ErrWorkspaceNotFound
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil {
+				return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: fmt.Sprintf("invalid ttl %q: %v", req.TTL, err)}
+			}
+			ttl = d
+		}
+		share, err := s.ShareWorkspacePort(req.WorkspaceID, req.Port, ShareWorkspacePortOptions{
+			TTL:         ttl,
+			BindAddress: req.BindAddress,
+			ListenPort:  req.ListenPort,
+			ReadOnly:    req.ReadOnly,
+			BasicAuth:   req.BasicAuth,
+		})
+		if err != nil {
+			return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+		}
+		return map[string]any{"share": share}, nil
+	})
+	rpc.TypedRegister(r, "spotlight.shares.list", func(_ context.Context, req struct {
+		WorkspaceID string `json:"workspaceId,omitempty"`
+	}) (map[string]any, *rpckit.RPCError) {
+		return map[string]any{"shares": s.shareMgr.List(req.WorkspaceID)}, nil
+	})
+	rpc.TypedRegister(r, "spotlight.shares.revoke", func(_ context.Context, req struct {
+		ID string `json:"id"`
+	}) (map[string]any, *rpckit.RPCError) {
+		if req.ID == "" || !s.shareMgr.Revoke(req.ID) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		return map[string]any{"revoked": true}, nil
+	})
+	rpc.TypedRegister(r, "spotlight.shares.logs", func(_ context.Context, req struct {
+		ID    string `json:"id"`
+		Limit int    `json:"limit,omitempty"`
+	}) (map[string]any, *rpckit.RPCError) {
+		entries, ok := s.shareMgr.Logs(req.ID, req.Limit)
+		if !ok {
+			return nil, rpckit.ErrInvalidParams
+		}
+		return map[string]any{"entries": entries}, nil
+	})
+
+	rpc.TypedRegister(r, "compose.ps", func(ctx context.Context, req handlers.ComposePSParams) (*handlers.ComposePSResult, *rpckit.RPCError) {
+		if rpcErr := s.requireWorkspaceStarted(req.WorkspaceID); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return handlers.HandleComposePS(ctx, req, s.composeSvc)
+	})
+	r.Register("compose.logs", func(ctx context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req handlers.ComposeLogsParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, rpckit.ErrInvalidParams
+		}
+		if rpcErr := s.requireWorkspaceStarted(req.WorkspaceID); rpcErr != nil {
+			return nil, rpcErr
+		}
+		if req.Follow {
+			if err := compose.CheckServiceNames(req.Services); err != nil {
+				return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: err.Error()}
+			}
+			c, ok := conn.(*Connection)
+			if !ok {
+				return nil, &rpckit.RPCError{Code: rpckit.ErrInvalidParams.Code, Message: "follow requires a streaming connection"}
+			}
+			return &handlers.ComposeLogsResult{StreamID: s.followComposeLogs(c, req)}, nil
+		}
+		return handlers.HandleComposeLogs(ctx, req, s.composeSvc)
+	})
+	r.Register("compose.logs.stop", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		var req struct {
+			StreamID string `json:"streamId"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil || req.StreamID == "" {
+			return nil, rpckit.ErrInvalidParams
+		}
+		c, ok := conn.(*Connection)
+		if !ok || !c.stopStream(req.StreamID) {
+			return nil, rpckit.ErrInvalidParams
+		}
+		return map[string]any{"stopped": true}, nil
+	})
+	rpc.TypedRegister(r, "compose.restart", func(ctx context.Context, req handlers.ComposeServicesParams) (*handlers.ComposeActionResult, *rpckit.RPCError) {
+		if rpcErr := s.requireWorkspaceStarted(req.WorkspaceID); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return handlers.HandleComposeRestart(ctx, req, s.composeSvc)
+	})
+	rpc.TypedRegister(r, "compose.up", func(ctx context.Context, req handlers.ComposeServicesParams) (*handlers.ComposeActionResult, *rpckit.RPCError) {
+		if rpcErr := s.requireWorkspaceStarted(req.WorkspaceID); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return handlers.HandleComposeUp(ctx, req, s.composeSvc)
+	})
+	rpc.TypedRegister(r, "compose.down", func(ctx context.Context, req handlers.ComposeDownParams) (*handlers.ComposeActionResult, *rpckit.RPCError) {
+		if rpcErr := s.requireWorkspaceStarted(req.WorkspaceID); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return handlers.HandleComposeDown(ctx, req, s.composeSvc)
+	})
 
 	r.Register("pty.open", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
 		c := conn.(*Connection)
@@ -273,6 +692,33 @@ func (s *Server) newRPCRegistry() *rpc.Registry {
 	r.Register("pty.rename", func(_ context.Context, _ string, params json.RawMessage, _ any) (interface{}, *rpckit.RPCError) {
 		return pty.HandleRename(s.ptyDeps(), params)
 	})
+	r.Register("pty.lock", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleLock(s.ptyDeps(), params, conn.(*Connection))
+	})
+	r.Register("pty.unlock", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleUnlock(s.ptyDeps(), params, conn.(*Connection))
+	})
+	r.Register("pty.control.request", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleControlRequest(s.ptyDeps(), params, conn.(*Connection))
+	})
+	r.Register("pty.control.grant", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleControlGrant(s.ptyDeps(), params, conn.(*Connection))
+	})
+	r.Register("pty.expect", func(ctx context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleExpect(ctx, s.ptyDeps(), params, conn.(*Connection))
+	})
+	r.Register("pty.send", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleSend(s.ptyDeps(), params, conn.(*Connection))
+	})
+	r.Register("pty.snapshot", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleSnapshot(s.ptyDeps(), params, conn.(*Connection))
+	})
+	r.Register("pty.recording.get", func(_ context.Context, _ string, params json.RawMessage, _ any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleRecordingGet(s.ptyDeps(), params)
+	})
+	r.Register("pty.recording.list", func(_ context.Context, _ string, params json.RawMessage, _ any) (interface{}, *rpckit.RPCError) {
+		return pty.HandleRecordingList(s.ptyDeps(), params)
+	})
 	r.Register("pty.tmux", func(_ context.Context, _ string, params json.RawMessage, conn any) (interface{}, *rpckit.RPCError) {
 		return pty.HandleTmuxCommand(s.ptyDeps(), conn.(*Connection), params)
 	})
@@ -288,5 +734,88 @@ func (s *Server) ptyDeps() *pty.Deps {
 		RequireStarted: s.requireWorkspaceStarted,
 		Registry:       s.ptyRegistry,
 		SessionStore:   s.ptyStore,
+		Recordings:     s.ptyRecordings,
+		RecordDefault: func(workspaceID string) bool {
+			return s.workspaceTerminalConfig(workspaceID).Record
+		},
+		ScrollbackDefault: func(workspaceID string) int {
+			return s.workspaceTerminalConfig(workspaceID).ScrollbackBytes
+		},
+	}
+}
+
+// checkWorkspaceReady runs readiness checks, or a named profile, against a
+// started workspace.
+func (s *Server) checkWorkspaceReady(ctx context.Context, workspaceID string, req handlers.WorkspaceReadyParams) (*handlers.WorkspaceReadyResult, *rpckit.RPCError) {
+	raw, _ := json.Marshal(map[string]string{"workspaceId": workspaceID})
+	workspace := s.resolveWorkspace(raw)
+	rootPath := workspace.Path()
+	if wsRecord, ok := s.workspaceMgr.Get(workspaceID); ok {
+		if preferred := preferredWorkspaceRoot(wsRecord); preferred != "" {
+			rootPath = preferred
+		}
+	}
+	s.ensureComposeHints(ctx, workspaceID, rootPath)
+	return handlers.HandleWorkspaceReady(ctx, req, workspace, s.workspaceReadyDeps(workspaceID))
+}
+
+// startTemplateServices brings up a new workspace's template services and
+// waits on its readiness profile.
+func (s *Server) startTemplateServices(ctx context.Context, workspaceID string, tmpl *projectmgr.WorkspaceTemplate) *handlers.TemplateServicesResult {
+	return handlers.StartTemplateServices(ctx, tmpl, handlers.TemplateServiceRunner{
+		Up: func(ctx context.Context, services []string) *rpckit.RPCError {
+			_, rpcErr := handlers.HandleComposeUp(ctx, handlers.ComposeServicesParams{WorkspaceID: workspaceID, Services: services}, s.composeSvc)
+			return rpcErr
+		},
+		Ready: func(ctx context.Context, profile string) (*handlers.WorkspaceReadyResult, *rpckit.RPCError) {
+			return s.checkWorkspaceReady(ctx, workspaceID, handlers.WorkspaceReadyParams{WorkspaceID: workspaceID, Profile: profile})
+		},
+	})
+}
+
+func templateHooksPassed(results []handlers.TemplateHookResult) bool {
+	for _, hook := range results {
+		if hook.ExitCode != 0 || hook.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// workspaceTerminalConfig returns the terminal defaults from the
+// workspace's .nexus/workspace.json.
+func (s *Server) workspaceTerminalConfig(workspaceID string) config.WorkspaceTerminal {
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return config.WorkspaceTerminal{}
+	}
+	root := preferredWorkspaceRoot(ws)
+	if root == "" {
+		return config.WorkspaceTerminal{}
+	}
+	cfg, _, err := config.LoadWorkspaceConfig(root)
+	if err != nil {
+		return config.WorkspaceTerminal{}
+	}
+	return cfg.Terminal
+}
+
+// execInWorkspace runs an exec request inside the workspace runtime, for
+// fan-out children and template setup hooks. A command without args is run
+// through sh -c.
+func (s *Server) execInWorkspace(ctx context.Context, ws *workspacemgr.Workspace, req handlers.ExecParams) (*handlers.ExecResult, *rpckit.RPCError) {
+	argv := append([]string{req.Command}, req.Args...)
+	if len(req.Args) == 0 {
+		argv = []string{"sh", "-c", req.Command}
+	}
+	res, err := s.runWorkspaceCommand(ctx, ws, argv, req.Options.Env, nil)
+	if err != nil {
+		return nil, &rpckit.RPCError{Code: rpckit.ErrInternalError.Code, Message: err.Error()}
 	}
+	return &handlers.ExecResult{
+		Stdout:   res.Stdout,
+		Stderr:   res.Stderr,
+		ExitCode: res.ExitCode,
+		Command:  strings.Join(argv, " "),
+	}, nil
 }
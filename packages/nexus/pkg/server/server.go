@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -18,10 +19,12 @@ import (
 	"github.com/inizio/nexus/packages/nexus/pkg/authrelay"
 	"github.com/inizio/nexus/packages/nexus/pkg/compose"
 	"github.com/inizio/nexus/packages/nexus/pkg/config"
+	"github.com/inizio/nexus/packages/nexus/pkg/dotfiles"
 	"github.com/inizio/nexus/packages/nexus/pkg/lifecycle"
 	"github.com/inizio/nexus/packages/nexus/pkg/projectmgr"
 	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
 	"github.com/inizio/nexus/packages/nexus/pkg/runtime"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/firecracker"
 	"github.com/inizio/nexus/packages/nexus/pkg/server/pty"
 	"github.com/inizio/nexus/packages/nexus/pkg/server/rpc"
 	"github.com/inizio/nexus/packages/nexus/pkg/services"
@@ -31,29 +34,36 @@ import (
 )
 
 type Server struct {
-	port                  int
-	workspaceDir          string
-	authProvider          auth.Provider
-	upgrader              websocket.Upgrader
-	connections           map[string]*Connection
-	ws                    *workspace.Workspace
-	workspaceMgr          *workspacemgr.Manager
-	projectMgr            *projectmgr.Manager
-	serviceMgr            *services.Manager
-	spotlightMgr          *spotlight.Manager
-	portMonitor           *spotlight.PortMonitor
-	lifecycle             *lifecycle.Manager
-	runtimeFactory        *runtime.Factory
-	nodeCfg               *config.NodeConfig
-	authRelayBroker       *authrelay.Broker
-	autoComposeForwards   map[string]bool
-	composePortHints      map[string]map[int]int
-	activeTunnelWorkspace string
-	rpcReg                *rpc.Registry
-	ptyRegistry           *pty.Registry // Global PTY session registry for multi-tab support
-	ptyStore              *pty.Store
-	mu                    sync.RWMutex
-	shutdownCh            chan struct{}
+	port                int
+	workspaceDir        string
+	authProvider        auth.Provider
+	upgrader            websocket.Upgrader
+	connections         map[string]*Connection
+	ws                  *workspace.Workspace
+	workspaceMgr        *workspacemgr.Manager
+	projectMgr          *projectmgr.Manager
+	serviceMgr          *services.Manager
+	spotlightMgr        *spotlight.Manager
+	shareMgr            *spotlight.ShareManager
+	composeSvc          *compose.Services
+	events              workspaceEventLog
+	personal            *personalLayer
+	portMonitor         *spotlight.PortMonitor
+	lifecycle           *lifecycle.Manager
+	runtimeFactory      *runtime.Factory
+	nodeCfg             *config.NodeConfig
+	authRelayBroker     *authrelay.Broker
+	autoComposeForwards map[string]bool
+	composePortHints    map[string]map[int]int
+	// activeTunnels holds the workspaces whose tunnels are active. Several
+	// workspaces may hold a lease at once; port collisions are remapped.
+	activeTunnels map[string]bool
+	rpcReg        *rpc.Registry
+	ptyRegistry   *pty.Registry // Global PTY session registry for multi-tab support
+	ptyStore      *pty.Store
+	ptyRecordings *pty.Recordings
+	mu            sync.RWMutex
+	shutdownCh    chan struct{}
 }
 
 type Connection struct {
@@ -64,6 +74,10 @@ type Connection struct {
 	identity *auth.Identity
 	ptyMu    sync.Mutex
 	pty      map[string]*pty.Session
+	streamMu sync.Mutex
+	streams  map[string]context.CancelFunc
+	fileMu   sync.Mutex
+	files    map[string]*os.File
 }
 
 type RPCMessage struct {
@@ -131,14 +145,19 @@ func NewServer(port int, workspaceDir string, tokenSecret string) (*Server, erro
 		projectMgr:          projectMgr,
 		serviceMgr:          services.NewManager(),
 		spotlightMgr:        spotlightMgr,
+		shareMgr:            spotlight.NewShareManager(),
 		lifecycle:           lifecycleMgr,
 		authRelayBroker:     authrelay.NewBroker(),
 		autoComposeForwards: make(map[string]bool),
 		composePortHints:    make(map[string]map[int]int),
+		activeTunnels:       make(map[string]bool),
 		ptyRegistry:         pty.NewRegistry(), // Initialize global PTY session registry
 		ptyStore:            pty.NewStore(workspaceDir),
+		ptyRecordings:       pty.NewRecordings(workspaceDir),
 		shutdownCh:          make(chan struct{}),
 	}
+	srv.composeSvc = compose.NewServices(workspaceCommandRunner{s: srv})
+	spotlightMgr.SetSocketDialer(srv.dialWorkspaceSocket)
 	srv.rpcReg = srv.newRPCRegistry()
 	return srv, nil
 }
@@ -151,6 +170,7 @@ func (s *Server) Shutdown() {
 	}
 
 	close(s.shutdownCh)
+	s.shareMgr.RevokeWorkspace("")
 	s.mu.Lock()
 	for _, conn := range s.connections {
 		close(conn.send)
@@ -421,11 +441,45 @@ func (s *Server) StartPTYMaintenance(ctx context.Context, interval time.Duration
 
 func (s *Server) SetNodeConfig(cfg *config.NodeConfig) {
 	s.nodeCfg = cfg
+	s.personal = nil
+	if cfg != nil && cfg.Personal.Enabled() {
+		s.personal = &personalLayer{layer: dotfiles.New(cfg.Personal, dotfiles.DefaultCacheDir())}
+	}
 }
 
 // SetPortMonitor sets the port monitor for live port detection.
 func (s *Server) SetPortMonitor(pm *spotlight.PortMonitor) {
 	s.portMonitor = pm
+	if pm != nil {
+		pm.SetAutoExposeRule(s.autoExposeRule)
+	}
+}
+
+// autoExposeRule forwards newly detected ports of workspaces whose tunnels
+// are active, so a dev server started after `nexus workspace tunnel` is
+// reachable without re-activating. Remembered host-port remaps are reused.
+func (s *Server) autoExposeRule(workspaceID string, port spotlight.DiscoveredPort) (spotlight.ExposeSpec, bool) {
+	s.mu.RLock()
+	active := s.activeTunnels[workspaceID]
+	s.mu.RUnlock()
+	policy := s.workspacePortRules(workspaceID).Resolve(port.Port, port.Process)
+	if !policy.ShouldAutoExpose(active) {
+		return spotlight.ExposeSpec{}, false
+	}
+	service := port.Process
+	if policy.Label != "" {
+		service = policy.Label
+	}
+	return spotlight.ExposeSpec{
+		WorkspaceID:   workspaceID,
+		Service:       service,
+		Protocol:      policy.Protocol,
+		RemotePort:    port.Port,
+		LocalPort:     s.tunnelLocalPort(workspaceID, port.Port, policy),
+		RequestedPort: port.Port,
+		Host:          "127.0.0.1",
+		Remap:         true,
+	}, true
 }
 
 // SpotlightManager returns the spotlight manager.
@@ -453,18 +507,31 @@ type WorkspacePortState struct {
 	Port       int    `json:"port"`
 	RemotePort int    `json:"remotePort"`
 	Process    string `json:"process,omitempty"`
-	Preferred  bool   `json:"preferred"`
-	Tunneled   bool   `json:"tunneled"`
+	// Label and Protocol come from the workspace's port rules.
+	Label    string `json:"label,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// LocalPort is the host port the tunnel is served on. It differs from
+	// Port when the port was remapped around another workspace's tunnel.
+	LocalPort int  `json:"localPort,omitempty"`
+	Preferred bool `json:"preferred"`
+	Tunneled  bool `json:"tunneled"`
+	// URL is the daemon front-door address for a tunneled port,
+	// http://<port>.<workspace>.localhost:<daemon-port>/.
+	URL string `json:"url,omitempty"`
 }
 
 func (s *Server) WorkspacePortStates(workspaceID string) ([]WorkspacePortState, string) {
 	stateByPort := map[int]*WorkspacePortState{}
+	rules := s.workspacePortRules(workspaceID)
 
 	if s.portMonitor != nil {
 		for _, p := range s.portMonitor.ListDiscovered(workspaceID) {
 			if p.Port <= 0 || p.Port > 65535 {
 				continue
 			}
+			if rules.Resolve(p.Port, p.Process).Ignore {
+				continue
+			}
 			stateByPort[p.Port] = &WorkspacePortState{
 				Port:       p.Port,
 				RemotePort: p.Port,
@@ -478,6 +545,9 @@ func (s *Server) WorkspacePortStates(workspaceID string) ([]WorkspacePortState,
 		if hostPort <= 0 || hostPort > 65535 || targetPort <= 0 || targetPort > 65535 {
 			continue
 		}
+		if rules.Resolve(hostPort, "").Ignore {
+			continue
+		}
 		existing, ok := stateByPort[hostPort]
 		if !ok {
 			stateByPort[hostPort] = &WorkspacePortState{
@@ -488,24 +558,19 @@ func (s *Server) WorkspacePortStates(workspaceID string) ([]WorkspacePortState,
 		}
 		existing.RemotePort = targetPort
 	}
-	activeWorkspaceID := s.activeTunnelWorkspace
+	activeWorkspaceID := ""
+	if s.activeTunnels[workspaceID] {
+		activeWorkspaceID = workspaceID
+	}
 	s.mu.RUnlock()
 
 	if ws, ok := s.workspaceMgr.Get(workspaceID); ok {
-		// First-time default: auto-add all detected ports as preferred so
-		// activation is ready without requiring manual Add clicks.
-		if len(ws.TunnelPorts) == 0 && len(stateByPort) > 0 {
-			defaultPorts := make([]int, 0, len(stateByPort))
-			for p := range stateByPort {
-				if p > 0 && p <= 65535 {
-					defaultPorts = append(defaultPorts, p)
-				}
-			}
-			sort.Slice(defaultPorts, func(i, j int) bool { return defaultPorts[i] < defaultPorts[j] })
-			if len(defaultPorts) > 0 {
-				if err := s.workspaceMgr.SetTunnelPorts(workspaceID, defaultPorts); err == nil {
-					ws.TunnelPorts = defaultPorts
-				}
+		// First-time default: auto-add detected ports as preferred so
+		// activation is ready without requiring manual Add clicks. Port
+		// rules can opt ports out, and autoExpose rules add ports later on.
+		if defaultPorts := defaultTunnelPorts(ws.TunnelPorts, stateByPort, rules); len(defaultPorts) > len(ws.TunnelPorts) {
+			if err := s.workspaceMgr.SetTunnelPorts(workspaceID, defaultPorts); err == nil {
+				ws.TunnelPorts = defaultPorts
 			}
 		}
 		for _, p := range ws.TunnelPorts {
@@ -518,23 +583,41 @@ func (s *Server) WorkspacePortStates(workspaceID string) ([]WorkspacePortState,
 				stateByPort[p] = entry
 			}
 			entry.Preferred = true
+			if local := ws.TunnelLocalPorts[p]; local > 0 {
+				entry.LocalPort = local
+			}
 		}
 	}
 
 	for _, fwd := range s.spotlightMgr.List(workspaceID) {
-		entry, ok := stateByPort[fwd.LocalPort]
+		if fwd.Protocol == spotlight.ProtocolUnix {
+			continue
+		}
+		port := fwd.LocalPort
+		if fwd.RequestedPort > 0 {
+			port = fwd.RequestedPort
+		}
+		entry, ok := stateByPort[port]
 		if !ok {
-			entry = &WorkspacePortState{Port: fwd.LocalPort, RemotePort: fwd.RemotePort}
-			stateByPort[fwd.LocalPort] = entry
+			entry = &WorkspacePortState{Port: port, RemotePort: fwd.RemotePort}
+			stateByPort[port] = entry
 		}
+		entry.LocalPort = fwd.LocalPort
 		entry.Tunneled = true
 		if entry.RemotePort == 0 {
 			entry.RemotePort = fwd.RemotePort
 		}
 	}
 
+	ws, wsOK := s.workspaceMgr.Get(workspaceID)
 	items := make([]WorkspacePortState, 0, len(stateByPort))
 	for _, st := range stateByPort {
+		policy := rules.Resolve(st.Port, st.Process)
+		st.Label = policy.Label
+		st.Protocol = policy.Protocol
+		if wsOK && st.Tunneled {
+			st.URL = s.WorkspaceProxyURL(ws, st.Port)
+		}
 		items = append(items, *st)
 	}
 	sort.Slice(items, func(i, j int) bool { return items[i].Port < items[j].Port })
@@ -563,9 +646,9 @@ func (s *Server) SetWorkspaceTunnelPreference(workspaceID string, port int, enab
 	}
 
 	s.mu.RLock()
-	activeWorkspace := s.activeTunnelWorkspace
+	active := s.activeTunnels[workspaceID]
 	s.mu.RUnlock()
-	if activeWorkspace == workspaceID {
+	if active {
 		if enabled {
 			return s.ensureTunnelPort(workspaceID, port)
 		}
@@ -574,46 +657,95 @@ func (s *Server) SetWorkspaceTunnelPreference(workspaceID string, port int, enab
 	return nil
 }
 
+// ensureTunnelPort forwards port for workspaceID. When the host port is held
+// by another workspace the spotlight manager remaps it, and the chosen port
+// is stored on the workspace so later activations reuse it.
 func (s *Server) ensureTunnelPort(workspaceID string, port int) error {
 	remotePort := s.composeTargetPort(workspaceID, port)
-	_, err := s.spotlightMgr.Expose(context.Background(), spotlight.ExposeSpec{
-		WorkspaceID: workspaceID,
-		Service:     "",
-		RemotePort:  remotePort,
-		LocalPort:   port,
-		Host:        "127.0.0.1",
+	policy := s.workspacePortRules(workspaceID).Resolve(port, s.detectedProcess(workspaceID, port))
+	preferred := port
+	if policy.LocalPort > 0 {
+		preferred = policy.LocalPort
+	}
+	localPort := s.tunnelLocalPort(workspaceID, port, policy)
+	fwd, err := s.spotlightMgr.Expose(context.Background(), spotlight.ExposeSpec{
+		WorkspaceID:   workspaceID,
+		Service:       policy.Label,
+		Protocol:      policy.Protocol,
+		RemotePort:    remotePort,
+		LocalPort:     localPort,
+		RequestedPort: port,
+		Host:          "127.0.0.1",
+		Remap:         true,
 	})
-	if err != nil && !strings.Contains(err.Error(), "already in use") {
+	if err != nil {
 		return err
 	}
+	if fwd.LocalPort != preferred || localPort != preferred {
+		mapped := fwd.LocalPort
+		if mapped == preferred {
+			mapped = 0
+		}
+		if err := s.workspaceMgr.SetTunnelLocalPort(workspaceID, port, mapped); err != nil {
+			log.Printf("[tunnels] persist local port for %s:%d: %v", workspaceID, port, err)
+		}
+	}
 	return nil
 }
 
+// dialWorkspaceSocket connects a unix forward to path in the workspace. VM
+// workspaces reach it through the guest agent; the others run on the host.
+func (s *Server) dialWorkspaceSocket(ctx context.Context, workspaceID, path string) (net.Conn, error) {
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return nil, fmt.Errorf("workspace not found: %s", workspaceID)
+	}
+	_, dial, inGuest := s.workspaceAgent(ws)
+	if !inGuest {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	conn, err := dial(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("agent connect: %w", err)
+	}
+	sock, err := firecracker.NewAgentClient(conn).ConnectSocket(ctx, fmt.Sprintf("sock-%d", time.Now().UnixNano()), path)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return sock, nil
+}
+
 func (s *Server) closeTunnelPort(workspaceID string, port int) {
 	for _, fwd := range s.spotlightMgr.List(workspaceID) {
-		if fwd.LocalPort == port {
+		if fwd.Protocol != spotlight.ProtocolUnix && (fwd.LocalPort == port || fwd.RequestedPort == port) {
 			_ = s.spotlightMgr.Close(fwd.ID)
 		}
 	}
 }
 
-func (s *Server) StartWorkspaceTunnels(workspaceID string) error {
-	s.mu.Lock()
-	existing := s.activeTunnelWorkspace
-	s.mu.Unlock()
+// StartWorkspaceTunnels activates tunnels for workspaceID alongside any other
+// active workspaces. With exclusive set, other workspaces' tunnels are
+// stopped first so the workspace gets its requested ports where possible.
+func (s *Server) StartWorkspaceTunnels(workspaceID string, exclusive bool) error {
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return fmt.Errorf("workspace not found")
+	}
 
-	if existing != "" && existing != workspaceID {
-		s.StopWorkspaceTunnels(existing)
+	if exclusive {
+		for _, other := range s.ActiveTunnelWorkspaces() {
+			if other != workspaceID {
+				s.StopWorkspaceTunnels(other)
+			}
+		}
 	}
 
 	s.mu.Lock()
-	s.activeTunnelWorkspace = workspaceID
+	s.activeTunnels[workspaceID] = true
 	s.mu.Unlock()
 
-	ws, ok := s.workspaceMgr.Get(workspaceID)
-	if !ok {
-		return fmt.Errorf("workspace not found")
-	}
 	for _, p := range ws.TunnelPorts {
 		if p <= 0 || p > 65535 {
 			continue
@@ -630,12 +762,22 @@ func (s *Server) StopWorkspaceTunnels(workspaceID string) {
 		_ = s.spotlightMgr.Close(fwd.ID)
 	}
 	s.mu.Lock()
-	if s.activeTunnelWorkspace == workspaceID {
-		s.activeTunnelWorkspace = ""
-	}
+	delete(s.activeTunnels, workspaceID)
 	s.mu.Unlock()
 }
 
+// ActiveTunnelWorkspaces returns the workspaces with active tunnels, sorted.
+func (s *Server) ActiveTunnelWorkspaces() []string {
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.activeTunnels))
+	for id := range s.activeTunnels {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+	sort.Strings(ids)
+	return ids
+}
+
 func (s *Server) requireWorkspaceStarted(workspaceID string) *rpckit.RPCError {
 	workspaceID = strings.TrimSpace(workspaceID)
 	if workspaceID == "" {
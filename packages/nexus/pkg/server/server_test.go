@@ -888,3 +888,180 @@ func TestServer_ShutdownDoesNotWriteSpotlightJSON(t *testing.T) {
 		t.Fatalf("expected no active tunnels persisted across restart, got %d", len(forwards))
 	}
 }
+
+func TestStartWorkspaceTunnelsKeepsConcurrentLeasesAndRemapsCollisions(t *testing.T) {
+	workspaceDir := t.TempDir()
+	srv, err := NewServer(0, workspaceDir, "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("probe port: %v", err)
+	}
+	port := probe.Addr().(*net.TCPAddr).Port
+	_ = probe.Close()
+
+	var created []*workspacemgr.Workspace
+	for _, ref := range []string{"tunnel-a", "tunnel-b"} {
+		ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+			Repo:          "https://example.com/repo.git",
+			Ref:           ref,
+			WorkspaceName: ref,
+			AgentProfile:  "codex",
+			Backend:       "firecracker",
+		})
+		if err != nil {
+			t.Fatalf("create workspace: %v", err)
+		}
+		created = append(created, ws)
+	}
+	first, second := created[0], created[1]
+	for _, ws := range created {
+		if err := srv.workspaceMgr.SetTunnelPorts(ws.ID, []int{port}); err != nil {
+			t.Fatalf("set tunnel ports: %v", err)
+		}
+	}
+
+	if err := srv.StartWorkspaceTunnels(first.ID, false); err != nil {
+		t.Fatalf("start first: %v", err)
+	}
+	if err := srv.StartWorkspaceTunnels(second.ID, false); err != nil {
+		t.Fatalf("start second: %v", err)
+	}
+	t.Cleanup(func() {
+		srv.StopWorkspaceTunnels(first.ID)
+		srv.StopWorkspaceTunnels(second.ID)
+	})
+
+	if active := srv.ActiveTunnelWorkspaces(); len(active) != 2 {
+		t.Fatalf("expected both workspaces to hold tunnels, got %v", active)
+	}
+	firstItems, _ := srv.WorkspacePortStates(first.ID)
+	if len(firstItems) != 1 || !firstItems[0].Tunneled || firstItems[0].LocalPort != port {
+		t.Fatalf("expected first workspace on requested port, got %#v", firstItems)
+	}
+	secondItems, activeID := srv.WorkspacePortStates(second.ID)
+	if activeID != second.ID {
+		t.Fatalf("expected second workspace active, got %q", activeID)
+	}
+	if len(secondItems) != 1 || !secondItems[0].Tunneled || secondItems[0].Port != port || secondItems[0].LocalPort == port {
+		t.Fatalf("expected second workspace remapped, got %#v", secondItems)
+	}
+	remapped := secondItems[0].LocalPort
+
+	reloaded := workspacemgr.NewManager(workspaceDir)
+	ws, ok := reloaded.Get(second.ID)
+	if !ok || ws.TunnelLocalPorts[port] != remapped {
+		t.Fatalf("expected persisted mapping %d->%d, got %#v", port, remapped, ws)
+	}
+
+	srv.StopWorkspaceTunnels(second.ID)
+	if err := srv.StartWorkspaceTunnels(second.ID, false); err != nil {
+		t.Fatalf("restart second: %v", err)
+	}
+	again, _ := srv.WorkspacePortStates(second.ID)
+	if len(again) != 1 || again[0].LocalPort != remapped {
+		t.Fatalf("expected stable remapped port %d, got %#v", remapped, again)
+	}
+
+	if err := srv.StartWorkspaceTunnels(second.ID, true); err != nil {
+		t.Fatalf("exclusive start: %v", err)
+	}
+	if active := srv.ActiveTunnelWorkspaces(); len(active) != 1 || active[0] != second.ID {
+		t.Fatalf("expected exclusive start to evict others, got %v", active)
+	}
+}
+
+type staticPortScanner struct{ ports []spotlight.DiscoveredPort }
+
+func (s staticPortScanner) ScanPorts(context.Context, string) ([]spotlight.DiscoveredPort, error) {
+	return s.ports, nil
+}
+
+func TestWorkspacePortStatesAppliesPortRules(t *testing.T) {
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          "https://example.com/repo.git",
+		Ref:           "main",
+		WorkspaceName: "rules",
+		AgentProfile:  "codex",
+		Backend:       "firecracker",
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	root := preferredWorkspaceRoot(ws)
+	if root == "" {
+		t.Fatal("expected workspace root")
+	}
+	if err := os.MkdirAll(filepath.Join(root, ".nexus"), 0o755); err != nil {
+		t.Fatalf("mkdir .nexus: %v", err)
+	}
+	localPort := func() int {
+		probe, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("probe port: %v", err)
+		}
+		defer probe.Close()
+		return probe.Addr().(*net.TCPAddr).Port
+	}()
+	rules := fmt.Sprintf(`{"version":1,"ports":{"rules":[
+		{"port":9229,"ignore":true},
+		{"port":5432,"localPort":%d,"label":"postgres"},
+		{"process":"worker*","autoExpose":false},
+		{"range":"3000-3999","label":"web"}
+	]}}`, localPort)
+	if err := os.WriteFile(filepath.Join(root, ".nexus", "workspace.json"), []byte(rules), 0o644); err != nil {
+		t.Fatalf("write workspace.json: %v", err)
+	}
+
+	pm := spotlight.NewPortMonitor(srv.SpotlightManager(), staticPortScanner{ports: []spotlight.DiscoveredPort{
+		{Port: 3000, Process: `users:(("node",pid=7,fd=20))`},
+		{Port: 5432, Process: "postgres"},
+		{Port: 8081, Process: "worker-queue"},
+		{Port: 9229, Process: "node"},
+	}}, time.Hour)
+	srv.SetPortMonitor(pm)
+	if err := srv.StartPortMonitoring(ws.ID); err != nil {
+		t.Fatalf("start monitoring: %v", err)
+	}
+	t.Cleanup(func() { srv.StopPortMonitoring(ws.ID) })
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pm.ListDiscovered(ws.ID)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	items, _ := srv.WorkspacePortStates(ws.ID)
+	byPort := map[int]WorkspacePortState{}
+	for _, item := range items {
+		byPort[item.Port] = item
+	}
+	if _, ok := byPort[9229]; ok {
+		t.Fatalf("expected ignored port 9229 to be hidden, got %#v", items)
+	}
+	if byPort[3000].Label != "web" || byPort[5432].Label != "postgres" {
+		t.Fatalf("expected labels from rules, got %#v", items)
+	}
+	if !byPort[3000].Preferred || !byPort[5432].Preferred || byPort[8081].Preferred {
+		t.Fatalf("expected 3000 and 5432 tunneled by default but not 8081, got %#v", items)
+	}
+
+	if err := srv.StartWorkspaceTunnels(ws.ID, false); err != nil {
+		t.Fatalf("start tunnels: %v", err)
+	}
+	t.Cleanup(func() { srv.StopWorkspaceTunnels(ws.ID) })
+	items, _ = srv.WorkspacePortStates(ws.ID)
+	for _, item := range items {
+		if item.Port == 5432 && (!item.Tunneled || item.LocalPort != localPort) {
+			t.Fatalf("expected 5432 tunneled on rule local port %d, got %#v", localPort, item)
+		}
+	}
+	if updated, _ := srv.workspaceMgr.Get(ws.ID); updated.TunnelLocalPorts[5432] != 0 {
+		t.Fatalf("rule local port should not be stored as a remap, got %v", updated.TunnelLocalPorts)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/spotlight"
+)
+
+// ShareWorkspacePortOptions are the caller-controlled parts of a share.
+type ShareWorkspacePortOptions struct {
+	TTL         time.Duration
+	BindAddress string
+	ListenPort  int
+	ReadOnly    bool
+	BasicAuth   *spotlight.ShareBasicAuth
+}
+
+// ShareWorkspacePort exposes a workspace port on a LAN interface behind a
+// share token. The port is tunneled first if it is not already, and
+// requests go through the same proxy as the <port>.<workspace> front door.
+func (s *Server) ShareWorkspacePort(workspaceID string, port int, opts ShareWorkspacePortOptions) (*spotlight.Share, error) {
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return nil, fmt.Errorf("workspace not found")
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("port must be between 1 and 65535")
+	}
+	if !s.portTunneled(workspaceID, port) {
+		if !slices.Contains(ws.TunnelPorts, port) {
+			if err := s.SetWorkspaceTunnelPreference(workspaceID, port, true); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.ensureTunnelPort(workspaceID, port); err != nil {
+			return nil, fmt.Errorf("tunnel port %d: %w", port, err)
+		}
+	}
+
+	bind := strings.TrimSpace(opts.BindAddress)
+	if bind == "" && s.nodeCfg != nil {
+		bind = strings.TrimSpace(s.nodeCfg.Proxy.ShareAddress)
+	}
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current, ok := s.workspaceMgr.Get(workspaceID)
+		if !ok {
+			http.Error(w, "workspace not found", http.StatusNotFound)
+			return
+		}
+		s.proxyWorkspacePort(w, r, current, port)
+	})
+	return s.shareMgr.Create(spotlight.ShareSpec{
+		WorkspaceID: workspaceID,
+		Port:        port,
+		TTL:         opts.TTL,
+		BindAddress: bind,
+		ListenPort:  opts.ListenPort,
+		ReadOnly:    opts.ReadOnly,
+		BasicAuth:   opts.BasicAuth,
+	}, upstream)
+}
+
+func (s *Server) portTunneled(workspaceID string, port int) bool {
+	items, _ := s.WorkspacePortStates(workspaceID)
+	for _, item := range items {
+		if item.Port == port {
+			return item.Tunneled && item.LocalPort > 0
+		}
+	}
+	return false
+}
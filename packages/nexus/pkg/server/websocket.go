@@ -16,21 +16,8 @@ import (
 )
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("Authorization")
-	if strings.HasPrefix(token, "Bearer ") {
-		token = strings.TrimPrefix(token, "Bearer ")
-	}
-	if token == "" {
-		http.Error(w, "missing token", http.StatusUnauthorized)
-		return
-	}
-	if s.authProvider == nil {
-		http.Error(w, "auth not configured", http.StatusInternalServerError)
-		return
-	}
-	identity, err := s.authProvider.ValidateToken(r.Context(), token)
-	if err != nil {
-		http.Error(w, "invalid token", http.StatusUnauthorized)
+	identity, ok := s.authenticate(w, r, bearerToken(r))
+	if !ok {
 		return
 	}
 
@@ -57,12 +44,42 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	clientConn.readPump(s)
 }
 
+// bearerToken returns the token of r's Authorization header.
+func bearerToken(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if strings.HasPrefix(token, "Bearer ") {
+		token = strings.TrimPrefix(token, "Bearer ")
+	}
+	return token
+}
+
+// authenticate validates token, answering the request with an error when
+// it is missing or invalid.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request, token string) (*auth.Identity, bool) {
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return nil, false
+	}
+	if s.authProvider == nil {
+		http.Error(w, "auth not configured", http.StatusInternalServerError)
+		return nil, false
+	}
+	identity, err := s.authProvider.ValidateToken(r.Context(), token)
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+	return identity, true
+}
+
 func (c *Connection) readPump(srv *Server) {
 	defer func() {
 		if srv.ptyRegistry != nil {
 			srv.ptyRegistry.UnsubscribeConn(c)
 		}
 		c.DetachAllPTY()
+		c.stopAllStreams()
+		c.closeAllFiles()
 		c.conn.Close()
 		srv.mu.Lock()
 		delete(srv.connections, c.clientID)
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/lifecycle"
+)
+
+// maxWorkspaceEvents bounds the per-workspace event log.
+const maxWorkspaceEvents = 200
+
+// WorkspaceEvent is an entry in a workspace's event log.
+type WorkspaceEvent struct {
+	Time    time.Time             `json:"time"`
+	Kind    string                `json:"kind"`
+	Message string                `json:"message"`
+	Hook    *lifecycle.HookResult `json:"hook,omitempty"`
+}
+
+// workspaceEventLog keeps recent events per workspace in memory. The zero
+// value is ready to use.
+type workspaceEventLog struct {
+	mu     sync.Mutex
+	events map[string][]WorkspaceEvent
+}
+
+func (l *workspaceEventLog) append(workspaceID string, ev WorkspaceEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.events == nil {
+		l.events = make(map[string][]WorkspaceEvent)
+	}
+	events := append(l.events[workspaceID], ev)
+	if len(events) > maxWorkspaceEvents {
+		events = append([]WorkspaceEvent(nil), events[len(events)-maxWorkspaceEvents:]...)
+	}
+	l.events[workspaceID] = events
+}
+
+// list returns the most recent events, oldest first. limit <= 0 returns all.
+func (l *workspaceEventLog) list(workspaceID string, limit int) []WorkspaceEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := l.events[workspaceID]
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return append([]WorkspaceEvent{}, events...)
+}
+
+func (l *workspaceEventLog) forget(workspaceID string) {
+	l.mu.Lock()
+	delete(l.events, workspaceID)
+	l.mu.Unlock()
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/compose"
+	"github.com/inizio/nexus/packages/nexus/pkg/config"
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	"github.com/inizio/nexus/packages/nexus/pkg/lifecycle"
+	"github.com/inizio/nexus/packages/nexus/pkg/projectmgr"
+	rpckit "github.com/inizio/nexus/packages/nexus/pkg/rpcerrors"
+	"github.com/inizio/nexus/packages/nexus/pkg/runtime/sandbox"
+	"github.com/inizio/nexus/packages/nexus/pkg/safeenv"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+// runWorkspaceHooks runs the workspace.json hooks of stage inside the
+// workspace and records each outcome in the workspace event log. The error
+// is a *lifecycle.HookError when an abort-policy hook failed.
+func (s *Server) runWorkspaceHooks(ctx context.Context, workspaceID, stage string) ([]lifecycle.HookResult, error) {
+	ws, ok := s.workspaceMgr.Get(workspaceID)
+	if !ok {
+		return nil, nil
+	}
+	root := preferredWorkspaceRoot(ws)
+	if root == "" {
+		return nil, nil
+	}
+	cfg, _, err := config.LoadWorkspaceConfig(root)
+	if err != nil {
+		s.events.append(ws.ID, WorkspaceEvent{Kind: "hook", Message: fmt.Sprintf("skipped %s hooks: %v", stage, err)})
+		return nil, nil
+	}
+	hooks := cfg.Lifecycle.Hooks(stage)
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+
+	env := map[string]string{
+		"NEXUS_WORKSPACE_ID":   ws.ID,
+		"NEXUS_WORKSPACE_NAME": ws.WorkspaceName,
+		"NEXUS_HOOK_STAGE":     stage,
+	}
+	run := func(ctx context.Context, argv, env []string, onOutput func(stream, data string)) (int, error) {
+		res, err := s.runWorkspaceCommand(ctx, ws, argv, env, onOutput)
+		return res.ExitCode, err
+	}
+	results, err := lifecycle.RunWorkspaceHooks(ctx, stage, hooks, env, run)
+	for i := range results {
+		result := results[i]
+		msg := fmt.Sprintf("%s hook %s succeeded", stage, result.Name)
+		if result.Failed() {
+			msg = fmt.Sprintf("%s hook %s failed (%s)", stage, result.Name, result.OnFailure)
+		}
+		s.events.append(ws.ID, WorkspaceEvent{Kind: "hook", Message: msg, Hook: &result})
+	}
+	return results, err
+}
+
+// runWorkspaceCommand runs argv in the workspace runtime: through the
+// guest agent for VM backends, in the host process sandbox for process
+// workspaces, and in the host worktree otherwise. Hooks and fan-out
+// commands both run here.
+func (s *Server) runWorkspaceCommand(ctx context.Context, ws *workspacemgr.Workspace, argv, env []string, onOutput func(stream, data string)) (compose.CommandResult, error) {
+	if driver, dial, ok := s.workspaceAgent(ws); ok {
+		return runAgentCommand(ctx, dial, guestWorkdir(driver, ws.ID), ws.ID, argv, env, onOutput)
+	}
+	root := preferredWorkspaceRoot(ws)
+	if root == "" {
+		return compose.CommandResult{}, fmt.Errorf("workspace %s has no host path", ws.ID)
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	if strings.EqualFold(strings.TrimSpace(ws.Backend), "process") {
+		sandboxed, err := sandbox.Command(root, strings.TrimSpace(ws.Repo), argv)
+		if err != nil {
+			return compose.CommandResult{}, err
+		}
+		cmd = exec.CommandContext(ctx, sandboxed.Path, sandboxed.Args[1:]...)
+	}
+	cmd.Dir = root
+	cmd.Env = append(safeenv.Base(), env...)
+	return runCommand(cmd, onOutput)
+}
+
+// templateSetupStage names template setup hooks in the workspace event log.
+const templateSetupStage = "templateSetup"
+
+// templateSetupHookTimeout bounds each template setup hook, like the
+// default timeout of workspace.json hooks.
+const templateSetupHookTimeout = 5 * time.Minute
+
+// runTemplateSetupHooks runs a template's setup hooks in the workspace
+// runtime and records each outcome in the workspace event log, the same way
+// as the workspace.json hooks.
+func (s *Server) runTemplateSetupHooks(ctx context.Context, ws *workspacemgr.Workspace, tmpl *projectmgr.WorkspaceTemplate) []handlers.TemplateHookResult {
+	run := func(ctx context.Context, ws *workspacemgr.Workspace, req handlers.ExecParams) (*handlers.ExecResult, *rpckit.RPCError) {
+		hookCtx, cancel := context.WithTimeout(ctx, templateSetupHookTimeout)
+		defer cancel()
+		return s.execInWorkspace(hookCtx, ws, req)
+	}
+	results := handlers.RunTemplateSetupHooks(ctx, ws, tmpl, run)
+	for i, r := range results {
+		result := lifecycle.HookResult{
+			Stage:     templateSetupStage,
+			Name:      r.Name,
+			Command:   r.Command,
+			OnFailure: lifecycle.FailureAbort,
+			ExitCode:  r.ExitCode,
+			Output:    r.Output,
+			Error:     r.Error,
+		}
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("%s-%d", templateSetupStage, i+1)
+		}
+		msg := fmt.Sprintf("%s hook %s succeeded", templateSetupStage, result.Name)
+		if result.Failed() {
+			msg = fmt.Sprintf("%s hook %s failed (%s)", templateSetupStage, result.Name, result.OnFailure)
+		}
+		s.events.append(ws.ID, WorkspaceEvent{Kind: "hook", Message: msg, Hook: &result})
+	}
+	return results
+}
+
+// hookRPCError reports an aborted lifecycle stage with the hook results
+// attached as error data.
+func hookRPCError(err error, results []lifecycle.HookResult) *rpckit.RPCError {
+	return &rpckit.RPCError{
+		Code:    rpckit.ErrInternalError.Code,
+		Message: err.Error(),
+		Data:    map[string]any{"hooks": results},
+	}
+}
+
+// discardWorkspace removes a workspace whose onCreate or onFork hooks
+// aborted, so a failed create leaves nothing behind.
+func (s *Server) discardWorkspace(ctx context.Context, workspaceID string) {
+	if _, rpcErr := handlers.HandleWorkspaceRemove(ctx, handlers.WorkspaceRemoveParams{ID: workspaceID}, s.workspaceMgr, s.runtimeFactory); rpcErr != nil {
+		log.Printf("[lifecycle] discard workspace %s after failed hook: %s", workspaceID, rpcErr.Message)
+	}
+	s.events.forget(workspaceID)
+}
+
+// runForkHooks runs the onFork hooks of a new fork and discards the fork
+// when one of them aborts.
+func (s *Server) runForkHooks(ctx context.Context, workspaceID string) ([]lifecycle.HookResult, error) {
+	hooks, err := s.runWorkspaceHooks(ctx, workspaceID, lifecycle.StageOnFork)
+	if err != nil {
+		s.discardWorkspace(ctx, workspaceID)
+	}
+	return hooks, err
+}
+
+// runPostStartHooks runs the postStart hooks of a workspace that was just
+// started or restored. When one of them aborts the workspace is stopped
+// again, so a failed start does not leave it running.
+func (s *Server) runPostStartHooks(ctx context.Context, workspaceID string) ([]lifecycle.HookResult, error) {
+	hooks, err := s.runWorkspaceHooks(ctx, workspaceID, lifecycle.StagePostStart)
+	if err != nil {
+		if _, rpcErr := handlers.HandleWorkspaceStopWithRuntime(ctx, handlers.WorkspaceStopParams{ID: workspaceID}, s.workspaceMgr, s.runtimeFactory); rpcErr != nil {
+			log.Printf("[lifecycle] stop workspace %s after failed hook: %s", workspaceID, rpcErr.Message)
+		}
+		s.StopPortMonitoring(workspaceID)
+		s.StopWorkspaceTunnels(workspaceID)
+	}
+	return hooks, err
+}
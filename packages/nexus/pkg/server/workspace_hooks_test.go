@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inizio/nexus/packages/nexus/pkg/handlers"
+	"github.com/inizio/nexus/packages/nexus/pkg/lifecycle"
+	"github.com/inizio/nexus/packages/nexus/pkg/projectmgr"
+	"github.com/inizio/nexus/packages/nexus/pkg/workspacemgr"
+)
+
+func TestRunWorkspaceHooksRunsConfiguredStageAndLogsEvents(t *testing.T) {
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          t.TempDir(),
+		Ref:           "main",
+		WorkspaceName: "hooks",
+		AgentProfile:  "codex",
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	root := preferredWorkspaceRoot(ws)
+	if root == "" {
+		t.Fatal("expected a host root for the workspace")
+	}
+	if err := os.MkdirAll(filepath.Join(root, ".nexus"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := `{"version":1,"lifecycle":{
+		"postStart":[{"name":"greet","command":"echo \"$GREETING from $NEXUS_HOOK_STAGE\"","env":{"GREETING":"hello"}}],
+		"preStop":[{"name":"flaky","command":"exit 3"},{"name":"after","command":"true"}],
+		"onFork":[{"name":"boom","command":"echo broken >&2; exit 1"},{"name":"skipped","command":"true"}]
+	}}`
+	if err := os.WriteFile(filepath.Join(root, ".nexus", "workspace.json"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := srv.runWorkspaceHooks(context.Background(), ws.ID, lifecycle.StagePostStart)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("postStart: %v %#v", err, results)
+	}
+	if results[0].Output != "hello from postStart\n" {
+		t.Fatalf("unexpected hook output %q", results[0].Output)
+	}
+
+	results, err = srv.runWorkspaceHooks(context.Background(), ws.ID, lifecycle.StagePreStop)
+	if err != nil || len(results) != 2 || results[0].ExitCode != 3 {
+		t.Fatalf("preStop should warn and continue: %v %#v", err, results)
+	}
+
+	results, err = srv.runWorkspaceHooks(context.Background(), ws.ID, lifecycle.StageOnFork)
+	var hookErr *lifecycle.HookError
+	if !errors.As(err, &hookErr) || len(results) != 1 || !strings.Contains(results[0].Output, "broken") {
+		t.Fatalf("onFork should abort on first failure: %v %#v", err, results)
+	}
+
+	events := srv.events.list(ws.ID, 0)
+	if len(events) != 4 {
+		t.Fatalf("expected one event per hook run, got %#v", events)
+	}
+	if events[1].Message != "preStop hook flaky failed (warn)" || events[1].Hook == nil || events[1].Hook.ExitCode != 3 {
+		t.Fatalf("unexpected event %#v", events[1])
+	}
+	if last := srv.events.list(ws.ID, 1); len(last) != 1 || last[0].Hook.Name != "boom" {
+		t.Fatalf("expected limited list to return newest event, got %#v", last)
+	}
+}
+
+func TestRunPostStartHooksStopsWorkspaceOnAbort(t *testing.T) {
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	srv.runtimeFactory = nil
+	ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          t.TempDir(),
+		Ref:           "main",
+		WorkspaceName: "hooks",
+		AgentProfile:  "codex",
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if err := srv.workspaceMgr.Start(ws.ID); err != nil {
+		t.Fatalf("start workspace: %v", err)
+	}
+	root := preferredWorkspaceRoot(ws)
+	if err := os.MkdirAll(filepath.Join(root, ".nexus"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := `{"version":1,"lifecycle":{"postStart":[{"name":"migrate","command":"exit 4"}]}}`
+	if err := os.WriteFile(filepath.Join(root, ".nexus", "workspace.json"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := srv.runPostStartHooks(context.Background(), ws.ID)
+	var hookErr *lifecycle.HookError
+	if !errors.As(err, &hookErr) || len(results) != 1 || results[0].ExitCode != 4 {
+		t.Fatalf("postStart should abort: %v %#v", err, results)
+	}
+	got, ok := srv.workspaceMgr.Get(ws.ID)
+	if !ok {
+		t.Fatal("workspace should be kept after a failed postStart hook")
+	}
+	if got.State != workspacemgr.StateStopped {
+		t.Fatalf("expected workspace to be stopped after aborted postStart, got %q", got.State)
+	}
+}
+
+func TestExecInWorkspaceRunsInWorkspaceRuntime(t *testing.T) {
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          t.TempDir(),
+		Ref:           "main",
+		WorkspaceName: "fanout",
+		AgentProfile:  "codex",
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+
+	res, rpcErr := srv.execInWorkspace(context.Background(), ws, handlers.ExecParams{
+		Command: `echo "$TRIAL in $(basename "$PWD")"; exit 3`,
+		Options: handlers.ExecOptions{Env: []string{"TRIAL=one"}},
+	})
+	if rpcErr != nil {
+		t.Fatalf("run: %+v", rpcErr)
+	}
+	want := "one in " + filepath.Base(preferredWorkspaceRoot(ws)) + "\n"
+	if res.ExitCode != 3 || res.Stdout != want {
+		t.Fatalf("unexpected result %#v, want stdout %q", res, want)
+	}
+}
+
+func TestRunTemplateSetupHooksRunsInWorkspaceAndLogsEvents(t *testing.T) {
+	srv, err := NewServer(0, t.TempDir(), "secret-token")
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	ws, err := srv.workspaceMgr.Create(context.Background(), workspacemgr.CreateSpec{
+		Repo:          t.TempDir(),
+		Ref:           "main",
+		WorkspaceName: "template",
+		AgentProfile:  "codex",
+	})
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	tmpl := &projectmgr.WorkspaceTemplate{SetupHooks: []projectmgr.TemplateHook{
+		{Name: "seed", Command: "echo seeded > seed.txt"},
+		{Command: "false"},
+		{Name: "never", Command: "true"},
+	}}
+
+	results := srv.runTemplateSetupHooks(context.Background(), ws, tmpl)
+	if len(results) != 2 || results[0].ExitCode != 0 || results[1].ExitCode != 1 {
+		t.Fatalf("unexpected template hook results %#v", results)
+	}
+	if data, err := os.ReadFile(filepath.Join(preferredWorkspaceRoot(ws), "seed.txt")); err != nil || string(data) != "seeded\n" {
+		t.Fatalf("expected hook to run in the workspace root: %q %v", data, err)
+	}
+	events := srv.events.list(ws.ID, 0)
+	if len(events) != 2 || events[0].Message != "templateSetup hook seed succeeded" || events[1].Message != "templateSetup hook templateSetup-2 failed (abort)" {
+		t.Fatalf("unexpected events %#v", events)
+	}
+	if events[1].Hook == nil || events[1].Hook.Stage != "templateSetup" || events[1].Hook.ExitCode != 1 {
+		t.Fatalf("expected hook result on failed event, got %#v", events[1].Hook)
+	}
+}
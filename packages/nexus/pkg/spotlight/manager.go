@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,32 +27,75 @@ const (
 	ForwardSourceAutoDetected ForwardSource = "auto-detected"
 )
 
+// Forward protocols. Unix forwards bind LocalPath on the host and relay to
+// RemotePath through the manager's SocketDialer, or on the host without one.
+const (
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolUnix = "unix"
+)
+
 type Forward struct {
-	ID          string        `json:"id"`
-	WorkspaceID string        `json:"workspaceId"`
-	Service     string        `json:"service"`
-	RemotePort  int           `json:"remotePort"`
-	LocalPort   int           `json:"localPort"`
-	Host        string        `json:"host"`
-	Source      ForwardSource `json:"source"`
-	CreatedAt   time.Time     `json:"createdAt"`
-	LastSeenAt  *time.Time    `json:"lastSeenAt,omitempty"`
+	ID          string `json:"id"`
+	WorkspaceID string `json:"workspaceId"`
+	Service     string `json:"service"`
+	Protocol    string `json:"protocol"`
+	RemotePort  int    `json:"remotePort"`
+	LocalPort   int    `json:"localPort"`
+	LocalPath   string `json:"localPath,omitempty"`
+	RemotePath  string `json:"remotePath,omitempty"`
+	// RequestedPort is the host port the caller asked for. It differs from
+	// LocalPort when the forward was remapped around a collision.
+	RequestedPort int           `json:"requestedPort,omitempty"`
+	Host          string        `json:"host"`
+	Source        ForwardSource `json:"source"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	LastSeenAt    *time.Time    `json:"lastSeenAt,omitempty"`
+	// Sessions is the number of live UDP flows. It is filled by List and
+	// is not persisted.
+	Sessions int `json:"sessions,omitempty"`
 }
 
 type ExposeSpec struct {
 	WorkspaceID string `json:"workspaceId"`
 	Service     string `json:"service"`
-	RemotePort  int    `json:"remotePort"`
-	LocalPort   int    `json:"localPort"`
-	Host        string `json:"host,omitempty"`
+	// Protocol is tcp (default), udp or unix. Unix forwards use LocalPath
+	// and RemotePath instead of ports.
+	Protocol   string `json:"protocol,omitempty"`
+	RemotePort int    `json:"remotePort"`
+	LocalPort  int    `json:"localPort"`
+	LocalPath  string `json:"localPath,omitempty"`
+	RemotePath string `json:"remotePath,omitempty"`
+	Host       string `json:"host,omitempty"`
+	// RequestedPort is the port the forward stands in for when LocalPort is
+	// a previously remapped port. Defaults to LocalPort.
+	RequestedPort int `json:"requestedPort,omitempty"`
+	// Remap lets the manager pick another local port when LocalPort is held
+	// by another forward or cannot be bound, instead of failing. An existing
+	// forward for the same workspace and requested port is returned as is.
+	Remap bool `json:"remap,omitempty"`
 }
 
+// Remapped ports are drawn from per-workspace blocks so a workspace tends to
+// land on the same ports every time: port 3000 maps to 20000+block*100+0.
+const (
+	remapRangeStart  = 20000
+	remapBlockSize   = 100
+	remapBlocks      = 400
+	maxRemapAttempts = 64
+)
+
+// SocketDialer connects to RemotePath of a unix forward. It lets forwards
+// reach sockets inside a workspace VM.
+type SocketDialer func(ctx context.Context, workspaceID, path string) (net.Conn, error)
+
 type Manager struct {
-	mu        sync.RWMutex
-	forwards  map[string]*Forward
-	localToID map[int]string
-	listeners map[string]net.Listener
-	repo      spotlightRepository
+	mu           sync.RWMutex
+	forwards     map[string]*Forward
+	localToID    map[string]string
+	listeners    map[string]io.Closer
+	repo         spotlightRepository
+	socketDialer SocketDialer
 }
 
 type spotlightRepository interface {
@@ -59,11 +107,18 @@ type spotlightRepository interface {
 func NewManager() *Manager {
 	return &Manager{
 		forwards:  make(map[string]*Forward),
-		localToID: make(map[int]string),
-		listeners: make(map[string]net.Listener),
+		localToID: make(map[string]string),
+		listeners: make(map[string]io.Closer),
 	}
 }
 
+// SetSocketDialer routes new connections of unix forwards through dial.
+func (m *Manager) SetSocketDialer(dial SocketDialer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.socketDialer = dial
+}
+
 func NewManagerWithRepository(repo spotlightRepository) (*Manager, error) {
 	m := NewManager()
 	m.repo = repo
@@ -87,9 +142,9 @@ func (m *Manager) hydrateFromRepository() error {
 	defer m.mu.Unlock()
 
 	m.forwards = make(map[string]*Forward, len(rows))
-	m.localToID = make(map[int]string, len(rows))
+	m.localToID = make(map[string]string, len(rows))
 	for _, row := range rows {
-		if row.ID == "" || row.LocalPort <= 0 || len(row.Payload) == 0 {
+		if row.ID == "" || len(row.Payload) == 0 {
 			continue
 		}
 
@@ -103,25 +158,42 @@ func (m *Manager) hydrateFromRepository() error {
 		if fwd.WorkspaceID == "" {
 			fwd.WorkspaceID = row.WorkspaceID
 		}
+		if fwd.Protocol == "" {
+			fwd.Protocol = row.Protocol
+		}
+		if fwd.Protocol == "" {
+			fwd.Protocol = ProtocolTCP
+		}
 		if fwd.LocalPort <= 0 {
 			fwd.LocalPort = row.LocalPort
 		}
+		if fwd.LocalPath == "" {
+			fwd.LocalPath = row.LocalPath
+		}
 		if fwd.CreatedAt.IsZero() {
 			fwd.CreatedAt = row.CreatedAt
 		}
-		if fwd.ID == "" || fwd.RemotePort <= 0 || fwd.LocalPort <= 0 {
+		if fwd.ID == "" {
+			continue
+		}
+		if fwd.Protocol == ProtocolUnix {
+			if fwd.LocalPath == "" || fwd.RemotePath == "" {
+				continue
+			}
+		} else if fwd.RemotePort <= 0 || fwd.LocalPort <= 0 {
 			continue
 		}
 		if _, dup := m.forwards[fwd.ID]; dup {
 			continue
 		}
-		if _, dup := m.localToID[fwd.LocalPort]; dup {
+		key := forwardKey(&fwd)
+		if _, dup := m.localToID[key]; dup {
 			continue
 		}
 
 		copy := fwd
 		m.forwards[copy.ID] = &copy
-		m.localToID[copy.LocalPort] = copy.ID
+		m.localToID[key] = copy.ID
 	}
 
 	return nil
@@ -132,15 +204,29 @@ func (m *Manager) Expose(_ context.Context, spec ExposeSpec) (*Forward, error) {
 }
 
 func (m *Manager) exposeWithSource(_ context.Context, spec ExposeSpec, source ForwardSource) (*Forward, error) {
-	if spec.RemotePort <= 0 || spec.LocalPort <= 0 {
-		return nil, fmt.Errorf("remotePort and localPort must be > 0")
+	protocol, err := normalizeExposeSpec(&spec)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := spec.RequestedPort
+	if requested <= 0 {
+		requested = spec.LocalPort
 	}
 
 	m.mu.Lock()
 
-	if existing, ok := m.localToID[spec.LocalPort]; ok {
+	if spec.Remap && protocol != ProtocolUnix {
+		for _, fwd := range m.forwards {
+			if fwd.WorkspaceID == spec.WorkspaceID && fwd.Protocol == protocol && fwd.RemotePort == spec.RemotePort && forwardRequestedPort(fwd) == requested {
+				copy := *fwd
+				m.mu.Unlock()
+				return &copy, nil
+			}
+		}
+	} else if existing, ok := m.localToID[localKey(protocol, spec.LocalPort, spec.LocalPath)]; ok {
 		m.mu.Unlock()
-		return nil, fmt.Errorf("local port %d already in use by %s", spec.LocalPort, existing)
+		return nil, fmt.Errorf("local %s already in use by %s", describeLocal(protocol, spec.LocalPort, spec.LocalPath), existing)
 	}
 
 	host := spec.Host
@@ -148,6 +234,13 @@ func (m *Manager) exposeWithSource(_ context.Context, spec ExposeSpec, source Fo
 		host = "127.0.0.1"
 	}
 
+	listener, localPort, err := m.bindLocked(host, protocol, spec, requested)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	spec.LocalPort = localPort
+
 	now := time.Now().UTC()
 	id := fmt.Sprintf("spot-%d", now.UnixNano())
 	if _, exists := m.forwards[id]; exists {
@@ -163,30 +256,30 @@ func (m *Manager) exposeWithSource(_ context.Context, spec ExposeSpec, source Fo
 		ID:          id,
 		WorkspaceID: spec.WorkspaceID,
 		Service:     spec.Service,
+		Protocol:    protocol,
 		RemotePort:  spec.RemotePort,
 		LocalPort:   spec.LocalPort,
+		LocalPath:   spec.LocalPath,
+		RemotePath:  spec.RemotePath,
 		Host:        host,
 		Source:      source,
 		CreatedAt:   now,
 	}
-
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, spec.LocalPort))
-	if err != nil {
-		m.mu.Unlock()
-		return nil, fmt.Errorf("bind local spotlight port: %w", err)
+	if protocol != ProtocolUnix && requested != spec.LocalPort {
+		fwd.RequestedPort = requested
 	}
 
+	key := forwardKey(fwd)
 	m.forwards[id] = fwd
-	m.localToID[spec.LocalPort] = id
+	m.localToID[key] = id
 	m.listeners[id] = listener
-	targetAddr := fmt.Sprintf("%s:%d", host, spec.RemotePort)
-	go serveForward(listener, targetAddr)
+	go m.serveForwardListener(listener, fwd)
 
 	if m.repo != nil {
 		payload, err := json.Marshal(fwd)
 		if err != nil {
 			delete(m.forwards, id)
-			delete(m.localToID, spec.LocalPort)
+			delete(m.localToID, key)
 			if l, ok := m.listeners[id]; ok {
 				_ = l.Close()
 				delete(m.listeners, id)
@@ -194,15 +287,9 @@ func (m *Manager) exposeWithSource(_ context.Context, spec ExposeSpec, source Fo
 			m.mu.Unlock()
 			return nil, fmt.Errorf("marshal spotlight forward: %w", err)
 		}
-		if err := m.repo.UpsertSpotlightForwardRow(store.SpotlightForwardRow{
-			ID:          fwd.ID,
-			WorkspaceID: fwd.WorkspaceID,
-			LocalPort:   fwd.LocalPort,
-			Payload:     payload,
-			CreatedAt:   fwd.CreatedAt,
-		}); err != nil {
+		if err := m.repo.UpsertSpotlightForwardRow(forwardRow(fwd, payload)); err != nil {
 			delete(m.forwards, id)
-			delete(m.localToID, spec.LocalPort)
+			delete(m.localToID, key)
 			if l, ok := m.listeners[id]; ok {
 				_ = l.Close()
 				delete(m.listeners, id)
@@ -218,12 +305,132 @@ func (m *Manager) exposeWithSource(_ context.Context, spec ExposeSpec, source Fo
 	return &copy, nil
 }
 
+// bindLocked listens on spec.LocalPort, or with spec.Remap on the first free
+// port from the workspace's remap candidates. Unix forwards bind
+// spec.LocalPath. Caller must hold m.mu lock.
+func (m *Manager) bindLocked(host, protocol string, spec ExposeSpec, requested int) (io.Closer, int, error) {
+	if protocol == ProtocolUnix {
+		listener, err := listenUnixSocket(spec.LocalPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		return listener, 0, nil
+	}
+	candidates := []int{spec.LocalPort}
+	if spec.Remap {
+		candidates = append(candidates, RemapCandidates(spec.WorkspaceID, requested)...)
+	}
+	var lastErr error
+	for _, port := range candidates {
+		if existing, ok := m.localToID[localKey(protocol, port, "")]; ok {
+			lastErr = fmt.Errorf("local %s port %d already in use by %s", protocol, port, existing)
+			continue
+		}
+		listener, err := listenPort(protocol, host, port)
+		if err != nil {
+			lastErr = fmt.Errorf("bind local spotlight port: %w", err)
+			continue
+		}
+		return listener, port, nil
+	}
+	if spec.Remap {
+		return nil, 0, fmt.Errorf("no free local port for %d after %d attempts: %w", requested, len(candidates), lastErr)
+	}
+	return nil, 0, lastErr
+}
+
+// RemapCandidates returns the ordered local ports tried for a workspace when
+// port is unavailable. The starting block is derived from the workspace id,
+// so the first choice is stable across daemon restarts.
+func RemapCandidates(workspaceID string, port int) []int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(workspaceID))
+	start := int(h.Sum32() % remapBlocks)
+	out := make([]int, 0, maxRemapAttempts)
+	for i := 0; i < remapBlocks && len(out) < maxRemapAttempts; i++ {
+		candidate := remapRangeStart + ((start+i)%remapBlocks)*remapBlockSize + port%remapBlockSize
+		if candidate != port {
+			out = append(out, candidate)
+		}
+	}
+	return out
+}
+
+// normalizeExposeSpec validates spec for its protocol and returns the
+// normalized protocol name.
+func normalizeExposeSpec(spec *ExposeSpec) (string, error) {
+	protocol := strings.ToLower(strings.TrimSpace(spec.Protocol))
+	if protocol == "" {
+		protocol = ProtocolTCP
+	}
+	switch protocol {
+	case ProtocolTCP, ProtocolUDP:
+		if spec.RemotePort <= 0 || spec.LocalPort <= 0 {
+			return "", fmt.Errorf("remotePort and localPort must be > 0")
+		}
+	case ProtocolUnix:
+		if !filepath.IsAbs(spec.LocalPath) || !filepath.IsAbs(spec.RemotePath) {
+			return "", fmt.Errorf("unix forwards require absolute localPath and remotePath")
+		}
+		spec.LocalPath = filepath.Clean(spec.LocalPath)
+		spec.RemotePath = filepath.Clean(spec.RemotePath)
+		spec.LocalPort, spec.RemotePort, spec.RequestedPort = 0, 0, 0
+	default:
+		return "", fmt.Errorf("unsupported protocol %q (want tcp, udp or unix)", spec.Protocol)
+	}
+	return protocol, nil
+}
+
+// localKey identifies the host-side endpoint of a forward.
+func localKey(protocol string, port int, path string) string {
+	if protocol == ProtocolUnix {
+		return protocol + ":" + path
+	}
+	return protocol + ":" + strconv.Itoa(port)
+}
+
+func forwardKey(fwd *Forward) string {
+	return localKey(fwd.Protocol, fwd.LocalPort, fwd.LocalPath)
+}
+
+func describeLocal(protocol string, port int, path string) string {
+	if protocol == ProtocolUnix {
+		return "socket " + path
+	}
+	if protocol == ProtocolTCP {
+		return fmt.Sprintf("port %d", port)
+	}
+	return fmt.Sprintf("%s port %d", protocol, port)
+}
+
+func forwardRow(fwd *Forward, payload []byte) store.SpotlightForwardRow {
+	return store.SpotlightForwardRow{
+		ID:          fwd.ID,
+		WorkspaceID: fwd.WorkspaceID,
+		Protocol:    fwd.Protocol,
+		LocalPort:   fwd.LocalPort,
+		LocalPath:   fwd.LocalPath,
+		Payload:     payload,
+		CreatedAt:   fwd.CreatedAt,
+	}
+}
+
+func forwardRequestedPort(fwd *Forward) int {
+	if fwd.RequestedPort > 0 {
+		return fwd.RequestedPort
+	}
+	return fwd.LocalPort
+}
+
 func (m *Manager) List(workspaceID string) []*Forward {
 	m.mu.RLock()
 	all := make([]*Forward, 0, len(m.forwards))
 	for _, fwd := range m.forwards {
 		if workspaceID == "" || fwd.WorkspaceID == workspaceID {
 			copy := *fwd
+			if relay, ok := m.listeners[fwd.ID].(*udpRelay); ok {
+				copy.Sessions = relay.SessionCount()
+			}
 			all = append(all, &copy)
 		}
 	}
@@ -253,7 +460,7 @@ func (m *Manager) Close(id string) bool {
 	}
 
 	delete(m.forwards, id)
-	delete(m.localToID, fwd.LocalPort)
+	delete(m.localToID, forwardKey(fwd))
 	delete(m.listeners, id)
 	m.mu.Unlock()
 	if listener != nil {
@@ -265,9 +472,14 @@ func (m *Manager) Close(id string) bool {
 // AutoExpose creates a forward for an auto-detected port.
 // It deduplicates by (workspaceID, remotePort) rather than localPort.
 // If a forward already exists for the same workspace and remote port, it updates LastSeenAt.
+// With spec.Remap a taken local port is remapped as in Expose.
 func (m *Manager) AutoExpose(spec ExposeSpec) (*Forward, error) {
-	if spec.RemotePort <= 0 || spec.LocalPort <= 0 {
-		return nil, fmt.Errorf("remotePort and localPort must be > 0")
+	protocol, err := normalizeExposeSpec(&spec)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == ProtocolUnix {
+		return nil, fmt.Errorf("unix sockets cannot be auto-exposed")
 	}
 
 	m.mu.Lock()
@@ -275,7 +487,7 @@ func (m *Manager) AutoExpose(spec ExposeSpec) (*Forward, error) {
 
 	// Check if we already have a forward for this workspace + remote port
 	for _, fwd := range m.forwards {
-		if fwd.WorkspaceID == spec.WorkspaceID && fwd.RemotePort == spec.RemotePort {
+		if fwd.WorkspaceID == spec.WorkspaceID && fwd.Protocol == protocol && fwd.RemotePort == spec.RemotePort {
 			// Update LastSeenAt and return existing
 			now := time.Now().UTC()
 			fwd.LastSeenAt = &now
@@ -285,14 +497,6 @@ func (m *Manager) AutoExpose(spec ExposeSpec) (*Forward, error) {
 		}
 	}
 
-	// Check if local port is already in use by a different forward
-	if existingID, ok := m.localToID[spec.LocalPort]; ok {
-		existing := m.forwards[existingID]
-		if existing != nil && (existing.WorkspaceID != spec.WorkspaceID || existing.RemotePort != spec.RemotePort) {
-			return nil, fmt.Errorf("local port %d already in use by %s", spec.LocalPort, existingID)
-		}
-	}
-
 	host := spec.Host
 	if host == "" {
 		host = "127.0.0.1"
@@ -310,32 +514,40 @@ func (m *Manager) AutoExpose(spec ExposeSpec) (*Forward, error) {
 		}
 	}
 
+	requested := spec.RequestedPort
+	if requested <= 0 {
+		requested = spec.LocalPort
+	}
+	listener, localPort, err := m.bindLocked(host, protocol, spec, requested)
+	if err != nil {
+		return nil, err
+	}
+
 	fwd := &Forward{
 		ID:          id,
 		WorkspaceID: spec.WorkspaceID,
 		Service:     spec.Service,
+		Protocol:    protocol,
 		RemotePort:  spec.RemotePort,
-		LocalPort:   spec.LocalPort,
+		LocalPort:   localPort,
 		Host:        host,
 		Source:      ForwardSourceAutoDetected,
 		CreatedAt:   now,
 		LastSeenAt:  &now,
 	}
-
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, spec.LocalPort))
-	if err != nil {
-		return nil, fmt.Errorf("bind local spotlight port: %w", err)
+	if requested != localPort {
+		fwd.RequestedPort = requested
 	}
 
+	key := forwardKey(fwd)
 	m.forwards[id] = fwd
-	m.localToID[spec.LocalPort] = id
+	m.localToID[key] = id
 	m.listeners[id] = listener
-	targetAddr := fmt.Sprintf("%s:%d", host, spec.RemotePort)
-	go serveForward(listener, targetAddr)
+	go m.serveForwardListener(listener, fwd)
 
 	if err := m.persistForwardLocked(fwd); err != nil {
 		delete(m.forwards, id)
-		delete(m.localToID, spec.LocalPort)
+		delete(m.localToID, key)
 		if l, ok := m.listeners[id]; ok {
 			_ = l.Close()
 			delete(m.listeners, id)
@@ -363,6 +575,28 @@ func (m *Manager) UpdateLastSeen(id string) bool {
 	return true
 }
 
+// CloseAutoDetected closes the auto-detected forwards of workspaceID that
+// target remotePort and returns how many were closed. Manual and compose
+// forwards are left alone.
+func (m *Manager) CloseAutoDetected(workspaceID string, remotePort int) int {
+	var ids []string
+	m.mu.RLock()
+	for id, fwd := range m.forwards {
+		if fwd.Source == ForwardSourceAutoDetected && fwd.WorkspaceID == workspaceID && fwd.RemotePort == remotePort {
+			ids = append(ids, id)
+		}
+	}
+	m.mu.RUnlock()
+
+	closed := 0
+	for _, id := range ids {
+		if m.Close(id) {
+			closed++
+		}
+	}
+	return closed
+}
+
 // CleanupStaleAutoDetected removes auto-detected forwards that haven't been seen since before the given time.
 // Returns the number of forwards removed.
 func (m *Manager) CleanupStaleAutoDetected(workspaceID string, before time.Time) int {
@@ -383,7 +617,7 @@ func (m *Manager) CleanupStaleAutoDetected(workspaceID string, before time.Time)
 				_ = m.repo.DeleteSpotlightForwardRow(id)
 			}
 			delete(m.forwards, id)
-			delete(m.localToID, fwd.LocalPort)
+			delete(m.localToID, forwardKey(fwd))
 			delete(m.listeners, id)
 			if listener != nil {
 				_ = listener.Close()
@@ -404,27 +638,85 @@ func (m *Manager) persistForwardLocked(fwd *Forward) error {
 	if err != nil {
 		return fmt.Errorf("marshal spotlight forward: %w", err)
 	}
-	return m.repo.UpsertSpotlightForwardRow(store.SpotlightForwardRow{
-		ID:          fwd.ID,
-		WorkspaceID: fwd.WorkspaceID,
-		LocalPort:   fwd.LocalPort,
-		Payload:     payload,
-		CreatedAt:   fwd.CreatedAt,
-	})
+	return m.repo.UpsertSpotlightForwardRow(forwardRow(fwd, payload))
+}
+
+// listenPort binds a tcp listener or udp relay on host:port.
+func listenPort(protocol, host string, port int) (io.Closer, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if protocol == ProtocolUDP {
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return newUDPRelay(pc), nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnixSocket binds path, replacing a stale socket file left behind by
+// a previous daemon. A socket that still accepts connections is not touched.
+func listenUnixSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("bind local spotlight socket: %s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("bind local spotlight socket: %s is in use", path)
+		}
+		_ = os.Remove(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create socket dir: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("bind local spotlight socket: %w", err)
+	}
+	return listener, nil
+}
+
+func (m *Manager) serveForwardListener(listener io.Closer, fwd *Forward) {
+	switch l := listener.(type) {
+	case *udpRelay:
+		l.serve(net.JoinHostPort(fwd.Host, strconv.Itoa(fwd.RemotePort)))
+	case net.Listener:
+		if fwd.Protocol == ProtocolUnix {
+			workspaceID, path := fwd.WorkspaceID, fwd.RemotePath
+			serveForward(l, func() (net.Conn, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				m.mu.RLock()
+				dial := m.socketDialer
+				m.mu.RUnlock()
+				if dial != nil {
+					return dial(ctx, workspaceID, path)
+				}
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			})
+			return
+		}
+		targetAddr := net.JoinHostPort(fwd.Host, strconv.Itoa(fwd.RemotePort))
+		serveForward(l, func() (net.Conn, error) {
+			return net.DialTimeout("tcp", targetAddr, 5*time.Second)
+		})
+	}
 }
 
-func serveForward(listener net.Listener, targetAddr string) {
+func serveForward(listener net.Listener, dial func() (net.Conn, error)) {
 	for {
 		clientConn, err := listener.Accept()
 		if err != nil {
 			return
 		}
-		go proxyTCP(clientConn, targetAddr)
+		go proxyConn(clientConn, dial)
 	}
 }
 
-func proxyTCP(clientConn net.Conn, targetAddr string) {
-	upstreamConn, err := net.DialTimeout("tcp", targetAddr, 5*time.Second)
+func proxyConn(clientConn net.Conn, dial func() (net.Conn, error)) {
+	upstreamConn, err := dial()
 	if err != nil {
 		_ = clientConn.Close()
 		return
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -237,3 +241,253 @@ func freeTCPPort(t *testing.T) int {
 	}
 	return addr.Port
 }
+
+func TestManagerExposeRemapsCollisionAcrossWorkspaces(t *testing.T) {
+	mgr := NewManager()
+	port := freeTCPPort(t)
+
+	first, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-a", RemotePort: 8080, LocalPort: port, Remap: true})
+	if err != nil {
+		t.Fatalf("expose first: %v", err)
+	}
+	defer mgr.Close(first.ID)
+	if first.LocalPort != port || first.RequestedPort != 0 {
+		t.Fatalf("expected first forward on requested port, got %#v", first)
+	}
+
+	second, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-b", RemotePort: 8080, LocalPort: port, Remap: true})
+	if err != nil {
+		t.Fatalf("expose second: %v", err)
+	}
+	defer mgr.Close(second.ID)
+	if second.LocalPort == port || second.RequestedPort != port {
+		t.Fatalf("expected remapped forward, got %#v", second)
+	}
+	found := false
+	for _, candidate := range RemapCandidates("ws-b", port) {
+		if candidate == second.LocalPort {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("expected local port %d from ws-b remap candidates", second.LocalPort)
+	}
+
+	again, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-b", RemotePort: 8080, LocalPort: second.LocalPort, RequestedPort: port, Remap: true})
+	if err != nil {
+		t.Fatalf("expose again: %v", err)
+	}
+	if again.ID != second.ID {
+		t.Fatalf("expected existing forward to be reused, got %s want %s", again.ID, second.ID)
+	}
+
+	if _, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-c", RemotePort: 8080, LocalPort: port}); err == nil {
+		t.Fatal("expected collision error without remap")
+	}
+}
+
+func TestRemapCandidatesAreStablePerWorkspace(t *testing.T) {
+	a := RemapCandidates("ws-a", 3000)
+	b := RemapCandidates("ws-a", 3000)
+	if len(a) == 0 || a[0] != b[0] {
+		t.Fatalf("expected stable candidates, got %v and %v", a, b)
+	}
+	for _, p := range a {
+		if p < remapRangeStart || p > 65535 || p%remapBlockSize != 0 {
+			t.Fatalf("unexpected candidate %d", p)
+		}
+	}
+}
+
+func TestManagerExposeUDPRelaysDatagramsPerSession(t *testing.T) {
+	upstream, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen upstream: %v", err)
+	}
+	t.Cleanup(func() { _ = upstream.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := upstream.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = upstream.WriteTo(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve udp port: %v", err)
+	}
+	localPort := probe.LocalAddr().(*net.UDPAddr).Port
+	_ = probe.Close()
+
+	mgr := NewManager()
+	fwd, err := mgr.Expose(context.Background(), ExposeSpec{
+		WorkspaceID: "ws-1",
+		Protocol:    "udp",
+		RemotePort:  upstream.LocalAddr().(*net.UDPAddr).Port,
+		LocalPort:   localPort,
+	})
+	if err != nil {
+		t.Fatalf("expose udp: %v", err)
+	}
+	t.Cleanup(func() { mgr.Close(fwd.ID) })
+	if fwd.Protocol != ProtocolUDP {
+		t.Fatalf("expected udp forward, got %q", fwd.Protocol)
+	}
+
+	for _, msg := range []string{"a", "b"} {
+		conn, err := net.Dial("udp", fwd.Host+":"+strconv.Itoa(fwd.LocalPort))
+		if err != nil {
+			t.Fatalf("dial forward: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read reply: %v", err)
+		}
+		if got := string(buf[:n]); got != "echo:"+msg {
+			t.Fatalf("expected echo:%s, got %q", msg, got)
+		}
+	}
+
+	list := mgr.List("ws-1")
+	if len(list) != 1 || list[0].Sessions != 2 {
+		t.Fatalf("expected one forward with 2 sessions, got %#v", list)
+	}
+
+	// A tcp forward may share the port number with the udp one.
+	if _, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-1", RemotePort: 9, LocalPort: localPort}); err != nil {
+		t.Fatalf("expected tcp forward on same port number to succeed: %v", err)
+	}
+}
+
+func TestManagerExposeUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "spot")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	remotePath := filepath.Join(dir, "guest.sock")
+	localPath := filepath.Join(dir, "host", "docker.sock")
+
+	upstream, err := net.Listen("unix", remotePath)
+	if err != nil {
+		t.Fatalf("listen upstream: %v", err)
+	}
+	t.Cleanup(func() { _ = upstream.Close() })
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	repo := &fakeSpotlightRepo{}
+	mgr, err := NewManagerWithRepository(repo)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	fwd, err := mgr.Expose(context.Background(), ExposeSpec{
+		WorkspaceID: "ws-1",
+		Protocol:    "unix",
+		LocalPath:   localPath,
+		RemotePath:  remotePath,
+	})
+	if err != nil {
+		t.Fatalf("expose unix: %v", err)
+	}
+	if len(repo.upserted) != 1 || repo.upserted[0].Protocol != ProtocolUnix || repo.upserted[0].LocalPath != localPath {
+		t.Fatalf("expected unix row to be persisted, got %#v", repo.upserted)
+	}
+
+	conn, err := net.Dial("unix", localPath)
+	if err != nil {
+		t.Fatalf("dial local socket: %v", err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("expected ping echo, got %q (%v)", buf, err)
+	}
+	_ = conn.Close()
+
+	if _, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-2", Protocol: "unix", LocalPath: localPath, RemotePath: remotePath}); err == nil {
+		t.Fatal("expected second forward on the same socket path to fail")
+	}
+
+	if !mgr.Close(fwd.ID) {
+		t.Fatal("expected close to succeed")
+	}
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Fatalf("expected local socket to be removed on close, stat err=%v", err)
+	}
+}
+
+func TestUnixForwardUsesSocketDialer(t *testing.T) {
+	dir, err := os.MkdirTemp("", "spot")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	localPath := filepath.Join(dir, "docker.sock")
+
+	mgr := NewManager()
+	dialed := make(chan string, 1)
+	mgr.SetSocketDialer(func(_ context.Context, workspaceID, path string) (net.Conn, error) {
+		dialed <- workspaceID + " " + path
+		guest, host := net.Pipe()
+		go func() {
+			defer guest.Close()
+			_, _ = io.Copy(guest, guest)
+		}()
+		return host, nil
+	})
+	if _, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-1", Protocol: "unix", LocalPath: localPath, RemotePath: "/var/run/docker.sock"}); err != nil {
+		t.Fatalf("expose unix: %v", err)
+	}
+
+	conn, err := net.Dial("unix", localPath)
+	if err != nil {
+		t.Fatalf("dial local socket: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("expected ping echo, got %q (%v)", buf, err)
+	}
+	if got := <-dialed; got != "ws-1 /var/run/docker.sock" {
+		t.Fatalf("expected guest socket to be dialed for the workspace, got %q", got)
+	}
+}
+
+func TestExposeRejectsUnknownProtocol(t *testing.T) {
+	mgr := NewManager()
+	if _, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-1", Protocol: "sctp", RemotePort: 1, LocalPort: 1}); err == nil {
+		t.Fatal("expected unsupported protocol error")
+	}
+	if _, err := mgr.Expose(context.Background(), ExposeSpec{WorkspaceID: "ws-1", Protocol: "unix", LocalPath: "rel.sock", RemotePath: "/x.sock"}); err == nil {
+		t.Fatal("expected relative socket path to be rejected")
+	}
+}
@@ -3,6 +3,7 @@ package spotlight
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -24,14 +25,36 @@ type DiscoveredPort struct {
 	Process string `json:"process,omitempty"` // process name if available
 }
 
-// PortMonitor periodically scans workspaces for listening ports and auto-exposes them.
+// PortWatcher is implemented by scanners that can subscribe to the guest's
+// listening-port set instead of being polled.
+type PortWatcher interface {
+	// WatchPorts calls onChange with the full port set every time it changes
+	// until ctx is cancelled or the subscription breaks. It returns
+	// ErrPortWatchUnsupported when the guest agent predates ports.watch.
+	WatchPorts(ctx context.Context, workspaceID string, onChange func([]DiscoveredPort)) error
+}
+
+// ErrPortWatchUnsupported reports that the guest agent rejected ports.watch.
+var ErrPortWatchUnsupported = errors.New("guest agent does not support ports.watch")
+
+// AutoExposeRule decides whether a newly detected port is forwarded to the
+// host, and how. WorkspaceID and RemotePort default to the detected port.
+type AutoExposeRule func(workspaceID string, port DiscoveredPort) (ExposeSpec, bool)
+
+// PortMonitor tracks listening ports in workspaces. It subscribes to
+// ports.changed events from the guest agent and falls back to polling for
+// agents without ports.watch. Newly seen ports are passed through the
+// auto-expose rule; auto-detected forwards are closed when their port goes
+// away.
 type PortMonitor struct {
+	mgr      *Manager
 	scanner  PortScanner
 	interval time.Duration
 
 	mu         sync.RWMutex
 	workspaces map[string]*workspaceMonitor
 	latest     map[string][]DiscoveredPort
+	rule       AutoExposeRule
 }
 
 type workspaceMonitor struct {
@@ -39,14 +62,17 @@ type workspaceMonitor struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 	lastScan    time.Time
+	lastErr     string
 }
 
-// NewPortMonitor creates a new port monitor.
-func NewPortMonitor(_ *Manager, scanner PortScanner, interval time.Duration) *PortMonitor {
+// NewPortMonitor creates a new port monitor. interval is the polling period
+// for agents without ports.watch and the resubscribe delay for those with it.
+func NewPortMonitor(mgr *Manager, scanner PortScanner, interval time.Duration) *PortMonitor {
 	if interval <= 0 {
 		interval = 5 * time.Second
 	}
 	return &PortMonitor{
+		mgr:        mgr,
 		scanner:    scanner,
 		interval:   interval,
 		workspaces: make(map[string]*workspaceMonitor),
@@ -54,6 +80,14 @@ func NewPortMonitor(_ *Manager, scanner PortScanner, interval time.Duration) *Po
 	}
 }
 
+// SetAutoExposeRule installs the rule applied to newly detected ports. A nil
+// rule disables auto-expose.
+func (pm *PortMonitor) SetAutoExposeRule(rule AutoExposeRule) {
+	pm.mu.Lock()
+	pm.rule = rule
+	pm.mu.Unlock()
+}
+
 // StartWorkspace begins monitoring a workspace for listening ports.
 func (pm *PortMonitor) StartWorkspace(workspaceID string) error {
 	if workspaceID == "" {
@@ -87,6 +121,7 @@ func (pm *PortMonitor) StopWorkspace(workspaceID string) {
 		mon.cancel()
 		delete(pm.workspaces, workspaceID)
 	}
+	delete(pm.latest, workspaceID)
 }
 
 // IsMonitoring returns true if the workspace is being monitored.
@@ -108,6 +143,30 @@ func (pm *PortMonitor) ListDiscovered(workspaceID string) []DiscoveredPort {
 }
 
 func (pm *PortMonitor) monitorLoop(ctx context.Context, workspaceID string) {
+	if watcher, ok := pm.scanner.(PortWatcher); ok {
+		for ctx.Err() == nil {
+			err := watcher.WatchPorts(ctx, workspaceID, func(ports []DiscoveredPort) {
+				pm.applyPorts(workspaceID, ports)
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, ErrPortWatchUnsupported) {
+				log.Printf("[PortMonitor] %s: agent has no ports.watch, polling every %s", workspaceID, pm.interval)
+				break
+			}
+			// The subscription dropped (agent restart, VM pause). Catch up
+			// with one scan and resubscribe after a pause.
+			pm.noteError(workspaceID, err)
+			pm.scanWorkspace(workspaceID)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pm.interval):
+			}
+		}
+	}
+
 	ticker := time.NewTicker(pm.interval)
 	defer ticker.Stop()
 
@@ -125,35 +184,93 @@ func (pm *PortMonitor) monitorLoop(ctx context.Context, workspaceID string) {
 }
 
 func (pm *PortMonitor) scanWorkspace(workspaceID string) {
-	log.Printf("[PortMonitor] Starting scan for workspace: %s", workspaceID)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	discovered, err := pm.scanner.ScanPorts(ctx, workspaceID)
 	if err != nil {
-		log.Printf("[PortMonitor] ScanPorts error for workspace %s: %v", workspaceID, err)
+		pm.noteError(workspaceID, err)
 		return
 	}
+	pm.applyPorts(workspaceID, discovered)
+}
 
-	log.Printf("[PortMonitor] Discovered %d ports for workspace %s: %+v", len(discovered), workspaceID, discovered)
+// noteError logs err once per distinct message so an unreachable agent does
+// not flood the log every interval.
+func (pm *PortMonitor) noteError(workspaceID string, err error) {
+	if err == nil {
+		return
+	}
+	pm.mu.Lock()
+	mon, ok := pm.workspaces[workspaceID]
+	repeat := ok && mon.lastErr == err.Error()
+	if ok {
+		mon.lastErr = err.Error()
+	}
+	pm.mu.Unlock()
+	if !repeat {
+		log.Printf("[PortMonitor] %s: %v", workspaceID, err)
+	}
+}
 
+// applyPorts records the current port set for a workspace and applies
+// auto-expose to ports that were not present in the previous set.
+func (pm *PortMonitor) applyPorts(workspaceID string, discovered []DiscoveredPort) {
 	filtered := make([]DiscoveredPort, 0, len(discovered))
+	seen := make(map[int]bool, len(discovered))
 	for _, port := range discovered {
-		if port.Port <= 0 {
+		if port.Port <= 0 || seen[port.Port] {
 			continue
 		}
+		seen[port.Port] = true
 		filtered = append(filtered, port)
 	}
 
 	pm.mu.Lock()
-	if mon, exists := pm.workspaces[workspaceID]; exists {
-		mon.lastScan = time.Now().UTC()
+	mon, exists := pm.workspaces[workspaceID]
+	if !exists {
+		pm.mu.Unlock()
+		return
+	}
+	mon.lastScan = time.Now().UTC()
+	mon.lastErr = ""
+	previous := make(map[int]bool, len(pm.latest[workspaceID]))
+	for _, p := range pm.latest[workspaceID] {
+		previous[p.Port] = true
 	}
 	pm.latest[workspaceID] = filtered
+	rule := pm.rule
 	pm.mu.Unlock()
 
-	log.Printf("[PortMonitor] Scan complete for workspace %s", workspaceID)
+	if pm.mgr == nil {
+		return
+	}
+	for _, port := range filtered {
+		if previous[port.Port] || rule == nil {
+			continue
+		}
+		spec, ok := rule(workspaceID, port)
+		if !ok {
+			continue
+		}
+		if spec.WorkspaceID == "" {
+			spec.WorkspaceID = workspaceID
+		}
+		if spec.RemotePort <= 0 {
+			spec.RemotePort = port.Port
+		}
+		if spec.LocalPort <= 0 {
+			spec.LocalPort = port.Port
+		}
+		if _, err := pm.mgr.AutoExpose(spec); err != nil {
+			log.Printf("[PortMonitor] %s: auto-expose port %d: %v", workspaceID, port.Port, err)
+		}
+	}
+	for port := range previous {
+		if !seen[port] {
+			pm.mgr.CloseAutoDetected(workspaceID, port)
+		}
+	}
 }
 
 // ShellPortScanner implements PortScanner using the shell protocol.
@@ -168,7 +285,6 @@ func NewShellPortScanner(agentConnFn func(ctx context.Context, workspaceID strin
 
 // ScanPorts scans for listening ports using the shell protocol.
 func (s *ShellPortScanner) ScanPorts(ctx context.Context, workspaceID string) ([]DiscoveredPort, error) {
-	log.Printf("[PortMonitor] ShellPortScanner: Getting agent connection for workspace %s", workspaceID)
 	conn, err := s.agentConnFn(ctx, workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("get agent connection: %w", err)
@@ -184,7 +300,6 @@ func (s *ShellPortScanner) ScanPorts(ctx context.Context, workspaceID string) ([
 	enc := json.NewEncoder(conn)
 	dec := json.NewDecoder(conn)
 
-	log.Printf("[PortMonitor] ShellPortScanner: Sending scan request for workspace %s", workspaceID)
 	if err := enc.Encode(req); err != nil {
 		return nil, fmt.Errorf("send scan request: %w", err)
 	}
@@ -203,9 +318,7 @@ func (s *ShellPortScanner) ScanPorts(ctx context.Context, workspaceID string) ([
 
 			respType, _ := resp["type"].(string)
 			if respType == "ports.result" {
-				ports := parsePortsResult(resp)
-				log.Printf("[PortMonitor] ShellPortScanner: Received %d ports from agent for workspace %s", len(ports), workspaceID)
-				resultCh <- ports
+				resultCh <- parsePortsResult(resp)
 				return
 			}
 		}
@@ -221,6 +334,46 @@ func (s *ShellPortScanner) ScanPorts(ctx context.Context, workspaceID string) ([
 	}
 }
 
+// WatchPorts subscribes to ports.changed events over a dedicated agent
+// connection.
+func (s *ShellPortScanner) WatchPorts(ctx context.Context, workspaceID string, onChange func([]DiscoveredPort)) error {
+	conn, err := s.agentConnFn(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("get agent connection: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	req := map[string]any{
+		"type": "ports.watch",
+		"id":   fmt.Sprintf("watch-%d", time.Now().UnixNano()),
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("send watch request: %w", err)
+	}
+
+	dec := json.NewDecoder(conn)
+	for {
+		var resp map[string]any
+		if err := dec.Decode(&resp); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("ports.watch stream: %w", err)
+		}
+		switch resp["type"] {
+		case "ports.changed":
+			onChange(parsePortsResult(resp))
+		case "result":
+			// Agents answer unknown request types with a failed result.
+			if code, _ := resp["exit_code"].(float64); code != 0 {
+				return ErrPortWatchUnsupported
+			}
+		}
+	}
+}
+
 func parsePortsResult(resp map[string]any) []DiscoveredPort {
 	portsData, ok := resp["ports"].([]any)
 	if !ok {
@@ -235,7 +388,7 @@ func parsePortsResult(resp map[string]any) []DiscoveredPort {
 		}
 
 		port := DiscoveredPort{}
-		
+
 		// Check for direct port field first
 		if pVal, ok := portMap["port"]; ok {
 			switch v := pVal.(type) {
@@ -249,7 +402,7 @@ func parsePortsResult(resp map[string]any) []DiscoveredPort {
 				}
 			}
 		}
-		
+
 		// Fall back to address parsing if port not found
 		if port.Port == 0 {
 			if addr, ok := portMap["address"].(string); ok {
@@ -265,7 +418,7 @@ func parsePortsResult(resp map[string]any) []DiscoveredPort {
 			// Port was found directly, but still capture address
 			port.Address = addr
 		}
-		
+
 		if proc, ok := portMap["process"].(string); ok {
 			port.Process = proc
 		}
@@ -0,0 +1,153 @@
+package spotlight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeWatchScanner struct {
+	events   chan []DiscoveredPort
+	watchErr error
+
+	mu    sync.Mutex
+	scan  []DiscoveredPort
+	scans int
+}
+
+func (f *fakeWatchScanner) ScanPorts(context.Context, string) ([]DiscoveredPort, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scans++
+	return f.scan, nil
+}
+
+func (f *fakeWatchScanner) WatchPorts(ctx context.Context, _ string, onChange func([]DiscoveredPort)) error {
+	if f.watchErr != nil {
+		return f.watchErr
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ports := <-f.events:
+			onChange(ports)
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestPortMonitorAppliesWatchEventsAndAutoExposeRule(t *testing.T) {
+	mgr := NewManager()
+	scanner := &fakeWatchScanner{events: make(chan []DiscoveredPort)}
+	pm := NewPortMonitor(mgr, scanner, time.Hour)
+	exposed := freeTCPPort(t)
+	ignored := freeTCPPort(t)
+	pm.SetAutoExposeRule(func(_ string, port DiscoveredPort) (ExposeSpec, bool) {
+		return ExposeSpec{Service: port.Process}, port.Port == exposed
+	})
+
+	if err := pm.StartWorkspace("ws-1"); err != nil {
+		t.Fatalf("start workspace: %v", err)
+	}
+	t.Cleanup(func() { pm.StopWorkspace("ws-1") })
+
+	scanner.events <- []DiscoveredPort{{Port: exposed, Process: "vite"}, {Port: ignored}}
+	waitFor(t, "auto-exposed forward", func() bool { return len(mgr.List("ws-1")) == 1 })
+	fwd := mgr.List("ws-1")[0]
+	if fwd.RemotePort != exposed || fwd.LocalPort != exposed || fwd.Source != ForwardSourceAutoDetected || fwd.Service != "vite" {
+		t.Fatalf("unexpected forward: %#v", fwd)
+	}
+	if got := pm.ListDiscovered("ws-1"); len(got) != 2 {
+		t.Fatalf("expected 2 discovered ports, got %#v", got)
+	}
+
+	scanner.events <- []DiscoveredPort{{Port: ignored}}
+	waitFor(t, "forward closed after port vanished", func() bool { return len(mgr.List("ws-1")) == 0 })
+	if got := pm.ListDiscovered("ws-1"); len(got) != 1 || got[0].Port != ignored {
+		t.Fatalf("unexpected discovered ports: %#v", got)
+	}
+
+	scanner.mu.Lock()
+	scans := scanner.scans
+	scanner.mu.Unlock()
+	if scans != 0 {
+		t.Fatalf("expected no polling while subscribed, got %d scans", scans)
+	}
+}
+
+func TestPortMonitorFallsBackToPollingForOldAgents(t *testing.T) {
+	scanner := &fakeWatchScanner{watchErr: ErrPortWatchUnsupported, scan: []DiscoveredPort{{Port: 8080}}}
+	pm := NewPortMonitor(NewManager(), scanner, 20*time.Millisecond)
+	if err := pm.StartWorkspace("ws-1"); err != nil {
+		t.Fatalf("start workspace: %v", err)
+	}
+	t.Cleanup(func() { pm.StopWorkspace("ws-1") })
+
+	waitFor(t, "polled ports", func() bool { return len(pm.ListDiscovered("ws-1")) == 1 })
+	waitFor(t, "repeated polling", func() bool {
+		scanner.mu.Lock()
+		defer scanner.mu.Unlock()
+		return scanner.scans >= 2
+	})
+}
+
+func TestShellPortScannerWatchPorts(t *testing.T) {
+	agent := func(reply func(enc *json.Encoder, id string)) func(context.Context, string) (net.Conn, error) {
+		return func(context.Context, string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				var req map[string]any
+				if err := json.NewDecoder(server).Decode(&req); err != nil {
+					return
+				}
+				if req["type"] != "ports.watch" {
+					return
+				}
+				reply(json.NewEncoder(server), req["id"].(string))
+			}()
+			return client, nil
+		}
+	}
+
+	t.Run("streams ports.changed events", func(t *testing.T) {
+		scanner := NewShellPortScanner(agent(func(enc *json.Encoder, id string) {
+			_ = enc.Encode(map[string]any{"id": id, "type": "ports.changed", "ports": []any{map[string]any{"port": 3000, "process": "node"}}})
+			_ = enc.Encode(map[string]any{"id": id, "type": "ports.changed", "ports": []any{}})
+		}))
+		var got [][]DiscoveredPort
+		err := scanner.WatchPorts(context.Background(), "ws-1", func(ports []DiscoveredPort) { got = append(got, ports) })
+		if err == nil || errors.Is(err, ErrPortWatchUnsupported) {
+			t.Fatalf("expected stream error after agent closed, got %v", err)
+		}
+		if len(got) != 2 || len(got[0]) != 1 || got[0][0].Port != 3000 || got[0][0].Process != "node" || len(got[1]) != 0 {
+			t.Fatalf("unexpected events: %#v", got)
+		}
+	})
+
+	t.Run("reports unsupported for old agents", func(t *testing.T) {
+		scanner := NewShellPortScanner(agent(func(enc *json.Encoder, id string) {
+			_ = enc.Encode(map[string]any{"id": id, "type": "result", "exit_code": 1, "stderr": "unknown shell request type"})
+		}))
+		err := scanner.WatchPorts(context.Background(), "ws-1", func([]DiscoveredPort) {})
+		if !errors.Is(err, ErrPortWatchUnsupported) {
+			t.Fatalf("expected ErrPortWatchUnsupported, got %v", err)
+		}
+	})
+}
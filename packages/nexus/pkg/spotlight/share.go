@@ -0,0 +1,436 @@
+package spotlight
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultShareTTL is how long a share stays valid when no TTL is given.
+	DefaultShareTTL = 24 * time.Hour
+	// MaxShareTTL caps share lifetimes so forgotten links die on their own.
+	MaxShareTTL = 7 * 24 * time.Hour
+
+	// ShareTokenParam is the query parameter carrying a share token.
+	ShareTokenParam = "nexus_share"
+
+	maxShareAccessLog = 200
+)
+
+// ShareBasicAuth is an optional username/password layer on top of the share
+// token.
+type ShareBasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ShareSpec describes a share to create.
+type ShareSpec struct {
+	WorkspaceID string
+	Port        int
+	TTL         time.Duration
+	// BindAddress is the interface the share listens on. Empty picks the
+	// host's first non-loopback IPv4 address.
+	BindAddress string
+	// ListenPort is the port to listen on; 0 picks a free one.
+	ListenPort int
+	// ReadOnly rejects every method other than GET, HEAD and OPTIONS.
+	ReadOnly  bool
+	BasicAuth *ShareBasicAuth
+}
+
+// Share is a LAN-reachable, token-gated view of a workspace port.
+type Share struct {
+	ID            string     `json:"id"`
+	WorkspaceID   string     `json:"workspaceId"`
+	Port          int        `json:"port"`
+	URL           string     `json:"url"`
+	BindAddress   string     `json:"bindAddress"`
+	ListenPort    int        `json:"listenPort"`
+	ReadOnly      bool       `json:"readOnly,omitempty"`
+	BasicAuthUser string     `json:"basicAuthUser,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	Requests      int        `json:"requests"`
+	LastAccessAt  *time.Time `json:"lastAccessAt,omitempty"`
+}
+
+// ShareAccess is one entry of a share's access log.
+type ShareAccess struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// ShareManager owns the listeners behind spotlight shares. Shares live only
+// as long as the daemon; tokens are never persisted.
+type ShareManager struct {
+	mu     sync.Mutex
+	shares map[string]*shareEntry
+	nextID int
+	now    func() time.Time
+}
+
+type shareEntry struct {
+	share     Share
+	token     string
+	password  [32]byte
+	hasAuth   bool
+	upstream  http.Handler
+	server    *http.Server
+	expiry    *time.Timer
+	logs      []ShareAccess
+	logStart  int
+	cookieKey string
+}
+
+func NewShareManager() *ShareManager {
+	return &ShareManager{shares: make(map[string]*shareEntry), now: time.Now}
+}
+
+// Create binds a listener for spec and serves upstream to requests that
+// present the share token. The returned share's URL carries the token.
+func (m *ShareManager) Create(spec ShareSpec, upstream http.Handler) (*Share, error) {
+	if spec.WorkspaceID == "" {
+		return nil, fmt.Errorf("workspace id is required")
+	}
+	if spec.Port <= 0 || spec.Port > 65535 {
+		return nil, fmt.Errorf("port must be between 1 and 65535")
+	}
+	if spec.ListenPort < 0 || spec.ListenPort > 65535 {
+		return nil, fmt.Errorf("listen port must be between 1 and 65535")
+	}
+	ttl := spec.TTL
+	switch {
+	case ttl < 0:
+		return nil, fmt.Errorf("ttl must be positive")
+	case ttl == 0:
+		ttl = DefaultShareTTL
+	case ttl > MaxShareTTL:
+		return nil, fmt.Errorf("ttl must be at most %s", MaxShareTTL)
+	}
+	if spec.BasicAuth != nil && (spec.BasicAuth.Username == "" || spec.BasicAuth.Password == "") {
+		return nil, fmt.Errorf("basic auth needs both username and password")
+	}
+
+	bind := strings.TrimSpace(spec.BindAddress)
+	if bind == "" {
+		bind = LANAddress()
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(spec.ListenPort)))
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", bind, err)
+	}
+	token, err := newShareToken()
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	listenPort := listener.Addr().(*net.TCPAddr).Port
+
+	urlHost := bind
+	if ip := net.ParseIP(bind); ip != nil && ip.IsUnspecified() {
+		urlHost = LANAddress()
+	}
+
+	now := m.now()
+	m.mu.Lock()
+	m.nextID++
+	id := fmt.Sprintf("share-%d", m.nextID)
+	entry := &shareEntry{
+		share: Share{
+			ID:          id,
+			WorkspaceID: spec.WorkspaceID,
+			Port:        spec.Port,
+			URL:         "http://" + net.JoinHostPort(urlHost, strconv.Itoa(listenPort)) + "/?" + ShareTokenParam + "=" + token,
+			BindAddress: bind,
+			ListenPort:  listenPort,
+			ReadOnly:    spec.ReadOnly,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		},
+		token:     token,
+		upstream:  upstream,
+		cookieKey: ShareTokenParam + "_" + strings.ReplaceAll(id, "-", "_"),
+	}
+	if spec.BasicAuth != nil {
+		entry.hasAuth = true
+		entry.share.BasicAuthUser = spec.BasicAuth.Username
+		entry.password = sha256.Sum256([]byte(spec.BasicAuth.Username + ":" + spec.BasicAuth.Password))
+	}
+	entry.server = &http.Server{Handler: m.handler(entry), ReadHeaderTimeout: 10 * time.Second}
+	entry.expiry = time.AfterFunc(ttl, func() { m.Revoke(id) })
+	m.shares[id] = entry
+	share := entry.share
+	m.mu.Unlock()
+
+	go func() { _ = entry.server.Serve(listener) }()
+	return &share, nil
+}
+
+// List returns the live shares for workspaceID, or all shares when empty.
+func (m *ShareManager) List(workspaceID string) []*Share {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*Share, 0, len(m.shares))
+	for _, entry := range m.shares {
+		if workspaceID != "" && entry.share.WorkspaceID != workspaceID {
+			continue
+		}
+		share := entry.share
+		out = append(out, &share)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Revoke closes a share's listener and invalidates its token.
+func (m *ShareManager) Revoke(id string) bool {
+	m.mu.Lock()
+	entry, ok := m.shares[id]
+	if ok {
+		delete(m.shares, id)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	entry.expiry.Stop()
+	_ = entry.server.Close()
+	return true
+}
+
+// RevokeWorkspace revokes every share of workspaceID and returns how many
+// were revoked.
+func (m *ShareManager) RevokeWorkspace(workspaceID string) int {
+	n := 0
+	for _, share := range m.List(workspaceID) {
+		if m.Revoke(share.ID) {
+			n++
+		}
+	}
+	return n
+}
+
+// Logs returns up to limit of the most recent access log entries for a
+// share, oldest first. limit <= 0 returns everything retained.
+func (m *ShareManager) Logs(id string, limit int) ([]ShareAccess, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.shares[id]
+	if !ok {
+		return nil, false
+	}
+	ordered := make([]ShareAccess, 0, len(entry.logs))
+	ordered = append(ordered, entry.logs[entry.logStart:]...)
+	ordered = append(ordered, entry.logs[:entry.logStart]...)
+	if limit > 0 && len(ordered) > limit {
+		ordered = ordered[len(ordered)-limit:]
+	}
+	return ordered, true
+}
+
+func (m *ShareManager) record(entry *shareEntry, access ShareAccess) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.share.Requests++
+	at := access.Time
+	entry.share.LastAccessAt = &at
+	if len(entry.logs) < maxShareAccessLog {
+		entry.logs = append(entry.logs, access)
+		return
+	}
+	entry.logs[entry.logStart] = access
+	entry.logStart = (entry.logStart + 1) % maxShareAccessLog
+}
+
+func (m *ShareManager) handler(entry *shareEntry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := m.now()
+		rec := &shareResponseRecorder{ResponseWriter: w, status: http.StatusOK}
+		path := r.URL.Path
+		defer func() {
+			m.record(entry, ShareAccess{
+				Time:       start,
+				RemoteAddr: r.RemoteAddr,
+				Method:     r.Method,
+				Path:       path,
+				Status:     rec.status,
+				Bytes:      rec.bytes,
+				DurationMs: m.now().Sub(start).Milliseconds(),
+			})
+		}()
+		m.serveShare(entry, rec, r)
+	})
+}
+
+func (m *ShareManager) serveShare(entry *shareEntry, w http.ResponseWriter, r *http.Request) {
+	if !m.now().Before(entry.share.ExpiresAt) {
+		http.Error(w, "share expired", http.StatusGone)
+		return
+	}
+
+	query := r.URL.Query()
+	if token := query.Get(ShareTokenParam); token != "" {
+		if !tokenEqual(token, entry.token) {
+			http.Error(w, "invalid share token", http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     entry.cookieKey,
+			Value:    token,
+			Path:     "/",
+			Expires:  entry.share.ExpiresAt,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		// Drop the token from the address bar so it does not leak through
+		// history or Referer headers.
+		query.Del(ShareTokenParam)
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			clean := *r.URL
+			clean.RawQuery = query.Encode()
+			http.Redirect(w, r, clean.RequestURI(), http.StatusSeeOther)
+			return
+		}
+		r.URL.RawQuery = query.Encode()
+	} else if c, err := r.Cookie(entry.cookieKey); err != nil || !tokenEqual(c.Value, entry.token) {
+		http.Error(w, "share token required", http.StatusForbidden)
+		return
+	}
+	stripShareCookie(r, entry.cookieKey)
+
+	if entry.hasAuth {
+		user, pass, ok := r.BasicAuth()
+		sum := sha256.Sum256([]byte(user + ":" + pass))
+		if !ok || subtle.ConstantTimeCompare(sum[:], entry.password[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="nexus share", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		r.Header.Del("Authorization")
+	}
+
+	if entry.share.ReadOnly {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			http.Error(w, "share is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	entry.upstream.ServeHTTP(w, r)
+}
+
+// stripShareCookie removes the share cookie so it is not forwarded to the
+// workspace.
+func stripShareCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+}
+
+func tokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func newShareToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate share token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// LANAddress returns the first non-loopback IPv4 address of an interface
+// that is up, or 0.0.0.0 when none is found.
+func LANAddress() string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "0.0.0.0"
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip := ipnet.IP.To4(); ip != nil && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+				return ip.String()
+			}
+		}
+	}
+	return "0.0.0.0"
+}
+
+// shareResponseRecorder captures status and size for the access log while
+// still supporting websocket upgrades and streaming.
+type shareResponseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *shareResponseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *shareResponseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *shareResponseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *shareResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
@@ -0,0 +1,149 @@
+package spotlight
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shareClient(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookie jar: %v", err)
+	}
+	return &http.Client{Jar: jar, Timeout: 5 * time.Second}
+}
+
+func shareGet(t *testing.T, client *http.Client, method, url string, auth *ShareBasicAuth) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if auth != nil {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestShareManagerGatesRequestsByTokenAndLogsAccess(t *testing.T) {
+	m := NewShareManager()
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(ShareTokenParam + "_share_1"); err == nil {
+			t.Errorf("share cookie leaked upstream")
+		}
+		_, _ = io.WriteString(w, "hello "+r.URL.Path)
+	})
+	share, err := m.Create(ShareSpec{WorkspaceID: "ws-1", Port: 3000, BindAddress: "127.0.0.1"}, upstream)
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	t.Cleanup(func() { m.Revoke(share.ID) })
+	if !strings.Contains(share.URL, ShareTokenParam+"=") || share.ExpiresAt.Sub(share.CreatedAt) != DefaultShareTTL {
+		t.Fatalf("unexpected share: %#v", share)
+	}
+	base := strings.SplitN(share.URL, "?", 2)[0]
+
+	if code, _ := shareGet(t, shareClient(t), http.MethodGet, base, nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403 without token, got %d", code)
+	}
+	if code, _ := shareGet(t, shareClient(t), http.MethodGet, base+"?"+ShareTokenParam+"=wrong", nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for wrong token, got %d", code)
+	}
+
+	client := shareClient(t)
+	if code, body := shareGet(t, client, http.MethodGet, share.URL, nil); code != http.StatusOK || body != "hello /" {
+		t.Fatalf("expected token to be accepted, got %d %q", code, body)
+	}
+	if code, body := shareGet(t, client, http.MethodGet, base+"app", nil); code != http.StatusOK || body != "hello /app" {
+		t.Fatalf("expected cookie to be accepted, got %d %q", code, body)
+	}
+
+	entries, ok := m.Logs(share.ID, 0)
+	if !ok || len(entries) != 5 {
+		t.Fatalf("expected 5 access log entries, got %d %#v", len(entries), entries)
+	}
+	if entries[0].Status != http.StatusForbidden || entries[2].Status != http.StatusSeeOther || entries[4].Path != "/app" || entries[4].Bytes != int64(len("hello /app")) {
+		t.Fatalf("unexpected access log: %#v", entries)
+	}
+	if last, _ := m.Logs(share.ID, 1); len(last) != 1 || last[0].Path != "/app" {
+		t.Fatalf("expected limit to keep the newest entry, got %#v", last)
+	}
+	if listed := m.List("ws-1"); len(listed) != 1 || listed[0].Requests != 5 || listed[0].LastAccessAt == nil {
+		t.Fatalf("unexpected listed shares: %#v", listed)
+	}
+
+	if !m.Revoke(share.ID) {
+		t.Fatal("expected revoke to succeed")
+	}
+	if _, err := client.Get(base); err == nil {
+		t.Fatal("expected revoked share listener to be closed")
+	}
+	if len(m.List("")) != 0 || m.Revoke(share.ID) {
+		t.Fatal("expected share to be gone after revoke")
+	}
+}
+
+func TestShareManagerBasicAuthAndReadOnly(t *testing.T) {
+	m := NewShareManager()
+	auth := &ShareBasicAuth{Username: "review", Password: "s3cret"}
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("share credentials leaked upstream")
+		}
+		_, _ = io.WriteString(w, r.Method)
+	})
+	share, err := m.Create(ShareSpec{WorkspaceID: "ws-1", Port: 3000, BindAddress: "127.0.0.1", ReadOnly: true, BasicAuth: auth}, upstream)
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	t.Cleanup(func() { m.Revoke(share.ID) })
+	if share.BasicAuthUser != "review" || !share.ReadOnly {
+		t.Fatalf("unexpected share: %#v", share)
+	}
+
+	client := shareClient(t)
+	if code, _ := shareGet(t, client, http.MethodGet, share.URL, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", code)
+	}
+	if code, _ := shareGet(t, client, http.MethodGet, share.URL, &ShareBasicAuth{Username: "review", Password: "nope"}); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for wrong password, got %d", code)
+	}
+	if code, body := shareGet(t, client, http.MethodGet, share.URL, auth); code != http.StatusOK || body != http.MethodGet {
+		t.Fatalf("expected GET to pass, got %d %q", code, body)
+	}
+	base := strings.SplitN(share.URL, "?", 2)[0]
+	if code, _ := shareGet(t, client, http.MethodPost, base, auth); code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected read-only share to reject POST, got %d", code)
+	}
+}
+
+func TestShareManagerRejectsExpiredShares(t *testing.T) {
+	m := NewShareManager()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	share, err := m.Create(ShareSpec{WorkspaceID: "ws-1", Port: 3000, BindAddress: "127.0.0.1", TTL: time.Hour}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	t.Cleanup(func() { m.Revoke(share.ID) })
+
+	now = now.Add(2 * time.Hour)
+	if code, _ := shareGet(t, shareClient(t), http.MethodGet, share.URL, nil); code != http.StatusGone {
+		t.Fatalf("expected 410 for expired share, got %d", code)
+	}
+
+	if _, err := m.Create(ShareSpec{WorkspaceID: "ws-1", Port: 3000, BindAddress: "127.0.0.1", TTL: MaxShareTTL + time.Hour}, http.NotFoundHandler()); err == nil {
+		t.Fatal("expected ttl above the maximum to be rejected")
+	}
+}
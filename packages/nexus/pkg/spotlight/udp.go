@@ -0,0 +1,139 @@
+package spotlight
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// udpSessionIdleTimeout closes a UDP flow after this long without traffic
+// in either direction.
+const udpSessionIdleTimeout = 2 * time.Minute
+
+const maxUDPDatagram = 64 * 1024
+
+// udpRelay forwards datagrams from a local packet listener to a remote
+// address. Each client address gets its own upstream socket so replies are
+// routed back to the client that sent the request.
+type udpRelay struct {
+	pc net.PacketConn
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+	closed   bool
+}
+
+type udpSession struct {
+	client   net.Addr
+	upstream net.Conn
+
+	mu         sync.Mutex
+	lastActive time.Time
+}
+
+func newUDPRelay(pc net.PacketConn) *udpRelay {
+	return &udpRelay{pc: pc, sessions: make(map[string]*udpSession)}
+}
+
+func (r *udpRelay) serve(targetAddr string) {
+	buf := make([]byte, maxUDPDatagram)
+	for {
+		n, client, err := r.pc.ReadFrom(buf)
+		if err != nil {
+			r.Close()
+			return
+		}
+		sess, err := r.session(client, targetAddr)
+		if err != nil {
+			continue
+		}
+		sess.touch()
+		_, _ = sess.upstream.Write(buf[:n])
+	}
+}
+
+func (r *udpRelay) session(client net.Addr, targetAddr string) (*udpSession, error) {
+	key := client.String()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sess, ok := r.sessions[key]; ok {
+		return sess, nil
+	}
+	if r.closed {
+		return nil, net.ErrClosed
+	}
+	upstream, err := net.Dial("udp", targetAddr)
+	if err != nil {
+		return nil, err
+	}
+	sess := &udpSession{client: client, upstream: upstream, lastActive: time.Now()}
+	r.sessions[key] = sess
+	go r.pump(key, sess)
+	return sess, nil
+}
+
+// pump copies replies from upstream back to the client until the session
+// has been idle for udpSessionIdleTimeout or the relay is closed.
+func (r *udpRelay) pump(key string, sess *udpSession) {
+	defer r.dropSession(key, sess)
+	buf := make([]byte, maxUDPDatagram)
+	for {
+		_ = sess.upstream.SetReadDeadline(time.Now().Add(udpSessionIdleTimeout))
+		n, err := sess.upstream.Read(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() && !sess.idle() {
+				continue
+			}
+			return
+		}
+		sess.touch()
+		if _, err := r.pc.WriteTo(buf[:n], sess.client); err != nil {
+			return
+		}
+	}
+}
+
+func (r *udpRelay) dropSession(key string, sess *udpSession) {
+	r.mu.Lock()
+	if r.sessions[key] == sess {
+		delete(r.sessions, key)
+	}
+	r.mu.Unlock()
+	_ = sess.upstream.Close()
+}
+
+// SessionCount returns the number of live client flows.
+func (r *udpRelay) SessionCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sessions)
+}
+
+func (r *udpRelay) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	sessions := r.sessions
+	r.sessions = make(map[string]*udpSession)
+	r.mu.Unlock()
+
+	for _, sess := range sessions {
+		_ = sess.upstream.Close()
+	}
+	return r.pc.Close()
+}
+
+func (s *udpSession) touch() {
+	s.mu.Lock()
+	s.lastActive = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *udpSession) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.lastActive) >= udpSessionIdleTimeout
+}
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE spotlight_forwards ADD COLUMN protocol TEXT NOT NULL DEFAULT 'tcp';
+ALTER TABLE spotlight_forwards ADD COLUMN local_path TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_spotlight_forwards_local_port;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spotlight_forwards_local_endpoint ON spotlight_forwards(protocol, local_port, local_path);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_spotlight_forwards_local_endpoint;
+DELETE FROM spotlight_forwards WHERE protocol <> 'tcp';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spotlight_forwards_local_port ON spotlight_forwards(local_port);
+ALTER TABLE spotlight_forwards DROP COLUMN local_path;
+ALTER TABLE spotlight_forwards DROP COLUMN protocol;
@@ -26,9 +26,27 @@ type WorkspaceRow struct {
 type SpotlightForwardRow struct {
 	ID          string
 	WorkspaceID string
-	LocalPort   int
-	Payload     []byte
-	CreatedAt   time.Time
+	// Protocol is tcp, udp or unix; empty means tcp.
+	Protocol string
+	// LocalPort is the host port for tcp and udp forwards; LocalPath is the
+	// host socket path for unix forwards.
+	LocalPort int
+	LocalPath string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// spotlightRowProtocol returns the row's protocol, defaulting to tcp, and
+// whether the row names a usable local endpoint.
+func spotlightRowProtocol(row SpotlightForwardRow) (string, bool) {
+	protocol := row.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	if protocol == "unix" {
+		return protocol, row.LocalPath != ""
+	}
+	return protocol, row.LocalPort > 0
 }
 
 type NodeStore struct {
@@ -344,7 +362,7 @@ func (s *NodeStore) ReplaceSpotlightForwardRows(forwards []SpotlightForwardRow)
 
 	desired := make(map[string]struct{})
 	for _, fwd := range forwards {
-		if fwd.ID == "" || fwd.WorkspaceID == "" || fwd.LocalPort <= 0 || len(fwd.Payload) == 0 {
+		if _, ok := spotlightRowProtocol(fwd); !ok || fwd.ID == "" || fwd.WorkspaceID == "" || len(fwd.Payload) == 0 {
 			continue
 		}
 		desired[fwd.ID] = struct{}{}
@@ -361,11 +379,13 @@ func (s *NodeStore) ReplaceSpotlightForwardRows(forwards []SpotlightForwardRow)
 	}
 
 	stmt, err := tx.Prepare(
-		`INSERT INTO spotlight_forwards(id, workspace_id, local_port, payload_json, created_at)
-		 VALUES(?, ?, ?, ?, ?)
+		`INSERT INTO spotlight_forwards(id, workspace_id, protocol, local_port, local_path, payload_json, created_at)
+		 VALUES(?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(id) DO UPDATE SET
 			workspace_id=excluded.workspace_id,
+			protocol=excluded.protocol,
 			local_port=excluded.local_port,
+			local_path=excluded.local_path,
 			payload_json=excluded.payload_json,
 			created_at=excluded.created_at`,
 	)
@@ -376,13 +396,16 @@ func (s *NodeStore) ReplaceSpotlightForwardRows(forwards []SpotlightForwardRow)
 	defer stmt.Close()
 
 	for _, fwd := range forwards {
-		if fwd.ID == "" || fwd.WorkspaceID == "" || fwd.LocalPort <= 0 || len(fwd.Payload) == 0 {
+		protocol, ok := spotlightRowProtocol(fwd)
+		if !ok || fwd.ID == "" || fwd.WorkspaceID == "" || len(fwd.Payload) == 0 {
 			continue
 		}
 		if _, err := stmt.Exec(
 			fwd.ID,
 			fwd.WorkspaceID,
+			protocol,
 			fwd.LocalPort,
+			fwd.LocalPath,
 			string(fwd.Payload),
 			fwd.CreatedAt.UTC().Format(time.RFC3339Nano),
 		); err != nil {
@@ -405,7 +428,11 @@ func (s *NodeStore) UpsertSpotlightForwardRow(row SpotlightForwardRow) error {
 	if row.WorkspaceID == "" {
 		return fmt.Errorf("spotlight workspace id is required")
 	}
-	if row.LocalPort <= 0 {
+	protocol, ok := spotlightRowProtocol(row)
+	if !ok && protocol == "unix" {
+		return fmt.Errorf("spotlight local path is required for unix forwards")
+	}
+	if !ok {
 		return fmt.Errorf("spotlight local port must be positive")
 	}
 	if len(row.Payload) == 0 {
@@ -413,16 +440,20 @@ func (s *NodeStore) UpsertSpotlightForwardRow(row SpotlightForwardRow) error {
 	}
 
 	_, err := s.db.Exec(
-		`INSERT INTO spotlight_forwards(id, workspace_id, local_port, payload_json, created_at)
-		 VALUES(?, ?, ?, ?, ?)
+		`INSERT INTO spotlight_forwards(id, workspace_id, protocol, local_port, local_path, payload_json, created_at)
+		 VALUES(?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(id) DO UPDATE SET
 			workspace_id=excluded.workspace_id,
+			protocol=excluded.protocol,
 			local_port=excluded.local_port,
+			local_path=excluded.local_path,
 			payload_json=excluded.payload_json,
 			created_at=excluded.created_at`,
 		row.ID,
 		row.WorkspaceID,
+		protocol,
 		row.LocalPort,
+		row.LocalPath,
 		string(row.Payload),
 		row.CreatedAt.UTC().Format(time.RFC3339Nano),
 	)
@@ -446,7 +477,7 @@ func (s *NodeStore) DeleteSpotlightForwardRow(id string) error {
 }
 
 func (s *NodeStore) ListSpotlightForwardRows() ([]SpotlightForwardRow, error) {
-	rows, err := s.db.Query(`SELECT id, workspace_id, local_port, payload_json, created_at FROM spotlight_forwards ORDER BY created_at ASC`)
+	rows, err := s.db.Query(`SELECT id, workspace_id, protocol, local_port, local_path, payload_json, created_at FROM spotlight_forwards ORDER BY created_at ASC`)
 	if err != nil {
 		return nil, fmt.Errorf("list spotlight forwards query: %w", err)
 	}
@@ -457,18 +488,22 @@ func (s *NodeStore) ListSpotlightForwardRows() ([]SpotlightForwardRow, error) {
 		var (
 			id          string
 			workspaceID string
+			protocol    string
 			localPort   int
+			localPath   string
 			payload     string
 			created     string
 		)
-		if err := rows.Scan(&id, &workspaceID, &localPort, &payload, &created); err != nil {
+		if err := rows.Scan(&id, &workspaceID, &protocol, &localPort, &localPath, &payload, &created); err != nil {
 			return nil, fmt.Errorf("scan spotlight row: %w", err)
 		}
 		createdAt, _ := time.Parse(time.RFC3339Nano, created)
 		all = append(all, SpotlightForwardRow{
 			ID:          id,
 			WorkspaceID: workspaceID,
+			Protocol:    protocol,
 			LocalPort:   localPort,
+			LocalPath:   localPath,
 			Payload:     []byte(payload),
 			CreatedAt:   createdAt,
 		})
@@ -258,3 +258,41 @@ func TestNodeStore_PersistAndLoadSandboxResourceSettings(t *testing.T) {
 		t.Fatalf("unexpected sandbox settings row: %#v", got)
 	}
 }
+
+func TestNodeStore_SpotlightRowsAreUniquePerProtocolEndpoint(t *testing.T) {
+	now := time.Date(2026, time.April, 9, 15, 0, 0, 0, time.UTC)
+	st, err := store.Open(filepath.Join(t.TempDir(), "node.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	rows := []store.SpotlightForwardRow{
+		{ID: "dns-tcp", WorkspaceID: "ws-1", LocalPort: 10053, Payload: []byte(`{}`), CreatedAt: now},
+		{ID: "dns-udp", WorkspaceID: "ws-1", Protocol: "udp", LocalPort: 10053, Payload: []byte(`{}`), CreatedAt: now.Add(time.Second)},
+		{ID: "docker", WorkspaceID: "ws-1", Protocol: "unix", LocalPath: "/tmp/ws-1/docker.sock", Payload: []byte(`{}`), CreatedAt: now.Add(2 * time.Second)},
+	}
+	for _, row := range rows {
+		if err := st.UpsertSpotlightForwardRow(row); err != nil {
+			t.Fatalf("upsert %q: %v", row.ID, err)
+		}
+	}
+
+	if err := st.UpsertSpotlightForwardRow(store.SpotlightForwardRow{ID: "dup", WorkspaceID: "ws-2", Protocol: "udp", LocalPort: 10053, Payload: []byte(`{}`), CreatedAt: now}); err == nil {
+		t.Fatal("expected duplicate udp port to be rejected")
+	}
+	if err := st.UpsertSpotlightForwardRow(store.SpotlightForwardRow{ID: "nopath", WorkspaceID: "ws-2", Protocol: "unix", Payload: []byte(`{}`), CreatedAt: now}); err == nil {
+		t.Fatal("expected unix row without local path to be rejected")
+	}
+
+	got, err := st.ListSpotlightForwardRows()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 rows, got %#v", got)
+	}
+	if got[0].Protocol != "tcp" || got[1].Protocol != "udp" || got[2].Protocol != "unix" || got[2].LocalPath != "/tmp/ws-1/docker.sock" {
+		t.Fatalf("unexpected rows: %#v", got)
+	}
+}
@@ -1,11 +1,13 @@
 package workspace
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -55,13 +57,114 @@ func (w *Workspace) SecurePath(userPath string) (string, error) {
 	cleanPath := filepath.Clean(userPath)
 	fullPath := filepath.Join(w.path, cleanPath)
 
-	if !strings.HasPrefix(fullPath, w.path) {
+	if !within(w.path, fullPath) {
 		return "", fmt.Errorf("path traversal not allowed: %s", userPath)
 	}
 
 	return fullPath, nil
 }
 
+// ContainedPath is SecurePath that also refuses paths which leave the
+// workspace through a symlink. Links in the parent directories are always
+// resolved. The last element is resolved only when follow is set, so that
+// a link itself can still be read, renamed or removed. Missing elements,
+// as for a file about to be created, are allowed.
+func (w *Workspace) ContainedPath(userPath string, follow bool) (string, error) {
+	fullPath, err := w.SecurePath(userPath)
+	if err != nil {
+		return "", err
+	}
+	check := fullPath
+	if !follow && fullPath != w.path {
+		check = filepath.Dir(fullPath)
+	}
+	if err := w.checkResolved(check); err != nil {
+		return "", fmt.Errorf("%w: %s", err, userPath)
+	}
+	return fullPath, nil
+}
+
+// CheckLinkTarget refuses a symlink target that would resolve outside the
+// workspace from the link at linkPath, a path ContainedPath returned.
+// Absolute targets are refused outright.
+func (w *Workspace) CheckLinkTarget(linkPath, target string) error {
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("absolute symlink target not allowed: %s", target)
+	}
+	// Not joined with filepath.Join: cleaning "d/.." away would hide
+	// where the kernel takes it when d is itself a link.
+	return w.checkResolved(filepath.Dir(linkPath) + string(filepath.Separator) + target)
+}
+
+func (w *Workspace) checkResolved(p string) error {
+	root, err := resolvePath(w.path)
+	if err != nil {
+		return err
+	}
+	real, err := resolvePath(p)
+	if err != nil {
+		return err
+	}
+	if !within(root, real) {
+		return errors.New("path escapes the workspace through a symlink")
+	}
+	return nil
+}
+
+// resolvePath resolves an absolute path one element at a time as the
+// kernel does, so ".." applies to where a link led rather than to the
+// link's name. A dangling link is followed to where it points, since
+// creating through it would land there. Elements that do not exist are
+// kept as they are.
+func resolvePath(p string) (string, error) {
+	sep := string(filepath.Separator)
+	vol := filepath.VolumeName(p)
+	resolved := vol + sep
+	queue := strings.Split(p[len(vol):], sep)
+	for hops := 0; len(queue) > 0; {
+		name := queue[0]
+		queue = queue[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(next)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR) {
+				return "", err
+			}
+			resolved = next
+			continue
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if hops++; hops > 40 {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", p)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			vol = filepath.VolumeName(target)
+			resolved = vol + sep
+			target = target[len(vol):]
+		}
+		queue = append(strings.Split(target, sep), queue...)
+	}
+	return resolved, nil
+}
+
+func within(root, p string) bool {
+	return p == root || strings.HasPrefix(p, root+string(filepath.Separator))
+}
+
 func (w *Workspace) Exists() bool {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
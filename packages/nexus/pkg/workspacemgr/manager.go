@@ -456,6 +456,97 @@ func (m *Manager) SetTunnelPorts(id string, ports []int) error {
 	return nil
 }
 
+// SetTunnelLocalPort records the host port a tunnel port is served on. A
+// localPort of 0, or equal to port, clears the mapping.
+func (m *Manager) SetTunnelLocalPort(id string, port int, localPort int) error {
+	m.mu.Lock()
+	ws, ok := m.workspaces[id]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("workspace not found: %s", id)
+	}
+	if localPort <= 0 || localPort == port {
+		if _, mapped := ws.TunnelLocalPorts[port]; !mapped {
+			m.mu.Unlock()
+			return nil
+		}
+		delete(ws.TunnelLocalPorts, port)
+		if len(ws.TunnelLocalPorts) == 0 {
+			ws.TunnelLocalPorts = nil
+		}
+	} else {
+		if ws.TunnelLocalPorts[port] == localPort {
+			m.mu.Unlock()
+			return nil
+		}
+		if ws.TunnelLocalPorts == nil {
+			ws.TunnelLocalPorts = make(map[int]int)
+		}
+		ws.TunnelLocalPorts[port] = localPort
+	}
+	ws.UpdatedAt = time.Now().UTC()
+	m.mu.Unlock()
+	if err := m.persistWorkspace(ws); err != nil {
+		return fmt.Errorf("persist tunnel local port: %w", err)
+	}
+	return nil
+}
+
+// SetPullRequest records the forge pull request published for a workspace.
+func (m *Manager) SetPullRequest(id string, url string, number int) error {
+	m.mu.Lock()
+	ws, ok := m.workspaces[id]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("workspace not found: %s", id)
+	}
+	ws.PullRequestURL = strings.TrimSpace(url)
+	ws.PullRequestNumber = number
+	ws.UpdatedAt = time.Now().UTC()
+	m.mu.Unlock()
+	if err := m.persistWorkspace(ws); err != nil {
+		return fmt.Errorf("persist pull request: %w", err)
+	}
+	return nil
+}
+
+// SetFanout stores fan-out membership and result state on a workspace.
+func (m *Manager) SetFanout(id string, membership FanoutMembership) error {
+	m.mu.Lock()
+	ws, ok := m.workspaces[id]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("workspace not found: %s", id)
+	}
+	ws.Fanout = cloneWorkspace(&Workspace{Fanout: &membership}).Fanout
+	ws.UpdatedAt = time.Now().UTC()
+	m.mu.Unlock()
+	if err := m.persistWorkspace(ws); err != nil {
+		return fmt.Errorf("persist fanout: %w", err)
+	}
+	return nil
+}
+
+// SetTemplate records the template revision a workspace was created from and
+// the runtime options it contributed.
+func (m *Manager) SetTemplate(id string, name string, revision int, options map[string]string) error {
+	m.mu.Lock()
+	ws, ok := m.workspaces[id]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("workspace not found: %s", id)
+	}
+	ws.TemplateName = strings.TrimSpace(name)
+	ws.TemplateRevision = revision
+	ws.RuntimeOptions = cloneWorkspace(&Workspace{RuntimeOptions: options}).RuntimeOptions
+	ws.UpdatedAt = time.Now().UTC()
+	m.mu.Unlock()
+	if err := m.persistWorkspace(ws); err != nil {
+		return fmt.Errorf("persist template: %w", err)
+	}
+	return nil
+}
+
 func (m *Manager) UpdateProjectID(id string, projectID string) error {
 	m.mu.Lock()
 	ws, ok := m.workspaces[id]
@@ -821,6 +912,30 @@ func cloneWorkspace(in *Workspace) *Workspace {
 		out.TunnelPorts = make([]int, len(in.TunnelPorts))
 		copy(out.TunnelPorts, in.TunnelPorts)
 	}
+	if in.Fanout != nil {
+		fanout := *in.Fanout
+		if in.Fanout.ExitCode != nil {
+			exitCode := *in.Fanout.ExitCode
+			fanout.ExitCode = &exitCode
+		}
+		if in.Fanout.FinishedAt != nil {
+			finishedAt := *in.Fanout.FinishedAt
+			fanout.FinishedAt = &finishedAt
+		}
+		out.Fanout = &fanout
+	}
+	if in.TunnelLocalPorts != nil {
+		out.TunnelLocalPorts = make(map[int]int, len(in.TunnelLocalPorts))
+		for k, v := range in.TunnelLocalPorts {
+			out.TunnelLocalPorts[k] = v
+		}
+	}
+	if in.RuntimeOptions != nil {
+		out.RuntimeOptions = make(map[string]string, len(in.RuntimeOptions))
+		for k, v := range in.RuntimeOptions {
+			out.RuntimeOptions[k] = v
+		}
+	}
 	return &out
 }
 
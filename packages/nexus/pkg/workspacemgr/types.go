@@ -25,6 +25,21 @@ type CreateSpec struct {
 	UseProjectRootPath bool `json:"useProjectRootPath,omitempty"`
 }
 
+// FanoutMembership ties a forked workspace to a fan-out group and stores the
+// outcome of the command that ran in it.
+type FanoutMembership struct {
+	GroupID           string     `json:"groupId"`
+	SourceWorkspaceID string     `json:"sourceWorkspaceId"`
+	Index             int        `json:"index"`
+	Command           string     `json:"command"`
+	Status            string     `json:"status"`
+	ExitCode          *int       `json:"exitCode,omitempty"`
+	Output            string     `json:"output,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	StartedAt         time.Time  `json:"startedAt"`
+	FinishedAt        *time.Time `json:"finishedAt,omitempty"`
+}
+
 type Workspace struct {
 	ID                string         `json:"id"`
 	ProjectID         string         `json:"projectId,omitempty"`
@@ -64,6 +79,23 @@ type Workspace struct {
 	// TunnelPorts stores user-selected host ports that should be tunnelable.
 	// Tunnels are only activated when this workspace holds the global tunnel lease.
 	TunnelPorts []int `json:"tunnelPorts,omitempty"`
+	// TunnelLocalPorts maps a tunnel port to the host port it was remapped
+	// to when the requested port was taken. Reused on later activations.
+	TunnelLocalPorts map[int]int `json:"tunnelLocalPorts,omitempty"`
+	// PullRequestURL is the forge pull request opened by workspace.publish for
+	// this workspace's branch.
+	PullRequestURL    string `json:"pullRequestUrl,omitempty"`
+	PullRequestNumber int    `json:"pullRequestNumber,omitempty"`
+	// Fanout records batch fan-out membership for workspaces created by
+	// workspace.fanout, including the command result once it completes.
+	Fanout *FanoutMembership `json:"fanout,omitempty"`
+	// TemplateName and TemplateRevision record the project template revision
+	// the workspace was created from.
+	TemplateName     string `json:"templateName,omitempty"`
+	TemplateRevision int    `json:"templateRevision,omitempty"`
+	// RuntimeOptions are extra runtime driver options (mem_mib, vcpus, vm.mode)
+	// applied when the workspace runtime is created.
+	RuntimeOptions map[string]string `json:"runtimeOptions,omitempty"`
 
 	// NEW: Optional fields for future multi-user support
 	// In personal mode, OwnerUserID is "local" and TenantID is empty
@@ -316,4 +316,26 @@ describe('FSOperations', () => {
       await expect(promise).resolves.toBeUndefined();
     });
   });
+
+  describe('copy', () => {
+    it('should copy recursively and return counts', async () => {
+      await connectClient();
+
+      const promise = fs.copy('src', 'src-copy', { recursive: true });
+
+      const sentData = mockWsInstance.send.mock.calls[0][0] as string;
+      const request = JSON.parse(sentData);
+
+      expect(request.method).toBe('fs.copy');
+      expect(request.params).toMatchObject({ path: 'src', newPath: 'src-copy', recursive: true });
+
+      emitEvent('message', Buffer.from(JSON.stringify({
+        jsonrpc: '2.0',
+        id: request.id,
+        result: { ok: true, path: 'src-copy', files: 3, bytes: 42, reflinked: 3 },
+      })));
+
+      await expect(promise).resolves.toMatchObject({ files: 3, reflinked: 3 });
+    });
+  });
 });
@@ -13,6 +13,40 @@ import {
   FSMkdirResult,
   FSRmResult,
   FSStatResult,
+  FSFindOptions,
+  FSFindParams,
+  FSFindResult,
+  FSGrepOptions,
+  FSGrepParams,
+  FSGrepResult,
+  FSGrepMatch,
+  FSGrepMatchEvent,
+  FSGrepEndEvent,
+  FSGrepStats,
+  FSWatchOptions,
+  FSWatchParams,
+  FSWatchResult,
+  FSWatchEvent,
+  FSWatchEventNotification,
+  FSWatchEndNotification,
+  FSWatcher,
+  FSEdit,
+  FSApplyPatchOptions,
+  FSApplyPatchParams,
+  FSApplyPatchResult,
+  FSReadRange,
+  FSOpenMode,
+  FSOpenResult,
+  FSChunkReadResult,
+  FSChunkWriteResult,
+  FSTailOptions,
+  FSTailChunk,
+  FSTailEndEvent,
+  FSTail,
+  FSStatOptions,
+  FSRenameOptions,
+  FSCopyOptions,
+  FSCopyResult,
 } from './types';
 import type { RPCClient } from './rpc/types';
 
@@ -32,8 +66,8 @@ export class FSOperations {
     return { ...input, workspaceId: this.workspaceId };
   }
 
-  async readFile(path: string, encoding: string = 'utf8'): Promise<string | Buffer> {
-    const params: FSReadFileParams = this.params({ path, encoding });
+  async readFile(path: string, encoding: string = 'utf8', range: FSReadRange = {}): Promise<string | Buffer> {
+    const params: FSReadFileParams = this.params({ path, encoding, ...range });
     const result = await this.client.request<FSReadFileResult>('fs.readFile', params);
 
     if (encoding === 'utf8' || encoding === 'utf-8') {
@@ -51,7 +85,7 @@ export class FSOperations {
     const encoding = Buffer.isBuffer(content) ? 'base64' : 'utf8';
     const params: FSWriteFileParams = this.params({
       path,
-      content,
+      content: Buffer.isBuffer(content) ? content.toString('base64') : content,
       encoding,
     });
 
@@ -80,9 +114,305 @@ export class FSOperations {
     await this.client.request<FSRmResult>('fs.rm', params);
   }
 
-  async stat(path: string): Promise<FSStatResult['stats']> {
-    const params: FSStatParams = this.params({ path });
+  async stat(path: string, options: FSStatOptions = {}): Promise<FSStatResult['stats']> {
+    const params: FSStatParams = this.params({ ...options, path });
     const result = await this.client.request<FSStatResult>('fs.stat', params);
     return result.stats;
   }
+
+  async chmod(path: string, mode: number, recursive: boolean = false): Promise<void> {
+    await this.client.request('fs.chmod', this.params({ path, mode, recursive }));
+  }
+
+  async rename(path: string, newPath: string, options: FSRenameOptions = {}): Promise<void> {
+    await this.client.request('fs.rename', this.params({ ...options, path, newPath }));
+  }
+
+  /** Create a symlink at path pointing to target, relative to the link's directory. */
+  async symlink(target: string, path: string): Promise<void> {
+    await this.client.request('fs.symlink', this.params({ path, target }));
+  }
+
+  async readlink(path: string): Promise<string> {
+    const result = await this.client.request<{ target: string }>('fs.readlink', this.params({ path }));
+    return result.target;
+  }
+
+  async copy(path: string, newPath: string, options: FSCopyOptions = {}): Promise<FSCopyResult> {
+    return await this.client.request<FSCopyResult>('fs.copy', this.params({ ...options, path, newPath }));
+  }
+
+  /**
+   * Apply a unified diff and/or structured edits all or nothing. Nothing is
+   * written when any file conflicts or with dryRun; check result.files.
+   */
+  async applyPatch(patch: string | FSEdit[], options: FSApplyPatchOptions = {}): Promise<FSApplyPatchResult> {
+    const input: FSApplyPatchParams = typeof patch === 'string'
+      ? { ...options, patch }
+      : { ...options, edits: [...patch, ...(options.edits ?? [])] };
+    return await this.client.request<FSApplyPatchResult>('fs.applyPatch', this.params(input));
+  }
+
+  /**
+   * Find files under a directory by glob, skipping what .gitignore excludes
+   */
+  async find(path: string, options: FSFindOptions = {}): Promise<FSFindResult> {
+    const params: FSFindParams = this.params({ ...options, path });
+    return await this.client.request<FSFindResult>('fs.find', params);
+  }
+
+  /**
+   * Search file contents for a regular expression (or a literal)
+   */
+  async grep(path: string, pattern: string, options: FSGrepOptions = {}): Promise<FSGrepResult> {
+    const params: FSGrepParams = this.params({ ...options, path, pattern });
+    return await this.client.request<FSGrepResult>('fs.grep', params);
+  }
+
+  /**
+   * Search file contents, receiving matches in batches as they are found.
+   * Resolves with the stats once the search ends.
+   */
+  async grepStream(
+    path: string,
+    pattern: string,
+    onMatches: (matches: FSGrepMatch[]) => void,
+    options: FSGrepOptions = {},
+  ): Promise<FSGrepStats> {
+    // Notifications can arrive before the response naming the stream, so
+    // they are held until the stream ID is known.
+    let streamId: string | undefined;
+    const early: Array<{ method: string; event: FSGrepMatchEvent | FSGrepEndEvent }> = [];
+    let finish: (stats: FSGrepStats) => void = () => {};
+    let fail: (err: Error) => void = () => {};
+    const done = new Promise<FSGrepStats>((resolve, reject) => {
+      finish = resolve;
+      fail = reject;
+    });
+    const handle = (method: string, event: FSGrepMatchEvent | FSGrepEndEvent) => {
+      if (method === 'fs.grep.match') {
+        onMatches((event as FSGrepMatchEvent).matches);
+        return;
+      }
+      const end = event as FSGrepEndEvent;
+      if (end.error) {
+        fail(new Error(end.error));
+      } else {
+        finish(end.stats as FSGrepStats);
+      }
+    };
+    const listen = (method: string) =>
+      this.client.onNotification(method, (params: unknown) => {
+        const event = params as FSGrepMatchEvent | FSGrepEndEvent;
+        if (!event || typeof event.streamId !== 'string') {
+          return;
+        }
+        if (streamId === undefined) {
+          early.push({ method, event });
+        } else if (event.streamId === streamId) {
+          handle(method, event);
+        }
+      });
+    const offMatch = listen('fs.grep.match');
+    const offEnd = listen('fs.grep.end');
+    try {
+      const params: FSGrepParams = this.params({ ...options, path, pattern, stream: true });
+      const result = await this.client.request<FSGrepResult>('fs.grep', params);
+      streamId = result.streamId;
+      for (const { method, event } of early) {
+        if (event.streamId === streamId) {
+          handle(method, event);
+        }
+      }
+      return await done;
+    } finally {
+      offMatch();
+      offEnd();
+    }
+  }
+
+  async stopGrep(streamId: string): Promise<void> {
+    await this.client.request('fs.grep.stop', { streamId });
+  }
+
+  /**
+   * Watch a directory tree, receiving debounced batches of changes. An
+   * "overflow" event means changes were lost and the tree should be
+   * rescanned. onEnd is called if the watch fails; close stops it.
+   */
+  async watch(
+    path: string,
+    onEvents: (events: FSWatchEvent[]) => void,
+    options: FSWatchOptions = {},
+    onEnd?: (error: string) => void,
+  ): Promise<FSWatcher> {
+    let watchId: string | undefined;
+    const early: Array<{ method: string; event: FSWatchEventNotification | FSWatchEndNotification }> = [];
+    const handle = (method: string, event: FSWatchEventNotification | FSWatchEndNotification) => {
+      if (method === 'fs.watch.event') {
+        onEvents((event as FSWatchEventNotification).events);
+        return;
+      }
+      stop();
+      onEnd?.((event as FSWatchEndNotification).error ?? 'watch ended');
+    };
+    const listen = (method: string) =>
+      this.client.onNotification(method, (params: unknown) => {
+        const event = params as FSWatchEventNotification | FSWatchEndNotification;
+        if (!event || typeof event.watchId !== 'string') {
+          return;
+        }
+        if (watchId === undefined) {
+          early.push({ method, event });
+        } else if (event.watchId === watchId) {
+          handle(method, event);
+        }
+      });
+    const offEvent = listen('fs.watch.event');
+    const offEnd = listen('fs.watch.end');
+    const stop = () => {
+      offEvent();
+      offEnd();
+    };
+    try {
+      const params: FSWatchParams = this.params({ ...options, path });
+      const result = await this.client.request<FSWatchResult>('fs.watch', params);
+      watchId = result.watchId;
+    } catch (err) {
+      stop();
+      throw err;
+    }
+    for (const { method, event } of early) {
+      if (event.watchId === watchId) {
+        handle(method, event);
+      }
+    }
+    const id = watchId;
+    return {
+      watchId: id,
+      close: async () => {
+        stop();
+        await this.unwatch(id);
+      },
+    };
+  }
+
+  async unwatch(watchId: string): Promise<void> {
+    await this.client.request('fs.unwatch', { watchId });
+  }
+
+  /**
+   * Open a file for chunked reads and writes. Handles belong to the
+   * connection and are closed when it goes away.
+   */
+  async open(path: string, mode: FSOpenMode = 'r'): Promise<FSFileHandle> {
+    const result = await this.client.request<FSOpenResult>('fs.open', this.params({ path, mode }));
+    return new FSFileHandle(this.client, result);
+  }
+
+  /**
+   * Follow a file as it grows, like tail -f. onData receives each chunk
+   * as it is appended; onEnd is called if following fails.
+   */
+  async tail(
+    path: string,
+    onData: (chunk: FSTailChunk) => void,
+    options: FSTailOptions = {},
+    onEnd?: (error: string) => void,
+  ): Promise<FSTail> {
+    let streamId: string | undefined;
+    const early: Array<{ method: string; event: FSTailChunk | FSTailEndEvent }> = [];
+    const handle = (method: string, event: FSTailChunk | FSTailEndEvent) => {
+      if (method === 'fs.tail.data') {
+        onData(event as FSTailChunk);
+        return;
+      }
+      stop();
+      onEnd?.((event as FSTailEndEvent).error ?? 'tail ended');
+    };
+    const listen = (method: string) =>
+      this.client.onNotification(method, (params: unknown) => {
+        const event = params as FSTailChunk | FSTailEndEvent;
+        if (!event || typeof event.streamId !== 'string') {
+          return;
+        }
+        if (streamId === undefined) {
+          early.push({ method, event });
+        } else if (event.streamId === streamId) {
+          handle(method, event);
+        }
+      });
+    const offData = listen('fs.tail.data');
+    const offEnd = listen('fs.tail.end');
+    const stop = () => {
+      offData();
+      offEnd();
+    };
+    try {
+      const result = await this.client.request<{ streamId: string }>('fs.tail', this.params({ ...options, path }));
+      streamId = result.streamId;
+    } catch (err) {
+      stop();
+      throw err;
+    }
+    for (const { method, event } of early) {
+      if (event.streamId === streamId) {
+        handle(method, event);
+      }
+    }
+    const id = streamId;
+    return {
+      streamId: id,
+      stop: async () => {
+        stop();
+        await this.client.request('fs.tail.stop', { streamId: id });
+      },
+    };
+  }
+}
+
+/**
+ * An open file on the daemon. Reads and writes continue from the last one
+ * unless an offset is given.
+ */
+export class FSFileHandle {
+  readonly handle: string;
+  readonly path: string;
+  readonly size: number;
+  private client: RPCClient;
+
+  constructor(client: RPCClient, opened: FSOpenResult) {
+    this.client = client;
+    this.handle = opened.handle;
+    this.path = opened.path;
+    this.size = opened.size;
+  }
+
+  /**
+   * Read up to length bytes (64 KiB by default, at most 256 KiB). Resolves
+   * with an empty buffer at the end of the file.
+   */
+  async read(length?: number, offset?: number): Promise<{ data: Buffer; offset: number; eof: boolean }> {
+    const result = await this.client.request<FSChunkReadResult>('fs.read', {
+      handle: this.handle,
+      length,
+      offset,
+      encoding: 'base64',
+    });
+    return { data: Buffer.from(result.data, 'base64'), offset: result.offset, eof: result.eof };
+  }
+
+  async write(data: string | Buffer, offset?: number): Promise<FSChunkWriteResult> {
+    const bytes = Buffer.isBuffer(data) ? data : Buffer.from(data, 'utf8');
+    return await this.client.request<FSChunkWriteResult>('fs.write', {
+      handle: this.handle,
+      data: bytes.toString('base64'),
+      encoding: 'base64',
+      offset,
+    });
+  }
+
+  async close(): Promise<void> {
+    await this.client.request('fs.close', { handle: this.handle });
+  }
 }
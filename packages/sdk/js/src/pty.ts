@@ -2,18 +2,30 @@ import {
   PTYCloseResult,
   PTYAttachParams,
   PTYAttachResult,
+  PTYControlRequestResult,
+  PTYControlRequestedEvent,
   PTYDataEvent,
   PTYExitEvent,
+  PTYExpectParams,
+  PTYExpectResult,
   PTYGetParams,
   PTYGetResult,
   PTYListParams,
   PTYListResult,
   PTYOpenParams,
   PTYOpenResult,
+  PTYPresenceEvent,
+  PTYRecordingGetResult,
+  PTYRecordingInfo,
+  PTYRecordingListResult,
   PTYRenameParams,
   PTYRenameResult,
   PTYResizeResult,
+  PTYRole,
+  PTYSendParams,
+  PTYSendResult,
   PTYSessionInfo,
+  PTYSnapshot,
   PTYTmuxCommandParams,
   PTYTmuxCommandResult,
   PTYWriteResult,
@@ -48,11 +60,87 @@ export class PTYOperations {
   }
 
   async attach(sessionId: string): Promise<boolean> {
-    const params: PTYAttachParams = { sessionId };
-    const result = await this.client.request<PTYAttachResult>('pty.attach', params as unknown as Record<string, unknown>);
+    const result = await this.resume(sessionId);
     return result.attached;
   }
 
+  /**
+   * Reattach to a session, replaying the output after `since` (the seq of
+   * the last pty.data seen) before live output. Zero replays all scrollback.
+   */
+  async resume(sessionId: string, since = 0, role: PTYRole = 'driver'): Promise<PTYAttachResult> {
+    const params: PTYAttachParams = { sessionId, since, role };
+    return await this.client.request<PTYAttachResult>('pty.attach', params as unknown as Record<string, unknown>);
+  }
+
+  // Collaboration
+
+  /**
+   * Take exclusive input to a session. Other drivers are blocked until unlock.
+   */
+  async lock(sessionId: string): Promise<PTYPresenceEvent> {
+    return await this.client.request<PTYPresenceEvent>('pty.lock', { sessionId });
+  }
+
+  async unlock(sessionId: string): Promise<PTYPresenceEvent> {
+    return await this.client.request<PTYPresenceEvent>('pty.unlock', { sessionId });
+  }
+
+  /**
+   * Ask to drive a session. Pending until a driver grants control, unless no driver is attached.
+   */
+  async requestControl(sessionId: string): Promise<PTYControlRequestResult> {
+    return await this.client.request<PTYControlRequestResult>('pty.control.request', { sessionId });
+  }
+
+  /**
+   * Make another participant a driver, handing over the lock if held.
+   */
+  async grantControl(sessionId: string, clientId: string): Promise<PTYPresenceEvent> {
+    return await this.client.request<PTYPresenceEvent>('pty.control.grant', { sessionId, clientId });
+  }
+
+  /**
+   * Wait until session output matches a pattern or literal, or the timeout passes
+   */
+  async expect(params: PTYExpectParams): Promise<PTYExpectResult> {
+    return await this.client.request<PTYExpectResult>('pty.expect', params as unknown as Record<string, unknown>);
+  }
+
+  /**
+   * Type text and then named keys into a session
+   */
+  async send(params: PTYSendParams): Promise<PTYSendResult> {
+    return await this.client.request<PTYSendResult>('pty.send', params as unknown as Record<string, unknown>);
+  }
+
+  /**
+   * Get the session's screen as it is currently rendered
+   */
+  async snapshot(sessionId: string): Promise<PTYSnapshot> {
+    return await this.client.request<PTYSnapshot>('pty.snapshot', { sessionId });
+  }
+
+  onPresence(callback: (event: PTYPresenceEvent) => void): () => void {
+    return this.client.onNotification('pty.presence', (params: unknown) => {
+      const evt = params as PTYPresenceEvent;
+      if (!evt || typeof evt.sessionId !== 'string' || !Array.isArray(evt.participants)) {
+        return;
+      }
+      callback(evt);
+    });
+  }
+
+  onControlRequested(callback: (event: PTYControlRequestedEvent) => void): () => void {
+    return this.client.onNotification('pty.control.requested', (params: unknown) => {
+      const evt = params as PTYControlRequestedEvent;
+      if (!evt || typeof evt.sessionId !== 'string' || !evt.from) {
+        return;
+      }
+      callback(evt);
+    });
+  }
+
   onData(callback: (event: PTYDataEvent) => void): () => void {
     return this.client.onNotification('pty.data', (params: unknown) => {
       const evt = params as PTYDataEvent;
@@ -112,4 +200,21 @@ export class PTYOperations {
     const params: PTYTmuxCommandParams = { sessionId, command, args };
     return await this.client.request<PTYTmuxCommandResult>('pty.tmux', params as unknown as Record<string, unknown>);
   }
+
+  // Recordings
+
+  /**
+   * List the terminal recordings of a workspace
+   */
+  async listRecordings(workspaceId: string): Promise<PTYRecordingInfo[]> {
+    const result = await this.client.request<PTYRecordingListResult>('pty.recording.list', { workspaceId });
+    return result.recordings;
+  }
+
+  /**
+   * Get a session recording, exported as asciicast v2
+   */
+  async getRecording(sessionId: string): Promise<PTYRecordingGetResult> {
+    return await this.client.request<PTYRecordingGetResult>('pty.recording.get', { sessionId });
+  }
 }
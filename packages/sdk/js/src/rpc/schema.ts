@@ -2,6 +2,7 @@ import type { ExecParams, ExecResultData } from '../types/exec';
 import type {
   NodeInfo,
   WorkspaceCreateResult,
+  WorkspaceEventsResult,
   WorkspaceForkResult,
   WorkspaceInfo,
   WorkspaceListResult,
@@ -9,6 +10,7 @@ import type {
   WorkspaceRelationsListResult,
   WorkspaceRemoveResult,
   WorkspaceRestoreResult,
+  WorkspaceReadyCheck,
   WorkspaceReadyResult,
   WorkspaceStartResult,
   WorkspaceStopResult,
@@ -16,6 +18,9 @@ import type {
 import type {
   SpotlightApplyComposePortsResult,
   SpotlightForward,
+  SpotlightShare,
+  SpotlightShareAccess,
+  SpotlightShareOptions,
 } from '../types/spotlight';
 import type {
   ProjectListResult,
@@ -31,8 +36,12 @@ type FsDirEntry = {
   name: string;
   path: string;
   is_dir: boolean;
+  is_symlink?: boolean;
   size: number;
   mode: string;
+  mtime_ms: number;
+  uid: number;
+  gid: number;
 };
 
 type GitCommandRPCResult = {
@@ -47,6 +56,7 @@ export interface RPCSchema {
   'workspace.list': [Record<string, never>, WorkspaceListResult];
   'workspace.info': [{ workspaceId?: string; id?: string }, WorkspaceInfo];
   'workspace.start': [{ id: string }, WorkspaceStartResult];
+  'workspace.events': [{ workspaceId: string; limit?: number }, WorkspaceEventsResult];
   'workspace.stop': [{ id: string }, WorkspaceStopResult];
   'workspace.remove': [{ id: string }, WorkspaceRemoveResult];
   'workspace.restore': [{ id: string }, WorkspaceRestoreResult];
@@ -66,14 +76,7 @@ export interface RPCSchema {
     {
       workspaceId?: string;
       profile?: string;
-      checks?: Array<{
-        name: string;
-        type?: string;
-        command?: string;
-        args?: string[];
-        serviceName?: string;
-        expectRunning?: boolean;
-      }>;
+      checks?: WorkspaceReadyCheck[];
       timeoutMs?: number;
       intervalMs?: number;
     },
@@ -104,7 +107,7 @@ export interface RPCSchema {
     { ok: boolean; path: string; size?: number },
   ];
   'fs.stat': [
-    { workspaceId?: string; path: string },
+    { workspaceId?: string; path: string; noFollow?: boolean; hash?: boolean },
     {
       name: string;
       path: string;
@@ -119,17 +122,40 @@ export interface RPCSchema {
         mtime: string;
         ctime: string;
         mode: number;
+        isSymbolicLink: boolean;
+        mtimeMs: number;
+        uid: number;
+        gid: number;
+        target?: string;
+        hash?: string;
       };
     },
   ];
+  'fs.chmod': [
+    { workspaceId?: string; path: string; mode: number; recursive?: boolean },
+    { ok: boolean; path: string },
+  ];
+  'fs.rename': [
+    { workspaceId?: string; path: string; newPath: string; overwrite?: boolean },
+    { ok: boolean; path: string },
+  ];
+  'fs.symlink': [{ workspaceId?: string; path: string; target: string }, { ok: boolean; path: string }];
+  'fs.readlink': [{ workspaceId?: string; path: string }, { path: string; target: string }];
+  'fs.copy': [
+    { workspaceId?: string; path: string; newPath: string; recursive?: boolean; overwrite?: boolean },
+    { ok: boolean; path: string; files: number; bytes: number; reflinked: number },
+  ];
   'node.info': [Record<string, never>, NodeInfo];
   'spotlight.expose': [
     {
       spec: {
         workspaceId: string;
         service: string;
+        protocol?: 'tcp' | 'udp' | 'unix';
         remotePort: number;
         localPort: number;
+        localPath?: string;
+        remotePath?: string;
         host?: string;
       };
     },
@@ -138,6 +164,10 @@ export interface RPCSchema {
   'spotlight.list': [{ workspaceId?: string }, { forwards: SpotlightForward[] }];
   'spotlight.close': [{ id: string }, { closed: boolean }];
   'spotlight.applyComposePorts': [{ workspaceId: string }, SpotlightApplyComposePortsResult];
+  'spotlight.share': [{ workspaceId: string } & SpotlightShareOptions, { share: SpotlightShare }];
+  'spotlight.shares.list': [{ workspaceId?: string }, { shares: SpotlightShare[] }];
+  'spotlight.shares.revoke': [{ id: string }, { revoked: boolean }];
+  'spotlight.shares.logs': [{ id: string; limit?: number }, { entries: SpotlightShareAccess[] }];
   'git.command': [
     { workspaceId?: string; action: string; params?: Record<string, unknown> },
     GitCommandRPCResult,
@@ -1,6 +1,9 @@
 import {
   SpotlightExposeOptions,
   SpotlightForward,
+  SpotlightShare,
+  SpotlightShareAccess,
+  SpotlightShareOptions,
 } from './types';
 import type { RPCClient } from './rpc/types';
 
@@ -27,8 +30,11 @@ export class TunnelOperations {
       spec: {
         workspaceId,
         service: options.service,
+        protocol: options.protocol,
         remotePort: options.remotePort,
         localPort: options.localPort,
+        localPath: options.localPath,
+        remotePath: options.remotePath,
         host: options.host,
       },
     });
@@ -48,6 +54,31 @@ export class TunnelOperations {
     return result.closed;
   }
 
+  async share(options: SpotlightShareOptions): Promise<SpotlightShare> {
+    const workspaceId = this.resolveWorkspaceID();
+    const result = await this.client.request<{ share: SpotlightShare }>('spotlight.share', {
+      workspaceId,
+      ...options,
+    });
+    return result.share;
+  }
+
+  async listShares(): Promise<SpotlightShare[]> {
+    const workspaceId = this.resolveWorkspaceID();
+    const result = await this.client.request<{ shares: SpotlightShare[] }>('spotlight.shares.list', { workspaceId });
+    return result.shares;
+  }
+
+  async revokeShare(id: string): Promise<boolean> {
+    const result = await this.client.request<{ revoked: boolean }>('spotlight.shares.revoke', { id });
+    return result.revoked;
+  }
+
+  async shareLogs(id: string, limit?: number): Promise<SpotlightShareAccess[]> {
+    const result = await this.client.request<{ entries: SpotlightShareAccess[] }>('spotlight.shares.logs', { id, limit });
+    return result.entries;
+  }
+
   private resolveWorkspaceID(): string {
     if (this.workspaceId && this.workspaceId.trim() !== '') {
       return this.workspaceId;
@@ -1,15 +1,28 @@
 export interface FileStats {
   isFile: boolean;
   isDirectory: boolean;
+  isSymbolicLink: boolean;
   size: number;
   mtime: string;
   ctime: string;
+  mtimeMs: number;
   mode: number;
+  uid: number;           // -1 where the host has no file ownership
+  gid: number;
+  target?: string;       // for a symlink, where it points
+  hash?: string;         // hex SHA-256, when requested
+}
+
+export interface FSStatOptions {
+  noFollow?: boolean;    // describe a symlink itself
+  hash?: boolean;
 }
 
 export interface FSReadFileParams {
   path: string;
   encoding?: string;
+  offset?: number;
+  length?: number;       // 0 or unset reads to the end
   [key: string]: unknown;
 }
 
@@ -42,7 +55,7 @@ export interface FSRmParams {
   [key: string]: unknown;
 }
 
-export interface FSStatParams {
+export interface FSStatParams extends FSStatOptions {
   path: string;
   [key: string]: unknown;
 }
@@ -50,6 +63,15 @@ export interface FSStatParams {
 export interface FSReadFileResult {
   content: string | Buffer;
   encoding: string;
+  size?: number;         // bytes read
+  offset?: number;
+  fileSize?: number;
+  eof?: boolean;
+}
+
+export interface FSReadRange {
+  offset?: number;
+  length?: number;
 }
 
 export interface FSWriteFileResult {
@@ -75,3 +97,216 @@ export interface FSRmResult {
 export interface FSStatResult {
   stats: FileStats;
 }
+
+export interface FSFindOptions {
+  patterns?: string[];   // globs; "*.go" matches at any depth, "**" spans directories
+  exclude?: string[];
+  type?: 'file' | 'dir';
+  maxDepth?: number;
+  maxResults?: number;   // default 1000, at most 10000
+  noIgnore?: boolean;    // include files excluded by .gitignore
+}
+
+export interface FSFindParams extends FSFindOptions {
+  path: string;
+  [key: string]: unknown;
+}
+
+export interface FSFindMatch {
+  path: string;
+  isDir: boolean;
+  size: number;
+}
+
+export interface FSFindResult {
+  matches: FSFindMatch[];
+  path: string;
+  count: number;
+  truncated: boolean;
+}
+
+export interface FSGrepOptions {
+  literal?: boolean;
+  ignoreCase?: boolean;
+  include?: string[];
+  exclude?: string[];
+  context?: number;      // lines before and after each match, at most 10
+  maxResults?: number;
+  maxFileBytes?: number; // larger files are skipped; default 10 MiB
+  noIgnore?: boolean;
+}
+
+export interface FSGrepParams extends FSGrepOptions {
+  path: string;
+  pattern: string;
+  stream?: boolean;
+  [key: string]: unknown;
+}
+
+export interface FSGrepMatch {
+  path: string;
+  line: number;          // 1-based
+  column: number;        // 1-based, in characters
+  text: string;
+  before?: string[];
+  after?: string[];
+}
+
+export interface FSGrepStats {
+  count: number;
+  filesSearched: number;
+  filesMatched: number;
+  truncated: boolean;
+}
+
+export interface FSGrepResult extends FSGrepStats {
+  matches: FSGrepMatch[];
+  path: string;
+  streamId?: string;
+}
+
+export interface FSGrepMatchEvent {
+  streamId: string;
+  matches: FSGrepMatch[];
+}
+
+export interface FSGrepEndEvent {
+  streamId: string;
+  stats?: FSGrepStats;
+  error?: string;
+}
+
+export interface FSWatchOptions {
+  ignore?: string[];     // globs of paths not to report
+  noIgnore?: boolean;    // also report paths excluded by .gitignore
+  debounceMs?: number;   // default 100, at most 10000
+}
+
+export interface FSWatchParams extends FSWatchOptions {
+  path: string;
+  [key: string]: unknown;
+}
+
+export interface FSWatchResult {
+  watchId: string;
+  path: string;
+}
+
+export interface FSWatchEvent {
+  type: 'create' | 'modify' | 'delete' | 'rename' | 'overflow';
+  path?: string;         // relative to the workspace root
+  oldPath?: string;      // set for renames
+  isDir?: boolean;
+}
+
+export interface FSWatchEventNotification {
+  watchId: string;
+  events: FSWatchEvent[];
+}
+
+export interface FSWatchEndNotification {
+  watchId: string;
+  error?: string;
+}
+
+export interface FSWatcher {
+  watchId: string;
+  close(): Promise<void>;
+}
+
+export interface FSEdit {
+  path: string;
+  oldHash?: string;      // hex SHA-256 the current content must have
+  content?: string;      // new content; creates the file if needed
+  encoding?: 'utf8' | 'base64';
+  newPath?: string;      // move the file, with content if given
+  delete?: boolean;
+}
+
+export interface FSApplyPatchOptions {
+  edits?: FSEdit[];
+  dryRun?: boolean;
+}
+
+export interface FSApplyPatchParams extends FSApplyPatchOptions {
+  patch?: string;        // unified diff
+  [key: string]: unknown;
+}
+
+export interface FSPatchFileResult {
+  path: string;
+  oldPath?: string;
+  action: 'create' | 'modify' | 'delete' | 'rename';
+  status: 'ok' | 'conflict';
+  oldHash?: string;
+  newHash?: string;
+  error?: string;
+}
+
+export interface FSApplyPatchResult {
+  applied: boolean;
+  dryRun?: boolean;
+  conflicts: number;
+  files: FSPatchFileResult[];
+}
+
+export type FSOpenMode = 'r' | 'w' | 'a' | 'rw';
+
+export interface FSOpenResult {
+  handle: string;
+  path: string;
+  size: number;
+}
+
+export interface FSChunkReadResult {
+  data: string;
+  encoding: string;
+  offset: number;
+  size: number;
+  eof: boolean;
+}
+
+export interface FSChunkWriteResult {
+  written: number;
+  offset: number;
+}
+
+export interface FSTailOptions {
+  lines?: number;        // start this many lines before the end
+  offset?: number;       // or at this byte offset; default is the end
+  encoding?: 'utf8' | 'base64';
+}
+
+export interface FSTailChunk {
+  streamId: string;
+  data: string;
+  offset: number;
+  truncated?: boolean;   // the file shrank or was replaced; data restarts at 0
+}
+
+export interface FSTailEndEvent {
+  streamId: string;
+  error?: string;
+}
+
+export interface FSTail {
+  streamId: string;
+  stop(): Promise<void>;
+}
+
+export interface FSRenameOptions {
+  overwrite?: boolean;
+}
+
+export interface FSCopyOptions {
+  recursive?: boolean;   // required for directories
+  overwrite?: boolean;
+}
+
+export interface FSCopyResult {
+  ok: boolean;
+  path: string;
+  files: number;
+  bytes: number;
+  reflinked: number;     // files cloned copy-on-write
+}
@@ -5,6 +5,9 @@ export interface PTYOpenParams {
   rows?: number;
   name?: string;         // Optional display name for the tab
   useTmux?: boolean;    // Whether to use tmux for this session
+  record?: boolean;     // Overrides the workspace's terminal.record default
+  recordInput?: boolean; // Also record typed input; off by default
+  scrollbackBytes?: number; // Output kept for replay on attach
 }
 
 export interface PTYOpenResult {
@@ -23,17 +26,97 @@ export interface PTYCloseResult {
   closed: boolean;
 }
 
+export type PTYRole = 'driver' | 'viewer';
+
 export interface PTYAttachParams {
   sessionId: string;
+  since?: number;       // seq of the last pty.data seen; output after it is replayed
+  role?: PTYRole;       // default 'driver'
 }
 
 export interface PTYAttachResult {
   attached: boolean;
+  seq: number;          // seq the replay ends at
+  truncated?: boolean;  // output after `since` had already left the scrollback
+  role?: PTYRole;
+}
+
+// Collaborative sessions
+export interface PTYParticipant {
+  clientId: string;
+  subject?: string;
+  name?: string;
+  email?: string;
+}
+
+export interface PTYPresence extends PTYParticipant {
+  role: PTYRole;
+  attachedAt: string;
+}
+
+export interface PTYPresenceEvent {
+  sessionId: string;
+  participants: PTYPresence[];
+  lockedBy?: string;    // clientId of the input lock holder
+}
+
+export interface PTYControlRequestResult {
+  role: PTYRole;
+  pending?: boolean;    // the drivers, or the lock holder, were asked to grant control
+}
+
+export interface PTYControlRequestedEvent {
+  sessionId: string;
+  from: PTYParticipant;
+}
+
+// Terminal automation
+export interface PTYExpectParams {
+  sessionId: string;
+  pattern?: string;     // RE2 regular expression
+  literal?: string;
+  since?: number;       // match output after this seq; omit for output after the call
+  timeoutMs?: number;   // default 10000, at most 300000
+  raw?: boolean;        // keep escape sequences and control characters
+}
+
+export interface PTYExpectResult {
+  matched: boolean;
+  match?: string;
+  groups?: string[];
+  before: string;       // everything seen when there was no match
+  after: string;
+  seq: number;          // pass as since to the next expect
+  timedOut?: boolean;
+  exited?: boolean;
+}
+
+export interface PTYSendParams {
+  sessionId: string;
+  text?: string;
+  keys?: string[];      // e.g. "enter", "ctrl-c", "up", "alt-b"
+}
+
+export interface PTYSendResult {
+  seq: number;          // output seq before the input was written
+}
+
+export interface PTYSnapshot {
+  text: string;
+  lines: string[];
+  cols: number;
+  rows: number;
+  cursorRow: number;
+  cursorCol: number;
+  altScreen?: boolean;
+  seq: number;
 }
 
 export interface PTYDataEvent {
   sessionId: string;
   data: string;
+  seq?: number;         // total bytes of output up to and including this chunk
+  replay?: boolean;     // scrollback replayed by pty.attach
 }
 
 export interface PTYExitEvent {
@@ -54,6 +137,9 @@ export interface PTYSessionInfo {
   isRemote: boolean;
   isTmux: boolean;
   tmuxSession?: string;
+  recording?: boolean;
+  recordingInput?: boolean;
+  persistent?: boolean; // Guest shell kept alive by the agent across reconnects
 }
 
 export interface PTYListParams {
@@ -70,6 +156,7 @@ export interface PTYGetParams {
 
 export interface PTYGetResult {
   session: PTYSessionInfo;
+  presence: PTYPresenceEvent;
 }
 
 export interface PTYRenameParams {
@@ -93,3 +180,25 @@ export interface PTYTmuxCommandResult {
   output?: string;
   error?: string;
 }
+
+// Session recordings (asciicast v2)
+export interface PTYRecordingInfo {
+  sessionId: string;
+  workspaceId: string;
+  name: string;
+  shell?: string;
+  startedAt: string;
+  updatedAt: string;
+  bytes: number;
+  segments: number;
+  active: boolean;
+}
+
+export interface PTYRecordingGetResult {
+  recording: PTYRecordingInfo;
+  cast: string;       // asciicast v2 text
+}
+
+export interface PTYRecordingListResult {
+  recordings: PTYRecordingInfo[];
+}
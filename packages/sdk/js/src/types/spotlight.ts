@@ -1,7 +1,12 @@
+export type SpotlightProtocol = 'tcp' | 'udp' | 'unix';
+
 export interface SpotlightExposeOptions {
   service: string;
+  protocol?: SpotlightProtocol;
   remotePort: number;
   localPort: number;
+  localPath?: string;
+  remotePath?: string; // Socket path in the workspace; inside the guest for VM backends
   host?: string;
 }
 
@@ -9,9 +14,13 @@ export interface SpotlightForward {
   id: string;
   workspaceId: string;
   service: string;
+  protocol?: SpotlightProtocol;
   remotePort: number;
   localPort: number;
+  localPath?: string;
+  remotePath?: string;
   host: string;
+  sessions?: number;
   createdAt: string;
 }
 
@@ -34,3 +43,38 @@ export interface SpotlightApplyComposePortsResult {
   forwards: SpotlightForward[];
   errors: SpotlightApplyComposePortsError[];
 }
+
+export interface SpotlightShareOptions {
+  port: number;
+  /** Go duration string, e.g. "2h". Defaults to 24h, at most 168h. */
+  ttl?: string;
+  bindAddress?: string;
+  listenPort?: number;
+  readOnly?: boolean;
+  basicAuth?: { username: string; password: string };
+}
+
+export interface SpotlightShare {
+  id: string;
+  workspaceId: string;
+  port: number;
+  url: string;
+  bindAddress: string;
+  listenPort: number;
+  readOnly?: boolean;
+  basicAuthUser?: string;
+  createdAt: string;
+  expiresAt: string;
+  requests: number;
+  lastAccessAt?: string;
+}
+
+export interface SpotlightShareAccess {
+  time: string;
+  remoteAddr: string;
+  method: string;
+  path: string;
+  status: number;
+  bytes: number;
+  durationMs: number;
+}
@@ -1,4 +1,4 @@
-import type { SpotlightForward } from './spotlight';
+import type { SpotlightForward, SpotlightShare } from './spotlight';
 
 export type WorkspaceState = 'created' | 'running' | 'paused' | 'stopped' | 'restored' | 'removed';
 
@@ -42,8 +42,33 @@ export interface WorkspaceRecord {
   updatedAt: string;
 }
 
+export type WorkspaceHookStage = 'onCreate' | 'postStart' | 'preStop' | 'onFork' | 'preRemove';
+
+export interface WorkspaceHookResult {
+  stage: WorkspaceHookStage;
+  name: string;
+  command: string;
+  onFailure: 'abort' | 'warn';
+  exitCode: number;
+  output?: string;
+  error?: string;
+  durationMs: number;
+}
+
+export interface WorkspaceEvent {
+  time: string;
+  kind: string;
+  message: string;
+  hook?: WorkspaceHookResult;
+}
+
+export interface WorkspaceEventsResult {
+  events: WorkspaceEvent[];
+}
+
 export interface WorkspaceCreateResult {
   workspace: WorkspaceRecord;
+  hooks?: WorkspaceHookResult[];
 }
 
 export interface WorkspaceListResult {
@@ -59,12 +84,43 @@ export interface WorkspaceInfo {
   workspace_path: string;
   workspaces?: WorkspaceRecord[];
   spotlight?: SpotlightForward[];
+  shares?: SpotlightShare[];
+  personal?: WorkspacePersonalStatus;
+}
+
+export interface WorkspacePersonalStatus {
+  state: 'applying' | 'applied' | 'failed';
+  revision?: string;
+  error?: string;
+  output?: string;
+  appliedAt: string;
 }
 
+export type WorkspaceReadyCheckType = 'command' | 'service' | 'http' | 'tcp' | 'log' | 'compose-healthy';
+
 export interface WorkspaceReadyCheck {
   name: string;
-  command: string;
+  type?: WorkspaceReadyCheckType;
+  command?: string;
   args?: string[];
+  serviceName?: string;
+  expectRunning?: boolean;
+  url?: string;
+  expectStatus?: number;
+  bodyRegex?: string;
+  host?: string;
+  port?: number;
+  pattern?: string;
+  timeoutMs?: number;
+}
+
+export interface WorkspaceReadyCheckResult {
+  name: string;
+  type: WorkspaceReadyCheckType;
+  ready: boolean;
+  attempts: number;
+  exitCode: number;
+  lastError?: string;
 }
 
 export interface WorkspaceReadyResult {
@@ -74,6 +130,7 @@ export interface WorkspaceReadyResult {
   elapsedMs: number;
   attempts: number;
   lastResults: Record<string, number>;
+  checks: WorkspaceReadyCheckResult[];
 }
 
 export interface WorkspaceStopResult {
@@ -82,16 +139,19 @@ export interface WorkspaceStopResult {
 
 export interface WorkspaceStartResult {
   workspace: WorkspaceRecord;
+  hooks?: WorkspaceHookResult[];
 }
 
 export interface WorkspaceRestoreResult {
   restored: boolean;
   workspace: WorkspaceRecord;
+  hooks?: WorkspaceHookResult[];
 }
 
 export interface WorkspaceForkResult {
   forked: boolean;
   workspace: WorkspaceRecord;
+  hooks?: WorkspaceHookResult[];
 }
 
 export interface Capability {
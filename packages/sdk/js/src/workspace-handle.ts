@@ -4,6 +4,20 @@ import { TunnelOperations } from './spotlight';
 import type { RPCClient } from './rpc/types';
 import {
   ExecOptions,
+  FSApplyPatchOptions,
+  FSCopyOptions,
+  FSEdit,
+  FSFindOptions,
+  FSGrepMatch,
+  FSGrepOptions,
+  FSOpenMode,
+  FSReadRange,
+  FSRenameOptions,
+  FSStatOptions,
+  FSTailChunk,
+  FSTailOptions,
+  FSWatchEvent,
+  FSWatchOptions,
   WorkspaceReadyCheck,
   WorkspaceReadyResult,
   WorkspaceRecord,
@@ -59,8 +73,8 @@ export class WorkspaceHandle {
     return this.execOps.exec(command, args, options);
   }
 
-  async readFile(path: string, encoding: string = 'utf8') {
-    return this.fsOps.readFile(path, encoding);
+  async readFile(path: string, encoding: string = 'utf8', range?: FSReadRange) {
+    return this.fsOps.readFile(path, encoding, range);
   }
 
   async writeFile(path: string, content: string | Buffer) {
@@ -83,7 +97,55 @@ export class WorkspaceHandle {
     await this.fsOps.rm(path, recursive);
   }
 
-  async stat(path: string) {
-    return this.fsOps.stat(path);
+  async stat(path: string, options?: FSStatOptions) {
+    return this.fsOps.stat(path, options);
+  }
+
+  async chmod(path: string, mode: number, recursive?: boolean) {
+    await this.fsOps.chmod(path, mode, recursive);
+  }
+
+  async rename(path: string, newPath: string, options?: FSRenameOptions) {
+    await this.fsOps.rename(path, newPath, options);
+  }
+
+  async symlink(target: string, path: string) {
+    await this.fsOps.symlink(target, path);
+  }
+
+  async readlink(path: string) {
+    return this.fsOps.readlink(path);
+  }
+
+  async copy(path: string, newPath: string, options?: FSCopyOptions) {
+    return this.fsOps.copy(path, newPath, options);
+  }
+
+  async applyPatch(patch: string | FSEdit[], options?: FSApplyPatchOptions) {
+    return this.fsOps.applyPatch(patch, options);
+  }
+
+  async find(path: string, options?: FSFindOptions) {
+    return this.fsOps.find(path, options);
+  }
+
+  async grep(path: string, pattern: string, options?: FSGrepOptions) {
+    return this.fsOps.grep(path, pattern, options);
+  }
+
+  async grepStream(path: string, pattern: string, onMatches: (matches: FSGrepMatch[]) => void, options?: FSGrepOptions) {
+    return this.fsOps.grepStream(path, pattern, onMatches, options);
+  }
+
+  async open(path: string, mode?: FSOpenMode) {
+    return this.fsOps.open(path, mode);
+  }
+
+  async tail(path: string, onData: (chunk: FSTailChunk) => void, options?: FSTailOptions, onEnd?: (error: string) => void) {
+    return this.fsOps.tail(path, onData, options, onEnd);
+  }
+
+  async watch(path: string, onEvents: (events: FSWatchEvent[]) => void, options?: FSWatchOptions, onEnd?: (error: string) => void) {
+    return this.fsOps.watch(path, onEvents, options, onEnd);
   }
 }
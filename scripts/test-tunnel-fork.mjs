@@ -91,41 +91,41 @@ async function main() {
   // ── TUNNEL TESTS ──────────────────────────────────────────────────────────
 
   // Ensure both tunnels deactivated to start fresh
-  await client.rpc('workspace.tunnels.deactivate', { workspaceId: ALPHA_WS }).catch(() => {});
-  await client.rpc('workspace.tunnels.deactivate', { workspaceId: BETA_WS }).catch(() => {});
+  await client.rpc('workspace.tunnels.stop', { workspaceId: ALPHA_WS }).catch(() => {});
+  await client.rpc('workspace.tunnels.stop', { workspaceId: BETA_WS }).catch(() => {});
   await sleep(300);
 
   await runTest('Tunnel: activate alpha succeeds', async () => {
-    const r = await client.rpc('workspace.tunnels.activate', { workspaceId: ALPHA_WS });
+    const r = await client.rpc('workspace.tunnels.start', { workspaceId: ALPHA_WS });
     if (!r.active) throw new Error(`Expected active=true, got ${JSON.stringify(r)}`);
     if (r.activeWorkspaceId !== ALPHA_WS) throw new Error(`Expected activeWorkspaceId=${ALPHA_WS}, got ${r.activeWorkspaceId}`);
     pass('Tunnel: activate alpha succeeds');
   });
 
   await runTest('Tunnel: activate beta while alpha active returns alpha as blocker', async () => {
-    const r = await client.rpc('workspace.tunnels.activate', { workspaceId: BETA_WS });
+    const r = await client.rpc('workspace.tunnels.start', { workspaceId: BETA_WS });
     if (r.active) throw new Error(`Expected active=false (alpha still active), got active=true`);
     if (r.activeWorkspaceId !== ALPHA_WS) throw new Error(`Expected activeWorkspaceId=${ALPHA_WS} (blocking), got ${r.activeWorkspaceId}`);
     pass('Tunnel: activate beta while alpha active returns alpha as blocker');
   });
 
   await runTest('Tunnel: deactivate alpha then activate beta succeeds', async () => {
-    await client.rpc('workspace.tunnels.deactivate', { workspaceId: ALPHA_WS });
+    await client.rpc('workspace.tunnels.stop', { workspaceId: ALPHA_WS });
     await sleep(300);
-    const r = await client.rpc('workspace.tunnels.activate', { workspaceId: BETA_WS });
+    const r = await client.rpc('workspace.tunnels.start', { workspaceId: BETA_WS });
     if (!r.active) throw new Error(`Expected active=true after deactivating alpha, got ${JSON.stringify(r)}`);
     if (r.activeWorkspaceId !== BETA_WS) throw new Error(`Expected activeWorkspaceId=${BETA_WS}, got ${r.activeWorkspaceId}`);
     pass('Tunnel: deactivate alpha then activate beta succeeds');
   });
 
   await runTest('Tunnel: deactivate beta allows alpha to activate again', async () => {
-    await client.rpc('workspace.tunnels.deactivate', { workspaceId: BETA_WS });
+    await client.rpc('workspace.tunnels.stop', { workspaceId: BETA_WS });
     await sleep(300);
-    const r = await client.rpc('workspace.tunnels.activate', { workspaceId: ALPHA_WS });
+    const r = await client.rpc('workspace.tunnels.start', { workspaceId: ALPHA_WS });
     if (!r.active) throw new Error(`Expected active=true, got ${JSON.stringify(r)}`);
     pass('Tunnel: deactivate beta allows alpha to activate again');
     // Clean up: deactivate alpha
-    await client.rpc('workspace.tunnels.deactivate', { workspaceId: ALPHA_WS });
+    await client.rpc('workspace.tunnels.stop', { workspaceId: ALPHA_WS });
   });
 
   // ── FORK + UNSTAGED FILE TESTS ────────────────────────────────────────────